@@ -0,0 +1,31 @@
+package common
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+const (
+	checkEncryptionShortDescription = "Check the encryption configuration"
+	checkEncryptionLongDescription  = "Validates the decryption settings by loading the configured keys " +
+		"which the restore needs, without encrypting anything. Exits with a non-zero code when the settings are " +
+		"partial or the keys can't be loaded."
+)
+
+// CheckEncryptionCmd represents the check-encryption command
+var CheckEncryptionCmd = &cobra.Command{
+	Use:   "check-encryption",
+	Short: checkEncryptionShortDescription,
+	Long:  checkEncryptionLongDescription,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		crypter, err := internal.ConfigureDecryptingCrypter()
+		tracelog.ErrorLogger.FatalOnError(err)
+		if crypter == nil {
+			tracelog.InfoLogger.Println("No crypter is configured")
+			return
+		}
+		tracelog.InfoLogger.Printf("Encryption configuration is valid: %s", crypter.Name())
+	},
+}
@@ -57,4 +57,12 @@ func Init(cmd *cobra.Command, dbName string) {
 
 	// Add storage tools
 	cmd.AddCommand(st.StorageToolsCmd)
+
+	cmd.AddCommand(CompressionBenchmarkCmd)
+
+	cmd.AddCommand(CryptoCmd)
+
+	cmd.AddCommand(VerifySignaturesCmd)
+
+	cmd.AddCommand(CheckEncryptionCmd)
 }
@@ -0,0 +1,52 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+const (
+	compressionBenchmarkShortDescription = "Measures the compression ratio and speed of the supported compression methods"
+	compressionBenchmarkLongDescription  = "Compresses and decompresses the sample with every compression method " +
+		"supported by this build and prints the ratio and throughput in megabytes of uncompressed data per second. " +
+		"Without the sample file the pseudo WAL data is generated."
+)
+
+var (
+	benchmarkSampleSize int
+	benchmarkJSON       bool
+
+	// CompressionBenchmarkCmd represents the compression-benchmark command
+	CompressionBenchmarkCmd = &cobra.Command{
+		Use:   "compression-benchmark [sample_file]",
+		Short: compressionBenchmarkShortDescription,
+		Long:  compressionBenchmarkLongDescription,
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var sample []byte
+			if len(args) > 0 {
+				var err error
+				sample, err = ioutil.ReadFile(args[0])
+				tracelog.ErrorLogger.FatalOnError(err)
+			} else {
+				sample = internal.GenerateCompressionBenchmarkSample(benchmarkSampleSize << 20)
+			}
+
+			err := internal.HandleCompressionBenchmark(sample, benchmarkJSON, os.Stdout)
+			tracelog.ErrorLogger.FatalOnError(err)
+		},
+	}
+)
+
+func init() {
+	CompressionBenchmarkCmd.Flags().IntVar(&benchmarkSampleSize, "size", 64,
+		"Size of the generated sample in megabytes")
+	CompressionBenchmarkCmd.Flags().BoolVar(&benchmarkJSON, "json", false, "Prints output in json format")
+
+	// the benchmark doesn't touch the storage, so the storage settings are not required
+	CompressionBenchmarkCmd.PersistentPreRun = func(*cobra.Command, []string) {}
+}
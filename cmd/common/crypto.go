@@ -0,0 +1,96 @@
+package common
+
+import (
+	"context"
+	"os"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/crypto"
+	"github.com/wal-g/wal-g/internal/storagetools"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	cryptoShortDescription = "Encryption key management"
+	rotateShortDescription = "Re-encrypt the storage objects with the new key"
+	rotateLongDescription  = "Re-encrypts every object under the prefix which is decrypted by the old keys, " +
+		"set by WALG_PGP_DECRYPTION_KEY_PATHS, with the key of the encryption settings, e.g. WALG_PGP_KEY_PATH. " +
+		"The objects are not decompressed. The interrupted rotation is resumed by running it again."
+	checkShortDescription = "Check that the crypter encrypts and decrypts"
+	checkLongDescription  = "Encrypts and decrypts the test payload with the configured crypter, " +
+		"to find the missing or mismatched keys before the restore. Exits with the non-zero status on failure."
+)
+
+var (
+	rotatePrefix      string
+	rotateConcurrency int
+
+	// CryptoCmd represents the crypto command
+	CryptoCmd = &cobra.Command{
+		Use:   "crypto",
+		Short: cryptoShortDescription,
+	}
+
+	rotateCmd = &cobra.Command{
+		Use:   "rotate [--prefix folder]",
+		Short: rotateShortDescription,
+		Long:  rotateLongDescription,
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			// the interrupted rotation kills the encryption and decryption commands
+			ctx, cancel := context.WithCancel(context.Background())
+			signalHandler := utility.NewSignalHandler(ctx, cancel, []os.Signal{syscall.SIGINT, syscall.SIGTERM})
+			defer func() { _ = signalHandler.Close() }()
+
+			folder, err := internal.ConfigureFolder()
+			tracelog.ErrorLogger.FatalOnError(err)
+			if rotatePrefix != "" {
+				folder = folder.GetSubFolder(rotatePrefix)
+			}
+
+			newCrypter, err := internal.ConfigureEncryptionCrypterContext(ctx)
+			tracelog.ErrorLogger.FatalOnError(err)
+			_, oldKeysSet := internal.GetSetting(internal.PgpDecryptionKeyPathsSetting)
+			if newCrypter == nil || !oldKeysSet {
+				tracelog.ErrorLogger.Fatalf("Both the new key and the old keys in %s must be configured",
+					internal.PgpDecryptionKeyPathsSetting)
+			}
+
+			crypter, err := internal.ConfigureDecryptingCrypterContext(ctx)
+			tracelog.ErrorLogger.FatalOnError(err)
+			rotator := storagetools.NewKeyRotator(folder, crypter, newCrypter)
+			err = storagetools.HandleKeyRotation(rotator, rotateConcurrency)
+			tracelog.ErrorLogger.FatalOnError(err)
+		},
+	}
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: checkShortDescription,
+	Long:  checkLongDescription,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		crypter, err := internal.ConfigureCrypter()
+		tracelog.ErrorLogger.FatalOnError(err)
+		if crypter == nil {
+			tracelog.ErrorLogger.Fatal("No crypter is configured")
+		}
+		if err := crypto.CheckRoundTrip(crypter); err != nil {
+			tracelog.ErrorLogger.Fatalf("Crypter %s check failed: %v", crypter.Name(), err)
+		}
+		tracelog.InfoLogger.Printf("Crypter %s encrypts and decrypts successfully", crypter.Name())
+	},
+}
+
+func init() {
+	CryptoCmd.AddCommand(checkCmd)
+	CryptoCmd.AddCommand(rotateCmd)
+	rotateCmd.Flags().StringVar(&rotatePrefix, "prefix", "",
+		"Storage folder to re-encrypt the objects in recursively, e.g. basebackups_005/")
+	rotateCmd.Flags().IntVar(&rotateConcurrency, "concurrency", 4,
+		"Number of objects re-encrypted concurrently")
+}
@@ -0,0 +1,15 @@
+package st
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCatObjectCmd_flags(t *testing.T) {
+	assert.NotNil(t, catObjectCmd.Flags().Lookup(decryptFlag))
+	assert.NotNil(t, catObjectCmd.Flags().Lookup(decompressFlag))
+	// get decrypts and decompresses by default, its flags turn it off
+	assert.Nil(t, getObjectCmd.Flags().Lookup(decryptFlag))
+	assert.Nil(t, getObjectCmd.Flags().Lookup(decompressFlag))
+}
@@ -0,0 +1,61 @@
+package st
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/storagetools"
+)
+
+const (
+	copyShortDescription = "Copy the storage objects to another storage"
+
+	copyFromFlag       = "from"
+	copyToFlag         = "to"
+	copyFromConfigFlag = "from-config"
+	copyToConfigFlag   = "to-config"
+	copyFilterFlag     = "filter"
+)
+
+// copyCmd represents the copy command
+var copyCmd = &cobra.Command{
+	Use:   "copy --from prefix --to prefix [--from-config file] [--to-config file] [--filter glob]",
+	Short: copyShortDescription,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		source, err := internal.ConfigureFolderForPrefixFromFile(copyFrom, copyFromConfig)
+		tracelog.ErrorLogger.FatalOnError(err)
+		destination, err := internal.ConfigureFolderForPrefixFromFile(copyTo, copyToConfig)
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		copier, err := storagetools.NewCopier(source, destination, copyFilter)
+		tracelog.ErrorLogger.FatalOnError(err)
+		err = storagetools.HandleCopy(copier, copyConcurrency)
+		tracelog.ErrorLogger.FatalOnError(err)
+	},
+}
+
+var copyFrom string
+var copyTo string
+var copyFromConfig string
+var copyToConfig string
+var copyFilter string
+var copyConcurrency int
+
+func init() {
+	StorageToolsCmd.AddCommand(copyCmd)
+	copyCmd.Flags().StringVar(&copyFrom, copyFromFlag, "",
+		"Storage prefix to copy the objects from recursively, e.g. s3://bucket/path")
+	copyCmd.Flags().StringVar(&copyTo, copyToFlag, "",
+		"Storage prefix to copy the objects to, e.g. s3://another-bucket/path")
+	copyCmd.Flags().StringVar(&copyFromConfig, copyFromConfigFlag, "",
+		"Config file with the storage settings of the source, e.g. its credentials, the global config by default")
+	copyCmd.Flags().StringVar(&copyToConfig, copyToConfigFlag, "",
+		"Config file with the storage settings of the destination, the global config by default")
+	copyCmd.Flags().StringVar(&copyFilter, copyFilterFlag, "",
+		"Glob of the object names relative to the source prefix to copy, e.g. 'basebackups_005/**'")
+	copyCmd.Flags().IntVar(&copyConcurrency, concurrencyFlag, 8,
+		"Number of objects copied concurrently")
+	_ = copyCmd.MarkFlagRequired(copyFromFlag)
+	_ = copyCmd.MarkFlagRequired(copyToFlag)
+}
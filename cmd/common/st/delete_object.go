@@ -7,21 +7,24 @@ import (
 	"github.com/wal-g/wal-g/internal/storagetools"
 )
 
-const deleteObjectShortDescription = "Delete the specified storage object"
+const deleteObjectShortDescription = "Delete the specified storage object, add --confirm to actually delete it"
 
 // deleteObjectCmd represents the deleteObject command
 var deleteObjectCmd = &cobra.Command{
-	Use:   "rm relative_object_path",
+	Use:   "rm relative_object_path [--confirm]",
 	Short: deleteObjectShortDescription,
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		folder, err := internal.ConfigureFolder()
 		tracelog.ErrorLogger.FatalOnError(err)
 
-		storagetools.HandleDeleteObject(args[0], folder)
+		storagetools.HandleDeleteObject(args[0], folder, deleteObjectConfirmed)
 	},
 }
 
+var deleteObjectConfirmed bool
+
 func init() {
+	deleteObjectCmd.Flags().BoolVar(&deleteObjectConfirmed, internal.ConfirmFlag, false, "Confirms the object deletion")
 	StorageToolsCmd.AddCommand(deleteObjectCmd)
 }
@@ -0,0 +1,70 @@
+package st
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/storagetools"
+)
+
+const (
+	recompressShortDescription = "Convert the storage objects to another compression method"
+
+	fromExtensionFlag = "from-ext"
+	toMethodFlag      = "to"
+	prefixFlag        = "prefix"
+	keepOriginalFlag  = "keep-original"
+	concurrencyFlag   = "concurrency"
+)
+
+// recompressCmd represents the recompress command
+var recompressCmd = &cobra.Command{
+	Use:   "recompress --from-ext extension --to method [--prefix folder]",
+	Short: recompressShortDescription,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		folder, err := internal.ConfigureFolder()
+		tracelog.ErrorLogger.FatalOnError(err)
+		if recompressPrefix != "" {
+			folder = folder.GetSubFolder(recompressPrefix)
+		}
+
+		compressor, ok := compression.Compressors[recompressToMethod]
+		if !ok {
+			tracelog.ErrorLogger.Fatalf("Unknown compression method '%s', supported methods are: %v",
+				recompressToMethod, compression.CompressingAlgorithms)
+		}
+
+		crypter, err := internal.ConfigureDecryptingCrypter()
+		tracelog.ErrorLogger.FatalOnError(err)
+		recompressor, err := storagetools.NewRecompressor(folder, recompressFromExtension, compressor,
+			crypter, keepOriginal)
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		err = storagetools.HandleRecompress(recompressor, recompressConcurrency)
+		tracelog.ErrorLogger.FatalOnError(err)
+	},
+}
+
+var recompressFromExtension string
+var recompressToMethod string
+var recompressPrefix string
+var keepOriginal bool
+var recompressConcurrency int
+
+func init() {
+	StorageToolsCmd.AddCommand(recompressCmd)
+	recompressCmd.Flags().StringVar(&recompressFromExtension, fromExtensionFlag, "",
+		"Extension of the objects to convert, e.g. lz4")
+	recompressCmd.Flags().StringVar(&recompressToMethod, toMethodFlag, "",
+		"Compression method to convert to, e.g. zstd")
+	recompressCmd.Flags().StringVar(&recompressPrefix, prefixFlag, "",
+		"Storage folder to convert the objects in recursively, e.g. basebackups_005/")
+	recompressCmd.Flags().BoolVar(&keepOriginal, keepOriginalFlag, false,
+		"Do not delete the original objects after conversion")
+	recompressCmd.Flags().IntVar(&recompressConcurrency, concurrencyFlag, 4,
+		"Number of objects converted concurrently")
+	_ = recompressCmd.MarkFlagRequired(fromExtensionFlag)
+	_ = recompressCmd.MarkFlagRequired(toMethodFlag)
+}
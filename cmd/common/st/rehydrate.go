@@ -0,0 +1,62 @@
+package st
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/storagetools"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+const (
+	rehydrateShortDescription = "Rehydrate the archived objects of the storage folder, e.g. from S3 Glacier or Azure Archive"
+
+	rehydratePrefixFlag   = "prefix"
+	rehydrateDaysFlag     = "days"
+	rehydratePriorityFlag = "priority"
+	rehydrateWaitFlag     = "wait"
+)
+
+// rehydrateCmd represents the rehydrate command
+var rehydrateCmd = &cobra.Command{
+	Use:   "rehydrate --prefix relative/folder/path [--days N] [--priority bulk|standard|high] [--wait interval]",
+	Short: rehydrateShortDescription,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		folder, err := internal.ConfigureFolder()
+		tracelog.ErrorLogger.FatalOnError(err)
+		if rehydratePrefix != "" {
+			folder = folder.GetSubFolder(rehydratePrefix)
+		}
+
+		priority, err := storage.ParseRehydratePriority(rehydratePriority)
+		tracelog.ErrorLogger.FatalOnError(err)
+		rehydrator, err := storagetools.NewRehydrator(folder,
+			storage.RehydrateOptions{Days: rehydrateDays, Priority: priority}, rehydrateConcurrency)
+		tracelog.ErrorLogger.FatalOnError(err)
+		err = storagetools.HandleRehydrate(rehydrator, rehydrateWait)
+		tracelog.ErrorLogger.FatalOnError(err)
+	},
+}
+
+var rehydratePrefix string
+var rehydrateDays int
+var rehydratePriority string
+var rehydrateWait time.Duration
+var rehydrateConcurrency int
+
+func init() {
+	StorageToolsCmd.AddCommand(rehydrateCmd)
+	rehydrateCmd.Flags().StringVar(&rehydratePrefix, rehydratePrefixFlag, "",
+		"Folder of the configured storage to rehydrate recursively, e.g. basebackups_005/base_000000010000000000000003")
+	rehydrateCmd.Flags().IntVar(&rehydrateDays, rehydrateDaysFlag, 7,
+		"Days the rehydrated copy of the S3 object is kept for, Azure moves the blob to the Hot tier for good")
+	rehydrateCmd.Flags().StringVar(&rehydratePriority, rehydratePriorityFlag, string(storage.RehydratePriorityStandard),
+		"Rehydration priority: bulk, standard or high")
+	rehydrateCmd.Flags().DurationVar(&rehydrateWait, rehydrateWaitFlag, 0,
+		"Poll the objects at the interval until all of them are readable, e.g. 10m")
+	rehydrateCmd.Flags().IntVar(&rehydrateConcurrency, concurrencyFlag, 8,
+		"Number of objects checked and rehydrated concurrently")
+}
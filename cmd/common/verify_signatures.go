@@ -0,0 +1,53 @@
+package common
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/storagetools"
+)
+
+const (
+	verifySignaturesShortDescription = "Verify the signatures of the storage objects"
+	verifySignaturesLongDescription  = "Checks the detached signature of every object under the prefix " +
+		"with the key of WALG_VERIFY_ED25519_KEY or WALG_VERIFY_PGP_KEY_PATH. The objects without the signature " +
+		"are reported, the objects which don't match the signature fail the command."
+)
+
+var (
+	verifySignaturesPrefix      string
+	verifySignaturesConcurrency int
+
+	// VerifySignaturesCmd represents the verify-signatures command
+	VerifySignaturesCmd = &cobra.Command{
+		Use:   "verify-signatures [--prefix folder]",
+		Short: verifySignaturesShortDescription,
+		Long:  verifySignaturesLongDescription,
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			folder, err := internal.ConfigureFolder()
+			tracelog.ErrorLogger.FatalOnError(err)
+			if verifySignaturesPrefix != "" {
+				folder = folder.GetSubFolder(verifySignaturesPrefix)
+			}
+
+			verifier, err := internal.ConfigureSignatureVerifier()
+			tracelog.ErrorLogger.FatalOnError(err)
+			if verifier == nil {
+				tracelog.ErrorLogger.Fatalf("%s or %s must be set to verify the signatures",
+					internal.VerifyEd25519KeySetting, internal.VerifyPgpKeyPathSetting)
+			}
+
+			signatureVerifier := storagetools.NewSignatureVerifier(folder, verifier)
+			err = storagetools.HandleSignatureVerification(signatureVerifier, verifySignaturesConcurrency)
+			tracelog.ErrorLogger.FatalOnError(err)
+		},
+	}
+)
+
+func init() {
+	VerifySignaturesCmd.Flags().StringVar(&verifySignaturesPrefix, "prefix", "",
+		"Storage folder to verify the objects in recursively, e.g. basebackups_005/")
+	VerifySignaturesCmd.Flags().IntVar(&verifySignaturesConcurrency, "concurrency", 4,
+		"Number of objects verified concurrently")
+}
@@ -48,7 +48,8 @@ var backupPushCmd = &cobra.Command{
 		backupCmd, err := internal.GetCommandSettingContext(ctx, internal.NameStreamCreateCmd)
 		tracelog.ErrorLogger.FatalOnError(err)
 		backupCmd.Stderr = os.Stderr
-		uploader := archive.NewStorageUploader(uplProvider)
+		uploader, err := archive.NewStorageUploader(uplProvider)
+		tracelog.ErrorLogger.FatalOnError(err)
 		metaConstructor := archive.NewBackupMongoMetaConstructor(ctx, mongoClient, uplProvider.Folder(), permanent)
 
 		err = mongo.HandleBackupPush(uploader, metaConstructor, backupCmd)
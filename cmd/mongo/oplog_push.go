@@ -59,7 +59,10 @@ func runOplogPush(ctx context.Context, pushArgs oplogPushRunArgs, statsArgs oplo
 		return err
 	}
 	uplProvider.ChangeDirectory(models.OplogArchBasePath)
-	uploader := archive.NewStorageUploader(uplProvider)
+	uploader, err := archive.NewStorageUploader(uplProvider)
+	if err != nil {
+		return err
+	}
 
 	// set up mongodb client and oplog fetcher
 	mongoClient, err := client.NewMongoClient(ctx, pushArgs.mongodbURL)
@@ -21,6 +21,9 @@ For information about pattern syntax view: https://golang.org/pkg/path/filepath/
 	reverseDeltaUnpackDescription = "Unpack delta backups in reverse order (beta feature)"
 	skipRedundantTarsDescription  = "Skip tars with no useful data (requires reverse delta unpack)"
 	targetUserDataDescription     = "Fetch storage backup which has the specified user data"
+	verifySignatureDescription    = "Verify the signature of every file before extracting it"
+	checkTierDescription          = "Check the storage tier of every file before the download " +
+		"and fail listing the archived ones, which have to be rehydrated by 'wal-g st rehydrate' first"
 )
 
 var fileMask string
@@ -28,6 +31,8 @@ var restoreSpec string
 var reverseDeltaUnpack bool
 var skipRedundantTars bool
 var fetchTargetUserData string
+var backupFetchVerifySignature bool
+var backupFetchCheckTier bool
 
 var backupFetchCmd = &cobra.Command{
 	Use:   "backup-fetch destination_directory [backup_name | --target-user-data <data>]",
@@ -42,6 +47,12 @@ var backupFetchCmd = &cobra.Command{
 
 		folder, err := internal.ConfigureFolder()
 		tracelog.ErrorLogger.FatalOnError(err)
+		if backupFetchVerifySignature {
+			viper.Set(internal.VerifySignatureSetting, true)
+		}
+		if backupFetchCheckTier {
+			viper.Set(internal.CheckStorageTierSetting, true)
+		}
 
 		var pgFetcher func(folder storage.Folder, backup internal.Backup)
 		reverseDeltaUnpack = reverseDeltaUnpack || viper.GetBool(internal.UseReverseUnpackSetting)
@@ -81,5 +92,9 @@ func init() {
 		false, skipRedundantTarsDescription)
 	backupFetchCmd.Flags().StringVar(&fetchTargetUserData, "target-user-data",
 		"", targetUserDataDescription)
+	backupFetchCmd.Flags().BoolVar(&backupFetchVerifySignature, "verify-signature",
+		false, verifySignatureDescription)
+	backupFetchCmd.Flags().BoolVar(&backupFetchCheckTier, "check-tier",
+		false, checkTierDescription)
 	Cmd.AddCommand(backupFetchCmd)
 }
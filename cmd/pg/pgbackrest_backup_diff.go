@@ -0,0 +1,37 @@
+package pg
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/pgbackrest"
+)
+
+const (
+	pgbackrestBackupDiffShortDescription = "Prints the files added, removed and changed between two pgbackrest backups"
+	backupDiffSummaryFlag                = "summary"
+)
+
+var backupDiffSummary bool
+
+var pgbackrestBackupDiffCmd = &cobra.Command{
+	Use:   "backup-diff from-backup-name to-backup-name",
+	Short: pgbackrestBackupDiffShortDescription,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		folder, stanza := configurePgbackrestSettings()
+		fromSelector := pgbackrest.NewBackupSelector(args[0], stanza)
+		toSelector := pgbackrest.NewBackupSelector(args[1], stanza)
+		err := pgbackrest.HandleBackupDiff(folder, stanza, fromSelector, toSelector, backupDiffSummary, json, os.Stdout)
+		tracelog.ErrorLogger.FatalOnError(err)
+	},
+}
+
+func init() {
+	pgbackrestCmd.AddCommand(pgbackrestBackupDiffCmd)
+
+	pgbackrestBackupDiffCmd.Flags().BoolVar(&json, JSONFlag, false, "Prints output in json format")
+	pgbackrestBackupDiffCmd.Flags().BoolVar(&backupDiffSummary, backupDiffSummaryFlag, false,
+		"Prints only the counts of the files and the total size of the added and changed files")
+}
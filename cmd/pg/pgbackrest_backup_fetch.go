@@ -1,25 +1,133 @@
 package pg
 
 import (
+	"fmt"
+
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
 	"github.com/wal-g/wal-g/internal/pgbackrest"
 )
 
+const (
+	targetLsnDescription = "Fetch the latest backup finished at or before the specified LSN (X/Y)"
+	toArchiveDescription = "Write the backup to the local tar file instead of the destination directory, " +
+		"compressed if the name ends with the compression extension, e.g. backup.tar.zst"
+	strictListingDescription = "Fail the fetch if some backup folder can't be listed after the retries " +
+		"instead of skipping it"
+	parallelVerifyDescription = "Compare the restored files with the checksums of the backup manifest, " +
+		"hashing WALG_DOWNLOAD_CONCURRENCY files at once, and fail the fetch listing all the mismatches"
+	decompressNestedDescription = "Decompress the files inside the backup archives which have the extension " +
+		"of a known compression, e.g. the gzipped files of the gzipped tar, and restore them without the extension"
+	flattenDescription = "Take every file from the backup its manifest reference names, like the pgbackrest restore, " +
+		"and fail if any of them is missing"
+	deltaDescription = "Restore over the existing destination directory: keep the files which match " +
+		"the size and the checksum of the backup manifest, fetch the rest and remove the files the backup doesn't have"
+	recoveryTargetTimeDescription = "Write recovery_target_time to postgresql.auto.conf of the restored cluster " +
+		"and create recovery.signal, so it recovers to the time when started"
+	standbyDescription         = "Create standby.signal, so the restored cluster is started as the standby"
+	recoverySettingDescription = "Write the key=value setting to postgresql.auto.conf of the restored cluster " +
+		"and create recovery.signal, e.g. restore_command='wal-g wal-fetch %f %p', may be repeated"
+	recoveryConfigTemplateDescription = "Write the settings of the file to postgresql.auto.conf of the restored " +
+		"cluster and create recovery.signal, the --recovery-setting flags override them"
+)
+
+var (
+	pgbackrestTargetLsn        string
+	pgbackrestToArchive        string
+	pgbackrestStrictListing    bool
+	pgbackrestParallelVerify   bool
+	pgbackrestDecompressNested bool
+	pgbackrestFlatten          bool
+	pgbackrestCheckTier        bool
+	pgbackrestDelta            bool
+
+	pgbackrestRecoveryTargetTime     string
+	pgbackrestStandby                bool
+	pgbackrestRecoverySettings       []string
+	pgbackrestRecoveryConfigTemplate string
+)
+
 var pgbackrestBackupFetchCmd = &cobra.Command{
-	Use:   "backup-fetch destination-directory backup-name",
+	Use:   "backup-fetch (destination-directory | --to-archive archive.tar) [backup-name | --target-lsn X/Y]",
 	Short: backupFetchShortDescription,
-	Args:  cobra.ExactArgs(2),
+	Args:  cobra.RangeArgs(0, 2),
 	Run: func(cmd *cobra.Command, args []string) {
-		destinationDirectory := args[0]
-		backupName := args[1]
 		folder, stanza := configurePgbackrestSettings()
-		backupSelector := pgbackrest.NewBackupSelector(backupName, stanza)
-		err := pgbackrest.HandlePgbackrestBackupFetch(folder, stanza, destinationDirectory, backupSelector)
+		if pgbackrestCheckTier {
+			viper.Set(internal.CheckStorageTierSetting, true)
+		}
+		if pgbackrestToArchive != "" {
+			backupSelector, err := createPgbackrestBackupSelector(cmd, args, stanza)
+			tracelog.ErrorLogger.FatalOnError(err)
+			err = pgbackrest.HandlePgbackrestBackupFetchToArchive(folder, stanza, pgbackrestToArchive, backupSelector,
+				pgbackrestStrictListing, pgbackrestFlatten)
+			tracelog.ErrorLogger.FatalOnError(err)
+			return
+		}
+
+		if len(args) == 0 {
+			fmt.Println(cmd.UsageString())
+			tracelog.ErrorLogger.Fatal("destination directory is not specified")
+		}
+		destinationDirectory := args[0]
+		backupSelector, err := createPgbackrestBackupSelector(cmd, args[1:], stanza)
+		tracelog.ErrorLogger.FatalOnError(err)
+		recoveryConfig, err := pgbackrest.NewRecoveryConfig(pgbackrestRecoveryConfigTemplate,
+			pgbackrestRecoverySettings, pgbackrestRecoveryTargetTime, pgbackrestStandby)
+		tracelog.ErrorLogger.FatalOnError(err)
+		err = pgbackrest.HandlePgbackrestBackupFetch(folder, stanza, destinationDirectory, backupSelector,
+			pgbackrest.FetchOptions{
+				StrictListing:    pgbackrestStrictListing,
+				ParallelVerify:   pgbackrestParallelVerify,
+				DecompressNested: pgbackrestDecompressNested,
+				Flatten:          pgbackrestFlatten,
+				Delta:            pgbackrestDelta,
+				RecoveryConfig:   recoveryConfig,
+			})
 		tracelog.ErrorLogger.FatalOnError(err)
 	},
 }
 
+// createPgbackrestBackupSelector selects the backup by the name from backupNameArgs or by the target LSN
+func createPgbackrestBackupSelector(cmd *cobra.Command, backupNameArgs []string,
+	stanza string) (internal.BackupSelector, error) {
+	var err error
+	switch {
+	case len(backupNameArgs) > 1:
+		err = errors.New("incorrect arguments. Too many arguments")
+	case len(backupNameArgs) == 1 && pgbackrestTargetLsn != "":
+		err = errors.New("incorrect arguments. Specify target backup name OR target LSN, not both")
+	case len(backupNameArgs) == 1:
+		return pgbackrest.NewBackupSelector(backupNameArgs[0], stanza), nil
+	case pgbackrestTargetLsn != "":
+		tracelog.InfoLogger.Printf("Selecting the latest backup finished before LSN %s...\n", pgbackrestTargetLsn)
+		return pgbackrest.NewLsnBackupSelector(pgbackrestTargetLsn, stanza)
+	default:
+		err = errors.New("insufficient arguments")
+	}
+	fmt.Println(cmd.UsageString())
+	return nil, err
+}
+
 func init() {
+	pgbackrestBackupFetchCmd.Flags().StringVar(&pgbackrestTargetLsn, "target-lsn", "", targetLsnDescription)
+	pgbackrestBackupFetchCmd.Flags().StringVar(&pgbackrestToArchive, "to-archive", "", toArchiveDescription)
+	pgbackrestBackupFetchCmd.Flags().BoolVar(&pgbackrestStrictListing, "strict-listing", false, strictListingDescription)
+	pgbackrestBackupFetchCmd.Flags().BoolVar(&pgbackrestParallelVerify, "parallel-verify", false, parallelVerifyDescription)
+	pgbackrestBackupFetchCmd.Flags().BoolVar(&pgbackrestDecompressNested, "decompress-nested", false,
+		decompressNestedDescription)
+	pgbackrestBackupFetchCmd.Flags().BoolVar(&pgbackrestFlatten, "flatten", false, flattenDescription)
+	pgbackrestBackupFetchCmd.Flags().BoolVar(&pgbackrestDelta, "delta", false, deltaDescription)
+	pgbackrestBackupFetchCmd.Flags().BoolVar(&pgbackrestCheckTier, "check-tier", false, checkTierDescription)
+	pgbackrestBackupFetchCmd.Flags().StringVar(&pgbackrestRecoveryTargetTime, "recovery-target-time", "",
+		recoveryTargetTimeDescription)
+	pgbackrestBackupFetchCmd.Flags().BoolVar(&pgbackrestStandby, "standby", false, standbyDescription)
+	pgbackrestBackupFetchCmd.Flags().StringArrayVar(&pgbackrestRecoverySettings, "recovery-setting", nil,
+		recoverySettingDescription)
+	pgbackrestBackupFetchCmd.Flags().StringVar(&pgbackrestRecoveryConfigTemplate, "recovery-config-template", "",
+		recoveryConfigTemplateDescription)
 	pgbackrestCmd.AddCommand(pgbackrestBackupFetchCmd)
 }
@@ -6,13 +6,19 @@ import (
 	"github.com/wal-g/wal-g/internal/pgbackrest"
 )
 
+var (
+	pgbackrestBackupType     string
+	pgbackrestIncludeHistory bool
+)
+
 var pgbackrestBackupListCmd = &cobra.Command{
 	Use:   "backup-list",
 	Short: backupListShortDescription,
 	Args:  cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
 		folder, stanza := configurePgbackrestSettings()
-		err := pgbackrest.HandleBackupList(folder, stanza, detail, pretty, json)
+		err := pgbackrest.HandleBackupList(folder, stanza, pgbackrestBackupType, pgbackrestIncludeHistory,
+			detail, pretty, json)
 		tracelog.ErrorLogger.FatalOnError(err)
 	},
 }
@@ -23,4 +29,8 @@ func init() {
 	pgbackrestBackupListCmd.Flags().BoolVar(&pretty, PrettyFlag, false, "Prints more readable output")
 	pgbackrestBackupListCmd.Flags().BoolVar(&json, JSONFlag, false, "Prints output in json format")
 	pgbackrestBackupListCmd.Flags().BoolVar(&detail, DetailFlag, false, "Prints extra backup details")
+	pgbackrestBackupListCmd.Flags().StringVar(&pgbackrestBackupType, "type", "",
+		"Prints only the backups of the type: full, diff or incr")
+	pgbackrestBackupListCmd.Flags().BoolVar(&pgbackrestIncludeHistory, "include-history", false,
+		"Prints the backups of backup:history pending expiration as well, fails if backup.info has no such section")
 }
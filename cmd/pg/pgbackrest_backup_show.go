@@ -0,0 +1,29 @@
+package pg
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/pgbackrest"
+)
+
+const pgbackrestBackupShowShortDescription = "Prints the details and annotations of a pgbackrest backup"
+
+var pgbackrestBackupShowCmd = &cobra.Command{
+	Use:   "backup-show backup-name",
+	Short: pgbackrestBackupShowShortDescription,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		folder, stanza := configurePgbackrestSettings()
+		backupSelector := pgbackrest.NewBackupSelector(args[0], stanza)
+		err := pgbackrest.HandleBackupShow(folder, stanza, backupSelector, json, os.Stdout)
+		tracelog.ErrorLogger.FatalOnError(err)
+	},
+}
+
+func init() {
+	pgbackrestCmd.AddCommand(pgbackrestBackupShowCmd)
+
+	pgbackrestBackupShowCmd.Flags().BoolVar(&json, JSONFlag, false, "Prints output in json format")
+}
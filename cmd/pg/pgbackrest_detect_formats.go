@@ -0,0 +1,33 @@
+package pg
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/pgbackrest"
+)
+
+const pgbackrestDetectFormatsShortDescription = "Detects the format of every backup file by its header"
+
+var pgbackrestDetectFormatsCmd = &cobra.Command{
+	Use:   "detect-formats [stanza]",
+	Short: pgbackrestDetectFormatsShortDescription,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		folder, stanza := configurePgbackrestSettings()
+		if len(args) > 0 {
+			stanza = args[0]
+		}
+		concurrency, err := internal.GetMaxDownloadConcurrency()
+		tracelog.ErrorLogger.FatalOnError(err)
+
+		err = pgbackrest.HandleDetectFormats(folder, stanza, concurrency, os.Stdout)
+		tracelog.ErrorLogger.FatalOnError(err)
+	},
+}
+
+func init() {
+	pgbackrestCmd.AddCommand(pgbackrestDetectFormatsCmd)
+}
@@ -0,0 +1,41 @@
+package pg
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/pgbackrest"
+)
+
+const (
+	pgbackrestExportSentinelShortDescription = "Writes the WAL-G sentinel and metadata of a pgbackrest backup"
+	exportedBackupNameFlag                   = "name"
+	exportTargetFlag                         = "to"
+)
+
+var exportedBackupName string
+var exportTarget string
+
+var pgbackrestExportSentinelCmd = &cobra.Command{
+	Use:   "export-sentinel backup-name --to prefix",
+	Short: pgbackrestExportSentinelShortDescription,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		folder, stanza := configurePgbackrestSettings()
+		targetFolder, err := internal.ConfigureFolderForPrefix(exportTarget)
+		tracelog.ErrorLogger.FatalOnError(err)
+		backupSelector := pgbackrest.NewBackupSelector(args[0], stanza)
+		err = pgbackrest.HandleExportSentinel(folder, targetFolder, stanza, backupSelector, exportedBackupName)
+		tracelog.ErrorLogger.FatalOnError(err)
+	},
+}
+
+func init() {
+	pgbackrestCmd.AddCommand(pgbackrestExportSentinelCmd)
+
+	pgbackrestExportSentinelCmd.Flags().StringVar(&exportedBackupName, exportedBackupNameFlag, "",
+		"Name of the exported WAL-G backup, base_<first WAL segment> by default")
+	pgbackrestExportSentinelCmd.Flags().StringVar(&exportTarget, exportTargetFlag, "",
+		"Storage prefix of the WAL-G backups to write the sentinel to, e.g. s3://bucket/walg")
+	_ = pgbackrestExportSentinelCmd.MarkFlagRequired(exportTargetFlag)
+}
@@ -0,0 +1,25 @@
+package pg
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/wal-g/wal-g/internal/compression"
+)
+
+const pgbackrestFormatsShortDescription = "Lists the extensions of the backup files which can be extracted"
+
+var pgbackrestFormatsCmd = &cobra.Command{
+	Use:   "formats",
+	Short: pgbackrestFormatsShortDescription,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, extension := range compression.SupportedExtensions() {
+			fmt.Println(extension)
+		}
+	},
+}
+
+func init() {
+	pgbackrestCmd.AddCommand(pgbackrestFormatsCmd)
+}
@@ -0,0 +1,50 @@
+package pg
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/pgbackrest"
+)
+
+const (
+	pgbackrestWalVerifyShortDescription = "Check that WAL archive has no gaps between two segments"
+	fromBackupFlag                      = "from-backup"
+	fromBackupDescription               = "Check WAL starting from the first segment of the backup instead of start-segment"
+)
+
+var pgbackrestFromBackup string
+
+var pgbackrestWalVerifyCmd = &cobra.Command{
+	Use:   "wal-verify [start-segment | --from-backup backup-name] end-segment",
+	Short: pgbackrestWalVerifyShortDescription,
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		folder, stanza := configurePgbackrestSettings()
+		var startSegment, endSegment string
+		if pgbackrestFromBackup != "" {
+			if len(args) != 1 {
+				tracelog.ErrorLogger.Fatal("specify either start segment or --from-backup, not both")
+			}
+			backupName, err := pgbackrest.NewBackupSelector(pgbackrestFromBackup, stanza).Select(folder)
+			tracelog.ErrorLogger.FatalOnError(err)
+			backupDetails, err := pgbackrest.GetBackupDetails(folder, stanza, backupName)
+			tracelog.ErrorLogger.FatalOnError(err)
+			startSegment, endSegment = backupDetails.WalFileName, args[0]
+		} else {
+			if len(args) != 2 {
+				tracelog.ErrorLogger.Fatal("insufficient arguments")
+			}
+			startSegment, endSegment = args[0], args[1]
+		}
+		err := pgbackrest.HandleWalVerify(folder, stanza, startSegment, endSegment, json, os.Stdout)
+		tracelog.ErrorLogger.FatalOnError(err)
+	},
+}
+
+func init() {
+	pgbackrestWalVerifyCmd.Flags().StringVar(&pgbackrestFromBackup, fromBackupFlag, "", fromBackupDescription)
+	pgbackrestWalVerifyCmd.Flags().BoolVar(&json, JSONFlag, false, "Prints output in json format")
+	pgbackrestCmd.AddCommand(pgbackrestWalVerifyCmd)
+}
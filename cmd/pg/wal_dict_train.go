@@ -0,0 +1,49 @@
+package pg
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	WalDictTrainUsage            = "wal-dict-train dictionary-file"
+	WalDictTrainShortDescription = "Train zstd dictionary on the recent WAL segments from storage"
+	WalDictTrainLongDescription  = "Samples the most recently uploaded WAL segments and writes the trained zstd dictionary " +
+		"to the file, which can be used via " + internal.ZstdDictionarySetting + "."
+
+	dictSegmentsFlag        = "segments"
+	dictSegmentsDescription = "Number of the most recent WAL segments to sample"
+	dictSizeFlag            = "dict-size"
+	dictSizeDescription     = "Maximum size of the dictionary in bytes"
+)
+
+var (
+	walDictTrainCmd = &cobra.Command{
+		Use:   WalDictTrainUsage,
+		Short: WalDictTrainShortDescription,
+		Long:  WalDictTrainLongDescription,
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			folder, err := internal.ConfigureFolder()
+			tracelog.ErrorLogger.FatalOnError(err)
+			file, err := os.Create(args[0])
+			tracelog.ErrorLogger.FatalOnError(err)
+			defer utility.LoggedClose(file, "failed to close the dictionary file")
+			err = postgres.HandleWalDictTrain(folder, dictSegments, dictSize, file)
+			tracelog.ErrorLogger.FatalOnError(err)
+		},
+	}
+	dictSegments int
+	dictSize     int
+)
+
+func init() {
+	Cmd.AddCommand(walDictTrainCmd)
+	walDictTrainCmd.Flags().IntVar(&dictSegments, dictSegmentsFlag, 16, dictSegmentsDescription)
+	walDictTrainCmd.Flags().IntVar(&dictSize, dictSizeFlag, 112640, dictSizeDescription)
+}
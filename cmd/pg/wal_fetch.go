@@ -2,6 +2,7 @@ package pg
 
 import (
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal"
 	"github.com/wal-g/wal-g/internal/databases/postgres"
@@ -9,6 +10,8 @@ import (
 
 const WalFetchShortDescription = "Fetches a WAL file from storage"
 
+var walFetchVerifySignature bool
+
 // walFetchCmd represents the walFetch command
 var walFetchCmd = &cobra.Command{
 	Use:   "wal-fetch wal_name destination_filename",
@@ -17,10 +20,15 @@ var walFetchCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		folder, err := internal.ConfigureFolder()
 		tracelog.ErrorLogger.FatalOnError(err)
+		if walFetchVerifySignature {
+			viper.Set(internal.VerifySignatureSetting, true)
+		}
 		postgres.HandleWALFetch(folder, args[0], args[1], true)
 	},
 }
 
 func init() {
+	walFetchCmd.Flags().BoolVar(&walFetchVerifySignature, "verify-signature",
+		false, "Verify the signature of the WAL file before writing it")
 	Cmd.AddCommand(walFetchCmd)
 }
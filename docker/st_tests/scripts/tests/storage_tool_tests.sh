@@ -39,8 +39,12 @@ brotli --decompress uncompressed_testfile.br
 diff testfile uncompressed_testfile
 rm uncompressed_testfile
 
-# WAL-G should be able to delete the uploaded file
+# WAL-G should keep the file without the confirmation
 wal-g st rm testfolder/testfile.br
+test "2" -eq "$(wal-g st ls | wc -l)"
+
+# WAL-G should be able to delete the uploaded file
+wal-g st rm testfolder/testfile.br --confirm
 
 # Should get empty storage after file removal
 test "1" -eq "$(wal-g st ls | wc -l)"
@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"golang.org/x/sync/errgroup"
+)
+
+// TieredReaderMaker is the ReaderMaker of the storage object, which may be in the archive tier
+type TieredReaderMaker interface {
+	ReaderMaker
+	ObjectTier() (storage.ObjectTier, error)
+}
+
+// ArchivedFilesError lists all the files to extract which are archived and not rehydrated yet,
+// so they are rehydrated at once instead of failing the extraction one by one
+type ArchivedFilesError struct {
+	Paths []string
+}
+
+func (err ArchivedFilesError) Error() string {
+	return fmt.Sprintf("%d files are in the archive tier and must be rehydrated before the fetch, "+
+		"e.g. by 'wal-g st rehydrate':\n%s", len(err.Paths), strings.Join(err.Paths, "\n"))
+}
+
+// checkArchivedFiles asks the storage for the tier of every file by the concurrent workers, the files
+// which are being rehydrated are archived as well. The missing files are left for the extraction to report.
+func checkArchivedFiles(files []ReaderMaker, concurrency int) error {
+	tracelog.InfoLogger.Printf("Checking the storage tier of %d files", len(files))
+	var mutex sync.Mutex
+	var archived []string
+	group, ctx := errgroup.WithContext(context.Background())
+	toCheck := make(chan TieredReaderMaker)
+	for i := 0; i < concurrency; i++ {
+		group.Go(func() error {
+			for file := range toCheck {
+				tier, err := file.ObjectTier()
+				var notFoundError storage.ObjectNotFoundError
+				if errors.As(err, &notFoundError) {
+					continue
+				}
+				if err != nil {
+					return errors.Wrapf(err, "failed to check the storage tier of %s", file.Path())
+				}
+				if !tier.IsReadable() {
+					mutex.Lock()
+					archived = append(archived, file.Path())
+					mutex.Unlock()
+				}
+			}
+			return nil
+		})
+	}
+	group.Go(func() error {
+		defer close(toCheck)
+		for _, file := range files {
+			tieredFile, ok := file.(TieredReaderMaker)
+			if !ok {
+				continue
+			}
+			select {
+			case toCheck <- tieredFile:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		return nil
+	})
+	if err := group.Wait(); err != nil {
+		return err
+	}
+	if len(archived) > 0 {
+		sort.Strings(archived)
+		return ArchivedFilesError{archived}
+	}
+	return nil
+}
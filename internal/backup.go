@@ -79,11 +79,12 @@ func (backup *Backup) FetchDto(dto interface{}, path string) error {
 	if err != nil {
 		return err
 	}
+	defer reader.Close()
 	unmarshaller, err := NewDtoSerializer()
 	if err != nil {
 		return err
 	}
-	return errors.Wrap(unmarshaller.Unmarshal(reader, dto), fmt.Sprintf("failed to fetch dto from %s", path))
+	return errors.Wrap(unmarshalMetadata(reader, unmarshaller, dto), fmt.Sprintf("failed to fetch dto from %s", path))
 }
 
 func (backup *Backup) fetchStorageStream(path string) (io.ReadCloser, error) {
@@ -99,7 +100,7 @@ func (backup *Backup) UploadSentinel(sentinelDto interface{}) error {
 	return UploadDto(backup.Folder, sentinelDto, backup.getStopSentinelPath())
 }
 
-// UploadDto serializes given object to JSON and puts it to path
+// UploadDto serializes given object to JSON and puts it to path, encrypted if WALG_ENCRYPT_METADATA is set
 func UploadDto(folder storage.Folder, dto interface{}, path string) error {
 	marshaller, err := NewDtoSerializer()
 	if err != nil {
@@ -109,6 +110,10 @@ func UploadDto(folder storage.Folder, dto interface{}, path string) error {
 	if err != nil {
 		return err
 	}
+	r, err = EncryptMetadata(r)
+	if err != nil {
+		return err
+	}
 	return folder.PutObject(path, r)
 }
 
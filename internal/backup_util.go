@@ -51,17 +51,17 @@ func GetLatestBackupName(folder storage.Folder) (string, error) {
 }
 
 func GetBackupSentinelObjects(folder storage.Folder) ([]storage.Object, error) {
-	objects, _, err := folder.GetSubFolder(utility.BaseBackupPath).ListFolder()
+	sentinelObjects := make([]storage.Object, 0)
+	err := storage.ListFolderStream(folder.GetSubFolder(utility.BaseBackupPath),
+		func(object storage.Object, subFolder storage.Folder) error {
+			if object != nil && strings.HasSuffix(object.GetName(), utility.SentinelSuffix) {
+				sentinelObjects = append(sentinelObjects, object)
+			}
+			return nil
+		})
 	if err != nil {
 		return nil, err
 	}
-	sentinelObjects := make([]storage.Object, 0, len(objects))
-	for _, object := range objects {
-		if !strings.HasSuffix(object.GetName(), utility.SentinelSuffix) {
-			continue
-		}
-		sentinelObjects = append(sentinelObjects, object)
-	}
 
 	return sentinelObjects, nil
 }
@@ -81,14 +81,22 @@ func GetBackups(folder storage.Folder) (backups []BackupTime, err error) {
 	return
 }
 
-// TODO : unit tests
+// GetBackupsAndGarbage streams the listing of the folder, only the sentinels and the subfolders are kept
 func GetBackupsAndGarbage(folder storage.Folder) (backups []BackupTime, garbage []string, err error) {
-	backupObjects, subFolders, err := folder.ListFolder()
+	sortTimes := make([]BackupTime, 0)
+	var subFolders []storage.Folder
+	err = storage.ListFolderStream(folder, func(object storage.Object, subFolder storage.Folder) error {
+		if subFolder != nil {
+			subFolders = append(subFolders, subFolder)
+		} else if backupTime, ok := getBackupTime(object); ok {
+			sortTimes = append(sortTimes, backupTime)
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, nil, err
 	}
 
-	sortTimes := GetBackupTimeSlices(backupObjects)
 	garbage = GetGarbageFromPrefix(subFolders, sortTimes)
 
 	return sortTimes, garbage, nil
@@ -97,17 +105,23 @@ func GetBackupsAndGarbage(folder storage.Folder) (backups []BackupTime, garbage
 func GetBackupTimeSlices(backups []storage.Object) []BackupTime {
 	backupTimes := make([]BackupTime, 0)
 	for _, object := range backups {
-		key := object.GetName()
-		if !strings.HasSuffix(key, utility.SentinelSuffix) {
-			continue
+		if backupTime, ok := getBackupTime(object); ok {
+			backupTimes = append(backupTimes, backupTime)
 		}
-		time := object.GetLastModified()
-		backupTimes = append(backupTimes, BackupTime{utility.StripRightmostBackupName(key), time,
-			utility.StripWalFileName(key)})
 	}
 	return backupTimes
 }
 
+// getBackupTime describes the backup by its sentinel, the other objects aren't backups
+func getBackupTime(object storage.Object) (BackupTime, bool) {
+	key := object.GetName()
+	if !strings.HasSuffix(key, utility.SentinelSuffix) {
+		return BackupTime{}, false
+	}
+	return BackupTime{utility.StripRightmostBackupName(key), object.GetLastModified(),
+		utility.StripWalFileName(key)}, true
+}
+
 func SortBackupTimeSlices(backupTimes []BackupTime) {
 	sort.Slice(backupTimes, func(i, j int) bool {
 		return backupTimes[i].Time.Before(backupTimes[j].Time)
@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/md5"
+	"hash"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+// checksumVerifyingReader hashes the downloaded bytes before they are decrypted and decompressed,
+// and fails with ChecksumMismatchError instead of io.EOF if they differ from the stored object.
+// The extraction fails the file then, and it's downloaded again on the next attempt.
+type checksumVerifyingReader struct {
+	io.ReadCloser
+	path     string
+	expected []byte
+	hash     hash.Hash
+}
+
+// newChecksumVerifyingReader returns the reader as is if the storage didn't report the MD5 of the object,
+// e.g. the ETag of the multipart upload is not the content MD5
+func newChecksumVerifyingReader(reader io.ReadCloser, readerMaker ReaderMaker) io.ReadCloser {
+	etag := etagOf(readerMaker)
+	expected, ok := storage.PlainMD5FromETag(etag)
+	if !ok {
+		tracelog.DebugLogger.Printf("Skipping checksum verification of %s: ETag '%s' is not MD5",
+			readerMaker.Path(), etag)
+		return reader
+	}
+	return &checksumVerifyingReader{reader, readerMaker.Path(), expected, md5.New()}
+}
+
+func (reader *checksumVerifyingReader) Read(p []byte) (int, error) {
+	n, err := reader.ReadCloser.Read(p)
+	reader.hash.Write(p[:n])
+	if err == io.EOF {
+		if actual := reader.hash.Sum(nil); !bytes.Equal(actual, reader.expected) {
+			return n, newChecksumMismatchError(reader.path, reader.expected, actual)
+		}
+	}
+	return n, err
+}
+
+// explainFailure reads the rest of the download when the extraction failed before the end of it,
+// e.g. the bit flipped in transit fails the decoder first, and returns ChecksumMismatchError
+// instead of err if the downloaded bytes differ from the stored object, so the file is downloaded again
+func (reader *checksumVerifyingReader) explainFailure(err error) error {
+	var mismatchErr ChecksumMismatchError
+	if errors.As(err, &mismatchErr) {
+		return err
+	}
+	if _, drainErr := io.Copy(ioutil.Discard, reader); errors.As(drainErr, &mismatchErr) {
+		return errors.Wrapf(drainErr, "the download failed with %v", err)
+	}
+	return err
+}
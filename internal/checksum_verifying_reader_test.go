@@ -0,0 +1,143 @@
+package internal_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression/computils"
+	"github.com/wal-g/wal-g/internal/compression/gzip"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/testtools"
+)
+
+type etagReaderMaker struct {
+	BufferReaderMaker
+	etag string
+}
+
+func (readerMaker *etagReaderMaker) ETag() string { return readerMaker.etag }
+
+func extractWithETag(etag func(content []byte) string) error {
+	brm, _ := makeTar("booba")
+	readerMaker := &etagReaderMaker{brm, etag(brm.Buf.Bytes())}
+	return internal.ExtractAllWithSleeper(&testtools.NOPTarInterpreter{},
+		[]internal.ReaderMaker{readerMaker}, NOPSleeper{})
+}
+
+func TestExtractAll_verifyChecksum(t *testing.T) {
+	os.Setenv(internal.DownloadConcurrencySetting, "1")
+	defer os.Unsetenv(internal.DownloadConcurrencySetting)
+	viper.Set(internal.VerifyDownloadChecksum, true)
+	defer viper.Set(internal.VerifyDownloadChecksum, false)
+
+	err := extractWithETag(func(content []byte) string {
+		sum := md5.Sum(content)
+		return `"` + hex.EncodeToString(sum[:]) + `"`
+	})
+	assert.NoError(t, err)
+
+	err = extractWithETag(func(content []byte) string {
+		sum := md5.Sum([]byte("other content"))
+		return `"` + hex.EncodeToString(sum[:]) + `"`
+	})
+	var mismatchErr internal.ChecksumMismatchError
+	assert.True(t, errors.As(err, &mismatchErr), "unexpected error %v", err)
+
+	// the multipart upload ETag is not the content MD5, so it isn't verified
+	err = extractWithETag(func(content []byte) string {
+		return `"0123456789abcdef0123456789abcdef-2"`
+	})
+	assert.NoError(t, err)
+}
+
+func TestExtractAll_verifyListedChecksum(t *testing.T) {
+	os.Setenv(internal.DownloadConcurrencySetting, "1")
+	defer os.Unsetenv(internal.DownloadConcurrencySetting)
+	viper.Set(internal.VerifyDownloadChecksum, true)
+	defer viper.Set(internal.VerifyDownloadChecksum, false)
+
+	brm, _ := makeTar("booba")
+	content := brm.Buf.Bytes()
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	assert.NoError(t, folder.PutObject("booba.tar", bytes.NewReader(content)))
+	extract := func(listedContent []byte) error {
+		sum := md5.Sum(listedContent)
+		readerMaker := internal.NewStorageReaderMaker(folder, "booba.tar")
+		readerMaker.Object = storage.NewLocalObjectWithETag("booba.tar", time.Now(), int64(len(content)),
+			`"`+hex.EncodeToString(sum[:])+`"`)
+		return internal.ExtractAllWithSleeper(&testtools.NOPTarInterpreter{},
+			[]internal.ReaderMaker{readerMaker}, NOPSleeper{})
+	}
+
+	assert.NoError(t, extract(content))
+	var mismatchErr internal.ChecksumMismatchError
+	err := extract([]byte("other content"))
+	assert.True(t, errors.As(err, &mismatchErr), "unexpected error %v", err)
+}
+
+// corruptedInTransitReaderMaker corrupts the first deflate block header of the first corruptions downloads
+// of the gzip file, the stored object is intact
+const gzipHeaderSize = 10
+
+type corruptedInTransitReaderMaker struct {
+	content     []byte
+	corruptions int
+}
+
+func (maker *corruptedInTransitReaderMaker) Reader() (io.ReadCloser, error) {
+	content := append([]byte(nil), maker.content...)
+	if maker.corruptions > 0 {
+		maker.corruptions--
+		content[gzipHeaderSize] |= 0x06 // the reserved block type
+	}
+	return ioutil.NopCloser(bytes.NewReader(content)), nil
+}
+
+func (maker *corruptedInTransitReaderMaker) Path() string                { return "booba.tar.gz" }
+func (maker *corruptedInTransitReaderMaker) FileType() internal.FileType { return internal.TarFileType }
+func (maker *corruptedInTransitReaderMaker) Mode() int                   { return 0 }
+
+func (maker *corruptedInTransitReaderMaker) ETag() string {
+	sum := md5.Sum(maker.content)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func TestExtractAll_corruptedDownloadRetried(t *testing.T) {
+	os.Setenv(internal.DownloadConcurrencySetting, "4")
+	defer os.Unsetenv(internal.DownloadConcurrencySetting)
+
+	brm, tarContent := makeTar("booba")
+	compressed, err := ioutil.ReadAll(internal.CompressAndEncrypt(brm.Buf, gzip.Compressor{}, nil))
+	assert.NoError(t, err)
+
+	// without the verification the decoder failure looks like the corrupt object, which isn't retried
+	readerMaker := &corruptedInTransitReaderMaker{content: compressed, corruptions: 2}
+	sleeper := &countingSleeper{}
+	err = internal.ExtractAllWithSleeper(&testtools.BufferTarInterpreter{}, []internal.ReaderMaker{readerMaker}, sleeper)
+	var decompressionErr computils.DecompressionError
+	assert.True(t, errors.As(err, &decompressionErr), "unexpected error %v", err)
+	assert.Zero(t, sleeper.sleeps)
+
+	viper.Set(internal.VerifyDownloadChecksum, true)
+	defer viper.Set(internal.VerifyDownloadChecksum, false)
+	buf := &testtools.BufferTarInterpreter{}
+	sleeper = &countingSleeper{}
+	err = internal.ExtractAllWithSleeper(buf, []internal.ReaderMaker{readerMaker}, sleeper)
+
+	// the decoder fails before the end of the download, but the failure is the checksum mismatch
+	// rather than the permanent decompression error, so the file is downloaded again
+	assert.NoError(t, err)
+	assert.Equal(t, tarContent, buf.Out)
+	assert.Equal(t, 1, sleeper.sleeps)
+	assert.Zero(t, readerMaker.corruptions)
+}
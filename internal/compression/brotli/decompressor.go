@@ -16,6 +16,15 @@ func (decompressor Decompressor) Decompress(src io.Reader) (io.ReadCloser, error
 	return cbrotli.NewReader(computils.NewUntilEOFReader(src)), nil
 }
 
+// DecompressTo decompresses the whole stream into dst, see compression.DecompressorV2
+func (decompressor Decompressor) DecompressTo(dst io.Writer, src io.Reader) (int64, error) {
+	decompressed, err := decompressor.Decompress(src)
+	if err != nil {
+		return 0, err
+	}
+	return computils.CopyDecompressed(dst, decompressed)
+}
+
 func (decompressor Decompressor) FileExtension() string {
 	return FileExtension
 }
@@ -3,10 +3,13 @@
 
 package compression
 
-import "github.com/wal-g/wal-g/internal/compression/brotli"
+import (
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/compression/brotli"
+)
 
 func init() {
-	Decompressors = append(Decompressors, brotli.Decompressor{})
+	tracelog.ErrorLogger.FatalOnError(RegisterDecompressor(brotli.Decompressor{}))
 	Compressors[brotli.AlgorithmName] = brotli.Compressor{}
 	CompressingAlgorithms = append(CompressingAlgorithms, brotli.AlgorithmName)
 }
@@ -0,0 +1,16 @@
+//go:build brotli && !windows
+// +build brotli,!windows
+
+package compression
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal/compression/brotli"
+)
+
+func TestBrotliDecompressorRegistered(t *testing.T) {
+	assert.Equal(t, brotli.Decompressor{}, FindDecompressor(brotli.FileExtension))
+	assert.Contains(t, CompressingAlgorithms, brotli.AlgorithmName)
+}
@@ -0,0 +1,41 @@
+package bzip2
+
+import (
+	"compress/bzip2"
+	"io"
+	"io/ioutil"
+
+	"github.com/wal-g/wal-g/internal/compression/computils"
+)
+
+const (
+	AlgorithmName = "bzip2"
+	FileExtension = "bz2"
+)
+
+type Decompressor struct{}
+
+func (decompressor Decompressor) Decompress(src io.Reader) (io.ReadCloser, error) {
+	bzReader := bzip2.NewReader(src)
+	return ioutil.NopCloser(computils.NewDecompressionErrorReader(bzReader, AlgorithmName, isDecodeError)), nil
+}
+
+// DecompressTo decompresses the whole stream into dst, see compression.DecompressorV2
+func (decompressor Decompressor) DecompressTo(dst io.Writer, src io.Reader) (int64, error) {
+	decompressed, err := decompressor.Decompress(src)
+	if err != nil {
+		return 0, err
+	}
+	return computils.CopyDecompressed(dst, decompressed)
+}
+
+func (decompressor Decompressor) FileExtension() string {
+	return FileExtension
+}
+
+func isDecodeError(err error) bool {
+	if _, ok := err.(bzip2.StructuralError); ok {
+		return true
+	}
+	return err == io.ErrUnexpectedEOF
+}
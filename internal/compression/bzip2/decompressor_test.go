@@ -0,0 +1,57 @@
+package bzip2_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal/compression/bzip2"
+	"github.com/wal-g/wal-g/internal/compression/computils"
+)
+
+const sampleFilePath = "testdata/sample.bz2"
+
+func sampleContent() []byte {
+	var content bytes.Buffer
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&content, "WAL segment line %05d: the quick brown fox jumps over the lazy dog\n", i)
+	}
+	return content.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	compressed, err := ioutil.ReadFile(sampleFilePath)
+	assert.NoError(t, err)
+
+	reader, err := bzip2.Decompressor{}.Decompress(bytes.NewReader(compressed))
+	assert.NoError(t, err)
+	decompressed, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, sampleContent(), decompressed)
+}
+
+func TestDecompress_corruptStream(t *testing.T) {
+	compressed, err := ioutil.ReadFile(sampleFilePath)
+	assert.NoError(t, err)
+	for i := len(compressed) / 2; i < len(compressed)/2+16; i++ {
+		compressed[i] ^= 0xff
+	}
+
+	reader, err := bzip2.Decompressor{}.Decompress(bytes.NewReader(compressed))
+	assert.NoError(t, err)
+	_, err = io.Copy(ioutil.Discard, reader)
+	assert.IsType(t, computils.DecompressionError{}, err)
+}
+
+func TestDecompress_truncatedStream(t *testing.T) {
+	compressed, err := ioutil.ReadFile(sampleFilePath)
+	assert.NoError(t, err)
+
+	reader, err := bzip2.Decompressor{}.Decompress(bytes.NewReader(compressed[:len(compressed)/2]))
+	assert.NoError(t, err)
+	_, err = io.Copy(ioutil.Discard, reader)
+	assert.IsType(t, computils.DecompressionError{}, err)
+}
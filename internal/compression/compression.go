@@ -1,7 +1,14 @@
 package compression
 
 import (
+	"fmt"
 	"io"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/compression/computils"
 )
 
 type Compressor interface {
@@ -14,6 +21,101 @@ type Decompressor interface {
 	FileExtension() string
 }
 
+// DecompressorV2 decompresses the whole stream into dst and reports how many bytes were written,
+// the size of the compressed data consumed can be counted by the caller reading src.
+// Use AsDecompressorV2 to get it from any Decompressor.
+type DecompressorV2 interface {
+	Decompressor
+	DecompressTo(dst io.Writer, src io.Reader) (written int64, err error)
+}
+
+// AsDecompressorV2 returns the decompressor itself if it implements DecompressorV2, like all the registered
+// decompressors do, otherwise the adapter which copies the output of Decompress into dst,
+// so the third-party decompressors implementing only the old interface keep working
+func AsDecompressorV2(decompressor Decompressor) DecompressorV2 {
+	if decompressorV2, ok := decompressor.(DecompressorV2); ok {
+		return decompressorV2
+	}
+	return decompressorAdapter{decompressor}
+}
+
+type decompressorAdapter struct {
+	Decompressor
+}
+
+func (adapter decompressorAdapter) DecompressTo(dst io.Writer, src io.Reader) (written int64, err error) {
+	reader, err := adapter.Decompress(src)
+	if err != nil {
+		return 0, err
+	}
+	return computils.CopyDecompressed(dst, reader)
+}
+
+type DuplicateDecompressorError struct {
+	error
+}
+
+func newDuplicateDecompressorError(fileExtension string) DuplicateDecompressorError {
+	return DuplicateDecompressorError{errors.Errorf("decompressor for the '%s' extension is already registered", fileExtension)}
+}
+
+func (err DuplicateDecompressorError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+var (
+	// decompressorsMutex guards decompressorsByExtension and Decompressors,
+	// the decompressors may be registered while the files are being fetched
+	decompressorsMutex       sync.RWMutex
+	decompressorsByExtension = indexDecompressors(Decompressors)
+)
+
+func indexDecompressors(decompressors []Decompressor) map[string]Decompressor {
+	index := make(map[string]Decompressor, len(decompressors))
+	for _, decompressor := range decompressors {
+		index[decompressor.FileExtension()] = decompressor
+	}
+	return index
+}
+
+// RegisterDecompressor makes the decompressor available for FindDecompressor and RegisteredDecompressors,
+// so the embedders can add their formats without editing the package.
+// Only one decompressor may be registered for a file extension.
+func RegisterDecompressor(decompressor Decompressor) error {
+	fileExtension := strings.TrimPrefix(decompressor.FileExtension(), ".")
+
+	decompressorsMutex.Lock()
+	defer decompressorsMutex.Unlock()
+	if _, ok := decompressorsByExtension[fileExtension]; ok {
+		return newDuplicateDecompressorError(fileExtension)
+	}
+	decompressorsByExtension[fileExtension] = decompressor
+	Decompressors = append(Decompressors, decompressor)
+	return nil
+}
+
+// RegisteredDecompressors returns the copy of the registered decompressors list,
+// which is safe to iterate while other decompressors are registered
+func RegisteredDecompressors() []Decompressor {
+	decompressorsMutex.RLock()
+	defer decompressorsMutex.RUnlock()
+	return append([]Decompressor(nil), Decompressors...)
+}
+
+// TarFileExtension is the extension of the uncompressed tar files, which are extracted without any decompressor
+const TarFileExtension = "tar"
+
+// SupportedExtensions returns the extensions of the files which can be extracted:
+// the ones of the registered decompressors, in the order of registration, and TarFileExtension
+func SupportedExtensions() []string {
+	decompressors := RegisteredDecompressors()
+	extensions := make([]string, 0, len(decompressors)+1)
+	for _, decompressor := range decompressors {
+		extensions = append(extensions, strings.TrimPrefix(decompressor.FileExtension(), "."))
+	}
+	return append(extensions, TarFileExtension)
+}
+
 func GetDecompressorByCompressor(compressor Compressor) Decompressor {
 	return FindDecompressor(compressor.FileExtension())
 }
@@ -24,10 +126,7 @@ func FindDecompressor(fileExtension string) Decompressor {
 		fileExtension = fileExtension[1:]
 	}
 
-	for _, decompressor := range Decompressors {
-		if decompressor.FileExtension() == fileExtension {
-			return decompressor
-		}
-	}
-	return nil
+	decompressorsMutex.RLock()
+	defer decompressorsMutex.RUnlock()
+	return decompressorsByExtension[fileExtension]
 }
@@ -4,22 +4,68 @@
 package compression
 
 import (
+	"github.com/wal-g/wal-g/internal/compression/bzip2"
 	"github.com/wal-g/wal-g/internal/compression/gzip"
 	"github.com/wal-g/wal-g/internal/compression/lz4"
 	"github.com/wal-g/wal-g/internal/compression/lzma"
+	"github.com/wal-g/wal-g/internal/compression/lzo"
+	"github.com/wal-g/wal-g/internal/compression/snappy"
+	"github.com/wal-g/wal-g/internal/compression/xz"
 	"github.com/wal-g/wal-g/internal/compression/zstd"
 )
 
-var CompressingAlgorithms = []string{lz4.AlgorithmName, lzma.AlgorithmName}
+var CompressingAlgorithms = []string{lz4.AlgorithmName, lzma.AlgorithmName, zstd.AlgorithmName, snappy.AlgorithmName, lzo.AlgorithmName}
 
 var Compressors = map[string]Compressor{
-	lz4.AlgorithmName:  lz4.Compressor{},
-	lzma.AlgorithmName: lzma.Compressor{},
+	lz4.AlgorithmName:    lz4.Compressor{},
+	lzma.AlgorithmName:   lzma.Compressor{},
+	zstd.AlgorithmName:   zstd.Compressor{},
+	snappy.AlgorithmName: snappy.Compressor{},
+	lzo.AlgorithmName:    lzo.Compressor{},
 }
 
+// Decompressors lists the registered decompressors.
+//
+// Deprecated: use FindDecompressor for lookups, RegisteredDecompressors to iterate
+// and RegisterDecompressor to add new formats, decompressors appended directly to this slice
+// are not visible to FindDecompressor.
 var Decompressors = []Decompressor{
 	lz4.Decompressor{},
 	lzma.Decompressor{},
 	zstd.Decompressor{},
 	gzip.Decompressor{},
+	bzip2.Decompressor{},
+	xz.Decompressor{},
+	snappy.Decompressor{},
+}
+
+// SetZstdDictionary makes zstd compress the new files with the dictionary
+// and decompress the files which reference it, nil content disables the dictionary
+func SetZstdDictionary(content []byte) error {
+	if content == nil {
+		zstd.SetDictionary(nil)
+		return nil
+	}
+	dict, err := zstd.NewDictionary(content)
+	if err != nil {
+		return err
+	}
+	zstd.SetDictionary(dict)
+	return nil
+}
+
+const (
+	ZstdDefaultMaxWindowLog = zstd.DefaultMaxWindowLog
+	ZstdDefaultWindowBudget = zstd.DefaultWindowBudget
+)
+
+// SetZstdWindowLimits sets the largest window log of the zstd frames which can be decompressed
+// and the total size of the windows decompressed concurrently
+func SetZstdWindowLimits(maxWindowLog int, budget int64) error {
+	return zstd.SetWindowLimits(maxWindowLog, budget)
+}
+
+// TrainZstdDictionary builds the zstd dictionary of at most maxSize bytes from the samples
+func TrainZstdDictionary(samples [][]byte, maxSize int) ([]byte, error) {
+	return zstd.TrainDictionary(samples, maxSize)
 }
@@ -2,8 +2,12 @@ package compression
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -62,3 +66,147 @@ func TestBigDataCompression(t *testing.T) {
 		testCompressor(compressor, testData, t)
 	}
 }
+
+type extensionDecompressor struct {
+	fileExtension string
+}
+
+func (decompressor extensionDecompressor) Decompress(src io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(src), nil
+}
+
+func (decompressor extensionDecompressor) FileExtension() string {
+	return decompressor.fileExtension
+}
+
+func TestFindDecompressor(t *testing.T) {
+	for _, decompressor := range Decompressors {
+		assert.Equal(t, decompressor, FindDecompressor(decompressor.FileExtension()))
+		assert.Equal(t, decompressor, FindDecompressor("."+decompressor.FileExtension()))
+	}
+	assert.Nil(t, FindDecompressor("unknown"))
+}
+
+// restoreDecompressors brings the registry back to its current state when the test ends,
+// so the decompressors registered by the test don't leak into the other tests
+func restoreDecompressors(t *testing.T) {
+	decompressorsMutex.RLock()
+	decompressors := append([]Decompressor(nil), Decompressors...)
+	byExtension := make(map[string]Decompressor, len(decompressorsByExtension))
+	for extension, decompressor := range decompressorsByExtension {
+		byExtension[extension] = decompressor
+	}
+	decompressorsMutex.RUnlock()
+
+	t.Cleanup(func() {
+		decompressorsMutex.Lock()
+		defer decompressorsMutex.Unlock()
+		Decompressors = decompressors
+		decompressorsByExtension = byExtension
+	})
+}
+
+func TestRegisterDecompressor(t *testing.T) {
+	restoreDecompressors(t)
+	decompressor := extensionDecompressor{"registered_ext"}
+	assert.NoError(t, RegisterDecompressor(decompressor))
+	assert.Equal(t, decompressor, FindDecompressor("registered_ext"))
+	assert.Contains(t, Decompressors, Decompressor(decompressor))
+}
+
+func TestRegisterDecompressor_duplicateExtension(t *testing.T) {
+	restoreDecompressors(t)
+	existing := FindDecompressor("lz4")
+	err := RegisterDecompressor(extensionDecompressor{"lz4"})
+	assert.IsType(t, DuplicateDecompressorError{}, err)
+	assert.Equal(t, existing, FindDecompressor("lz4"))
+}
+
+func TestRegisterDecompressor_concurrent(t *testing.T) {
+	restoreDecompressors(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, RegisterDecompressor(extensionDecompressor{fmt.Sprintf("concurrent_%d", i)}))
+			// the duplicate registered with the leading dot is rejected too
+			assert.Error(t, RegisterDecompressor(extensionDecompressor{fmt.Sprintf(".concurrent_%d", i)}))
+			for _, decompressor := range RegisteredDecompressors() {
+				assert.NotNil(t, FindDecompressor(decompressor.FileExtension()))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 8; i++ {
+		assert.NotNil(t, FindDecompressor(fmt.Sprintf("concurrent_%d", i)))
+	}
+}
+
+func TestSupportedExtensions(t *testing.T) {
+	restoreDecompressors(t)
+	assert.NoError(t, RegisterDecompressor(extensionDecompressor{".supported_ext"}))
+	extensions := SupportedExtensions()
+	for _, extension := range []string{"lz4", "zst", "gz", "supported_ext", TarFileExtension} {
+		assert.Contains(t, extensions, extension)
+	}
+	assert.Len(t, extensions, len(RegisteredDecompressors())+1)
+}
+
+type decompressorV2 struct {
+	extensionDecompressor
+}
+
+func (decompressor decompressorV2) DecompressTo(dst io.Writer, src io.Reader) (int64, error) {
+	return io.Copy(dst, src)
+}
+
+func TestAsDecompressorV2(t *testing.T) {
+	native := decompressorV2{extensionDecompressor{"v2_ext"}}
+	assert.Equal(t, native, AsDecompressorV2(native))
+
+	adapted := AsDecompressorV2(extensionDecompressor{"v1_ext"})
+	assert.Equal(t, "v1_ext", adapted.FileExtension())
+	var dst bytes.Buffer
+	written, err := adapted.DecompressTo(&dst, bytes.NewReader([]byte("uncompressed")))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len("uncompressed")), written)
+	assert.Equal(t, "uncompressed", dst.String())
+}
+
+func TestBuiltinDecompressorsImplementV2(t *testing.T) {
+	for _, decompressor := range RegisteredDecompressors() {
+		if !strings.HasPrefix(reflect.TypeOf(decompressor).PkgPath(), "github.com/wal-g/wal-g/internal/compression/") {
+			continue
+		}
+		_, ok := decompressor.(DecompressorV2)
+		assert.True(t, ok, decompressor.FileExtension())
+	}
+}
+
+func TestDecompressTo_countsWrittenBytes(t *testing.T) {
+	data := bytes.Repeat([]byte("WAL record "), 10000)
+	for _, compressingAlgorithm := range CompressingAlgorithms {
+		compressor := Compressors[compressingAlgorithm]
+		var compressed bytes.Buffer
+		writer := compressor.NewWriter(&compressed)
+		_, err := writer.Write(data)
+		assert.NoError(t, err)
+		assert.NoError(t, writer.Close())
+
+		var decompressed bytes.Buffer
+		decompressor := AsDecompressorV2(GetDecompressorByCompressor(compressor))
+		written, err := decompressor.DecompressTo(&decompressed, &compressed)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(data)), written, compressingAlgorithm)
+		assert.Equal(t, data, decompressed.Bytes())
+	}
+}
+
+func TestFindDecompressorByMagic_lz4LegacyFrame(t *testing.T) {
+	decompressor := FindDecompressorByMagic([]byte{0x02, 0x21, 0x4c, 0x18, 0x18, 0x28, 0x00, 0x00})
+	if assert.NotNil(t, decompressor) {
+		assert.Equal(t, "lz4", decompressor.FileExtension())
+	}
+}
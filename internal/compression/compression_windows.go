@@ -4,18 +4,55 @@
 package compression
 
 import (
+	"github.com/pkg/errors"
+	"github.com/wal-g/wal-g/internal/compression/bzip2"
 	"github.com/wal-g/wal-g/internal/compression/lz4"
 	"github.com/wal-g/wal-g/internal/compression/lzma"
+	"github.com/wal-g/wal-g/internal/compression/lzo"
+	"github.com/wal-g/wal-g/internal/compression/snappy"
+	"github.com/wal-g/wal-g/internal/compression/xz"
 )
 
-var CompressingAlgorithms = []string{lz4.AlgorithmName, lzma.AlgorithmName}
+var CompressingAlgorithms = []string{lz4.AlgorithmName, lzma.AlgorithmName, snappy.AlgorithmName, lzo.AlgorithmName}
 
 var Compressors = map[string]Compressor{
-	lz4.AlgorithmName:  lz4.Compressor{},
-	lzma.AlgorithmName: lzma.Compressor{},
+	lz4.AlgorithmName:    lz4.Compressor{},
+	lzma.AlgorithmName:   lzma.Compressor{},
+	snappy.AlgorithmName: snappy.Compressor{},
+	lzo.AlgorithmName:    lzo.Compressor{},
 }
 
+// Decompressors lists the registered decompressors.
+//
+// Deprecated: use FindDecompressor for lookups, RegisteredDecompressors to iterate
+// and RegisterDecompressor to add new formats, decompressors appended directly to this slice
+// are not visible to FindDecompressor.
 var Decompressors = []Decompressor{
 	lz4.Decompressor{},
 	lzma.Decompressor{},
+	bzip2.Decompressor{},
+	xz.Decompressor{},
+	snappy.Decompressor{},
+}
+
+var errZstdIsNotSupported = errors.New("zstd is not supported on windows")
+
+func SetZstdDictionary(content []byte) error {
+	if content == nil {
+		return nil
+	}
+	return errZstdIsNotSupported
+}
+
+const (
+	ZstdDefaultMaxWindowLog = 27
+	ZstdDefaultWindowBudget = 1 << 30
+)
+
+func SetZstdWindowLimits(maxWindowLog int, budget int64) error {
+	return errZstdIsNotSupported
+}
+
+func TrainZstdDictionary(samples [][]byte, maxSize int) ([]byte, error) {
+	return nil, errZstdIsNotSupported
 }
@@ -0,0 +1,13 @@
+package computils
+
+import "io"
+
+// CopyDecompressed copies the decompressed stream into dst and closes it, the decompressors
+// implement DecompressTo of compression.DecompressorV2 by it
+func CopyDecompressed(dst io.Writer, decompressed io.ReadCloser) (written int64, err error) {
+	written, err = io.Copy(dst, decompressed)
+	if closeErr := decompressed.Close(); err == nil {
+		err = closeErr
+	}
+	return written, err
+}
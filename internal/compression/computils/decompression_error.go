@@ -0,0 +1,55 @@
+package computils
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+)
+
+// DecompressionError is used to signal that the compressed stream
+// is malformed and can not be decoded
+type DecompressionError struct {
+	error
+}
+
+func NewDecompressionError(err error, format string) DecompressionError {
+	return DecompressionError{errors.Wrapf(err, "%s decompression failed", format)}
+}
+
+// NewDecompressionErrorAt is NewDecompressionError which tells how much of the compressed stream was consumed
+// before the failure, that helps to tell a truncated stream from the corrupted one
+func NewDecompressionErrorAt(err error, format string, consumed int64) DecompressionError {
+	return DecompressionError{errors.Wrapf(err, "%s decompression failed after %d bytes of compressed data",
+		format, consumed)}
+}
+
+func (err DecompressionError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+func (err DecompressionError) Unwrap() error {
+	return err.error
+}
+
+// DecompressionErrorReader converts the errors of the underlying decompressing reader
+// into DecompressionError when isDecodeError reports them as malformed stream errors.
+type DecompressionErrorReader struct {
+	underlying    io.Reader
+	format        string
+	isDecodeError func(err error) bool
+}
+
+func NewDecompressionErrorReader(underlying io.Reader, format string,
+	isDecodeError func(err error) bool) *DecompressionErrorReader {
+	return &DecompressionErrorReader{underlying, format, isDecodeError}
+}
+
+func (reader *DecompressionErrorReader) Read(p []byte) (n int, err error) {
+	n, err = reader.underlying.Read(p)
+	if err != nil && err != io.EOF && reader.isDecodeError(err) {
+		err = NewDecompressionError(err, reader.format)
+	}
+	return
+}
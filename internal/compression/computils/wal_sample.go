@@ -0,0 +1,32 @@
+package computils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+)
+
+const walSamplePageSize = 8192
+
+// GenerateWALSample makes the pseudo WAL data of the given size:
+// 8KB pages with increasing LSNs in headers and tuples which mix repeated text with random values,
+// so the data is compressible unlike the purely random one. The same size always gives the same data.
+func GenerateWALSample(size int) []byte {
+	random := rand.New(rand.NewSource(1))
+	words := []string{"INSERT", "UPDATE", "pg_catalog", "public", "users", "orders", "id", "created_at", "NULL"}
+
+	sample := make([]byte, 0, size+walSamplePageSize)
+	for lsn := uint64(0); len(sample) < size; lsn += walSamplePageSize {
+		page := bytes.NewBuffer(make([]byte, 0, walSamplePageSize))
+		_ = binary.Write(page, binary.LittleEndian, lsn)
+		_ = binary.Write(page, binary.LittleEndian, uint32(0xD10D))
+		for page.Len() < walSamplePageSize {
+			_ = binary.Write(page, binary.LittleEndian, random.Uint64())
+			_ = binary.Write(page, binary.LittleEndian, uint32(random.Intn(1000)))
+			page.WriteString(words[random.Intn(len(words))])
+			page.Write(make([]byte, random.Intn(32)))
+		}
+		sample = append(sample, page.Bytes()[:walSamplePageSize]...)
+	}
+	return sample[:size]
+}
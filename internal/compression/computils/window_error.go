@@ -0,0 +1,29 @@
+package computils
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+)
+
+// WindowTooLargeError is used to signal that the stream needs the larger decoding window
+// than the decompressor is allowed to allocate
+type WindowTooLargeError struct {
+	error
+	RequiredWindowLog int
+	MaxWindowLog      int
+}
+
+func NewWindowTooLargeError(format string, requiredWindowLog int, maxWindowLog int) WindowTooLargeError {
+	return WindowTooLargeError{
+		errors.Errorf("%s stream requires the window of 2^%d bytes, but at most 2^%d bytes are allowed",
+			format, requiredWindowLog, maxWindowLog),
+		requiredWindowLog,
+		maxWindowLog,
+	}
+}
+
+func (err WindowTooLargeError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
@@ -0,0 +1,16 @@
+package computils
+
+import "io"
+
+// WindowHolder is implemented by the decompressed streams which hold their decoding window in the shared budget
+// and by the readers which pass the reads to such a stream, e.g. the ones measuring it
+type WindowHolder interface {
+	HoldsWindow() bool
+}
+
+// HoldsWindow tells if the reader is read from the stream holding the decoding window. The stream decoded from it
+// is nested in that one, so it must not wait for the budget, which its own source may never give back.
+func HoldsWindow(reader io.Reader) bool {
+	holder, ok := reader.(WindowHolder)
+	return ok && holder.HoldsWindow()
+}
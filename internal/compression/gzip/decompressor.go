@@ -1,18 +1,147 @@
 package gzip
 
 import (
+	"bufio"
+	"compress/flate"
 	"compress/gzip"
+	"fmt"
 	"io"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/compression/computils"
 )
 
 type Decompressor struct{}
 
-const FileExtension = "gz"
+const (
+	AlgorithmName = "gzip"
+	FileExtension = "gz"
+)
+
+// gzip member header starts with these bytes
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// TrailingGarbageError is used to signal that the data following a gzip member
+// is not another gzip member
+type TrailingGarbageError struct {
+	error
+}
+
+func newTrailingGarbageError(members int) TrailingGarbageError {
+	return TrailingGarbageError{errors.Errorf("unexpected data after gzip member %d is not a gzip header", members)}
+}
 
+func (err TrailingGarbageError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// Decompress reads all members of a multistream gzip file one after another until the end of the source,
+// such files are produced by parallel compressors like pigz or by concatenation of gzip files.
+// CRC and length stored in the trailer of every member are verified when the member ends,
+// so a truncated or damaged stream fails with computils.DecompressionError,
+// the same happens when a member is followed by anything but another member or zero padding.
 func (decompressor Decompressor) Decompress(src io.Reader) (io.ReadCloser, error) {
-	return gzip.NewReader(src)
+	// gzip.Reader reads the source through bufio.Reader as is, so the bytes after a member can be peeked
+	bufferedSrc := bufio.NewReader(src)
+	gzReader, err := gzip.NewReader(bufferedSrc)
+	if err != nil {
+		if isDecodeError(err) {
+			return nil, computils.NewDecompressionError(err, AlgorithmName)
+		}
+		return nil, err
+	}
+	gzReader.Multistream(false)
+	members := &membersReader{src: bufferedSrc, member: gzReader, members: 1}
+	return &reader{computils.NewDecompressionErrorReader(members, AlgorithmName, isDecodeError), gzReader}, nil
+}
+
+// DecompressTo decompresses the whole stream into dst, see compression.DecompressorV2
+func (decompressor Decompressor) DecompressTo(dst io.Writer, src io.Reader) (int64, error) {
+	decompressed, err := decompressor.Decompress(src)
+	if err != nil {
+		return 0, err
+	}
+	return computils.CopyDecompressed(dst, decompressed)
 }
 
 func (decompressor Decompressor) FileExtension() string {
 	return FileExtension
 }
+
+type reader struct {
+	io.Reader
+	gzReader *gzip.Reader
+}
+
+func (reader *reader) Close() error {
+	return reader.gzReader.Close()
+}
+
+// membersReader reads the gzip members one by one, the next member is started
+// only when the previous one is completely read and verified
+type membersReader struct {
+	src     *bufio.Reader
+	member  *gzip.Reader
+	members int
+}
+
+func (reader *membersReader) Read(p []byte) (int, error) {
+	n, err := reader.member.Read(p)
+	if err != io.EOF {
+		return n, err
+	}
+	if err = reader.nextMember(); err != nil {
+		return n, err
+	}
+	if n == 0 {
+		return reader.Read(p)
+	}
+	return n, nil
+}
+
+// nextMember returns io.EOF at the real end of the source
+func (reader *membersReader) nextMember() error {
+	magic, err := reader.src.Peek(len(gzipMagic))
+	if len(magic) == 0 && err == io.EOF {
+		return io.EOF
+	}
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if len(magic) < len(gzipMagic) || magic[0] != gzipMagic[0] || magic[1] != gzipMagic[1] {
+		return reader.skipZeroPadding()
+	}
+	if err = reader.member.Reset(reader.src); err != nil {
+		return err
+	}
+	reader.member.Multistream(false)
+	reader.members++
+	return nil
+}
+
+// skipZeroPadding returns io.EOF if only zero bytes are left in the source. Such padding is benign,
+// e.g. pigz output written to the block device or tape is padded up to the block size.
+func (reader *membersReader) skipZeroPadding() error {
+	for {
+		b, err := reader.src.ReadByte()
+		if err == io.EOF {
+			tracelog.DebugLogger.Printf("Skipped zero padding after gzip member %d", reader.members)
+			return io.EOF
+		}
+		if err != nil {
+			return err
+		}
+		if b != 0 {
+			return newTrailingGarbageError(reader.members)
+		}
+	}
+}
+
+func isDecodeError(err error) bool {
+	switch err.(type) {
+	case flate.CorruptInputError, TrailingGarbageError:
+		return true
+	}
+	return err == gzip.ErrChecksum || err == gzip.ErrHeader || err == io.ErrUnexpectedEOF
+}
@@ -0,0 +1,162 @@
+package gzip_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal/compression/computils"
+	walg_gzip "github.com/wal-g/wal-g/internal/compression/gzip"
+)
+
+const threeMembersFilePath = "testdata/three_members.gz"
+
+func compress(t *testing.T, data []byte) []byte {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, err := writer.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	return compressed.Bytes()
+}
+
+func decompress(compressed []byte) ([]byte, error) {
+	reader, err := walg_gzip.Decompressor{}.Decompress(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	decompressed, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return decompressed, err
+	}
+	return decompressed, reader.Close()
+}
+
+func sampleData() []byte {
+	return bytes.Repeat([]byte("0123456789abcdef"), 4096)
+}
+
+func TestDecompress(t *testing.T) {
+	data := sampleData()
+	decompressed, err := decompress(compress(t, data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, decompressed)
+}
+
+func TestDecompress_truncatedStream(t *testing.T) {
+	compressed := compress(t, sampleData())
+	_, err := decompress(compressed[:len(compressed)-4])
+	assert.IsType(t, computils.DecompressionError{}, err)
+}
+
+func TestDecompress_bitFlippedStream(t *testing.T) {
+	compressed := compress(t, sampleData())
+	// damage the CRC stored in the trailer
+	compressed[len(compressed)-8] ^= 0x01
+	_, err := decompress(compressed)
+	assert.IsType(t, computils.DecompressionError{}, err)
+}
+
+func TestDecompress_multistream(t *testing.T) {
+	first, second := []byte("first member\n"), []byte("second member\n")
+	compressed := append(compress(t, first), compress(t, second)...)
+	decompressed, err := decompress(compressed)
+	assert.NoError(t, err)
+	assert.Equal(t, append(first, second...), decompressed)
+}
+
+func TestDecompress_notGzip(t *testing.T) {
+	_, err := walg_gzip.Decompressor{}.Decompress(bytes.NewReader(bytes.Repeat([]byte{0}, 32)))
+	assert.IsType(t, computils.DecompressionError{}, err)
+	_, err = walg_gzip.Decompressor{}.Decompress(bytes.NewReader(nil))
+	assert.Equal(t, io.EOF, err)
+}
+
+// three_members.gz is the concatenation of three files compressed by the gzip utility
+func threeMembersContent() []byte {
+	var content bytes.Buffer
+	for member := 1; member <= 3; member++ {
+		for i := 0; i < 1000; i++ {
+			fmt.Fprintf(&content, "WAL segment member %d line %05d: the quick brown fox jumps over the lazy dog\n", member, i)
+		}
+	}
+	return content.Bytes()
+}
+
+func TestDecompress_threeMembersFile(t *testing.T) {
+	compressed, err := ioutil.ReadFile(threeMembersFilePath)
+	assert.NoError(t, err)
+
+	decompressed, err := decompress(compressed)
+	assert.NoError(t, err)
+	assert.Equal(t, threeMembersContent(), decompressed)
+}
+
+func TestDecompress_emptyMember(t *testing.T) {
+	compressed := append(compress(t, []byte("first")), compress(t, nil)...)
+	compressed = append(compressed, compress(t, []byte("third"))...)
+	decompressed, err := decompress(compressed)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("firstthird"), decompressed)
+}
+
+func TestDecompress_trailingGarbage(t *testing.T) {
+	compressed, err := ioutil.ReadFile(threeMembersFilePath)
+	assert.NoError(t, err)
+
+	for _, garbage := range [][]byte{[]byte("garbage"), {0x1f}, {0x1f, 0x8b, 0x08}} {
+		_, err = decompress(append(compressed, garbage...))
+		assert.IsType(t, computils.DecompressionError{}, err, "garbage %x", garbage)
+	}
+	_, err = decompress(append(compressed, "garbage"...))
+	assert.Contains(t, err.Error(), "after gzip member 3")
+}
+
+// compressLikePigz imitates pigz output: the data is split into blocks compressed independently
+// and flushed with the empty stored block, and every member holds several such blocks
+func compressLikePigz(t *testing.T, data []byte, blockSize int, blocksPerMember int) []byte {
+	var compressed bytes.Buffer
+	for len(data) > 0 {
+		writer := gzip.NewWriter(&compressed)
+		for i := 0; i < blocksPerMember && len(data) > 0; i++ {
+			block := data
+			if len(block) > blockSize {
+				block = block[:blockSize]
+			}
+			data = data[len(block):]
+			_, err := writer.Write(block)
+			assert.NoError(t, err)
+			assert.NoError(t, writer.Flush())
+		}
+		assert.NoError(t, writer.Close())
+	}
+	return compressed.Bytes()
+}
+
+func TestDecompress_pigzMembers(t *testing.T) {
+	data := threeMembersContent()
+	decompressed, err := decompress(compressLikePigz(t, data, 4096, 4))
+	assert.NoError(t, err)
+	assert.Equal(t, data, decompressed)
+}
+
+func TestDecompress_trailingZeroPadding(t *testing.T) {
+	data := threeMembersContent()
+	compressed := compressLikePigz(t, data, 4096, 4)
+	for _, padding := range []int{1, 2, 511, 64 * 1024} {
+		decompressed, err := decompress(append(compressed, make([]byte, padding)...))
+		assert.NoError(t, err, "padding %d", padding)
+		assert.Equal(t, data, decompressed, "padding %d", padding)
+	}
+}
+
+func TestDecompress_garbageAfterZeroPadding(t *testing.T) {
+	compressed := compressLikePigz(t, threeMembersContent(), 4096, 4)
+	padded := append(append(compressed, make([]byte, 100)...), 0x01)
+	_, err := decompress(padded)
+	assert.IsType(t, computils.DecompressionError{}, err)
+}
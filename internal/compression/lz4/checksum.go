@@ -0,0 +1,90 @@
+package lz4
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ChecksumMode tells how the decompressor treats the frames without the content checksum,
+// the checksums are verified whenever the frame has them
+type ChecksumMode string
+
+const (
+	// ChecksumOptional accepts the frames without checksums silently
+	ChecksumOptional ChecksumMode = "optional"
+	// ChecksumWarn accepts the frames without checksums with a warning, e.g. the archives made by old versions
+	ChecksumWarn ChecksumMode = "warn"
+	// ChecksumStrict rejects the frames without checksums
+	ChecksumStrict ChecksumMode = "strict"
+)
+
+const (
+	frameMagic       = 0x184D2204
+	legacyFrameMagic = 0x184C2102
+
+	flagContentChecksum = 1 << 2
+	flagBlockChecksum   = 1 << 4
+
+	// magic and FLG byte of the frame descriptor
+	frameHeaderPrefix = 4 + 1
+)
+
+func ParseChecksumMode(mode string) (ChecksumMode, error) {
+	switch ChecksumMode(mode) {
+	case ChecksumOptional, ChecksumWarn, ChecksumStrict:
+		return ChecksumMode(mode), nil
+	}
+	return "", errors.Errorf("unknown lz4 checksum mode '%s', expected one of: %s, %s, %s",
+		mode, ChecksumOptional, ChecksumWarn, ChecksumStrict)
+}
+
+var (
+	checksumModeMutex sync.RWMutex
+	checksumMode      = ChecksumOptional
+	blockChecksums    bool
+)
+
+// SetChecksumMode configures how the decompressor treats the frames without checksums
+func SetChecksumMode(mode ChecksumMode) {
+	checksumModeMutex.Lock()
+	defer checksumModeMutex.Unlock()
+	checksumMode = mode
+}
+
+func getChecksumMode() ChecksumMode {
+	checksumModeMutex.RLock()
+	defer checksumModeMutex.RUnlock()
+	return checksumMode
+}
+
+// SetBlockChecksums makes the compressor write the checksum of every block besides the content checksum,
+// so the corrupted block is detected where it is rather than at the end of the frame. The frames with
+// the block checksums are larger, and some old lz4 decoders don't read them, so they are off by default.
+func SetBlockChecksums(enabled bool) {
+	checksumModeMutex.Lock()
+	defer checksumModeMutex.Unlock()
+	blockChecksums = enabled
+}
+
+func getBlockChecksums() bool {
+	checksumModeMutex.RLock()
+	defer checksumModeMutex.RUnlock()
+	return blockChecksums
+}
+
+// frameMissesChecksum reports whether the frame header declares neither the content nor block checksums,
+// the legacy frames never have them. The malformed header is left for the decoder to report.
+func frameMissesChecksum(header []byte) bool {
+	if len(header) < 4 {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(header) {
+	case legacyFrameMagic:
+		return true
+	case frameMagic:
+		return len(header) >= frameHeaderPrefix && header[4]&(flagContentChecksum|flagBlockChecksum) == 0
+	}
+	return false
+}
@@ -13,8 +13,15 @@ const (
 
 type Compressor struct{}
 
+// NewWriter emits the content checksum, and the block checksums too if they are enabled,
+// see SetBlockChecksums
 func (compressor Compressor) NewWriter(writer io.Writer) io.WriteCloser {
-	return lz4.NewWriter(writer)
+	lz4Writer := lz4.NewWriter(writer)
+	if getBlockChecksums() {
+		// the option is valid for the new writer, so Apply can't fail
+		_ = lz4Writer.Apply(lz4.BlockChecksumOption(true))
+	}
+	return lz4Writer
 }
 
 func (compressor Compressor) FileExtension() string {
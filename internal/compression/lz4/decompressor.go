@@ -1,18 +1,88 @@
 package lz4
 
 import (
+	"bufio"
 	"io"
 	"io/ioutil"
 
 	"github.com/pierrec/lz4/v4"
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/compression/computils"
 )
 
+var errMissingChecksum = errors.New("lz4 frame has no checksums, its integrity can't be verified")
+
 type Decompressor struct{}
 
+// Decompress verifies the content and block checksums of the frame if it has them,
+// the frame without checksums is accepted, reported or rejected according to the checksum mode.
+// The legacy frames, e.g. made by `lz4 -l`, are decoded too, they never have checksums.
+// Malformed or corrupted frames fail with computils.DecompressionError which tells the offset
+// in the compressed stream where the bad block was detected.
 func (decompressor Decompressor) Decompress(src io.Reader) (io.ReadCloser, error) {
-	return ioutil.NopCloser(lz4.NewReader(src)), nil
+	bufferedSrc := bufio.NewReader(src)
+	header, err := bufferedSrc.Peek(frameHeaderPrefix)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if frameMissesChecksum(header) {
+		switch getChecksumMode() {
+		case ChecksumStrict:
+			return nil, computils.NewDecompressionError(errMissingChecksum, AlgorithmName)
+		case ChecksumWarn:
+			tracelog.WarningLogger.Println(errMissingChecksum)
+		}
+	}
+	source := &countingReader{underlying: bufferedSrc}
+	return ioutil.NopCloser(&reader{lz4.NewReader(source), source}), nil
+}
+
+// DecompressTo decompresses the whole stream into dst, see compression.DecompressorV2
+func (decompressor Decompressor) DecompressTo(dst io.Writer, src io.Reader) (int64, error) {
+	decompressed, err := decompressor.Decompress(src)
+	if err != nil {
+		return 0, err
+	}
+	return computils.CopyDecompressed(dst, decompressed)
 }
 
 func (decompressor Decompressor) FileExtension() string {
 	return FileExtension
 }
+
+type countingReader struct {
+	underlying io.Reader
+	consumed   int64
+}
+
+func (source *countingReader) Read(p []byte) (int, error) {
+	n, err := source.underlying.Read(p)
+	source.consumed += int64(n)
+	return n, err
+}
+
+// reader converts the decoding failures into computils.DecompressionError with the compressed offset
+type reader struct {
+	lz4Reader *lz4.Reader
+	source    *countingReader
+}
+
+func (reader *reader) Read(p []byte) (int, error) {
+	n, err := reader.lz4Reader.Read(p)
+	if err != nil && err != io.EOF && isDecodeError(err) {
+		err = computils.NewDecompressionErrorAt(err, AlgorithmName, reader.source.consumed)
+	}
+	return n, err
+}
+
+func isDecodeError(err error) bool {
+	for _, decodeError := range []error{lz4.ErrInvalidBlockChecksum, lz4.ErrInvalidFrameChecksum,
+		lz4.ErrInvalidHeaderChecksum, lz4.ErrInvalidFrame, lz4.ErrInvalidSourceShortBuffer,
+		lz4.ErrOptionInvalidBlockSize, io.ErrUnexpectedEOF} {
+		if errors.Is(err, decodeError) {
+			return true
+		}
+	}
+	return false
+}
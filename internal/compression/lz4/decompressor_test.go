@@ -0,0 +1,146 @@
+package lz4
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/pierrec/lz4/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal/compression/computils"
+)
+
+// legacyFilePath contains two concatenated legacy frames made by `lz4 -l` of legacySampleContent
+const legacyFilePath = "testdata/legacy.lz4"
+
+func legacySampleContent() []byte {
+	var content bytes.Buffer
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&content, "WAL segment line %05d: the quick brown fox jumps over the lazy dog\n", i)
+	}
+	return bytes.Repeat(content.Bytes(), 2)
+}
+
+func sampleContent() []byte {
+	var content bytes.Buffer
+	for i := 0; content.Len() < 1<<20; i++ {
+		fmt.Fprintf(&content, "WAL record %08d: the quick brown fox jumps over the lazy dog\n", i*7919%100003)
+	}
+	return content.Bytes()
+}
+
+func compress(t *testing.T, writer io.WriteCloser, output *bytes.Buffer, data []byte) []byte {
+	_, err := writer.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	return output.Bytes()
+}
+
+// compressWithoutChecksums makes the frame like the ones written before the checksums were enabled
+func compressWithoutChecksums(t *testing.T, data []byte) []byte {
+	var output bytes.Buffer
+	writer := lz4.NewWriter(&output)
+	assert.NoError(t, writer.Apply(lz4.ChecksumOption(false)))
+	return compress(t, writer, &output, data)
+}
+
+func decompress(compressed []byte) ([]byte, error) {
+	reader, err := Decompressor{}.Decompress(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(reader)
+}
+
+func withChecksumMode(t *testing.T, mode ChecksumMode) {
+	SetChecksumMode(mode)
+	t.Cleanup(func() { SetChecksumMode(ChecksumOptional) })
+}
+
+func TestCompressor_writesChecksums(t *testing.T) {
+	withChecksumMode(t, ChecksumStrict)
+	data := sampleContent()
+	var output bytes.Buffer
+	compressed := compress(t, Compressor{}.NewWriter(&output), &output, data)
+	assert.False(t, frameMissesChecksum(compressed))
+
+	decompressed, err := decompress(compressed)
+	assert.NoError(t, err)
+	assert.Equal(t, data, decompressed)
+}
+
+func withBlockChecksums(t *testing.T) {
+	SetBlockChecksums(true)
+	t.Cleanup(func() { SetBlockChecksums(false) })
+}
+
+func TestCompressor_blockChecksumsOptIn(t *testing.T) {
+	var output bytes.Buffer
+	compressed := compress(t, Compressor{}.NewWriter(&output), &output, sampleContent())
+	assert.Zero(t, compressed[4]&flagBlockChecksum, "the block checksums change the format, they are off by default")
+	assert.NotZero(t, compressed[4]&flagContentChecksum)
+
+	withBlockChecksums(t)
+	output.Reset()
+	compressed = compress(t, Compressor{}.NewWriter(&output), &output, sampleContent())
+	assert.NotZero(t, compressed[4]&flagBlockChecksum)
+}
+
+func TestDecompress_corruptBlock(t *testing.T) {
+	withBlockChecksums(t)
+	var output bytes.Buffer
+	compressed := compress(t, Compressor{}.NewWriter(&output), &output, sampleContent())
+	corruptOffset := len(compressed) / 2
+	compressed[corruptOffset] ^= 0xff
+
+	_, err := decompress(compressed)
+	assert.IsType(t, computils.DecompressionError{}, err)
+	assert.Contains(t, err.Error(), "invalid block checksum")
+	assert.Contains(t, err.Error(), "after")
+}
+
+func TestDecompress_missingChecksum(t *testing.T) {
+	data := sampleContent()
+	compressed := compressWithoutChecksums(t, data)
+	assert.True(t, frameMissesChecksum(compressed))
+
+	for _, mode := range []ChecksumMode{ChecksumOptional, ChecksumWarn} {
+		withChecksumMode(t, mode)
+		decompressed, err := decompress(compressed)
+		assert.NoError(t, err, "mode %s", mode)
+		assert.Equal(t, data, decompressed, "mode %s", mode)
+	}
+
+	withChecksumMode(t, ChecksumStrict)
+	_, err := decompress(compressed)
+	assert.IsType(t, computils.DecompressionError{}, err)
+}
+
+func TestParseChecksumMode(t *testing.T) {
+	mode, err := ParseChecksumMode("strict")
+	assert.NoError(t, err)
+	assert.Equal(t, ChecksumStrict, mode)
+
+	_, err = ParseChecksumMode("always")
+	assert.Error(t, err)
+}
+
+func TestDecompress_legacyFrame(t *testing.T) {
+	compressed, err := ioutil.ReadFile(legacyFilePath)
+	assert.NoError(t, err)
+	assert.True(t, frameMissesChecksum(compressed))
+
+	decompressed, err := decompress(compressed)
+	assert.NoError(t, err)
+	assert.Equal(t, legacySampleContent(), decompressed)
+
+	// the legacy frame ends with the stream, so only the truncated block is detected
+	_, err = decompress(compressed[:len(compressed)-100])
+	assert.IsType(t, computils.DecompressionError{}, err)
+
+	withChecksumMode(t, ChecksumStrict)
+	_, err = decompress(compressed)
+	assert.IsType(t, computils.DecompressionError{}, err)
+}
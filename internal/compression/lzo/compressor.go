@@ -0,0 +1,122 @@
+package lzo
+
+import (
+	"encoding/binary"
+	"hash/adler32"
+	"io"
+)
+
+const AlgorithmName = "lzo"
+
+// lzop, LZO library and version needed to extract fields of the header
+var lzopWriterVersion = []byte{0x10, 0x30, 0x20, 0x60, 0x09, 0x40}
+
+// Compressor writes lzop files which can be unpacked by the lzop tool, the data is compressed
+// by the pure Go LZO1X encoder, so no cgo is needed
+type Compressor struct{}
+
+func (compressor Compressor) NewWriter(writer io.Writer) io.WriteCloser {
+	return &lzopWriter{dst: writer, block: make([]byte, 0, LzopBlockSize)}
+}
+
+func (compressor Compressor) FileExtension() string {
+	return FileExtension
+}
+
+// lzopWriter buffers LzopBlockSize blocks, every block is stored with adler32 checksums
+// of both uncompressed and compressed data. Blocks which don't shrink are stored as is.
+type lzopWriter struct {
+	dst           io.Writer
+	block         []byte
+	headerWritten bool
+	err           error
+}
+
+func (writer *lzopWriter) Write(p []byte) (int, error) {
+	if writer.err != nil {
+		return 0, writer.err
+	}
+	written := 0
+	for len(p) > 0 {
+		n := copy(writer.block[len(writer.block):cap(writer.block)], p)
+		writer.block = writer.block[:len(writer.block)+n]
+		written += n
+		p = p[n:]
+		if len(writer.block) == cap(writer.block) {
+			if writer.err = writer.writeBlock(); writer.err != nil {
+				return written, writer.err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close writes the buffered data and the end marker, the underlying writer is not closed
+func (writer *lzopWriter) Close() error {
+	if writer.err != nil {
+		return writer.err
+	}
+	if len(writer.block) > 0 {
+		if writer.err = writer.writeBlock(); writer.err != nil {
+			return writer.err
+		}
+	}
+	if writer.err = writer.writeHeader(); writer.err != nil {
+		return writer.err
+	}
+	writer.err = binary.Write(writer.dst, binary.BigEndian, uint32(0))
+	return writer.err
+}
+
+func (writer *lzopWriter) writeHeader() error {
+	if writer.headerWritten {
+		return nil
+	}
+	writer.headerWritten = true
+	header := make([]byte, 0, 34)
+	header = append(header, lzopWriterVersion...)
+	header = append(header, methodLZO1X1, 5)
+	header = appendUint32(header, flagAdler32D|flagAdler32C)
+	// mode, mtime (low and high) and the empty file name
+	header = append(header, make([]byte, 13)...)
+	header = appendUint32(header, adler32.Checksum(header))
+
+	if _, err := writer.dst.Write(lzopMagic); err != nil {
+		return err
+	}
+	_, err := writer.dst.Write(header)
+	return err
+}
+
+func (writer *lzopWriter) writeBlock() error {
+	if err := writer.writeHeader(); err != nil {
+		return err
+	}
+	block := writer.block
+	writer.block = writer.block[:0]
+
+	compressed := compressLZO1X(block)
+	blockHeader := make([]byte, 0, 16)
+	blockHeader = appendUint32(blockHeader, uint32(len(block)))
+	if len(compressed) < len(block) {
+		blockHeader = appendUint32(blockHeader, uint32(len(compressed)))
+		blockHeader = appendUint32(blockHeader, adler32.Checksum(block))
+		blockHeader = appendUint32(blockHeader, adler32.Checksum(compressed))
+	} else {
+		// lzop stores the incompressible block as is and omits the checksum of the compressed data
+		compressed = block
+		blockHeader = appendUint32(blockHeader, uint32(len(block)))
+		blockHeader = appendUint32(blockHeader, adler32.Checksum(block))
+	}
+	if _, err := writer.dst.Write(blockHeader); err != nil {
+		return err
+	}
+	_, err := writer.dst.Write(compressed)
+	return err
+}
+
+func appendUint32(dst []byte, value uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], value)
+	return append(dst, buf[:]...)
+}
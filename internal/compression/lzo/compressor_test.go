@@ -0,0 +1,101 @@
+package lzo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/compression/computils"
+)
+
+// lzopFilePath contains the WAL segment compressed by lzop 1.03 with liblzo2 2.06, it is the WAL-E archive
+// ../../../test/testdata/000000010000000000000024.lzo decrypted, the blocks carry the adler32 of their content
+const lzopFilePath = "testdata/wal_segment.lzo"
+
+func compress(data []byte) []byte {
+	var file bytes.Buffer
+	writer := Compressor{}.NewWriter(&file)
+	_, _ = writer.Write(data)
+	_ = writer.Close()
+	return file.Bytes()
+}
+
+func decompress(compressed []byte) ([]byte, error) {
+	reader, err := Decompressor{}.Decompress(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(reader)
+}
+
+func readLzopFile(t *testing.T) []byte {
+	compressed, err := ioutil.ReadFile(lzopFilePath)
+	require.NoError(t, err)
+	return compressed
+}
+
+// the lzop utility output is read by both the liblzo2 and the pure Go decompressors
+func TestDecompress_lzopFile(t *testing.T) {
+	compressed := readLzopFile(t)
+	assert.True(t, bytes.HasPrefix(compressed, lzopMagic))
+
+	segment, err := decompress(compressed)
+	require.NoError(t, err)
+	assert.Len(t, segment, 16<<20)
+
+	_, err = decompress(compressed[:len(compressed)/2])
+	assert.Error(t, err)
+}
+
+func TestCompressor_roundTrip(t *testing.T) {
+	random := rand.New(rand.NewSource(3))
+	incompressible := make([]byte, 300<<10)
+	random.Read(incompressible)
+
+	for _, data := range [][]byte{
+		nil,
+		computils.GenerateWALSample(1),
+		computils.GenerateWALSample(LzopBlockSize),
+		append(computils.GenerateWALSample(2*LzopBlockSize+17), incompressible...),
+	} {
+		compressed := compress(data)
+		assert.True(t, bytes.HasPrefix(compressed, lzopMagic))
+		decompressed, err := decompress(compressed)
+		assert.NoError(t, err, "size %d", len(data))
+		assert.True(t, bytes.Equal(data, decompressed), "size %d", len(data))
+	}
+}
+
+func TestCompressor_smallWrites(t *testing.T) {
+	data := computils.GenerateWALSample(LzopBlockSize + 5000)
+	var file bytes.Buffer
+	writer := Compressor{}.NewWriter(&file)
+	for chunk := data; len(chunk) > 0; {
+		n := 1000
+		if n > len(chunk) {
+			n = len(chunk)
+		}
+		written, err := writer.Write(chunk[:n])
+		assert.NoError(t, err)
+		assert.Equal(t, n, written)
+		chunk = chunk[n:]
+	}
+	assert.NoError(t, writer.Close())
+
+	assert.Equal(t, compress(data), file.Bytes())
+}
+
+// the segment is unpacked from the lzop utility output, then packed by our compressor and unpacked again
+func TestCompressor_lzopFile(t *testing.T) {
+	segment, err := decompress(readLzopFile(t))
+	require.NoError(t, err)
+
+	compressed := compress(segment)
+	assert.Less(t, len(compressed), len(segment))
+	decompressed, err := decompress(compressed)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(segment, decompressed))
+}
@@ -0,0 +1,36 @@
+//go:build lzo && cgo
+// +build lzo,cgo
+
+package lzo
+
+import (
+	"io"
+	"io/ioutil"
+
+	"github.com/cyberdelia/lzo"
+	"github.com/wal-g/wal-g/internal/compression/computils"
+)
+
+// Decompressor uses liblzo2 when WAL-G is built with the lzo tag and cgo is available
+type Decompressor struct{}
+
+func (decompressor Decompressor) Decompress(src io.Reader) (io.ReadCloser, error) {
+	lzor, err := lzo.NewReader(src)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(lzor), nil
+}
+
+// DecompressTo decompresses the whole stream into dst, see compression.DecompressorV2
+func (decompressor Decompressor) DecompressTo(dst io.Writer, src io.Reader) (int64, error) {
+	decompressed, err := decompressor.Decompress(src)
+	if err != nil {
+		return 0, err
+	}
+	return computils.CopyDecompressed(dst, decompressed)
+}
+
+func (decompressor Decompressor) FileExtension() string {
+	return FileExtension
+}
@@ -0,0 +1,39 @@
+//go:build !lzo || !cgo
+// +build !lzo !cgo
+
+package lzo
+
+import (
+	"io"
+	"io/ioutil"
+
+	"github.com/wal-g/wal-g/internal/compression/computils"
+)
+
+// Decompressor is the pure Go lzop decompressor used when WAL-G is built without liblzo2,
+// e.g. statically with cgo disabled
+type Decompressor struct{}
+
+func (decompressor Decompressor) Decompress(src io.Reader) (io.ReadCloser, error) {
+	reader, err := newLzopReader(src)
+	if err != nil {
+		if isDecodeError(err) {
+			return nil, computils.NewDecompressionError(err, FileExtension)
+		}
+		return nil, err
+	}
+	return ioutil.NopCloser(computils.NewDecompressionErrorReader(reader, FileExtension, isDecodeError)), nil
+}
+
+// DecompressTo decompresses the whole stream into dst, see compression.DecompressorV2
+func (decompressor Decompressor) DecompressTo(dst io.Writer, src io.Reader) (int64, error) {
+	decompressed, err := decompressor.Decompress(src)
+	if err != nil {
+		return 0, err
+	}
+	return computils.CopyDecompressed(dst, decompressed)
+}
+
+func (decompressor Decompressor) FileExtension() string {
+	return FileExtension
+}
@@ -0,0 +1,7 @@
+package lzo
+
+const (
+	FileExtension = "lzo"
+
+	LzopBlockSize = 256 * 1024
+)
@@ -0,0 +1,213 @@
+//go:build !lzo || !cgo
+// +build !lzo !cgo
+
+package lzo
+
+type lzo1xDecoder struct {
+	src []byte
+	dst []byte
+	in  int
+	out int
+}
+
+// decompressLZO1X decodes the LZO1X compressed block, dst must have the exact uncompressed size
+func decompressLZO1X(src, dst []byte) error {
+	decoder := lzo1xDecoder{src: src, dst: dst}
+	return decoder.decode()
+}
+
+func (decoder *lzo1xDecoder) decode() error {
+	state := 0
+	t, err := decoder.readByte()
+	if err != nil {
+		return err
+	}
+	if t > firstLiteralRunBias {
+		length := t - firstLiteralRunBias
+		if err = decoder.copyLiterals(length); err != nil {
+			return err
+		}
+		state = afterLiteralRun
+		if length < 4 {
+			state = length
+		}
+		if t, err = decoder.readByte(); err != nil {
+			return err
+		}
+	}
+
+	for {
+		if t < m4Marker && state == 0 {
+			if err = decoder.literalRun(t); err != nil {
+				return err
+			}
+			state = afterLiteralRun
+		} else {
+			distance, length, next, err := decoder.readMatch(t, state)
+			if err != nil {
+				return err
+			}
+			if distance == 0 {
+				return decoder.checkEnd(length)
+			}
+			if err = decoder.copyMatch(distance, length); err != nil {
+				return err
+			}
+			if err = decoder.copyLiterals(next); err != nil {
+				return err
+			}
+			state = next
+		}
+		if t, err = decoder.readByte(); err != nil {
+			return err
+		}
+	}
+}
+
+func (decoder *lzo1xDecoder) literalRun(t int) error {
+	length := t + 3
+	if t == 0 {
+		extra, err := decoder.readLength()
+		if err != nil {
+			return err
+		}
+		length = 15 + 3 + extra
+	}
+	return decoder.copyLiterals(length)
+}
+
+// readMatch decodes the match instruction, the zero distance is returned for the end of stream marker.
+// next is the number of literals which follow the match.
+func (decoder *lzo1xDecoder) readMatch(t int, state int) (distance, length, next int, err error) {
+	switch {
+	case t >= m2Marker:
+		b, err := decoder.readByte()
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		return 1 + (t>>2)&7 + b<<3, t>>5 + 1, t & 3, nil
+	case t >= m3Marker:
+		length, err = decoder.readMatchLength(t&31, 31)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		field, err := decoder.readUint16()
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		return 1 + field>>2, length, field & 3, nil
+	case t >= m4Marker:
+		length, err = decoder.readMatchLength(t&7, 7)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		field, err := decoder.readUint16()
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		distance = (t&8)<<11 + field>>2
+		if distance == 0 {
+			return 0, length, 0, nil
+		}
+		return distance + m4MinOffset, length, field & 3, nil
+	default:
+		// M1 match, only possible right after literals
+		b, err := decoder.readByte()
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if state == afterLiteralRun {
+			return 1 + m2MaxOffset + t>>2 + b<<2, 3, t & 3, nil
+		}
+		return 1 + t>>2 + b<<2, 2, t & 3, nil
+	}
+}
+
+func (decoder *lzo1xDecoder) readMatchLength(lengthBits int, maxBits int) (int, error) {
+	if lengthBits != 0 {
+		return lengthBits + 2, nil
+	}
+	extra, err := decoder.readLength()
+	if err != nil {
+		return 0, err
+	}
+	return maxBits + 2 + extra, nil
+}
+
+// readLength reads the length continuation: every zero byte adds 255 and the first non-zero byte ends it
+func (decoder *lzo1xDecoder) readLength() (int, error) {
+	length := 0
+	for {
+		b, err := decoder.readByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != 0 {
+			return length + b, nil
+		}
+		length += 255
+		if length > len(decoder.dst) {
+			return 0, newFormatError("lzo1x: length exceeds the block size")
+		}
+	}
+}
+
+func (decoder *lzo1xDecoder) checkEnd(length int) error {
+	if length != 3 {
+		return newFormatError("lzo1x: malformed end of stream marker")
+	}
+	if decoder.out != len(decoder.dst) {
+		return newFormatError("lzo1x: decompressed %d bytes instead of %d", decoder.out, len(decoder.dst))
+	}
+	if decoder.in != len(decoder.src) {
+		return newFormatError("lzo1x: %d bytes left after the end of stream marker", len(decoder.src)-decoder.in)
+	}
+	return nil
+}
+
+func (decoder *lzo1xDecoder) readByte() (int, error) {
+	if decoder.in >= len(decoder.src) {
+		return 0, newFormatError("lzo1x: input overrun")
+	}
+	b := decoder.src[decoder.in]
+	decoder.in++
+	return int(b), nil
+}
+
+func (decoder *lzo1xDecoder) readUint16() (int, error) {
+	if decoder.in+2 > len(decoder.src) {
+		return 0, newFormatError("lzo1x: input overrun")
+	}
+	value := int(decoder.src[decoder.in]) | int(decoder.src[decoder.in+1])<<8
+	decoder.in += 2
+	return value, nil
+}
+
+func (decoder *lzo1xDecoder) copyLiterals(length int) error {
+	if decoder.in+length > len(decoder.src) {
+		return newFormatError("lzo1x: input overrun")
+	}
+	if decoder.out+length > len(decoder.dst) {
+		return newFormatError("lzo1x: output overrun")
+	}
+	copy(decoder.dst[decoder.out:], decoder.src[decoder.in:decoder.in+length])
+	decoder.in += length
+	decoder.out += length
+	return nil
+}
+
+func (decoder *lzo1xDecoder) copyMatch(distance int, length int) error {
+	if distance > decoder.out {
+		return newFormatError("lzo1x: lookbehind overrun")
+	}
+	if decoder.out+length > len(decoder.dst) {
+		return newFormatError("lzo1x: output overrun")
+	}
+	// the match may overlap the bytes being written, so it is copied byte by byte
+	from := decoder.out - distance
+	for i := 0; i < length; i++ {
+		decoder.dst[decoder.out+i] = decoder.dst[from+i]
+	}
+	decoder.out += length
+	return nil
+}
@@ -0,0 +1,95 @@
+package lzo
+
+import "encoding/binary"
+
+// LZO1X instruction ranges, the meaning of the first instruction byte depends on its value
+// and on the number of literals copied by the previous instruction
+const (
+	m2Marker = 64
+	m3Marker = 32
+	m4Marker = 16
+
+	m2MaxOffset = 0x0800
+	m4MinOffset = 0x4000
+
+	// the first byte above this value is the length of the leading literal run
+	firstLiteralRunBias = 17
+	// state after the literal run instruction, the following M1 match is 3 bytes long
+	afterLiteralRun = 4
+)
+
+// compressLZO1X is the simple greedy LZO1X compressor, it only emits long distance matches
+// to cover the literal and match encodings handled by every decoder state
+func compressLZO1X(src []byte) []byte {
+	const maxDistance = 0xbfff
+	dst := make([]byte, 0, len(src)+len(src)/16+64)
+	var table [1 << 14]int
+	matchField := -1
+	literalStart := 0
+	for pos := 0; pos+4 <= len(src); {
+		key := binary.LittleEndian.Uint32(src[pos:])
+		hash := (key * 2654435761) >> 18
+		candidate := table[hash] - 1
+		table[hash] = pos + 1
+		if candidate < 0 || pos-candidate > maxDistance || binary.LittleEndian.Uint32(src[candidate:]) != key {
+			pos++
+			continue
+		}
+		length := 4
+		for pos+length < len(src) && src[candidate+length] == src[pos+length] {
+			length++
+		}
+		dst = appendLiterals(dst, src[literalStart:pos], matchField)
+		dst, matchField = appendMatch(dst, pos-candidate, length)
+		pos += length
+		literalStart = pos
+	}
+	dst = appendLiterals(dst, src[literalStart:], matchField)
+	return append(dst, m4Marker|1, 0, 0)
+}
+
+func appendLiterals(dst []byte, literals []byte, matchField int) []byte {
+	switch {
+	case len(literals) == 0:
+		return dst
+	case matchField < 0 && len(literals) <= 255-firstLiteralRunBias:
+		dst = append(dst, byte(firstLiteralRunBias+len(literals)))
+	case matchField >= 0 && len(literals) < 4:
+		// short literal runs are encoded in the low bits of the previous match distance
+		dst[matchField] |= byte(len(literals))
+	case len(literals) <= 18:
+		dst = append(dst, byte(len(literals)-3))
+	default:
+		dst = appendLength(append(dst, 0), len(literals)-18)
+	}
+	return append(dst, literals...)
+}
+
+func appendMatch(dst []byte, distance int, length int) ([]byte, int) {
+	if distance <= m4MinOffset {
+		if length <= 33 {
+			dst = append(dst, byte(m3Marker|(length-2)))
+		} else {
+			dst = appendLength(append(dst, m3Marker), length-33)
+		}
+		distance--
+	} else {
+		distance -= m4MinOffset
+		highBit := byte(distance>>14) << 3
+		if length <= 9 {
+			dst = append(dst, m4Marker|highBit|byte(length-2))
+		} else {
+			dst = appendLength(append(dst, m4Marker|highBit), length-9)
+		}
+		distance &= 0x3fff
+	}
+	matchField := len(dst)
+	return append(dst, byte(distance<<2), byte(distance>>6)), matchField
+}
+
+func appendLength(dst []byte, length int) []byte {
+	for ; length > 255; length -= 255 {
+		dst = append(dst, 0)
+	}
+	return append(dst, byte(length))
+}
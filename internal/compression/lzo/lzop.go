@@ -0,0 +1,27 @@
+package lzo
+
+var lzopMagic = []byte{0x89, 'L', 'Z', 'O', 0x00, 0x0d, 0x0a, 0x1a, 0x0a}
+
+// lzop header flags
+const (
+	flagAdler32D   = 0x0001
+	flagAdler32C   = 0x0002
+	flagExtraField = 0x0040
+	flagCRC32D     = 0x0100
+	flagCRC32C     = 0x0200
+	flagFilter     = 0x0800
+	flagHeaderCRC  = 0x1000
+)
+
+// the header fields are extended starting from this lzop version
+const lzopExtendedHeaderVersion = 0x0940
+
+// lzop refuses to make blocks larger than that, so the size above it means the corrupt block header
+const lzopMaxBlockSize = 64 * 1024 * 1024
+
+// lzop compression methods, all of them produce the LZO1X stream
+const (
+	methodLZO1X1   = 1
+	methodLZO1X115 = 2
+	methodLZO1X999 = 3
+)
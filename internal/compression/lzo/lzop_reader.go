@@ -0,0 +1,258 @@
+//go:build !lzo || !cgo
+// +build !lzo !cgo
+
+package lzo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/adler32"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+)
+
+// FormatError is used to signal that the lzop stream is malformed or its checksum doesn't match
+type FormatError struct {
+	error
+}
+
+func newFormatError(format string, args ...interface{}) FormatError {
+	return FormatError{errors.Errorf(format, args...)}
+}
+
+func (err FormatError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+func isDecodeError(err error) bool {
+	_, ok := err.(FormatError)
+	return ok || err == io.ErrUnexpectedEOF
+}
+
+// lzopReader reads the lzop file block by block verifying the block checksums
+type lzopReader struct {
+	src        io.Reader
+	flags      uint32
+	block      bytes.Reader
+	compressed []byte
+	buffer     []byte
+	err        error
+}
+
+func newLzopReader(src io.Reader) (*lzopReader, error) {
+	reader := &lzopReader{src: src}
+	if err := reader.readHeader(); err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+func (reader *lzopReader) Read(p []byte) (int, error) {
+	for reader.block.Len() == 0 {
+		if reader.err != nil {
+			return 0, reader.err
+		}
+		reader.err = reader.readBlock()
+	}
+	return reader.block.Read(p)
+}
+
+func (reader *lzopReader) readHeader() error {
+	magic := make([]byte, len(lzopMagic))
+	if _, err := io.ReadFull(reader.src, magic); err != nil {
+		return unexpectedEOF(err)
+	}
+	if !bytes.Equal(magic, lzopMagic) {
+		return newFormatError("lzop: invalid magic bytes")
+	}
+
+	// the header checksum covers all the fields from the version to the file name
+	header := &headerReader{src: reader.src}
+	version := header.uint16()
+	header.uint16() // library version
+	if version >= lzopExtendedHeaderVersion {
+		header.uint16() // version needed to extract
+	}
+	method := header.uint8()
+	if version >= lzopExtendedHeaderVersion {
+		header.uint8() // level
+	}
+	reader.flags = header.uint32()
+	if reader.flags&flagFilter != 0 {
+		header.uint32()
+	}
+	header.uint32() // mode
+	header.uint32() // mtime
+	if version >= lzopExtendedHeaderVersion {
+		header.uint32() // mtime high bits
+	}
+	header.bytes(int(header.uint8())) // file name
+	if header.err != nil {
+		return unexpectedEOF(header.err)
+	}
+
+	checksum := adler32.Checksum(header.read)
+	if reader.flags&flagHeaderCRC != 0 {
+		checksum = crc32.ChecksumIEEE(header.read)
+	}
+	expectedChecksum, err := reader.readUint32()
+	if err != nil {
+		return err
+	}
+	if checksum != expectedChecksum {
+		return newFormatError("lzop: header checksum mismatch")
+	}
+	if method != methodLZO1X1 && method != methodLZO1X115 && method != methodLZO1X999 {
+		return newFormatError("lzop: unsupported compression method %d", method)
+	}
+	if reader.flags&flagExtraField != 0 {
+		return reader.skipExtraField()
+	}
+	return nil
+}
+
+func (reader *lzopReader) skipExtraField() error {
+	length, err := reader.readUint32()
+	if err != nil {
+		return err
+	}
+	// the extra field is followed by its checksum
+	_, err = io.CopyN(ioutil.Discard, reader.src, int64(length)+4)
+	return unexpectedEOF(err)
+}
+
+func (reader *lzopReader) readBlock() error {
+	uncompressedSize, err := reader.readUint32()
+	if err != nil {
+		return err
+	}
+	if uncompressedSize == 0 {
+		return io.EOF
+	}
+	compressedSize, err := reader.readUint32()
+	if err != nil {
+		return err
+	}
+	if uncompressedSize > lzopMaxBlockSize || compressedSize > uncompressedSize {
+		return newFormatError("lzop: invalid block sizes %d/%d", compressedSize, uncompressedSize)
+	}
+
+	uncompressedChecksum, err := reader.readChecksum(flagAdler32D | flagCRC32D)
+	if err != nil {
+		return err
+	}
+	// the compressed data checksum is omitted for the blocks stored uncompressed
+	compressedChecksum := uncompressedChecksum
+	isCompressed := compressedSize < uncompressedSize
+	if isCompressed {
+		if compressedChecksum, err = reader.readChecksum(flagAdler32C | flagCRC32C); err != nil {
+			return err
+		}
+	}
+
+	reader.compressed = resize(reader.compressed, int(compressedSize))
+	if _, err = io.ReadFull(reader.src, reader.compressed); err != nil {
+		return unexpectedEOF(err)
+	}
+	if isCompressed {
+		err = reader.verifyChecksum(reader.compressed, compressedChecksum, flagAdler32C, flagCRC32C)
+		if err != nil {
+			return err
+		}
+		reader.buffer = resize(reader.buffer, int(uncompressedSize))
+		if err = decompressLZO1X(reader.compressed, reader.buffer); err != nil {
+			return err
+		}
+	} else {
+		reader.buffer, reader.compressed = reader.compressed, reader.buffer
+	}
+	err = reader.verifyChecksum(reader.buffer, uncompressedChecksum, flagAdler32D, flagCRC32D)
+	if err != nil {
+		return err
+	}
+	reader.block.Reset(reader.buffer)
+	return nil
+}
+
+func (reader *lzopReader) readChecksum(flags uint32) (uint32, error) {
+	if reader.flags&flags == 0 {
+		return 0, nil
+	}
+	return reader.readUint32()
+}
+
+func (reader *lzopReader) verifyChecksum(data []byte, expected uint32, adlerFlag, crcFlag uint32) error {
+	var checksum hash.Hash32
+	switch {
+	case reader.flags&crcFlag != 0:
+		checksum = crc32.NewIEEE()
+	case reader.flags&adlerFlag != 0:
+		checksum = adler32.New()
+	default:
+		return nil
+	}
+	_, _ = checksum.Write(data)
+	if checksum.Sum32() != expected {
+		return newFormatError("lzop: block checksum mismatch")
+	}
+	return nil
+}
+
+func (reader *lzopReader) readUint32() (uint32, error) {
+	var value uint32
+	if err := binary.Read(reader.src, binary.BigEndian, &value); err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	return value, nil
+}
+
+// headerReader reads the big endian header fields remembering the read bytes for the checksum,
+// the first error stops reading
+type headerReader struct {
+	src  io.Reader
+	read []byte
+	err  error
+}
+
+func (header *headerReader) bytes(length int) []byte {
+	if header.err != nil {
+		return make([]byte, length)
+	}
+	data := make([]byte, length)
+	_, header.err = io.ReadFull(header.src, data)
+	header.read = append(header.read, data...)
+	return data
+}
+
+func (header *headerReader) uint8() uint8 {
+	return header.bytes(1)[0]
+}
+
+func (header *headerReader) uint16() uint16 {
+	return binary.BigEndian.Uint16(header.bytes(2))
+}
+
+func (header *headerReader) uint32() uint32 {
+	return binary.BigEndian.Uint32(header.bytes(4))
+}
+
+// unexpectedEOF converts io.EOF into io.ErrUnexpectedEOF, since the stream must not end in the middle of lzop file
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func resize(buffer []byte, size int) []byte {
+	if cap(buffer) < size {
+		return make([]byte, size)
+	}
+	return buffer[:size]
+}
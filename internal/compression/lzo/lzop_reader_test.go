@@ -0,0 +1,62 @@
+//go:build !lzo || !cgo
+// +build !lzo !cgo
+
+package lzo
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal/compression/computils"
+)
+
+func TestLZO1XRoundTrip(t *testing.T) {
+	for _, size := range []int{1, 3, 17, 300, 64 << 10, 1 << 20} {
+		data := computils.GenerateWALSample(size)
+		decompressed := make([]byte, len(data))
+		assert.NoError(t, decompressLZO1X(compressLZO1X(data), decompressed), "size %d", size)
+		assert.True(t, bytes.Equal(data, decompressed), "size %d", size)
+	}
+}
+
+func TestDecompress_roundTrip(t *testing.T) {
+	random := rand.New(rand.NewSource(2))
+	incompressible := make([]byte, 100<<10)
+	random.Read(incompressible)
+	data := append(computils.GenerateWALSample(3*LzopBlockSize+1000), incompressible...)
+
+	decompressed, err := decompress(compress(data))
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(data, decompressed))
+}
+
+func TestDecompress_emptyFile(t *testing.T) {
+	decompressed, err := decompress(compress(nil))
+	assert.NoError(t, err)
+	assert.Empty(t, decompressed)
+}
+
+func TestDecompress_corruptBlock(t *testing.T) {
+	compressed := compress(computils.GenerateWALSample(64 << 10))
+	compressed[len(compressed)/2] ^= 0xff
+
+	_, err := decompress(compressed)
+	assert.IsType(t, computils.DecompressionError{}, err)
+}
+
+func TestDecompress_corruptHeader(t *testing.T) {
+	compressed := compress(computils.GenerateWALSample(64 << 10))
+	compressed[len(lzopMagic)+1] ^= 0xff
+
+	_, err := Decompressor{}.Decompress(bytes.NewReader(compressed))
+	assert.IsType(t, computils.DecompressionError{}, err)
+}
+
+func TestDecompress_truncatedFile(t *testing.T) {
+	compressed := compress(computils.GenerateWALSample(64 << 10))
+
+	_, err := decompress(compressed[:len(compressed)-100])
+	assert.IsType(t, computils.DecompressionError{}, err)
+}
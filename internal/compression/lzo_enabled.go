@@ -3,8 +3,11 @@
 
 package compression
 
-import "github.com/wal-g/wal-g/internal/compression/lzo"
+import (
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/compression/lzo"
+)
 
 func init() {
-	Decompressors = append(Decompressors, lzo.Decompressor{})
+	tracelog.ErrorLogger.FatalOnError(RegisterDecompressor(lzo.Decompressor{}))
 }
@@ -0,0 +1,15 @@
+//go:build lzo && !windows
+// +build lzo,!windows
+
+package compression
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal/compression/lzo"
+)
+
+func TestLzoDecompressorRegistered(t *testing.T) {
+	assert.Equal(t, lzo.Decompressor{}, FindDecompressor(lzo.FileExtension))
+}
@@ -0,0 +1,14 @@
+//go:build !lzo || windows
+// +build !lzo windows
+
+package compression
+
+import (
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/compression/lzo"
+)
+
+// the builds without the lzo tag decompress lzop files by the pure Go decompressor instead of liblzo2
+func init() {
+	tracelog.ErrorLogger.FatalOnError(RegisterDecompressor(lzo.Decompressor{}))
+}
@@ -0,0 +1,52 @@
+package compression
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// MaxMagicLength is the number of leading stream bytes enough to recognize any known format
+const MaxMagicLength = 10
+
+type magicNumber struct {
+	magic         []byte
+	fileExtension string
+}
+
+// magicNumbers maps the leading bytes of compressed streams to the extension of the decompressor.
+// Formats without a reliable signature (lzma, brotli) can only be chosen by extension.
+var magicNumbers = []magicNumber{
+	{[]byte{0x04, 0x22, 0x4d, 0x18}, "lz4"},
+	// legacy frame of `lz4 -l` and the older tools
+	{[]byte{0x02, 0x21, 0x4c, 0x18}, "lz4"},
+	{[]byte{0x28, 0xb5, 0x2f, 0xfd}, "zst"},
+	{[]byte{0x1f, 0x8b}, "gz"},
+	{[]byte("BZh"), "bz2"},
+	{[]byte{0x89, 'L', 'Z', 'O', 0x00, 0x0d, 0x0a, 0x1a}, "lzo"},
+	{[]byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, "xz"},
+	// stream identifier chunk of the snappy framing format
+	{[]byte{0xff, 0x06, 0x00, 0x00, 's', 'N', 'a', 'P', 'p', 'Y'}, "snappy"},
+}
+
+// FindDecompressorByMagic returns the registered decompressor which format signature
+// matches the header, or nil if there is none.
+func FindDecompressorByMagic(header []byte) Decompressor {
+	for _, number := range magicNumbers {
+		if bytes.HasPrefix(header, number.magic) {
+			return FindDecompressor(number.fileExtension)
+		}
+	}
+	return nil
+}
+
+// DetectDecompressor peeks at the beginning of src and looks for a decompressor by the magic bytes.
+// The returned reader still contains the peeked bytes and must be used instead of src.
+func DetectDecompressor(src io.Reader) (Decompressor, io.Reader, error) {
+	bufReader := bufio.NewReader(src)
+	header, err := bufReader.Peek(MaxMagicLength)
+	if err != nil && err != io.EOF {
+		return nil, bufReader, err
+	}
+	return FindDecompressorByMagic(header), bufReader, nil
+}
@@ -0,0 +1,23 @@
+package snappy
+
+import (
+	"io"
+
+	"github.com/golang/snappy"
+)
+
+const (
+	AlgorithmName = "snappy"
+	FileExtension = "snappy"
+)
+
+// Compressor writes the snappy framing format, every chunk of which carries the checksum of its data
+type Compressor struct{}
+
+func (compressor Compressor) NewWriter(writer io.Writer) io.WriteCloser {
+	return snappy.NewBufferedWriter(writer)
+}
+
+func (compressor Compressor) FileExtension() string {
+	return FileExtension
+}
@@ -0,0 +1,35 @@
+package snappy
+
+import (
+	"io"
+	"io/ioutil"
+
+	"github.com/golang/snappy"
+	"github.com/wal-g/wal-g/internal/compression/computils"
+)
+
+type Decompressor struct{}
+
+// Decompress reads the snappy framing format. The checksum of every chunk is validated,
+// so a damaged or truncated stream fails with computils.DecompressionError.
+func (decompressor Decompressor) Decompress(src io.Reader) (io.ReadCloser, error) {
+	snappyReader := snappy.NewReader(src)
+	return ioutil.NopCloser(computils.NewDecompressionErrorReader(snappyReader, AlgorithmName, isDecodeError)), nil
+}
+
+// DecompressTo decompresses the whole stream into dst, see compression.DecompressorV2
+func (decompressor Decompressor) DecompressTo(dst io.Writer, src io.Reader) (int64, error) {
+	decompressed, err := decompressor.Decompress(src)
+	if err != nil {
+		return 0, err
+	}
+	return computils.CopyDecompressed(dst, decompressed)
+}
+
+func (decompressor Decompressor) FileExtension() string {
+	return FileExtension
+}
+
+func isDecodeError(err error) bool {
+	return err == snappy.ErrCorrupt || err == snappy.ErrUnsupported
+}
@@ -0,0 +1,95 @@
+package snappy_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/compression/computils"
+	"github.com/wal-g/wal-g/internal/compression/lz4"
+	"github.com/wal-g/wal-g/internal/compression/snappy"
+)
+
+func compress(t testing.TB, compressor compression.Compressor, data []byte) []byte {
+	var compressed bytes.Buffer
+	writer := compressor.NewWriter(&compressed)
+	_, err := writer.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	return compressed.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, 64 << 10, 1 << 20} {
+		data := computils.GenerateWALSample(size)
+		compressed := compress(t, snappy.Compressor{}, data)
+
+		reader, err := snappy.Decompressor{}.Decompress(bytes.NewReader(compressed))
+		assert.NoError(t, err)
+		decompressed, err := ioutil.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.True(t, bytes.Equal(data, decompressed), "size %d", size)
+	}
+}
+
+func TestDecompress_corruptChecksum(t *testing.T) {
+	compressed := compress(t, snappy.Compressor{}, computils.GenerateWALSample(64<<10))
+	// skip the 10 bytes stream identifier and the 4 bytes chunk header, then damage the chunk checksum
+	compressed[14] ^= 0xff
+
+	reader, err := snappy.Decompressor{}.Decompress(bytes.NewReader(compressed))
+	assert.NoError(t, err)
+	_, err = io.Copy(ioutil.Discard, reader)
+	assert.IsType(t, computils.DecompressionError{}, err)
+}
+
+func TestDecompress_truncatedStream(t *testing.T) {
+	compressed := compress(t, snappy.Compressor{}, computils.GenerateWALSample(64<<10))
+
+	reader, err := snappy.Decompressor{}.Decompress(bytes.NewReader(compressed[:len(compressed)/2]))
+	assert.NoError(t, err)
+	_, err = io.Copy(ioutil.Discard, reader)
+	assert.IsType(t, computils.DecompressionError{}, err)
+}
+
+func benchmarkCompression(b *testing.B, compressor compression.Compressor) {
+	data := computils.GenerateWALSample(16 << 20)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		writer := compressor.NewWriter(ioutil.Discard)
+		_, _ = writer.Write(data)
+		_ = writer.Close()
+	}
+}
+
+func benchmarkDecompression(b *testing.B, compressor compression.Compressor) {
+	data := computils.GenerateWALSample(16 << 20)
+	compressed := compress(b, compressor, data)
+	decompressor := compression.GetDecompressorByCompressor(compressor)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		reader, _ := decompressor.Decompress(bytes.NewReader(compressed))
+		_, _ = io.Copy(ioutil.Discard, reader)
+	}
+}
+
+func BenchmarkCompress_snappy(b *testing.B) {
+	benchmarkCompression(b, snappy.Compressor{})
+}
+
+func BenchmarkCompress_lz4(b *testing.B) {
+	benchmarkCompression(b, lz4.Compressor{})
+}
+
+func BenchmarkDecompress_snappy(b *testing.B) {
+	benchmarkDecompression(b, snappy.Compressor{})
+}
+
+func BenchmarkDecompress_lz4(b *testing.B) {
+	benchmarkDecompression(b, lz4.Compressor{})
+}
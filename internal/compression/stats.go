@@ -0,0 +1,218 @@
+package compression
+
+import (
+	"expvar"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/compression/computils"
+)
+
+var (
+	statsMutex   sync.RWMutex
+	statsEnabled bool
+
+	decompressionStatsMutex sync.Mutex
+	decompressionStats      = make(map[string]*DecompressionStats)
+	activeDecompressions    int
+	maxActiveDecompressions int
+)
+
+func init() {
+	expvar.Publish("walg_decompression", expvar.Func(func() interface{} {
+		return GetDecompressionStats()
+	}))
+}
+
+// SetStatsEnabled turns on the measurement of every decompressed file: its throughput is logged at DEVEL level
+// and summed up by the format. When it is off, Decompress doesn't wrap the readers at all.
+func SetStatsEnabled(enabled bool) {
+	statsMutex.Lock()
+	defer statsMutex.Unlock()
+	statsEnabled = enabled
+}
+
+func isStatsEnabled() bool {
+	statsMutex.RLock()
+	defer statsMutex.RUnlock()
+	return statsEnabled
+}
+
+// DecompressionStats sums up the decompressed files of one format. Duration is the time spent in the decompressor
+// itself: the time of reading its compressed source, e.g. downloading, is excluded, so the formats are compared
+// regardless of the storage speed. The ReadAheadDecompressor overlaps the decoding with the download,
+// so its files have no duration and only TimedBytes are timed.
+type DecompressionStats struct {
+	Files             int64         `json:"files"`
+	CompressedBytes   int64         `json:"compressed_bytes"`
+	DecompressedBytes int64         `json:"decompressed_bytes"`
+	TimedBytes        int64         `json:"timed_decompressed_bytes"`
+	Duration          time.Duration `json:"duration_ns"`
+}
+
+// Throughput returns the decompressed megabytes per second of the timed files
+func (stats DecompressionStats) Throughput() float64 {
+	if stats.Duration <= 0 {
+		return 0
+	}
+	return float64(stats.TimedBytes) / (1 << 20) / stats.Duration.Seconds()
+}
+
+// DecompressionStatsSnapshot is the copy of the statistics published as the walg_decompression expvar
+type DecompressionStatsSnapshot struct {
+	Formats   map[string]DecompressionStats `json:"formats"`
+	Active    int                           `json:"active"`
+	MaxActive int                           `json:"max_active"`
+}
+
+func GetDecompressionStats() DecompressionStatsSnapshot {
+	decompressionStatsMutex.Lock()
+	defer decompressionStatsMutex.Unlock()
+	formats := make(map[string]DecompressionStats, len(decompressionStats))
+	for format, stats := range decompressionStats {
+		formats[format] = *stats
+	}
+	return DecompressionStatsSnapshot{Formats: formats, Active: activeDecompressions, MaxActive: maxActiveDecompressions}
+}
+
+// ReadAheadDecompressor is implemented by the decompressors which read and decode their source in their own
+// goroutines ahead of the consumer, so the time the consumer waits for them isn't the decoding time
+type ReadAheadDecompressor interface {
+	Decompressor
+	ReadsAhead()
+}
+
+// Decompress decompresses src with the decompressor, measuring the file if the statistics are enabled.
+// The name identifies the file in the log, it may be empty when the stream has no file name.
+// The file is measured until its end, its first error or Close, whichever comes first.
+func Decompress(decompressor Decompressor, src io.Reader, name string) (io.ReadCloser, error) {
+	if !isStatsEnabled() {
+		return decompressor.Decompress(src)
+	}
+	source := &timedReader{reader: src}
+	start := time.Now()
+	readCloser, err := decompressor.Decompress(source)
+	if err != nil {
+		return nil, err
+	}
+	startDecompression()
+	return &measuredReader{
+		ReadCloser: readCloser,
+		source:     source,
+		format:     decompressor.FileExtension(),
+		name:       name,
+		duration:   time.Since(start),
+		timed:      !readsAhead(decompressor),
+	}, nil
+}
+
+func startDecompression() {
+	decompressionStatsMutex.Lock()
+	defer decompressionStatsMutex.Unlock()
+	activeDecompressions++
+	if activeDecompressions > maxActiveDecompressions {
+		maxActiveDecompressions = activeDecompressions
+	}
+}
+
+func finishDecompression(format string, measured DecompressionStats) {
+	decompressionStatsMutex.Lock()
+	defer decompressionStatsMutex.Unlock()
+	activeDecompressions--
+	stats, ok := decompressionStats[format]
+	if !ok {
+		stats = &DecompressionStats{}
+		decompressionStats[format] = stats
+	}
+	stats.Files++
+	stats.CompressedBytes += measured.CompressedBytes
+	stats.DecompressedBytes += measured.DecompressedBytes
+	stats.TimedBytes += measured.TimedBytes
+	stats.Duration += measured.Duration
+}
+
+func readsAhead(decompressor Decompressor) bool {
+	_, ok := decompressor.(ReadAheadDecompressor)
+	return ok
+}
+
+// timedReader counts the compressed bytes and the time the decompressor waits for them,
+// atomically since the ReadAheadDecompressor reads them in its own goroutines
+type timedReader struct {
+	reader   io.Reader
+	read     int64
+	duration int64
+}
+
+func (reader *timedReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := reader.reader.Read(p)
+	atomic.AddInt64(&reader.duration, int64(time.Since(start)))
+	atomic.AddInt64(&reader.read, int64(n))
+	return n, err
+}
+
+func (reader *timedReader) HoldsWindow() bool {
+	return computils.HoldsWindow(reader.reader)
+}
+
+type measuredReader struct {
+	io.ReadCloser
+	source       *timedReader
+	format       string
+	name         string
+	decompressed int64
+	duration     time.Duration
+	// timed is false for the ReadAheadDecompressor, the source reads of the others are nested
+	// in the decompressor calls, so the decoding time is the difference
+	timed      bool
+	finishOnce sync.Once
+}
+
+func (reader *measuredReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := reader.ReadCloser.Read(p)
+	reader.duration += time.Since(start)
+	reader.decompressed += int64(n)
+	if err != nil {
+		reader.finish()
+	}
+	return n, err
+}
+
+func (reader *measuredReader) HoldsWindow() bool {
+	return computils.HoldsWindow(reader.ReadCloser)
+}
+
+func (reader *measuredReader) Close() error {
+	reader.finish()
+	return reader.ReadCloser.Close()
+}
+
+// finish adds the file to the statistics once, the readers which are read to the end aren't always closed
+func (reader *measuredReader) finish() {
+	reader.finishOnce.Do(func() {
+		measured := DecompressionStats{
+			CompressedBytes:   atomic.LoadInt64(&reader.source.read),
+			DecompressedBytes: reader.decompressed,
+		}
+		name := reader.name
+		if name == "" {
+			name = "the stream"
+		}
+		if !reader.timed {
+			finishDecompression(reader.format, measured)
+			tracelog.DebugLogger.Printf("Decompressed %s (%s): %d -> %d bytes, not timed since it's read ahead",
+				name, reader.format, measured.CompressedBytes, measured.DecompressedBytes)
+			return
+		}
+		measured.TimedBytes = measured.DecompressedBytes
+		measured.Duration = reader.duration - time.Duration(atomic.LoadInt64(&reader.source.duration))
+		finishDecompression(reader.format, measured)
+		tracelog.DebugLogger.Printf("Decompressed %s (%s): %d -> %d bytes in %v, %.1f MB/s", name, reader.format,
+			measured.CompressedBytes, measured.DecompressedBytes, measured.Duration, measured.Throughput())
+	})
+}
@@ -0,0 +1,149 @@
+package compression
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal/compression/computils"
+	"github.com/wal-g/wal-g/internal/compression/gzip"
+	"github.com/wal-g/wal-g/internal/compression/lz4"
+)
+
+func compressForStats(t *testing.T, compressor Compressor, data []byte) []byte {
+	var compressed bytes.Buffer
+	writer := compressor.NewWriter(&compressed)
+	_, err := writer.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	return compressed.Bytes()
+}
+
+func TestDecompress_StatsDisabled(t *testing.T) {
+	compressed := compressForStats(t, gzip.Compressor{}, []byte("data"))
+	reader, err := Decompress(gzip.Decompressor{}, bytes.NewReader(compressed), "file.gz")
+	assert.NoError(t, err)
+	_, measured := reader.(*measuredReader)
+	assert.False(t, measured)
+	assert.NoError(t, reader.Close())
+}
+
+func TestDecompress_StatsByFormat(t *testing.T) {
+	SetStatsEnabled(true)
+	defer SetStatsEnabled(false)
+	before := GetDecompressionStats()
+
+	data := bytes.Repeat([]byte("decompression statistics "), 4096)
+	for _, pair := range []struct {
+		compressor   Compressor
+		decompressor Decompressor
+	}{
+		{gzip.Compressor{}, gzip.Decompressor{}},
+		{lz4.Compressor{}, lz4.Decompressor{}},
+	} {
+		compressed := compressForStats(t, pair.compressor, data)
+		reader, err := Decompress(pair.decompressor, bytes.NewReader(compressed), "file")
+		assert.NoError(t, err)
+		assert.Equal(t, before.Active+1, GetDecompressionStats().Active)
+		decompressed, err := ioutil.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, data, decompressed)
+		// the file read to the end is measured even if it isn't closed
+		assert.Equal(t, before.Active, GetDecompressionStats().Active)
+		assert.NoError(t, reader.Close())
+
+		format := pair.decompressor.FileExtension()
+		stats := GetDecompressionStats().Formats[format]
+		previous := before.Formats[format]
+		assert.Equal(t, previous.Files+1, stats.Files)
+		assert.Equal(t, previous.CompressedBytes+int64(len(compressed)), stats.CompressedBytes)
+		assert.Equal(t, previous.DecompressedBytes+int64(len(data)), stats.DecompressedBytes)
+		assert.Equal(t, previous.TimedBytes+int64(len(data)), stats.TimedBytes)
+	}
+	assert.Equal(t, before.Active, GetDecompressionStats().Active)
+}
+
+// readAheadDecompressor copies its source in the background like the decoders reading ahead
+type readAheadDecompressor struct{}
+
+func (decompressor readAheadDecompressor) Decompress(src io.Reader) (io.ReadCloser, error) {
+	reader, writer := io.Pipe()
+	go func() {
+		_, err := io.Copy(writer, src)
+		_ = writer.CloseWithError(err)
+	}()
+	return reader, nil
+}
+
+func (decompressor readAheadDecompressor) FileExtension() string { return "readahead" }
+func (decompressor readAheadDecompressor) ReadsAhead()           {}
+
+func TestDecompress_StatsReadAhead(t *testing.T) {
+	SetStatsEnabled(true)
+	defer SetStatsEnabled(false)
+	before := GetDecompressionStats().Formats["readahead"]
+
+	reader, err := Decompress(readAheadDecompressor{}, bytes.NewReader([]byte("data")), "file")
+	assert.NoError(t, err)
+	decompressed, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "data", string(decompressed))
+	assert.NoError(t, reader.Close())
+
+	stats := GetDecompressionStats().Formats["readahead"]
+	assert.Equal(t, before.Files+1, stats.Files)
+	assert.Equal(t, before.DecompressedBytes+4, stats.DecompressedBytes)
+	assert.Equal(t, before.TimedBytes, stats.TimedBytes, "the decoding overlapping the reading isn't timed")
+	assert.Equal(t, before.Duration, stats.Duration)
+}
+
+type windowHoldingReader struct {
+	io.ReadCloser
+}
+
+func (reader windowHoldingReader) HoldsWindow() bool {
+	return true
+}
+
+type windowHoldingDecompressor struct{}
+
+func (decompressor windowHoldingDecompressor) Decompress(src io.Reader) (io.ReadCloser, error) {
+	return windowHoldingReader{ioutil.NopCloser(src)}, nil
+}
+
+func (decompressor windowHoldingDecompressor) FileExtension() string {
+	return "window"
+}
+
+func TestDecompress_StatsForwardHoldsWindow(t *testing.T) {
+	SetStatsEnabled(true)
+	defer SetStatsEnabled(false)
+
+	outer, err := Decompress(windowHoldingDecompressor{}, bytes.NewReader([]byte("data")), "outer")
+	assert.NoError(t, err)
+	assert.True(t, computils.HoldsWindow(outer))
+
+	var nestedSource io.Reader
+	_, err = Decompress(sourceCapturingDecompressor{&nestedSource}, outer, "inner")
+	assert.NoError(t, err)
+	assert.True(t, computils.HoldsWindow(nestedSource), "the nested decompressor sees the window of its source")
+
+	plain, err := Decompress(gzip.Decompressor{}, bytes.NewReader(compressForStats(t, gzip.Compressor{}, []byte("data"))), "")
+	assert.NoError(t, err)
+	assert.False(t, computils.HoldsWindow(plain))
+}
+
+type sourceCapturingDecompressor struct {
+	source *io.Reader
+}
+
+func (decompressor sourceCapturingDecompressor) Decompress(src io.Reader) (io.ReadCloser, error) {
+	*decompressor.source = src
+	return ioutil.NopCloser(src), nil
+}
+
+func (decompressor sourceCapturingDecompressor) FileExtension() string {
+	return "capture"
+}
@@ -0,0 +1,63 @@
+package xz
+
+import (
+	"io"
+	"io/ioutil"
+
+	"github.com/ulikunitz/xz"
+	"github.com/wal-g/wal-g/internal/compression/computils"
+)
+
+const (
+	AlgorithmName = "xz"
+	FileExtension = "xz"
+)
+
+type Decompressor struct{}
+
+// Decompress reads all the concatenated xz streams one after another.
+// Block checksums and stream indexes are verified while reading,
+// so a damaged or truncated stream fails with computils.DecompressionError.
+func (decompressor Decompressor) Decompress(src io.Reader) (io.ReadCloser, error) {
+	source := &sourceReader{underlying: src}
+	xzReader, err := xz.NewReader(source)
+	if err != nil {
+		if source.isDecodeError(err) {
+			return nil, computils.NewDecompressionError(err, AlgorithmName)
+		}
+		return nil, err
+	}
+	return ioutil.NopCloser(computils.NewDecompressionErrorReader(xzReader, AlgorithmName, source.isDecodeError)), nil
+}
+
+// DecompressTo decompresses the whole stream into dst, see compression.DecompressorV2
+func (decompressor Decompressor) DecompressTo(dst io.Writer, src io.Reader) (int64, error) {
+	decompressed, err := decompressor.Decompress(src)
+	if err != nil {
+		return 0, err
+	}
+	return computils.CopyDecompressed(dst, decompressed)
+}
+
+func (decompressor Decompressor) FileExtension() string {
+	return FileExtension
+}
+
+// sourceReader remembers the error of the compressed source:
+// the xz decoder errors are not exported, so everything except the source failure is a decode error
+type sourceReader struct {
+	underlying io.Reader
+	err        error
+}
+
+func (source *sourceReader) Read(p []byte) (n int, err error) {
+	n, err = source.underlying.Read(p)
+	if err != nil && err != io.EOF {
+		source.err = err
+	}
+	return
+}
+
+func (source *sourceReader) isDecodeError(err error) bool {
+	return source.err == nil || err != source.err
+}
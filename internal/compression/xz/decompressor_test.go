@@ -0,0 +1,77 @@
+package xz_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal/compression/computils"
+	"github.com/wal-g/wal-g/internal/compression/xz"
+)
+
+// sampleFilePath contains two concatenated xz streams made by the xz utility
+const sampleFilePath = "testdata/sample.xz"
+
+func sampleContent() []byte {
+	var content bytes.Buffer
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&content, "WAL segment line %05d: the quick brown fox jumps over the lazy dog\n", i)
+	}
+	return content.Bytes()
+}
+
+func TestDecompress_concatenatedStreams(t *testing.T) {
+	compressed, err := ioutil.ReadFile(sampleFilePath)
+	assert.NoError(t, err)
+
+	reader, err := xz.Decompressor{}.Decompress(bytes.NewReader(compressed))
+	assert.NoError(t, err)
+	decompressed, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, sampleContent(), decompressed)
+}
+
+func TestDecompress_corruptChecksum(t *testing.T) {
+	compressed, err := ioutil.ReadFile(sampleFilePath)
+	assert.NoError(t, err)
+	// the last stream ends with the block check, the index and the 12 bytes footer
+	compressed[len(compressed)-12-8-1] ^= 0xff
+
+	reader, err := xz.Decompressor{}.Decompress(bytes.NewReader(compressed))
+	assert.NoError(t, err)
+	_, err = io.Copy(ioutil.Discard, reader)
+	assert.IsType(t, computils.DecompressionError{}, err)
+}
+
+func TestDecompress_truncatedStream(t *testing.T) {
+	compressed, err := ioutil.ReadFile(sampleFilePath)
+	assert.NoError(t, err)
+
+	reader, err := xz.Decompressor{}.Decompress(bytes.NewReader(compressed[:len(compressed)-8]))
+	assert.NoError(t, err)
+	_, err = io.Copy(ioutil.Discard, reader)
+	assert.IsType(t, computils.DecompressionError{}, err)
+}
+
+func TestDecompress_sourceError(t *testing.T) {
+	compressed, err := ioutil.ReadFile(sampleFilePath)
+	assert.NoError(t, err)
+	sourceErr := fmt.Errorf("connection reset")
+	source := io.MultiReader(bytes.NewReader(compressed[:len(compressed)/2]), &failingReader{sourceErr})
+
+	reader, err := xz.Decompressor{}.Decompress(source)
+	assert.NoError(t, err)
+	_, err = io.Copy(ioutil.Discard, reader)
+	assert.Equal(t, sourceErr, err)
+}
+
+type failingReader struct {
+	err error
+}
+
+func (reader *failingReader) Read(p []byte) (int, error) {
+	return 0, reader.err
+}
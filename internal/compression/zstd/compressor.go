@@ -13,7 +13,11 @@ const (
 
 type Compressor struct{}
 
+// NewWriter compresses with the dictionary if it is set by SetDictionary
 func (compressor Compressor) NewWriter(writer io.Writer) io.WriteCloser {
+	if dict := getDictionary(); dict != nil {
+		return zstd.NewWriterLevelDict(writer, 3, dict.content)
+	}
 	return zstd.NewWriterLevel(writer, 3)
 }
 
@@ -1,16 +1,60 @@
 package zstd
 
 import (
+	"bufio"
 	"io"
 
-	"github.com/DataDog/zstd"
 	"github.com/wal-g/wal-g/internal/compression/computils"
 )
 
 type Decompressor struct{}
 
+// Decompress uses the configured dictionary for the frames which reference it, the frames compressed
+// without dictionary are readable regardless of the configuration, also when concatenated with the others.
+// The window of the first frame is limited by the maximum window log and is accounted
+// against the window budget shared by all the decompressors until the stream ends or is closed.
+// Only the outermost stream waits for the budget, the streams decoded from it are nested in its window.
 func (decompressor Decompressor) Decompress(src io.Reader) (io.ReadCloser, error) {
-	return zstd.NewReader(computils.NewUntilEOFReader(src)), nil
+	bufferedSrc := bufio.NewReader(src)
+	header, err := bufferedSrc.Peek(maxFrameHeaderSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	source := computils.NewUntilEOFReader(bufferedSrc)
+
+	limits := getWindowLimits()
+	windowSize, isFrame := frameWindowSize(header)
+	if windowSize > int64(1)<<limits.maxWindowLog {
+		return nil, computils.NewWindowTooLargeError(AlgorithmName, windowLog(windowSize), limits.maxWindowLog)
+	}
+
+	// the first frame is checked before the download goes on, the following ones by the reader
+	dict := getDictionary()
+	if frameDictionaryID := frameDictionaryID(header); frameDictionaryID != 0 && (dict == nil || dict.ID != frameDictionaryID) {
+		return nil, newDictionaryMismatchError(frameDictionaryID, dict)
+	}
+
+	nested := computils.HoldsWindow(src)
+	reader, err := newFrameReader(source, limits.maxWindowLog, dict)
+	if err != nil {
+		return nil, err
+	}
+	if !isFrame {
+		return reader, nil
+	}
+	if nested {
+		return &budgetReader{reader, func() {}}, nil
+	}
+	return &budgetReader{reader, limits.acquire(windowSize)}, nil
+}
+
+// DecompressTo decompresses the whole stream into dst, see compression.DecompressorV2
+func (decompressor Decompressor) DecompressTo(dst io.Writer, src io.Reader) (int64, error) {
+	decompressed, err := decompressor.Decompress(src)
+	if err != nil {
+		return 0, err
+	}
+	return computils.CopyDecompressed(dst, decompressed)
 }
 
 func (decompressor Decompressor) FileExtension() string {
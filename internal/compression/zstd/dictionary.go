@@ -0,0 +1,100 @@
+package zstd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+)
+
+const (
+	dictionaryMagic = 0xEC30A437
+	frameMagic      = 0xFD2FB528
+
+	// magic, frame header descriptor, window descriptor and the longest dictionary ID and content size fields
+	maxFrameHeaderSize = 4 + 1 + 1 + 4 + 8
+)
+
+// Dictionary is the zstd dictionary in the format produced by `zstd --train`,
+// the frames compressed with it reference its ID
+type Dictionary struct {
+	ID      uint32
+	content []byte
+}
+
+// NewDictionary checks that the content is the formatted zstd dictionary with non-zero ID,
+// the raw content dictionaries are not accepted since the frames can't reference them
+func NewDictionary(content []byte) (*Dictionary, error) {
+	if len(content) < 8 || binary.LittleEndian.Uint32(content) != dictionaryMagic {
+		return nil, errors.New("zstd dictionary must start with the dictionary magic number")
+	}
+	id := binary.LittleEndian.Uint32(content[4:])
+	if id == 0 {
+		return nil, errors.New("zstd dictionary must have non-zero ID")
+	}
+	return &Dictionary{ID: id, content: content}, nil
+}
+
+var (
+	dictionaryMutex sync.RWMutex
+	dictionary      *Dictionary
+)
+
+// SetDictionary makes the compressor use the dictionary for the new frames
+// and the decompressor use it for the frames referencing it, nil disables the dictionary
+func SetDictionary(dict *Dictionary) {
+	dictionaryMutex.Lock()
+	defer dictionaryMutex.Unlock()
+	dictionary = dict
+}
+
+func getDictionary() *Dictionary {
+	dictionaryMutex.RLock()
+	defer dictionaryMutex.RUnlock()
+	return dictionary
+}
+
+// DictionaryMismatchError is used to signal that the frame was compressed with the dictionary
+// which is not configured
+type DictionaryMismatchError struct {
+	error
+}
+
+func newDictionaryMismatchError(frameDictionaryID uint32, dict *Dictionary) DictionaryMismatchError {
+	if dict == nil {
+		return DictionaryMismatchError{errors.Errorf(
+			"zstd frame requires the dictionary with ID %d, but no dictionary is configured", frameDictionaryID)}
+	}
+	return DictionaryMismatchError{errors.Errorf(
+		"zstd frame requires the dictionary with ID %d, but the configured dictionary has ID %d",
+		frameDictionaryID, dict.ID)}
+}
+
+func (err DictionaryMismatchError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// frameDictionaryID returns the dictionary ID from the zstd frame header, zero means no dictionary.
+// The data which is not the zstd frame, e.g. the skippable frame, is reported as not using the dictionary.
+func frameDictionaryID(header []byte) uint32 {
+	if len(header) < 5 || binary.LittleEndian.Uint32(header) != frameMagic {
+		return 0
+	}
+	descriptor := header[4]
+	fieldStart := 5
+	// the window descriptor is absent in the single segment frames
+	if descriptor&0x20 == 0 {
+		fieldStart++
+	}
+	fieldSize := [4]int{0, 1, 2, 4}[descriptor&3]
+	if fieldSize == 0 || len(header) < fieldStart+fieldSize {
+		return 0
+	}
+	var id uint32
+	for i := fieldSize - 1; i >= 0; i-- {
+		id = id<<8 | uint32(header[fieldStart+i])
+	}
+	return id
+}
@@ -0,0 +1,167 @@
+package zstd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// walLikeSamples are the similar records with varying numbers, like the WAL segments of one cluster
+func walLikeSamples(count int) [][]byte {
+	random := rand.New(rand.NewSource(1))
+	samples := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		var sample bytes.Buffer
+		for j := 0; j < 32; j++ {
+			fmt.Fprintf(&sample, "rmgr: Heap len (rec/tot): %d/%d, tx: %d, lsn: 0/%08X, desc: INSERT off %d flags 0x00\n",
+				random.Intn(100), random.Intn(200), random.Intn(1<<20), random.Uint32(), random.Intn(300))
+		}
+		samples = append(samples, sample.Bytes())
+	}
+	return samples
+}
+
+func trainTestDictionary(t *testing.T) *Dictionary {
+	content, err := TrainDictionary(walLikeSamples(500), 16*1024)
+	assert.NoError(t, err)
+	dict, err := NewDictionary(content)
+	assert.NoError(t, err)
+	return dict
+}
+
+func compress(t *testing.T, data []byte) []byte {
+	var compressed bytes.Buffer
+	writer := Compressor{}.NewWriter(&compressed)
+	_, err := writer.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	return compressed.Bytes()
+}
+
+func decompress(compressed []byte) ([]byte, error) {
+	reader, err := Decompressor{}.Decompress(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+func TestDictionaryRoundTrip(t *testing.T) {
+	dict := trainTestDictionary(t)
+	SetDictionary(dict)
+	defer SetDictionary(nil)
+
+	data := walLikeSamples(1)[0]
+	compressed := compress(t, data)
+	assert.Equal(t, dict.ID, frameDictionaryID(compressed))
+
+	decompressed, err := decompress(compressed)
+	assert.NoError(t, err)
+	assert.Equal(t, data, decompressed)
+}
+
+func TestDictionaryImprovesRatio(t *testing.T) {
+	data := walLikeSamples(1)[0]
+	withoutDictionary := compress(t, data)
+
+	SetDictionary(trainTestDictionary(t))
+	defer SetDictionary(nil)
+	withDictionary := compress(t, data)
+
+	assert.Less(t, len(withDictionary), len(withoutDictionary))
+}
+
+func TestDecompress_dictionaryIsNotConfigured(t *testing.T) {
+	dict := trainTestDictionary(t)
+	SetDictionary(dict)
+	compressed := compress(t, []byte("compressed with dictionary"))
+	SetDictionary(nil)
+
+	_, err := decompress(compressed)
+	assert.IsType(t, DictionaryMismatchError{}, err)
+	assert.Contains(t, err.Error(), fmt.Sprint(dict.ID))
+}
+
+func TestDecompress_otherDictionaryIsConfigured(t *testing.T) {
+	dict := trainTestDictionary(t)
+	SetDictionary(dict)
+	defer SetDictionary(nil)
+	compressed := compress(t, []byte("compressed with dictionary"))
+
+	other := append([]byte(nil), dict.content...)
+	binary.LittleEndian.PutUint32(other[4:], dict.ID+1)
+	otherDict, err := NewDictionary(other)
+	assert.NoError(t, err)
+	SetDictionary(otherDict)
+
+	_, err = decompress(compressed)
+	assert.IsType(t, DictionaryMismatchError{}, err)
+}
+
+// the backups made before the dictionary was configured must stay readable
+func TestDecompress_noDictionaryFrameWithDictionaryConfigured(t *testing.T) {
+	data := []byte("compressed without dictionary")
+	compressed := compress(t, data)
+	assert.Equal(t, uint32(0), frameDictionaryID(compressed))
+
+	SetDictionary(trainTestDictionary(t))
+	defer SetDictionary(nil)
+	decompressed, err := decompress(compressed)
+	assert.NoError(t, err)
+	assert.Equal(t, data, decompressed)
+}
+
+func TestNewDictionary_rawContent(t *testing.T) {
+	_, err := NewDictionary([]byte("raw content dictionary"))
+	assert.Error(t, err)
+}
+
+func TestDecompress_empty(t *testing.T) {
+	decompressed, err := decompress(compress(t, nil))
+	assert.NoError(t, err)
+	assert.Empty(t, decompressed)
+}
+
+// the files appended after the dictionary is configured are the frames with and without dictionary in one stream
+func TestDecompress_concatenatedFrames(t *testing.T) {
+	samples := walLikeSamples(3)
+	withoutDictionary := compress(t, samples[0])
+	dict := trainTestDictionary(t)
+	SetDictionary(dict)
+	defer SetDictionary(nil)
+	withDictionary := compress(t, samples[1])
+
+	var stream []byte
+	stream = append(stream, withoutDictionary...)
+	stream = append(stream, withDictionary...)
+	stream = append(stream, withoutDictionary...)
+	stream = append(stream, withDictionary...)
+	decompressed, err := decompress(stream)
+	assert.NoError(t, err)
+	assert.Equal(t, bytes.Join([][]byte{samples[0], samples[1], samples[0], samples[1]}, nil), decompressed)
+
+	decompressed, err = decompress(append(append([]byte(nil), withDictionary...), withoutDictionary...))
+	assert.NoError(t, err)
+	assert.Equal(t, append(append([]byte(nil), samples[1]...), samples[0]...), decompressed)
+}
+
+func TestDecompress_concatenatedFrameRequiresDictionary(t *testing.T) {
+	withoutDictionary := compress(t, []byte("compressed without dictionary"))
+	dict := trainTestDictionary(t)
+	SetDictionary(dict)
+	withDictionary := compress(t, []byte("compressed with dictionary"))
+	SetDictionary(nil)
+
+	reader, err := Decompressor{}.Decompress(bytes.NewReader(append(withoutDictionary, withDictionary...)))
+	assert.NoError(t, err)
+	defer reader.Close()
+	_, err = ioutil.ReadAll(reader)
+	assert.IsType(t, DictionaryMismatchError{}, err)
+	assert.Contains(t, err.Error(), fmt.Sprint(dict.ID))
+}
@@ -0,0 +1,181 @@
+package zstd
+
+/*
+#include <stddef.h>
+
+// the streaming decoder functions are compiled into the github.com/DataDog/zstd package,
+// whose reader doesn't allow to raise the window limit
+typedef struct ZSTD_DCtx_s ZSTD_DCtx;
+typedef struct { const void* src; size_t size; size_t pos; } ZSTD_inBuffer;
+typedef struct { void* dst; size_t size; size_t pos; } ZSTD_outBuffer;
+
+ZSTD_DCtx* ZSTD_createDCtx(void);
+size_t ZSTD_freeDCtx(ZSTD_DCtx* dctx);
+size_t ZSTD_DCtx_setParameter(ZSTD_DCtx* dctx, int param, int value);
+size_t ZSTD_DCtx_loadDictionary(ZSTD_DCtx* dctx, const void* dict, size_t dictSize);
+size_t ZSTD_decompressStream(ZSTD_DCtx* dctx, ZSTD_outBuffer* output, ZSTD_inBuffer* input);
+size_t ZSTD_DStreamInSize(void);
+unsigned ZSTD_isError(size_t code);
+const char* ZSTD_getErrorName(size_t code);
+
+// ZSTD_d_windowLogMax
+enum { windowLogMaxParameter = 100 };
+
+// the buffers are passed by the positions, since Go memory passed to C can't hold Go pointers
+static size_t decompressStream(ZSTD_DCtx* dctx, void* dst, size_t dstSize, size_t* dstPos,
+		const void* src, size_t srcSize, size_t* srcPos) {
+	ZSTD_outBuffer output = {dst, dstSize, *dstPos};
+	ZSTD_inBuffer input = {src, srcSize, *srcPos};
+	size_t result = ZSTD_decompressStream(dctx, &output, &input);
+	*dstPos = output.pos;
+	*srcPos = input.pos;
+	return result;
+}
+*/
+import "C"
+
+import (
+	"io"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/wal-g/internal/compression/computils"
+)
+
+// frameReader decodes the frames with windows up to 2^maxWindowLog bytes, e.g. produced by `zstd --long=30`.
+// The dictionary is chosen for every frame of the concatenated stream by the ID in its header:
+// the frames appended by the compressor with and without the dictionary are decoded alike.
+type frameReader struct {
+	src        io.Reader
+	ctx        *C.ZSTD_DCtx
+	dictionary *Dictionary
+	// loadedID is the ID of the dictionary loaded into ctx, zero if none is
+	loadedID uint32
+	in       []byte
+	inPos    int
+	inSize   int
+	srcEOF   bool
+	// frameEnded is true between the frames, the source may end only there
+	frameEnded    bool
+	outputPending bool
+	err           error
+}
+
+func newFrameReader(src io.Reader, maxWindowLog int, dictionary *Dictionary) (*frameReader, error) {
+	ctx := C.ZSTD_createDCtx()
+	if ctx == nil {
+		return nil, errors.New("failed to create zstd decompression context")
+	}
+	reader := &frameReader{src: src, ctx: ctx, dictionary: dictionary,
+		in: make([]byte, int(C.ZSTD_DStreamInSize())), frameEnded: true}
+	if err := reader.check(C.ZSTD_DCtx_setParameter(ctx, C.windowLogMaxParameter, C.int(maxWindowLog))); err != nil {
+		_ = reader.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+func (reader *frameReader) Read(p []byte) (int, error) {
+	if reader.err != nil {
+		return 0, reader.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for {
+		if reader.inPos == reader.inSize && !reader.srcEOF && !reader.outputPending {
+			if reader.err = reader.fill(); reader.err != nil {
+				return 0, reader.err
+			}
+		}
+		if reader.inPos == reader.inSize && reader.srcEOF && !reader.outputPending {
+			reader.err = io.EOF
+			if !reader.frameEnded {
+				reader.err = computils.NewDecompressionError(io.ErrUnexpectedEOF, AlgorithmName)
+			}
+			return 0, reader.err
+		}
+		if reader.frameEnded && !reader.outputPending {
+			if reader.err = reader.startFrame(); reader.err != nil {
+				return 0, reader.err
+			}
+		}
+
+		var outPos, inPos C.size_t = 0, C.size_t(reader.inPos)
+		var in unsafe.Pointer
+		if reader.inSize > 0 {
+			in = unsafe.Pointer(&reader.in[0])
+		}
+		result := C.decompressStream(reader.ctx, unsafe.Pointer(&p[0]), C.size_t(len(p)), &outPos,
+			in, C.size_t(reader.inSize), &inPos)
+		reader.inPos = int(inPos)
+		if err := reader.check(result); err != nil {
+			reader.err = err
+			return int(outPos), err
+		}
+		reader.frameEnded = result == 0
+		// the decoder may hold more data than the output could take, unless the frame is flushed completely
+		reader.outputPending = !reader.frameEnded && int(outPos) == len(p)
+		if outPos > 0 {
+			return int(outPos), nil
+		}
+	}
+}
+
+// fill moves the unread input to the start of the buffer and reads the source after it
+func (reader *frameReader) fill() error {
+	reader.inSize = copy(reader.in, reader.in[reader.inPos:reader.inSize])
+	reader.inPos = 0
+	n, err := reader.src.Read(reader.in[reader.inSize:])
+	reader.inSize += n
+	if err == io.EOF {
+		reader.srcEOF = true
+		return nil
+	}
+	return err
+}
+
+// startFrame loads the dictionary the next frame references, or unloads it for the frame without dictionary.
+// The decoder accepts the dictionary only between the frames.
+func (reader *frameReader) startFrame() error {
+	for reader.inSize-reader.inPos < maxFrameHeaderSize && !reader.srcEOF {
+		if err := reader.fill(); err != nil {
+			return err
+		}
+	}
+	frameDictionaryID := frameDictionaryID(reader.in[reader.inPos:reader.inSize])
+	if frameDictionaryID == reader.loadedID {
+		return nil
+	}
+	if frameDictionaryID == 0 {
+		reader.loadedID = 0
+		return reader.check(C.ZSTD_DCtx_loadDictionary(reader.ctx, nil, 0))
+	}
+	if reader.dictionary == nil || reader.dictionary.ID != frameDictionaryID {
+		return newDictionaryMismatchError(frameDictionaryID, reader.dictionary)
+	}
+	content := reader.dictionary.content
+	if err := reader.check(C.ZSTD_DCtx_loadDictionary(reader.ctx, unsafe.Pointer(&content[0]), C.size_t(len(content)))); err != nil {
+		return err
+	}
+	reader.loadedID = frameDictionaryID
+	return nil
+}
+
+func (reader *frameReader) check(result C.size_t) error {
+	if C.ZSTD_isError(result) == 0 {
+		return nil
+	}
+	return computils.NewDecompressionError(errors.New(C.GoString(C.ZSTD_getErrorName(result))), AlgorithmName)
+}
+
+func (reader *frameReader) Close() error {
+	if reader.ctx != nil {
+		C.ZSTD_freeDCtx(reader.ctx)
+		reader.ctx = nil
+	}
+	if reader.err == nil {
+		reader.err = errors.New("zstd reader is closed")
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package zstd
+
+/*
+#include <stddef.h>
+
+// ZDICT functions are compiled into the github.com/DataDog/zstd package, which has no Go wrappers for them
+size_t ZDICT_trainFromBuffer(void* dictBuffer, size_t dictBufferCapacity,
+	const void* samplesBuffer, const size_t* samplesSizes, unsigned nbSamples);
+unsigned ZDICT_isError(size_t code);
+const char* ZDICT_getErrorName(size_t code);
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+// TrainDictionary builds the dictionary of at most maxSize bytes from the samples,
+// zstd needs a few hundred samples of the typical data to build a good one
+func TrainDictionary(samples [][]byte, maxSize int) ([]byte, error) {
+	var samplesBuffer []byte
+	samplesSizes := make([]C.size_t, 0, len(samples))
+	for _, sample := range samples {
+		if len(sample) == 0 {
+			continue
+		}
+		samplesBuffer = append(samplesBuffer, sample...)
+		samplesSizes = append(samplesSizes, C.size_t(len(sample)))
+	}
+	if len(samplesSizes) == 0 || maxSize <= 0 {
+		return nil, errors.New("zstd dictionary training requires non-empty samples and dictionary size")
+	}
+
+	dict := make([]byte, maxSize)
+	size := C.ZDICT_trainFromBuffer(unsafe.Pointer(&dict[0]), C.size_t(maxSize),
+		unsafe.Pointer(&samplesBuffer[0]), &samplesSizes[0], C.unsigned(len(samplesSizes)))
+	if C.ZDICT_isError(size) != 0 {
+		return nil, errors.Errorf("zstd dictionary training failed: %s", C.GoString(C.ZDICT_getErrorName(size)))
+	}
+	return dict[:size], nil
+}
@@ -0,0 +1,133 @@
+package zstd
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"math/bits"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"golang.org/x/sync/semaphore"
+)
+
+const (
+	// DefaultMaxWindowLog is the largest window the zstd decoder accepts by default
+	DefaultMaxWindowLog = 27
+	// MaxWindowLog is the largest window zstd supports on 64-bit platforms, e.g. `zstd --long=31`
+	MaxWindowLog = 31
+	minWindowLog = 10
+
+	// DefaultWindowBudget is the total size of the decoding windows of the concurrently read streams
+	DefaultWindowBudget = 1 << 30
+)
+
+// windowLimits bound the window of a single frame and the total size of the windows in use,
+// the streams which don't fit into the budget wait for the others to finish
+type windowLimits struct {
+	maxWindowLog int
+	budget       int64
+	semaphore    *semaphore.Weighted
+}
+
+var (
+	windowLimitsMutex sync.RWMutex
+	limits            = &windowLimits{DefaultMaxWindowLog, DefaultWindowBudget, semaphore.NewWeighted(DefaultWindowBudget)}
+)
+
+// SetWindowLimits configures the largest window log the decompressor accepts and the total size
+// of the windows allocated by the concurrent decompressors, the budget must fit the largest window
+func SetWindowLimits(maxWindowLog int, budget int64) error {
+	if maxWindowLog < minWindowLog || maxWindowLog > MaxWindowLog {
+		return errors.Errorf("zstd window log must be between %d and %d, got %d", minWindowLog, MaxWindowLog, maxWindowLog)
+	}
+	if budget < int64(1)<<maxWindowLog {
+		return errors.Errorf("zstd window budget of %d bytes can't fit the window of 2^%d bytes", budget, maxWindowLog)
+	}
+	windowLimitsMutex.Lock()
+	defer windowLimitsMutex.Unlock()
+	limits = &windowLimits{maxWindowLog, budget, semaphore.NewWeighted(budget)}
+	return nil
+}
+
+func getWindowLimits() *windowLimits {
+	windowLimitsMutex.RLock()
+	defer windowLimitsMutex.RUnlock()
+	return limits
+}
+
+// acquire blocks until the window fits into the budget and returns the function which gives it back
+func (limits *windowLimits) acquire(windowSize int64) func() {
+	if !limits.semaphore.TryAcquire(windowSize) {
+		tracelog.DebugLogger.Printf("Waiting for %d bytes of zstd window budget", windowSize)
+		// the context is never canceled, so Acquire can't fail
+		_ = limits.semaphore.Acquire(context.Background(), windowSize)
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			limits.semaphore.Release(windowSize)
+		})
+	}
+}
+
+// frameWindowSize returns the window size declared by the zstd frame header, false means not a zstd frame
+func frameWindowSize(header []byte) (int64, bool) {
+	if len(header) < 6 || binary.LittleEndian.Uint32(header) != frameMagic {
+		return 0, false
+	}
+	descriptor := header[4]
+	if descriptor&0x20 == 0 {
+		windowDescriptor := header[5]
+		windowBase := int64(1) << (minWindowLog + windowDescriptor>>3)
+		return windowBase + windowBase/8*int64(windowDescriptor&7), true
+	}
+
+	// the window of the single segment frame is its content size, which follows the dictionary ID
+	fieldStart := 5 + [4]int{0, 1, 2, 4}[descriptor&3]
+	fieldSize := [4]int{1, 2, 4, 8}[descriptor>>6]
+	if len(header) < fieldStart+fieldSize {
+		return 0, false
+	}
+	var size uint64
+	for i := fieldSize - 1; i >= 0; i-- {
+		size = size<<8 | uint64(header[fieldStart+i])
+	}
+	if fieldSize == 2 {
+		size += 256
+	}
+	if size > 1<<62 {
+		size = 1 << 62
+	}
+	return int64(size), true
+}
+
+// windowLog is the smallest log of the window which fits windowSize bytes
+func windowLog(windowSize int64) int {
+	return bits.Len64(uint64(windowSize - 1))
+}
+
+// budgetReader gives the window back to the budget when the stream ends, fails or is closed,
+// the nested stream holds no window of its own and its release does nothing
+type budgetReader struct {
+	io.ReadCloser
+	release func()
+}
+
+func (reader *budgetReader) HoldsWindow() bool {
+	return true
+}
+
+func (reader *budgetReader) Read(p []byte) (int, error) {
+	n, err := reader.ReadCloser.Read(p)
+	if err != nil {
+		reader.release()
+	}
+	return n, err
+}
+
+func (reader *budgetReader) Close() error {
+	reader.release()
+	return reader.ReadCloser.Close()
+}
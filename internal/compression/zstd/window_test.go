@@ -0,0 +1,157 @@
+package zstd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/compression/computils"
+)
+
+// longModeFilePath contains longModeSampleContent compressed with the streamed input by `zstd -19 --long=30`,
+// so the frame declares the window of 2^30 bytes
+const longModeFilePath = "testdata/long30.zst"
+
+func longModeSampleContent() []byte {
+	var content bytes.Buffer
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&content, "WAL segment line %05d: the quick brown fox jumps over the lazy dog\n", i)
+	}
+	return bytes.Repeat(content.Bytes(), 2)
+}
+
+// rawFrame builds a frame of one raw block which declares the window of 2^windowLog bytes,
+// the same header `zstd --long` writes for the streamed input
+func rawFrame(windowLog int, content []byte) []byte {
+	frame := make([]byte, 4, 9+len(content))
+	binary.LittleEndian.PutUint32(frame, frameMagic)
+	frame = append(frame, 0, byte(windowLog-minWindowLog)<<3)
+	blockHeader := uint32(len(content))<<3 | 1
+	frame = append(frame, byte(blockHeader), byte(blockHeader>>8), byte(blockHeader>>16))
+	return append(frame, content...)
+}
+
+func TestFrameWindowSize(t *testing.T) {
+	windowSize, isFrame := frameWindowSize(rawFrame(28, []byte("data")))
+	assert.True(t, isFrame)
+	assert.Equal(t, int64(1)<<28, windowSize)
+
+	windowSize, isFrame = frameWindowSize(compress(t, walLikeSamples(1)[0]))
+	assert.True(t, isFrame)
+	assert.LessOrEqual(t, windowSize, int64(1)<<DefaultMaxWindowLog)
+
+	// the window of the single segment frame is its content size, here in the 2-byte field with 256 offset
+	windowSize, isFrame = frameWindowSize([]byte{0x28, 0xb5, 0x2f, 0xfd, 0x60, 0x10, 0x00})
+	assert.True(t, isFrame)
+	assert.Equal(t, int64(256+16), windowSize)
+
+	_, isFrame = frameWindowSize([]byte("not a zstd frame"))
+	assert.False(t, isFrame)
+}
+
+func TestLongWindowFrame(t *testing.T) {
+	data := walLikeSamples(1)[0]
+	frame := rawFrame(28, data)
+
+	_, err := Decompressor{}.Decompress(bytes.NewReader(frame))
+	windowErr, ok := err.(computils.WindowTooLargeError)
+	assert.True(t, ok, "unexpected error %v", err)
+	assert.Equal(t, 28, windowErr.RequiredWindowLog)
+	assert.Equal(t, DefaultMaxWindowLog, windowErr.MaxWindowLog)
+
+	assert.NoError(t, SetWindowLimits(28, DefaultWindowBudget))
+	defer func() { assert.NoError(t, SetWindowLimits(DefaultMaxWindowLog, DefaultWindowBudget)) }()
+	decompressed, err := decompress(append(frame, compress(t, data)...))
+	assert.NoError(t, err)
+	assert.Equal(t, append(data, data...), decompressed)
+
+	_, err = decompress(frame[:len(frame)-1])
+	assert.Error(t, err)
+}
+
+func TestLongModeFile(t *testing.T) {
+	compressed, err := ioutil.ReadFile(longModeFilePath)
+	require.NoError(t, err)
+
+	_, err = decompress(compressed)
+	windowErr, ok := err.(computils.WindowTooLargeError)
+	require.True(t, ok, "unexpected error %v", err)
+	assert.Equal(t, 30, windowErr.RequiredWindowLog)
+
+	require.NoError(t, SetWindowLimits(30, 1<<30))
+	defer func() { assert.NoError(t, SetWindowLimits(DefaultMaxWindowLog, DefaultWindowBudget)) }()
+	decompressed, err := decompress(compressed)
+	require.NoError(t, err)
+	assert.Equal(t, longModeSampleContent(), decompressed)
+}
+
+func TestSetWindowLimits(t *testing.T) {
+	assert.Error(t, SetWindowLimits(MaxWindowLog+1, DefaultWindowBudget))
+	assert.Error(t, SetWindowLimits(minWindowLog-1, DefaultWindowBudget))
+	assert.Error(t, SetWindowLimits(28, 1<<27))
+}
+
+func TestWindowBudget(t *testing.T) {
+	assert.NoError(t, SetWindowLimits(DefaultMaxWindowLog, 1<<DefaultMaxWindowLog))
+	defer func() { assert.NoError(t, SetWindowLimits(DefaultMaxWindowLog, DefaultWindowBudget)) }()
+	frame := rawFrame(DefaultMaxWindowLog, []byte("data"))
+
+	first, err := Decompressor{}.Decompress(bytes.NewReader(frame))
+	assert.NoError(t, err)
+
+	opened := make(chan []byte)
+	go func() {
+		second, err := Decompressor{}.Decompress(bytes.NewReader(frame))
+		assert.NoError(t, err)
+		content, err := ioutil.ReadAll(second)
+		assert.NoError(t, err)
+		opened <- content
+	}()
+
+	select {
+	case <-opened:
+		t.Fatal("the second window doesn't fit the budget until the first stream ends")
+	case <-time.After(100 * time.Millisecond):
+	}
+	content, err := ioutil.ReadAll(first)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("data"), content)
+	assert.Equal(t, []byte("data"), <-opened)
+}
+
+func TestWindowBudget_nestedStream(t *testing.T) {
+	assert.NoError(t, SetWindowLimits(DefaultMaxWindowLog, 1<<DefaultMaxWindowLog))
+	defer func() { assert.NoError(t, SetWindowLimits(DefaultMaxWindowLog, DefaultWindowBudget)) }()
+	inner := rawFrame(DefaultMaxWindowLog, []byte("data"))
+	outer := rawFrame(DefaultMaxWindowLog, inner)
+
+	decoded := make(chan []byte)
+	go func() {
+		outerStream, err := Decompressor{}.Decompress(bytes.NewReader(outer))
+		assert.NoError(t, err)
+		// the inner stream doesn't wait for the window held by the stream it is read from
+		innerStream, err := Decompressor{}.Decompress(outerStream)
+		assert.NoError(t, err)
+		content, err := ioutil.ReadAll(innerStream)
+		assert.NoError(t, err)
+		assert.NoError(t, innerStream.Close())
+		assert.NoError(t, outerStream.Close())
+		decoded <- content
+	}()
+
+	select {
+	case content := <-decoded:
+		assert.Equal(t, []byte("data"), content)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the nested stream waits for the window budget held by its source")
+	}
+
+	// only the outer stream took the window, and it's given back
+	assert.True(t, getWindowLimits().semaphore.TryAcquire(1<<DefaultMaxWindowLog))
+	getWindowLimits().semaphore.Release(1 << DefaultMaxWindowLog)
+}
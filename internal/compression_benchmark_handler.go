@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/compression/computils"
+)
+
+// compressionMethodNotes describe the trade-offs which the numbers of a single sample don't show
+var compressionMethodNotes = map[string]string{
+	"brotli": "good trade-off between ratio and speed",
+	"lz4":    "default, fast decompression",
+	"lzma":   "best ratio, very slow",
+	"lzo": "lzop compatible files for the tools which expect them, " +
+		"pure Go encoder is slower and compresses worse than lz4",
+	"snappy": "fastest compression, every chunk is checksummed",
+	"zstd":   "high ratio at lz4-like decompression speed",
+}
+
+// CompressionBenchmarkResult holds the throughput of a compression method on the sample,
+// speeds are measured in megabytes of uncompressed data per second
+type CompressionBenchmarkResult struct {
+	Method          string  `json:"method"`
+	Ratio           float64 `json:"ratio"`
+	CompressSpeed   float64 `json:"compress_mb_per_sec"`
+	DecompressSpeed float64 `json:"decompress_mb_per_sec"`
+	Notes           string  `json:"notes,omitempty"`
+}
+
+// HandleCompressionBenchmark runs every registered compression method on the sample
+// using the same compressors and decompressors as backups do and prints the results
+func HandleCompressionBenchmark(sample []byte, json bool, output io.Writer) error {
+	if len(sample) == 0 {
+		return errors.New("compression benchmark sample is empty")
+	}
+
+	methods := make([]string, 0, len(compression.Compressors))
+	for method := range compression.Compressors {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	results := make([]CompressionBenchmarkResult, 0, len(methods))
+	for _, method := range methods {
+		result, err := benchmarkCompression(method, compression.Compressors[method], sample)
+		if err != nil {
+			return errors.Wrapf(err, "failed to benchmark %s", method)
+		}
+		results = append(results, result)
+	}
+
+	if json {
+		return WriteAsJSON(results, output, true)
+	}
+	return writeCompressionBenchmarkResults(results, output)
+}
+
+func benchmarkCompression(method string, compressor compression.Compressor,
+	sample []byte) (CompressionBenchmarkResult, error) {
+	decompressor := compression.GetDecompressorByCompressor(compressor)
+	if decompressor == nil {
+		return CompressionBenchmarkResult{}, errors.Errorf("no decompressor for the '%s' extension",
+			compressor.FileExtension())
+	}
+
+	compressed := &bytes.Buffer{}
+	compressStart := time.Now()
+	writer := compressor.NewWriter(compressed)
+	if _, err := writer.Write(sample); err != nil {
+		return CompressionBenchmarkResult{}, err
+	}
+	if err := writer.Close(); err != nil {
+		return CompressionBenchmarkResult{}, err
+	}
+	compressTime := time.Since(compressStart)
+
+	compressedSize := compressed.Len()
+	decompressStart := time.Now()
+	reader, err := decompressor.Decompress(compressed)
+	if err != nil {
+		return CompressionBenchmarkResult{}, err
+	}
+	decompressedSize, err := io.Copy(ioutil.Discard, reader)
+	if err != nil {
+		return CompressionBenchmarkResult{}, err
+	}
+	if err = reader.Close(); err != nil {
+		return CompressionBenchmarkResult{}, err
+	}
+	decompressTime := time.Since(decompressStart)
+	if decompressedSize != int64(len(sample)) {
+		return CompressionBenchmarkResult{}, errors.Errorf("decompressed %d bytes instead of %d",
+			decompressedSize, len(sample))
+	}
+
+	return CompressionBenchmarkResult{
+		Method:          method,
+		Ratio:           float64(len(sample)) / float64(compressedSize),
+		CompressSpeed:   megabytesPerSecond(len(sample), compressTime),
+		DecompressSpeed: megabytesPerSecond(len(sample), decompressTime),
+		Notes:           compressionMethodNotes[method],
+	}, nil
+}
+
+func megabytesPerSecond(size int, elapsed time.Duration) float64 {
+	return float64(size) / (1 << 20) / elapsed.Seconds()
+}
+
+func writeCompressionBenchmarkResults(results []CompressionBenchmarkResult, output io.Writer) error {
+	writer := tabwriter.NewWriter(output, 0, 0, 1, ' ', 0)
+	_, err := fmt.Fprintln(writer, "method\tratio\tcompress_mb_per_sec\tdecompress_mb_per_sec\tnotes")
+	if err != nil {
+		return err
+	}
+	for _, result := range results {
+		_, err = fmt.Fprintf(writer, "%s\t%.2f\t%.1f\t%.1f\t%s\n",
+			result.Method, result.Ratio, result.CompressSpeed, result.DecompressSpeed, result.Notes)
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// GenerateCompressionBenchmarkSample makes the pseudo WAL data of the given size, see computils.GenerateWALSample
+func GenerateCompressionBenchmarkSample(size int) []byte {
+	return computils.GenerateWALSample(size)
+}
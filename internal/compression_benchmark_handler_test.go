@@ -0,0 +1,33 @@
+package internal_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression"
+)
+
+func TestHandleCompressionBenchmark(t *testing.T) {
+	sample := internal.GenerateCompressionBenchmarkSample(1 << 20)
+	assert.Len(t, sample, 1<<20)
+
+	output := &bytes.Buffer{}
+	err := internal.HandleCompressionBenchmark(sample, true, output)
+	assert.NoError(t, err)
+
+	var results []internal.CompressionBenchmarkResult
+	assert.NoError(t, json.Unmarshal(output.Bytes(), &results))
+	assert.Len(t, results, len(compression.Compressors))
+	for _, result := range results {
+		assert.Contains(t, compression.Compressors, result.Method)
+		assert.Greater(t, result.Ratio, 1.0)
+	}
+}
+
+func TestHandleCompressionBenchmark_emptySample(t *testing.T) {
+	err := internal.HandleCompressionBenchmark([]byte{}, false, &bytes.Buffer{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+)
+
+// EntropyProbeSize is the size of the file head used to estimate the file compressibility
+const EntropyProbeSize = 64 * 1024
+
+// CompressionPolicy decides which files are not worth compressing, such files are stored
+// in the plain tar parts instead of the compressed ones
+type CompressionPolicy struct {
+	patterns         []string
+	entropyThreshold float64
+
+	storedFiles int64
+	storedBytes int64
+}
+
+func NewCompressionPolicy(patterns []string, entropyThreshold float64) *CompressionPolicy {
+	return &CompressionPolicy{patterns: patterns, entropyThreshold: entropyThreshold}
+}
+
+// ConfigureCompressionPolicy returns nil if neither file patterns nor entropy threshold are set,
+// i.e. all the files are compressed
+func ConfigureCompressionPolicy() (*CompressionPolicy, error) {
+	var patterns []string
+	for _, pattern := range strings.Split(viper.GetString(UncompressedPatternsSetting), ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, errors.Wrapf(err, "invalid %s pattern '%s'", UncompressedPatternsSetting, pattern)
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	entropyThreshold := viper.GetFloat64(UncompressedEntropySetting)
+	if entropyThreshold < 0 || entropyThreshold > 8 {
+		return nil, errors.Errorf("%s must be between 0 and 8 bits per byte, got %v",
+			UncompressedEntropySetting, entropyThreshold)
+	}
+	if len(patterns) == 0 && entropyThreshold == 0 {
+		return nil, nil
+	}
+	return NewCompressionPolicy(patterns, entropyThreshold), nil
+}
+
+// ShouldStoreUncompressed checks whether the file matches one of the patterns
+// or its head looks like already compressed data. The patterns are matched
+// against both the relative file path and the file base name.
+func (policy *CompressionPolicy) ShouldStoreUncompressed(relPath string, absPath string) bool {
+	for _, pattern := range policy.patterns {
+		if matched, _ := filepath.Match(pattern, filepath.Base(relPath)); matched {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern, strings.TrimPrefix(relPath, "/")); matched {
+			return true
+		}
+	}
+	if policy.entropyThreshold == 0 {
+		return false
+	}
+
+	file, err := os.Open(absPath)
+	if err != nil {
+		// the file will be compressed as usual, its packing reports the error if any
+		tracelog.DebugLogger.Printf("Skipping entropy probe of '%s': %v", absPath, err)
+		return false
+	}
+	defer file.Close()
+	entropy, err := ProbeEntropy(file)
+	if err != nil {
+		tracelog.DebugLogger.Printf("Skipping entropy probe of '%s': %v", absPath, err)
+		return false
+	}
+	return entropy >= policy.entropyThreshold
+}
+
+// AddStoredFile counts the file stored uncompressed
+func (policy *CompressionPolicy) AddStoredFile(size int64) {
+	atomic.AddInt64(&policy.storedFiles, 1)
+	atomic.AddInt64(&policy.storedBytes, size)
+}
+
+// StoredFiles is the number of files stored uncompressed
+func (policy *CompressionPolicy) StoredFiles() int64 {
+	return atomic.LoadInt64(&policy.storedFiles)
+}
+
+// StoredBytes is the total size of the files stored uncompressed
+func (policy *CompressionPolicy) StoredBytes() int64 {
+	return atomic.LoadInt64(&policy.storedBytes)
+}
+
+// ProbeEntropy reads up to EntropyProbeSize bytes and returns their Shannon entropy in bits per byte,
+// the compressed or encrypted data is close to 8 while the text and table pages are well below it
+func ProbeEntropy(reader io.Reader) (float64, error) {
+	probe := make([]byte, EntropyProbeSize)
+	n, err := io.ReadFull(reader, probe)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	return shannonEntropy(probe[:n]), nil
+}
+
+func shannonEntropy(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / float64(len(data))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
@@ -0,0 +1,90 @@
+package internal_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal"
+)
+
+func TestProbeEntropy(t *testing.T) {
+	random := make([]byte, internal.EntropyProbeSize)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	entropy, err := internal.ProbeEntropy(bytes.NewReader(random))
+	assert.NoError(t, err)
+	assert.Greater(t, entropy, 7.9)
+
+	entropy, err = internal.ProbeEntropy(bytes.NewReader(bytes.Repeat([]byte("relation page "), 10000)))
+	assert.NoError(t, err)
+	assert.Less(t, entropy, 4.0)
+
+	entropy, err = internal.ProbeEntropy(bytes.NewReader(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, entropy)
+}
+
+func TestCompressionPolicy_patterns(t *testing.T) {
+	policy := internal.NewCompressionPolicy([]string{"*.gz", "base/16384/*"}, 0)
+
+	assert.True(t, policy.ShouldStoreUncompressed("/pg_log/archive.gz", "/nonexistent"))
+	assert.True(t, policy.ShouldStoreUncompressed("/base/16384/16385", "/nonexistent"))
+	assert.False(t, policy.ShouldStoreUncompressed("/base/1/16385", "/nonexistent"))
+}
+
+func TestCompressionPolicy_entropy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compression_policy")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	random := make([]byte, 2*internal.EntropyProbeSize)
+	rand.New(rand.NewSource(1)).Read(random)
+	randomPath := filepath.Join(dir, "random")
+	assert.NoError(t, ioutil.WriteFile(randomPath, random, 0600))
+	zerosPath := filepath.Join(dir, "zeros")
+	assert.NoError(t, ioutil.WriteFile(zerosPath, make([]byte, internal.EntropyProbeSize), 0600))
+
+	policy := internal.NewCompressionPolicy(nil, 7.9)
+	assert.True(t, policy.ShouldStoreUncompressed("/random", randomPath))
+	assert.False(t, policy.ShouldStoreUncompressed("/zeros", zerosPath))
+	assert.False(t, policy.ShouldStoreUncompressed("/missing", filepath.Join(dir, "missing")))
+}
+
+func TestConfigureCompressionPolicy(t *testing.T) {
+	defer func() {
+		viper.Set(internal.UncompressedPatternsSetting, "")
+		viper.Set(internal.UncompressedEntropySetting, "")
+	}()
+
+	policy, err := internal.ConfigureCompressionPolicy()
+	assert.NoError(t, err)
+	assert.Nil(t, policy)
+
+	viper.Set(internal.UncompressedPatternsSetting, " *.gz, *.zst ")
+	policy, err = internal.ConfigureCompressionPolicy()
+	assert.NoError(t, err)
+	assert.True(t, policy.ShouldStoreUncompressed("/a.zst", "/nonexistent"))
+
+	viper.Set(internal.UncompressedPatternsSetting, "[")
+	_, err = internal.ConfigureCompressionPolicy()
+	assert.Error(t, err)
+
+	viper.Set(internal.UncompressedPatternsSetting, "")
+	viper.Set(internal.UncompressedEntropySetting, "9")
+	_, err = internal.ConfigureCompressionPolicy()
+	assert.Error(t, err)
+}
+
+func TestCompressionPolicy_counters(t *testing.T) {
+	policy := internal.NewCompressionPolicy(nil, 7.9)
+	policy.AddStoredFile(100)
+	policy.AddStoredFile(23)
+	assert.Equal(t, int64(2), policy.StoredFiles())
+	assert.Equal(t, int64(123), policy.StoredBytes())
+}
@@ -27,6 +27,20 @@ const (
 	GP        = "GP"
 
 	DownloadConcurrencySetting   = "WALG_DOWNLOAD_CONCURRENCY"
+	DecompressionConcurrency     = "WALG_DECOMPRESSION_CONCURRENCY"
+	DecryptionWorkersSetting     = "WALG_DECRYPTION_WORKERS"
+	HostExtractionLockDirSetting = "WALG_HOST_EXTRACTION_LOCK_DIR"
+	HostExtractionSlotsSetting   = "WALG_HOST_EXTRACTION_CONCURRENCY"
+	DownloadResumeAttempts       = "WALG_DOWNLOAD_RESUME_ATTEMPTS"
+	VerifyDownloadChecksum       = "WALG_VERIFY_DOWNLOAD_CHECKSUM"
+	MultipartDownloadThreshold   = "WALG_MULTIPART_DOWNLOAD_THRESHOLD"
+	DownloadPartSizeSetting      = "WALG_DOWNLOAD_PART_SIZE"
+	DownloadPartConcurrency      = "WALG_DOWNLOAD_PART_CONCURRENCY"
+	ExtractUnknownAsRawSetting   = "WALG_EXTRACT_UNKNOWN_AS_RAW"
+	StrictEncryptionSetting      = "WALG_STRICT_ENCRYPTION"
+	PerFileExtractTimeout        = "WALG_PER_FILE_EXTRACT_TIMEOUT"
+	CheckStorageTierSetting      = "WALG_CHECK_STORAGE_TIER"
+	EncryptMetadataSetting       = "WALG_ENCRYPT_METADATA"
 	UploadConcurrencySetting     = "WALG_UPLOAD_CONCURRENCY"
 	UploadDiskConcurrencySetting = "WALG_UPLOAD_DISK_CONCURRENCY"
 	UploadQueueSetting           = "WALG_UPLOAD_QUEUE"
@@ -37,8 +51,13 @@ const (
 	DeltaOriginSetting           = "WALG_DELTA_ORIGIN"
 	CompressionMethodSetting     = "WALG_COMPRESSION_METHOD"
 	StoragePrefixSetting         = "WALG_STORAGE_PREFIX"
+	StorageRetryAttemptsSetting  = "WALG_STORAGE_RETRY_ATTEMPTS"
+	StorageRetryTimeoutSetting   = "WALG_STORAGE_RETRY_TIMEOUT"
+	FailoverStoragePrefixes      = "WALG_FAILOVER_STORAGE_PREFIXES"
 	DiskRateLimitSetting         = "WALG_DISK_RATE_LIMIT"
 	NetworkRateLimitSetting      = "WALG_NETWORK_RATE_LIMIT"
+	StorageRateLimitSetting      = "WALG_STORAGE_RATE_LIMIT"
+	StorageRateBurstSetting      = "WALG_STORAGE_RATE_BURST"
 	UseWalDeltaSetting           = "WALG_USE_WAL_DELTA"
 	UseReverseUnpackSetting      = "WALG_USE_REVERSE_UNPACK"
 	SkipRedundantTarsSetting     = "WALG_SKIP_REDUNDANT_TARS"
@@ -53,6 +72,16 @@ const (
 	LogLevelSetting              = "WALG_LOG_LEVEL"
 	TarSizeThresholdSetting      = "WALG_TAR_SIZE_THRESHOLD"
 	TarDisableFsyncSetting       = "WALG_TAR_DISABLE_FSYNC"
+	SkipFsyncOnRestoreSetting    = "WALG_SKIP_FSYNC_ON_RESTORE"
+	RestoreUmaskSetting          = "WALG_RESTORE_UMASK"
+	RestoreOverwriteSetting      = "WALG_RESTORE_OVERWRITE"
+	UncompressedPatternsSetting  = "WALG_UNCOMPRESSED_FILE_PATTERNS"
+	UncompressedEntropySetting   = "WALG_UNCOMPRESSED_ENTROPY_THRESHOLD"
+	ZstdDictionarySetting        = "WALG_ZSTD_DICTIONARY_PATH"
+	ZstdMaxWindowLogSetting      = "WALG_ZSTD_MAX_WINDOW_LOG"
+	ZstdWindowBudgetSetting      = "WALG_ZSTD_WINDOW_BUDGET"
+	Lz4ChecksumModeSetting       = "WALG_LZ4_CHECKSUM_MODE"
+	Lz4BlockChecksumSetting      = "WALG_LZ4_BLOCK_CHECKSUM"
 	CseKmsIDSetting              = "WALG_CSE_KMS_ID"
 	CseKmsRegionSetting          = "WALG_CSE_KMS_REGION"
 	LibsodiumKeySetting          = "WALG_LIBSODIUM_KEY"
@@ -62,6 +91,23 @@ const (
 	PgpKeySetting                = "WALG_PGP_KEY"
 	PgpKeyPathSetting            = "WALG_PGP_KEY_PATH"
 	PgpKeyPassphraseSetting      = "WALG_PGP_KEY_PASSPHRASE"
+	PgpDecryptionKeyPathsSetting = "WALG_PGP_DECRYPTION_KEY_PATHS"
+	PgpAgentSocketSetting        = "WALG_PGP_AGENT_SOCKET"
+	PgpPkcs11ModuleSetting       = "WALG_PGP_PKCS11_MODULE"
+	PgpPkcs11TokenLabelSetting   = "WALG_PGP_PKCS11_TOKEN_LABEL"
+	PgpPkcs11PinSetting          = "WALG_PGP_PKCS11_PIN"
+	AgeRecipientsSetting         = "WALG_AGE_RECIPIENTS"
+	AgeIdentitiesPathSetting     = "WALG_AGE_IDENTITIES_PATH"
+	AgePassphraseSetting         = "WALG_AGE_PASSPHRASE"
+	EncryptCommandSetting        = "WALG_ENCRYPT_COMMAND"
+	DecryptCommandSetting        = "WALG_DECRYPT_COMMAND"
+	FIPSModeSetting              = "WALG_FIPS_MODE"
+	SigningEd25519KeySetting     = "WALG_SIGNING_ED25519_KEY"
+	SigningPgpKeyPathSetting     = "WALG_SIGNING_PGP_KEY_PATH"
+	SigningPgpPassphraseSetting  = "WALG_SIGNING_PGP_KEY_PASSPHRASE"
+	VerifyEd25519KeySetting      = "WALG_VERIFY_ED25519_KEY"
+	VerifyPgpKeyPathSetting      = "WALG_VERIFY_PGP_KEY_PATH"
+	VerifySignatureSetting       = "WALG_VERIFY_SIGNATURE"
 	PgDataSetting                = "PGDATA"
 	UserSetting                  = "USER" // TODO : do something with it
 	PgPortSetting                = "PGPORT"
@@ -137,6 +183,8 @@ const (
 	YcKmsKeyIDSetting  = "YC_CSE_KMS_KEY_ID"
 	YcSaKeyFileSetting = "YC_SERVICE_ACCOUNT_KEY_FILE"
 
+	GcpKmsKeyNameSetting = "WALG_GCP_CSE_KMS_KEY_NAME"
+
 	PgBackRestStanza = "PGBACKREST_STANZA"
 )
 
@@ -146,6 +194,16 @@ var (
 
 	commonDefaultConfigValues = map[string]string{
 		DownloadConcurrencySetting:   "10",
+		DecryptionWorkersSetting:     "1",
+		HostExtractionSlotsSetting:   AutoConcurrency,
+		DownloadResumeAttempts:       "0",
+		VerifyDownloadChecksum:       "false",
+		DownloadPartSizeSetting:      "16777216",
+		DownloadPartConcurrency:      "4",
+		ExtractUnknownAsRawSetting:   "false",
+		StrictEncryptionSetting:      "false",
+		EncryptMetadataSetting:       "false",
+		FIPSModeSetting:              "false",
 		UploadConcurrencySetting:     "16",
 		UploadDiskConcurrencySetting: "1",
 		UploadQueueSetting:           "2",
@@ -153,9 +211,13 @@ var (
 		UploadWalMetadata:            "NOMETADATA",
 		DeltaMaxStepsSetting:         "0",
 		CompressionMethodSetting:     "lz4",
+		StorageRetryAttemptsSetting:  "1",
+		StorageRetryTimeoutSetting:   "1m",
 		UseWalDeltaSetting:           "false",
 		TarSizeThresholdSetting:      "1073741823", // (1 << 30) - 1
 		TarDisableFsyncSetting:       "false",
+		SkipFsyncOnRestoreSetting:    "false",
+		RestoreOverwriteSetting:      string(OverwriteExistingFiles),
 		TotalBgUploadedLimit:         "32",
 		UseReverseUnpackSetting:      "false",
 		SkipRedundantTarsSetting:     "false",
@@ -207,6 +269,21 @@ var (
 	CommonAllowedSettings = map[string]bool{
 		// WAL-G core
 		DownloadConcurrencySetting:   true,
+		DecompressionConcurrency:     true,
+		DecryptionWorkersSetting:     true,
+		HostExtractionLockDirSetting: true,
+		HostExtractionSlotsSetting:   true,
+		DownloadResumeAttempts:       true,
+		VerifyDownloadChecksum:       true,
+		MultipartDownloadThreshold:   true,
+		DownloadPartSizeSetting:      true,
+		DownloadPartConcurrency:      true,
+		PerFileExtractTimeout:        true,
+		CheckStorageTierSetting:      true,
+		ExtractUnknownAsRawSetting:   true,
+		StrictEncryptionSetting:      true,
+		EncryptMetadataSetting:       true,
+		FIPSModeSetting:              true,
 		UploadConcurrencySetting:     true,
 		UploadDiskConcurrencySetting: true,
 		UploadQueueSetting:           true,
@@ -217,17 +294,48 @@ var (
 		DeltaOriginSetting:           true,
 		CompressionMethodSetting:     true,
 		StoragePrefixSetting:         true,
+		StorageRetryAttemptsSetting:  true,
+		StorageRetryTimeoutSetting:   true,
+		FailoverStoragePrefixes:      true,
 		DiskRateLimitSetting:         true,
 		NetworkRateLimitSetting:      true,
+		StorageRateLimitSetting:      true,
+		StorageRateBurstSetting:      true,
 		UseWalDeltaSetting:           true,
 		LogLevelSetting:              true,
 		TarSizeThresholdSetting:      true,
 		TarDisableFsyncSetting:       true,
+		SkipFsyncOnRestoreSetting:    true,
+		RestoreUmaskSetting:          true,
+		RestoreOverwriteSetting:      true,
+		UncompressedPatternsSetting:  true,
+		UncompressedEntropySetting:   true,
+		ZstdDictionarySetting:        true,
+		ZstdMaxWindowLogSetting:      true,
+		ZstdWindowBudgetSetting:      true,
+		Lz4ChecksumModeSetting:       true,
+		Lz4BlockChecksumSetting:      true,
 		"WALG_" + GpgKeyIDSetting:    true,
 		"WALE_" + GpgKeyIDSetting:    true,
 		PgpKeySetting:                true,
 		PgpKeyPathSetting:            true,
 		PgpKeyPassphraseSetting:      true,
+		PgpDecryptionKeyPathsSetting: true,
+		PgpAgentSocketSetting:        true,
+		PgpPkcs11ModuleSetting:       true,
+		PgpPkcs11TokenLabelSetting:   true,
+		PgpPkcs11PinSetting:          true,
+		AgeRecipientsSetting:         true,
+		AgeIdentitiesPathSetting:     true,
+		AgePassphraseSetting:         true,
+		EncryptCommandSetting:        true,
+		DecryptCommandSetting:        true,
+		SigningEd25519KeySetting:     true,
+		SigningPgpKeyPathSetting:     true,
+		SigningPgpPassphraseSetting:  true,
+		VerifyEd25519KeySetting:      true,
+		VerifyPgpKeyPathSetting:      true,
+		VerifySignatureSetting:       true,
 		LibsodiumKeySetting:          true,
 		LibsodiumKeyPathSetting:      true,
 		LibsodiumKeyTransform:        true,
@@ -247,6 +355,13 @@ var (
 		FetchTargetUserDataSetting:   true,
 		SerializerTypeSetting:        true,
 
+		// Storage HTTP clients
+		"WALG_STORAGE_DIAL_TIMEOUT":            true,
+		"WALG_STORAGE_RESPONSE_HEADER_TIMEOUT": true,
+		"WALG_STORAGE_MAX_IDLE_CONNECTIONS":    true,
+		"WALG_STORAGE_CA_CERT_FILE":            true,
+		"WALG_STORAGE_INSECURE_SKIP_VERIFY":    true,
+
 		// Swift
 		"WALG_SWIFT_PREFIX": true,
 		"OS_AUTH_URL":       true,
@@ -286,6 +401,7 @@ var (
 		"S3_RANGE_BATCH_ENABLED":      true,
 		"S3_RANGE_MAX_RETRIES":        true,
 		"S3_MAX_RETRIES":              true,
+		"S3_REQUESTER_PAYS":           true,
 
 		// Azure
 		"WALG_AZ_PREFIX":           true,
@@ -299,6 +415,7 @@ var (
 		// GS
 		"WALG_GS_PREFIX":                 true,
 		"GOOGLE_APPLICATION_CREDENTIALS": true,
+		GcpKmsKeyNameSetting:             true,
 
 		// Yandex Cloud
 		YcSaKeyFileSetting: true,
@@ -310,6 +427,8 @@ var (
 		"SSH_PASSWORD":         true,
 		"SSH_USERNAME":         true,
 		"SSH_PRIVATE_KEY_PATH": true,
+		"SSH_KNOWN_HOSTS_PATH": true,
+		"SSH_CONNECTIONS":      true,
 
 		//File
 		"WALG_FILE_PREFIX": true,
@@ -458,6 +577,7 @@ func ConfigureSettings(currentType string) {
 			}
 			AllowedSettings["WALG_"+adapter.prefixName] = true
 		}
+		addSecretSourceSettings(AllowedSettings)
 	}
 }
 
@@ -514,6 +634,38 @@ func Configure() {
 	}
 
 	configureLimiters()
+	resolveAutoConcurrency()
+
+	err = configureZstdDictionary()
+	if err != nil {
+		tracelog.ErrorLogger.Println("Failed to load zstd dictionary.")
+		tracelog.ErrorLogger.FatalError(err)
+	}
+
+	err = configureZstdWindowLimits()
+	if err != nil {
+		tracelog.ErrorLogger.FatalError(err)
+	}
+
+	err = configureLz4Checksums()
+	if err != nil {
+		tracelog.ErrorLogger.FatalError(err)
+	}
+
+	err = ConfigureFIPSMode()
+	if err != nil {
+		tracelog.ErrorLogger.FatalError(err)
+	}
+
+	err = configureDecompressionStats()
+	if err != nil {
+		tracelog.ErrorLogger.FatalError(err)
+	}
+
+	err = configureDecryptionWorkers()
+	if err != nil {
+		tracelog.ErrorLogger.FatalError(err)
+	}
 }
 
 // ConfigureAndRunDefaultWebServer configures and runs web server
@@ -575,6 +727,9 @@ func InitConfig() {
 	CheckAllowedSettings(globalViper)
 
 	bindConfigToEnv(globalViper)
+	// the secrets are resolved after the binding, so they don't get to the environment
+	err := resolveSecretSettings(globalViper)
+	tracelog.ErrorLogger.FatalOnError(err)
 }
 
 // ReadConfigFromFile read config to the viper instance
@@ -684,8 +839,10 @@ func FolderFromConfig(configFile string) (storage.Folder, error) {
 	SetDefaultValues(config)
 	ReadConfigFromFile(config, configFile)
 	CheckAllowedSettings(config)
+	err := resolveSecretSettings(config)
+	tracelog.ErrorLogger.FatalOnError(err)
 
-	var folder, err = ConfigureFolderForSpecificConfig(config)
+	folder, err := ConfigureFolderForSpecificConfig(config)
 
 	if err != nil {
 		tracelog.ErrorLogger.Println("Failed configure folder according to config " + configFile)
@@ -4,10 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/wal-g/wal-g/internal/crypto/yckms"
@@ -16,11 +20,16 @@ import (
 	"github.com/spf13/viper"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/compression/lz4"
 	"github.com/wal-g/wal-g/internal/crypto"
+	"github.com/wal-g/wal-g/internal/crypto/age"
 	"github.com/wal-g/wal-g/internal/crypto/awskms"
+	"github.com/wal-g/wal-g/internal/crypto/command"
+	"github.com/wal-g/wal-g/internal/crypto/gcpkms"
 	"github.com/wal-g/wal-g/internal/crypto/openpgp"
 	"github.com/wal-g/wal-g/internal/fsutil"
 	"github.com/wal-g/wal-g/internal/limiters"
+	"github.com/wal-g/wal-g/internal/signing"
 	"github.com/wal-g/wal-g/pkg/storages/storage"
 	"golang.org/x/time/rate"
 )
@@ -34,6 +43,24 @@ const (
 
 const MinAllowedConcurrency = 1
 
+// AutoConcurrency is the concurrency setting value which sizes the worker pool by the number of CPUs
+const AutoConcurrency = "auto"
+
+// autoConcurrencyPerCPU are the workers per CPU for the settings supporting AutoConcurrency.
+// Download workers decompress what they download, so the CPU-bound decompression overlaps
+// with the waiting for the network and more workers than CPUs are needed to keep both busy,
+// while the decompression itself is limited by the CPUs.
+// Disk upload workers read and compress the files, so they are CPU-bound, and so are the decryption workers.
+// The host extraction cap is shared by the processes, so it is sized by the CPUs alone.
+var autoConcurrencyPerCPU = map[string]int{
+	DownloadConcurrencySetting:   4,
+	DecompressionConcurrency:     1,
+	UploadConcurrencySetting:     4,
+	UploadDiskConcurrencySetting: 1,
+	DecryptionWorkersSetting:     1,
+	HostExtractionSlotsSetting:   1,
+}
+
 var DeprecatedExternalGpgMessage = fmt.Sprintf(
 	`You are using deprecated functionality that uses an external gpg library.
 It will be removed in next major version.
@@ -106,6 +133,90 @@ func (err UnmarshallingError) Error() string {
 	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
 }
 
+// configureZstdDictionary loads the dictionary used by zstd compressor and decompressor
+func configureZstdDictionary() error {
+	dictionaryPath, ok := GetSetting(ZstdDictionarySetting)
+	if !ok {
+		return nil
+	}
+	content, err := ioutil.ReadFile(dictionaryPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s", ZstdDictionarySetting)
+	}
+	return compression.SetZstdDictionary(content)
+}
+
+// configureZstdWindowLimits sets the window limits of zstd decompressor, the defaults are kept
+// unless one of the settings is given, so the builds without zstd don't fail
+func configureZstdWindowLimits() error {
+	maxWindowLogSetting, logSet := GetSetting(ZstdMaxWindowLogSetting)
+	budgetSetting, budgetSet := GetSetting(ZstdWindowBudgetSetting)
+	if !logSet && !budgetSet {
+		return nil
+	}
+	maxWindowLog := compression.ZstdDefaultMaxWindowLog
+	if logSet {
+		var err error
+		maxWindowLog, err = strconv.Atoi(maxWindowLogSetting)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse %s", ZstdMaxWindowLogSetting)
+		}
+	}
+	budget := int64(compression.ZstdDefaultWindowBudget)
+	if budgetSet {
+		var err error
+		budget, err = strconv.ParseInt(budgetSetting, 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse %s", ZstdWindowBudgetSetting)
+		}
+	}
+	return compression.SetZstdWindowLimits(maxWindowLog, budget)
+}
+
+// configureLz4Checksums sets whether lz4 compressor writes the block checksums
+// and how lz4 decompressor treats the frames without checksums
+func configureLz4Checksums() error {
+	if blockChecksumSetting, ok := GetSetting(Lz4BlockChecksumSetting); ok {
+		blockChecksums, err := strconv.ParseBool(blockChecksumSetting)
+		if err != nil {
+			return errors.Wrapf(err, "invalid %s", Lz4BlockChecksumSetting)
+		}
+		lz4.SetBlockChecksums(blockChecksums)
+	}
+	modeSetting, ok := GetSetting(Lz4ChecksumModeSetting)
+	if !ok {
+		return nil
+	}
+	mode, err := lz4.ParseChecksumMode(modeSetting)
+	if err != nil {
+		return errors.Wrapf(err, "invalid %s", Lz4ChecksumModeSetting)
+	}
+	lz4.SetChecksumMode(mode)
+	return nil
+}
+
+// configureDecryptionWorkers sets the workers decrypting every file of the KMS crypters in parallel,
+// all the files share GOMAXPROCS decryption slots, so more workers only help the fewer concurrent downloads
+func configureDecryptionWorkers() error {
+	workers, err := GetMaxConcurrency(DecryptionWorkersSetting)
+	if err != nil {
+		return err
+	}
+	crypto.SetDecryptionWorkers(workers)
+	return nil
+}
+
+// configureDecompressionStats measures the decompression of every file when its throughput is either logged,
+// at DEVEL log level, or exposed by the expvar endpoint
+func configureDecompressionStats() error {
+	exposeExpVar, err := GetBoolSettingDefault(HTTPExposeExpVar, false)
+	if err != nil {
+		return err
+	}
+	compression.SetStatsEnabled(exposeExpVar || viper.GetString(LogLevelSetting) == tracelog.DevelLogLevel)
+	return nil
+}
+
 // TODO : unit tests
 func configureLimiters() {
 	if Turbo {
@@ -122,6 +233,18 @@ func configureLimiters() {
 		limiters.NetworkLimiter = rate.NewLimiter(rate.Limit(netLimit),
 			int(netLimit+DefaultDataBurstRateLimit)) // Add 8 pages to possible bursts
 	}
+
+	if viper.IsSet(StorageRateLimitSetting) {
+		requestsLimit := viper.GetFloat64(StorageRateLimitSetting)
+		burst := int(math.Ceil(requestsLimit))
+		if viper.IsSet(StorageRateBurstSetting) {
+			burst = viper.GetInt(StorageRateBurstSetting)
+		}
+		if burst < 1 {
+			burst = 1
+		}
+		limiters.StorageLimiter = rate.NewLimiter(rate.Limit(requestsLimit), burst)
+	}
 }
 
 // TODO : unit tests
@@ -159,11 +282,119 @@ func ConfigureFolderForSpecificConfig(config *viper.Viper) (storage.Folder, erro
 		}
 
 		settings := adapter.loadSettings(config)
-		return adapter.configureFolder(prefix, settings)
+		folder, err := configureAdapterFolder(adapter, prefix, settings, config)
+		if err != nil {
+			return nil, err
+		}
+		return configureFailoverFolders(folder, adapter, settings, config)
 	}
 	return nil, newUnconfiguredStorageError(skippedPrefixes)
 }
 
+// ConfigureFolderForPrefix configures the folder of the storage prefix, e.g. s3://bucket/path,
+// by the adapter of its scheme and the storage settings of the config. The prefixes without
+// a known scheme are the local paths.
+func ConfigureFolderForPrefix(prefix string) (storage.Folder, error) {
+	return ConfigureFolderForPrefixWithConfig(prefix, viper.GetViper())
+}
+
+// ConfigureFolderForPrefixFromFile configures the folder of the prefix by the storage settings of the config file,
+// e.g. the credentials of the other side of the copy. The settings the file doesn't set are taken
+// from the global config. Without the file the folder is configured by the global config.
+func ConfigureFolderForPrefixFromFile(prefix string, configFile string) (storage.Folder, error) {
+	if configFile == "" {
+		return ConfigureFolderForPrefix(prefix)
+	}
+	config := viper.New()
+	config.SetConfigFile(configFile)
+	if err := config.ReadInConfig(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read the config file %s", configFile)
+	}
+	return ConfigureFolderForPrefixWithConfig(prefix, config)
+}
+
+// ConfigureFolderForPrefixWithConfig is ConfigureFolderForPrefix by the storage settings of the config
+func ConfigureFolderForPrefixWithConfig(prefix string, config *viper.Viper) (storage.Folder, error) {
+	prefixName := "FILE_PREFIX"
+	if separator := strings.Index(prefix, "://"); separator >= 0 {
+		if name, ok := storageSchemePrefixNames[prefix[:separator]]; ok {
+			prefixName = name
+		}
+	}
+	for _, adapter := range StorageAdapters {
+		if adapter.prefixName != prefixName {
+			continue
+		}
+		if adapter.prefixPreprocessor != nil {
+			prefix = adapter.prefixPreprocessor(prefix)
+		}
+		return configureAdapterFolder(adapter, prefix, adapter.loadSettings(config), config)
+	}
+	return nil, errors.Errorf("no storage adapter for the prefix '%s'", prefix)
+}
+
+func configureAdapterFolder(adapter StorageAdapter, prefix string, settings map[string]string,
+	config *viper.Viper) (storage.Folder, error) {
+	folder, err := adapter.configureFolder(prefix, settings)
+	if err != nil {
+		return nil, err
+	}
+	// every retry attempt is throttled too
+	if limiters.StorageLimiter != nil {
+		folder = storage.NewThrottlingFolder(folder, limiters.StorageLimiter)
+	}
+	return configureFolderRetries(folder, adapter.isRetryableError, config)
+}
+
+// configureFailoverFolders reads from the prefixes of WALG_FAILOVER_STORAGE_PREFIXES when the primary folder
+// is missing the object or unavailable. They are configured by the same adapter and settings as the primary folder.
+func configureFailoverFolders(primary storage.Folder, adapter StorageAdapter, settings map[string]string,
+	config *viper.Viper) (storage.Folder, error) {
+	var failovers []storage.Folder
+	for _, prefix := range strings.Split(config.GetString(FailoverStoragePrefixes), ",") {
+		prefix = strings.TrimSpace(prefix)
+		if prefix == "" {
+			continue
+		}
+		if adapter.prefixPreprocessor != nil {
+			prefix = adapter.prefixPreprocessor(prefix)
+		}
+		failover, err := configureAdapterFolder(adapter, prefix, settings, config)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to configure the failover storage %s", prefix)
+		}
+		failovers = append(failovers, failover)
+	}
+	return storage.NewMultiFolder(primary, failovers, adapter.isRetryableError), nil
+}
+
+// configureFolderRetries wraps the folder to retry the transient failures if WALG_STORAGE_RETRY_ATTEMPTS is above 1
+func configureFolderRetries(folder storage.Folder, isRetryableError func(error) bool,
+	config *viper.Viper) (storage.Folder, error) {
+	attemptsStr := config.GetString(StorageRetryAttemptsSetting)
+	if attemptsStr == "" {
+		return folder, nil
+	}
+	maxAttempts, err := strconv.Atoi(attemptsStr)
+	if err != nil || maxAttempts < 1 {
+		return nil, fmt.Errorf("positive integer expected for %s setting but given '%s'",
+			StorageRetryAttemptsSetting, attemptsStr)
+	}
+	var timeout time.Duration
+	if timeoutStr := config.GetString(StorageRetryTimeoutSetting); timeoutStr != "" {
+		timeout, err = time.ParseDuration(timeoutStr)
+		if err != nil {
+			return nil, fmt.Errorf("duration expected for %s setting but given '%s': %w",
+				StorageRetryTimeoutSetting, timeoutStr, err)
+		}
+	}
+	return storage.NewRetryingFolder(folder, storage.RetryOptions{
+		MaxAttempts: maxAttempts,
+		Timeout:     timeout,
+		IsRetryable: isRetryableError,
+	}), nil
+}
+
 func getWalFolderPath() string {
 	if !viper.IsSet(PgDataSetting) {
 		return DefaultDataFolderPath
@@ -248,6 +479,7 @@ func ConfigureUploader() (uploader *Uploader, err error) {
 	}
 
 	uploader = NewUploader(compressor, folder)
+	uploader.Signer, err = ConfigureSigner()
 	return uploader, err
 }
 
@@ -258,6 +490,7 @@ func ConfigureUploaderWithoutCompressMethod() (uploader *Uploader, err error) {
 	}
 
 	uploader = NewUploader(nil, folder)
+	uploader.Signer, err = ConfigureSigner()
 	return uploader, err
 }
 
@@ -275,51 +508,323 @@ func ConfigureSplitUploader() (uploader UploaderProvider, err error) {
 	var partitions = viper.GetInt(StreamSplitterPartitions)
 	var blockSize = viper.GetSizeInBytes(StreamSplitterBlockSize)
 
+	signer, err := ConfigureSigner()
+	if err != nil {
+		return nil, err
+	}
+
 	uploader = NewSplitStreamUploader(compressor, folder, partitions, int(blockSize))
-	return uploader, err
+	switch typedUploader := uploader.(type) {
+	case *Uploader:
+		typedUploader.Signer = signer
+	case *SplitStreamUploader:
+		typedUploader.Signer = signer
+	}
+	return uploader, nil
 }
 
 // ConfigureCrypter uses environment variables to create and configure a crypter.
 // In case no configuration in environment variables found, return `<nil>` value.
-func ConfigureCrypter() crypto.Crypter {
+// The incomplete settings and the keys which can't be loaded are reported as errors,
+// the keys needed only for the decryption are checked by ConfigureDecryptingCrypter.
+func ConfigureCrypter() (crypto.Crypter, error) {
+	return ConfigureCrypterContext(context.Background())
+}
+
+// ConfigureCrypterContext is ConfigureCrypter whose encryption and decryption commands are killed
+// when the context is done
+func ConfigureCrypterContext(ctx context.Context) (crypto.Crypter, error) {
+	crypter, err := ConfigureEncryptionCrypterContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return loadCrypterKeys(withPgpDecryptionKeys(crypter))
+}
+
+// ConfigureEncryptionCrypter returns the crypter of the new files,
+// unlike ConfigureCrypter it doesn't decrypt with the keys of WALG_PGP_DECRYPTION_KEY_PATHS
+func ConfigureEncryptionCrypter() (crypto.Crypter, error) {
+	return ConfigureEncryptionCrypterContext(context.Background())
+}
+
+func ConfigureEncryptionCrypterContext(ctx context.Context) (crypto.Crypter, error) {
+	err := checkCrypterSettings()
+	if err != nil {
+		return nil, err
+	}
+	crypter, err := configureNonAgeCrypter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ageCrypter := configureAgeCrypter()
+	if ageCrypter == nil {
+		return loadCrypterKeys(crypter)
+	}
+	if crypter == nil {
+		return loadCrypterKeys(ageCrypter)
+	}
+	// the new files are encrypted with age, the files encrypted before keep being decrypted by the former crypter
+	return loadCrypterKeys(crypto.NewMixedCrypter(ageCrypter, crypto.AgeFormat, crypter))
+}
+
+// ConfigureDecryptingCrypter returns the crypter of the restore. Unlike ConfigureCrypter, it loads the keys needed
+// only for the decryption, e.g. the private key unlocked by the passphrase, so the restore fails before any file
+// is downloaded. Nothing is encrypted or decrypted, so the KMS and the commands aren't called.
+func ConfigureDecryptingCrypter() (crypto.Crypter, error) {
+	return ConfigureDecryptingCrypterContext(context.Background())
+}
+
+func ConfigureDecryptingCrypterContext(ctx context.Context) (crypto.Crypter, error) {
+	crypter, err := ConfigureCrypterContext(ctx)
+	if err != nil || crypter == nil {
+		return crypter, err
+	}
+	if err := crypto.LoadDecryptionKeys(crypter); err != nil {
+		return nil, errors.Wrapf(err, "crypter %s can't decrypt", crypter.Name())
+	}
+	return crypter, nil
+}
+
+// crypterSettingDependencies maps the crypter settings which have no effect on their own
+// to the settings they complement
+var crypterSettingDependencies = map[string][]string{
+	PgpKeyPassphraseSetting:    {PgpKeySetting, PgpKeyPathSetting, GpgKeyIDSetting, PgpDecryptionKeyPathsSetting},
+	PgpAgentSocketSetting:      {PgpKeySetting, PgpKeyPathSetting},
+	PgpPkcs11ModuleSetting:     {PgpKeySetting, PgpKeyPathSetting},
+	PgpPkcs11TokenLabelSetting: {PgpPkcs11ModuleSetting},
+	PgpPkcs11PinSetting:        {PgpPkcs11ModuleSetting},
+	CseKmsRegionSetting:        {CseKmsIDSetting},
+	YcSaKeyFileSetting:         {YcKmsKeyIDSetting},
+}
+
+// checkCrypterSettings reports the partially configured crypters, which otherwise leave the files unencrypted
+func checkCrypterSettings() error {
+	for setting, complemented := range crypterSettingDependencies {
+		if _, ok := GetSetting(setting); !ok {
+			continue
+		}
+		isComplemented := false
+		for _, complementedSetting := range complemented {
+			_, ok := GetSetting(complementedSetting)
+			if complementedSetting == GpgKeyIDSetting {
+				_, ok = getWaleCompatibleSetting(GpgKeyIDSetting)
+			}
+			isComplemented = isComplemented || ok
+		}
+		if !isComplemented {
+			return errors.Errorf("%s is set, but none of %s is", setting, strings.Join(complemented, ", "))
+		}
+	}
+	return nil
+}
+
+func loadCrypterKeys(crypter crypto.Crypter) (crypto.Crypter, error) {
+	if crypter == nil {
+		return nil, nil
+	}
+	if err := crypto.LoadKeys(crypter); err != nil {
+		return nil, errors.Wrapf(err, "can't load the keys of crypter %s", crypter.Name())
+	}
+	return crypter, nil
+}
+
+// withPgpDecryptionKeys adds the PGP keys which decrypt the files encrypted before the key rotation,
+// the new files are still encrypted by the configured crypter, or by the first of the keys if there is none
+func withPgpDecryptionKeys(crypter crypto.Crypter) crypto.Crypter {
+	keyPaths, ok := GetSetting(PgpDecryptionKeyPathsSetting)
+	if !ok {
+		return crypter
+	}
 	loadPassphrase := func() (string, bool) {
 		return GetSetting(PgpKeyPassphraseSetting)
 	}
 
+	var crypters []crypto.Crypter
+	if crypter != nil {
+		crypters = append(crypters, crypter)
+	}
+	for _, keyPath := range strings.Split(keyPaths, ",") {
+		if keyPath = strings.TrimSpace(keyPath); keyPath != "" {
+			crypters = append(crypters, openpgp.CrypterFromKeyPath(keyPath, loadPassphrase))
+		}
+	}
+	if len(crypters) == 0 {
+		return crypter
+	}
+	return crypto.NewMultiCrypter(crypters...)
+}
+
+// configureAgeCrypter returns the age crypter if any of its settings is set
+func configureAgeCrypter() crypto.Crypter {
+	recipients, recipientsSet := GetSetting(AgeRecipientsSetting)
+	identitiesPath, identitiesSet := GetSetting(AgeIdentitiesPathSetting)
+	_, passphraseSet := GetSetting(AgePassphraseSetting)
+	if !recipientsSet && !identitiesSet && !passphraseSet {
+		return nil
+	}
+	loadPassphrase := func() (string, bool) {
+		return GetSetting(AgePassphraseSetting)
+	}
+	return age.CrypterFromRecipients(age.ParseRecipients(recipients), identitiesPath, loadPassphrase)
+}
+
+func configureNonAgeCrypter(ctx context.Context) (crypto.Crypter, error) {
+	encryptCommand, encryptCommandSet := GetSetting(EncryptCommandSetting)
+	decryptCommand, decryptCommandSet := GetSetting(DecryptCommandSetting)
+	if encryptCommandSet || decryptCommandSet {
+		return command.CrypterFromCommands(ctx, commandShell(), encryptCommand, decryptCommand), nil
+	}
+
+	loadPassphrase := func() (string, bool) {
+		return GetSetting(PgpKeyPassphraseSetting)
+	}
+	keyHolder, err := configurePgpKeyHolder()
+	if err != nil {
+		return nil, err
+	}
+
 	// key can be either private (for download) or public (for upload)
 	if viper.IsSet(PgpKeySetting) {
-		return openpgp.CrypterFromKey(viper.GetString(PgpKeySetting), loadPassphrase)
+		if keyHolder != nil {
+			return openpgp.CrypterFromKeyWithHolder(viper.GetString(PgpKeySetting), keyHolder), nil
+		}
+		return openpgp.CrypterFromKey(viper.GetString(PgpKeySetting), loadPassphrase), nil
 	}
 
 	// key can be either private (for download) or public (for upload)
 	if viper.IsSet(PgpKeyPathSetting) {
-		return openpgp.CrypterFromKeyPath(viper.GetString(PgpKeyPathSetting), loadPassphrase)
+		if keyHolder != nil {
+			return openpgp.CrypterFromKeyPathWithHolder(viper.GetString(PgpKeyPathSetting), keyHolder), nil
+		}
+		return openpgp.CrypterFromKeyPath(viper.GetString(PgpKeyPathSetting), loadPassphrase), nil
 	}
 
 	if keyRingID, ok := getWaleCompatibleSetting(GpgKeyIDSetting); ok {
 		tracelog.WarningLogger.Printf(DeprecatedExternalGpgMessage)
-		return openpgp.CrypterFromKeyRingID(keyRingID, loadPassphrase)
+		return openpgp.CrypterFromKeyRingID(keyRingID, loadPassphrase), nil
 	}
 
 	if viper.IsSet(CseKmsIDSetting) {
-		return awskms.CrypterFromKeyID(viper.GetString(CseKmsIDSetting), viper.GetString(CseKmsRegionSetting))
+		return awskms.CrypterFromKeyID(viper.GetString(CseKmsIDSetting), viper.GetString(CseKmsRegionSetting)), nil
 	}
 
 	if viper.IsSet(YcKmsKeyIDSetting) {
-		return yckms.YcCrypterFromKeyIDAndCredential(viper.GetString(YcKmsKeyIDSetting), viper.GetString(YcSaKeyFileSetting))
+		return yckms.YcCrypterFromKeyIDAndCredential(viper.GetString(YcKmsKeyIDSetting), viper.GetString(YcSaKeyFileSetting)), nil
 	}
 
-	if crypter := configureLibsodiumCrypter(); crypter != nil {
-		return crypter
+	if viper.IsSet(GcpKmsKeyNameSetting) {
+		return gcpkms.CrypterFromKeyName(viper.GetString(GcpKmsKeyNameSetting)), nil
 	}
 
-	return nil
+	return configureLibsodiumCrypter()
+}
+
+// configurePgpKeyHolder returns the holder of the secret PGP key, if the key is kept by gpg-agent or the PKCS #11 token
+// and only the public one is configured
+func configurePgpKeyHolder() (openpgp.KeyHolder, error) {
+	socketPath, socketSet := GetSetting(PgpAgentSocketSetting)
+	_, moduleSet := GetSetting(PgpPkcs11ModuleSetting)
+	if socketSet && moduleSet {
+		return nil, errors.Errorf("only one of %s and %s can be set", PgpAgentSocketSetting, PgpPkcs11ModuleSetting)
+	}
+	if socketSet {
+		return openpgp.NewAgentKeyHolder(socketPath), nil
+	}
+	return configurePkcs11KeyHolder()
+}
+
+// ConfigureSigner returns the signer of the uploaded objects, or nil if the signing key is not configured
+func ConfigureSigner() (signing.Signer, error) {
+	ed25519Key, ed25519KeySet := GetSetting(SigningEd25519KeySetting)
+	pgpKeyPath, pgpKeyPathSet := GetSetting(SigningPgpKeyPathSetting)
+	switch {
+	case ed25519KeySet && pgpKeyPathSet:
+		return nil, errors.Errorf("only one of %s and %s can be set", SigningEd25519KeySetting, SigningPgpKeyPathSetting)
+	case ed25519KeySet:
+		return signing.NewEd25519Signer(ed25519Key)
+	case pgpKeyPathSet:
+		armoredKey, err := ioutil.ReadFile(pgpKeyPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read %s", SigningPgpKeyPathSetting)
+		}
+		passphrase, _ := GetSetting(SigningPgpPassphraseSetting)
+		return signing.NewOpenPGPSigner(string(armoredKey), passphrase)
+	default:
+		return nil, nil
+	}
+}
+
+// ConfigureSignatureVerifier returns the verifier of the object signatures, or nil if the verification key
+// is not configured
+func ConfigureSignatureVerifier() (signing.Verifier, error) {
+	ed25519Key, ed25519KeySet := GetSetting(VerifyEd25519KeySetting)
+	pgpKeyPath, pgpKeyPathSet := GetSetting(VerifyPgpKeyPathSetting)
+	switch {
+	case ed25519KeySet && pgpKeyPathSet:
+		return nil, errors.Errorf("only one of %s and %s can be set", VerifyEd25519KeySetting, VerifyPgpKeyPathSetting)
+	case ed25519KeySet:
+		return signing.NewEd25519Verifier(ed25519Key)
+	case pgpKeyPathSet:
+		armoredKeyRing, err := ioutil.ReadFile(pgpKeyPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read %s", VerifyPgpKeyPathSetting)
+		}
+		return signing.NewOpenPGPVerifier(string(armoredKeyRing))
+	default:
+		return nil, nil
+	}
+}
+
+// configureRequiredSignatureVerifier returns the verifier if VerifySignatureSetting is set, nil otherwise
+func configureRequiredSignatureVerifier() (signing.Verifier, error) {
+	if !viper.GetBool(VerifySignatureSetting) {
+		return nil, nil
+	}
+	verifier, err := ConfigureSignatureVerifier()
+	if err == nil && verifier == nil {
+		err = errors.Errorf("%s or %s must be set to verify the signatures", VerifyEd25519KeySetting, VerifyPgpKeyPathSetting)
+	}
+	return verifier, err
 }
 
 func GetMaxDownloadConcurrency() (int, error) {
 	return GetMaxConcurrency(DownloadConcurrencySetting)
 }
 
+// GetRestoreUmask returns the permission bits which are cleared in the modes of the restored files and directories
+func GetRestoreUmask() (os.FileMode, error) {
+	umask, ok := GetSetting(RestoreUmaskSetting)
+	if !ok {
+		return 0, nil
+	}
+	parsed, err := strconv.ParseUint(umask, 8, 32)
+	if err != nil || parsed > uint64(os.ModePerm) {
+		return 0, errors.Errorf("invalid %s value '%s': octal permission bits expected, e.g. 077",
+			RestoreUmaskSetting, umask)
+	}
+	return os.FileMode(parsed), nil
+}
+
+// RestoreOverwriteMode tells what the restore does with the files which already exist in the destination
+type RestoreOverwriteMode string
+
+const (
+	OverwriteExistingFiles RestoreOverwriteMode = "overwrite"
+	SkipExistingFiles      RestoreOverwriteMode = "skip"
+	FailOnExistingFiles    RestoreOverwriteMode = "error"
+)
+
+// GetRestoreOverwriteMode returns whether the restored files overwrite the existing ones, are skipped or fail the restore
+func GetRestoreOverwriteMode() (RestoreOverwriteMode, error) {
+	mode := RestoreOverwriteMode(viper.GetString(RestoreOverwriteSetting))
+	switch mode {
+	case OverwriteExistingFiles, SkipExistingFiles, FailOnExistingFiles:
+		return mode, nil
+	}
+	return "", errors.Errorf("invalid %s value '%s': %s, %s or %s expected", RestoreOverwriteSetting, mode,
+		OverwriteExistingFiles, SkipExistingFiles, FailOnExistingFiles)
+}
+
 func GetMaxUploadConcurrency() (int, error) {
 	return GetMaxConcurrency(UploadConcurrencySetting)
 }
@@ -338,6 +843,14 @@ func GetMaxUploadDiskConcurrency() (int, error) {
 }
 
 func GetMaxConcurrency(concurrencyType string) (int, error) {
+	if isAutoConcurrency(concurrencyType) {
+		perCPU, ok := autoConcurrencyPerCPU[concurrencyType]
+		if !ok {
+			return MinAllowedConcurrency, errors.Errorf("%s does not support the '%s' value",
+				concurrencyType, AutoConcurrency)
+		}
+		return runtime.NumCPU() * perCPU, nil
+	}
 	concurrency := viper.GetInt(concurrencyType)
 
 	if concurrency < MinAllowedConcurrency {
@@ -346,6 +859,35 @@ func GetMaxConcurrency(concurrencyType string) (int, error) {
 	return concurrency, nil
 }
 
+func isAutoConcurrency(concurrencyType string) bool {
+	return strings.EqualFold(strings.TrimSpace(viper.GetString(concurrencyType)), AutoConcurrency)
+}
+
+// resolveAutoConcurrency replaces the AutoConcurrency values by the numbers, so the storages reading the settings
+// by themselves, like the S3 upload concurrency, see the numbers too, and logs the chosen ones.
+// The auto download concurrency sizes the decompression by the CPUs, unless it is set explicitly.
+func resolveAutoConcurrency() {
+	if isAutoConcurrency(DownloadConcurrencySetting) && !viper.IsSet(DecompressionConcurrency) {
+		viper.Set(DecompressionConcurrency, AutoConcurrency)
+	}
+	var chosen []string
+	for _, concurrencyType := range []string{DownloadConcurrencySetting, DecompressionConcurrency,
+		UploadConcurrencySetting, UploadDiskConcurrencySetting, DecryptionWorkersSetting, HostExtractionSlotsSetting} {
+		if !isAutoConcurrency(concurrencyType) {
+			continue
+		}
+		concurrency, err := GetMaxConcurrency(concurrencyType)
+		if err != nil {
+			continue
+		}
+		viper.Set(concurrencyType, strconv.Itoa(concurrency))
+		chosen = append(chosen, fmt.Sprintf("%s=%d", concurrencyType, concurrency))
+	}
+	if len(chosen) > 0 {
+		tracelog.InfoLogger.Printf("Auto concurrency for %d CPUs: %s", runtime.NumCPU(), strings.Join(chosen, ", "))
+	}
+}
+
 func GetSentinelUserData() (interface{}, error) {
 	dataStr, ok := GetSetting(SentinelUserDataSetting)
 	if !ok {
@@ -377,14 +919,19 @@ func GetCommandSettingContext(ctx context.Context, variableName string) (*exec.C
 		tracelog.ErrorLogger.Print(variableName + " expected.")
 		return nil, errors.New(variableName + " not configured")
 	}
+	cmd := exec.CommandContext(ctx, commandShell(), "-c", dataStr)
+	// do not shut up subcommands by default
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// commandShell is the shell running the commands of the settings
+func commandShell() string {
 	shell := os.Getenv("SHELL")
 	if shell == "" {
 		shell = "/bin/sh"
 	}
-	cmd := exec.CommandContext(ctx, shell, "-c", dataStr)
-	// do not shut up subcommands by default
-	cmd.Stderr = os.Stderr
-	return cmd, nil
+	return shell
 }
 
 func GetCommandSetting(variableName string) (*exec.Cmd, error) {
@@ -414,6 +961,20 @@ func GetDurationSetting(setting string) (time.Duration, error) {
 	return interval, nil
 }
 
+// GetPerFileExtractTimeout returns the time one file may take to download and extract, 0 if it's not limited
+func GetPerFileExtractTimeout() (time.Duration, error) {
+	timeoutStr, ok := GetSetting(PerFileExtractTimeout)
+	if !ok {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(timeoutStr)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("non-negative duration expected for %s setting but given '%s'",
+			PerFileExtractTimeout, timeoutStr)
+	}
+	return timeout, nil
+}
+
 func GetOplogPITRDiscoveryIntervalSetting() (*time.Duration, error) {
 	durStr, ok := GetSetting(OplogPITRDiscoveryInterval)
 	if !ok {
@@ -8,26 +8,26 @@ package internal
 // And the configure_crypter_<crypter>.go files must have a real implementation of the function.
 //
 // Thus, if the tag is missing, the condition:
-// if crypter := configure<crypter>Crypter(); crypter != nil {
-//     return crypter
+// if crypter, err := configure<crypter>Crypter(); crypter != nil || err != nil {
+//     return crypter, err
 // }
 // will never be met.
 // If there is a tag, we can configure the correct implementation of crypter.
 
 import (
+	"github.com/pkg/errors"
 	"github.com/spf13/viper"
-	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal/crypto"
 )
 
-func configureLibsodiumCrypter() crypto.Crypter {
+func configureLibsodiumCrypter() (crypto.Crypter, error) {
 	if viper.IsSet(LibsodiumKeySetting) {
-		tracelog.ErrorLogger.Fatalf("non-empty WALG_LIBSODIUM_KEY but wal-g was not compiled with libsodium")
+		return nil, errors.New("non-empty WALG_LIBSODIUM_KEY but wal-g was not compiled with libsodium")
 	}
 
 	if viper.IsSet(LibsodiumKeyPathSetting) {
-		tracelog.ErrorLogger.Fatalf("non-empty WALG_LIBSODIUM_KEY_PATH but wal-g was not compiled with libsodium")
+		return nil, errors.New("non-empty WALG_LIBSODIUM_KEY_PATH but wal-g was not compiled with libsodium")
 	}
 
-	return nil
+	return nil, nil
 }
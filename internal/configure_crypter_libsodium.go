@@ -9,14 +9,14 @@ import (
 	"github.com/wal-g/wal-g/internal/crypto/libsodium"
 )
 
-func configureLibsodiumCrypter() crypto.Crypter {
+func configureLibsodiumCrypter() (crypto.Crypter, error) {
 	if viper.IsSet(LibsodiumKeySetting) {
-		return libsodium.CrypterFromKey(viper.GetString(LibsodiumKeySetting), viper.GetString(LibsodiumKeyTransform))
+		return libsodium.CrypterFromKey(viper.GetString(LibsodiumKeySetting), viper.GetString(LibsodiumKeyTransform)), nil
 	}
 
 	if viper.IsSet(LibsodiumKeyPathSetting) {
-		return libsodium.CrypterFromKeyPath(viper.GetString(LibsodiumKeyPathSetting), viper.GetString(LibsodiumKeyTransform))
+		return libsodium.CrypterFromKeyPath(viper.GetString(LibsodiumKeyPathSetting), viper.GetString(LibsodiumKeyTransform)), nil
 	}
 
-	return nil
+	return nil, nil
 }
@@ -0,0 +1,21 @@
+//go:build !pkcs11
+// +build !pkcs11
+
+package internal
+
+// This file is the stub of the PKCS #11 key holder, as configure_crypter.go is of the libsodium crypter:
+// configure_key_holder_pkcs11.go has the real implementation, which is built with the pkcs11 tag.
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/wal-g/internal/crypto/openpgp"
+)
+
+func configurePkcs11KeyHolder() (openpgp.KeyHolder, error) {
+	if viper.IsSet(PgpPkcs11ModuleSetting) {
+		return nil, errors.New("non-empty WALG_PGP_PKCS11_MODULE but wal-g was not compiled with pkcs11")
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,18 @@
+//go:build pkcs11
+// +build pkcs11
+
+package internal
+
+import (
+	"github.com/spf13/viper"
+	"github.com/wal-g/wal-g/internal/crypto/openpgp"
+)
+
+func configurePkcs11KeyHolder() (openpgp.KeyHolder, error) {
+	if viper.IsSet(PgpPkcs11ModuleSetting) {
+		return openpgp.NewPKCS11KeyHolder(viper.GetString(PgpPkcs11ModuleSetting),
+			viper.GetString(PgpPkcs11TokenLabelSetting), viper.GetString(PgpPkcs11PinSetting)), nil
+	}
+
+	return nil, nil
+}
@@ -1,10 +1,14 @@
 package internal_test
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/wal-g/wal-g/testtools"
@@ -13,6 +17,14 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression/lz4"
+	"github.com/wal-g/wal-g/internal/crypto"
+	"github.com/wal-g/wal-g/internal/limiters"
+	"github.com/wal-g/wal-g/pkg/storages/s3"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/time/rate"
 )
 
 func TestGetMaxConcurrency_InvalidKey(t *testing.T) {
@@ -30,6 +42,14 @@ func TestGetMaxConcurrency_ValidKey(t *testing.T) {
 	resetToDefaults()
 }
 
+func TestConfigureCompressor_defaultLz4(t *testing.T) {
+	resetToDefaults()
+	compressor, err := internal.ConfigureCompressor()
+
+	assert.NoError(t, err)
+	assert.Equal(t, lz4.FileExtension, compressor.FileExtension())
+}
+
 func TestGetMaxConcurrency_ValidKeyAndNegativeValue(t *testing.T) {
 	viper.Set(internal.UploadConcurrencySetting, "-5")
 	_, err := internal.GetMaxConcurrency(internal.UploadConcurrencySetting)
@@ -46,6 +66,64 @@ func TestGetMaxConcurrency_ValidKeyAndInvalidValue(t *testing.T) {
 	resetToDefaults()
 }
 
+func TestGetMaxConcurrency_Auto(t *testing.T) {
+	viper.Set(internal.DownloadConcurrencySetting, "auto")
+	viper.Set(internal.UploadDiskConcurrencySetting, "Auto")
+	download, err := internal.GetMaxConcurrency(internal.DownloadConcurrencySetting)
+	assert.NoError(t, err)
+	uploadDisk, err := internal.GetMaxConcurrency(internal.UploadDiskConcurrencySetting)
+	assert.NoError(t, err)
+
+	assert.Equal(t, runtime.NumCPU(), uploadDisk)
+	assert.Greater(t, download, uploadDisk)
+	resetToDefaults()
+}
+
+func TestGetMaxConcurrency_AutoNotSupported(t *testing.T) {
+	viper.Set(internal.UploadQueueSetting, "auto")
+	_, err := internal.GetMaxConcurrency(internal.UploadQueueSetting)
+
+	assert.Error(t, err)
+	resetToDefaults()
+}
+
+func TestGetRestoreUmask(t *testing.T) {
+	umask, err := internal.GetRestoreUmask()
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0), umask)
+
+	viper.Set(internal.RestoreUmaskSetting, "027")
+	umask, err = internal.GetRestoreUmask()
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0027), umask)
+	resetToDefaults()
+}
+
+func TestGetRestoreUmask_InvalidValue(t *testing.T) {
+	for _, value := range []string{"rwx", "089", "1777"} {
+		viper.Set(internal.RestoreUmaskSetting, value)
+		_, err := internal.GetRestoreUmask()
+		assert.Error(t, err, value)
+	}
+	resetToDefaults()
+}
+
+func TestGetRestoreOverwriteMode(t *testing.T) {
+	mode, err := internal.GetRestoreOverwriteMode()
+	assert.NoError(t, err)
+	assert.Equal(t, internal.OverwriteExistingFiles, mode)
+
+	viper.Set(internal.RestoreOverwriteSetting, "skip")
+	mode, err = internal.GetRestoreOverwriteMode()
+	assert.NoError(t, err)
+	assert.Equal(t, internal.SkipExistingFiles, mode)
+
+	viper.Set(internal.RestoreOverwriteSetting, "replace")
+	_, err = internal.GetRestoreOverwriteMode()
+	assert.Error(t, err)
+	resetToDefaults()
+}
+
 func TestGetSentinelUserData(t *testing.T) {
 	viper.Set(internal.SentinelUserDataSetting, "1.0")
 
@@ -177,3 +255,237 @@ func resetToDefaults() {
 	internal.InitConfig()
 	internal.Configure()
 }
+
+func withCrypterSettings(settings map[string]string, check func()) {
+	for setting, value := range settings {
+		viper.Set(setting, value)
+	}
+	defer func() {
+		for setting := range settings {
+			viper.Set(setting, nil)
+		}
+	}()
+	check()
+}
+
+func TestConfigureCrypter_NotConfigured(t *testing.T) {
+	crypter, err := internal.ConfigureCrypter()
+	assert.NoError(t, err)
+	assert.Nil(t, crypter)
+}
+
+func TestConfigureCrypter_PassphraseWithoutKey(t *testing.T) {
+	withCrypterSettings(map[string]string{internal.PgpKeyPassphraseSetting: "secret"}, func() {
+		_, err := internal.ConfigureCrypter()
+		assert.Error(t, err)
+	})
+}
+
+func TestConfigureCrypter_MissingKeyFile(t *testing.T) {
+	settings := map[string]string{internal.PgpKeyPathSetting: filepath.Join(t.TempDir(), "missing")}
+	withCrypterSettings(settings, func() {
+		_, err := internal.ConfigureCrypter()
+		assert.Error(t, err)
+	})
+}
+
+func TestConfigureDecryptingCrypter_ValidKey(t *testing.T) {
+	withCrypterSettings(map[string]string{internal.PgpKeyPathSetting: PrivateKeyFilePath}, func() {
+		crypter, err := internal.ConfigureDecryptingCrypter()
+		assert.NoError(t, err)
+		assert.NotNil(t, crypter)
+	})
+}
+
+func TestConfigureDecryptingCrypter_PublicKeyOnly(t *testing.T) {
+	keyFile, err := os.Open(PrivateKeyFilePath)
+	assert.NoError(t, err)
+	defer keyFile.Close()
+	entities, err := openpgp.ReadArmoredKeyRing(keyFile)
+	assert.NoError(t, err)
+	entity := entities[0]
+	// only the public half of the key is written
+	keyPath := filepath.Join(t.TempDir(), "public.asc")
+	file, err := os.Create(keyPath)
+	assert.NoError(t, err)
+	writer, err := armor.Encode(file, openpgp.PublicKeyType, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, entity.Serialize(writer))
+	assert.NoError(t, writer.Close())
+	assert.NoError(t, file.Close())
+
+	withCrypterSettings(map[string]string{internal.PgpKeyPathSetting: keyPath}, func() {
+		crypter, err := internal.ConfigureCrypter()
+		assert.NoError(t, err)
+		assert.NotNil(t, crypter)
+
+		_, err = internal.ConfigureDecryptingCrypter()
+		assert.Error(t, err)
+	})
+}
+
+func TestConfigureDecryptingCrypter_encryptsNothing(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "encrypted")
+	withCrypterSettings(map[string]string{
+		internal.EncryptCommandSetting: "touch " + marker + " && cat",
+		internal.DecryptCommandSetting: "cat",
+	}, func() {
+		crypter, err := internal.ConfigureDecryptingCrypter()
+		assert.NoError(t, err)
+		assert.NotNil(t, crypter)
+		assert.NoFileExists(t, marker)
+	})
+}
+
+// the restore host may be configured only to decrypt, check-encryption passes on it unlike crypto check
+func TestConfigureDecryptingCrypter_decryptOnly(t *testing.T) {
+	withCrypterSettings(map[string]string{internal.DecryptCommandSetting: "cat"}, func() {
+		crypter, err := internal.ConfigureDecryptingCrypter()
+		assert.NoError(t, err)
+		assert.NotNil(t, crypter)
+		assert.Error(t, crypto.CheckRoundTrip(crypter))
+	})
+}
+
+func TestConfigureCrypterContext_commandsKilled(t *testing.T) {
+	withCrypterSettings(map[string]string{
+		internal.EncryptCommandSetting: "cat",
+		internal.DecryptCommandSetting: "sleep 60; true",
+	}, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		crypter, err := internal.ConfigureCrypterContext(ctx)
+		assert.NoError(t, err)
+		reader, err := crypter.Decrypt(strings.NewReader("data"))
+		assert.NoError(t, err)
+		cancel()
+		_, err = ioutil.ReadAll(reader)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestConfigureCrypter_keyHolderSettings(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "S.gpg-agent")
+	invalidSettings := []map[string]string{
+		{internal.PgpAgentSocketSetting: socketPath},
+		{internal.PgpKeyPathSetting: PrivateKeyFilePath, internal.PgpAgentSocketSetting: socketPath,
+			internal.PgpPkcs11ModuleSetting: "/usr/lib/libykcs11.so"},
+		{internal.PgpKeyPathSetting: PrivateKeyFilePath, internal.PgpPkcs11PinSetting: "123456"},
+	}
+	for _, settings := range invalidSettings {
+		withCrypterSettings(settings, func() {
+			_, err := internal.ConfigureCrypter()
+			assert.Error(t, err, settings)
+		})
+	}
+
+	withCrypterSettings(map[string]string{internal.PgpKeyPathSetting: PrivateKeyFilePath, internal.PgpAgentSocketSetting: socketPath},
+		func() {
+			crypter, err := internal.ConfigureCrypter()
+			assert.NoError(t, err)
+			assert.NotNil(t, crypter)
+		})
+}
+
+func TestConfigureFolderForSpecificConfig_retries(t *testing.T) {
+	config := viper.New()
+	config.Set("WALG_FILE_PREFIX", t.TempDir())
+	folder, err := internal.ConfigureFolderForSpecificConfig(config)
+	assert.NoError(t, err)
+	_, isRetrying := folder.(*storage.RetryingFolder)
+	assert.False(t, isRetrying)
+
+	config.Set(internal.StorageRetryAttemptsSetting, "3")
+	config.Set(internal.StorageRetryTimeoutSetting, "30s")
+	folder, err = internal.ConfigureFolderForSpecificConfig(config)
+	assert.NoError(t, err)
+	assert.IsType(t, &storage.RetryingFolder{}, folder)
+
+	for _, invalid := range []string{"0", "many"} {
+		config.Set(internal.StorageRetryAttemptsSetting, invalid)
+		_, err = internal.ConfigureFolderForSpecificConfig(config)
+		assert.Error(t, err)
+	}
+	config.Set(internal.StorageRetryAttemptsSetting, "3")
+	config.Set(internal.StorageRetryTimeoutSetting, "soon")
+	_, err = internal.ConfigureFolderForSpecificConfig(config)
+	assert.Error(t, err)
+}
+
+func TestConfigureFolderForSpecificConfig_throttled(t *testing.T) {
+	limiters.StorageLimiter = rate.NewLimiter(10, 10)
+	defer func() {
+		limiters.StorageLimiter = nil
+	}()
+	config := viper.New()
+	config.Set("WALG_FILE_PREFIX", t.TempDir())
+	folder, err := internal.ConfigureFolderForSpecificConfig(config)
+	assert.NoError(t, err)
+	assert.IsType(t, &storage.ThrottlingFolder{}, folder)
+
+	config.Set(internal.StorageRetryAttemptsSetting, "3")
+	folder, err = internal.ConfigureFolderForSpecificConfig(config)
+	assert.NoError(t, err)
+	assert.IsType(t, &storage.ThrottlingFolder{}, folder.(*storage.RetryingFolder).Folder)
+}
+
+func TestConfigureFolderForSpecificConfig_failover(t *testing.T) {
+	primary, replica := t.TempDir(), t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(replica, "replicated"), []byte("replica"), 0600))
+	config := viper.New()
+	config.Set("WALG_FILE_PREFIX", primary)
+	config.Set(internal.FailoverStoragePrefixes, " "+replica+" ,")
+	folder, err := internal.ConfigureFolderForSpecificConfig(config)
+	assert.NoError(t, err)
+	assert.IsType(t, &storage.MultiFolder{}, folder)
+
+	reader, err := folder.ReadObject("replicated")
+	assert.NoError(t, err)
+	data, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "replica", string(data))
+	assert.NoError(t, folder.PutObject("uploaded", strings.NewReader("primary")))
+	_, err = os.Stat(filepath.Join(primary, "uploaded"))
+	assert.NoError(t, err)
+}
+
+func TestConfigureFolderForPrefix(t *testing.T) {
+	directory := t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(directory, "object"), []byte("data"), 0600))
+	for _, prefix := range []string{directory, "file://localhost" + directory} {
+		folder, err := internal.ConfigureFolderForPrefix(prefix)
+		assert.NoError(t, err)
+		exists, err := folder.Exists("object")
+		assert.NoError(t, err)
+		assert.True(t, exists, prefix)
+	}
+
+	for _, setting := range []string{"AWS_REGION", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"} {
+		viper.Set(setting, "test")
+		defer viper.Set(setting, nil)
+	}
+	folder, err := internal.ConfigureFolderForPrefix("s3://bucket/path")
+	assert.NoError(t, err)
+	assert.IsType(t, &s3.Folder{}, folder)
+}
+
+func TestConfigureFolderForPrefixFromFile(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "destination.yaml")
+	assert.NoError(t, ioutil.WriteFile(configFile,
+		[]byte("AWS_REGION: test\nAWS_ACCESS_KEY_ID: other\nAWS_SECRET_ACCESS_KEY: other\n"), 0600))
+	folder, err := internal.ConfigureFolderForPrefixFromFile("s3://bucket/path", configFile)
+	assert.NoError(t, err)
+	assert.IsType(t, &s3.Folder{}, folder)
+
+	_, err = internal.ConfigureFolderForPrefixFromFile("s3://bucket/path", filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestConfigure_resolvesAutoConcurrency(t *testing.T) {
+	viper.Set(internal.DownloadConcurrencySetting, "auto")
+	viper.Set(internal.UploadConcurrencySetting, "auto")
+	internal.Configure()
+
+	assert.Equal(t, strconv.Itoa(4*runtime.NumCPU()), viper.GetString(internal.UploadConcurrencySetting))
+	assert.Equal(t, strconv.Itoa(runtime.NumCPU()), viper.GetString(internal.DecompressionConcurrency))
+	resetToDefaults()
+}
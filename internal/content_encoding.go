@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/compression"
+)
+
+// contentEncodingExtensions maps the HTTP content codings to the extensions of their decompressors
+var contentEncodingExtensions = map[string]string{
+	"gzip":   "gz",
+	"x-gzip": "gz",
+	"br":     "br",
+	"zstd":   "zst",
+}
+
+// decodeContentEncoding undoes the compression applied by the storage on top of the stored file,
+// so it is the outermost layer and goes before the decryption and the file's own decompression.
+// The codings are listed in the order they were applied, so they are decoded from the last one.
+func decodeContentEncoding(reader io.Reader, filePath string, contentEncoding string) (io.ReadCloser, error) {
+	codings := strings.Split(contentEncoding, ",")
+	readCloser := io.NopCloser(reader)
+	for i := len(codings) - 1; i >= 0; i-- {
+		coding := strings.ToLower(strings.TrimSpace(codings[i]))
+		if coding == "" || coding == "identity" {
+			continue
+		}
+		decompressor := compression.FindDecompressor(contentEncodingExtensions[coding])
+		if decompressor == nil {
+			return nil, newUnsupportedFileTypeError(filePath, "Content-Encoding: "+coding)
+		}
+		decoded, err := compression.Decompress(decompressor, readCloser, filePath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode '%s' content encoding of '%s'", coding, filePath)
+		}
+		tracelog.DebugLogger.Printf("Decoding '%s' content encoding of %s", coding, filePath)
+		readCloser = &layeredReadCloser{decoded, readCloser}
+	}
+	return readCloser, nil
+}
+
+// layeredReadCloser closes the reader and then the source it reads from
+type layeredReadCloser struct {
+	io.ReadCloser
+	source io.Closer
+}
+
+func (reader *layeredReadCloser) Close() error {
+	err := reader.ReadCloser.Close()
+	if sourceErr := reader.source.Close(); err == nil {
+		err = sourceErr
+	}
+	return err
+}
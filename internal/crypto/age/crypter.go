@@ -0,0 +1,191 @@
+package age
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/pkg/errors"
+	"github.com/wal-g/wal-g/internal/crypto"
+)
+
+// armorHeader starts the ASCII armored files produced by `age --armor`
+var armorHeader = []byte("-----BEGIN AGE ENCRYPTED FILE-----")
+
+// Crypter encrypts to the X25519 recipients, e.g. generated by age-keygen, and decrypts with the identities file.
+// The passphrase makes it encrypt and decrypt with scrypt instead, age doesn't mix it with the other recipients.
+type Crypter struct {
+	Recipients     []string
+	IdentitiesPath string
+
+	loadPassphrase func() (string, bool)
+
+	recipients []age.Recipient
+	identities []age.Identity
+
+	mutex sync.RWMutex
+}
+
+func (crypter *Crypter) Name() string {
+	return "Age/Crypter"
+}
+
+func (crypter *Crypter) EncryptionFormats() []string {
+	return []string{crypto.AgeFormat}
+}
+
+// CrypterFromRecipients creates Crypter which encrypts to the recipients and decrypts with the identities file,
+// any of them may be empty if the crypter is used only for one direction
+func CrypterFromRecipients(recipients []string, identitiesPath string,
+	loadPassphrase func() (string, bool)) crypto.Crypter {
+	return &Crypter{Recipients: recipients, IdentitiesPath: identitiesPath, loadPassphrase: loadPassphrase}
+}
+
+// ParseRecipients splits the list of recipients separated by commas or whitespace
+func ParseRecipients(list string) []string {
+	return strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+}
+
+func (crypter *Crypter) passphrase() (string, bool) {
+	if crypter.loadPassphrase == nil {
+		return "", false
+	}
+	return crypter.loadPassphrase()
+}
+
+// LoadKeys parses the recipients and reads the identities file, if they are set
+func (crypter *Crypter) LoadKeys() error {
+	_, hasPassphrase := crypter.passphrase()
+	if len(crypter.Recipients) > 0 || hasPassphrase {
+		if err := crypter.setupRecipients(); err != nil {
+			return err
+		}
+	}
+	if crypter.IdentitiesPath != "" || hasPassphrase {
+		return crypter.setupIdentities()
+	}
+	return nil
+}
+
+// LoadDecryptionKeys reads the identities, the crypter without them can't decrypt
+func (crypter *Crypter) LoadDecryptionKeys() error {
+	if _, hasPassphrase := crypter.passphrase(); crypter.IdentitiesPath == "" && !hasPassphrase {
+		return errors.New("age Crypter: neither the identities nor the passphrase is set")
+	}
+	return crypter.setupIdentities()
+}
+
+func (crypter *Crypter) setupRecipients() error {
+	crypter.mutex.RLock()
+	if crypter.recipients != nil {
+		crypter.mutex.RUnlock()
+		return nil
+	}
+	crypter.mutex.RUnlock()
+
+	crypter.mutex.Lock()
+	defer crypter.mutex.Unlock()
+	if crypter.recipients != nil {
+		return nil
+	}
+
+	if passphrase, ok := crypter.passphrase(); ok {
+		if len(crypter.Recipients) > 0 {
+			return errors.New("age Crypter: passphrase can't be combined with recipients")
+		}
+		recipient, err := age.NewScryptRecipient(passphrase)
+		if err != nil {
+			return errors.Wrap(err, "age Crypter: invalid passphrase")
+		}
+		crypter.recipients = []age.Recipient{recipient}
+		return nil
+	}
+
+	if len(crypter.Recipients) == 0 {
+		return errors.New("age Crypter: no recipients to encrypt to")
+	}
+	recipients := make([]age.Recipient, 0, len(crypter.Recipients))
+	for _, recipientString := range crypter.Recipients {
+		recipient, err := age.ParseX25519Recipient(recipientString)
+		if err != nil {
+			return errors.Wrapf(err, "age Crypter: invalid recipient '%s'", recipientString)
+		}
+		recipients = append(recipients, recipient)
+	}
+	crypter.recipients = recipients
+	return nil
+}
+
+func (crypter *Crypter) setupIdentities() error {
+	crypter.mutex.RLock()
+	if crypter.identities != nil {
+		crypter.mutex.RUnlock()
+		return nil
+	}
+	crypter.mutex.RUnlock()
+
+	crypter.mutex.Lock()
+	defer crypter.mutex.Unlock()
+	if crypter.identities != nil {
+		return nil
+	}
+
+	identities := make([]age.Identity, 0)
+	if passphrase, ok := crypter.passphrase(); ok {
+		identity, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return errors.Wrap(err, "age Crypter: invalid passphrase")
+		}
+		identities = append(identities, identity)
+	}
+	if crypter.IdentitiesPath != "" {
+		file, err := os.Open(crypter.IdentitiesPath)
+		if err != nil {
+			return errors.Wrap(err, "age Crypter: unable to read identities")
+		}
+		defer file.Close()
+		parsed, err := age.ParseIdentities(file)
+		if err != nil {
+			return errors.Wrapf(err, "age Crypter: failed to parse identities from '%s'", crypter.IdentitiesPath)
+		}
+		identities = append(identities, parsed...)
+	}
+	if len(identities) == 0 {
+		return errors.New("age Crypter: no identities to decrypt with")
+	}
+	crypter.identities = identities
+	return nil
+}
+
+// Encrypt creates encryption writer from ordinary writer, closing it doesn't close the writer
+func (crypter *Crypter) Encrypt(writer io.Writer) (io.WriteCloser, error) {
+	if err := crypter.setupRecipients(); err != nil {
+		return nil, err
+	}
+	return age.Encrypt(writer, crypter.recipients...)
+}
+
+// Decrypt creates decrypted reader from ordinary reader, both binary and ASCII armored files are accepted.
+// Only the header is read here, the payload is decrypted chunk by chunk while reading.
+func (crypter *Crypter) Decrypt(reader io.Reader) (io.Reader, error) {
+	if err := crypter.setupIdentities(); err != nil {
+		return nil, err
+	}
+	bufferedReader := bufio.NewReader(reader)
+	header, err := bufferedReader.Peek(len(armorHeader))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	reader = bufferedReader
+	if bytes.Equal(header, armorHeader) {
+		reader = armor.NewReader(bufferedReader)
+	}
+	return age.Decrypt(reader, crypter.identities...)
+}
@@ -0,0 +1,115 @@
+package age
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal/crypto"
+)
+
+const someSecret = "so very secret thingy"
+
+func generateIdentity(t *testing.T) (*age.X25519Identity, string) {
+	identity, err := age.GenerateX25519Identity()
+	assert.NoError(t, err)
+	identitiesPath := filepath.Join(t.TempDir(), "identities.txt")
+	content := "# created by age-keygen\n" + identity.String() + "\n"
+	assert.NoError(t, ioutil.WriteFile(identitiesPath, []byte(content), 0600))
+	return identity, identitiesPath
+}
+
+func encrypt(t *testing.T, crypter crypto.Crypter, data string) []byte {
+	var buf bytes.Buffer
+	writer, err := crypter.Encrypt(&buf)
+	assert.NoError(t, err)
+	_, err = writer.Write([]byte(data))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func decrypt(crypter crypto.Crypter, encrypted io.Reader) (string, error) {
+	reader, err := crypter.Decrypt(encrypted)
+	if err != nil {
+		return "", err
+	}
+	decrypted, err := ioutil.ReadAll(reader)
+	return string(decrypted), err
+}
+
+func TestEncryptionCycle(t *testing.T) {
+	identity, identitiesPath := generateIdentity(t)
+	other, _ := generateIdentity(t)
+	crypter := CrypterFromRecipients([]string{other.Recipient().String(), identity.Recipient().String()},
+		identitiesPath, nil)
+
+	encrypted := encrypt(t, crypter, someSecret)
+	assert.Equal(t, crypto.AgeFormat, crypto.DetectEncryption(encrypted))
+
+	decrypted, err := decrypt(crypter, bytes.NewReader(encrypted))
+	assert.NoError(t, err)
+	assert.Equal(t, someSecret, decrypted)
+}
+
+func TestDecryptArmored(t *testing.T) {
+	identity, identitiesPath := generateIdentity(t)
+
+	var buf bytes.Buffer
+	armorWriter := armor.NewWriter(&buf)
+	writer, err := age.Encrypt(armorWriter, identity.Recipient())
+	assert.NoError(t, err)
+	_, err = writer.Write([]byte(someSecret))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	assert.NoError(t, armorWriter.Close())
+
+	decrypted, err := decrypt(CrypterFromRecipients(nil, identitiesPath, nil), &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, someSecret, decrypted)
+}
+
+func TestPassphrase(t *testing.T) {
+	loadPassphrase := func() (string, bool) {
+		return "correct horse battery staple", true
+	}
+	crypter := CrypterFromRecipients(nil, "", loadPassphrase)
+
+	decrypted, err := decrypt(crypter, bytes.NewReader(encrypt(t, crypter, someSecret)))
+	assert.NoError(t, err)
+	assert.Equal(t, someSecret, decrypted)
+
+	other, _ := generateIdentity(t)
+	_, err = CrypterFromRecipients([]string{other.Recipient().String()}, "", loadPassphrase).Encrypt(&bytes.Buffer{})
+	assert.Error(t, err)
+}
+
+func TestWrongIdentity(t *testing.T) {
+	identity, _ := generateIdentity(t)
+	_, otherIdentitiesPath := generateIdentity(t)
+
+	encrypted := encrypt(t, CrypterFromRecipients([]string{identity.Recipient().String()}, "", nil), someSecret)
+	_, err := decrypt(CrypterFromRecipients(nil, otherIdentitiesPath, nil), bytes.NewReader(encrypted))
+	assert.Error(t, err)
+}
+
+func TestMissingKeys(t *testing.T) {
+	crypter := CrypterFromRecipients(nil, "", nil)
+	_, err := crypter.Encrypt(&bytes.Buffer{})
+	assert.Error(t, err)
+	_, err = crypter.Decrypt(&bytes.Buffer{})
+	assert.Error(t, err)
+
+	_, err = CrypterFromRecipients([]string{"age1invalid"}, "", nil).Encrypt(&bytes.Buffer{})
+	assert.Error(t, err)
+}
+
+func TestParseRecipients(t *testing.T) {
+	assert.Equal(t, []string{"age1a", "age1b", "age1c"}, ParseRecipients(" age1a,age1b\nage1c "))
+	assert.Empty(t, ParseRecipients(""))
+}
@@ -1,13 +1,9 @@
 package awskms
 
 import (
-	"bufio"
 	"io"
 
-	"github.com/minio/sio"
-	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal/crypto"
-	"github.com/wal-g/wal-g/internal/ioextensions"
 )
 
 // Crypter is AWS KMS Crypter implementation
@@ -21,45 +17,12 @@ func (crypter *Crypter) Name() string {
 
 // Encrypt creates encryption writer from ordinary writer
 func (crypter *Crypter) Encrypt(writer io.Writer) (io.WriteCloser, error) {
-	if len(crypter.SymmetricKey.GetKey()) == 0 {
-		err := crypter.SymmetricKey.Generate()
-		tracelog.ErrorLogger.FatalfOnError("Can't generate symmetric key: %v", err)
-
-		err = crypter.SymmetricKey.Encrypt()
-		tracelog.ErrorLogger.FatalfOnError("Can't encrypt symmetric key: %v", err)
-	}
-
-	bufferedWriter := bufio.NewWriter(writer)
-	_, err := bufferedWriter.Write(crypter.SymmetricKey.GetEncryptedKey())
-
-	if err != nil {
-		tracelog.ErrorLogger.Printf("Can't write encryption key to buffer: %v", err)
-		return nil, err
-	}
-
-	encryptedWriter, err := sio.EncryptWriter(bufferedWriter, sio.Config{Key: crypter.SymmetricKey.GetKey()})
-
-	if err != nil {
-		tracelog.ErrorLogger.Printf("AWS KMS can't create encrypted writer: %v", err)
-		return nil, err
-	}
-
-	return ioextensions.NewOnCloseFlusher(encryptedWriter, bufferedWriter), nil
+	return crypto.EncryptEnvelope(writer, crypter.SymmetricKey)
 }
 
 // Decrypt creates decrypted reader from ordinary reader
 func (crypter *Crypter) Decrypt(reader io.Reader) (io.Reader, error) {
-	encryptedSymmetricKey := make([]byte, crypter.SymmetricKey.GetEncryptedKeyLen())
-	_, err := reader.Read(encryptedSymmetricKey)
-	tracelog.ErrorLogger.FatalfOnError("Can't read encryption key from archive file header: %v", err)
-
-	err = crypter.SymmetricKey.SetEncryptedKey(encryptedSymmetricKey)
-	tracelog.ErrorLogger.FatalfOnError("Can't set encrypted key: %v", err)
-
-	err = crypter.SymmetricKey.Decrypt()
-	tracelog.ErrorLogger.FatalfOnError("Can't decrypt symmetric key: %v", err)
-
-	return sio.DecryptReader(reader, sio.Config{Key: crypter.SymmetricKey.GetKey()})
+	return crypto.DecryptEnvelope(reader, crypter.SymmetricKey)
 }
 
 // CrypterFromKeyID creates AWS KMS Crypter with given KMS Key ID
@@ -0,0 +1,63 @@
+package crypto
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+)
+
+// checkPayload is encrypted and decrypted by CheckRoundTrip, it's long enough for the block and stream ciphers
+var checkPayload = bytes.Repeat([]byte("WAL-G crypter check payload\n"), 1024)
+
+type CheckFailedError struct {
+	error
+	// Stage is "encrypt" or "decrypt"
+	Stage string
+}
+
+func newCheckFailedError(stage string, err error) CheckFailedError {
+	return CheckFailedError{errors.Wrapf(err, "%s failed", stage), stage}
+}
+
+func (err CheckFailedError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// CheckRoundTrip encrypts and decrypts the test payload to check that the keys of the crypter are loadable
+// and match each other, so the misconfigured crypter is found before the restore
+func CheckRoundTrip(crypter Crypter) error {
+	encrypted := new(bytes.Buffer)
+	writer, err := crypter.Encrypt(encrypted)
+	if err != nil {
+		return newCheckFailedError("encrypt", err)
+	}
+	_, err = writer.Write(checkPayload)
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return newCheckFailedError("encrypt", err)
+	}
+	if bytes.Contains(encrypted.Bytes(), checkPayload[:64]) {
+		return newCheckFailedError("encrypt", errors.New("the encrypted data contains the plaintext"))
+	}
+
+	reader, err := crypter.Decrypt(encrypted)
+	if err != nil {
+		return newCheckFailedError("decrypt", err)
+	}
+	decrypted, err := ioutil.ReadAll(reader)
+	if closeErr := CloseDecrypted(reader); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return newCheckFailedError("decrypt", err)
+	}
+	if !bytes.Equal(decrypted, checkPayload) {
+		return newCheckFailedError("decrypt", errors.New("the decrypted data differs from the encrypted one"))
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package crypto_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal/crypto"
+)
+
+// xorCrypter xors the data with the key, the data decrypted with another key is garbage
+type xorCrypter struct {
+	encryptKey byte
+	decryptKey byte
+}
+
+func (crypter xorCrypter) Name() string {
+	return "xor"
+}
+
+func (crypter xorCrypter) Encrypt(writer io.Writer) (io.WriteCloser, error) {
+	return nopWriteCloser{xorWriter{writer, crypter.encryptKey}}, nil
+}
+
+func (crypter xorCrypter) Decrypt(reader io.Reader) (io.Reader, error) {
+	return xorReader{reader, crypter.decryptKey}, nil
+}
+
+type xorWriter struct {
+	io.Writer
+	key byte
+}
+
+func (writer xorWriter) Write(p []byte) (int, error) {
+	xored := make([]byte, len(p))
+	for i := range p {
+		xored[i] = p[i] ^ writer.key
+	}
+	return writer.Writer.Write(xored)
+}
+
+type xorReader struct {
+	io.Reader
+	key byte
+}
+
+func (reader xorReader) Read(p []byte) (int, error) {
+	n, err := reader.Reader.Read(p)
+	for i := 0; i < n; i++ {
+		p[i] ^= reader.key
+	}
+	return n, err
+}
+
+func TestCheckRoundTrip(t *testing.T) {
+	assert.NoError(t, crypto.CheckRoundTrip(xorCrypter{0x5a, 0x5a}))
+
+	var checkErr crypto.CheckFailedError
+	err := crypto.CheckRoundTrip(xorCrypter{0x5a, 0x33})
+	assert.True(t, errors.As(err, &checkErr))
+	assert.Equal(t, "decrypt", checkErr.Stage)
+
+	// the crypter which doesn't encrypt at all
+	err = crypto.CheckRoundTrip(xorCrypter{0, 0})
+	assert.True(t, errors.As(err, &checkErr))
+	assert.Equal(t, "encrypt", checkErr.Stage)
+
+	err = crypto.CheckRoundTrip(prefixCrypter{"prefix"})
+	assert.True(t, errors.As(err, &checkErr))
+}
@@ -0,0 +1,268 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/crypto"
+)
+
+const (
+	// stderrTailLength is how much of the command stderr the error keeps
+	stderrTailLength = 4096
+	// closeDrainLength is how much of the unread output Close reads to get the exit status of the command,
+	// e.g. the decompressors stop before the padding of the stream
+	closeDrainLength = 64 * 1024
+)
+
+type FailedError struct {
+	error
+	Stderr string
+}
+
+func newFailedError(command string, err error, stderr string) FailedError {
+	return FailedError{
+		errors.Errorf("the command '%s' failed: %v, stderr: '%s'", command, err, stderr),
+		stderr,
+	}
+}
+
+func (err FailedError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+type NotConfiguredError struct {
+	error
+}
+
+func newNotConfiguredError(operation string) NotConfiguredError {
+	return NotConfiguredError{errors.Errorf("the %s command is not configured", operation)}
+}
+
+func (err NotConfiguredError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// Crypter pipes the data through the external programs, which read the input from stdin
+// and write the result to stdout. The program runs while its stream is written or read, so the number
+// of the programs is limited by the upload and download concurrency of the streams.
+// The programs are killed when the context is done.
+type Crypter struct {
+	ctx            context.Context
+	shell          string
+	encryptCommand string
+	decryptCommand string
+}
+
+// CrypterFromCommands creates the Crypter of the commands run by the shell, either of them can be empty
+// if only the other direction is used, e.g. the decryption of the restore host
+func CrypterFromCommands(ctx context.Context, shell, encryptCommand, decryptCommand string) crypto.Crypter {
+	return &Crypter{ctx: ctx, shell: shell, encryptCommand: encryptCommand, decryptCommand: decryptCommand}
+}
+
+func (crypter *Crypter) Name() string {
+	return "Command/Crypter"
+}
+
+// Encrypt starts the encryption command which writes to the writer,
+// Close of the returned writer waits for the command to exit
+func (crypter *Crypter) Encrypt(writer io.Writer) (io.WriteCloser, error) {
+	if crypter.encryptCommand == "" {
+		return nil, newNotConfiguredError("encryption")
+	}
+	process := crypter.newProcess(crypter.encryptCommand)
+	process.cmd.Stdout = writer
+	stdin, err := process.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = process.start(); err != nil {
+		return nil, err
+	}
+	return &commandWriter{process: process, stdin: stdin}, nil
+}
+
+// DecryptsLazily is true, since the command is started before its input is read
+func (crypter *Crypter) DecryptsLazily() bool {
+	return true
+}
+
+// Decrypt starts the decryption command which reads the reader, the command exit status is checked
+// at the end of the returned reader. The reader implements io.Closer, which kills the unfinished command.
+func (crypter *Crypter) Decrypt(reader io.Reader) (io.Reader, error) {
+	if crypter.decryptCommand == "" {
+		return nil, newNotConfiguredError("decryption")
+	}
+	process := crypter.newProcess(crypter.decryptCommand)
+	process.cmd.Stdin = reader
+	stdout, err := process.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = process.start(); err != nil {
+		return nil, err
+	}
+	return &commandReader{process: process, stdout: stdout}, nil
+}
+
+func (crypter *Crypter) newProcess(command string) *process {
+	process := &process{
+		ctx:     crypter.ctx,
+		command: command,
+		cmd:     exec.Command(crypter.shell, "-c", command),
+		stderr:  &tailBuffer{limit: stderrTailLength},
+		exited:  make(chan struct{}),
+	}
+	process.cmd.Stderr = process.stderr
+	setProcessGroup(process.cmd)
+	return process
+}
+
+type process struct {
+	ctx     context.Context
+	command string
+	cmd     *exec.Cmd
+	stderr  *tailBuffer
+
+	exited   chan struct{}
+	waitOnce sync.Once
+	err      error
+}
+
+func (process *process) start() error {
+	if err := process.cmd.Start(); err != nil {
+		return errors.Wrapf(err, "failed to start the command '%s'", process.command)
+	}
+	go func() {
+		select {
+		case <-process.ctx.Done():
+			process.kill()
+		case <-process.exited:
+		}
+	}()
+	return nil
+}
+
+func (process *process) kill() {
+	select {
+	case <-process.exited:
+		// the process group is gone, its ID may be reused
+		return
+	default:
+	}
+	if err := killProcess(process.cmd); err != nil {
+		tracelog.WarningLogger.Printf("Failed to kill the command '%s': %v", process.command, err)
+	}
+}
+
+// wait reaps the process once, the later calls return the same result
+func (process *process) wait() error {
+	process.waitOnce.Do(func() {
+		err := process.cmd.Wait()
+		close(process.exited)
+		if ctxErr := process.ctx.Err(); ctxErr != nil {
+			process.err = errors.Wrapf(ctxErr, "the command '%s' is killed", process.command)
+		} else if err != nil {
+			process.err = newFailedError(process.command, err, strings.TrimSpace(process.stderr.String()))
+		}
+	})
+	return process.err
+}
+
+type commandWriter struct {
+	process *process
+	stdin   io.WriteCloser
+}
+
+func (writer *commandWriter) Write(p []byte) (int, error) {
+	n, err := writer.stdin.Write(p)
+	if err != nil {
+		// the command has exited, its status explains why better than the broken pipe
+		_ = writer.stdin.Close()
+		if waitErr := writer.process.wait(); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+func (writer *commandWriter) Close() error {
+	err := writer.stdin.Close()
+	if waitErr := writer.process.wait(); waitErr != nil {
+		return waitErr
+	}
+	return err
+}
+
+type commandReader struct {
+	process *process
+	stdout  io.Reader
+
+	mutex    sync.Mutex
+	finished bool
+}
+
+func (reader *commandReader) Read(p []byte) (int, error) {
+	n, err := reader.stdout.Read(p)
+	if err == io.EOF {
+		reader.mutex.Lock()
+		reader.finished = true
+		reader.mutex.Unlock()
+		if waitErr := reader.process.wait(); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// Close returns the exit status of the command, the command which still has more output to read is killed
+func (reader *commandReader) Close() error {
+	if !reader.isFinished() {
+		_, err := io.Copy(ioutil.Discard, io.LimitReader(reader, closeDrainLength))
+		if !reader.isFinished() {
+			reader.process.kill()
+			_ = reader.process.wait()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return reader.process.wait()
+}
+
+func (reader *commandReader) isFinished() bool {
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+	return reader.finished
+}
+
+// tailBuffer keeps the last bytes written to it
+type tailBuffer struct {
+	mutex sync.Mutex
+	limit int
+	data  []byte
+}
+
+func (buffer *tailBuffer) Write(p []byte) (int, error) {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	buffer.data = append(buffer.data, p...)
+	if len(buffer.data) > buffer.limit {
+		buffer.data = buffer.data[len(buffer.data)-buffer.limit:]
+	}
+	return len(p), nil
+}
+
+func (buffer *tailBuffer) String() string {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	return string(buffer.data)
+}
@@ -0,0 +1,89 @@
+package command_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/crypto"
+	"github.com/wal-g/wal-g/internal/crypto/command"
+)
+
+func TestCrypter_roundTrip(t *testing.T) {
+	crypter := command.CrypterFromCommands(context.Background(), "/bin/sh", "tr a-z n-za-m", "tr n-za-m a-z")
+	plaintext := strings.Repeat("the quick brown fox jumps over the lazy dog\n", 10000)
+
+	encrypted := new(bytes.Buffer)
+	writer, err := crypter.Encrypt(encrypted)
+	require.NoError(t, err)
+	_, err = io.Copy(writer, strings.NewReader(plaintext))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	assert.True(t, strings.HasPrefix(encrypted.String(), "gur dhvpx"))
+
+	decrypted, err := crypter.Decrypt(encrypted)
+	require.NoError(t, err)
+	result, err := ioutil.ReadAll(decrypted)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, string(result))
+	assert.NoError(t, crypto.CloseDecrypted(decrypted))
+}
+
+func TestCrypter_failedCommand(t *testing.T) {
+	crypter := command.CrypterFromCommands(context.Background(), "/bin/sh",
+		"cat >/dev/null; echo 'appliance is offline' >&2; exit 3", "head -c 4; echo 'wrong key' >&2; exit 1")
+
+	writer, err := crypter.Encrypt(ioutil.Discard)
+	require.NoError(t, err)
+	_, _ = writer.Write([]byte("data"))
+	err = writer.Close()
+	var failedErr command.FailedError
+	require.True(t, errors.As(err, &failedErr), "unexpected error: %v", err)
+	assert.Equal(t, "appliance is offline", failedErr.Stderr)
+
+	decrypted, err := crypter.Decrypt(strings.NewReader("ciphertext"))
+	require.NoError(t, err)
+	result, err := ioutil.ReadAll(decrypted)
+	assert.Equal(t, "ciph", string(result))
+	require.True(t, errors.As(err, &failedErr), "unexpected error: %v", err)
+	assert.Equal(t, "wrong key", failedErr.Stderr)
+}
+
+func TestCrypter_exitStatusOnClose(t *testing.T) {
+	crypter := command.CrypterFromCommands(context.Background(), "/bin/sh", "", "cat; exit 2")
+
+	decrypted, err := crypter.Decrypt(strings.NewReader("tar archive and its padding"))
+	require.NoError(t, err)
+	// the consumer stops before the end of the output, like the decompressor before the padding
+	_, err = io.ReadFull(decrypted, make([]byte, 3))
+	require.NoError(t, err)
+	var failedErr command.FailedError
+	assert.True(t, errors.As(crypto.CloseDecrypted(decrypted), &failedErr))
+}
+
+func TestCrypter_notConfigured(t *testing.T) {
+	crypter := command.CrypterFromCommands(context.Background(), "/bin/sh", "", "cat")
+	_, err := crypter.Encrypt(ioutil.Discard)
+	assert.IsType(t, command.NotConfiguredError{}, err)
+}
+
+func TestCrypter_contextCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	// sleep is not the last command, so it runs in a child process of the shell, which must be killed too
+	crypter := command.CrypterFromCommands(ctx, "/bin/sh", "", "sleep 60; true")
+
+	decrypted, err := crypter.Decrypt(strings.NewReader("ciphertext"))
+	require.NoError(t, err)
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	_, err = ioutil.ReadAll(decrypted)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), 30*time.Second)
+}
@@ -8,3 +8,66 @@ type Crypter interface {
 	Encrypt(writer io.Writer) (io.WriteCloser, error)
 	Decrypt(reader io.Reader) (io.Reader, error)
 }
+
+// KeyLoader is implemented by the crypters which load their keys on the first use,
+// LoadKeys loads them beforehand to report the missing or invalid keys before any data is processed
+type KeyLoader interface {
+	LoadKeys() error
+}
+
+// LoadKeys loads the keys of the crypter if it's a KeyLoader
+func LoadKeys(crypter Crypter) error {
+	if keyLoader, ok := crypter.(KeyLoader); ok {
+		return keyLoader.LoadKeys()
+	}
+	return nil
+}
+
+// DecryptionKeyLoader is implemented by the crypters holding the keys needed only for the decryption,
+// LoadDecryptionKeys loads and unlocks them without decrypting anything
+type DecryptionKeyLoader interface {
+	LoadDecryptionKeys() error
+}
+
+// LoadDecryptionKeys loads the decryption keys of the crypter if it's a DecryptionKeyLoader
+func LoadDecryptionKeys(crypter Crypter) error {
+	if keyLoader, ok := crypter.(DecryptionKeyLoader); ok {
+		return keyLoader.LoadDecryptionKeys()
+	}
+	return nil
+}
+
+// FormatCrypter is implemented by the crypters whose output always starts with the header
+// recognized by DetectEncryption, e.g. OpenPGP and age
+type FormatCrypter interface {
+	EncryptionFormats() []string
+}
+
+// EncryptionFormats returns the formats of the headers the data decrypted by the crypter starts with,
+// or nothing if it may have no recognizable header, e.g. the libsodium or KMS encrypted data
+func EncryptionFormats(crypter Crypter) []string {
+	if formatCrypter, ok := crypter.(FormatCrypter); ok {
+		return formatCrypter.EncryptionFormats()
+	}
+	return nil
+}
+
+// LazyDecrypter is implemented by the crypters whose Decrypt may return before the stream is read,
+// e.g. the command one, so its success doesn't tell that the key fits the stream
+type LazyDecrypter interface {
+	DecryptsLazily() bool
+}
+
+func decryptsLazily(crypter Crypter) bool {
+	lazyDecrypter, ok := crypter.(LazyDecrypter)
+	return ok && lazyDecrypter.DecryptsLazily()
+}
+
+// CloseDecrypted releases the decrypted reader which holds the resources, e.g. the decryption process,
+// the reader not read to the end must be closed
+func CloseDecrypted(reader io.Reader) error {
+	if closer, ok := reader.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
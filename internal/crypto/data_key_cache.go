@@ -0,0 +1,122 @@
+package crypto
+
+import (
+	"container/list"
+	"expvar"
+	"sync"
+)
+
+// DataKeyCacheSize bounds the number of the unwrapped data keys kept by the process.
+// Every process uploading with the KMS crypter generates its own data key, so a restore meets
+// about as many distinct keys as the uploading processes, e.g. one per wal-push.
+const DataKeyCacheSize = 4096
+
+// DefaultDataKeyCache is the process-wide cache of the data keys unwrapped by the KMS crypters,
+// it is shared by the goroutines decrypting the files concurrently
+var DefaultDataKeyCache = NewDataKeyCache(DataKeyCacheSize)
+
+func init() {
+	expvar.Publish("walg_data_key_cache", expvar.Func(func() interface{} {
+		hits, misses := DefaultDataKeyCache.Stats()
+		return map[string]int64{"hits": hits, "misses": misses}
+	}))
+}
+
+// DataKeyCache maps the wrapped data keys, as they are stored in the encrypted files, to the unwrapped ones,
+// so the remote key management service decrypts every data key once. The least recently used keys
+// are evicted beyond the capacity. The evicted keys are zeroized, and all the keys are zeroized by Zeroize.
+type DataKeyCache struct {
+	capacity int
+
+	mutex  sync.Mutex
+	keys   map[string]*list.Element
+	recent *list.List
+	hits   int64
+	misses int64
+
+	// unwrapMutex serializes the unwrapping of the missing keys, the crypters unwrap the key
+	// in their shared state, and the goroutines missing the same key wait for the first one to unwrap it
+	unwrapMutex sync.Mutex
+}
+
+type dataKeyEntry struct {
+	wrappedKey string
+	key        []byte
+}
+
+func NewDataKeyCache(capacity int) *DataKeyCache {
+	return &DataKeyCache{capacity: capacity, keys: make(map[string]*list.Element), recent: list.New()}
+}
+
+// Unwrap returns the cached data key of the wrapped key, or unwraps it by unwrap and caches it.
+// The returned key is owned by the cache and must not be modified.
+func (cache *DataKeyCache) Unwrap(wrappedKey []byte, unwrap func() ([]byte, error)) ([]byte, error) {
+	if key, ok := cache.get(wrappedKey, true); ok {
+		return key, nil
+	}
+
+	cache.unwrapMutex.Lock()
+	defer cache.unwrapMutex.Unlock()
+	// the key could be unwrapped while this goroutine waited for the lock
+	if key, ok := cache.get(wrappedKey, false); ok {
+		return key, nil
+	}
+	key, err := unwrap()
+	if err != nil {
+		return nil, err
+	}
+	cache.put(wrappedKey, key)
+	return key, nil
+}
+
+func (cache *DataKeyCache) get(wrappedKey []byte, countMiss bool) ([]byte, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	element, ok := cache.keys[string(wrappedKey)]
+	if !ok {
+		if countMiss {
+			cache.misses++
+		}
+		return nil, false
+	}
+	cache.hits++
+	cache.recent.MoveToFront(element)
+	return element.Value.(*dataKeyEntry).key, true
+}
+
+func (cache *DataKeyCache) put(wrappedKey []byte, key []byte) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.keys[string(wrappedKey)] = cache.recent.PushFront(&dataKeyEntry{string(wrappedKey), key})
+	for cache.recent.Len() > cache.capacity {
+		cache.remove(cache.recent.Back())
+	}
+}
+
+func (cache *DataKeyCache) remove(element *list.Element) {
+	entry := cache.recent.Remove(element).(*dataKeyEntry)
+	delete(cache.keys, entry.wrappedKey)
+	zeroize(entry.key)
+}
+
+// Stats returns the number of the cache hits and misses, the misses are the remote unwrap calls
+func (cache *DataKeyCache) Stats() (hits int64, misses int64) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return cache.hits, cache.misses
+}
+
+// Zeroize overwrites and drops all the cached keys, e.g. when the restore is finished
+func (cache *DataKeyCache) Zeroize() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	for cache.recent.Len() > 0 {
+		cache.remove(cache.recent.Back())
+	}
+}
+
+func zeroize(key []byte) {
+	for i := range key {
+		key[i] = 0
+	}
+}
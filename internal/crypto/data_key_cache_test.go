@@ -0,0 +1,90 @@
+package crypto_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/crypto"
+)
+
+func unwrapCounting(calls *int32, key []byte) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		atomic.AddInt32(calls, 1)
+		return append([]byte(nil), key...), nil
+	}
+}
+
+func TestDataKeyCache_unwrapsOncePerKey(t *testing.T) {
+	cache := crypto.NewDataKeyCache(4)
+	var calls int32
+	for i := 0; i < 3; i++ {
+		key, err := cache.Unwrap([]byte("wrapped"), unwrapCounting(&calls, []byte("key")))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("key"), key)
+	}
+	assert.Equal(t, int32(1), calls)
+	hits, misses := cache.Stats()
+	assert.Equal(t, int64(2), hits)
+	assert.Equal(t, int64(1), misses)
+}
+
+func TestDataKeyCache_doesNotCacheErrors(t *testing.T) {
+	cache := crypto.NewDataKeyCache(4)
+	_, err := cache.Unwrap([]byte("wrapped"), func() ([]byte, error) { return nil, errors.New("kms is down") })
+	assert.Error(t, err)
+
+	var calls int32
+	key, err := cache.Unwrap([]byte("wrapped"), unwrapCounting(&calls, []byte("key")))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("key"), key)
+	assert.Equal(t, int32(1), calls)
+}
+
+func TestDataKeyCache_evictsLeastRecentlyUsed(t *testing.T) {
+	cache := crypto.NewDataKeyCache(2)
+	var calls int32
+	first, _ := cache.Unwrap([]byte("first"), unwrapCounting(&calls, []byte("key1")))
+	_, _ = cache.Unwrap([]byte("second"), unwrapCounting(&calls, []byte("key2")))
+	_, _ = cache.Unwrap([]byte("second"), unwrapCounting(&calls, []byte("key2")))
+	_, _ = cache.Unwrap([]byte("third"), unwrapCounting(&calls, []byte("key3")))
+	assert.Equal(t, []byte{0, 0, 0, 0}, first)
+
+	_, _ = cache.Unwrap([]byte("second"), unwrapCounting(&calls, []byte("key2")))
+	assert.Equal(t, int32(3), calls)
+	_, _ = cache.Unwrap([]byte("first"), unwrapCounting(&calls, []byte("key1")))
+	assert.Equal(t, int32(4), calls)
+}
+
+func TestDataKeyCache_concurrentUnwrap(t *testing.T) {
+	cache := crypto.NewDataKeyCache(16)
+	var calls int32
+	var wg sync.WaitGroup
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			wrapped := fmt.Sprintf("wrapped%d", i%4)
+			key, err := cache.Unwrap([]byte(wrapped), unwrapCounting(&calls, []byte(wrapped+"key")))
+			assert.NoError(t, err)
+			assert.Equal(t, []byte(wrapped+"key"), key)
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(4), calls)
+}
+
+func TestDataKeyCache_Zeroize(t *testing.T) {
+	cache := crypto.NewDataKeyCache(4)
+	var calls int32
+	key, _ := cache.Unwrap([]byte("wrapped"), unwrapCounting(&calls, []byte("key")))
+	cache.Zeroize()
+	assert.Equal(t, []byte{0, 0, 0}, key)
+
+	_, _ = cache.Unwrap([]byte("wrapped"), unwrapCounting(&calls, []byte("key")))
+	assert.Equal(t, int32(2), calls)
+}
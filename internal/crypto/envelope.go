@@ -0,0 +1,64 @@
+package crypto
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/minio/sio"
+	"github.com/pkg/errors"
+	"github.com/wal-g/wal-g/internal/ioextensions"
+)
+
+// EncryptEnvelope writes the encrypted symmetric key to the beginning of the stream and returns the writer
+// which encrypts the data with the symmetric key in the DARE format of minio/sio.
+// The key is generated and encrypted by the key management service on the first call.
+// The KMS crypters share this format, only the way they encrypt the symmetric key differs.
+func EncryptEnvelope(writer io.Writer, symmetricKey SymmetricKey) (io.WriteCloser, error) {
+	if len(symmetricKey.GetKey()) == 0 {
+		if err := symmetricKey.Generate(); err != nil {
+			return nil, errors.Wrap(err, "can't generate symmetric key")
+		}
+		if err := symmetricKey.Encrypt(); err != nil {
+			return nil, errors.Wrap(err, "can't encrypt symmetric key")
+		}
+	}
+
+	bufferedWriter := bufio.NewWriter(writer)
+	_, err := bufferedWriter.Write(symmetricKey.GetEncryptedKey())
+	if err != nil {
+		return nil, errors.Wrap(err, "can't write encryption key to buffer")
+	}
+
+	encryptedWriter, err := sio.EncryptWriter(bufferedWriter, sio.Config{Key: symmetricKey.GetKey(), CipherSuites: envelopeCipherSuites()})
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create encrypted writer")
+	}
+	return ioextensions.NewOnCloseFlusher(encryptedWriter, bufferedWriter), nil
+}
+
+// DecryptEnvelope reads the encrypted symmetric key of GetEncryptedKeyLen bytes from the beginning of the stream,
+// decrypts it with the key management service, unless it's in DefaultDataKeyCache,
+// and returns the reader of the decrypted data
+func DecryptEnvelope(reader io.Reader, symmetricKey SymmetricKey) (io.Reader, error) {
+	encryptedSymmetricKey := make([]byte, symmetricKey.GetEncryptedKeyLen())
+	_, err := io.ReadFull(reader, encryptedSymmetricKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read encryption key from archive file header")
+	}
+
+	key, err := DefaultDataKeyCache.Unwrap(encryptedSymmetricKey, func() ([]byte, error) {
+		if err := symmetricKey.SetEncryptedKey(encryptedSymmetricKey); err != nil {
+			return nil, errors.Wrap(err, "can't set encrypted key")
+		}
+		if err := symmetricKey.Decrypt(); err != nil {
+			return nil, errors.Wrap(err, "can't decrypt symmetric key")
+		}
+		// the cache zeroizes its own copy, the key of the crypter may be still used for encryption
+		return append([]byte(nil), symmetricKey.GetKey()...), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return DecryptDARE(reader, sio.Config{Key: key, CipherSuites: envelopeCipherSuites()})
+}
@@ -0,0 +1,17 @@
+package crypto
+
+import "github.com/pkg/errors"
+
+// The decryption failures which the crypters report along with the underlying error,
+// the retries can't fix any of them
+var (
+	// ErrWrongKey is returned when the data is encrypted with another key than the configured ones
+	ErrWrongKey = errors.New("the data is encrypted with another key")
+	// ErrCorruptCiphertext is returned when the encrypted data is damaged or truncated
+	ErrCorruptCiphertext = errors.New("the encrypted data is corrupt")
+	// ErrNotEncrypted is returned when the data doesn't look encrypted at all
+	ErrNotEncrypted = errors.New("the data is not encrypted")
+	// ErrKeyUnavailable is returned when the key kept out of the process, e.g. on the smartcard,
+	// can't be used: the PIN entry failed or was cancelled, or the card is removed
+	ErrKeyUnavailable = errors.New("the decryption key is unavailable")
+)
@@ -0,0 +1,34 @@
+package crypto
+
+import (
+	"sync"
+
+	"github.com/minio/sio"
+)
+
+var (
+	fipsModeMutex sync.RWMutex
+	fipsMode      bool
+)
+
+// SetFIPSMode restricts the crypters to the FIPS-approved algorithms
+func SetFIPSMode(enabled bool) {
+	fipsModeMutex.Lock()
+	defer fipsModeMutex.Unlock()
+	fipsMode = enabled
+}
+
+func IsFIPSMode() bool {
+	fipsModeMutex.RLock()
+	defer fipsModeMutex.RUnlock()
+	return fipsMode
+}
+
+// envelopeCipherSuites returns the DARE cipher suites of the KMS crypters: by default sio encrypts
+// with ChaCha20-Poly1305 on the CPUs without the AES instructions, and decrypts both
+func envelopeCipherSuites() []byte {
+	if IsFIPSMode() {
+		return []byte{sio.AES_256_GCM}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package gcpkms
+
+import (
+	"io"
+
+	"github.com/wal-g/wal-g/internal/crypto"
+	"google.golang.org/api/option"
+)
+
+// Crypter is Google Cloud KMS Crypter implementation
+type Crypter struct {
+	SymmetricKey crypto.SymmetricKey
+}
+
+func (crypter *Crypter) Name() string {
+	return "GCP_KMS/Crypter"
+}
+
+// Encrypt creates encryption writer from ordinary writer
+func (crypter *Crypter) Encrypt(writer io.Writer) (io.WriteCloser, error) {
+	return crypto.EncryptEnvelope(writer, crypter.SymmetricKey)
+}
+
+// Decrypt creates decrypted reader from ordinary reader
+func (crypter *Crypter) Decrypt(reader io.Reader) (io.Reader, error) {
+	return crypto.DecryptEnvelope(reader, crypter.SymmetricKey)
+}
+
+// CrypterFromKeyName creates Google Cloud KMS Crypter with given key resource name
+func CrypterFromKeyName(keyName string, clientOptions ...option.ClientOption) crypto.Crypter {
+	return &Crypter{SymmetricKey: NewSymmetricKey(keyName, clientOptions...)}
+}
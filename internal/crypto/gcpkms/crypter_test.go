@@ -0,0 +1,126 @@
+package gcpkms
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal/crypto"
+	"google.golang.org/api/option"
+)
+
+const testKeyName = "projects/walg/locations/global/keyRings/backups/cryptoKeys/data"
+
+// fakeKMS implements encrypt and decrypt methods of Cloud KMS REST API,
+// the ciphertext is the key name followed by the plaintext with inverted bits
+func fakeKMS(t *testing.T) *httptest.Server {
+	invert := func(data []byte) []byte {
+		result := make([]byte, len(data))
+		for i, b := range data {
+			result[i] = ^b
+		}
+		return result
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]string
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		path := strings.TrimPrefix(r.URL.Path, "/v1/")
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case path == testKeyName+":encrypt":
+			plaintext, err := base64.StdEncoding.DecodeString(request["plaintext"])
+			assert.NoError(t, err)
+			ciphertext := append([]byte(testKeyName), invert(plaintext)...)
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"name":       testKeyName,
+				"ciphertext": base64.StdEncoding.EncodeToString(ciphertext),
+			})
+		case path == testKeyName+":decrypt":
+			ciphertext, err := base64.StdEncoding.DecodeString(request["ciphertext"])
+			assert.NoError(t, err)
+			if !bytes.HasPrefix(ciphertext, []byte(testKeyName)) {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"error": {"code": 400, "message": "Decryption failed"}}`))
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"plaintext": base64.StdEncoding.EncodeToString(invert(ciphertext[len(testKeyName):])),
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error": {"code": 404, "message": "CryptoKey not found"}}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func testCrypter(server *httptest.Server, keyName string) crypto.Crypter {
+	return CrypterFromKeyName(keyName, option.WithEndpoint(server.URL+"/"), option.WithoutAuthentication())
+}
+
+func encrypt(t *testing.T, crypter crypto.Crypter, data string) []byte {
+	buf := new(bytes.Buffer)
+	writer, err := crypter.Encrypt(buf)
+	assert.NoError(t, err)
+	_, err = writer.Write([]byte(data))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func TestEncryptionCycle(t *testing.T) {
+	const someSecret = "so very secret thingy"
+	server := fakeKMS(t)
+
+	encrypted := encrypt(t, testCrypter(server, testKeyName), someSecret)
+
+	// the other process decrypts with the key unwrapped from the header
+	decrypt, err := testCrypter(server, testKeyName).Decrypt(bytes.NewReader(encrypted))
+	assert.NoError(t, err)
+	decryptedBytes, err := ioutil.ReadAll(decrypt)
+	assert.NoError(t, err)
+	assert.Equal(t, someSecret, string(decryptedBytes))
+}
+
+func TestDecryptCorruptHeader(t *testing.T) {
+	server := fakeKMS(t)
+	encrypted := encrypt(t, testCrypter(server, testKeyName), "data")
+
+	corrupted := append([]byte{}, encrypted...)
+	corrupted[ciphertextLenSize] ^= 0xff
+	_, err := testCrypter(server, testKeyName).Decrypt(bytes.NewReader(corrupted))
+	assert.Error(t, err)
+
+	_, err = testCrypter(server, testKeyName).Decrypt(bytes.NewReader(encrypted[:encryptedKeySlotLen-1]))
+	assert.Error(t, err)
+}
+
+func TestUnknownKey(t *testing.T) {
+	server := fakeKMS(t)
+	_, err := testCrypter(server, "projects/walg/locations/global/keyRings/backups/cryptoKeys/missing").
+		Encrypt(new(bytes.Buffer))
+	assert.Error(t, err)
+}
+
+func TestKeysServiceCreatedOnce(t *testing.T) {
+	server := fakeKMS(t)
+	crypter := testCrypter(server, testKeyName).(*Crypter)
+	symmetricKey := crypter.SymmetricKey.(*SymmetricKey)
+
+	encrypted := encrypt(t, crypter, "data")
+	keys := symmetricKey.keys
+	assert.NotNil(t, keys)
+
+	_, err := crypter.Decrypt(bytes.NewReader(encrypted))
+	assert.NoError(t, err)
+	encrypt(t, crypter, "more data")
+	assert.Same(t, keys, symmetricKey.keys)
+}
@@ -0,0 +1,184 @@
+package gcpkms
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"sync"
+
+	"github.com/pkg/errors"
+	cloudkms "google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/option"
+)
+
+const (
+	symmetricKeyLen = 32
+	// Cloud KMS ciphertext has no fixed length, so it's stored after its 2-byte length
+	// in the padded slot, which keeps the header of the fixed length like AWS KMS one
+	encryptedKeySlotLen = 512
+	ciphertextLenSize   = 2
+)
+
+// SymmetricKey is Google Cloud KMS implementation of crypto.SymmetricKey interface
+type SymmetricKey struct {
+	SymmetricKey          []byte
+	EncryptedSymmetricKey []byte
+
+	// KeyName is the resource name of the key,
+	// projects/<project>/locations/<location>/keyRings/<key ring>/cryptoKeys/<key>
+	KeyName string
+
+	clientOptions []option.ClientOption
+
+	// keys is the Cloud KMS client created on the first use, then shared by all the calls of the crypter
+	keys      *cloudkms.ProjectsLocationsKeyRingsCryptoKeysService
+	keysMutex sync.Mutex
+
+	mutex sync.RWMutex
+}
+
+// NewSymmetricKey creates new symmetric Google Cloud KMS key object,
+// the application default credentials are used unless the options provide others
+func NewSymmetricKey(keyName string, clientOptions ...option.ClientOption) *SymmetricKey {
+	return &SymmetricKey{KeyName: keyName, clientOptions: clientOptions}
+}
+
+func (symmetricKey *SymmetricKey) keysService() (*cloudkms.ProjectsLocationsKeyRingsCryptoKeysService, error) {
+	symmetricKey.keysMutex.Lock()
+	defer symmetricKey.keysMutex.Unlock()
+	if symmetricKey.keys != nil {
+		return symmetricKey.keys, nil
+	}
+	service, err := cloudkms.NewService(context.Background(), symmetricKey.clientOptions...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create Cloud KMS client")
+	}
+	symmetricKey.keys = service.Projects.Locations.KeyRings.CryptoKeys
+	return symmetricKey.keys, nil
+}
+
+// Generate symmetric key
+func (symmetricKey *SymmetricKey) Generate() error {
+	key := make([]byte, symmetricKeyLen)
+	_, err := rand.Read(key)
+	if err == nil {
+		symmetricKey.mutex.Lock()
+		symmetricKey.SymmetricKey = key
+		symmetricKey.mutex.Unlock()
+	}
+	return err
+}
+
+// Encrypt symmetric key with Google Cloud KMS
+func (symmetricKey *SymmetricKey) Encrypt() error {
+	keys, err := symmetricKey.keysService()
+	if err != nil {
+		return err
+	}
+
+	symmetricKey.mutex.RLock()
+	request := &cloudkms.EncryptRequest{Plaintext: base64.StdEncoding.EncodeToString(symmetricKey.SymmetricKey)}
+	symmetricKey.mutex.RUnlock()
+
+	response, err := keys.Encrypt(symmetricKey.KeyName, request).Do()
+	if err != nil {
+		return errors.Wrapf(err, "failed to encrypt with Cloud KMS key '%s'", symmetricKey.KeyName)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(response.Ciphertext)
+	if err != nil {
+		return errors.Wrap(err, "invalid Cloud KMS ciphertext")
+	}
+	if ciphertextLenSize+len(ciphertext) > encryptedKeySlotLen {
+		return errors.Errorf("Cloud KMS ciphertext of %d bytes doesn't fit the header", len(ciphertext))
+	}
+
+	slot := make([]byte, encryptedKeySlotLen)
+	binary.BigEndian.PutUint16(slot, uint16(len(ciphertext)))
+	copy(slot[ciphertextLenSize:], ciphertext)
+
+	symmetricKey.mutex.Lock()
+	symmetricKey.EncryptedSymmetricKey = slot
+	symmetricKey.mutex.Unlock()
+	return nil
+}
+
+// Decrypt symmetric key with Google Cloud KMS
+func (symmetricKey *SymmetricKey) Decrypt() error {
+	symmetricKey.mutex.RLock()
+	slot := symmetricKey.EncryptedSymmetricKey
+	symmetricKey.mutex.RUnlock()
+
+	if len(slot) != encryptedKeySlotLen {
+		return errors.New("GCP KMS: invalid encrypted header format")
+	}
+	ciphertextLen := int(binary.BigEndian.Uint16(slot))
+	if ciphertextLen == 0 || ciphertextLenSize+ciphertextLen > encryptedKeySlotLen {
+		return errors.New("GCP KMS: invalid encrypted header format")
+	}
+	ciphertext := slot[ciphertextLenSize : ciphertextLenSize+ciphertextLen]
+
+	keys, err := symmetricKey.keysService()
+	if err != nil {
+		return err
+	}
+	request := &cloudkms.DecryptRequest{Ciphertext: base64.StdEncoding.EncodeToString(ciphertext)}
+	response, err := keys.Decrypt(symmetricKey.KeyName, request).Do()
+	if err != nil {
+		return errors.Wrapf(err, "failed to decrypt with Cloud KMS key '%s'", symmetricKey.KeyName)
+	}
+	key, err := base64.StdEncoding.DecodeString(response.Plaintext)
+	if err != nil {
+		return errors.Wrap(err, "invalid Cloud KMS plaintext")
+	}
+
+	symmetricKey.mutex.Lock()
+	symmetricKey.SymmetricKey = key
+	symmetricKey.mutex.Unlock()
+	return nil
+}
+
+// GetKey returns unencrypted symmetric key
+func (symmetricKey *SymmetricKey) GetKey() []byte {
+	symmetricKey.mutex.RLock()
+	defer symmetricKey.mutex.RUnlock()
+	return symmetricKey.SymmetricKey
+}
+
+// GetEncryptedKey returns encrypted symmetric key
+func (symmetricKey *SymmetricKey) GetEncryptedKey() []byte {
+	symmetricKey.mutex.RLock()
+	defer symmetricKey.mutex.RUnlock()
+	return symmetricKey.EncryptedSymmetricKey
+}
+
+// SetKey set unencrypted symmetric key
+func (symmetricKey *SymmetricKey) SetKey(key []byte) error {
+	symmetricKey.mutex.Lock()
+	symmetricKey.SymmetricKey = key
+	symmetricKey.mutex.Unlock()
+	return nil
+}
+
+// SetEncryptedKey set encrypted symmetric key
+func (symmetricKey *SymmetricKey) SetEncryptedKey(encryptedKey []byte) error {
+	symmetricKey.mutex.Lock()
+	symmetricKey.EncryptedSymmetricKey = encryptedKey
+	symmetricKey.mutex.Unlock()
+	return nil
+}
+
+// GetKeyID returns the resource name of Cloud KMS key
+func (symmetricKey *SymmetricKey) GetKeyID() string {
+	return symmetricKey.KeyName
+}
+
+// GetEncryptedKeyLen returns encrypted key length
+func (symmetricKey *SymmetricKey) GetEncryptedKeyLen() int {
+	return encryptedKeySlotLen
+}
+
+// GetKeyLen returns key length
+func (symmetricKey *SymmetricKey) GetKeyLen() int {
+	return symmetricKeyLen
+}
@@ -91,6 +91,10 @@ func (crypter *Crypter) setup() (err error) {
 	return nil
 }
 
+func (crypter *Crypter) LoadKeys() error {
+	return crypter.setup()
+}
+
 // Encrypt creates encryption writer from ordinary writer
 func (crypter *Crypter) Encrypt(writer io.Writer) (io.WriteCloser, error) {
 	if err := crypter.setup(); err != nil {
@@ -100,6 +104,11 @@ func (crypter *Crypter) Encrypt(writer io.Writer) (io.WriteCloser, error) {
 	return NewWriter(writer, crypter.key), nil
 }
 
+// DecryptsLazily is true, since the stream header is read and checked by the first read
+func (crypter *Crypter) DecryptsLazily() bool {
+	return true
+}
+
 // Decrypt creates decrypted reader from ordinary reader
 func (crypter *Crypter) Decrypt(reader io.Reader) (io.Reader, error) {
 	if err := crypter.setup(); err != nil {
@@ -4,6 +4,8 @@
 package libsodium
 
 import (
+	"bytes"
+	"errors"
 	"io"
 	"io/ioutil"
 	"strings"
@@ -109,3 +111,33 @@ func TestEncryptionCycleFromKeyPath(t *testing.T) {
 		EncryptionCycle(t, crypter)
 	}
 }
+
+func TestDecrypt_typedErrors(t *testing.T) {
+	crypter := CrypterFromKey("4c0829fdfe7ae1987918edc585b1a90556d901eaea963c7625bb5734576dfb59", KeyTransformHex)
+	encrypted := new(bytes.Buffer)
+	writer, err := crypter.Encrypt(encrypted)
+	assert.NoError(t, err)
+	_, err = writer.Write([]byte(strings.Repeat(" so very secret thing ", 1000)))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	otherCrypter := CrypterFromKey("jv81yb3v3gNePrY0JmJ4q2j2NrqcM7tDYSHFoZ0tTIw=", KeyTransformBase64)
+	reader, err := otherCrypter.Decrypt(bytes.NewReader(encrypted.Bytes()))
+	assert.NoError(t, err)
+	_, err = ioutil.ReadAll(reader)
+	assert.True(t, errors.Is(err, crypto.ErrWrongKey), "unexpected error: %v", err)
+
+	damaged := append([]byte{}, encrypted.Bytes()...)
+	damaged[len(damaged)-10] ^= 0xff
+	reader, err = crypter.Decrypt(bytes.NewReader(damaged))
+	assert.NoError(t, err)
+	_, err = ioutil.ReadAll(reader)
+	assert.True(t, errors.Is(err, crypto.ErrCorruptCiphertext), "unexpected error: %v", err)
+
+	// the truncated header is retried like the interrupted download
+	reader, err = crypter.Decrypt(bytes.NewReader(encrypted.Bytes()[:10]))
+	assert.NoError(t, err)
+	_, err = ioutil.ReadAll(reader)
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF), "unexpected error: %v", err)
+	assert.False(t, errors.Is(err, crypto.ErrCorruptCiphertext), "unexpected error: %v", err)
+}
@@ -10,6 +10,7 @@ import (
 	"sync"
 
 	"github.com/pkg/errors"
+	"github.com/wal-g/wal-g/internal/crypto"
 )
 
 // Reader wraps ordinary reader with libsodium decryption
@@ -23,6 +24,8 @@ type Reader struct {
 
 	outIdx int
 	outLen int
+	// chunks is the number of the chunks decrypted so far
+	chunks int
 
 	// In case of using io.Pipe we can't read header until writer doesn't write, therefor we use these sync
 	onceHeader sync.Once
@@ -45,6 +48,7 @@ func NewReader(reader io.Reader, key []byte) io.Reader {
 func (reader *Reader) readHeader() {
 	header := make([]byte, C.crypto_secretstream_xchacha20poly1305_HEADERBYTES)
 
+	// the header which ends too early isn't the corruption: the truncated download ends the same way and is retried
 	if _, err := io.ReadFull(reader.Reader, header); err != nil {
 		reader.headerErr = errors.Wrap(err, "failed to read libsodium header")
 		return
@@ -59,7 +63,7 @@ func (reader *Reader) readHeader() {
 	)
 
 	if returnCode != 0 {
-		reader.headerErr = errors.New("corrupted libsodium header")
+		reader.headerErr = errors.Wrap(crypto.ErrCorruptCiphertext, "corrupted libsodium header")
 		return
 	}
 
@@ -109,11 +113,17 @@ func (reader *Reader) readNextChunk() (err error) {
 	)
 
 	if returnCode != 0 {
-		err = errors.New("corrupted chunk")
+		// the authentication of the first chunk fails the same way for the wrong key and the damaged data,
+		// the wrong key is much more likely
+		if reader.chunks == 0 {
+			return errors.Wrap(crypto.ErrWrongKey, "failed to decrypt the first libsodium chunk")
+		}
+		return errors.Wrapf(crypto.ErrCorruptCiphertext, "corrupted chunk %d", reader.chunks)
 	}
+	reader.chunks++
 
 	if tag == C.crypto_secretstream_xchacha20poly1305_TAG_FINAL && err != io.ErrUnexpectedEOF {
-		err = errors.New("premature end")
+		err = errors.Wrap(crypto.ErrCorruptCiphertext, "premature end")
 	}
 
 	if err == io.ErrUnexpectedEOF {
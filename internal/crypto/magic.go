@@ -0,0 +1,100 @@
+package crypto
+
+import "bytes"
+
+// EncryptionHeaderLength is the number of leading stream bytes enough for DetectEncryption
+const EncryptionHeaderLength = 32
+
+const (
+	OpenPGPFormat = "OpenPGP"
+	AgeFormat     = "age"
+	OpenSSLFormat = "OpenSSL"
+)
+
+var encryptionPrefixes = []struct {
+	prefix []byte
+	format string
+}{
+	{[]byte("-----BEGIN PGP MESSAGE-----"), OpenPGPFormat},
+	{[]byte("age-encryption.org/"), AgeFormat},
+	{[]byte("-----BEGIN AGE ENCRYPTED FILE"), AgeFormat},
+	// salted openssl enc output, used by pgbackrest repo encryption
+	{[]byte("Salted__"), OpenSSLFormat},
+}
+
+// OpenPGP packet tags which an encrypted message starts with, RFC 4880 section 4.3
+const (
+	publicKeyEncryptedSessionKeyTag    = 1
+	symmetricKeyEncryptedSessionKeyTag = 3
+)
+
+// DetectEncryption returns the encryption format which the stream header looks like,
+// or an empty string if the header is not recognized as encrypted.
+// libsodium streams start with a random nonce, so they can't be recognized.
+func DetectEncryption(header []byte) string {
+	for _, encryption := range encryptionPrefixes {
+		if bytes.HasPrefix(header, encryption.prefix) {
+			return encryption.format
+		}
+	}
+	if isOpenPGPMessage(header) {
+		return OpenPGPFormat
+	}
+	return ""
+}
+
+// isOpenPGPMessage checks that the header is an OpenPGP session key packet of the known version,
+// which is what both gpg and WAL-G encrypted messages start with
+func isOpenPGPMessage(header []byte) bool {
+	if len(header) == 0 || header[0]&0x80 == 0 {
+		return false
+	}
+	var tag byte
+	var lengthSize int
+	if header[0]&0x40 != 0 {
+		// new packet format
+		tag = header[0] & 0x3f
+		if len(header) < 2 {
+			return false
+		}
+		switch length := header[1]; {
+		case length < 192:
+			lengthSize = 1
+		case length < 224:
+			lengthSize = 2
+		case length == 255:
+			lengthSize = 5
+		default:
+			// partial body length
+			lengthSize = 1
+		}
+	} else {
+		// old packet format
+		tag = (header[0] >> 2) & 0x0f
+		switch header[0] & 0x03 {
+		case 0:
+			lengthSize = 1
+		case 1:
+			lengthSize = 2
+		case 2:
+			lengthSize = 4
+		default:
+			// indeterminate length
+			lengthSize = 0
+		}
+	}
+	versionIndex := 1 + lengthSize
+	if len(header) <= versionIndex {
+		return false
+	}
+	version := header[versionIndex]
+
+	switch tag {
+	case publicKeyEncryptedSessionKeyTag:
+		return version == 3 || version == 6
+	case symmetricKeyEncryptedSessionKeyTag:
+		return version == 4 || version == 5 || version == 6
+	default:
+		return false
+	}
+}
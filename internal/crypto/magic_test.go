@@ -0,0 +1,34 @@
+package crypto_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal/crypto"
+)
+
+func TestDetectEncryption(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		format string
+	}{
+		{"armored pgp", []byte("-----BEGIN PGP MESSAGE-----\n"), crypto.OpenPGPFormat},
+		{"pgp public key session packet", []byte{0x85, 0x01, 0x0c, 0x03, 0x1a}, crypto.OpenPGPFormat},
+		{"pgp new format packet", []byte{0xc1, 0xc0, 0x4c, 0x03, 0x1a}, crypto.OpenPGPFormat},
+		{"pgp symmetric session packet", []byte{0x8c, 0x0d, 0x04, 0x07}, crypto.OpenPGPFormat},
+		{"age", []byte("age-encryption.org/v1\n-> X25519"), crypto.AgeFormat},
+		{"armored age", []byte("-----BEGIN AGE ENCRYPTED FILE-----"), crypto.AgeFormat},
+		{"openssl", []byte("Salted__\x01\x02\x03\x04\x05\x06\x07\x08"), crypto.OpenSSLFormat},
+		{"pgp signature packet", []byte{0x89, 0x01, 0x1c, 0x04}, ""},
+		{"lzo", []byte{0x89, 'L', 'Z', 'O', 0x00, 0x0d, 0x0a, 0x1a}, ""},
+		{"gzip", []byte{0x1f, 0x8b, 0x08, 0x00}, ""},
+		{"tar", []byte("base/1/1259\x00\x00\x00"), ""},
+		{"empty", []byte{}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.format, crypto.DetectEncryption(test.header))
+		})
+	}
+}
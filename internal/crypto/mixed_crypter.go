@@ -0,0 +1,65 @@
+package crypto
+
+import (
+	"bufio"
+	"io"
+)
+
+// MixedCrypter encrypts with the primary crypter and decrypts the streams which look like its format with it,
+// the rest is left to the secondary crypter. So the storage may keep the files encrypted by the former crypter
+// after switching to the new one.
+type MixedCrypter struct {
+	Primary       Crypter
+	PrimaryFormat string
+	Secondary     Crypter
+}
+
+// NewMixedCrypter creates MixedCrypter, primaryFormat is one of the formats returned by DetectEncryption
+func NewMixedCrypter(primary Crypter, primaryFormat string, secondary Crypter) Crypter {
+	return &MixedCrypter{Primary: primary, PrimaryFormat: primaryFormat, Secondary: secondary}
+}
+
+func (crypter *MixedCrypter) Name() string {
+	return crypter.Primary.Name() + "+" + crypter.Secondary.Name()
+}
+
+func (crypter *MixedCrypter) LoadKeys() error {
+	if err := LoadKeys(crypter.Primary); err != nil {
+		return err
+	}
+	return LoadKeys(crypter.Secondary)
+}
+
+// LoadDecryptionKeys loads the decryption keys of both crypters, the files of both formats are restored
+func (crypter *MixedCrypter) LoadDecryptionKeys() error {
+	if err := LoadDecryptionKeys(crypter.Primary); err != nil {
+		return err
+	}
+	return LoadDecryptionKeys(crypter.Secondary)
+}
+
+// EncryptionFormats returns the formats of both crypters, if both of them have ones
+func (crypter *MixedCrypter) EncryptionFormats() []string {
+	return combineEncryptionFormats([]Crypter{crypter.Primary, crypter.Secondary})
+}
+
+func (crypter *MixedCrypter) Encrypt(writer io.Writer) (io.WriteCloser, error) {
+	return crypter.Primary.Encrypt(writer)
+}
+
+// DecryptsLazily tells if the secondary crypter does, the streams of the other formats are passed to it
+func (crypter *MixedCrypter) DecryptsLazily() bool {
+	return decryptsLazily(crypter.Secondary)
+}
+
+func (crypter *MixedCrypter) Decrypt(reader io.Reader) (io.Reader, error) {
+	bufferedReader := bufio.NewReader(reader)
+	header, err := bufferedReader.Peek(EncryptionHeaderLength)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if DetectEncryption(header) == crypter.PrimaryFormat {
+		return crypter.Primary.Decrypt(bufferedReader)
+	}
+	return crypter.Secondary.Decrypt(bufferedReader)
+}
@@ -0,0 +1,142 @@
+package crypto_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal/crypto"
+)
+
+// prefixCrypter marks the encrypted data with the prefix, which Decrypt checks and strips
+type prefixCrypter struct {
+	prefix string
+}
+
+func (crypter prefixCrypter) Name() string {
+	return crypter.prefix
+}
+
+func (crypter prefixCrypter) Encrypt(writer io.Writer) (io.WriteCloser, error) {
+	_, err := writer.Write([]byte(crypter.prefix))
+	return nopWriteCloser{writer}, err
+}
+
+func (crypter prefixCrypter) Decrypt(reader io.Reader) (io.Reader, error) {
+	prefix := make([]byte, len(crypter.prefix))
+	if _, err := io.ReadFull(reader, prefix); err != nil || string(prefix) != crypter.prefix {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return reader, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func TestMixedCrypter(t *testing.T) {
+	primary := prefixCrypter{"age-encryption.org/v1\n"}
+	secondary := prefixCrypter{"secondary"}
+	crypter := crypto.NewMixedCrypter(primary, crypto.AgeFormat, secondary)
+
+	var buf bytes.Buffer
+	writer, err := crypter.Encrypt(&buf)
+	assert.NoError(t, err)
+	_, err = writer.Write([]byte("new"))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	assert.Equal(t, "age-encryption.org/v1\nnew", buf.String())
+
+	for encrypted, expected := range map[string]string{
+		"age-encryption.org/v1\nnew": "new",
+		"secondaryold":               "old",
+	} {
+		reader, err := crypter.Decrypt(bytes.NewBufferString(encrypted))
+		assert.NoError(t, err)
+		decrypted, err := ioutil.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(decrypted))
+	}
+}
+
+func TestMultiCrypter_trial(t *testing.T) {
+	crypter := crypto.NewMultiCrypter(prefixCrypter{"new"}, prefixCrypter{"old"})
+
+	var buf bytes.Buffer
+	writer, err := crypter.Encrypt(&buf)
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	assert.Equal(t, "new", buf.String())
+
+	for encrypted, expected := range map[string]string{
+		"newdata": "data",
+		"olddata": "data",
+		"old":     "",
+	} {
+		reader, err := crypter.Decrypt(bytes.NewBufferString(encrypted))
+		assert.NoError(t, err)
+		decrypted, err := ioutil.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(decrypted))
+	}
+
+	_, err = crypter.Decrypt(bytes.NewBufferString("unknown"))
+	assert.Error(t, err)
+}
+
+// lazyPrefixCrypter checks the prefix only when the decrypted data is read, like the command crypter
+type lazyPrefixCrypter struct {
+	prefixCrypter
+}
+
+func (crypter lazyPrefixCrypter) DecryptsLazily() bool {
+	return true
+}
+
+func (crypter lazyPrefixCrypter) Decrypt(reader io.Reader) (io.Reader, error) {
+	return &lazyReader{reader: reader, prefix: crypter.prefix}, nil
+}
+
+type lazyReader struct {
+	reader  io.Reader
+	prefix  string
+	checked bool
+}
+
+func (reader *lazyReader) Read(p []byte) (int, error) {
+	if !reader.checked {
+		reader.checked = true
+		if _, err := prefixCrypter.Decrypt(prefixCrypter{reader.prefix}, reader.reader); err != nil {
+			return 0, err
+		}
+	}
+	return reader.reader.Read(p)
+}
+
+func TestMultiCrypter_lazyCrypterTriedLast(t *testing.T) {
+	crypter := crypto.NewMultiCrypter(lazyPrefixCrypter{prefixCrypter{"new"}}, prefixCrypter{"old"})
+
+	for encrypted, expected := range map[string]string{
+		"olddata": "data",
+		// the lazy crypter is the only one left
+		"newdata": "data",
+	} {
+		reader, err := crypter.Decrypt(bytes.NewBufferString(encrypted))
+		assert.NoError(t, err)
+		decrypted, err := ioutil.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(decrypted))
+	}
+
+	// neither of the lazy crypters can be picked without consuming the stream
+	crypter = crypto.NewMultiCrypter(lazyPrefixCrypter{prefixCrypter{"new"}}, lazyPrefixCrypter{prefixCrypter{"old"}},
+		prefixCrypter{"other"})
+	_, err := crypter.Decrypt(bytes.NewBufferString("olddata"))
+	assert.Error(t, err)
+}
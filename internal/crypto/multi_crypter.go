@@ -0,0 +1,258 @@
+package crypto
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+)
+
+// multiCrypterHeaderLength is the number of leading stream bytes which the crypters examine to pick the key,
+// the OpenPGP session key packets of several RSA 4096 recipients fit into it
+const multiCrypterHeaderLength = 16 * 1024
+
+// KeyIDCrypter is implemented by the crypters whose format names the keys the data is encrypted to
+type KeyIDCrypter interface {
+	Crypter
+	// RecipientKeyIDs returns the IDs of the keys the stream starting with the header is encrypted to,
+	// or nothing if the header is not of the crypter format
+	RecipientKeyIDs(header []byte) []string
+	// DecryptionKeyIDs returns the IDs of the keys the crypter is able to decrypt with
+	DecryptionKeyIDs() ([]string, error)
+}
+
+// NoMatchingKeyError is returned when none of the configured keys is the one the data is encrypted to
+type NoMatchingKeyError struct {
+	error
+	KeyIDs []string
+}
+
+func newNoMatchingKeyError(keyIDs []string) NoMatchingKeyError {
+	return NoMatchingKeyError{
+		errors.Errorf("none of the configured keys can decrypt the data encrypted to the keys %s",
+			strings.Join(keyIDs, ", ")),
+		keyIDs,
+	}
+}
+
+func (err NoMatchingKeyError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+func (err NoMatchingKeyError) Unwrap() error {
+	return ErrWrongKey
+}
+
+// MultiCrypter encrypts with the first crypter and decrypts with any of them, e.g. with the old
+// and the new keys during the key rotation. The key of the KeyIDCrypter is picked by the key IDs in the stream,
+// the other crypters are tried in order until one of them accepts the stream header. The LazyDecrypter,
+// which accepts any stream, is used only if the others fail and it's the only one left.
+// The choices are cached, so the rest of the files of the same restore mostly don't repeat them.
+type MultiCrypter struct {
+	Crypters []Crypter
+
+	mutex            sync.Mutex
+	crypterByKeyID   map[string]Crypter
+	crypterByFormat  map[string]Crypter
+	decryptionKeyIDs map[Crypter][]string
+}
+
+// NewMultiCrypter creates MultiCrypter, the first crypter is the primary one used for the encryption
+func NewMultiCrypter(crypters ...Crypter) Crypter {
+	return &MultiCrypter{
+		Crypters:         crypters,
+		crypterByKeyID:   make(map[string]Crypter),
+		crypterByFormat:  make(map[string]Crypter),
+		decryptionKeyIDs: make(map[Crypter][]string),
+	}
+}
+
+func (crypter *MultiCrypter) Name() string {
+	names := make([]string, 0, len(crypter.Crypters))
+	for _, subCrypter := range crypter.Crypters {
+		names = append(names, subCrypter.Name())
+	}
+	return "Multi/" + strings.Join(names, ",")
+}
+
+// EncryptionFormats returns the formats of all the crypters, if all of them have ones
+func (crypter *MultiCrypter) EncryptionFormats() []string {
+	return combineEncryptionFormats(crypter.Crypters)
+}
+
+// combineEncryptionFormats returns nothing if any of the crypters has no recognizable format
+func combineEncryptionFormats(crypters []Crypter) []string {
+	var formats []string
+	for _, subCrypter := range crypters {
+		subFormats := EncryptionFormats(subCrypter)
+		if len(subFormats) == 0 {
+			return nil
+		}
+		formats = append(formats, subFormats...)
+	}
+	return formats
+}
+
+// LoadKeys loads the keys of all the crypters
+func (crypter *MultiCrypter) LoadKeys() error {
+	for _, subCrypter := range crypter.Crypters {
+		if err := LoadKeys(subCrypter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadDecryptionKeys succeeds if any of the crypters loads its decryption keys,
+// e.g. the new key may be the public one while the former keys decrypt
+func (crypter *MultiCrypter) LoadDecryptionKeys() error {
+	var err error
+	for _, subCrypter := range crypter.Crypters {
+		if err = LoadDecryptionKeys(subCrypter); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// Encrypt creates encryption writer of the primary crypter
+func (crypter *MultiCrypter) Encrypt(writer io.Writer) (io.WriteCloser, error) {
+	return crypter.Crypters[0].Encrypt(writer)
+}
+
+// Decrypt creates decrypted reader with the crypter which has the key of the stream
+func (crypter *MultiCrypter) Decrypt(reader io.Reader) (io.Reader, error) {
+	header := make([]byte, multiCrypterHeaderLength)
+	headerLength, err := io.ReadFull(reader, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, errors.Wrap(err, "failed to read the encrypted stream header")
+	}
+	header = header[:headerLength]
+
+	for _, subCrypter := range crypter.Crypters {
+		keyIDCrypter, ok := subCrypter.(KeyIDCrypter)
+		if !ok {
+			continue
+		}
+		if recipients := keyIDCrypter.RecipientKeyIDs(header); len(recipients) > 0 {
+			decrypter, err := crypter.findByKeyIDs(recipients)
+			if err != nil {
+				return nil, err
+			}
+			return decrypter.Decrypt(io.MultiReader(bytes.NewReader(header), reader))
+		}
+	}
+	return crypter.decryptByTrial(header, reader)
+}
+
+func (crypter *MultiCrypter) findByKeyIDs(recipients []string) (Crypter, error) {
+	crypter.mutex.Lock()
+	defer crypter.mutex.Unlock()
+	for _, recipient := range recipients {
+		if decrypter, ok := crypter.crypterByKeyID[recipient]; ok {
+			return decrypter, nil
+		}
+	}
+
+	for _, subCrypter := range crypter.Crypters {
+		keyIDCrypter, ok := subCrypter.(KeyIDCrypter)
+		if !ok {
+			continue
+		}
+		keyIDs, err := crypter.loadDecryptionKeyIDs(keyIDCrypter)
+		if err != nil {
+			tracelog.WarningLogger.Printf("failed to load the keys of %s: %v", subCrypter.Name(), err)
+			continue
+		}
+		for _, keyID := range keyIDs {
+			for _, recipient := range recipients {
+				if keyID == recipient {
+					crypter.crypterByKeyID[recipient] = subCrypter
+					return subCrypter, nil
+				}
+			}
+		}
+	}
+	return nil, newNoMatchingKeyError(recipients)
+}
+
+func (crypter *MultiCrypter) loadDecryptionKeyIDs(keyIDCrypter KeyIDCrypter) ([]string, error) {
+	if keyIDs, ok := crypter.decryptionKeyIDs[keyIDCrypter]; ok {
+		return keyIDs, nil
+	}
+	keyIDs, err := keyIDCrypter.DecryptionKeyIDs()
+	if err != nil {
+		return nil, err
+	}
+	crypter.decryptionKeyIDs[keyIDCrypter] = keyIDs
+	return keyIDs, nil
+}
+
+// decryptByTrial tries the crypters in order while they fail within the header,
+// the stream consumed further can't be replayed to the next crypter.
+// The crypter which decrypted the last stream of the same format is tried first.
+// The lazy crypters succeed before reading anything, so the wrong key would fail only in the middle
+// of the stream: they are tried after the others, and only the single one of them is.
+func (crypter *MultiCrypter) decryptByTrial(header []byte, reader io.Reader) (io.Reader, error) {
+	format := DetectEncryption(header)
+	crypter.mutex.Lock()
+	lastCrypter, ok := crypter.crypterByFormat[format]
+	crypter.mutex.Unlock()
+	var candidates, lazyCandidates []Crypter
+	if ok {
+		candidates = append(candidates, lastCrypter)
+	}
+	for _, subCrypter := range crypter.Crypters {
+		if decryptsLazily(subCrypter) {
+			lazyCandidates = append(lazyCandidates, subCrypter)
+		} else if !ok || subCrypter != lastCrypter {
+			candidates = append(candidates, subCrypter)
+		}
+	}
+
+	var failures []string
+	for _, subCrypter := range candidates {
+		replay := &headerReplayReader{header: bytes.NewReader(header), rest: reader}
+		decrypted, err := subCrypter.Decrypt(replay)
+		if err == nil {
+			crypter.mutex.Lock()
+			crypter.crypterByFormat[format] = subCrypter
+			crypter.mutex.Unlock()
+			return decrypted, nil
+		}
+		if replay.pastHeader {
+			return nil, err
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", subCrypter.Name(), err))
+	}
+	if len(lazyCandidates) == 1 {
+		return lazyCandidates[0].Decrypt(io.MultiReader(bytes.NewReader(header), reader))
+	}
+	for _, subCrypter := range lazyCandidates {
+		failures = append(failures, fmt.Sprintf("%s: not tried, it can't be told from the other lazy crypters "+
+			"before the stream is consumed", subCrypter.Name()))
+	}
+	return nil, errors.Errorf("none of the crypters can decrypt the data:\n%s", strings.Join(failures, "\n"))
+}
+
+// headerReplayReader reads the header and then the rest of the stream, remembering if it got past the header
+type headerReplayReader struct {
+	header     *bytes.Reader
+	rest       io.Reader
+	pastHeader bool
+}
+
+func (reader *headerReplayReader) Read(p []byte) (int, error) {
+	if reader.header.Len() > 0 {
+		return reader.header.Read(p)
+	}
+	n, err := reader.rest.Read(p)
+	if n > 0 {
+		reader.pastHeader = true
+	}
+	return n, err
+}
@@ -0,0 +1,260 @@
+package openpgp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rsa"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/wal-g/internal/crypto"
+)
+
+// agentLineLength is the Assuan line length limit, the longer data is sent in several lines
+const agentLineLength = 1000
+
+// gpgErrNoSecretKey is GPG_ERR_NO_SECKEY, the agent has no key of the keygrip
+const gpgErrNoSecretKey = 17
+
+// gpgErrSourcePinentry and gpgErrSourceSCD are the libgpg-error sources of pinentry and scdaemon,
+// whichever failure they report is the PIN entry or the card one
+const (
+	gpgErrSourcePinentry = 5
+	gpgErrSourceSCD      = 6
+)
+
+// agentKeyUnavailableCodes are the libgpg-error codes of the PIN entry and smartcard failures,
+// which fail the decryption with any file until the operator fixes them
+var agentKeyUnavailableCodes = map[uint64]string{
+	11:  "GPG_ERR_BAD_PASSPHRASE",
+	62:  "GPG_ERR_TIMEOUT",
+	85:  "GPG_ERR_NO_PIN_ENTRY",
+	86:  "GPG_ERR_PIN_ENTRY",
+	87:  "GPG_ERR_BAD_PIN",
+	91:  "GPG_ERR_WRONG_CARD",
+	99:  "GPG_ERR_CANCELED",
+	108: "GPG_ERR_CARD",
+	109: "GPG_ERR_CARD_RESET",
+	110: "GPG_ERR_CARD_REMOVED",
+	111: "GPG_ERR_INV_CARD",
+	112: "GPG_ERR_CARD_NOT_PRESENT",
+	114: "GPG_ERR_NOT_CONFIRMED",
+	119: "GPG_ERR_NO_SCDAEMON",
+	130: "GPG_ERR_PIN_BLOCKED",
+	131: "GPG_ERR_USE_CONDITIONS",
+	178: "GPG_ERR_NO_PIN",
+	198: "GPG_ERR_FULLY_CANCELED",
+}
+
+// AgentKeyHolder asks gpg-agent to decrypt the session keys. The agent knows the keys on the smartcard
+// once gpg --card-status is run, and asks for the PIN and talks to the card by itself.
+type AgentKeyHolder struct {
+	socketPath string
+}
+
+// NewAgentKeyHolder creates the key holder talking to gpg-agent on its socket,
+// which gpgconf --list-dirs agent-socket prints
+func NewAgentKeyHolder(socketPath string) *AgentKeyHolder {
+	return &AgentKeyHolder{socketPath: socketPath}
+}
+
+func (holder *AgentKeyHolder) Name() string {
+	return "gpg-agent"
+}
+
+func (holder *AgentKeyHolder) DecryptSessionKey(key *rsa.PublicKey, ciphertext []byte) ([]byte, error) {
+	conn, err := net.Dial("unix", holder.socketPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to gpg-agent")
+	}
+	defer conn.Close()
+
+	agent := &assuanConn{writer: conn, reader: bufio.NewReader(conn)}
+	if _, err = agent.readResponse(nil); err != nil {
+		return nil, err
+	}
+	if _, err = agent.transact(fmt.Sprintf("SETKEY %X", keygrip(key)), nil); err != nil {
+		return nil, err
+	}
+	encryptedValue := []byte(fmt.Sprintf("(7:enc-val(3:rsa(1:a%d:", len(ciphertext)+1))
+	// the leading zero keeps the ciphertext positive, whichever way the agent parses it
+	encryptedValue = append(append(append(encryptedValue, 0), ciphertext...), ")))"...)
+	response, err := agent.transact("PKDECRYPT", map[string][]byte{"CIPHERTEXT": encryptedValue})
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := parseAgentValue(response.data)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range response.status {
+		// the card may remove the padding itself
+		if status == "PADDING 0" {
+			return value, nil
+		}
+	}
+	return unpadSessionKey(value)
+}
+
+// keygrip is how gpg-agent identifies the RSA key: the SHA-1 of its modulus as the signed MPI
+func keygrip(key *rsa.PublicKey) []byte {
+	modulus := key.N.Bytes()
+	if len(modulus) > 0 && modulus[0]&0x80 != 0 {
+		modulus = append([]byte{0}, modulus...)
+	}
+	grip := sha1.Sum(modulus)
+	return grip[:]
+}
+
+// parseAgentValue extracts the value of the (5:value<length>:<value>) canonical S-expression
+func parseAgentValue(data []byte) ([]byte, error) {
+	const prefix = "(5:value"
+	if !bytes.HasPrefix(data, []byte(prefix)) {
+		return nil, errors.Errorf("unexpected gpg-agent response %q", data)
+	}
+	rest := data[len(prefix):]
+	colon := bytes.IndexByte(rest, ':')
+	if colon < 0 {
+		return nil, errors.Errorf("unexpected gpg-agent response %q", data)
+	}
+	length, err := strconv.Atoi(string(rest[:colon]))
+	value := rest[colon+1:]
+	if err != nil || length < 0 || len(value) <= length || value[length] != ')' {
+		return nil, errors.Errorf("unexpected gpg-agent response %q", data)
+	}
+	return value[:length], nil
+}
+
+// unpadSessionKey removes the PKCS #1 v1.5 padding of the session key, its leading zero byte may be dropped already
+func unpadSessionKey(value []byte) ([]byte, error) {
+	if len(value) > 0 && value[0] == 0 {
+		value = value[1:]
+	}
+	// the type byte, at least 8 random non-zero bytes and the separating zero byte
+	const minPaddingLength = 10
+	if len(value) < minPaddingLength || value[0] != 2 {
+		return nil, errors.Wrap(crypto.ErrWrongKey, "the session key decrypted by gpg-agent has no PKCS #1 v1.5 padding")
+	}
+	separator := bytes.IndexByte(value[1:], 0) + 1
+	if separator < minPaddingLength-1 {
+		return nil, errors.Wrap(crypto.ErrWrongKey, "the session key decrypted by gpg-agent has no PKCS #1 v1.5 padding")
+	}
+	return value[separator+1:], nil
+}
+
+// assuanConn is the client side of the Assuan protocol gpg-agent speaks
+type assuanConn struct {
+	writer io.Writer
+	reader *bufio.Reader
+}
+
+type assuanResponse struct {
+	data   []byte
+	status []string
+}
+
+// transact sends the command and reads the response, answering the inquiries of the agent with the data given
+func (conn *assuanConn) transact(command string, inquiries map[string][]byte) (assuanResponse, error) {
+	if _, err := io.WriteString(conn.writer, command+"\n"); err != nil {
+		return assuanResponse{}, errors.Wrap(err, "failed to send command to gpg-agent")
+	}
+	return conn.readResponse(inquiries)
+}
+
+func (conn *assuanConn) readResponse(inquiries map[string][]byte) (assuanResponse, error) {
+	var response assuanResponse
+	for {
+		line, err := conn.reader.ReadString('\n')
+		if err != nil {
+			return response, errors.Wrap(err, "failed to read gpg-agent response")
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "OK" || strings.HasPrefix(line, "OK "):
+			return response, nil
+		case strings.HasPrefix(line, "ERR "):
+			return response, parseAgentError(strings.TrimPrefix(line, "ERR "))
+		case strings.HasPrefix(line, "D "):
+			response.data = append(response.data, unescapeAssuan(strings.TrimPrefix(line, "D "))...)
+		case strings.HasPrefix(line, "S "):
+			response.status = append(response.status, strings.TrimPrefix(line, "S "))
+		case strings.HasPrefix(line, "INQUIRE "):
+			keyword := strings.Fields(strings.TrimPrefix(line, "INQUIRE "))[0]
+			if err := conn.sendData(inquiries[keyword]); err != nil {
+				return response, err
+			}
+		}
+	}
+}
+
+// sendData answers the inquiry with the escaped data split to the lines of the limited length,
+// the unknown inquiries are answered with no data
+func (conn *assuanConn) sendData(data []byte) error {
+	var lines strings.Builder
+	line := make([]byte, 0, agentLineLength)
+	for i, b := range data {
+		if b == '%' || b == '\r' || b == '\n' {
+			line = append(line, fmt.Sprintf("%%%02X", b)...)
+		} else {
+			line = append(line, b)
+		}
+		// the line ends with a newline, and "D " is prepended
+		if len(line) > agentLineLength-6 || i == len(data)-1 {
+			lines.WriteString("D ")
+			lines.Write(line)
+			lines.WriteString("\n")
+			line = line[:0]
+		}
+	}
+	lines.WriteString("END\n")
+	if _, err := io.WriteString(conn.writer, lines.String()); err != nil {
+		return errors.Wrap(err, "failed to send data to gpg-agent")
+	}
+	return nil
+}
+
+func unescapeAssuan(line string) []byte {
+	data := make([]byte, 0, len(line))
+	for i := 0; i < len(line); i++ {
+		if line[i] == '%' && i+2 < len(line) {
+			if b, err := strconv.ParseUint(line[i+1:i+3], 16, 8); err == nil {
+				data = append(data, byte(b))
+				i += 2
+				continue
+			}
+		}
+		data = append(data, line[i])
+	}
+	return data
+}
+
+// parseAgentError maps the ERR <value> <description> response: the PIN entry and card failures are permanent.
+// The value keeps the error source in its upper bits and the error code in the lower ones.
+func parseAgentError(response string) error {
+	fields := strings.SplitN(response, " ", 2)
+	description := response
+	if len(fields) == 2 {
+		description = fields[1]
+	}
+	value, err := strconv.ParseUint(fields[0], 10, 32)
+	if err != nil {
+		return errors.Errorf("gpg-agent: %s", description)
+	}
+	source, code := value>>24&0x7f, value&0xffff
+	if codeName, ok := agentKeyUnavailableCodes[code]; ok {
+		return newKeyHolderError("gpg-agent", fmt.Sprintf("%s (%s)", description, codeName))
+	}
+	if source == gpgErrSourcePinentry || source == gpgErrSourceSCD {
+		return newKeyHolderError("gpg-agent", description)
+	}
+	if code == gpgErrNoSecretKey {
+		return errors.Wrapf(crypto.ErrWrongKey, "gpg-agent: %s", description)
+	}
+	return errors.Errorf("gpg-agent: %s", description)
+}
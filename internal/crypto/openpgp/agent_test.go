@@ -0,0 +1,194 @@
+package openpgp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rsa"
+	"fmt"
+	"math/big"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/crypto"
+	"golang.org/x/crypto/openpgp"
+)
+
+// fakeAgent speaks the part of the gpg-agent protocol which PKDECRYPT needs
+type fakeAgent struct {
+	key *rsa.PrivateKey
+	// errorResponse, if set, answers PKDECRYPT
+	errorResponse string
+	// cardPadding makes the agent remove the padding, as the smartcards do
+	cardPadding bool
+
+	connections int
+	keygrips    []string
+}
+
+func startFakeAgent(t *testing.T, agent *fakeAgent) string {
+	socketPath := filepath.Join(t.TempDir(), "S.gpg-agent")
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			agent.connections++
+			agent.serve(conn)
+		}
+	}()
+	return socketPath
+}
+
+func (agent *fakeAgent) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	fmt.Fprintf(conn, "OK Pleased to meet you\n")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.Fields(line)
+		switch command[0] {
+		case "SETKEY":
+			agent.keygrips = append(agent.keygrips, command[1])
+			fmt.Fprintf(conn, "OK\n")
+		case "PKDECRYPT":
+			fmt.Fprintf(conn, "INQUIRE CIPHERTEXT\n")
+			var encryptedValue []byte
+			for {
+				line, err = reader.ReadString('\n')
+				if err != nil || line == "END\n" {
+					break
+				}
+				encryptedValue = append(encryptedValue, unescapeAssuan(strings.TrimSuffix(line[2:], "\n"))...)
+			}
+			if agent.errorResponse != "" {
+				fmt.Fprintf(conn, "%s\n", agent.errorResponse)
+				continue
+			}
+			fmt.Fprintf(conn, "%s", agent.decrypt(encryptedValue))
+		default:
+			fmt.Fprintf(conn, "ERR 67109139 Unknown IPC command <GPG Agent>\n")
+		}
+	}
+}
+
+// decrypt returns the response to PKDECRYPT of (7:enc-val(3:rsa(1:a<length>:<ciphertext>)))
+func (agent *fakeAgent) decrypt(encryptedValue []byte) string {
+	const prefix = "(7:enc-val(3:rsa(1:a"
+	rest := encryptedValue[len(prefix):]
+	colon := bytes.IndexByte(rest, ':')
+	length, _ := strconv.Atoi(string(rest[:colon]))
+	ciphertext := new(big.Int).SetBytes(rest[colon+1 : colon+1+length])
+	// the raw RSA decryption keeps the padding, and drops its leading zero byte as libgcrypt does
+	value := new(big.Int).Exp(ciphertext, agent.key.D, agent.key.N).Bytes()
+	status := ""
+	if agent.cardPadding {
+		separator := bytes.IndexByte(value, 0)
+		value = value[separator+1:]
+		status = "S PADDING 0\n"
+	}
+	response := new(bytes.Buffer)
+	assuan := &assuanConn{writer: response}
+	_ = assuan.sendData([]byte(fmt.Sprintf("(5:value%d:%s)", len(value), value)))
+	return status + strings.TrimSuffix(response.String(), "END\n") + "OK\n"
+}
+
+func agentCrypter(t *testing.T, agent *fakeAgent) (*Crypter, *Crypter) {
+	generated := generatedKeyCrypter(t, "agent")
+	agent.key = generated.SecretKey[0].Subkeys[0].PrivateKey.PrivateKey.(*rsa.PrivateKey)
+	holder := NewAgentKeyHolder(startFakeAgent(t, agent))
+	publicKey := serializeKey(t, generated, false, openpgp.PublicKeyType)
+	return generated, CrypterFromKeyWithHolder(publicKey, holder).(*Crypter)
+}
+
+func TestAgentKeyHolder_decrypt(t *testing.T) {
+	for _, cardPadding := range []bool{false, true} {
+		agent := &fakeAgent{cardPadding: cardPadding}
+		generated, crypter := agentCrypter(t, agent)
+
+		for _, data := range []string{"first", "second"} {
+			decrypted, err := decryptAll(crypter, encrypt(t, generated, data))
+			assert.NoError(t, err)
+			assert.Equal(t, data, decrypted)
+		}
+		assert.Equal(t, 2, agent.connections)
+		assert.Equal(t, fmt.Sprintf("%X", keygrip(&agent.key.PublicKey)), agent.keygrips[0])
+	}
+}
+
+func TestAgentKeyHolder_permanentErrors(t *testing.T) {
+	responses := []string{
+		"ERR 83886167 Bad PIN <Pinentry>",
+		"ERR 83918950 Inappropriate ioctl for device <Pinentry>",
+		"ERR 100663406 Card removed <SCD>",
+		"ERR 67108963 Operation cancelled <GPG Agent>",
+	}
+	for _, response := range responses {
+		agent := &fakeAgent{errorResponse: response}
+		generated, crypter := agentCrypter(t, agent)
+		message := encrypt(t, generated, "data")
+
+		for i := 0; i < 3; i++ {
+			_, err := crypter.Decrypt(bytes.NewReader(message))
+			assert.True(t, errors.Is(err, crypto.ErrKeyUnavailable), err)
+		}
+		assert.Equal(t, 1, agent.connections, response)
+	}
+}
+
+func TestAgentKeyHolder_otherErrors(t *testing.T) {
+	agent := &fakeAgent{errorResponse: "ERR 67108881 No secret key <GPG Agent>"}
+	generated, crypter := agentCrypter(t, agent)
+	_, err := crypter.Decrypt(bytes.NewReader(encrypt(t, generated, "data")))
+	assert.True(t, errors.Is(err, crypto.ErrWrongKey), err)
+
+	agent.errorResponse = "ERR 67108865 General error <GPG Agent>"
+	_, err = crypter.Decrypt(bytes.NewReader(encrypt(t, generated, "data")))
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, crypto.ErrKeyUnavailable), err)
+	assert.Equal(t, 2, agent.connections)
+
+	_, err = decryptAll(CrypterFromKeyPathWithHolder(PrivateKeyFilePath, NewAgentKeyHolder(filepath.Join(t.TempDir(), "none"))),
+		encrypt(t, MockArmedCrypterFromKeyPath(), "data"))
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, crypto.ErrKeyUnavailable), err)
+}
+
+func TestKeygrip(t *testing.T) {
+	crypter := MockArmedCrypterFromKeyPath().(*Crypter)
+	require.NoError(t, crypter.LoadKeys())
+	var keygrips []string
+	for _, key := range keyHolderKeys(crypter.PubKey) {
+		keygrips = append(keygrips, fmt.Sprintf("%X", keygrip(key.PublicKey.(*rsa.PublicKey))))
+	}
+	// as gpg --with-keygrip lists them
+	assert.Equal(t, []string{"E8C05BE6B71FA5AC00A2B5C551D5F5E90BC2E2BD", "221B0B1183EA26CC0E367F3A1AE486BA9D59834C"}, keygrips)
+}
+
+func TestAssuanConn_sendData(t *testing.T) {
+	data := bytes.Repeat([]byte("%\n\r(x)"), 500)
+	buf := new(bytes.Buffer)
+	require.NoError(t, (&assuanConn{writer: buf}).sendData(data))
+
+	lines := strings.SplitAfter(buf.String(), "\n")
+	assert.Equal(t, "END\n", lines[len(lines)-2])
+	var sent []byte
+	for _, line := range lines[:len(lines)-2] {
+		assert.LessOrEqual(t, len(line), agentLineLength)
+		require.True(t, strings.HasPrefix(line, "D "))
+		sent = append(sent, unescapeAssuan(strings.TrimSuffix(line[2:], "\n"))...)
+	}
+	assert.Equal(t, data, sent)
+}
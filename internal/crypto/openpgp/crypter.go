@@ -3,14 +3,18 @@ package openpgp
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/wal-g/wal-g/internal/crypto"
 	"github.com/wal-g/wal-g/internal/ioextensions"
 	"golang.org/x/crypto/openpgp"
+	pgperrors "golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/packet"
 )
 
 // Crypter incapsulates specific of cypher method
@@ -30,6 +34,12 @@ type Crypter struct {
 	PubKey    openpgp.EntityList
 	SecretKey openpgp.EntityList
 
+	// KeyHolder, if set, decrypts the session keys with the secret key it keeps,
+	// then the public key is enough for the decryption
+	KeyHolder        KeyHolder
+	keyHolderMutex   sync.Mutex
+	keyHolderFailure error
+
 	loadPassphrase func() (string, bool)
 
 	mutex sync.RWMutex
@@ -39,6 +49,10 @@ func (crypter *Crypter) Name() string {
 	return "Opengpg/Crypter"
 }
 
+func (crypter *Crypter) EncryptionFormats() []string {
+	return []string{crypto.OpenPGPFormat}
+}
+
 // CrypterFromKey creates Crypter from armored key.
 func CrypterFromKey(armoredKey string, loadPassphrase func() (string, bool)) crypto.Crypter {
 	return &Crypter{ArmoredKey: armoredKey, IsUseArmoredKey: true, loadPassphrase: loadPassphrase}
@@ -68,43 +82,27 @@ func (crypter *Crypter) setupPubKey() error {
 		return nil
 	}
 
-	switch {
-	case crypter.IsUseArmoredKey:
-		evaluatedKey := strings.Replace(crypter.ArmoredKey, `\n`, "\n", -1)
-		entityList, err := openpgp.ReadArmoredKeyRing(strings.NewReader(evaluatedKey))
-
-		if err != nil {
-			return err
-		}
-
-		crypter.PubKey = entityList
-
-	case crypter.IsUseArmoredKeyPath:
-		entityList, err := readPGPKey(crypter.ArmoredKeyPath)
-
-		if err != nil {
-			return err
-		}
-
-		crypter.PubKey = entityList
-
-	default:
-		// TODO: legacy gpg external use, need to remove in next major version
-		armor, err := crypto.GetPubRingArmor(crypter.KeyRingID)
-
-		if err != nil {
-			return err
-		}
-
-		entityList, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(armor))
+	entityList, err := crypter.readKeyRing(crypto.GetPubRingArmor)
+	if err != nil {
+		return err
+	}
+	logLoadedKeys("public", entityList)
+	crypter.PubKey = entityList
+	return nil
+}
 
-		if err != nil {
-			return err
-		}
+// LoadKeys reads the public key, the secret key is loaded only for the decryption
+// since the public key is enough to upload
+func (crypter *Crypter) LoadKeys() error {
+	return crypter.setupPubKey()
+}
 
-		crypter.PubKey = entityList
+// LoadDecryptionKeys reads and unlocks the secret key, the key holder keeps the keys itself
+func (crypter *Crypter) LoadDecryptionKeys() error {
+	if crypter.KeyHolder != nil {
+		return nil
 	}
-	return nil
+	return crypter.loadSecret()
 }
 
 // Encrypt creates encryption writer from ordinary writer
@@ -113,13 +111,22 @@ func (crypter *Crypter) Encrypt(writer io.Writer) (io.WriteCloser, error) {
 	if err != nil {
 		return nil, err
 	}
+	if crypto.IsFIPSMode() {
+		if err := crypter.CheckApprovedAlgorithms(); err != nil {
+			return nil, err
+		}
+	}
 
 	// We use buffered writer because encryption starts writing header immediately,
 	// which can be inappropriate for further usage with blocking writers.
 	// E. g. if underlying writer is a pipe, then this thread will be blocked before
 	// creation of new thread, reading from this pipe.Writer.
+	recipients, err := encryptionEntities(crypter.PubKey, time.Now())
+	if err != nil {
+		return nil, err
+	}
 	bufferedWriter := bufio.NewWriter(writer)
-	encryptedWriter, err := openpgp.Encrypt(bufferedWriter, crypter.PubKey, nil, nil, nil)
+	encryptedWriter, err := openpgp.Encrypt(bufferedWriter, recipients, nil, nil, fipsConfig())
 
 	if err != nil {
 		return nil, errors.Wrapf(err, "opengpg encryption error")
@@ -130,19 +137,117 @@ func (crypter *Crypter) Encrypt(writer io.Writer) (io.WriteCloser, error) {
 
 // Decrypt creates decrypted reader from ordinary reader
 func (crypter *Crypter) Decrypt(reader io.Reader) (io.Reader, error) {
+	if crypter.KeyHolder != nil {
+		return crypter.decryptWithKeyHolder(reader)
+	}
 	err := crypter.loadSecret()
 
 	if err != nil {
 		return nil, err
 	}
 
-	md, err := openpgp.ReadMessage(reader, crypter.SecretKey, nil, nil)
+	bufferedReader := bufio.NewReader(reader)
+	header, _ := bufferedReader.Peek(crypto.EncryptionHeaderLength)
+	md, err := openpgp.ReadMessage(bufferedReader, newDecryptionKeyRing(crypter.SecretKey), nil, nil)
 
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, errors.WithStack(classifyMessageError(err, header))
 	}
 
-	return md.UnverifiedBody, nil
+	return &bodyReader{md.UnverifiedBody}, nil
+}
+
+// classifyMessageError adds the crypto error kind to the failure to read the message start
+func classifyMessageError(err error, header []byte) error {
+	switch format := crypto.DetectEncryption(header); {
+	case err == pgperrors.ErrKeyIncorrect:
+		return errors.Wrap(crypto.ErrWrongKey, err.Error())
+	case format == "" && len(header) > 0:
+		return errors.Wrap(crypto.ErrNotEncrypted, err.Error())
+	case format != crypto.OpenPGPFormat && format != "":
+		return errors.Wrapf(crypto.ErrWrongKey, "the data is %s encrypted, not OpenPGP", format)
+	case isCorruptionError(err):
+		return errors.Wrap(crypto.ErrCorruptCiphertext, err.Error())
+	default:
+		return err
+	}
+}
+
+// isCorruptionError tells the malformed packets and the MDC mismatch from the errors of the underlying reader.
+// The message which ends too early isn't the corruption: the truncated download ends the same way and is retried.
+func isCorruptionError(err error) bool {
+	switch err.(type) {
+	// the MDC mismatch of the damaged body is reported as SignatureError
+	case pgperrors.StructuralError, pgperrors.SignatureError, pgperrors.UnsupportedError, pgperrors.UnknownPacketTypeError:
+		return true
+	}
+	return false
+}
+
+// bodyReader reports the damaged message body as crypto.ErrCorruptCiphertext
+type bodyReader struct {
+	io.Reader
+}
+
+func (reader *bodyReader) Read(p []byte) (int, error) {
+	n, err := reader.Reader.Read(p)
+	if err != nil && err != io.EOF && isCorruptionError(err) {
+		err = errors.Wrap(crypto.ErrCorruptCiphertext, err.Error())
+	}
+	return n, err
+}
+
+// RecipientKeyIDs returns the IDs of the keys from the public-key encrypted session key packets
+// which the OpenPGP message starts with
+func (crypter *Crypter) RecipientKeyIDs(header []byte) []string {
+	if crypto.DetectEncryption(header) != crypto.OpenPGPFormat {
+		return nil
+	}
+	packets := packet.NewReader(bytes.NewReader(header))
+	var keyIDs []string
+	for {
+		p, err := packets.Next()
+		if err != nil {
+			return keyIDs
+		}
+		encryptedKey, ok := p.(*packet.EncryptedKey)
+		if !ok {
+			return keyIDs
+		}
+		keyIDs = append(keyIDs, formatKeyID(encryptedKey.KeyId))
+	}
+}
+
+// DecryptionKeyIDs returns the IDs of the secret keys and subkeys,
+// or of the keys the key holder decrypts with if it is set
+func (crypter *Crypter) DecryptionKeyIDs() ([]string, error) {
+	if crypter.KeyHolder != nil {
+		return crypter.keyHolderKeyIDs()
+	}
+	err := crypter.loadSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	crypter.mutex.RLock()
+	defer crypter.mutex.RUnlock()
+	var keyIDs []string
+	for _, entity := range crypter.SecretKey {
+		if entity.PrivateKey != nil {
+			keyIDs = append(keyIDs, formatKeyID(entity.PrivateKey.KeyId))
+		}
+		for _, subkey := range entity.Subkeys {
+			if subkey.PrivateKey != nil {
+				keyIDs = append(keyIDs, formatKeyID(subkey.PrivateKey.KeyId))
+			}
+		}
+	}
+	return keyIDs, nil
+}
+
+// formatKeyID formats the key ID as gpg --list-keys --keyid-format long does
+func formatKeyID(keyID uint64) string {
+	return fmt.Sprintf("%016X", keyID)
 }
 
 // load the secret key based on the settings
@@ -165,46 +270,47 @@ func (crypter *Crypter) loadSecret() error {
 		return nil
 	}
 
-	if crypter.IsUseArmoredKey {
-		evaluatedKey := strings.Replace(crypter.ArmoredKey, `\n`, "\n", -1)
-		entityList, err := openpgp.ReadArmoredKeyRing(strings.NewReader(evaluatedKey))
-
-		if err != nil {
-			return errors.WithStack(err)
-		}
-
-		crypter.SecretKey = entityList
-	} else if crypter.IsUseArmoredKeyPath {
-		entityList, err := readPGPKey(crypter.ArmoredKeyPath)
-
-		if err != nil {
-			return errors.WithStack(err)
-		}
-
-		crypter.SecretKey = entityList
-	} else {
-		// TODO: legacy gpg external use, need to remove in next major version
-		armor, err := crypto.GetSecretRingArmor(crypter.KeyRingID)
-
-		if err != nil {
-			return errors.WithStack(err)
-		}
+	entityList, err := crypter.readKeyRing(crypto.GetSecretRingArmor)
+	if err != nil {
+		return errors.WithStack(err)
+	}
 
-		entityList, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(armor))
+	passphrase, hasPassphrase := crypter.loadPassphrase()
+	err = checkPrivateKeys(entityList, hasPassphrase)
+	if err != nil {
+		return err
+	}
+	if hasPassphrase {
+		err = decryptSecretKey(entityList, passphrase)
 
 		if err != nil {
-			return errors.WithStack(err)
+			return err
 		}
-
-		crypter.SecretKey = entityList
 	}
+	logLoadedKeys("private", entityList)
+	crypter.SecretKey = entityList
+	return nil
+}
 
-	if passphrase, ok := crypter.loadPassphrase(); ok {
-		err := decryptSecretKey(crypter.SecretKey, passphrase)
-
+// readKeyRing reads the key from the configured source,
+// the legacy key ring ID is exported from the gpg keyring by gpgExport
+func (crypter *Crypter) readKeyRing(gpgExport func(keyID string) ([]byte, error)) (openpgp.EntityList, error) {
+	switch {
+	case crypter.IsUseArmoredKey:
+		key := crypter.ArmoredKey
+		if strings.Contains(key, armorPrefix) {
+			// the multiline key is often put in the environment with escaped line breaks
+			key = strings.Replace(key, `\n`, "\n", -1)
+		}
+		return parseKeyRing([]byte(key))
+	case crypter.IsUseArmoredKeyPath:
+		return readPGPKey(crypter.ArmoredKeyPath)
+	default:
+		// TODO: legacy gpg external use, need to remove in next major version
+		armor, err := gpgExport(crypter.KeyRingID)
 		if err != nil {
-			return errors.WithStack(err)
+			return nil, err
 		}
+		return parseKeyRing(armor)
 	}
-	return nil
 }
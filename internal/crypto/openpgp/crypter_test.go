@@ -2,11 +2,14 @@ package openpgp
 
 import (
 	"bytes"
+	"errors"
 	"io/ioutil"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/wal-g/wal-g/internal/crypto"
+	"golang.org/x/crypto/openpgp"
 )
 
 var pgpTestPrivateKey string
@@ -68,3 +71,98 @@ func TestEncryptionCycleFromEnv(t *testing.T) {
 func TestEncryptionCycleFromKeyPath(t *testing.T) {
 	EncryptionCycle(t, MockArmedCrypterFromKeyPath())
 }
+
+func TestEncryptedDataIsDetected(t *testing.T) {
+	buf := new(bytes.Buffer)
+	encrypt, err := MockArmedCrypterFromKeyPath().Encrypt(buf)
+	assert.NoError(t, err)
+	_, err = encrypt.Write([]byte("so very secret thingy"))
+	assert.NoError(t, err)
+	assert.NoError(t, encrypt.Close())
+
+	assert.Equal(t, crypto.OpenPGPFormat, crypto.DetectEncryption(buf.Bytes()))
+}
+
+// sha256HashID is the OpenPGP ID of SHA-256, RFC 4880 section 9.4
+const sha256HashID = 8
+
+func generatedKeyCrypter(t *testing.T, name string) *Crypter {
+	entity, err := openpgp.NewEntity(name, "", name+"@example.com", nil)
+	assert.NoError(t, err)
+	for _, identity := range entity.Identities {
+		// the generated self-signature prefers RIPEMD160, which isn't compiled in
+		identity.SelfSignature.PreferredHash = []uint8{sha256HashID}
+	}
+	entityList := openpgp.EntityList{entity}
+	return &Crypter{PubKey: entityList, SecretKey: entityList}
+}
+
+func encrypt(t *testing.T, crypter crypto.Crypter, data string) []byte {
+	buf := new(bytes.Buffer)
+	writer, err := crypter.Encrypt(buf)
+	assert.NoError(t, err)
+	_, err = writer.Write([]byte(data))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func TestMultiCrypter_keyRotation(t *testing.T) {
+	oldCrypter := generatedKeyCrypter(t, "old")
+	newCrypter := generatedKeyCrypter(t, "new")
+	oldBackup := encrypt(t, oldCrypter, "old backup")
+
+	crypter := crypto.NewMultiCrypter(newCrypter, oldCrypter)
+	newBackup := encrypt(t, crypter, "new backup")
+	assert.Equal(t, newCrypter.RecipientKeyIDs(newBackup), newCrypter.RecipientKeyIDs(encrypt(t, newCrypter, "")))
+
+	for encrypted, expected := range map[string][]byte{"old backup": oldBackup, "new backup": newBackup} {
+		reader, err := crypter.Decrypt(bytes.NewReader(expected))
+		assert.NoError(t, err)
+		decrypted, err := ioutil.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, encrypted, string(decrypted))
+	}
+
+	_, err := crypto.NewMultiCrypter(newCrypter).Decrypt(bytes.NewReader(oldBackup))
+	var noMatchingKeyError crypto.NoMatchingKeyError
+	assert.True(t, errors.As(err, &noMatchingKeyError))
+	assert.Equal(t, oldCrypter.RecipientKeyIDs(oldBackup), noMatchingKeyError.KeyIDs)
+	assert.Contains(t, err.Error(), noMatchingKeyError.KeyIDs[0])
+}
+
+func TestRecipientKeyIDs(t *testing.T) {
+	crypter := generatedKeyCrypter(t, "test")
+	keyIDs, err := crypter.DecryptionKeyIDs()
+	assert.NoError(t, err)
+	// the message is encrypted to the encryption subkey
+	recipients := crypter.RecipientKeyIDs(encrypt(t, crypter, "data"))
+	assert.Len(t, recipients, 1)
+	assert.Contains(t, keyIDs, recipients[0])
+	assert.Len(t, recipients[0], 16)
+
+	assert.Empty(t, crypter.RecipientKeyIDs([]byte("not encrypted")))
+}
+
+func TestDecrypt_typedErrors(t *testing.T) {
+	crypter := generatedKeyCrypter(t, "test")
+	message := encrypt(t, crypter, strings.Repeat("backup data ", 1000))
+
+	_, err := generatedKeyCrypter(t, "other").Decrypt(bytes.NewReader(message))
+	assert.True(t, errors.Is(err, crypto.ErrWrongKey), "unexpected error: %v", err)
+
+	_, err = crypter.Decrypt(strings.NewReader("PGDMP plain pg_dump output"))
+	assert.True(t, errors.Is(err, crypto.ErrNotEncrypted), "unexpected error: %v", err)
+
+	damaged := append([]byte{}, message...)
+	damaged[len(damaged)-10] ^= 0xff
+	reader, err := crypter.Decrypt(bytes.NewReader(damaged))
+	if err == nil {
+		_, err = ioutil.ReadAll(reader)
+	}
+	assert.True(t, errors.Is(err, crypto.ErrCorruptCiphertext), "unexpected error: %v", err)
+
+	// the decryption by the multi crypter without the key is the wrong key as well
+	_, err = crypto.NewMultiCrypter(generatedKeyCrypter(t, "other")).Decrypt(bytes.NewReader(message))
+	assert.True(t, errors.Is(err, crypto.ErrWrongKey), "unexpected error: %v", err)
+}
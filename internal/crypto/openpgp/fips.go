@@ -0,0 +1,67 @@
+package openpgp
+
+import (
+	"github.com/pkg/errors"
+	"github.com/wal-g/wal-g/internal/crypto"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// fipsConfig makes the message cipher AES-256 whenever the recipient keys allow it,
+// the other ciphers are left to the key preferences by the default config
+func fipsConfig() *packet.Config {
+	if !crypto.IsFIPSMode() {
+		return nil
+	}
+	return &packet.Config{DefaultCipher: packet.CipherAES256}
+}
+
+// CheckApprovedAlgorithms checks that the messages to the key are encrypted by the FIPS-approved algorithms.
+// The message cipher is chosen by the preferences of the recipient key, so they must include AES,
+// and the ElGamal encryption keys aren't approved.
+func (crypter *Crypter) CheckApprovedAlgorithms() error {
+	err := crypter.setupPubKey()
+	if err != nil {
+		return err
+	}
+
+	crypter.mutex.RLock()
+	defer crypter.mutex.RUnlock()
+	for _, entity := range crypter.PubKey {
+		if err := checkApprovedEntity(entity); err != nil {
+			return errors.Wrapf(err, "PGP key %X", entity.PrimaryKey.Fingerprint)
+		}
+	}
+	return nil
+}
+
+func checkApprovedEntity(entity *openpgp.Entity) error {
+	keys := []*packet.PublicKey{entity.PrimaryKey}
+	for _, subkey := range entity.Subkeys {
+		keys = append(keys, subkey.PublicKey)
+	}
+	for _, key := range keys {
+		if key.PubKeyAlgo == packet.PubKeyAlgoElGamal {
+			return errors.Errorf("ElGamal key %s is not FIPS-approved", formatKeyID(key.KeyId))
+		}
+	}
+
+	for name, identity := range entity.Identities {
+		if identity.SelfSignature == nil || !prefersAES(identity.SelfSignature.PreferredSymmetric) {
+			return errors.Errorf("the cipher preferences of %s don't include AES", name)
+		}
+	}
+	return nil
+}
+
+// prefersAES tells whether x/crypto/openpgp encrypts with AES to the key with the preferences,
+// it only supports AES and CAST5, and CAST5 is implied when there are no preferences
+func prefersAES(preferredSymmetric []uint8) bool {
+	for _, cipher := range preferredSymmetric {
+		switch packet.CipherFunction(cipher) {
+		case packet.CipherAES128, packet.CipherAES256:
+			return true
+		}
+	}
+	return false
+}
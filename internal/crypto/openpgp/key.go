@@ -2,56 +2,152 @@ package openpgp
 
 import (
 	"bytes"
-	"io"
+	"fmt"
 	"io/ioutil"
+	"strings"
 
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
 	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
 )
 
-func readKey(path string) (io.Reader, error) {
-	byteData, err := ioutil.ReadFile(path)
+// armorPrefix starts every ASCII-armored block, the key data without it is read as a binary keyring
+const armorPrefix = "-----BEGIN PGP "
 
-	if err != nil {
-		return nil, err
+type InvalidKeyError struct {
+	error
+}
+
+func newInvalidKeyError(reason string, cause error) InvalidKeyError {
+	if cause == nil {
+		return InvalidKeyError{errors.Errorf("invalid PGP key: %s", reason)}
 	}
+	return InvalidKeyError{errors.Errorf("invalid PGP key: %s: %v", reason, cause)}
+}
 
-	return bytes.NewReader(byteData), nil
+func (err InvalidKeyError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
 }
 
-func readPGPKey(path string) (openpgp.EntityList, error) {
-	gpgKeyReader, err := readKey(path)
+type NoPrivateKeyError struct {
+	error
+}
 
+func newNoPrivateKeyError(entityList openpgp.EntityList) NoPrivateKeyError {
+	return NoPrivateKeyError{errors.Errorf(
+		"the PGP key %s is a public key, decryption requires the private key", strings.Join(fingerprints(entityList), ", "))}
+}
+
+func (err NoPrivateKeyError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+func readPGPKey(path string) (openpgp.EntityList, error) {
+	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
+	return parseKeyRing(data)
+}
+
+// parseKeyRing reads a single key or a keyring, either ASCII-armored or binary.
+// The concatenated armored blocks, e.g. the exported public and private keys, make a single keyring.
+func parseKeyRing(data []byte) (openpgp.EntityList, error) {
+	data = bytes.TrimSpace(data)
+	if !bytes.Contains(data, []byte(armorPrefix)) {
+		entityList, err := openpgp.ReadKeyRing(bytes.NewReader(data))
+		if err != nil {
+			return nil, newInvalidKeyError("the key is neither an ASCII-armored key block nor a binary OpenPGP key", err)
+		}
+		return entityList, nil
+	}
 
-	entityList, err := openpgp.ReadArmoredKeyRing(gpgKeyReader)
+	var entityList openpgp.EntityList
+	blocks := bytes.Split(data, []byte(armorPrefix))
+	for _, blockData := range blocks[1:] {
+		blockEntities, err := parseArmoredBlock(append([]byte(armorPrefix), blockData...))
+		if err != nil {
+			return nil, err
+		}
+		entityList = append(entityList, blockEntities...)
+	}
+	return entityList, nil
+}
 
+func parseArmoredBlock(data []byte) (openpgp.EntityList, error) {
+	block, err := armor.Decode(bytes.NewReader(data))
 	if err != nil {
-		return nil, err
+		return nil, newInvalidKeyError("the ASCII armor is damaged", err)
+	}
+	if block.Type != openpgp.PublicKeyType && block.Type != openpgp.PrivateKeyType {
+		return nil, newInvalidKeyError(fmt.Sprintf("the armored block is a %s, not a key", block.Type), nil)
+	}
+	entityList, err := openpgp.ReadKeyRing(block.Body)
+	if err != nil {
+		return nil, newInvalidKeyError(fmt.Sprintf("can't read the %s", block.Type), err)
 	}
-
 	return entityList, nil
 }
 
+// privateKeys returns the private keys and subkeys of the keyring
+func privateKeys(entityList openpgp.EntityList) []*packet.PrivateKey {
+	var keys []*packet.PrivateKey
+	for _, entity := range entityList {
+		if entity.PrivateKey != nil {
+			keys = append(keys, entity.PrivateKey)
+		}
+		for _, subKey := range entity.Subkeys {
+			if subKey.PrivateKey != nil {
+				keys = append(keys, subKey.PrivateKey)
+			}
+		}
+	}
+	return keys
+}
+
+// checkPrivateKeys tells the public key supplied in place of the private one
+// and the passphrase-protected keys without the passphrase
+func checkPrivateKeys(entityList openpgp.EntityList, hasPassphrase bool) error {
+	keys := privateKeys(entityList)
+	if len(keys) == 0 {
+		return newNoPrivateKeyError(entityList)
+	}
+	if hasPassphrase {
+		return nil
+	}
+	for _, key := range keys {
+		if !key.Encrypted {
+			return nil
+		}
+	}
+	return newInvalidKeyError(fmt.Sprintf("the private key %s is protected by a passphrase, which isn't set",
+		strings.Join(fingerprints(entityList), ", ")), nil)
+}
+
 func decryptSecretKey(entityList openpgp.EntityList, passphrase string) error {
 	passphraseBytes := []byte(passphrase)
 
-	for _, entity := range entityList {
-		err := entity.PrivateKey.Decrypt(passphraseBytes)
+	for _, key := range privateKeys(entityList) {
+		err := key.Decrypt(passphraseBytes)
 
 		if err != nil {
-			return err
+			return newInvalidKeyError(fmt.Sprintf("can't unlock the private key %X with the passphrase", key.Fingerprint), err)
 		}
+	}
 
-		for _, subKey := range entity.Subkeys {
-			err := subKey.PrivateKey.Decrypt(passphraseBytes)
+	return nil
+}
 
-			if err != nil {
-				return err
-			}
-		}
+func fingerprints(entityList openpgp.EntityList) []string {
+	result := make([]string, 0, len(entityList))
+	for _, entity := range entityList {
+		result = append(result, fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint))
 	}
+	return result
+}
 
-	return nil
+func logLoadedKeys(kind string, entityList openpgp.EntityList) {
+	tracelog.DebugLogger.Printf("Loaded PGP %s key %s", kind, strings.Join(fingerprints(entityList), ", "))
 }
@@ -0,0 +1,375 @@
+package openpgp
+
+import (
+	"bufio"
+	"crypto/rsa"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/crypto"
+	"golang.org/x/crypto/openpgp"
+	pgperrors "golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// KeyHolder keeps the secret RSA key out of the process, e.g. on the smartcard, and decrypts the session keys
+// of the messages with it, while the messages themselves are decrypted in-process.
+// The crypter asks it for one message at a time.
+type KeyHolder interface {
+	Name() string
+	// DecryptSessionKey decrypts the session key, which is encrypted to the key and is as long as its modulus,
+	// and returns it without the PKCS #1 v1.5 padding
+	DecryptSessionKey(key *rsa.PublicKey, ciphertext []byte) ([]byte, error)
+}
+
+// KeyHolderError is the failure of the key holder which the retries don't fix,
+// like the wrong or cancelled PIN entry and the card removed during the restore
+type KeyHolderError struct {
+	error
+}
+
+func newKeyHolderError(holder string, reason string) KeyHolderError {
+	return KeyHolderError{errors.Wrapf(crypto.ErrKeyUnavailable, "%s: %s", holder, reason)}
+}
+
+func (err KeyHolderError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+func (err KeyHolderError) Unwrap() error {
+	return err.error
+}
+
+// CrypterFromKeyWithHolder creates Crypter from armored public key, the session keys are decrypted by the key holder
+func CrypterFromKeyWithHolder(armoredKey string, holder KeyHolder) crypto.Crypter {
+	return &Crypter{ArmoredKey: armoredKey, IsUseArmoredKey: true, KeyHolder: holder}
+}
+
+// CrypterFromKeyPathWithHolder creates Crypter from armored public key path,
+// the session keys are decrypted by the key holder
+func CrypterFromKeyPathWithHolder(armoredKeyPath string, holder KeyHolder) crypto.Crypter {
+	return &Crypter{ArmoredKeyPath: armoredKeyPath, IsUseArmoredKeyPath: true, KeyHolder: holder}
+}
+
+// decryptWithKeyHolder reads the message as openpgp.ReadMessage does, except that the session key
+// is decrypted by the key holder with the secret key matching the public one
+func (crypter *Crypter) decryptWithKeyHolder(reader io.Reader) (io.Reader, error) {
+	err := crypter.setupPubKey()
+	if err != nil {
+		return nil, err
+	}
+
+	bufferedReader := bufio.NewReader(reader)
+	header, _ := bufferedReader.Peek(crypto.EncryptionHeaderLength)
+	sessionKeys, err := readEncryptedSessionKeys(bufferedReader)
+	if err != nil {
+		return nil, errors.WithStack(classifyMessageError(err, header))
+	}
+	cipherFunc, key, err := crypter.decryptSessionKey(sessionKeys)
+	if err != nil {
+		return nil, err
+	}
+	body, err := readLiteralData(bufferedReader, cipherFunc, key)
+	if err != nil {
+		return nil, errors.WithStack(classifyMessageError(err, header))
+	}
+	return &bodyReader{body}, nil
+}
+
+// decryptSessionKey asks the key holder to decrypt the session keys encrypted to the public key
+// until one of them is decrypted, e.g. the message may be encrypted to several keys of which the card holds one.
+// The holder is used by one file at a time, so the card isn't asked for the PIN concurrently,
+// and once it fails permanently the rest of the files fail without asking again.
+func (crypter *Crypter) decryptSessionKey(sessionKeys []encryptedSessionKey) (packet.CipherFunction, []byte, error) {
+	crypter.keyHolderMutex.Lock()
+	defer crypter.keyHolderMutex.Unlock()
+	if crypter.keyHolderFailure != nil {
+		return 0, nil, crypter.keyHolderFailure
+	}
+
+	crypter.mutex.RLock()
+	keys := keyHolderKeys(crypter.PubKey)
+	crypter.mutex.RUnlock()
+	var lastErr error
+	for _, sessionKey := range sessionKeys {
+		for _, key := range keys {
+			if sessionKey.ciphertext == nil || (sessionKey.keyID != key.KeyId && sessionKey.keyID != 0) {
+				continue
+			}
+			rsaKey := key.PublicKey.(*rsa.PublicKey)
+			plaintext, err := crypter.KeyHolder.DecryptSessionKey(rsaKey, leftPad(sessionKey.ciphertext, rsaKey.Size()))
+			var keyHolderError KeyHolderError
+			if errors.As(err, &keyHolderError) {
+				crypter.keyHolderFailure = err
+				return 0, nil, errors.Wrapf(err, "failed to decrypt the session key with PGP key %s", formatKeyID(key.KeyId))
+			}
+			if err != nil {
+				lastErr = errors.Wrapf(err, "failed to decrypt the session key with PGP key %s", formatKeyID(key.KeyId))
+				continue
+			}
+			cipherFunc, sessionKeyBytes, err := parseSessionKey(plaintext)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			return cipherFunc, sessionKeyBytes, nil
+		}
+	}
+	if lastErr != nil {
+		return 0, nil, lastErr
+	}
+	return 0, nil, errors.Wrapf(crypto.ErrWrongKey, "%s holds none of the keys the message is encrypted to",
+		crypter.KeyHolder.Name())
+}
+
+// keyHolderKeys returns the RSA keys and subkeys which the key holder may have the secret keys of
+func keyHolderKeys(entityList openpgp.EntityList) []*packet.PublicKey {
+	var keys []*packet.PublicKey
+	for _, entity := range entityList {
+		if isKeyHolderKey(entity.PrimaryKey) {
+			keys = append(keys, entity.PrimaryKey)
+		}
+		for _, subkey := range entity.Subkeys {
+			if isKeyHolderKey(subkey.PublicKey) {
+				keys = append(keys, subkey.PublicKey)
+			}
+		}
+	}
+	return keys
+}
+
+func isKeyHolderKey(key *packet.PublicKey) bool {
+	_, isRSA := key.PublicKey.(*rsa.PublicKey)
+	return isRSA && key.PubKeyAlgo.CanEncrypt()
+}
+
+// encryptedSessionKey is the public-key encrypted session key packet, RFC 4880 section 5.1.
+// It is parsed here since packet.EncryptedKey keeps the ciphertext to itself and decrypts it only in-process.
+type encryptedSessionKey struct {
+	keyID uint64
+	// ciphertext is nil unless the session key is encrypted with RSA
+	ciphertext []byte
+}
+
+const encryptedSessionKeyTag = 1
+
+// readEncryptedSessionKeys reads the session key packets the message starts with,
+// and leaves the reader at the encrypted data packet which follows them
+func readEncryptedSessionKeys(reader *bufio.Reader) ([]encryptedSessionKey, error) {
+	var sessionKeys []encryptedSessionKey
+	for {
+		tag, err := peekPacketTag(reader)
+		if err != nil {
+			return nil, err
+		}
+		if tag != encryptedSessionKeyTag {
+			if len(sessionKeys) == 0 {
+				return nil, pgperrors.StructuralError("no session key packets in the message")
+			}
+			return sessionKeys, nil
+		}
+		bodyLength, err := readPacketLength(reader)
+		if err != nil {
+			return nil, err
+		}
+		body := make([]byte, bodyLength)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		sessionKey, err := parseEncryptedSessionKey(body)
+		if err != nil {
+			return nil, err
+		}
+		sessionKeys = append(sessionKeys, sessionKey)
+	}
+}
+
+// peekPacketTag returns the tag of the next packet without consuming it, RFC 4880 section 4.2
+func peekPacketTag(reader *bufio.Reader) (byte, error) {
+	header, err := reader.Peek(1)
+	if err != nil {
+		if err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	if header[0]&0x80 == 0 {
+		return 0, pgperrors.StructuralError("tag byte does not have MSB set")
+	}
+	if header[0]&0x40 == 0 {
+		// the old format packet keeps the length type in the lower bits of the tag
+		return (header[0] & 0x3f) >> 2, nil
+	}
+	return header[0] & 0x3f, nil
+}
+
+// readPacketLength consumes the packet header and returns the packet length,
+// the session key packets never have the partial or indeterminate length
+func readPacketLength(reader *bufio.Reader) (int, error) {
+	header, err := reader.ReadByte()
+	if err != nil {
+		return 0, io.ErrUnexpectedEOF
+	}
+	var length []byte
+	if header&0x40 == 0 {
+		lengthBytes := [...]int{1, 2, 4, 0}[header&3]
+		if lengthBytes == 0 {
+			return 0, pgperrors.StructuralError("session key packet of indeterminate length")
+		}
+		length = make([]byte, lengthBytes)
+	} else {
+		first, err := reader.ReadByte()
+		switch {
+		case err != nil:
+			return 0, io.ErrUnexpectedEOF
+		case first < 192:
+			return int(first), nil
+		case first < 224:
+			second, err := reader.ReadByte()
+			if err != nil {
+				return 0, io.ErrUnexpectedEOF
+			}
+			return (int(first)-192)<<8 + int(second) + 192, nil
+		case first < 255:
+			return 0, pgperrors.StructuralError("session key packet of partial length")
+		}
+		length = make([]byte, 4)
+	}
+	if _, err := io.ReadFull(reader, length); err != nil {
+		return 0, io.ErrUnexpectedEOF
+	}
+	var value uint32
+	for _, b := range length {
+		value = value<<8 | uint32(b)
+	}
+	return int(value), nil
+}
+
+func parseEncryptedSessionKey(body []byte) (encryptedSessionKey, error) {
+	const headerLength = 10 // version, key ID and algorithm
+	if len(body) < headerLength {
+		return encryptedSessionKey{}, io.ErrUnexpectedEOF
+	}
+	if body[0] != 3 {
+		return encryptedSessionKey{}, pgperrors.UnsupportedError(fmt.Sprintf("session key packet version %d", body[0]))
+	}
+	sessionKey := encryptedSessionKey{keyID: binary.BigEndian.Uint64(body[1:9])}
+	switch packet.PublicKeyAlgorithm(body[9]) {
+	case packet.PubKeyAlgoRSA, packet.PubKeyAlgoRSAEncryptOnly:
+		if len(body) < headerLength+2 {
+			return encryptedSessionKey{}, io.ErrUnexpectedEOF
+		}
+		bits := int(binary.BigEndian.Uint16(body[headerLength:]))
+		mpi := body[headerLength+2:]
+		if len(mpi) < (bits+7)/8 {
+			return encryptedSessionKey{}, io.ErrUnexpectedEOF
+		}
+		sessionKey.ciphertext = mpi[:(bits+7)/8]
+	}
+	return sessionKey, nil
+}
+
+// leftPad pads the ciphertext MPI, which drops the leading zeroes, to the key modulus size
+func leftPad(ciphertext []byte, size int) []byte {
+	if len(ciphertext) >= size {
+		return ciphertext
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(ciphertext):], ciphertext)
+	return padded
+}
+
+// parseSessionKey splits the decrypted session key into the cipher and the key and checks its checksum,
+// RFC 4880 section 5.1
+func parseSessionKey(plaintext []byte) (packet.CipherFunction, []byte, error) {
+	if len(plaintext) < 3 {
+		return 0, nil, errors.Wrap(crypto.ErrWrongKey, "the decrypted session key is too short")
+	}
+	cipherFunc := packet.CipherFunction(plaintext[0])
+	key := plaintext[1 : len(plaintext)-2]
+	if cipherFunc.KeySize() == 0 || cipherFunc.KeySize() != len(key) {
+		return 0, nil, errors.Wrapf(crypto.ErrWrongKey, "the decrypted session key of %d bytes is not of cipher %d",
+			len(key), cipherFunc)
+	}
+	var checksum uint16
+	for _, b := range key {
+		checksum += uint16(b)
+	}
+	if checksum != binary.BigEndian.Uint16(plaintext[len(plaintext)-2:]) {
+		return 0, nil, errors.Wrap(crypto.ErrWrongKey, "the decrypted session key checksum mismatch")
+	}
+	return cipherFunc, key, nil
+}
+
+// readLiteralData decrypts the encrypted data packet with the session key and returns the literal data
+// of the message, decompressing it if needed
+func readLiteralData(reader io.Reader, cipherFunc packet.CipherFunction, key []byte) (io.Reader, error) {
+	p, err := packet.NewReader(reader).Next()
+	if err != nil {
+		return nil, err
+	}
+	encryptedData, ok := p.(*packet.SymmetricallyEncrypted)
+	if !ok {
+		return nil, pgperrors.StructuralError("no encrypted data packet after the session keys")
+	}
+	decrypted, err := encryptedData.Decrypt(cipherFunc, key)
+	if err != nil {
+		return nil, err
+	}
+
+	packets := packet.NewReader(decrypted)
+	for {
+		p, err := packets.Next()
+		if err != nil {
+			return nil, err
+		}
+		switch p := p.(type) {
+		case *packet.Compressed:
+			if err := packets.Push(p.Body); err != nil {
+				return nil, err
+			}
+		case *packet.LiteralData:
+			return &integrityCheckingReader{body: p.Body, decrypted: decrypted}, nil
+		case *packet.OnePassSignature, *packet.Signature:
+			// the signatures aren't verified, as openpgp.ReadMessage doesn't without the keyring of the signer
+		default:
+			return nil, pgperrors.StructuralError(fmt.Sprintf("unexpected packet %T in the encrypted data", p))
+		}
+	}
+}
+
+// integrityCheckingReader checks the modification detection code of the encrypted data once the body is read
+type integrityCheckingReader struct {
+	body      io.Reader
+	decrypted io.ReadCloser
+	checked   bool
+}
+
+func (reader *integrityCheckingReader) Read(p []byte) (int, error) {
+	n, err := reader.body.Read(p)
+	if err == io.EOF && !reader.checked {
+		reader.checked = true
+		if closeErr := reader.decrypted.Close(); closeErr != nil {
+			return n, closeErr
+		}
+	}
+	return n, err
+}
+
+func (crypter *Crypter) keyHolderKeyIDs() ([]string, error) {
+	err := crypter.setupPubKey()
+	if err != nil {
+		return nil, err
+	}
+
+	crypter.mutex.RLock()
+	defer crypter.mutex.RUnlock()
+	var keyIDs []string
+	for _, key := range keyHolderKeys(crypter.PubKey) {
+		keyIDs = append(keyIDs, formatKeyID(key.KeyId))
+	}
+	return keyIDs, nil
+}
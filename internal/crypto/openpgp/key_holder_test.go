@@ -0,0 +1,163 @@
+package openpgp
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/crypto"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// inProcessKeyHolder decrypts the session keys with the secret key in memory, as the smartcard would
+type inProcessKeyHolder struct {
+	key   *rsa.PrivateKey
+	err   error
+	calls int
+}
+
+func (holder *inProcessKeyHolder) Name() string {
+	return "test key holder"
+}
+
+func (holder *inProcessKeyHolder) DecryptSessionKey(key *rsa.PublicKey, ciphertext []byte) ([]byte, error) {
+	holder.calls++
+	if holder.err != nil {
+		return nil, holder.err
+	}
+	if key.N.Cmp(holder.key.N) != 0 {
+		return nil, errors.New("no secret key for the public key")
+	}
+	if len(ciphertext) != key.Size() {
+		return nil, errors.Errorf("the ciphertext of %d bytes is not padded to the key size", len(ciphertext))
+	}
+	return rsa.DecryptPKCS1v15(nil, holder.key, ciphertext)
+}
+
+// keyHolderCrypter returns the crypter of the generated key and the one decrypting with its public key
+// and the key holder of its secret encryption subkey
+func keyHolderCrypter(t *testing.T) (*Crypter, *Crypter, *inProcessKeyHolder) {
+	generated := generatedKeyCrypter(t, "card")
+	holder := &inProcessKeyHolder{key: generated.SecretKey[0].Subkeys[0].PrivateKey.PrivateKey.(*rsa.PrivateKey)}
+	publicKey := serializeKey(t, generated, false, openpgp.PublicKeyType)
+	return generated, CrypterFromKeyWithHolder(publicKey, holder).(*Crypter), holder
+}
+
+func decryptAll(crypter crypto.Crypter, message []byte) (string, error) {
+	reader, err := crypter.Decrypt(bytes.NewReader(message))
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadAll(reader)
+	return string(data), err
+}
+
+func TestKeyHolder_decrypt(t *testing.T) {
+	generated, crypter, holder := keyHolderCrypter(t)
+
+	decrypted, err := decryptAll(crypter, encrypt(t, generated, "data"))
+	assert.NoError(t, err)
+	assert.Equal(t, "data", decrypted)
+	assert.Equal(t, 1, holder.calls)
+}
+
+func TestKeyHolder_compressedMessage(t *testing.T) {
+	generated, crypter, _ := keyHolderCrypter(t)
+	buf := new(bytes.Buffer)
+	writer, err := openpgp.Encrypt(buf, generated.PubKey, nil, nil, &packet.Config{DefaultCompressionAlgo: packet.CompressionZLIB})
+	require.NoError(t, err)
+	data := bytes.Repeat([]byte("compressed "), 10000)
+	_, err = writer.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	decrypted, err := decryptAll(crypter, buf.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, string(data), decrypted)
+}
+
+func TestKeyHolder_decryptionKeyIDs(t *testing.T) {
+	generated, crypter, _ := keyHolderCrypter(t)
+	keyIDs, err := crypter.DecryptionKeyIDs()
+	assert.NoError(t, err)
+	assert.Contains(t, keyIDs, recipientKeyID(t, generated))
+}
+
+func TestKeyHolder_typedErrors(t *testing.T) {
+	generated, crypter, _ := keyHolderCrypter(t)
+	message := encrypt(t, generated, "data")
+
+	_, err := decryptAll(crypter, encrypt(t, generatedKeyCrypter(t, "other"), "data"))
+	assert.True(t, errors.Is(err, crypto.ErrWrongKey), err)
+
+	_, err = decryptAll(crypter, []byte("plain text"))
+	assert.True(t, errors.Is(err, crypto.ErrNotEncrypted), err)
+
+	corrupt := append([]byte(nil), message...)
+	corrupt[len(corrupt)-5] ^= 0xff
+	_, err = decryptAll(crypter, corrupt)
+	assert.True(t, errors.Is(err, crypto.ErrCorruptCiphertext), err)
+
+	// the truncated message is retried like the interrupted download
+	_, err = decryptAll(crypter, message[:len(message)-10])
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF), err)
+	assert.False(t, errors.Is(err, crypto.ErrCorruptCiphertext), err)
+}
+
+func TestKeyHolder_permanentFailure(t *testing.T) {
+	generated, crypter, holder := keyHolderCrypter(t)
+	message := encrypt(t, generated, "data")
+	holder.err = newKeyHolderError("test key holder", "card removed")
+
+	_, err := crypter.Decrypt(bytes.NewReader(message))
+	assert.True(t, errors.Is(err, crypto.ErrKeyUnavailable), err)
+	var keyHolderError KeyHolderError
+	assert.True(t, errors.As(err, &keyHolderError))
+
+	// the next files fail without asking the key holder, even when the card is back
+	holder.err = nil
+	_, err = crypter.Decrypt(bytes.NewReader(message))
+	assert.True(t, errors.Is(err, crypto.ErrKeyUnavailable), err)
+	assert.Equal(t, 1, holder.calls)
+}
+
+func TestKeyHolder_transientFailure(t *testing.T) {
+	generated, crypter, holder := keyHolderCrypter(t)
+	message := encrypt(t, generated, "data")
+	holder.err = io.ErrClosedPipe
+
+	_, err := crypter.Decrypt(bytes.NewReader(message))
+	assert.True(t, errors.Is(err, io.ErrClosedPipe), err)
+
+	holder.err = nil
+	decrypted, err := decryptAll(crypter, message)
+	assert.NoError(t, err)
+	assert.Equal(t, "data", decrypted)
+	assert.Equal(t, 2, holder.calls)
+}
+
+func TestKeyHolder_severalRecipients(t *testing.T) {
+	generated, crypter, holder := keyHolderCrypter(t)
+	other := generatedKeyCrypter(t, "other")
+	// the card holds the second of the keys the message is encrypted to
+	recipients := openpgp.EntityList{other.PubKey[0], generated.PubKey[0]}
+	buf := new(bytes.Buffer)
+	writer, err := openpgp.Encrypt(buf, recipients, nil, nil, nil)
+	require.NoError(t, err)
+	_, err = writer.Write([]byte("data"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	require.NoError(t, crypter.setupPubKey())
+	crypter.PubKey = append(openpgp.EntityList{other.PubKey[0]}, crypter.PubKey...)
+
+	decrypted, err := decryptAll(crypter, buf.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, "data", decrypted)
+	assert.Equal(t, 2, holder.calls)
+}
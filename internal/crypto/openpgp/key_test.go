@@ -0,0 +1,112 @@
+package openpgp
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+const (
+	PassphraseKeyFilePath = "./testdata/pgpTestPassphraseKey"
+	testKeyPassphrase     = "walg-test"
+)
+
+func serializeKey(t *testing.T, crypter *Crypter, private bool, armorType string) string {
+	buf := new(bytes.Buffer)
+	var err error
+	if private {
+		err = crypter.SecretKey[0].SerializePrivate(buf, nil)
+	} else {
+		err = crypter.PubKey[0].Serialize(buf)
+	}
+	require.NoError(t, err)
+	if armorType == "" {
+		return buf.String()
+	}
+	armored := new(bytes.Buffer)
+	writer, err := armor.Encode(armored, armorType, nil)
+	require.NoError(t, err)
+	_, err = writer.Write(buf.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return armored.String()
+}
+
+func TestCrypterFromKey_keyFormats(t *testing.T) {
+	generated := generatedKeyCrypter(t, "test")
+	message := encrypt(t, generated, "data")
+	armoredPrivateKey := serializeKey(t, generated, true, openpgp.PrivateKeyType)
+	privateKeys := map[string]string{
+		"armored":                 armoredPrivateKey,
+		"binary":                  serializeKey(t, generated, true, ""),
+		"escaped line breaks":     strings.Replace(armoredPrivateKey, "\n", `\n`, -1),
+		"public and private keys": serializeKey(t, generated, false, openpgp.PublicKeyType) + armoredPrivateKey,
+	}
+	for name, key := range privateKeys {
+		t.Run(name, func(t *testing.T) {
+			reader, err := CrypterFromKey(key, noPassphrase).Decrypt(bytes.NewReader(message))
+			require.NoError(t, err)
+			decrypted, err := ioutil.ReadAll(reader)
+			require.NoError(t, err)
+			assert.Equal(t, "data", string(decrypted))
+		})
+	}
+
+	for _, publicKey := range []string{serializeKey(t, generated, false, openpgp.PublicKeyType), serializeKey(t, generated, false, "")} {
+		reader, err := generated.Decrypt(bytes.NewReader(encrypt(t, CrypterFromKey(publicKey, noPassphrase), "data")))
+		require.NoError(t, err)
+		decrypted, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, "data", string(decrypted))
+	}
+}
+
+func TestCrypterFromKey_publicKeyForDecryption(t *testing.T) {
+	generated := generatedKeyCrypter(t, "test")
+	publicKey := serializeKey(t, generated, false, openpgp.PublicKeyType)
+
+	_, err := CrypterFromKey(publicKey, noPassphrase).Decrypt(bytes.NewReader(encrypt(t, generated, "data")))
+	var noPrivateKeyError NoPrivateKeyError
+	require.True(t, errors.As(err, &noPrivateKeyError), "unexpected error: %v", err)
+	assert.Contains(t, err.Error(), fingerprints(generated.PubKey)[0])
+}
+
+func TestCrypterFromKey_invalidKeys(t *testing.T) {
+	for name, key := range map[string]string{
+		"garbage":         "not a key",
+		"damaged armor":   "-----BEGIN PGP PUBLIC KEY BLOCK-----\n\nnot base64\n-----END PGP PUBLIC KEY BLOCK-----\n",
+		"armored message": "-----BEGIN PGP MESSAGE-----\n\nwcBMA\n=AAAA\n-----END PGP MESSAGE-----\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := CrypterFromKey(key, noPassphrase).Encrypt(new(bytes.Buffer))
+			var invalidKeyError InvalidKeyError
+			assert.True(t, errors.As(err, &invalidKeyError), "unexpected error: %v", err)
+		})
+	}
+}
+
+func TestCrypterFromKeyPath_passphraseProtectedKey(t *testing.T) {
+	withPassphrase := func() (string, bool) { return testKeyPassphrase, true }
+	EncryptionCycle(t, CrypterFromKeyPath(PassphraseKeyFilePath, withPassphrase))
+
+	key, err := ioutil.ReadFile(PassphraseKeyFilePath)
+	require.NoError(t, err)
+	EncryptionCycle(t, CrypterFromKey(string(key), withPassphrase))
+
+	_, err = CrypterFromKeyPath(PassphraseKeyFilePath, noPassphrase).Decrypt(new(bytes.Buffer))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "protected by a passphrase")
+
+	wrongPassphrase := func() (string, bool) { return "wrong", true }
+	_, err = CrypterFromKeyPath(PassphraseKeyFilePath, wrongPassphrase).Decrypt(new(bytes.Buffer))
+	var invalidKeyError InvalidKeyError
+	assert.True(t, errors.As(err, &invalidKeyError), "unexpected error: %v", err)
+	assert.Contains(t, err.Error(), "can't unlock")
+}
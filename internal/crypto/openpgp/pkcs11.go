@@ -0,0 +1,156 @@
+//go:build pkcs11
+// +build pkcs11
+
+package openpgp
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/pkcs11"
+	"github.com/pkg/errors"
+	"github.com/wal-g/wal-g/internal/crypto"
+)
+
+// pkcs11KeyUnavailableCodes are the failures of the PIN and the token, e.g. the one removed during the restore
+var pkcs11KeyUnavailableCodes = map[pkcs11.Error]bool{
+	pkcs11.CKR_DEVICE_ERROR:           true,
+	pkcs11.CKR_DEVICE_REMOVED:         true,
+	pkcs11.CKR_FUNCTION_CANCELED:      true,
+	pkcs11.CKR_PIN_INCORRECT:          true,
+	pkcs11.CKR_PIN_INVALID:            true,
+	pkcs11.CKR_PIN_LEN_RANGE:          true,
+	pkcs11.CKR_PIN_EXPIRED:            true,
+	pkcs11.CKR_PIN_LOCKED:             true,
+	pkcs11.CKR_SESSION_CLOSED:         true,
+	pkcs11.CKR_SESSION_HANDLE_INVALID: true,
+	pkcs11.CKR_TOKEN_NOT_PRESENT:      true,
+	pkcs11.CKR_TOKEN_NOT_RECOGNIZED:   true,
+	pkcs11.CKR_USER_NOT_LOGGED_IN:     true,
+}
+
+// PKCS11KeyHolder decrypts the session keys with the RSA key on the token of the PKCS #11 module,
+// e.g. ykcs11 of the Yubikey or opensc-pkcs11. The session is opened by the first decryption and kept for the rest.
+type PKCS11KeyHolder struct {
+	modulePath string
+	tokenLabel string
+	pin        string
+
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+}
+
+// NewPKCS11KeyHolder creates the key holder using the token of the label, or the first token present if it is empty,
+// the PIN logs in unless the token authenticates by itself
+func NewPKCS11KeyHolder(modulePath, tokenLabel, pin string) *PKCS11KeyHolder {
+	return &PKCS11KeyHolder{modulePath: modulePath, tokenLabel: tokenLabel, pin: pin}
+}
+
+func (holder *PKCS11KeyHolder) Name() string {
+	return "PKCS #11 module " + holder.modulePath
+}
+
+func (holder *PKCS11KeyHolder) DecryptSessionKey(key *rsa.PublicKey, ciphertext []byte) ([]byte, error) {
+	if holder.ctx == nil {
+		if err := holder.openSession(); err != nil {
+			return nil, err
+		}
+	}
+	privateKey, err := holder.findPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	mechanism := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)}
+	if err = holder.ctx.DecryptInit(holder.session, mechanism, privateKey); err != nil {
+		return nil, holder.wrapError(err, "start the decryption")
+	}
+	plaintext, err := holder.ctx.Decrypt(holder.session, ciphertext)
+	if err != nil {
+		return nil, holder.wrapError(err, "decrypt")
+	}
+	return plaintext, nil
+}
+
+func (holder *PKCS11KeyHolder) openSession() error {
+	ctx := pkcs11.New(holder.modulePath)
+	if ctx == nil {
+		return errors.Errorf("failed to load PKCS #11 module %s", holder.modulePath)
+	}
+	session, err := openTokenSession(ctx, holder.tokenLabel, holder.pin)
+	if err != nil {
+		ctx.Destroy()
+		return holder.wrapError(err, "open the token session")
+	}
+	holder.ctx, holder.session = ctx, session
+	return nil
+}
+
+func openTokenSession(ctx *pkcs11.Ctx, tokenLabel string, pin string) (pkcs11.SessionHandle, error) {
+	if err := ctx.Initialize(); err != nil {
+		return 0, err
+	}
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, err
+	}
+	for _, slot := range slots {
+		if tokenLabel != "" {
+			tokenInfo, err := ctx.GetTokenInfo(slot)
+			if err != nil {
+				return 0, err
+			}
+			if strings.TrimSpace(tokenInfo.Label) != tokenLabel {
+				continue
+			}
+		}
+		session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+		if err != nil {
+			return 0, err
+		}
+		if pin != "" {
+			err = ctx.Login(session, pkcs11.CKU_USER, pin)
+			if err != nil && err != pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+				return 0, err
+			}
+		}
+		return session, nil
+	}
+	if tokenLabel != "" {
+		return 0, errors.Wrapf(pkcs11.Error(pkcs11.CKR_TOKEN_NOT_PRESENT), "no token labeled %s", tokenLabel)
+	}
+	return 0, pkcs11.Error(pkcs11.CKR_TOKEN_NOT_PRESENT)
+}
+
+// findPrivateKey finds the RSA private key of the token by the modulus of the public key
+func (holder *PKCS11KeyHolder) findPrivateKey(key *rsa.PublicKey) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_RSA),
+		pkcs11.NewAttribute(pkcs11.CKA_MODULUS, key.N.Bytes()),
+	}
+	if err := holder.ctx.FindObjectsInit(holder.session, template); err != nil {
+		return 0, holder.wrapError(err, "find the private key")
+	}
+	objects, _, err := holder.ctx.FindObjects(holder.session, 1)
+	finalErr := holder.ctx.FindObjectsFinal(holder.session)
+	if err == nil {
+		err = finalErr
+	}
+	if err != nil {
+		return 0, holder.wrapError(err, "find the private key")
+	}
+	if len(objects) == 0 {
+		return 0, errors.Wrapf(crypto.ErrWrongKey, "%s has no private key of the message", holder.Name())
+	}
+	return objects[0], nil
+}
+
+// wrapError reports the PIN and token failures as the permanent ones
+func (holder *PKCS11KeyHolder) wrapError(err error, action string) error {
+	var code pkcs11.Error
+	if errors.As(err, &code) && pkcs11KeyUnavailableCodes[code] {
+		return newKeyHolderError(holder.Name(), fmt.Sprintf("failed to %s: %v", action, err))
+	}
+	return errors.Wrapf(err, "%s failed to %s", holder.Name(), action)
+}
@@ -0,0 +1,158 @@
+package openpgp
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// expiresAt returns when the key bound by the signature expires, the lifetime counts from the key creation
+func expiresAt(key *packet.PublicKey, sig *packet.Signature) (time.Time, bool) {
+	if sig == nil || sig.KeyLifetimeSecs == nil || *sig.KeyLifetimeSecs == 0 {
+		return time.Time{}, false
+	}
+	return key.CreationTime.Add(time.Duration(*sig.KeyLifetimeSecs) * time.Second), true
+}
+
+func primarySelfSignature(entity *openpgp.Entity) *packet.Signature {
+	var selfSignature *packet.Signature
+	for _, identity := range entity.Identities {
+		if selfSignature == nil {
+			selfSignature = identity.SelfSignature
+		}
+		if identity.SelfSignature != nil && identity.SelfSignature.IsPrimaryId != nil && *identity.SelfSignature.IsPrimaryId {
+			return identity.SelfSignature
+		}
+	}
+	return selfSignature
+}
+
+// keyExpiry returns when the key expires: the subkey expires with its primary key too
+func keyExpiry(entity *openpgp.Entity, key *packet.PublicKey, sig *packet.Signature) (time.Time, bool) {
+	expiry, expires := expiresAt(entity.PrimaryKey, primarySelfSignature(entity))
+	if key == entity.PrimaryKey {
+		return expiry, expires
+	}
+	subkeyExpiry, subkeyExpires := expiresAt(key, sig)
+	if subkeyExpires && (!expires || subkeyExpiry.Before(expiry)) {
+		return subkeyExpiry, true
+	}
+	return expiry, expires
+}
+
+func isRevoked(sig *packet.Signature) bool {
+	return sig == nil || sig.SigType == packet.SigTypeSubkeyRevocation || sig.RevocationReason != nil
+}
+
+// canEncrypt tells whether the key is meant for the encryption: the flags, if any, allow either kind of it
+func canEncrypt(key *packet.PublicKey, sig *packet.Signature) bool {
+	return key.PubKeyAlgo.CanEncrypt() &&
+		(!sig.FlagsValid || sig.FlagEncryptCommunications || sig.FlagEncryptStorage)
+}
+
+// encryptionEntity returns the copy of the entity reduced to the key the messages are encrypted to:
+// the newest encryption subkey which is neither revoked nor expired, or the primary key
+// if there is no such subkey and the primary key can encrypt itself.
+// x/crypto/openpgp picks only the subkeys flagged for the communications, so the flags of the copy are adjusted.
+func encryptionEntity(entity *openpgp.Entity, now time.Time) (*openpgp.Entity, error) {
+	if len(entity.Revocations) > 0 {
+		return nil, newInvalidKeyError(fmt.Sprintf("the key %X is revoked", entity.PrimaryKey.Fingerprint), nil)
+	}
+	if expiry, expires := keyExpiry(entity, entity.PrimaryKey, nil); expires && !now.Before(expiry) {
+		return nil, newInvalidKeyError(fmt.Sprintf("the key %X expired at %s, the messages are not encrypted to it",
+			entity.PrimaryKey.Fingerprint, expiry.Format(time.RFC3339)), nil)
+	}
+
+	candidate := -1
+	for i, subkey := range entity.Subkeys {
+		if isRevoked(subkey.Sig) || !canEncrypt(subkey.PublicKey, subkey.Sig) {
+			continue
+		}
+		if expiry, expires := keyExpiry(entity, subkey.PublicKey, subkey.Sig); expires && !now.Before(expiry) {
+			continue
+		}
+		if candidate == -1 || subkey.Sig.CreationTime.After(entity.Subkeys[candidate].Sig.CreationTime) {
+			candidate = i
+		}
+	}
+
+	reduced := *entity
+	if candidate != -1 {
+		subkey := entity.Subkeys[candidate]
+		sig := *subkey.Sig
+		sig.FlagsValid, sig.FlagEncryptCommunications = true, true
+		subkey.Sig = &sig
+		reduced.Subkeys = []openpgp.Subkey{subkey}
+		return &reduced, nil
+	}
+
+	selfSignature := primarySelfSignature(entity)
+	if selfSignature == nil || !canEncrypt(entity.PrimaryKey, selfSignature) {
+		return nil, newInvalidKeyError(fmt.Sprintf("the key %X has no valid encryption subkey",
+			entity.PrimaryKey.Fingerprint), nil)
+	}
+	reduced.Subkeys = nil
+	reduced.Identities = make(map[string]*openpgp.Identity, len(entity.Identities))
+	for name, identity := range entity.Identities {
+		identityCopy := *identity
+		if identity.SelfSignature != nil && identity.SelfSignature.FlagsValid {
+			sig := *identity.SelfSignature
+			sig.FlagEncryptCommunications = true
+			identityCopy.SelfSignature = &sig
+		}
+		reduced.Identities[name] = &identityCopy
+	}
+	return &reduced, nil
+}
+
+func encryptionEntities(entityList openpgp.EntityList, now time.Time) (openpgp.EntityList, error) {
+	recipients := make(openpgp.EntityList, 0, len(entityList))
+	for _, entity := range entityList {
+		recipient, err := encryptionEntity(entity, now)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, nil
+}
+
+// decryptionKeyRing offers every secret key and subkey which can decrypt the message, including the primary key
+// and the subkeys without the encryption flags, which x/crypto/openpgp skips for the hidden recipients.
+// The revoked and expired keys still decrypt the messages encrypted to them before, so the old backups
+// stay restorable, they are only refused for the encryption.
+type decryptionKeyRing struct {
+	entities openpgp.EntityList
+}
+
+func newDecryptionKeyRing(entities openpgp.EntityList) *decryptionKeyRing {
+	return &decryptionKeyRing{entities: entities}
+}
+
+func (ring *decryptionKeyRing) KeysById(id uint64) []openpgp.Key {
+	return ring.entities.KeysById(id)
+}
+
+// KeysByIdUsage is used for the signatures, which WAL-G doesn't verify, so the keys are returned as is
+func (ring *decryptionKeyRing) KeysByIdUsage(id uint64, requiredUsage byte) []openpgp.Key {
+	return ring.entities.KeysByIdUsage(id, requiredUsage)
+}
+
+func (ring *decryptionKeyRing) DecryptionKeys() []openpgp.Key {
+	var keys []openpgp.Key
+	for _, entity := range ring.entities {
+		if entity.PrivateKey != nil && entity.PrimaryKey.PubKeyAlgo.CanEncrypt() {
+			keys = append(keys, openpgp.Key{Entity: entity, PublicKey: entity.PrimaryKey,
+				PrivateKey: entity.PrivateKey, SelfSignature: primarySelfSignature(entity)})
+		}
+		for _, subkey := range entity.Subkeys {
+			if subkey.PrivateKey != nil && subkey.PublicKey.PubKeyAlgo.CanEncrypt() {
+				keys = append(keys, openpgp.Key{Entity: entity, PublicKey: subkey.PublicKey,
+					PrivateKey: subkey.PrivateKey, SelfSignature: subkey.Sig})
+			}
+		}
+	}
+	return keys
+}
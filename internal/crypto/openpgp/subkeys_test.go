@@ -0,0 +1,114 @@
+package openpgp
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// addSubkey adds the encryption subkey of another generated key, its binding signature isn't verified in memory
+func addSubkey(t *testing.T, crypter *Crypter, created time.Time) *openpgp.Subkey {
+	donor := generatedKeyCrypter(t, "donor").PubKey[0]
+	subkey := donor.Subkeys[0]
+	sig := *subkey.Sig
+	sig.CreationTime = created
+	subkey.Sig = &sig
+	entity := crypter.PubKey[0]
+	entity.Subkeys = append(entity.Subkeys, subkey)
+	return &entity.Subkeys[len(entity.Subkeys)-1]
+}
+
+// expire makes the key created two hours ago expire in an hour
+func expire(key *packet.PublicKey, sig *packet.Signature) {
+	key.CreationTime = time.Now().Add(-2 * time.Hour)
+	lifetime := uint32(time.Hour / time.Second)
+	sig.KeyLifetimeSecs = &lifetime
+}
+
+func recipientKeyID(t *testing.T, crypter *Crypter) string {
+	recipients := crypter.RecipientKeyIDs(encrypt(t, crypter, "data"))
+	require.Len(t, recipients, 1)
+	return recipients[0]
+}
+
+func decryptString(crypter *Crypter, encrypted []byte) (string, error) {
+	reader, err := crypter.Decrypt(bytes.NewReader(encrypted))
+	if err != nil {
+		return "", err
+	}
+	decrypted, err := ioutil.ReadAll(reader)
+	return string(decrypted), err
+}
+
+func TestEncrypt_storageOnlySubkey(t *testing.T) {
+	crypter := generatedKeyCrypter(t, "storage")
+	subkey := crypter.PubKey[0].Subkeys[0]
+	subkey.Sig.FlagEncryptCommunications = false
+	subkey.Sig.FlagEncryptStorage = true
+
+	assert.Equal(t, formatKeyID(subkey.PublicKey.KeyId), recipientKeyID(t, crypter))
+	decrypted, err := decryptString(crypter, encrypt(t, crypter, "storage"))
+	assert.NoError(t, err)
+	assert.Equal(t, "storage", decrypted)
+}
+
+func TestEncrypt_newestValidSubkey(t *testing.T) {
+	crypter := generatedKeyCrypter(t, "subkeys")
+	valid := crypter.PubKey[0].Subkeys[0]
+	validKeyID := formatKeyID(valid.PublicKey.KeyId)
+
+	newer := addSubkey(t, crypter, valid.Sig.CreationTime.Add(time.Second))
+	assert.Equal(t, formatKeyID(newer.PublicKey.KeyId), recipientKeyID(t, crypter))
+
+	newer.Sig.SigType = packet.SigTypeSubkeyRevocation
+	assert.Equal(t, validKeyID, recipientKeyID(t, crypter), "the revoked subkey is skipped")
+
+	expired := addSubkey(t, crypter, valid.Sig.CreationTime.Add(2*time.Second))
+	expire(expired.PublicKey, expired.Sig)
+	assert.Equal(t, validKeyID, recipientKeyID(t, crypter), "the expired subkey is skipped")
+
+	expire(valid.PublicKey, valid.Sig)
+	_, err := crypter.Encrypt(new(bytes.Buffer))
+	assert.True(t, errors.As(err, &InvalidKeyError{}), "the signing primary key isn't used for the encryption")
+}
+
+func TestDecrypt_revokedSubkey(t *testing.T) {
+	crypter := generatedKeyCrypter(t, "revoked")
+	encrypted := encrypt(t, crypter, "before revocation")
+	crypter.PubKey[0].Subkeys[0].Sig.SigType = packet.SigTypeSubkeyRevocation
+
+	decrypted, err := decryptString(crypter, encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, "before revocation", decrypted)
+}
+
+func TestDecrypt_expiredSubkey(t *testing.T) {
+	crypter := generatedKeyCrypter(t, "expired")
+	encrypted := encrypt(t, crypter, "before expiry")
+	subkey := crypter.PubKey[0].Subkeys[0]
+	expire(subkey.PublicKey, subkey.Sig)
+
+	decrypted, err := decryptString(crypter, encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, "before expiry", decrypted)
+	_, err = crypter.Encrypt(new(bytes.Buffer))
+	assert.Error(t, err, "the expired key is never encrypted to")
+}
+
+func TestDecryptionKeyRing_primaryKey(t *testing.T) {
+	crypter := generatedKeyCrypter(t, "primary")
+	entity := crypter.SecretKey[0]
+	keys := newDecryptionKeyRing(crypter.SecretKey).DecryptionKeys()
+	keyIDs := make([]uint64, 0, len(keys))
+	for _, key := range keys {
+		keyIDs = append(keyIDs, key.PublicKey.KeyId)
+	}
+	assert.Equal(t, []uint64{entity.PrimaryKey.KeyId, entity.Subkeys[0].PublicKey.KeyId}, keyIDs)
+}
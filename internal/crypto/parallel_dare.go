@@ -0,0 +1,331 @@
+package crypto
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/minio/sio"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// The layout of the DARE 2.0 package: the header of the version, the cipher, the payload length minus one
+// and the nonce, whose first bit flags the final package, then the payload and the authentication tag
+const (
+	dareHeaderSize     = 16
+	dareTagSize        = 16
+	dareMaxPayloadSize = 1 << 16
+	dareFinalFlag      = 0x80
+
+	// darePackagesPerBatch packages, 256 KiB, are decrypted by one worker at a time
+	darePackagesPerBatch = 4
+)
+
+// The DARE stream failures are reported as ErrCorruptCiphertext, sio reports them by its unexported errors
+var (
+	errDareUnexpectedEOF  = errors.Wrap(ErrCorruptCiphertext, "DARE stream ends without the final package")
+	errDareUnexpectedData = errors.Wrap(ErrCorruptCiphertext, "unexpected data after the final DARE package")
+	errDareInvalidPackage = errors.Wrap(ErrCorruptCiphertext, "invalid DARE package header")
+	errDareNotAuthentic   = errors.Wrap(ErrCorruptCiphertext, "DARE package authentication failed")
+)
+
+var (
+	decryptionWorkersMutex sync.RWMutex
+	decryptionWorkers      = 1
+	// decryptionSlots bounds the packages decrypted at once by all the streams, so the concurrent downloads
+	// times the workers of every stream don't exceed the CPUs
+	decryptionSlots = make(chan struct{}, runtime.GOMAXPROCS(0))
+)
+
+// SetDecryptionWorkers sets how many goroutines decrypt every DARE stream of the KMS crypters,
+// 1 keeps the decryption sequential. The workers are capped by GOMAXPROCS.
+func SetDecryptionWorkers(workers int) {
+	if maxWorkers := runtime.GOMAXPROCS(0); workers > maxWorkers {
+		workers = maxWorkers
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	decryptionWorkersMutex.Lock()
+	defer decryptionWorkersMutex.Unlock()
+	decryptionWorkers = workers
+}
+
+func getDecryptionWorkers() int {
+	decryptionWorkersMutex.RLock()
+	defer decryptionWorkersMutex.RUnlock()
+	return decryptionWorkers
+}
+
+// DecryptDARE returns the reader of the data encrypted by sio in the DARE format. With several decryption workers
+// the packages of the DARE 2.0 stream are decrypted in parallel, the reader must be closed by CloseDecrypted then.
+// The DARE 1.0 streams are always decrypted by sio.
+func DecryptDARE(reader io.Reader, config sio.Config) (io.Reader, error) {
+	workers := getDecryptionWorkers()
+	if workers == 1 {
+		return newSioReader(reader, config)
+	}
+	bufferedReader := bufio.NewReaderSize(reader, dareHeaderSize+dareMaxPayloadSize+dareTagSize)
+	version, err := bufferedReader.Peek(1)
+	if err != nil || version[0] != sio.Version20 {
+		return newSioReader(bufferedReader, config)
+	}
+	ciphers, err := dareCiphers(config)
+	if err != nil {
+		return nil, err
+	}
+	return newParallelDareReader(bufferedReader, ciphers, workers), nil
+}
+
+// sioReader reports the damaged DARE stream decrypted by sio as ErrCorruptCiphertext
+type sioReader struct {
+	io.Reader
+}
+
+func newSioReader(reader io.Reader, config sio.Config) (io.Reader, error) {
+	decryptedReader, err := sio.DecryptReader(reader, config)
+	if err != nil {
+		return nil, err
+	}
+	return &sioReader{decryptedReader}, nil
+}
+
+func (reader *sioReader) Read(p []byte) (int, error) {
+	n, err := reader.Reader.Read(p)
+	if sioErr, ok := err.(sio.Error); ok {
+		err = errors.Wrap(ErrCorruptCiphertext, sioErr.Error())
+	}
+	return n, err
+}
+
+func dareCiphers(config sio.Config) ([2]cipher.AEAD, error) {
+	var ciphers [2]cipher.AEAD
+	if len(config.Key) != 32 {
+		return ciphers, errors.New("DARE key must be 32 bytes")
+	}
+	suites := config.CipherSuites
+	if len(suites) == 0 {
+		suites = []byte{sio.AES_256_GCM, sio.CHACHA20_POLY1305}
+	}
+	for _, suite := range suites {
+		var err error
+		switch suite {
+		case sio.AES_256_GCM:
+			var block cipher.Block
+			block, err = aes.NewCipher(config.Key)
+			if err == nil {
+				ciphers[suite], err = cipher.NewGCM(block)
+			}
+		case sio.CHACHA20_POLY1305:
+			ciphers[suite], err = chacha20poly1305.New(config.Key)
+		default:
+			return ciphers, errors.Errorf("unknown DARE cipher suite %d", suite)
+		}
+		if err != nil {
+			return ciphers, err
+		}
+	}
+	return ciphers, nil
+}
+
+type dareBatch struct {
+	packages       [][]byte
+	sequenceNumber uint32
+	result         chan dareBatchResult
+}
+
+type dareBatchResult struct {
+	plaintext []byte
+	err       error
+}
+
+// parallelDareReader reads the packages in order and hands them to the workers by batches,
+// the decrypted batches are returned in the same order. Up to workers batches are read ahead.
+type parallelDareReader struct {
+	src       io.Reader
+	ciphers   [2]cipher.AEAD
+	refHeader []byte
+
+	results   chan chan dareBatchResult
+	done      chan struct{}
+	closeOnce sync.Once
+
+	current []byte
+	err     error
+}
+
+func newParallelDareReader(src io.Reader, ciphers [2]cipher.AEAD, workers int) *parallelDareReader {
+	reader := &parallelDareReader{
+		src:     src,
+		ciphers: ciphers,
+		results: make(chan chan dareBatchResult, workers),
+		done:    make(chan struct{}),
+	}
+	batches := make(chan dareBatch)
+	var workersGroup sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		workersGroup.Add(1)
+		go func() {
+			defer workersGroup.Done()
+			for batch := range batches {
+				batch.result <- reader.decryptBatch(batch)
+			}
+		}()
+	}
+	go func() {
+		reader.readBatches(batches)
+		close(batches)
+		workersGroup.Wait()
+	}()
+	return reader
+}
+
+func (reader *parallelDareReader) readBatches(batches chan<- dareBatch) {
+	defer close(reader.results)
+	var sequenceNumber uint32
+	for {
+		packages, err := reader.readPackages()
+		result := make(chan dareBatchResult, 1)
+		select {
+		case reader.results <- result:
+		case <-reader.done:
+			return
+		}
+		if err != nil {
+			result <- dareBatchResult{err: err}
+			return
+		}
+		select {
+		case batches <- dareBatch{packages: packages, sequenceNumber: sequenceNumber, result: result}:
+		case <-reader.done:
+			return
+		}
+		sequenceNumber += uint32(len(packages))
+		if isFinalPackage(packages[len(packages)-1]) {
+			return
+		}
+	}
+}
+
+// readPackages reads up to darePackagesPerBatch packages, the batch ends early with the final package
+func (reader *parallelDareReader) readPackages() ([][]byte, error) {
+	packages := make([][]byte, 0, darePackagesPerBatch)
+	for len(packages) < darePackagesPerBatch {
+		header := make([]byte, dareHeaderSize)
+		_, err := io.ReadFull(reader.src, header)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errDareUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		if reader.refHeader == nil {
+			reader.refHeader = header
+		}
+		length := int(binary.LittleEndian.Uint16(header[2:4])) + 1
+		darePackage := make([]byte, dareHeaderSize+length+dareTagSize)
+		copy(darePackage, header)
+		if _, err = io.ReadFull(reader.src, darePackage[dareHeaderSize:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil, errDareUnexpectedEOF
+			}
+			return nil, err
+		}
+		packages = append(packages, darePackage)
+		if isFinalPackage(darePackage) {
+			return packages, reader.checkEnd()
+		}
+	}
+	return packages, nil
+}
+
+func (reader *parallelDareReader) checkEnd() error {
+	_, err := io.ReadFull(reader.src, make([]byte, 1))
+	if err == nil {
+		return errDareUnexpectedData
+	}
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+func isFinalPackage(darePackage []byte) bool {
+	return darePackage[4]&dareFinalFlag == dareFinalFlag
+}
+
+// decryptBatch checks and opens the packages as sio does, every package is authenticated by its sequence number
+func (reader *parallelDareReader) decryptBatch(batch dareBatch) dareBatchResult {
+	select {
+	case decryptionSlots <- struct{}{}:
+	case <-reader.done:
+		return dareBatchResult{err: io.ErrClosedPipe}
+	}
+	defer func() { <-decryptionSlots }()
+
+	plaintext := make([]byte, 0, len(batch.packages)*dareMaxPayloadSize)
+	for i, darePackage := range batch.packages {
+		header := darePackage[:dareHeaderSize]
+		length := len(darePackage) - dareHeaderSize - dareTagSize
+		if header[0] != sio.Version20 {
+			return dareBatchResult{err: errDareInvalidPackage}
+		}
+		suite := header[1]
+		if suite > sio.CHACHA20_POLY1305 || reader.ciphers[suite] == nil || suite != reader.refHeader[1] {
+			return dareBatchResult{err: errDareInvalidPackage}
+		}
+		if !isFinalPackage(darePackage) && length != dareMaxPayloadSize {
+			return dareBatchResult{err: errDareInvalidPackage}
+		}
+		refNonce := append([]byte(nil), reader.refHeader[4:dareHeaderSize]...)
+		if isFinalPackage(darePackage) {
+			refNonce[0] |= dareFinalFlag
+		}
+		if subtle.ConstantTimeCompare(header[4:dareHeaderSize], refNonce) != 1 {
+			return dareBatchResult{err: errDareInvalidPackage}
+		}
+
+		var nonce [12]byte
+		copy(nonce[:], header[4:dareHeaderSize])
+		sequenceNumber := batch.sequenceNumber + uint32(i)
+		binary.LittleEndian.PutUint32(nonce[8:], binary.LittleEndian.Uint32(nonce[8:])^sequenceNumber)
+		var err error
+		plaintext, err = reader.ciphers[suite].Open(plaintext, nonce[:], darePackage[dareHeaderSize:], header[:4])
+		if err != nil {
+			return dareBatchResult{err: errDareNotAuthentic}
+		}
+	}
+	return dareBatchResult{plaintext: plaintext}
+}
+
+func (reader *parallelDareReader) Read(p []byte) (int, error) {
+	for len(reader.current) == 0 {
+		if reader.err != nil {
+			return 0, reader.err
+		}
+		result, ok := <-reader.results
+		if !ok {
+			reader.err = io.EOF
+			continue
+		}
+		batch := <-result
+		reader.current, reader.err = batch.plaintext, batch.err
+	}
+	n := copy(p, reader.current)
+	reader.current = reader.current[n:]
+	return n, nil
+}
+
+// Close stops the reading ahead, the reader not read to the end must be closed to release the workers
+func (reader *parallelDareReader) Close() error {
+	reader.closeOnce.Do(func() {
+		close(reader.done)
+	})
+	return nil
+}
@@ -0,0 +1,135 @@
+package crypto_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"testing"
+
+	"github.com/minio/sio"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/crypto"
+)
+
+const darePackageSize = 16 + 1<<16 + 16
+
+func dareEncrypt(t testing.TB, key []byte, data []byte, suite byte) []byte {
+	var encrypted bytes.Buffer
+	writer, err := sio.EncryptWriter(&encrypted, sio.Config{Key: key, CipherSuites: []byte{suite}})
+	require.NoError(t, err)
+	_, err = writer.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return encrypted.Bytes()
+}
+
+func randomBytes(t testing.TB, size int) []byte {
+	data := make([]byte, size)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+	return data
+}
+
+func dareDecrypt(key []byte, encrypted []byte) ([]byte, error) {
+	reader, err := crypto.DecryptDARE(bytes.NewReader(encrypted), sio.Config{Key: key})
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.CloseDecrypted(reader)
+	return ioutil.ReadAll(reader)
+}
+
+// withDecryptionWorkers raises GOMAXPROCS, which caps the workers, so the parallel reader runs on any machine
+func withDecryptionWorkers(workers int, run func()) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(workers))
+	crypto.SetDecryptionWorkers(workers)
+	defer crypto.SetDecryptionWorkers(1)
+	run()
+}
+
+func TestDecryptDARE_parallel(t *testing.T) {
+	key := randomBytes(t, 32)
+	withDecryptionWorkers(4, func() {
+		for _, suite := range []byte{sio.AES_256_GCM, sio.CHACHA20_POLY1305} {
+			for _, size := range []int{1, 1 << 16, 4<<16 + 1, 1<<20 + 123} {
+				data := randomBytes(t, size)
+				decrypted, err := dareDecrypt(key, dareEncrypt(t, key, data, suite))
+				assert.NoError(t, err, "suite %d, size %d", suite, size)
+				assert.Equal(t, data, decrypted, "suite %d, size %d", suite, size)
+			}
+		}
+	})
+}
+
+func TestDecryptDARE_corruptStream(t *testing.T) {
+	key := randomBytes(t, 32)
+	encrypted := dareEncrypt(t, key, randomBytes(t, 6<<16+10), sio.AES_256_GCM)
+	flipped := append([]byte(nil), encrypted...)
+	flipped[5*darePackageSize+100] ^= 1
+	swapped := append([]byte(nil), encrypted...)
+	copy(swapped[darePackageSize:], encrypted[2*darePackageSize:3*darePackageSize])
+	copy(swapped[2*darePackageSize:], encrypted[darePackageSize:2*darePackageSize])
+
+	for _, workers := range []int{1, 4} {
+		withDecryptionWorkers(workers, func() {
+			for name, corrupt := range map[string][]byte{
+				"flipped bit":       flipped,
+				"swapped packages":  swapped,
+				"truncated":         encrypted[:3*darePackageSize],
+				"trailing data":     append(append([]byte(nil), encrypted...), 0),
+				"wrong key":         dareEncrypt(t, randomBytes(t, 32), randomBytes(t, 100), sio.AES_256_GCM),
+				"final package cut": encrypted[:len(encrypted)-1],
+			} {
+				_, err := dareDecrypt(key, corrupt)
+				assert.True(t, errors.Is(err, crypto.ErrCorruptCiphertext), "%d workers, %s: %v", workers, name, err)
+			}
+		})
+	}
+}
+
+func TestDecryptDARE_closeBeforeEnd(t *testing.T) {
+	key := randomBytes(t, 32)
+	encrypted := dareEncrypt(t, key, randomBytes(t, 64<<16), sio.AES_256_GCM)
+	withDecryptionWorkers(4, func() {
+		for i := 0; i < 100; i++ {
+			reader, err := crypto.DecryptDARE(bytes.NewReader(encrypted), sio.Config{Key: key})
+			require.NoError(t, err)
+			_, err = io.ReadFull(reader, make([]byte, 100))
+			assert.NoError(t, err)
+			assert.NoError(t, crypto.CloseDecrypted(reader))
+		}
+		// the decryption slots are released by the closed readers
+		data := randomBytes(t, 1<<20)
+		decrypted, err := dareDecrypt(key, dareEncrypt(t, key, data, sio.AES_256_GCM))
+		assert.NoError(t, err)
+		assert.Equal(t, data, decrypted)
+	})
+}
+
+func BenchmarkDecryptDARE(b *testing.B) {
+	key := randomBytes(b, 32)
+	data := randomBytes(b, 16<<20)
+	encrypted := dareEncrypt(b, key, data, sio.AES_256_GCM)
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers_%d", workers), func(b *testing.B) {
+			withDecryptionWorkers(workers, func() {
+				b.SetBytes(int64(len(data)))
+				for i := 0; i < b.N; i++ {
+					reader, err := crypto.DecryptDARE(bytes.NewReader(encrypted), sio.Config{Key: key})
+					if err != nil {
+						b.Fatal(err)
+					}
+					if _, err = io.Copy(ioutil.Discard, reader); err != nil {
+						b.Fatal(err)
+					}
+					_ = crypto.CloseDecrypted(reader)
+				}
+			})
+		})
+	}
+}
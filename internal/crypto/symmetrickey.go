@@ -1,9 +1,7 @@
 package crypto
 
 // SymmetricKey encryption interface
-// Used by AWS KMS Crypter
-// When implement another crypters,
-// can be moved to crypto package
+// Used by the KMS crypters through EncryptEnvelope and DecryptEnvelope
 type SymmetricKey interface {
 	Generate() error
 	Encrypt() error
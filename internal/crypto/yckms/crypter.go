@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"io"
+	"sync"
 
 	"github.com/minio/sio"
 	"github.com/wal-g/tracelog"
@@ -14,6 +15,8 @@ import (
 
 type YcCrypter struct {
 	symmetricKey YcSymmetricKeyInterface
+
+	decryptMutex sync.Mutex
 }
 
 func (crypter *YcCrypter) Name() string {
@@ -46,13 +49,21 @@ func (crypter *YcCrypter) Encrypt(writer io.Writer) (io.WriteCloser, error) {
 }
 
 func (crypter *YcCrypter) Decrypt(reader io.Reader) (io.Reader, error) {
+	// the encrypted key is read into the shared symmetric key, so the concurrent decryptions take turns
+	crypter.decryptMutex.Lock()
 	err := crypter.symmetricKey.ReadEncryptedKey(reader)
 	tracelog.ErrorLogger.FatalfOnError("Can't read encryption key from archive file header: %v", err)
 
-	err = crypter.symmetricKey.Decrypt()
+	key, err := crypto.DefaultDataKeyCache.Unwrap(crypter.symmetricKey.GetEncryptedKey(), func() ([]byte, error) {
+		if err := crypter.symmetricKey.Decrypt(); err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), crypter.symmetricKey.GetKey()...), nil
+	})
+	crypter.decryptMutex.Unlock()
 	tracelog.ErrorLogger.FatalfOnError("Can't decrypt data encryption key from archive file header: %v", err)
 
-	return sio.DecryptReader(reader, sio.Config{Key: crypter.symmetricKey.GetKey(), CipherSuites: []byte{sio.AES_256_GCM}})
+	return crypto.DecryptDARE(reader, sio.Config{Key: key, CipherSuites: []byte{sio.AES_256_GCM}})
 }
 
 func YcCrypterFromKeyIDAndCredential(keyID string, saFilePath string) crypto.Crypter {
@@ -169,7 +169,11 @@ func NewDiscardUploader(compressor compression.Compressor, readerFrom io.ReaderF
 // UploadOplogArchive reads all data into memory, stream is compressed and encrypted if required
 func (d *DiscardUploader) UploadOplogArchive(archReader io.Reader, firstTS, lastTS models.Timestamp) error {
 	if d.compressor != nil {
-		archReader = internal.CompressAndEncrypt(archReader, d.compressor, internal.ConfigureCrypter())
+		crypter, err := internal.ConfigureCrypter()
+		if err != nil {
+			return err
+		}
+		archReader = internal.CompressAndEncrypt(archReader, d.compressor, crypter)
 	}
 	if d.readerFrom != nil {
 		if _, err := d.readerFrom.ReadFrom(archReader); err != nil {
@@ -199,9 +203,13 @@ type StorageUploader struct {
 }
 
 // NewStorageUploader builds mongodb uploader.
-func NewStorageUploader(upl internal.UploaderProvider) *StorageUploader {
+func NewStorageUploader(upl internal.UploaderProvider) (*StorageUploader, error) {
+	crypter, err := internal.ConfigureCrypter()
+	if err != nil {
+		return nil, err
+	}
 	upl.DisableSizeTracking() // providing io.ReaderAt+io.ReadSeeker to s3 upload enables buffer pool usage
-	return &StorageUploader{upl, internal.ConfigureCrypter(), &bytes.Buffer{}}
+	return &StorageUploader{upl, crypter, &bytes.Buffer{}}, nil
 }
 
 // UploadOplogArchive compresses a stream and uploads it with given archive name.
@@ -32,7 +32,8 @@ func TestStorageUploader_UploadOplogArchive_ProperInterfaces(t *testing.T) {
 	})
 
 	uploaderProv := internal.NewUploader(compression.Compressors[lz4.AlgorithmName], storageProv)
-	su := NewStorageUploader(uploaderProv)
+	su, err := NewStorageUploader(uploaderProv)
+	assert.NoError(t, err)
 	r, w := io.Pipe()
 	go func() {
 		n, err := w.Write([]byte("test_data_stream"))
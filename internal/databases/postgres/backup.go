@@ -55,10 +55,9 @@ func (backup *Backup) getTarPartitionFolder() storage.Folder {
 }
 
 func (backup *Backup) GetTarNames() ([]string, error) {
-	tarPartitionFolder := backup.getTarPartitionFolder()
-	objects, _, err := tarPartitionFolder.ListFolder()
+	objects, err := backup.getTarObjects()
 	if err != nil {
-		return nil, errors.Wrapf(err, "unable to list backup '%s' for deletion", backup.Name)
+		return nil, err
 	}
 	result := make([]string, len(objects))
 	for id, object := range objects {
@@ -67,6 +66,14 @@ func (backup *Backup) GetTarNames() ([]string, error) {
 	return result, nil
 }
 
+func (backup *Backup) getTarObjects() ([]storage.Object, error) {
+	objects, _, err := backup.getTarPartitionFolder().ListFolder()
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to list backup '%s' for deletion", backup.Name)
+	}
+	return objects, nil
+}
+
 func (backup *Backup) GetSentinel() (BackupSentinelDto, error) {
 	if backup.SentinelDto != nil {
 		return *backup.SentinelDto, nil
@@ -261,6 +268,18 @@ func (backup *Backup) unwrapOld(
 	filesMeta FilesMetadataDto, filesToUnwrap map[string]bool, createIncrementalFiles bool,
 ) error {
 	tarInterpreter := NewFileTarInterpreter(dbDataDirectory, sentinelDto, filesMeta, filesToUnwrap, createIncrementalFiles)
+	umask, err := internal.GetRestoreUmask()
+	if err != nil {
+		return err
+	}
+	tarInterpreter.Umask = umask
+	// catchup-fetch updates the existing data directory in place
+	if !createIncrementalFiles {
+		tarInterpreter.Overwrite, err = internal.GetRestoreOverwriteMode()
+		if err != nil {
+			return err
+		}
+	}
 	tarsToExtract, pgControlKey, err := backup.getTarsToExtract(filesMeta, filesToUnwrap, false)
 	if err != nil {
 		return err
@@ -314,15 +333,20 @@ func isDirectoryEmpty(directoryPath string) (bool, error) {
 // TODO : init tests
 func (backup *Backup) getTarsToExtract(filesMeta FilesMetadataDto, filesToUnwrap map[string]bool,
 	skipRedundantTars bool) (tarsToExtract []internal.ReaderMaker, pgControlKey string, err error) {
-	tarNames, err := backup.GetTarNames()
+	tarObjects, err := backup.getTarObjects()
 	if err != nil {
 		return nil, "", err
 	}
+	tarNames := make([]string, len(tarObjects))
+	for id, tarObject := range tarObjects {
+		tarNames[id] = tarObject.GetName()
+	}
 	tracelog.DebugLogger.Printf("Tars to extract: '%+v'\n", tarNames)
-	tarsToExtract = make([]internal.ReaderMaker, 0, len(tarNames))
+	tarsToExtract = make([]internal.ReaderMaker, 0, len(tarObjects))
 
 	pgControlRe := regexp.MustCompile(`^.*?pg_control\.tar(\..+$|$)`)
-	for _, tarName := range tarNames {
+	for _, tarObject := range tarObjects {
+		tarName := tarObject.GetName()
 		// Separate the pg_control tarName from the others to
 		// extract it at the end, as to prevent server startup
 		// with incomplete backup restoration.  But only if it
@@ -341,6 +365,7 @@ func (backup *Backup) getTarsToExtract(filesMeta FilesMetadataDto, filesToUnwrap
 		}
 
 		tarToExtract := internal.NewStorageReaderMaker(backup.getTarPartitionFolder(), tarName)
+		tarToExtract.Object = tarObject
 		tarsToExtract = append(tarsToExtract, tarToExtract)
 	}
 	return tarsToExtract, pgControlKey, nil
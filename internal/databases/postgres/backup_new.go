@@ -77,6 +77,10 @@ func (backup *Backup) unwrapNew(
 	}
 
 	tarInterpreter := NewFileTarInterpreter(dbDataDirectory, sentinelDto, filesMetaDto, filesToUnwrap, createIncrementalFiles)
+	tarInterpreter.Umask, err = internal.GetRestoreUmask()
+	if err != nil {
+		return nil, err
+	}
 	tarsToExtract, pgControlKey, err := backup.getTarsToExtract(filesMetaDto, filesToUnwrap, skipRedundantTars)
 	if err != nil {
 		return nil, err
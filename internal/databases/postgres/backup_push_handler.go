@@ -71,6 +71,8 @@ type CurBackupInfo struct {
 	uncompressedSize int64
 	compressedSize   int64
 	incrementCount   int
+	// the part of uncompressedSize stored in the plain tar files
+	storedUncompressedSize int64
 }
 
 // PrevBackupInfo holds all information that is harvest during the backup process
@@ -145,7 +147,8 @@ func (bh *BackupHandler) createAndPushBackup() {
 	tracelog.DebugLogger.Printf("Uploading folder: %s", bh.workers.uploader.UploadingFolder)
 
 	arguments := bh.arguments
-	crypter := internal.ConfigureCrypter()
+	crypter, err := internal.ConfigureCrypter()
+	tracelog.ErrorLogger.FatalOnError(err)
 	bh.workers.bundle = NewBundle(bh.pgInfo.pgDataDirectory, crypter, bh.prevBackupInfo.sentinelDto.BackupStartLSN,
 		bh.prevBackupInfo.filesMetadataDto.Files, arguments.forceIncremental,
 		viper.GetInt64(internal.TarSizeThresholdSetting))
@@ -231,11 +234,26 @@ func (bh *BackupHandler) markBackups(folder storage.Folder, sentinelDto BackupSe
 	}
 }
 
+// startQueues starts the queue of compressed tarballs and, if the compression policy is configured,
+// the queue of tarballs for the files stored uncompressed
+func (bh *BackupHandler) startQueues(bundle *Bundle) error {
+	tarBallMaker := internal.NewStorageTarBallMaker(bh.curBackupInfo.name, bh.workers.uploader.Uploader)
+	err := bundle.StartQueue(tarBallMaker)
+	if err != nil {
+		return err
+	}
+	compressionPolicy, err := internal.ConfigureCompressionPolicy()
+	if err != nil || compressionPolicy == nil {
+		return err
+	}
+	return bundle.StartUncompressedQueue(tarBallMaker.UncompressedMaker(), compressionPolicy)
+}
+
 func (bh *BackupHandler) uploadBackup() TarFileSets {
 	bundle := bh.workers.bundle
 	// Start a new tar bundle, walk the pgDataDirectory and upload everything there.
 	tracelog.InfoLogger.Println("Starting a new tar bundle")
-	err := bundle.StartQueue(internal.NewStorageTarBallMaker(bh.curBackupInfo.name, bh.workers.uploader.Uploader))
+	err := bh.startQueues(bundle)
 	tracelog.ErrorLogger.FatalOnError(err)
 
 	tarBallComposerMaker, err := NewTarBallComposerMaker(bh.arguments.tarBallComposerType, bh.workers.conn,
@@ -269,6 +287,13 @@ func (bh *BackupHandler) uploadBackup() TarFileSets {
 	tracelog.ErrorLogger.FatalOnError(err)
 	bh.curBackupInfo.endLSN = finishLsn
 	bh.curBackupInfo.uncompressedSize = atomic.LoadInt64(bundle.TarBallQueue.AllTarballsSize)
+	if bundle.UncompressedTarBallQueue != nil {
+		storedSize := atomic.LoadInt64(bundle.UncompressedTarBallQueue.AllTarballsSize)
+		bh.curBackupInfo.uncompressedSize += storedSize
+		bh.curBackupInfo.storedUncompressedSize = storedSize
+		tracelog.InfoLogger.Printf("Stored %d files (%d bytes) without compression",
+			bundle.CompressionPolicy.StoredFiles(), bundle.CompressionPolicy.StoredBytes())
+	}
 	bh.curBackupInfo.compressedSize, err = bh.workers.uploader.UploadedDataSize()
 	tracelog.ErrorLogger.FatalOnError(err)
 	tarFileSets.AddFiles(labelFilesTarBallName, labelFilesList)
@@ -576,7 +601,11 @@ func (bh *BackupHandler) uploadExtendedMetadata(meta ExtendedMetadataDto) (err e
 		return internal.NewSentinelMarshallingError(metaFile, err)
 	}
 	tracelog.DebugLogger.Printf("Uploading metadata file (%s):\n%s", metaFile, dtoBody)
-	return bh.workers.uploader.Upload(metaFile, bytes.NewReader(dtoBody))
+	metaReader, err := internal.EncryptMetadata(bytes.NewReader(dtoBody))
+	if err != nil {
+		return err
+	}
+	return bh.workers.uploader.Upload(metaFile, metaReader)
 }
 
 func (bh *BackupHandler) uploadFilesMetadata(filesMetaDto FilesMetadataDto) (err error) {
@@ -589,7 +618,11 @@ func (bh *BackupHandler) uploadFilesMetadata(filesMetaDto FilesMetadataDto) (err
 	if err != nil {
 		return err
 	}
-	return bh.workers.uploader.Upload(getFilesMetadataPath(bh.curBackupInfo.name), bytes.NewReader(dtoBody))
+	filesMetaReader, err := internal.EncryptMetadata(bytes.NewReader(dtoBody))
+	if err != nil {
+		return err
+	}
+	return bh.workers.uploader.Upload(getFilesMetadataPath(bh.curBackupInfo.name), filesMetaReader)
 }
 
 func (bh *BackupHandler) checkPgVersionAndPgControl() {
@@ -29,6 +29,9 @@ type BackupSentinelDto struct {
 	CompressedSize   int64           `json:"CompressedSize"`
 	TablespaceSpec   *TablespaceSpec `json:"Spec"`
 
+	// StoredUncompressedSize is the size of the tar parts uploaded without compression
+	StoredUncompressedSize int64 `json:"StoredUncompressedSize,omitempty"`
+
 	UserData interface{} `json:"UserData,omitempty"`
 
 	FilesMetadataDisabled bool `json:"FilesMetadataDisabled,omitempty"`
@@ -56,6 +59,7 @@ func NewBackupSentinelDto(bh *BackupHandler, tbsSpec *TablespaceSpec) BackupSent
 	sentinel.SystemIdentifier = bh.pgInfo.systemIdentifier
 	sentinel.UncompressedSize = bh.curBackupInfo.uncompressedSize
 	sentinel.CompressedSize = bh.curBackupInfo.compressedSize
+	sentinel.StoredUncompressedSize = bh.curBackupInfo.storedUncompressedSize
 	sentinel.FilesMetadataDisabled = bh.arguments.withoutFilesMetadata
 	return sentinel
 }
@@ -67,6 +67,9 @@ type Bundle struct {
 
 	TarBallComposer TarBallComposer
 	TarBallQueue    *internal.TarBallQueue
+	// UncompressedTarBallQueue is used for the files CompressionPolicy chooses to store uncompressed
+	UncompressedTarBallQueue *internal.TarBallQueue
+	CompressionPolicy        *internal.CompressionPolicy
 
 	Crypter            crypto.Crypter
 	Timeline           uint32
@@ -106,6 +109,14 @@ func (bundle *Bundle) StartQueue(tarBallMaker internal.TarBallMaker) error {
 	return bundle.TarBallQueue.StartQueue()
 }
 
+// StartUncompressedQueue starts the queue of plain tar parts for the files
+// which the compression policy doesn't want to compress
+func (bundle *Bundle) StartUncompressedQueue(tarBallMaker internal.TarBallMaker, policy *internal.CompressionPolicy) error {
+	bundle.CompressionPolicy = policy
+	bundle.UncompressedTarBallQueue = internal.NewTarBallQueue(bundle.TarSizeThreshold, tarBallMaker)
+	return bundle.UncompressedTarBallQueue.StartQueue()
+}
+
 func (bundle *Bundle) SetupComposer(composerMaker TarBallComposerMaker) (err error) {
 	tarBallComposer, err := composerMaker.Make(bundle)
 	if err != nil {
@@ -116,6 +127,11 @@ func (bundle *Bundle) SetupComposer(composerMaker TarBallComposerMaker) (err err
 }
 
 func (bundle *Bundle) FinishQueue() error {
+	if bundle.UncompressedTarBallQueue != nil {
+		if err := bundle.UncompressedTarBallQueue.FinishQueue(); err != nil {
+			return err
+		}
+	}
 	return bundle.TarBallQueue.FinishQueue()
 }
 
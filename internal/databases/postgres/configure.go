@@ -26,6 +26,7 @@ func ConfigureWalUploader() (uploader *WalUploader, err error) {
 	}
 
 	uploader = NewWalUploader(compressor, folder, deltaFileManager)
+	uploader.Signer, err = internal.ConfigureSigner()
 	return uploader, err
 }
 
@@ -46,6 +47,7 @@ func ConfigureWalUploaderWithoutCompressMethod() (uploader *WalUploader, err err
 	}
 
 	uploader = NewWalUploader(nil, folder, deltaFileManager)
+	uploader.Signer, err = internal.ConfigureSigner()
 	return uploader, err
 }
 
@@ -168,7 +168,11 @@ func (c *CopyTarBallComposer) copyTar(tarName string) error {
 	tracelog.InfoLogger.Printf("Copying %s ...\n", tarName)
 	splitTarName := strings.Split(tarName, ".")
 	fileExtension := splitTarName[len(splitTarName)-1]
-	newTarName := "copy_" + strconv.Itoa(c.copyCount) + ".tar." + fileExtension
+	newTarName := "copy_" + strconv.Itoa(c.copyCount) + ".tar"
+	// the uncompressed parts have no compressor extension
+	if fileExtension != "tar" {
+		newTarName += "." + fileExtension
+	}
 	c.copyCount++
 	srcPath := path.Join(c.prevBackup.Name, internal.TarPartitionFolderName, tarName)
 	dstPath := path.Join(c.newBackupName, internal.TarPartitionFolderName, newTarName)
@@ -252,6 +252,10 @@ func forkPrefetch(walFileName string, location string) {
 	if storagePrefix != "" {
 		prefetchArgs = append(prefetchArgs, "--walg-storage-prefix", storagePrefix)
 	}
+	if viper.GetBool(internal.VerifySignatureSetting) {
+		// the prefetched files are verified as well, the flag of wal-fetch is not in the environment
+		prefetchArgs = append(prefetchArgs, "--walg-verify-signature=true")
+	}
 	cmd := exec.Command(os.Args[0], prefetchArgs...)
 	cmd.Env = os.Environ()
 	cmd.Stdout = os.Stdout
@@ -19,6 +19,9 @@ type RegularTarBallComposer struct {
 	tarFileSets   TarFileSets
 	errorGroup    *errgroup.Group
 	ctx           context.Context
+
+	uncompressedQueue *internal.TarBallQueue
+	compressionPolicy *internal.CompressionPolicy
 }
 
 func NewRegularTarBallComposer(
@@ -61,11 +64,17 @@ func (maker *RegularTarBallComposerMaker) Make(bundle *Bundle) (TarBallComposer,
 	tarFileSets := maker.tarFileSets
 	tarBallFilePacker := newTarBallFilePacker(bundle.DeltaMap,
 		bundle.IncrementFromLsn, bundleFiles, maker.filePackerOptions)
-	return NewRegularTarBallComposer(bundle.TarBallQueue, tarBallFilePacker, bundleFiles, tarFileSets, bundle.Crypter), nil
+	composer := NewRegularTarBallComposer(bundle.TarBallQueue, tarBallFilePacker, bundleFiles, tarFileSets, bundle.Crypter)
+	if bundle.UncompressedTarBallQueue != nil {
+		composer.uncompressedQueue = bundle.UncompressedTarBallQueue
+		composer.compressionPolicy = bundle.CompressionPolicy
+	}
+	return composer, nil
 }
 
 func (c *RegularTarBallComposer) AddFile(info *ComposeFileInfo) {
-	tarBall, err := c.tarBallQueue.DequeCtx(c.ctx)
+	tarBallQueue := c.chooseTarBallQueue(info)
+	tarBall, err := tarBallQueue.DequeCtx(c.ctx)
 	if err != nil {
 		return
 	}
@@ -76,10 +85,20 @@ func (c *RegularTarBallComposer) AddFile(info *ComposeFileInfo) {
 		if err != nil {
 			return err
 		}
-		return c.tarBallQueue.CheckSizeAndEnqueueBack(tarBall)
+		return tarBallQueue.CheckSizeAndEnqueueBack(tarBall)
 	})
 }
 
+// chooseTarBallQueue returns the queue of uncompressed tarballs for the files
+// which are not worth compressing according to the compression policy
+func (c *RegularTarBallComposer) chooseTarBallQueue(info *ComposeFileInfo) *internal.TarBallQueue {
+	if c.compressionPolicy == nil || !c.compressionPolicy.ShouldStoreUncompressed(info.header.Name, info.path) {
+		return c.tarBallQueue
+	}
+	c.compressionPolicy.AddStoredFile(info.fileInfo.Size())
+	return c.uncompressedQueue
+}
+
 func (c *RegularTarBallComposer) AddHeader(fileInfoHeader *tar.Header, info os.FileInfo) error {
 	tarBall, err := c.tarBallQueue.DequeCtx(c.ctx)
 	if err != nil {
@@ -0,0 +1,117 @@
+package postgres_test
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression/computils"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/testtools"
+)
+
+// composeWithPolicy packs the file into the backup with the compression policy
+// and returns the names of the files in the compressed and in the plain tar parts
+func composeWithPolicy(t *testing.T, fileName string, content []byte,
+	policy *internal.CompressionPolicy) (compressed []string, plain []string) {
+	dataDir := t.TempDir()
+	filePath := filepath.Join(dataDir, "base", "1", fileName)
+	require.NoError(t, os.MkdirAll(filepath.Dir(filePath), 0700))
+	require.NoError(t, ioutil.WriteFile(filePath, content, 0600))
+
+	backupStorage := memory.NewStorage()
+	uploader := testtools.NewStoringMockUploader(backupStorage, nil)
+	tarBallMaker := internal.NewStorageTarBallMaker("base_000000010000000000000002", uploader)
+	bundle := postgres.NewBundle(dataDir, nil, nil, nil, false, 1<<30)
+	require.NoError(t, bundle.StartQueue(tarBallMaker))
+	if policy != nil {
+		require.NoError(t, bundle.StartUncompressedQueue(tarBallMaker.UncompressedMaker(), policy))
+	}
+	composerMaker := postgres.NewRegularTarBallComposerMaker(postgres.NewTarBallFilePackerOptions(false, false),
+		&postgres.RegularBundleFiles{}, postgres.NewRegularTarFileSets())
+	require.NoError(t, bundle.SetupComposer(composerMaker))
+	require.NoError(t, filepath.Walk(dataDir, bundle.HandleWalkedFSObject))
+	_, err := bundle.PackTarballs()
+	require.NoError(t, err)
+	require.NoError(t, bundle.FinishQueue())
+
+	// the uploader of the backup push writes to the basebackups folder itself
+	partsFolder := memory.NewFolder("in_memory/", backupStorage).
+		GetSubFolder("base_000000010000000000000002").
+		GetSubFolder(strings.Trim(internal.TarPartitionFolderName, "/"))
+	parts, _, err := partsFolder.ListFolder()
+	require.NoError(t, err)
+	for _, part := range parts {
+		names := tarredFileNames(t, partsFolder, part)
+		if strings.HasSuffix(part.GetName(), ".tar") {
+			plain = append(plain, names...)
+		} else {
+			compressed = append(compressed, names...)
+		}
+	}
+	return compressed, plain
+}
+
+// tarredFileNames lists the regular files of the part, the mock compressor leaves the parts plain tar files
+func tarredFileNames(t *testing.T, partsFolder storage.Folder, part storage.Object) []string {
+	reader, err := partsFolder.ReadObject(part.GetName())
+	require.NoError(t, err)
+	defer reader.Close()
+	var names []string
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return names
+		}
+		require.NoError(t, err)
+		if header.Typeflag == tar.TypeReg {
+			names = append(names, header.Name)
+		}
+	}
+}
+
+func TestRegularTarBallComposer_compressedRoute(t *testing.T) {
+	policy := internal.NewCompressionPolicy([]string{"*.gz"}, 7.5)
+	compressed, plain := composeWithPolicy(t, "16384", computils.GenerateWALSample(128<<10), policy)
+	assert.Equal(t, []string{"/base/1/16384"}, compressed)
+	assert.Empty(t, plain)
+	assert.Zero(t, policy.StoredFiles())
+}
+
+func TestRegularTarBallComposer_patternRoute(t *testing.T) {
+	policy := internal.NewCompressionPolicy([]string{"*.gz"}, 0)
+	compressed, plain := composeWithPolicy(t, "dump.gz", computils.GenerateWALSample(128<<10), policy)
+	assert.Empty(t, compressed)
+	assert.Equal(t, []string{"/base/1/dump.gz"}, plain)
+	assert.Equal(t, int64(1), policy.StoredFiles())
+	assert.Equal(t, int64(128<<10), policy.StoredBytes())
+}
+
+func TestRegularTarBallComposer_entropyRoute(t *testing.T) {
+	random := make([]byte, 128<<10)
+	rand.New(rand.NewSource(1)).Read(random)
+	policy := internal.NewCompressionPolicy(nil, 7.5)
+	compressed, plain := composeWithPolicy(t, "16385", random, policy)
+	assert.Empty(t, compressed)
+	assert.Equal(t, []string{"/base/1/16385"}, plain)
+	assert.Equal(t, int64(1), policy.StoredFiles())
+}
+
+func TestRegularTarBallComposer_noPolicy(t *testing.T) {
+	random := make([]byte, 128<<10)
+	rand.New(rand.NewSource(1)).Read(random)
+	compressed, plain := composeWithPolicy(t, "dump.gz", random, nil)
+	assert.Equal(t, []string{"/base/1/dump.gz"}, compressed)
+	assert.Empty(t, plain)
+}
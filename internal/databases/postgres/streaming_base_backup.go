@@ -128,9 +128,13 @@ func (bb *StreamingBaseBackup) Upload(uploader *WalUploader, bundleFiles BundleF
 	// Upload the tar
 	bb.uploader = uploader
 	bb.streamer = NewTarballStreamer(bb, bb.maxTarSize, bundleFiles)
+	crypter, err := internal.ConfigureCrypter()
+	if err != nil {
+		return err
+	}
 	for {
 		tbsTar := ioextensions.NewNamedReaderImpl(bb.streamer, bb.FileName())
-		compressedFile := internal.CompressAndEncrypt(tbsTar, bb.uploader.Compressor, internal.ConfigureCrypter())
+		compressedFile := internal.CompressAndEncrypt(tbsTar, bb.uploader.Compressor, crypter)
 		dstPath := fmt.Sprintf("%s.%s", bb.Path(), bb.uploader.Compressor.FileExtension())
 		err = bb.uploader.Upload(dstPath, compressedFile)
 		if err != nil {
@@ -154,7 +158,7 @@ func (bb *StreamingBaseBackup) Upload(uploader *WalUploader, bundleFiles BundleF
 	// Upload the extra tar
 	if len(bb.streamer.Tee) > 0 {
 		teeTar := ioextensions.NewNamedReaderImpl(bb.streamer.TeeIo, bb.FileName())
-		teeCompressedFile := internal.CompressAndEncrypt(teeTar, bb.uploader.Compressor, internal.ConfigureCrypter())
+		teeCompressedFile := internal.CompressAndEncrypt(teeTar, bb.uploader.Compressor, crypter)
 		teeFileName := fmt.Sprintf("pg_control.tar.%s", bb.uploader.Compressor.FileExtension())
 		teeFilePath := storage.JoinPath(bb.BackupName(), internal.TarPartitionFolderName, teeFileName)
 		err = bb.uploader.Upload(teeFilePath, teeCompressedFile)
@@ -168,7 +172,7 @@ func (bb *StreamingBaseBackup) Upload(uploader *WalUploader, bundleFiles BundleF
 
 // BackupName returns the name of the folder where the backup should be stored.
 func (bb *StreamingBaseBackup) BackupName() string {
-	return "base_" + formatWALFileName(bb.TimeLine, uint64(bb.StartLSN)/WalSegmentSize)
+	return "base_" + FormatWALFileName(bb.TimeLine, uint64(bb.StartLSN)/WalSegmentSize)
 }
 
 // FileName returns the filename of a tablespace backup file.
@@ -2,16 +2,20 @@ package postgres
 
 import (
 	"archive/tar"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression"
 	"github.com/wal-g/wal-g/utility"
 )
 
@@ -22,8 +26,35 @@ type FileTarInterpreter struct {
 	FilesMetadata   FilesMetadataDto
 	FilesToUnwrap   map[string]bool
 	UnwrapResult    *UnwrapResult
+	// Umask is cleared in the modes of the extracted files and directories, see internal.GetRestoreUmask
+	Umask os.FileMode
+	// DecompressNestedFiles decompresses the regular files of the archive with the extension of a known compression,
+	// e.g. the gzipped files inside the gzipped tar, and extracts them without the extension
+	DecompressNestedFiles bool
+	// Overwrite tells what to do with the regular files which already exist in the destination,
+	// the empty mode overwrites them, see internal.GetRestoreOverwriteMode
+	Overwrite internal.RestoreOverwriteMode
 
 	createNewIncrementalFiles bool
+	// extractedFiles are the target paths written by this interpreter, the retried archives overwrite them
+	extractedFiles sync.Map
+	// writingFiles are the target paths created by this interpreter which aren't written completely yet
+	writingFiles sync.Map
+	// symlinks are the target paths of the symlinks created by this interpreter, nothing is written through them
+	symlinks sync.Map
+}
+
+type DestinationFileExistsError struct {
+	error
+}
+
+func newDestinationFileExistsError(targetPath string) DestinationFileExistsError {
+	return DestinationFileExistsError{errors.Errorf("Interpret: file '%s' already exists in the destination, "+
+		"set %s to overwrite or skip the existing files", targetPath, internal.RestoreOverwriteSetting)}
+}
+
+func (err DestinationFileExistsError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
 }
 
 func NewFileTarInterpreter(
@@ -31,7 +62,7 @@ func NewFileTarInterpreter(
 	filesToUnwrap map[string]bool, createNewIncrementalFiles bool,
 ) *FileTarInterpreter {
 	return &FileTarInterpreter{dbDataDirectory, sentinel, filesMetadata,
-		filesToUnwrap, newUnwrapResult(), createNewIncrementalFiles}
+		filesToUnwrap, newUnwrapResult(), 0, false, "", createNewIncrementalFiles, sync.Map{}, sync.Map{}, sync.Map{}}
 }
 
 // write file from reader to local file
@@ -78,7 +109,11 @@ func (tarInterpreter *FileTarInterpreter) unwrapRegularFileOld(fileReader io.Rea
 		err := ApplyFileIncrement(targetPath, fileReader, tarInterpreter.createNewIncrementalFiles, fsync)
 		return errors.Wrapf(err, "Interpret: failed to apply increment for '%s'", targetPath)
 	}
-	err := PrepareDirs(fileInfo.Name, targetPath)
+	proceed, err := tarInterpreter.checkExistingFile(fileReader, targetPath)
+	if !proceed || err != nil {
+		return err
+	}
+	err = PrepareDirs(fileInfo.Name, targetPath)
 	if err != nil {
 		return errors.Wrap(err, "Interpret: failed to create all directories")
 	}
@@ -87,44 +122,203 @@ func (tarInterpreter *FileTarInterpreter) unwrapRegularFileOld(fileReader io.Rea
 		return errors.Wrapf(err, "failed to create new file: '%s'", targetPath)
 	}
 	defer utility.LoggedClose(file, "")
+	tarInterpreter.extractedFiles.Store(targetPath, true)
+	tarInterpreter.writingFiles.Store(targetPath, true)
+
+	err = WriteLocalFile(fileReader, fileInfo, file, fsync)
+	if err == nil {
+		tarInterpreter.writingFiles.Delete(targetPath)
+	}
+	return err
+}
+
+// RemovePartialFile removes the regular file of the entry if the interpreter has created it and failed
+// to write it completely. The existing files the increments are applied to are left as they are.
+func (tarInterpreter *FileTarInterpreter) RemovePartialFile(fileInfo *tar.Header) error {
+	targetPath := path.Join(tarInterpreter.DBDataDirectory, tarInterpreter.entryName(fileInfo))
+	if _, writing := tarInterpreter.writingFiles.LoadAndDelete(targetPath); !writing {
+		return nil
+	}
+	tracelog.WarningLogger.Printf("Interpret: removing the partially extracted file '%s'", targetPath)
+	err := os.Remove(targetPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return errors.Wrapf(err, "Interpret: failed to remove the partially extracted file '%s'", targetPath)
+}
+
+// entryName is the name the entry is extracted under, the nested compressed files lose their extension
+func (tarInterpreter *FileTarInterpreter) entryName(fileInfo *tar.Header) string {
+	if tarInterpreter.DecompressNestedFiles && isRegularFile(fileInfo) &&
+		compression.FindDecompressor(utility.GetFileExtension(fileInfo.Name)) != nil {
+		return utility.TrimFileExtension(fileInfo.Name)
+	}
+	return fileInfo.Name
+}
+
+// checkExistingFile applies the Overwrite mode to the file about to be extracted to targetPath unless
+// the interpreter has already written it, e.g. before the archive was retried.
+// The content of the skipped file is read out so the checksum of the whole download is still verified
+func (tarInterpreter *FileTarInterpreter) checkExistingFile(fileReader io.Reader, targetPath string) (bool, error) {
+	if tarInterpreter.Overwrite == "" || tarInterpreter.Overwrite == internal.OverwriteExistingFiles {
+		return true, nil
+	}
+	if _, extracted := tarInterpreter.extractedFiles.Load(targetPath); extracted {
+		return true, nil
+	}
+	if _, err := os.Lstat(targetPath); os.IsNotExist(err) {
+		return true, nil
+	} else if err != nil {
+		return false, errors.Wrapf(err, "Interpret: failed to check %s", targetPath)
+	}
+	if tarInterpreter.Overwrite == internal.FailOnExistingFiles {
+		return false, newDestinationFileExistsError(targetPath)
+	}
+	tracelog.WarningLogger.Printf("Interpret: skipping '%s' which already exists", targetPath)
+	_, err := io.Copy(ioutil.Discard, fileReader)
+	return false, errors.Wrapf(err, "Interpret: failed to skip %s", targetPath)
+}
 
-	return WriteLocalFile(fileReader, fileInfo, file, fsync)
+// entryHandler extracts the tar entry of one type to targetPath
+type entryHandler func(tarInterpreter *FileTarInterpreter, fileReader io.Reader, fileInfo *tar.Header,
+	targetPath string, fsync bool) error
+
+// entryHandlers maps the typeflags of the tar headers to the handlers of their entries,
+// the entries of other types, e.g. the devices and the FIFOs, are skipped
+var entryHandlers = map[byte]entryHandler{
+	tar.TypeReg:     (*FileTarInterpreter).extractRegularFile,
+	tar.TypeRegA:    (*FileTarInterpreter).extractRegularFile,
+	tar.TypeDir:     (*FileTarInterpreter).extractDirectory,
+	tar.TypeLink:    (*FileTarInterpreter).extractHardlink,
+	tar.TypeSymlink: (*FileTarInterpreter).extractSymlink,
 }
 
 // Interpret extracts a tar file to disk and creates needed directories.
 // Returns the first error encountered. Calls fsync after each file
-// is written successfully.
+// is written successfully unless fsync is disabled by the settings.
 func (tarInterpreter *FileTarInterpreter) Interpret(fileReader io.Reader, fileInfo *tar.Header) error {
 	tracelog.DebugLogger.Println("Interpreting: ", fileInfo.Name)
-	targetPath := path.Join(tarInterpreter.DBDataDirectory, fileInfo.Name)
-	fsync := !viper.GetBool(internal.TarDisableFsyncSetting)
-	switch fileInfo.Typeflag {
-	case tar.TypeReg, tar.TypeRegA:
-		// temporary switch to determine if new unwrap logic should be used
-		if useNewUnwrapImplementation {
-			return tarInterpreter.unwrapRegularFileNew(fileReader, fileInfo, targetPath, fsync)
-		}
-		return tarInterpreter.unwrapRegularFileOld(fileReader, fileInfo, targetPath, fsync)
-	case tar.TypeDir:
-		err := os.MkdirAll(targetPath, 0755)
-		if err != nil {
-			return errors.Wrapf(err, "Interpret: failed to create all directories in %s", targetPath)
-		}
-		if err = os.Chmod(targetPath, os.FileMode(fileInfo.Mode)); err != nil {
-			return errors.Wrap(err, "Interpret: chmod failed")
+	if tarInterpreter.Umask != 0 {
+		maskedInfo := *fileInfo
+		maskedInfo.Mode &^= int64(tarInterpreter.Umask)
+		fileInfo = &maskedInfo
+	}
+	if tarInterpreter.DecompressNestedFiles && isRegularFile(fileInfo) {
+		if decompressor := compression.FindDecompressor(utility.GetFileExtension(fileInfo.Name)); decompressor != nil {
+			decompressed, err := compression.Decompress(decompressor, fileReader, fileInfo.Name)
+			if err != nil {
+				return errors.Wrapf(err, "Interpret: failed to decompress %s", fileInfo.Name)
+			}
+			defer utility.LoggedClose(decompressed, "")
+			decompressedInfo := *fileInfo
+			decompressedInfo.Name = utility.TrimFileExtension(fileInfo.Name)
+			fileReader, fileInfo = decompressed, &decompressedInfo
 		}
-	case tar.TypeLink:
-		if err := os.Link(fileInfo.Name, targetPath); err != nil {
-			return errors.Wrapf(err, "Interpret: failed to create hardlink %s", targetPath)
+	}
+	handler, ok := entryHandlers[fileInfo.Typeflag]
+	if !ok {
+		tracelog.WarningLogger.Printf("Interpret: skipping '%s' of the unsupported tar type %q", fileInfo.Name, fileInfo.Typeflag)
+		return nil
+	}
+	targetPath := path.Join(tarInterpreter.DBDataDirectory, fileInfo.Name)
+	if err := tarInterpreter.checkSymlinkedPath(fileInfo); err != nil {
+		return err
+	}
+	fsync := !viper.GetBool(internal.TarDisableFsyncSetting) && !viper.GetBool(internal.SkipFsyncOnRestoreSetting)
+	return handler(tarInterpreter, fileReader, fileInfo, targetPath, fsync)
+}
+
+func (tarInterpreter *FileTarInterpreter) extractRegularFile(fileReader io.Reader, fileInfo *tar.Header,
+	targetPath string, fsync bool) error {
+	// temporary switch to determine if new unwrap logic should be used
+	if useNewUnwrapImplementation {
+		return tarInterpreter.unwrapRegularFileNew(fileReader, fileInfo, targetPath, fsync)
+	}
+	return tarInterpreter.unwrapRegularFileOld(fileReader, fileInfo, targetPath, fsync)
+}
+
+func (tarInterpreter *FileTarInterpreter) extractDirectory(_ io.Reader, fileInfo *tar.Header,
+	targetPath string, _ bool) error {
+	err := os.MkdirAll(targetPath, 0755&^tarInterpreter.Umask)
+	if err != nil {
+		return errors.Wrapf(err, "Interpret: failed to create all directories in %s", targetPath)
+	}
+	// the headers without the permission bits keep the default mode instead of the unusable 000 directory
+	if fileInfo.FileInfo().Mode().Perm() == 0 {
+		return nil
+	}
+	return errors.Wrap(os.Chmod(targetPath, os.FileMode(fileInfo.Mode)), "Interpret: chmod failed")
+}
+
+// extractHardlink links the entry to the file of the archive named by Linkname, which must be extracted before it
+func (tarInterpreter *FileTarInterpreter) extractHardlink(_ io.Reader, fileInfo *tar.Header,
+	targetPath string, _ bool) error {
+	linkTarget := path.Join(tarInterpreter.DBDataDirectory, fileInfo.Linkname)
+	if !isInsideDirectory(linkTarget, tarInterpreter.DBDataDirectory) {
+		return errors.Errorf("Interpret: hardlink %s points to '%s' outside of the data directory",
+			fileInfo.Name, fileInfo.Linkname)
+	}
+	// links may precede the header of their directory in the archive
+	if err := prepareLinkPath(fileInfo.Name, targetPath); err != nil {
+		return err
+	}
+	if err := os.Link(linkTarget, targetPath); err != nil {
+		return errors.Wrapf(err, "Interpret: failed to create hardlink %s", targetPath)
+	}
+	return nil
+}
+
+// extractSymlink keeps Linkname as is, e.g. the absolute path of the tablespace, so it may point anywhere.
+// The later entries aren't written through it instead, see checkSymlinkedPath.
+func (tarInterpreter *FileTarInterpreter) extractSymlink(_ io.Reader, fileInfo *tar.Header,
+	targetPath string, _ bool) error {
+	if err := prepareLinkPath(fileInfo.Name, targetPath); err != nil {
+		return err
+	}
+	if err := os.Symlink(fileInfo.Linkname, targetPath); err != nil {
+		return errors.Wrapf(err, "Interpret: failed to create symlink %s", targetPath)
+	}
+	tarInterpreter.symlinks.Store(targetPath, true)
+	return nil
+}
+
+// checkSymlinkedPath refuses the entry which would be written through the symlink extracted before it,
+// the path of the entry or of any of its directories. The symlink entry may replace the symlink itself.
+func (tarInterpreter *FileTarInterpreter) checkSymlinkedPath(fileInfo *tar.Header) error {
+	for name := path.Clean(fileInfo.Name); name != "." && name != "/"; name = path.Dir(name) {
+		if name == path.Clean(fileInfo.Name) && fileInfo.Typeflag == tar.TypeSymlink {
+			continue
 		}
-	case tar.TypeSymlink:
-		if err := os.Symlink(fileInfo.Name, targetPath); err != nil {
-			return errors.Wrapf(err, "Interpret: failed to create symlink %s", targetPath)
+		symlinkPath := path.Join(tarInterpreter.DBDataDirectory, name)
+		if _, ok := tarInterpreter.symlinks.Load(symlinkPath); ok {
+			return errors.Errorf("Interpret: %s would be written through the symlink %s extracted from the archive",
+				fileInfo.Name, symlinkPath)
 		}
 	}
 	return nil
 }
 
+// prepareLinkPath creates the directories of the link and removes the link left by the previous attempt
+// to extract the same archive
+func prepareLinkPath(fileName string, targetPath string) error {
+	if err := PrepareDirs(fileName, targetPath); err != nil {
+		return errors.Wrap(err, "Interpret: failed to create all directories")
+	}
+	if err := os.Remove(targetPath); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "Interpret: failed to replace %s", targetPath)
+	}
+	return nil
+}
+
+func isRegularFile(fileInfo *tar.Header) bool {
+	return fileInfo.Typeflag == tar.TypeReg || fileInfo.Typeflag == tar.TypeRegA
+}
+
+func isInsideDirectory(filePath string, directory string) bool {
+	relativePath, err := filepath.Rel(directory, filePath)
+	return err == nil && relativePath != ".." && !strings.HasPrefix(relativePath, "../")
+}
+
 // PrepareDirs makes sure all dirs exist
 func PrepareDirs(fileName string, targetPath string) error {
 	if fileName == targetPath {
@@ -32,6 +32,7 @@ func (tarInterpreter *FileTarInterpreter) unwrapRegularFileNew(fileReader io.Rea
 	var unwrapResult *FileUnwrapResult
 	var unwrapError error
 	if isNewFile {
+		tarInterpreter.writingFiles.Store(targetPath, true)
 		unwrapResult, unwrapError = fileUnwrapper.UnwrapNewFile(fileReader, header, localFile, fsync)
 	} else {
 		unwrapResult, unwrapError = fileUnwrapper.UnwrapExistingFile(fileReader, header, localFile, fsync)
@@ -39,6 +40,7 @@ func (tarInterpreter *FileTarInterpreter) unwrapRegularFileNew(fileReader io.Rea
 	if unwrapError != nil {
 		return unwrapError
 	}
+	tarInterpreter.writingFiles.Delete(targetPath)
 	tarInterpreter.AddFileUnwrapResult(unwrapResult, header.Name)
 	return nil
 }
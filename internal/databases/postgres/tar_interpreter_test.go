@@ -3,11 +3,17 @@ package postgres_test
 import (
 	"archive/tar"
 	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"testing"
 
+	"github.com/wal-g/wal-g/internal"
 	"github.com/wal-g/wal-g/internal/databases/postgres"
+	"github.com/wal-g/wal-g/testtools"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -128,34 +134,337 @@ func TestInterpretTypeDirNested(t *testing.T) {
 }
 
 func TestInterpretTypeLink(t *testing.T) {
-	srcFileInfo, dstFileInfo := testInterpret(t,
-		os.TempDir(),
-
-		"test_file",
-		tar.TypeLink,
-
-		createFile,
-		os.Remove,
-	)
-
+	dbDataDirectory := t.TempDir()
+	tarInterpreter := &postgres.FileTarInterpreter{DBDataDirectory: dbDataDirectory}
+	content := "file content"
+	assert.NoError(t, tarInterpreter.Interpret(bytes.NewBufferString(content),
+		&tar.Header{Name: "base/1/1259", Typeflag: tar.TypeReg, Mode: 0600, Size: int64(len(content))}))
+	link := &tar.Header{Name: "base/5/1259", Typeflag: tar.TypeLink, Linkname: "base/1/1259"}
+	assert.NoError(t, tarInterpreter.Interpret(&bytes.Buffer{}, link))
+	// the extraction of the same archive may be retried
+	assert.NoError(t, tarInterpreter.Interpret(&bytes.Buffer{}, link))
+
+	srcFileInfo, err := os.Lstat(path.Join(dbDataDirectory, "base/1/1259"))
+	assert.NoError(t, err)
+	dstFileInfo, err := os.Lstat(path.Join(dbDataDirectory, "base/5/1259"))
+	assert.NoError(t, err)
 	assert.True(t, os.SameFile(srcFileInfo, dstFileInfo))
+
+	err = tarInterpreter.Interpret(&bytes.Buffer{},
+		&tar.Header{Name: "base/5/1260", Typeflag: tar.TypeLink, Linkname: "../../etc/passwd"})
+	assert.Error(t, err)
 }
 
 func TestInterpretTypeSymlink(t *testing.T) {
-	_, dstFileInfo := testInterpret(t,
-		os.TempDir(),
+	dbDataDirectory := t.TempDir()
+	tarInterpreter := &postgres.FileTarInterpreter{DBDataDirectory: dbDataDirectory}
+	symlink := &tar.Header{Name: "pg_tblspc/16384", Typeflag: tar.TypeSymlink, Linkname: "/mnt/tablespaces/16384"}
+	assert.NoError(t, tarInterpreter.Interpret(&bytes.Buffer{}, symlink))
+	assert.NoError(t, tarInterpreter.Interpret(&bytes.Buffer{}, symlink))
 
-		"test_file",
-		tar.TypeSymlink,
+	dstFileInfo, err := os.Lstat(path.Join(dbDataDirectory, "pg_tblspc/16384"))
+	assert.NoError(t, err)
+	assert.True(t, dstFileInfo.Mode()&os.ModeSymlink != 0)
+	linkname, err := os.Readlink(path.Join(dbDataDirectory, "pg_tblspc/16384"))
+	assert.NoError(t, err)
+	assert.Equal(t, "/mnt/tablespaces/16384", linkname)
+}
 
-		createFile,
-		os.Remove,
-	)
+func TestInterpretTypeSymlink_notWrittenThrough(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	outside := t.TempDir()
+	tarInterpreter := &postgres.FileTarInterpreter{DBDataDirectory: dbDataDirectory}
+	assert.NoError(t, tarInterpreter.Interpret(&bytes.Buffer{},
+		&tar.Header{Name: "escape", Typeflag: tar.TypeSymlink, Linkname: outside}))
+	assert.NoError(t, tarInterpreter.Interpret(&bytes.Buffer{},
+		&tar.Header{Name: "escape_file", Typeflag: tar.TypeSymlink, Linkname: path.Join(outside, "file")}))
+
+	for _, header := range []*tar.Header{
+		{Name: "escape/file", Typeflag: tar.TypeReg, Mode: 0600, Size: 4},
+		{Name: "escape/dir", Typeflag: tar.TypeDir, Mode: 0700},
+		{Name: "escape_file", Typeflag: tar.TypeReg, Mode: 0600, Size: 4},
+	} {
+		err := tarInterpreter.Interpret(bytes.NewBufferString("data"), header)
+		assert.Error(t, err, header.Name)
+	}
+	entries, err := ioutil.ReadDir(outside)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
 
-	assert.True(t, dstFileInfo.Mode()&os.ModeSymlink != 0)
+func TestInterpretUnsupportedType(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	tarInterpreter := &postgres.FileTarInterpreter{DBDataDirectory: dbDataDirectory}
+	assert.NoError(t, tarInterpreter.Interpret(&bytes.Buffer{}, &tar.Header{Name: "fifo", Typeflag: tar.TypeFifo}))
+	_, err := os.Lstat(path.Join(dbDataDirectory, "fifo"))
+	assert.True(t, os.IsNotExist(err))
 }
 
 func TestPrepareDirsForLocalDirectory(t *testing.T) {
 	err := postgres.PrepareDirs("filename", "filename")
 	assert.NoError(t, err)
 }
+
+func TestInterpretOutOfOrderDirectories(t *testing.T) {
+	dbDataDirectory, err := ioutil.TempDir("", "out_of_order")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dbDataDirectory)
+
+	content := []byte("14\n")
+	var archive bytes.Buffer
+	tarWriter := tar.NewWriter(&archive)
+	headers := []*tar.Header{
+		{Name: "base/1/PG_VERSION", Typeflag: tar.TypeReg, Mode: 0600, Size: int64(len(content))},
+		{Name: "pg_tblspc/16384", Typeflag: tar.TypeSymlink, Mode: 0777, Linkname: "/mnt/tablespaces/16384"},
+		{Name: "base/1", Typeflag: tar.TypeDir, Mode: 0700},
+		{Name: "base", Typeflag: tar.TypeDir, Mode: 0700},
+		{Name: "pg_tblspc", Typeflag: tar.TypeDir, Mode: 0700},
+	}
+	for _, header := range headers {
+		assert.NoError(t, tarWriter.WriteHeader(header))
+		if header.Typeflag == tar.TypeReg {
+			_, err = tarWriter.Write(content)
+			assert.NoError(t, err)
+		}
+	}
+	assert.NoError(t, tarWriter.Close())
+
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false)
+	tarReader := tar.NewReader(&archive)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		assert.NoError(t, tarInterpreter.Interpret(tarReader, header))
+	}
+
+	restored, err := ioutil.ReadFile(path.Join(dbDataDirectory, "base/1/PG_VERSION"))
+	assert.NoError(t, err)
+	assert.Equal(t, content, restored)
+
+	dirInfo, err := os.Stat(path.Join(dbDataDirectory, "base/1"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), dirInfo.Mode().Perm())
+
+	linkInfo, err := os.Lstat(path.Join(dbDataDirectory, "pg_tblspc/16384"))
+	assert.NoError(t, err)
+	assert.True(t, linkInfo.Mode()&os.ModeSymlink != 0)
+}
+
+func TestInterpretWithUmask(t *testing.T) {
+	dbDataDirectory, err := ioutil.TempDir("", "umask")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dbDataDirectory)
+
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false)
+	tarInterpreter.Umask = 0077
+
+	err = tarInterpreter.Interpret(&bytes.Buffer{},
+		&tar.Header{Name: "global", Typeflag: tar.TypeDir, Mode: 0755})
+	assert.NoError(t, err)
+	content := "file content"
+	err = tarInterpreter.Interpret(bytes.NewBufferString(content),
+		&tar.Header{Name: "global/pg_control", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))})
+	assert.NoError(t, err)
+
+	dirInfo, err := os.Stat(path.Join(dbDataDirectory, "global"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), dirInfo.Mode().Perm())
+	fileInfo, err := os.Stat(path.Join(dbDataDirectory, "global/pg_control"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fileInfo.Mode().Perm())
+}
+
+// interpretOverExistingFile extracts the file over the pre-existing one with the given overwrite mode
+// and returns the resulting content and the extraction error
+func interpretOverExistingFile(t *testing.T, mode internal.RestoreOverwriteMode) (string, error) {
+	dbDataDirectory, err := ioutil.TempDir("", "overwrite")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dbDataDirectory)
+	targetPath := path.Join(dbDataDirectory, "postgresql.auto.conf")
+	assert.NoError(t, ioutil.WriteFile(targetPath, []byte("existing"), 0600))
+
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false)
+	tarInterpreter.Overwrite = mode
+	content := bytes.NewBufferString("restored")
+	interpretErr := tarInterpreter.Interpret(content,
+		&tar.Header{Name: "postgresql.auto.conf", Typeflag: tar.TypeReg, Mode: 0600, Size: int64(content.Len())})
+	if interpretErr == nil {
+		assert.Equal(t, 0, content.Len(), "the content must be read out")
+	}
+
+	extracted, err := ioutil.ReadFile(targetPath)
+	assert.NoError(t, err)
+	return string(extracted), interpretErr
+}
+
+func TestInterpretOverwritesExistingFile(t *testing.T) {
+	for _, mode := range []internal.RestoreOverwriteMode{"", internal.OverwriteExistingFiles} {
+		content, err := interpretOverExistingFile(t, mode)
+		assert.NoError(t, err)
+		assert.Equal(t, "restored", content)
+	}
+}
+
+func TestInterpretSkipsExistingFile(t *testing.T) {
+	content, err := interpretOverExistingFile(t, internal.SkipExistingFiles)
+	assert.NoError(t, err)
+	assert.Equal(t, "existing", content)
+}
+
+func TestInterpretFailsOnExistingFile(t *testing.T) {
+	content, err := interpretOverExistingFile(t, internal.FailOnExistingFiles)
+	assert.IsType(t, postgres.DestinationFileExistsError{}, err)
+	assert.Equal(t, "existing", content)
+}
+
+func TestInterpretRewritesOwnFileInFailMode(t *testing.T) {
+	dbDataDirectory, err := ioutil.TempDir("", "overwrite")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dbDataDirectory)
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false)
+	tarInterpreter.Overwrite = internal.FailOnExistingFiles
+
+	// the retried archive extracts the same file again
+	for i := 0; i < 2; i++ {
+		err = tarInterpreter.Interpret(bytes.NewBufferString("restored"),
+			&tar.Header{Name: "PG_VERSION", Typeflag: tar.TypeReg, Mode: 0600, Size: 8})
+		assert.NoError(t, err)
+	}
+}
+
+func TestExtractAllKeepsEmptyDirectories(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "empty_dirs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+	dbDataDirectory := path.Join(tempDir, "data")
+
+	content := []byte("14\n")
+	var archive bytes.Buffer
+	tarWriter := tar.NewWriter(&archive)
+	headers := []*tar.Header{
+		{Name: "pg_replslot", Typeflag: tar.TypeDir, Mode: 0700},
+		{Name: "pg_tblspc", Typeflag: tar.TypeDir},
+		{Name: "PG_VERSION", Typeflag: tar.TypeReg, Mode: 0600, Size: int64(len(content))},
+	}
+	for _, header := range headers {
+		assert.NoError(t, tarWriter.WriteHeader(header))
+		if header.Typeflag == tar.TypeReg {
+			_, err = tarWriter.Write(content)
+			assert.NoError(t, err)
+		}
+	}
+	assert.NoError(t, tarWriter.Close())
+	tarPath := path.Join(tempDir, "part_1.tar")
+	assert.NoError(t, ioutil.WriteFile(tarPath, archive.Bytes(), 0600))
+
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false)
+	err = internal.ExtractAll(tarInterpreter, []internal.ReaderMaker{&testtools.FileReaderMaker{Key: tarPath}})
+	assert.NoError(t, err)
+
+	dirInfo, err := os.Stat(path.Join(dbDataDirectory, "pg_replslot"))
+	assert.NoError(t, err)
+	assert.True(t, dirInfo.IsDir())
+	assert.Equal(t, os.FileMode(0700), dirInfo.Mode().Perm())
+
+	// the header without the permission bits gets the default mode
+	dirInfo, err = os.Stat(path.Join(dbDataDirectory, "pg_tblspc"))
+	assert.NoError(t, err)
+	assert.True(t, dirInfo.IsDir())
+	assert.NotZero(t, dirInfo.Mode().Perm())
+}
+
+func gzipBytes(t *testing.T, content []byte) []byte {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, err := writer.Write(content)
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	return compressed.Bytes()
+}
+
+func TestExtractAllDecompressesNestedFiles(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "nested")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	content := []byte("relation data")
+	nested := gzipBytes(t, content)
+	var archive bytes.Buffer
+	tarWriter := tar.NewWriter(&archive)
+	assert.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: "base/1/16384.gz", Typeflag: tar.TypeReg,
+		Mode: 0600, Size: int64(len(nested))}))
+	_, err = tarWriter.Write(nested)
+	assert.NoError(t, err)
+	assert.NoError(t, tarWriter.Close())
+	tarPath := path.Join(tempDir, "part_1.tar.gz")
+	assert.NoError(t, ioutil.WriteFile(tarPath, gzipBytes(t, archive.Bytes()), 0600))
+
+	for _, decompressNested := range []bool{false, true} {
+		dbDataDirectory := path.Join(tempDir, fmt.Sprintf("data_%t", decompressNested))
+		tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+			postgres.FilesMetadataDto{}, nil, false)
+		tarInterpreter.DecompressNestedFiles = decompressNested
+		err = internal.ExtractAll(tarInterpreter, []internal.ReaderMaker{&testtools.FileReaderMaker{Key: tarPath}})
+		assert.NoError(t, err)
+
+		if decompressNested {
+			extracted, err := ioutil.ReadFile(path.Join(dbDataDirectory, "base/1/16384"))
+			assert.NoError(t, err)
+			assert.Equal(t, content, extracted)
+			_, err = os.Stat(path.Join(dbDataDirectory, "base/1/16384.gz"))
+			assert.True(t, os.IsNotExist(err))
+		} else {
+			extracted, err := ioutil.ReadFile(path.Join(dbDataDirectory, "base/1/16384.gz"))
+			assert.NoError(t, err)
+			assert.Equal(t, nested, extracted)
+		}
+	}
+}
+
+func TestRemovePartialFile(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(path.Join(dbDataDirectory, "existing"), []byte("existing"), 0600))
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false)
+
+	// the files the interpreter hasn't created or has written completely are kept
+	complete := &tar.Header{Name: "complete", Typeflag: tar.TypeReg, Mode: 0600, Size: 8}
+	assert.NoError(t, tarInterpreter.Interpret(bytes.NewBufferString("complete"), complete))
+	assert.NoError(t, tarInterpreter.RemovePartialFile(complete))
+	assert.NoError(t, tarInterpreter.RemovePartialFile(&tar.Header{Name: "existing", Typeflag: tar.TypeReg}))
+	assert.FileExists(t, path.Join(dbDataDirectory, "complete"))
+	assert.FileExists(t, path.Join(dbDataDirectory, "existing"))
+}
+
+func TestExtractAllRemovesPartialFile(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	var archive bytes.Buffer
+	tarWriter := tar.NewWriter(&archive)
+	assert.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: "PG_VERSION", Typeflag: tar.TypeReg, Mode: 0600, Size: 3}))
+	_, err := tarWriter.Write([]byte("14\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: "global/pg_control", Typeflag: tar.TypeReg, Mode: 0600,
+		Size: 8192}))
+	_, err = tarWriter.Write(make([]byte, 4096))
+	assert.NoError(t, err)
+	// the archive breaks in the middle of pg_control
+	tarPath := path.Join(t.TempDir(), "part_1.tar")
+	assert.NoError(t, ioutil.WriteFile(tarPath, archive.Bytes(), 0600))
+
+	tarInterpreter := postgres.NewFileTarInterpreter(dbDataDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, nil, false)
+	err = internal.ExtractAllWithOptions(tarInterpreter, []internal.ReaderMaker{&testtools.FileReaderMaker{Key: tarPath}},
+		internal.ExtractRetries(0))
+
+	assert.Error(t, err)
+	assert.FileExists(t, path.Join(dbDataDirectory, "PG_VERSION"))
+	assert.NoFileExists(t, path.Join(dbDataDirectory, "global", "pg_control"))
+}
@@ -108,7 +108,8 @@ func getWalFilename(lsn uint64, conn *pgx.Conn) (walFilename string, timeline ui
 	return walSegmentNo.getFilename(timeline), timeline, nil
 }
 
-func formatWALFileName(timeline uint32, logSegNo uint64) string {
+// FormatWALFileName returns the name of the WAL segment with the given number on the timeline
+func FormatWALFileName(timeline uint32, logSegNo uint64) string {
 	return fmt.Sprintf(walFileFormat, timeline, logSegNo/xLogSegmentsPerXLogID, logSegNo%xLogSegmentsPerXLogID)
 }
 
@@ -180,7 +181,7 @@ func GetNextWalFilename(name string) (string, error) {
 		return "", err
 	}
 	logSegNo++
-	return formatWALFileName(timelineID, logSegNo), nil
+	return FormatWALFileName(timelineID, logSegNo), nil
 }
 
 func shouldPrefault(name string) (lsn uint64, shouldPrefault bool, timelineID uint32, err error) {
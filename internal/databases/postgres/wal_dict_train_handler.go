@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// every WAL page is a separate training sample, a whole segment is too large for the zstd trainer
+const walDictSampleSize = 8192
+
+// HandleWalDictTrain trains the zstd dictionary on the most recent WAL segments in storage
+// and writes it to output, the dictionary is used via WALG_ZSTD_DICTIONARY_PATH
+func HandleWalDictTrain(rootFolder storage.Folder, segmentCount int, dictionarySize int, output io.Writer) error {
+	walFolder := rootFolder.GetSubFolder(utility.WalPath)
+	segmentNames, err := getRecentSegmentNames(walFolder, segmentCount)
+	if err != nil {
+		return err
+	}
+	if len(segmentNames) == 0 {
+		return errors.New("no WAL segments found in storage")
+	}
+
+	var samples [][]byte
+	for _, segmentName := range segmentNames {
+		tracelog.InfoLogger.Printf("Sampling WAL segment %s\n", segmentName)
+		segment, err := downloadSegment(walFolder, segmentName)
+		if err != nil {
+			return err
+		}
+		for len(segment) > 0 {
+			sampleSize := utility.Min(walDictSampleSize, len(segment))
+			samples = append(samples, segment[:sampleSize])
+			segment = segment[sampleSize:]
+		}
+	}
+
+	dictionary, err := compression.TrainZstdDictionary(samples, dictionarySize)
+	if err != nil {
+		return err
+	}
+	tracelog.InfoLogger.Printf("Trained %d bytes dictionary on %d WAL segments\n", len(dictionary), len(segmentNames))
+	_, err = output.Write(dictionary)
+	return err
+}
+
+// getRecentSegmentNames returns the names without extensions of the last modified WAL segments
+func getRecentSegmentNames(walFolder storage.Folder, segmentCount int) ([]string, error) {
+	objects, _, err := walFolder.ListFolder()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list the WAL folder")
+	}
+	var segments []storage.Object
+	for _, object := range objects {
+		if isWalFilename(utility.TrimFileExtension(object.GetName())) {
+			segments = append(segments, object)
+		}
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].GetLastModified().After(segments[j].GetLastModified())
+	})
+
+	names := make([]string, 0, segmentCount)
+	for i := 0; i < len(segments) && i < segmentCount; i++ {
+		names = append(names, utility.TrimFileExtension(segments[i].GetName()))
+	}
+	return names, nil
+}
+
+func downloadSegment(walFolder storage.Folder, segmentName string) ([]byte, error) {
+	reader, err := internal.DownloadAndDecompressStorageFile(walFolder, segmentName)
+	if err != nil {
+		return nil, err
+	}
+	defer utility.LoggedClose(reader, "")
+	return ioutil.ReadAll(reader)
+}
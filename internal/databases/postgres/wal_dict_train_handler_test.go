@@ -0,0 +1,50 @@
+package postgres_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/compression/computils"
+	"github.com/wal-g/wal-g/internal/compression/lz4"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+func putCompressedSegment(t *testing.T, walFolder storage.Folder, name string, content []byte) {
+	var compressed bytes.Buffer
+	writer := compression.Compressors[lz4.AlgorithmName].NewWriter(&compressed)
+	_, err := writer.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	require.NoError(t, walFolder.PutObject(name+"."+lz4.FileExtension, &compressed))
+}
+
+func TestHandleWalDictTrain(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	walFolder := folder.GetSubFolder(utility.WalPath)
+	sample := computils.GenerateWALSample(3 << 20)
+	putCompressedSegment(t, walFolder, "000000010000000000000001", sample[:1<<20])
+	putCompressedSegment(t, walFolder, "000000010000000000000002", sample[1<<20:2<<20])
+	putCompressedSegment(t, walFolder, "000000010000000000000003", sample[2<<20:])
+	require.NoError(t, walFolder.PutObject("000000010000000000000003.00000028.backup", bytes.NewReader([]byte("not a segment"))))
+
+	var dictionary bytes.Buffer
+	require.NoError(t, postgres.HandleWalDictTrain(folder, 2, 16<<10, &dictionary))
+	assert.NotZero(t, dictionary.Len())
+	assert.LessOrEqual(t, dictionary.Len(), 16<<10)
+
+	// the trained dictionary is accepted by WALG_ZSTD_DICTIONARY_PATH
+	require.NoError(t, compression.SetZstdDictionary(dictionary.Bytes()))
+	require.NoError(t, compression.SetZstdDictionary(nil))
+}
+
+func TestHandleWalDictTrain_noSegments(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	err := postgres.HandleWalDictTrain(folder, 10, 16<<10, new(bytes.Buffer))
+	assert.Error(t, err)
+}
@@ -52,7 +52,7 @@ func TestWallFetchCachesLastDecompressor(t *testing.T) {
 }
 
 func TestSetLastDecompressorWorkWell(t *testing.T) {
-	for _, decompressor := range compression.Decompressors {
+	for _, decompressor := range compression.RegisteredDecompressors() {
 		_ = internal.SetLastDecompressor(decompressor)
 		last, err := internal.GetLastDecompressor()
 
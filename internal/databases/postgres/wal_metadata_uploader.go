@@ -69,7 +69,7 @@ func (u *WalMetadataUploader) UploadWalMetadata(walFileName string, createdTime
 		}
 		err = u.uploadBulkMetadataFile(walFileName, uploader)
 	} else {
-		err = uploader.Upload(walMetadataName, bytes.NewReader(dtoBody))
+		err = uploadWalMetadataFile(walMetadataName, dtoBody, uploader)
 	}
 	return errors.Wrapf(err, "upload: could not Upload metadata'%s'\n", walFileName)
 }
@@ -112,7 +112,7 @@ func (u *WalMetadataUploader) uploadBulkMetadataFile(walFileName string, uploade
 	if err != nil {
 		return err
 	}
-	if err = uploader.Upload(walSearchString+".json", bytes.NewReader(dtoBody)); err != nil {
+	if err = uploadWalMetadataFile(walSearchString+".json", dtoBody, uploader); err != nil {
 		return err
 	}
 	//Deleting the temporary metadata files created
@@ -176,3 +176,13 @@ func uploadRemoteWalMetadata(walFileName string, uploader *internal.Uploader) er
 
 	return walMetadataUploader.UploadWalMetadata(walFileName, createdTime, uploader)
 }
+
+// uploadWalMetadataFile uploads the metadata, encrypted if WALG_ENCRYPT_METADATA is set,
+// the local files of the bulk upload stay plaintext
+func uploadWalMetadataFile(name string, dtoBody []byte, uploader *internal.Uploader) error {
+	reader, err := internal.EncryptMetadata(bytes.NewReader(dtoBody))
+	if err != nil {
+		return err
+	}
+	return uploader.Upload(name, reader)
+}
@@ -97,9 +97,9 @@ func (seg *WalSegment) Name() string {
 	// '0/2A33FE00' -> '00000001000000000000002A'
 	segID := uint64(seg.StartLSN) / seg.walSegmentBytes
 	if seg.isComplete() {
-		return formatWALFileName(seg.TimeLine, segID)
+		return FormatWALFileName(seg.TimeLine, segID)
 	}
-	return formatWALFileName(seg.TimeLine, segID) + ".partial"
+	return FormatWALFileName(seg.TimeLine, segID) + ".partial"
 }
 
 // processMessage is a method that processes a message from Postgres and copies its data
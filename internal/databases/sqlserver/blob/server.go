@@ -49,7 +49,7 @@ type Server struct {
 	crypter      crypto.Crypter
 }
 
-func NewServer(folder storage.Folder) (*Server, error) {
+func NewServer(ctx context.Context, folder storage.Folder) (*Server, error) {
 	var err error
 	bs := new(Server)
 	bs.folder = folder
@@ -90,7 +90,10 @@ func NewServer(folder storage.Folder) (*Server, error) {
 		bs.compressor = compressor
 		bs.decompressor = compression.FindDecompressor(bs.compression)
 	}
-	bs.crypter = internal.ConfigureCrypter()
+	bs.crypter, err = internal.ConfigureCrypterContext(ctx)
+	if err != nil {
+		return nil, err
+	}
 	if bs.crypter != nil {
 		bs.encryption = bs.crypter.Name()
 	}
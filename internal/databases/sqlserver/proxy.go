@@ -15,7 +15,7 @@ func RunProxy(folder storage.Folder) {
 	ctx, cancel := context.WithCancel(context.Background())
 	signalHandler := utility.NewSignalHandler(ctx, cancel, []os.Signal{syscall.SIGINT, syscall.SIGTERM})
 	defer func() { _ = signalHandler.Close() }()
-	bs, err := blob.NewServer(folder)
+	bs, err := blob.NewServer(ctx, folder)
 	tracelog.ErrorLogger.FatalfOnError("proxy create error: %v", err)
 	lock, err := bs.AcquireLock()
 	tracelog.ErrorLogger.FatalOnError(err)
@@ -529,7 +529,7 @@ func (lw LockWrapper) Close() {
 }
 
 func RunOrReuseProxy(ctx context.Context, cancel context.CancelFunc, folder storage.Folder) (*LockWrapper, error) {
-	bs, err := blob.NewServer(folder)
+	bs, err := blob.NewServer(ctx, folder)
 	if err != nil {
 		return nil, xerrors.Errorf("proxy create error: %v", err)
 	}
@@ -0,0 +1,172 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/wal-g/tracelog"
+	"golang.org/x/sync/semaphore"
+)
+
+const (
+	// prefetchChunkSize and prefetchChunks bound the compressed data downloaded ahead of the decompression
+	prefetchChunkSize = 1 << 20
+	prefetchChunks    = 4
+)
+
+// decompressionSlots caps the number of files decompressed at once, while more files are downloaded:
+// the download workers are sized by the network and the decompression by the CPUs. The file holds the slot
+// while it decompresses the downloaded data and hands it back while it waits for the network.
+type decompressionSlots struct {
+	semaphore *semaphore.Weighted
+}
+
+// configureDecompressionSlots returns the slots if WALG_DECOMPRESSION_CONCURRENCY is set, otherwise nil
+func configureDecompressionSlots() (*decompressionSlots, error) {
+	if _, ok := GetSetting(DecompressionConcurrency); !ok {
+		return nil, nil
+	}
+	count, err := GetMaxConcurrency(DecompressionConcurrency)
+	if err != nil {
+		return nil, err
+	}
+	tracelog.DebugLogger.Printf("Decompressing at most %d files at once", count)
+	return newDecompressionSlots(count), nil
+}
+
+func newDecompressionSlots(count int) *decompressionSlots {
+	return &decompressionSlots{semaphore.NewWeighted(int64(count))}
+}
+
+// limit wraps the downloaded source, which is read ahead by its own goroutine, and returns the function
+// wrapping the decompressed reader of it. The wrapped source must be closed before the source.
+// Without the cap both are left as they are.
+func (slots *decompressionSlots) limit(source io.ReadCloser) (io.ReadCloser, func(io.ReadCloser) io.ReadCloser) {
+	if slots == nil {
+		return source, func(decompressed io.ReadCloser) io.ReadCloser { return decompressed }
+	}
+	slot := &decompressionSlot{semaphore: slots.semaphore}
+	return newPrefetchingReader(source, slot), func(decompressed io.ReadCloser) io.ReadCloser {
+		return &slotHoldingReader{decompressed, slot}
+	}
+}
+
+// decompressionSlot is the slot of one file, the decompressors reading ahead
+// may use it from several goroutines
+type decompressionSlot struct {
+	semaphore *semaphore.Weighted
+	mutex     sync.Mutex
+	held      bool
+}
+
+func (slot *decompressionSlot) acquire() {
+	// the semaphore is waited for outside the mutex, so the release by the other goroutine isn't blocked
+	_ = slot.semaphore.Acquire(context.Background(), 1)
+	slot.mutex.Lock()
+	defer slot.mutex.Unlock()
+	if slot.held {
+		slot.semaphore.Release(1)
+		return
+	}
+	slot.held = true
+}
+
+func (slot *decompressionSlot) release() {
+	slot.mutex.Lock()
+	defer slot.mutex.Unlock()
+	if slot.held {
+		slot.held = false
+		slot.semaphore.Release(1)
+	}
+}
+
+// slotHoldingReader holds the slot for every Read of the decompressed data
+type slotHoldingReader struct {
+	io.ReadCloser
+	slot *decompressionSlot
+}
+
+func (reader *slotHoldingReader) Read(p []byte) (int, error) {
+	reader.slot.acquire()
+	defer reader.slot.release()
+	return reader.ReadCloser.Read(p)
+}
+
+func (reader *slotHoldingReader) Close() error {
+	reader.slot.release()
+	return reader.ReadCloser.Close()
+}
+
+// prefetchingReader downloads the source ahead of the decompression, and hands the slot back
+// when the decompression waits for the data which isn't downloaded yet
+type prefetchingReader struct {
+	source  io.ReadCloser
+	slot    *decompressionSlot
+	chunks  chan []byte
+	done    chan struct{}
+	current []byte
+	// err is set before chunks is closed
+	err       error
+	closeOnce sync.Once
+}
+
+func newPrefetchingReader(source io.ReadCloser, slot *decompressionSlot) *prefetchingReader {
+	reader := &prefetchingReader{
+		source: source,
+		slot:   slot,
+		chunks: make(chan []byte, prefetchChunks),
+		done:   make(chan struct{}),
+	}
+	go reader.prefetch()
+	return reader
+}
+
+func (reader *prefetchingReader) prefetch() {
+	defer close(reader.chunks)
+	for {
+		chunk := make([]byte, prefetchChunkSize)
+		n, err := io.ReadFull(reader.source, chunk)
+		if n > 0 {
+			select {
+			case reader.chunks <- chunk[:n]:
+			case <-reader.done:
+				return
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			reader.err = io.EOF
+			return
+		}
+		if err != nil {
+			reader.err = err
+			return
+		}
+	}
+}
+
+func (reader *prefetchingReader) Read(p []byte) (int, error) {
+	if len(reader.current) == 0 {
+		var ok bool
+		select {
+		case reader.current, ok = <-reader.chunks:
+		default:
+			reader.slot.release()
+			reader.current, ok = <-reader.chunks
+			reader.slot.acquire()
+		}
+		if !ok {
+			return 0, reader.err
+		}
+	}
+	n := copy(p, reader.current)
+	reader.current = reader.current[n:]
+	return n, nil
+}
+
+// Close stops the prefetching, the source is closed by its owner, and then the prefetching goroutine
+// waiting for it quits on the failed read
+func (reader *prefetchingReader) Close() error {
+	reader.closeOnce.Do(func() { close(reader.done) })
+	return nil
+}
@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingReader is the decompressor busy with the data until it is unblocked
+type blockingReader struct {
+	unblock chan struct{}
+	started chan struct{}
+}
+
+func (reader *blockingReader) Read(p []byte) (int, error) {
+	close(reader.started)
+	<-reader.unblock
+	return 0, io.EOF
+}
+
+func TestDecompressionSlots_passesData(t *testing.T) {
+	content := bytes.Repeat([]byte("data"), prefetchChunkSize)
+	source, limitDecompressed := newDecompressionSlots(1).limit(ioutil.NopCloser(bytes.NewReader(content)))
+	reader := limitDecompressed(ioutil.NopCloser(source))
+
+	read, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, content, read)
+	assert.NoError(t, reader.Close())
+	assert.NoError(t, source.Close())
+}
+
+func TestDecompressionSlots_slotIsHandedBackWhileWaitingForNetwork(t *testing.T) {
+	slots := newDecompressionSlots(1)
+	pipeReader, pipeWriter := io.Pipe()
+	waitingSource, limitWaiting := slots.limit(pipeReader)
+	waiting := limitWaiting(ioutil.NopCloser(waitingSource))
+	waitingDone := make(chan []byte)
+	go func() {
+		read, err := ioutil.ReadAll(waiting)
+		assert.NoError(t, err)
+		waitingDone <- read
+	}()
+
+	source, limitDecompressed := slots.limit(ioutil.NopCloser(bytes.NewReader([]byte("downloaded"))))
+	read, err := ioutil.ReadAll(limitDecompressed(ioutil.NopCloser(source)))
+	require.NoError(t, err)
+	assert.Equal(t, "downloaded", string(read))
+
+	_, err = pipeWriter.Write([]byte("late"))
+	require.NoError(t, err)
+	require.NoError(t, pipeWriter.Close())
+	assert.Equal(t, "late", string(<-waitingDone))
+}
+
+func TestDecompressionSlots_capsDecompression(t *testing.T) {
+	slots := newDecompressionSlots(1)
+	busy := &blockingReader{unblock: make(chan struct{}), started: make(chan struct{})}
+	_, limitBusy := slots.limit(ioutil.NopCloser(bytes.NewReader(nil)))
+	go func() {
+		_, _ = limitBusy(ioutil.NopCloser(busy)).Read(make([]byte, 1))
+	}()
+	<-busy.started
+
+	source, limitDecompressed := slots.limit(ioutil.NopCloser(bytes.NewReader([]byte("data"))))
+	done := make(chan struct{})
+	go func() {
+		_, _ = ioutil.ReadAll(limitDecompressed(ioutil.NopCloser(source)))
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("the second file is decompressed while the only slot is busy")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(busy.unblock)
+	<-done
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/crypto"
+	"github.com/wal-g/wal-g/utility"
+	"golang.org/x/sync/semaphore"
+)
+
+// FormatDetectionHeaderSize is the number of leading bytes read from every file to detect its format
+const FormatDetectionHeaderSize = 1024
+
+const (
+	UnknownFormat = "unknown"
+	TarFormat     = "tar"
+)
+
+// tarMagicOffset is the offset of the "ustar" magic in the tar header
+const tarMagicOffset = 257
+
+// FormatDetection is the format of the file detected by its header.
+// Format is the extension of the detected decompressor, TarFormat, the encryption format
+// or UnknownFormat. Error is set if the header could not be read.
+type FormatDetection struct {
+	Path      string
+	Extension string
+	Format    string
+	Error     error
+}
+
+// DetectFormats reads only the header of every file and detects its format by the magic bytes,
+// so the unrecognized files can be found without downloading the whole objects
+func DetectFormats(files []ReaderMaker, concurrency int) []FormatDetection {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	detections := make([]FormatDetection, len(files))
+	detectingSemaphore := semaphore.NewWeighted(int64(concurrency))
+	for i, file := range files {
+		_ = detectingSemaphore.Acquire(context.Background(), 1)
+		go func(i int, file ReaderMaker) {
+			defer detectingSemaphore.Release(1)
+			format, err := DetectFormat(file)
+			detections[i] = FormatDetection{
+				Path:      file.Path(),
+				Extension: utility.GetFileExtension(file.Path()),
+				Format:    format,
+				Error:     err,
+			}
+		}(i, file)
+	}
+	_ = detectingSemaphore.Acquire(context.Background(), int64(concurrency))
+	return detections
+}
+
+func DetectFormat(file ReaderMaker) (string, error) {
+	reader, err := file.Reader()
+	if err != nil {
+		return "", err
+	}
+	defer utility.LoggedClose(reader, "")
+
+	header := make([]byte, FormatDetectionHeaderSize)
+	n, err := io.ReadFull(reader, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return detectHeaderFormat(header[:n]), nil
+}
+
+func detectHeaderFormat(header []byte) string {
+	if decompressor := compression.FindDecompressorByMagic(header); decompressor != nil {
+		return decompressor.FileExtension()
+	}
+	if encryption := crypto.DetectEncryption(header); encryption != "" {
+		return encryption
+	}
+	if len(header) > tarMagicOffset && bytes.HasPrefix(header[tarMagicOffset:], []byte("ustar")) {
+		return TarFormat
+	}
+	return UnknownFormat
+}
@@ -0,0 +1,49 @@
+package internal_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/compression/gzip"
+	"github.com/wal-g/wal-g/internal/compression/lz4"
+)
+
+func compressedReaderMaker(path string, compressor compression.Compressor) *BufferReaderMaker {
+	buffer := &bytes.Buffer{}
+	_, _ = buffer.ReadFrom(internal.CompressAndEncrypt(bytes.NewReader(generateRandomBytes()), compressor, nil))
+	return &BufferReaderMaker{buffer, path}
+}
+
+func TestDetectFormats(t *testing.T) {
+	tar, _ := makeTar("booba")
+	files := []internal.ReaderMaker{
+		compressedReaderMaker("base/1/1259.gz", gzip.Compressor{}),
+		compressedReaderMaker("base/1/1260", lz4.Compressor{}),
+		compressedReaderMaker("base/1/1261", nil),
+		&BufferReaderMaker{&bytes.Buffer{}, "base/1/empty"},
+		&tar,
+	}
+
+	detections := internal.DetectFormats(files, 2)
+
+	assert.Len(t, detections, len(files))
+	expected := []struct {
+		extension string
+		format    string
+	}{
+		{"gz", gzip.FileExtension},
+		{"", lz4.FileExtension},
+		{"", internal.UnknownFormat},
+		{"", internal.UnknownFormat},
+		{"tar", internal.TarFormat},
+	}
+	for i, detection := range detections {
+		assert.NoError(t, detection.Error)
+		assert.Equal(t, files[i].Path(), detection.Path)
+		assert.Equal(t, expected[i].extension, detection.Extension)
+		assert.Equal(t, expected[i].format, detection.Format)
+	}
+}
@@ -11,6 +11,11 @@ func NewExponentialSleeper(startSleepDuration, sleepDurationBound time.Duration)
 	return &ExponentialSleeper{startSleepDuration, sleepDurationBound}
 }
 
+// NextSleepDuration is how long the next Sleep lasts, every Sleep doubles it up to the bound
+func (sleeper *ExponentialSleeper) NextSleepDuration() time.Duration {
+	return sleeper.sleepDuration
+}
+
 func (sleeper *ExponentialSleeper) Sleep() {
 	time.Sleep(sleeper.sleepDuration)
 	sleeper.sleepDuration *= 2
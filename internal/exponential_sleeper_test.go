@@ -0,0 +1,20 @@
+package internal_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal"
+)
+
+func TestExponentialSleeper_NextSleepDuration(t *testing.T) {
+	sleeper := internal.NewExponentialSleeper(time.Millisecond, 3*time.Millisecond)
+	var durations []time.Duration
+	for i := 0; i < 4; i++ {
+		durations = append(durations, sleeper.NextSleepDuration())
+		sleeper.Sleep()
+	}
+	assert.Equal(t, []time.Duration{time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond, 3 * time.Millisecond},
+		durations)
+}
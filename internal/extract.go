@@ -2,21 +2,29 @@ package internal
 
 import (
 	"archive/tar"
+	"bufio"
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/spf13/viper"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal/compression"
 	"github.com/wal-g/wal-g/internal/crypto"
+	"github.com/wal-g/wal-g/internal/ioextensions"
+	"github.com/wal-g/wal-g/internal/signing"
 	"github.com/wal-g/wal-g/utility"
 	"golang.org/x/sync/semaphore"
 )
 
+// defaultRawFileMode is the mode of the files copied as is, if the storage doesn't tell it
+const defaultRawFileMode = 0640
+
 var MinExtractRetryWait = time.Minute
 var MaxExtractRetryWait = 5 * time.Minute
 
@@ -73,8 +81,10 @@ func (e *DevNullWriter) Write(p []byte) (int, error) {
 
 var _ io.Writer = &DevNullWriter{}
 
-// TODO : unit tests
 // Extract exactly one tar bundle.
+// The PAX extended headers (typeflag 'x') are consumed by tar.Reader and merged into the header
+// of the entry they precede: the long names, the large sizes and the xattrs in PAXRecords.
+// The global headers (typeflag 'g') describe the whole archive rather than any file, so they are not interpreted.
 func extractOneTar(tarInterpreter TarInterpreter, source io.Reader) error {
 	tarReader := tar.NewReader(source)
 
@@ -86,11 +96,45 @@ func extractOneTar(tarInterpreter TarInterpreter, source io.Reader) error {
 		if err != nil {
 			return errors.Wrap(err, "extractOne: tar extract failed")
 		}
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			tracelog.DebugLogger.Printf("extractOne: skipping PAX global header %v", header.PAXRecords)
+			continue
+		}
 
-		err = tarInterpreter.Interpret(tarReader, header)
+		entryReader := &tarEntryReader{reader: tarReader}
+		err = tarInterpreter.Interpret(entryReader, header)
 		if err != nil {
 			return errors.Wrap(err, "extractOne: Interpret failed")
 		}
+		err = entryReader.checkSize(header)
+		if err != nil {
+			return errors.Wrap(err, "extractOne: tar extract failed")
+		}
+	}
+	return nil
+}
+
+// tarEntryReader counts the bytes of the tar entry read by the interpreter
+type tarEntryReader struct {
+	reader io.Reader
+	read   int64
+}
+
+func (entryReader *tarEntryReader) Read(p []byte) (n int, err error) {
+	n, err = entryReader.reader.Read(p)
+	entryReader.read += int64(n)
+	return
+}
+
+// checkSize reads the rest of the regular file entry, which the interpreter could leave unread,
+// and fails with TarEntrySizeMismatchError if the entry turns out shorter than its header declares
+func (entryReader *tarEntryReader) checkSize(header *tar.Header) error {
+	if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+		return nil
+	}
+	_, err := io.Copy(ioutil.Discard, entryReader)
+	if err != nil || entryReader.read != header.Size {
+		return newTarEntrySizeMismatchError(header.Name, header.Size, entryReader.read, err)
 	}
 	return nil
 }
@@ -111,65 +155,325 @@ func extractNonTar(tarInterpreter TarInterpreter, source io.Reader, path string,
 
 // DecryptAndDecompressTar decrypts file and checks its extension.
 // If it's tar, a decompression is not needed.
-// Otherwise it uses corresponding decompressor. If none found an error will be returned.
+// Otherwise it uses corresponding decompressor. If extension is unknown,
+// decompressor is detected by the magic bytes of the stream. If none found an error will be returned.
+// Without crypter the stream which looks encrypted fails with PossiblyEncryptedError, with crypter the stream
+// which looks compressed or tar is not decrypted unless StrictEncryptionSetting is set.
+// The decoder failures are reported as computils.DecompressionError with the consumed bytes count.
 func DecryptAndDecompressTar(reader io.Reader, filePath string, crypter crypto.Crypter) (io.ReadCloser, error) {
-	var err error
+	readCloser, _, err := decryptAndDecompressTar(reader, filePath, "", crypter, nil,
+		false, viper.GetBool(StrictEncryptionSetting), &sync.Once{})
+	return readCloser, err
+}
+
+// DecryptAndDecompressEncodedTar is DecryptAndDecompressTar for the object stored with the content encoding,
+// e.g. gzip applied by the storage proxy. The content encoding is decoded first, so the file
+// with no extension and no other compression is treated as tar.
+func DecryptAndDecompressEncodedTar(reader io.Reader, filePath string, contentEncoding string,
+	crypter crypto.Crypter) (io.ReadCloser, error) {
+	readCloser, _, err := decryptAndDecompressTar(reader, filePath, contentEncoding, crypter, nil,
+		false, viper.GetBool(StrictEncryptionSetting), &sync.Once{})
+	return readCloser, err
+}
+
+// TarMemberRange is the position of the tar entry, its header included, in the uncompressed tar,
+// e.g. taken from the offset index of the backup
+type TarMemberRange struct {
+	Offset int64
+	Length int64
+}
+
+// DecryptAndDecompressTarMember is DecryptAndDecompressTar returning only the member range of the tar,
+// so tar.Reader of the result reads the member. The plain tar file, neither compressed nor encrypted,
+// is seeked to the member if the reader is io.Seeker, e.g. the object of the fs storage.
+// Otherwise the decompressed stream is read up to the member.
+func DecryptAndDecompressTarMember(reader io.Reader, filePath string, crypter crypto.Crypter,
+	member TarMemberRange) (io.ReadCloser, error) {
+	if seeker, ok := reader.(io.Seeker); ok && crypter == nil && utility.GetFileExtension(filePath) == "tar" {
+		if _, err := seeker.Seek(member.Offset, io.SeekStart); err != nil {
+			return nil, errors.Wrapf(err, "DecryptAndDecompressTarMember: failed to seek %s to %d",
+				filePath, member.Offset)
+		}
+		return io.NopCloser(io.LimitReader(reader, member.Length)), nil
+	}
 
+	readCloser, err := DecryptAndDecompressTar(reader, filePath, crypter)
+	if err != nil {
+		return nil, err
+	}
+	skipped, err := io.CopyN(io.Discard, readCloser, member.Offset)
+	if err != nil {
+		_ = readCloser.Close()
+		if err == io.EOF {
+			return nil, errors.Errorf("DecryptAndDecompressTarMember: %s ends at %d before the member at %d",
+				filePath, skipped, member.Offset)
+		}
+		return nil, errors.Wrapf(err, "DecryptAndDecompressTarMember: failed to read %s up to the member", filePath)
+	}
+	return &ioextensions.ReadCascadeCloser{Reader: io.LimitReader(readCloser, member.Length), Closer: readCloser}, nil
+}
+
+// decryptAndDecompressTar is DecryptAndDecompressEncodedTar measuring its phases in the trace, if trace is not nil.
+// With unknownAsRaw the file of unknown type is returned as is instead of UnsupportedFileTypeError, raw is true then.
+// The crypter whose output has the recognizable header doesn't decrypt the file without it, which is read
+// as is if it looks compressed or tar, and fails the strictEncryption restore. The plaintextWarning is logged
+// once for all such files of the restore.
+func decryptAndDecompressTar(reader io.Reader, filePath string, contentEncoding string, crypter crypto.Crypter,
+	trace *fileExtractionTrace, unknownAsRaw, strictEncryption bool,
+	plaintextWarning *sync.Once) (readCloser io.ReadCloser, raw bool, err error) {
+	reader = trace.timeReader(downloadPhase, reader)
+
+	var contentDecoder io.ReadCloser
+	if contentEncoding != "" {
+		contentDecoder, err = decodeContentEncoding(reader, filePath, contentEncoding)
+		if err != nil {
+			return nil, false, err
+		}
+		reader = contentDecoder
+	}
+
+	if formats := crypto.EncryptionFormats(crypter); len(formats) > 0 {
+		var plaintext bool
+		reader, plaintext, err = detectPlaintext(reader, filePath, formats, strictEncryption)
+		if err != nil {
+			return nil, false, err
+		}
+		if plaintext {
+			plaintextWarning.Do(func() {
+				tracelog.WarningLogger.Printf("%s is not encrypted, the files which look compressed or tar "+
+					"are read without decryption, set %s to fail on them", filePath, StrictEncryptionSetting)
+			})
+			tracelog.DebugLogger.Printf("Reading the unencrypted file %s without decryption", filePath)
+			crypter = nil
+		}
+	}
+
+	var decrypted io.Reader
 	if crypter != nil {
-		reader, err = crypter.Decrypt(reader)
+		decryptStart := time.Now()
+		decrypted, err = crypter.Decrypt(reader)
 		if err != nil {
-			return nil, errors.Wrap(err, "DecryptAndDecompressTar: decrypt failed")
+			return nil, false, errors.Wrap(err, "DecryptAndDecompressTar: decrypt failed")
+		}
+		reader = decrypted
+		trace.addSetupTime(decryptPhase, decryptStart)
+	} else {
+		reader, err = checkNotEncrypted(reader, filePath)
+		if err != nil {
+			return nil, false, err
 		}
 	}
+	reader = trace.timeReader(decryptPhase, reader)
 
+	decompressStart := time.Now()
+	readCloser, raw, err = decompressTar(reader, filePath, contentDecoder != nil, unknownAsRaw)
+	if err != nil {
+		_ = crypto.CloseDecrypted(decrypted)
+		return nil, false, err
+	}
+	trace.addSetupTime(decompressPhase, decompressStart)
+	if closer, ok := decrypted.(io.Closer); ok {
+		// e.g. the decryption process must not outlive the extraction of the file
+		readCloser = &layeredReadCloser{readCloser, closer}
+	}
+	if contentDecoder != nil {
+		readCloser = &layeredReadCloser{readCloser, contentDecoder}
+	}
+	return trace.timeReadCloser(decompressPhase, readCloser), raw, nil
+}
+
+// detectPlaintext peeks the stream header to tell the plaintext file, e.g. the one uploaded before the encryption
+// was enabled, from the one encrypted by the crypter of the formats, whose output always has the header.
+// The file without the encryption header is plaintext if its header is compressed or tar, but with strictEncryption
+// it fails with crypto.ErrNotEncrypted. The returned reader still contains the peeked header.
+func detectPlaintext(reader io.Reader, filePath string, formats []string,
+	strictEncryption bool) (io.Reader, bool, error) {
+	bufReader := bufio.NewReader(reader)
+	header, err := bufReader.Peek(FormatDetectionHeaderSize)
+	if err != nil && err != io.EOF {
+		return nil, false, errors.Wrap(err, "DecryptAndDecompressTar: failed to read file header")
+	}
+	if crypto.DetectEncryption(header) != "" {
+		return bufReader, false, nil
+	}
+	if strictEncryption {
+		return nil, false, errors.Wrapf(crypto.ErrNotEncrypted, "%s has no %s header, unset %s to read "+
+			"such files without the decryption", filePath, strings.Join(formats, " or "), StrictEncryptionSetting)
+	}
+	return bufReader, detectHeaderFormat(header) != UnknownFormat, nil
+}
+
+// decompressTar picks the decompressor by the file extension or by the magic bytes,
+// the content decoded stream without both of them is the plain tar
+func decompressTar(reader io.Reader, filePath string, contentDecoded bool,
+	unknownAsRaw bool) (readCloser io.ReadCloser, raw bool, err error) {
 	fileExtension := utility.GetFileExtension(filePath)
 	if fileExtension == "tar" {
-		return io.NopCloser(reader), nil
+		return io.NopCloser(reader), false, nil
 	}
 
 	decompressor := compression.FindDecompressor(fileExtension)
 	if decompressor == nil {
-		return nil, newUnsupportedFileTypeError(filePath, fileExtension)
+		decompressor, reader, err = compression.DetectDecompressor(reader)
+		if err != nil {
+			return nil, false, errors.Wrap(err, "DecryptAndDecompressTar: failed to read file header")
+		}
+		if decompressor == nil && contentDecoded {
+			return io.NopCloser(reader), false, nil
+		}
+		if decompressor == nil && unknownAsRaw {
+			tracelog.WarningLogger.Printf("Copying %s as is: WAL-G does not support the file format '%s'",
+				filePath, fileExtension)
+			return io.NopCloser(reader), true, nil
+		}
+		if decompressor == nil {
+			return nil, false, newUnsupportedFileTypeError(filePath, fileExtension)
+		}
+		tracelog.DebugLogger.Printf("Detected '%s' compression of %s by magic bytes",
+			decompressor.FileExtension(), filePath)
 	}
 
-	return decompressor.Decompress(reader)
+	source := &compressedSourceReader{underlying: reader}
+	readCloser, err = compression.Decompress(decompressor, source, filePath)
+	if err != nil {
+		return nil, false, source.decodeError(err, decompressor.FileExtension())
+	}
+	return &decompressedReader{readCloser, source, decompressor.FileExtension()}, false, nil
 }
 
-// ExtractAll Handles all files passed in. Supports `.lzo`, `.lz4`, `.lzma`, and `.tar`.
+// ExtractAll Handles all files passed in. Supports `.lzo`, `.lz4`, `.lzma`, `.xz`, `.bz2`, and `.tar`.
 // File type `.nop` is used for testing purposes. Each file is extracted
 // in its own goroutine and ExtractAll will wait for all goroutines to finish.
 // Retries unsuccessful attempts log2(MaxConcurrency) times, dividing concurrency by two each time.
+// The failures which the retries don't fix, like the corrupt or missing files, are returned without the retries.
 func ExtractAll(tarInterpreter TarInterpreter, files []ReaderMaker) error {
-	return ExtractAllWithSleeper(tarInterpreter, files, NewExponentialSleeper(MinExtractRetryWait, MaxExtractRetryWait))
+	return ExtractAllWithOptions(tarInterpreter, files)
 }
 
 func ExtractAllWithSleeper(tarInterpreter TarInterpreter, files []ReaderMaker, sleeper Sleeper) error {
+	return ExtractAllWithOptions(tarInterpreter, files, ExtractSleeper(sleeper))
+}
+
+// ExtractAllWithOptions is ExtractAll with the retries, concurrency and the files to extract set by the options
+func ExtractAllWithOptions(tarInterpreter TarInterpreter, files []ReaderMaker, options ...ExtractOption) error {
 	if len(files) == 0 {
 		return newNoFilesToExtractError()
 	}
+	extractOptions := newExtractOptions(options)
+	files = filterReaderMakers(files, extractOptions.predicate)
 
 	// Set maximum number of goroutines spun off by ExtractAll
-	downloadingConcurrency, err := GetMaxDownloadConcurrency()
+	downloadingConcurrency := extractOptions.concurrency
+	if downloadingConcurrency <= 0 {
+		var err error
+		downloadingConcurrency, err = GetMaxDownloadConcurrency()
+		if err != nil {
+			return err
+		}
+	}
+	verifier, err := configureRequiredSignatureVerifier()
 	if err != nil {
 		return err
 	}
-	for currentRun := files; len(currentRun) > 0; {
-		failed := tryExtractFiles(currentRun, tarInterpreter, downloadingConcurrency)
+	crypter, err := ConfigureDecryptingCrypter()
+	if err != nil {
+		return err
+	}
+	hostSlots, err := configureHostExtractionSlots()
+	if err != nil {
+		return err
+	}
+	decompression, err := configureDecompressionSlots()
+	if err != nil {
+		return err
+	}
+	multipart, err := configureMultipartDownload()
+	if err != nil {
+		return err
+	}
+	perFileTimeout, err := GetPerFileExtractTimeout()
+	if err != nil {
+		return err
+	}
+	if viper.GetBool(CheckStorageTierSetting) {
+		if err := checkArchivedFiles(files, downloadingConcurrency); err != nil {
+			return err
+		}
+	}
+	logStoredSize(files)
+	phaseTimer := newExtractionPhaseTimer()
+	defer phaseTimer.logTotal()
+	// there may be thousands of the files uploaded before the encryption, the warning is logged once per restore
+	plaintextWarning := &sync.Once{}
+	defer releaseDataKeys()
+	for currentRun, retries := files, 0; len(currentRun) > 0; retries++ {
+		failed, failure := tryExtractFiles(currentRun, tarInterpreter, downloadingConcurrency, hostSlots, decompression,
+			multipart, perFileTimeout, phaseTimer, crypter, verifier, plaintextWarning, extractOptions.progress)
+		var extractionErrors ExtractionErrors
+		if errors.As(failure, &extractionErrors) && extractionErrors.hasPermanentFailure() {
+			// the corrupt file stays corrupt, the lower concurrency would only slow down the other retries
+			return failure
+		}
+		if len(failed) > 0 && retries == extractOptions.maxRetries {
+			return failure
+		}
 		if downloadingConcurrency > 1 {
 			downloadingConcurrency /= 2
 		} else if len(failed) == len(currentRun) {
-			return errors.Errorf("failed to extract files:\n%s\n",
-				strings.Join(readerMakersToFilePaths(failed), "\n"))
+			return failure
 		}
 		currentRun = failed
 		if len(failed) > 0 {
-			sleeper.Sleep()
+			logRetryDelay(extractOptions.sleeper, fmt.Sprintf("the extraction of %d files", len(failed)))
+			extractOptions.sleeper.Sleep()
 		}
 	}
 
 	return nil
 }
 
+// logStoredSize logs the total size of the objects to download, as far as the storage listing reported it
+func logStoredSize(files []ReaderMaker) {
+	var totalSize int64
+	unknown := 0
+	for _, file := range files {
+		if size, ok := sizeOf(file); ok {
+			totalSize += size
+		} else {
+			unknown++
+		}
+	}
+	if unknown == len(files) {
+		return
+	}
+	if unknown > 0 {
+		tracelog.DebugLogger.Printf("Extracting %d files of %d bytes in storage and %d files of unknown size",
+			len(files)-unknown, totalSize, unknown)
+		return
+	}
+	tracelog.DebugLogger.Printf("Extracting %d files of %d bytes in storage", len(files), totalSize)
+}
+
+func filterReaderMakers(files []ReaderMaker, predicate func(ReaderMaker) bool) []ReaderMaker {
+	filtered := make([]ReaderMaker, 0, len(files))
+	for _, file := range files {
+		if predicate(file) {
+			filtered = append(filtered, file)
+		}
+	}
+	return filtered
+}
+
+// releaseDataKeys zeroizes the data keys unwrapped during the restore, the KMS crypters cache them
+// to unwrap every key once rather than once per file
+func releaseDataKeys() {
+	hits, misses := crypto.DefaultDataKeyCache.Stats()
+	if hits+misses > 0 {
+		tracelog.DebugLogger.Printf("Data key cache: %d hits, %d unwrap calls", hits, misses)
+	}
+	crypto.DefaultDataKeyCache.Zeroize()
+}
+
 // Extract single file from backup
 // If it is .tar file unpack it and store internal files (there will be .tar file if you work with wal-g backup)
 // Otherwise store this file (there will be regular file if you work with pgbackrest backup)
@@ -190,59 +494,154 @@ func extractFile(tarInterpreter TarInterpreter, extractingReader io.Reader, file
 	}
 }
 
+// extractRawFile stores the file of unknown type as is, under its full name
+func extractRawFile(tarInterpreter TarInterpreter, extractingReader io.Reader, fileClosure ReaderMaker) error {
+	mode := fileClosure.Mode()
+	if mode == 0 {
+		mode = defaultRawFileMode
+	}
+	return extractNonTar(tarInterpreter, extractingReader, fileClosure.Path(), RegularFileType, mode)
+}
+
 // TODO : unit tests
+// tryExtractFiles returns the files which failed to extract along with their errors as ExtractionErrors.
+// The partially written output of the failed file is removed, see PartialFileRemover.
+// The file which didn't extract in perFileTimeout fails with FileExtractTimeoutError once its aborted extraction stops.
 func tryExtractFiles(files []ReaderMaker,
 	tarInterpreter TarInterpreter,
-	downloadingConcurrency int) (failed []ReaderMaker) {
+	downloadingConcurrency int,
+	hostSlots *hostExtractionSlots,
+	decompression *decompressionSlots,
+	multipart *multipartDownload,
+	perFileTimeout time.Duration,
+	phaseTimer *extractionPhaseTimer,
+	crypter crypto.Crypter,
+	verifier signing.Verifier,
+	plaintextWarning *sync.Once,
+	progress func(ReaderMaker, error)) (failed []ReaderMaker, failure error) {
 	downloadingContext := context.TODO()
 	downloadingSemaphore := semaphore.NewWeighted(int64(downloadingConcurrency))
-	crypter := ConfigureCrypter()
+	resumeAttempts := viper.GetInt(DownloadResumeAttempts)
+	verifyChecksum := viper.GetBool(VerifyDownloadChecksum)
+	unknownAsRaw := viper.GetBool(ExtractUnknownAsRawSetting)
+	strictEncryption := viper.GetBool(StrictEncryptionSetting)
 	isFailed := sync.Map{}
 
 	for _, file := range files {
 		err := downloadingSemaphore.Acquire(downloadingContext, 1)
 		if err != nil {
 			tracelog.ErrorLogger.Println(err)
-			return files //Should never happen, but if we are asked to cancel - consider all files unfinished
+			return files, err //Should never happen, but if we are asked to cancel - consider all files unfinished
 		}
 		fileClosure := file
 
 		go func() {
 			defer downloadingSemaphore.Release(1)
 
-			readCloser, err := fileClosure.Reader()
-			if err == nil {
-				defer utility.LoggedClose(readCloser, "")
-
-				filePath := fileClosure.Path()
-				var extractingReader io.ReadCloser
-				extractingReader, err = DecryptAndDecompressTar(readCloser, filePath, crypter)
+			err := extractWithTimeout(fileClosure, perFileTimeout, func(watchdog *extractionWatchdog) error {
+				tracker := newPartialFileTracker(tarInterpreter)
+				slot, err := hostSlots.acquire(watchdog.context())
 				if err == nil {
-					defer extractingReader.Close()
-					err = extractFile(tarInterpreter, extractingReader, fileClosure)
-					err = errors.Wrapf(err, "Extraction error in %s", filePath)
-					tracelog.InfoLogger.Printf("Finished extraction of %s", filePath)
+					slot = watchdog.hold(slot)
+					defer utility.LoggedClose(slot, "failed to unlock the host extraction slot")
 				}
-			}
+				trace := phaseTimer.newFileTrace()
+				openStart := time.Now()
+				var readCloser io.ReadCloser
+				var signatureReader *SignatureVerifyingReader
+				var checksumReader *checksumVerifyingReader
+				if err == nil {
+					readCloser, err = multipart.open(fileClosure, resumeAttempts)
+				}
+				if err == nil {
+					readCloser = watchdog.watch(readCloser)
+					defer utility.LoggedClose(readCloser, "")
+					if verifyChecksum {
+						readCloser = newChecksumVerifyingReader(readCloser, fileClosure)
+						checksumReader, _ = readCloser.(*checksumVerifyingReader)
+					}
+					if verifier != nil {
+						signatureReader, err = verifyReaderMakerSignature(readCloser, fileClosure, verifier)
+						if err == nil {
+							readCloser = ioutil.NopCloser(signatureReader)
+						}
+					}
+				}
+				limitDecompressed := func(decompressed io.ReadCloser) io.ReadCloser { return decompressed }
+				if err == nil {
+					var limited io.ReadCloser
+					limited, limitDecompressed = decompression.limit(readCloser)
+					if limited != readCloser {
+						defer utility.LoggedClose(limited, "failed to close the prefetching reader")
+					}
+					readCloser = limited
+				}
+				if err == nil {
+					trace.addSetupTime(downloadPhase, openStart)
+
+					filePath := fileClosure.Path()
+					var extractingReader io.ReadCloser
+					var raw bool
+					extractingReader, raw, err = decryptAndDecompressTar(readCloser, filePath,
+						contentEncodingOf(fileClosure), crypter, trace, unknownAsRaw, strictEncryption,
+						plaintextWarning)
+					if err == nil {
+						extractingReader = limitDecompressed(extractingReader)
+						if raw {
+							err = extractRawFile(tracker, extractingReader, fileClosure)
+						} else {
+							err = extractFile(tracker, extractingReader, fileClosure)
+						}
+						if closeErr := extractingReader.Close(); err == nil {
+							err = closeErr
+						}
+						if signatureReader != nil {
+							// the tar reader stops before the padding at the end of the object,
+							// and the modified object is likely to fail the decompression first
+							verifyErr := signatureReader.Verify()
+							if err == nil || errors.Is(verifyErr, signing.ErrSignatureMismatch) {
+								err = verifyErr
+							}
+						}
+						if err != nil {
+							tracker.removePartialFile()
+						}
+						err = errors.Wrapf(err, "Extraction error in %s", filePath)
+						tracelog.InfoLogger.Printf("Finished extraction of %s", describeObject(fileClosure))
+						phaseTimer.finishFile(filePath, trace)
+					}
+				}
+				if err != nil && checksumReader != nil {
+					err = checksumReader.explainFailure(err)
+				}
+				return err
+			})
 
 			if err != nil {
-				isFailed.Store(fileClosure, true)
+				isFailed.Store(fileClosure, err)
 				tracelog.ErrorLogger.Println(err)
 			}
+			progress(fileClosure, err)
 		}()
 	}
 
 	err := downloadingSemaphore.Acquire(downloadingContext, int64(downloadingConcurrency))
 	if err != nil {
 		tracelog.ErrorLogger.Println(err)
-		return files //Should never happen, but if we are asked to cancel - consider all files unfinished
+		return files, err //Should never happen, but if we are asked to cancel - consider all files unfinished
 	}
 
-	isFailed.Range(func(failedFile, _ interface{}) bool {
+	var extractionErrors ExtractionErrors
+	isFailed.Range(func(failedFile, fileErr interface{}) bool {
 		failed = append(failed, failedFile.(ReaderMaker))
+		extractionErrors.Failures = append(extractionErrors.Failures,
+			newExtractionFailure(failedFile.(ReaderMaker), fileErr.(error)))
 		return true
 	})
-	return failed
+	if len(failed) == 0 {
+		return nil, nil
+	}
+	return failed, extractionErrors
 }
 
 func readTrailingZeros(r io.Reader) error {
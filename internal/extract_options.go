@@ -0,0 +1,63 @@
+package internal
+
+// ExtractOption configures ExtractAllWithOptions
+type ExtractOption func(*extractOptions)
+
+type extractOptions struct {
+	sleeper     Sleeper
+	concurrency int
+	// maxRetries is negative when the retries are limited only by the progress they make
+	maxRetries int
+	predicate  func(ReaderMaker) bool
+	progress   func(file ReaderMaker, err error)
+}
+
+func newExtractOptions(options []ExtractOption) *extractOptions {
+	extractOptions := &extractOptions{
+		sleeper:    NewExponentialSleeper(MinExtractRetryWait, MaxExtractRetryWait),
+		maxRetries: -1,
+		predicate:  func(ReaderMaker) bool { return true },
+		progress:   func(ReaderMaker, error) {},
+	}
+	for _, option := range options {
+		option(extractOptions)
+	}
+	return extractOptions
+}
+
+// ExtractSleeper sets the Sleeper which waits between the retries, the exponential one by default
+func ExtractSleeper(sleeper Sleeper) ExtractOption {
+	return func(options *extractOptions) {
+		options.sleeper = sleeper
+	}
+}
+
+// ExtractConcurrency sets the number of the files extracted at once, WALG_DOWNLOAD_CONCURRENCY by default
+func ExtractConcurrency(concurrency int) ExtractOption {
+	return func(options *extractOptions) {
+		options.concurrency = concurrency
+	}
+}
+
+// ExtractRetries limits the number of the retries of the failed files, zero disables the retries.
+// By default the files are retried as long as the retries extract some of them.
+func ExtractRetries(maxRetries int) ExtractOption {
+	return func(options *extractOptions) {
+		options.maxRetries = maxRetries
+	}
+}
+
+// ExtractPredicate sets the filter of the files to extract, the files it rejects are skipped
+func ExtractPredicate(predicate func(ReaderMaker) bool) ExtractOption {
+	return func(options *extractOptions) {
+		options.predicate = predicate
+	}
+}
+
+// ExtractProgress sets the callback called after every attempt to extract a file, with nil error on success.
+// It's called concurrently from the extracting goroutines.
+func ExtractProgress(progress func(file ReaderMaker, err error)) ExtractOption {
+	return func(options *extractOptions) {
+		options.progress = progress
+	}
+}
@@ -1,16 +1,31 @@
 package internal_test
 
 import (
+	"archive/tar"
 	"bufio"
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression/computils"
+	"github.com/wal-g/wal-g/internal/compression/gzip"
+	"github.com/wal-g/wal-g/internal/compression/lz4"
+	"github.com/wal-g/wal-g/internal/crypto"
 	"github.com/wal-g/wal-g/internal/crypto/openpgp"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
 	"github.com/wal-g/wal-g/testtools"
 	"github.com/wal-g/wal-g/utility"
 )
@@ -34,6 +49,214 @@ func TestExtractAll_fileDoesntExist(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestExtractAll_extractionErrors(t *testing.T) {
+	os.Setenv(internal.DownloadConcurrencySetting, "1")
+	defer os.Unsetenv(internal.DownloadConcurrencySetting)
+
+	readerMaker := &testtools.FileReaderMaker{Key: "testdata/booba.tar"}
+	err := internal.ExtractAllWithSleeper(&testtools.NOPTarInterpreter{}, []internal.ReaderMaker{readerMaker}, NOPSleeper{})
+
+	var extractionErrors internal.ExtractionErrors
+	assert.True(t, errors.As(err, &extractionErrors))
+	assert.Len(t, extractionErrors.Failures, 1)
+	assert.Equal(t, "testdata/booba.tar", extractionErrors.Failures[0].Path)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	assert.Equal(t, "failed to extract files:\ntestdata/booba.tar\n: "+extractionErrors.Failures[0].Err.Error(), err.Error())
+}
+
+func TestExtractAll_extractionErrorsObjectInfo(t *testing.T) {
+	os.Setenv(internal.DownloadConcurrencySetting, "1")
+	defer os.Unsetenv(internal.DownloadConcurrencySetting)
+
+	lastModified := time.Date(2021, 11, 2, 10, 0, 0, 0, time.UTC)
+	readerMaker := internal.NewStorageReaderMaker(memory.NewFolder("", memory.NewStorage()), "base_000.tar.lz4")
+	readerMaker.Object = storage.NewLocalObject("base_000.tar.lz4", lastModified, 1024)
+	err := internal.ExtractAllWithSleeper(&testtools.NOPTarInterpreter{}, []internal.ReaderMaker{readerMaker}, NOPSleeper{})
+
+	var extractionErrors internal.ExtractionErrors
+	assert.True(t, errors.As(err, &extractionErrors))
+	assert.Equal(t, int64(1024), extractionErrors.Failures[0].Size)
+	assert.Equal(t, lastModified, extractionErrors.Failures[0].LastModified)
+	assert.Contains(t, err.Error(), "base_000.tar.lz4 (1024 bytes, modified 2021-11-02T10:00:00Z)\n")
+
+	unknown := internal.ExtractionFailure{Path: "base_001.tar.lz4", Err: os.ErrNotExist, Size: -1}
+	assert.Contains(t, internal.ExtractionErrors{Failures: []internal.ExtractionFailure{unknown}}.Error(), "\nbase_001.tar.lz4\n")
+}
+
+// throttledReaderMaker fails to open the file the first failures times, like the throttled storage
+type throttledReaderMaker struct {
+	BufferReaderMaker
+	failures int
+}
+
+func (maker *throttledReaderMaker) Reader() (io.ReadCloser, error) {
+	if maker.failures > 0 {
+		maker.failures--
+		return nil, errors.New("SlowDown: please reduce your request rate")
+	}
+	return maker.BufferReaderMaker.Reader()
+}
+
+type countingSleeper struct {
+	sleeps int
+}
+
+func (sleeper *countingSleeper) Sleep() {
+	sleeper.sleeps++
+}
+
+func TestExtractAll_transientErrorsRetried(t *testing.T) {
+	os.Setenv(internal.DownloadConcurrencySetting, "4")
+	defer os.Unsetenv(internal.DownloadConcurrencySetting)
+
+	brm, b := makeTar("booba")
+	buf := &testtools.BufferTarInterpreter{}
+	sleeper := &countingSleeper{}
+	err := internal.ExtractAllWithSleeper(buf, []internal.ReaderMaker{&throttledReaderMaker{brm, 2}}, sleeper)
+
+	assert.NoError(t, err)
+	assert.Equal(t, b, buf.Out)
+	assert.Equal(t, 2, sleeper.sleeps)
+}
+
+// durationSleeper counts how many times the pause was asked for before the sleeps
+type durationSleeper struct {
+	countingSleeper
+	durationQueries int
+}
+
+func (sleeper *durationSleeper) NextSleepDuration() time.Duration {
+	sleeper.durationQueries++
+	return time.Second
+}
+
+func TestExtractAll_retryDelayReported(t *testing.T) {
+	os.Setenv(internal.DownloadConcurrencySetting, "4")
+	defer os.Unsetenv(internal.DownloadConcurrencySetting)
+
+	brm, _ := makeTar("booba")
+	sleeper := &durationSleeper{}
+	err := internal.ExtractAllWithSleeper(&testtools.BufferTarInterpreter{},
+		[]internal.ReaderMaker{&throttledReaderMaker{brm, 2}}, sleeper)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, sleeper.sleeps)
+	assert.Equal(t, sleeper.sleeps, sleeper.durationQueries)
+}
+
+func TestExtractAll_permanentErrorsNotRetried(t *testing.T) {
+	os.Setenv(internal.DownloadConcurrencySetting, "4")
+	defer os.Unsetenv(internal.DownloadConcurrencySetting)
+
+	compressed := &bytes.Buffer{}
+	_, _ = compressed.ReadFrom(internal.CompressAndEncrypt(bytes.NewReader(generateRandomBytes()), gzip.Compressor{}, nil))
+	compressed.Truncate(compressed.Len() / 2)
+	corrupt := &BufferReaderMaker{compressed, "/usr/local/corrupt.tar.gz"}
+	brm, _ := makeTar("booba")
+
+	sleeper := &countingSleeper{}
+	err := internal.ExtractAllWithSleeper(testtools.NewConcurrentConcatBufferTarInterpreter(),
+		[]internal.ReaderMaker{corrupt, &brm}, sleeper)
+
+	var extractionErrors internal.ExtractionErrors
+	assert.True(t, errors.As(err, &extractionErrors))
+	assert.Len(t, extractionErrors.Failures, 1)
+	var decompressionErr computils.DecompressionError
+	assert.True(t, errors.As(err, &decompressionErr))
+	assert.Zero(t, sleeper.sleeps)
+}
+
+func TestExtractAllWithOptions_retries(t *testing.T) {
+	brm, _ := makeTar("booba")
+	sleeper := &countingSleeper{}
+	err := internal.ExtractAllWithOptions(&testtools.BufferTarInterpreter{}, []internal.ReaderMaker{&throttledReaderMaker{brm, 2}},
+		internal.ExtractSleeper(sleeper), internal.ExtractConcurrency(4), internal.ExtractRetries(1))
+
+	var extractionErrors internal.ExtractionErrors
+	assert.True(t, errors.As(err, &extractionErrors))
+	assert.Equal(t, 1, sleeper.sleeps)
+}
+
+func TestExtractAllWithOptions_predicateAndProgress(t *testing.T) {
+	booba, b := makeTar("booba")
+	skipped := &testtools.FileReaderMaker{Key: "testdata/booba.tar"}
+	buf := &testtools.BufferTarInterpreter{}
+	var extracted []string
+	err := internal.ExtractAllWithOptions(buf, []internal.ReaderMaker{skipped, &booba},
+		internal.ExtractSleeper(NOPSleeper{}),
+		internal.ExtractConcurrency(1),
+		internal.ExtractPredicate(func(file internal.ReaderMaker) bool { return file != skipped }),
+		internal.ExtractProgress(func(file internal.ReaderMaker, err error) {
+			assert.NoError(t, err)
+			extracted = append(extracted, file.Path())
+		}))
+
+	assert.NoError(t, err)
+	assert.Equal(t, b, buf.Out)
+	assert.Equal(t, []string{booba.Path()}, extracted)
+}
+
+func TestExtractAll_truncatedTarEntry(t *testing.T) {
+	tarContents := &bytes.Buffer{}
+	tarWriter := tar.NewWriter(tarContents)
+	require.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: "base/1/1259", Typeflag: tar.TypeReg, Mode: 0600, Size: 100}))
+	_, err := tarWriter.Write([]byte("ten bytes!"))
+	require.NoError(t, err)
+	// the entry ends after 10 of the declared 100 bytes, without the padding and the end of the archive
+
+	err = internal.ExtractAllWithOptions(&testtools.NOPTarInterpreter{},
+		[]internal.ReaderMaker{&BufferReaderMaker{tarContents, "/usr/local/truncated.tar"}},
+		internal.ExtractSleeper(NOPSleeper{}), internal.ExtractConcurrency(1), internal.ExtractRetries(0))
+
+	var sizeMismatchError internal.TarEntrySizeMismatchError
+	require.True(t, errors.As(err, &sizeMismatchError), err)
+	assert.Contains(t, sizeMismatchError.Error(), "tar entry 'base/1/1259' declares 100 bytes, but provides 10")
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+}
+
+// diskTarInterpreter writes the regular entries to the directory and leaves the partial files of the failed ones
+type diskTarInterpreter struct {
+	directory string
+	removed   []string
+}
+
+func (tarInterpreter *diskTarInterpreter) Interpret(reader io.Reader, header *tar.Header) error {
+	file, err := os.Create(filepath.Join(tarInterpreter.directory, header.Name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(file, reader)
+	return err
+}
+
+func (tarInterpreter *diskTarInterpreter) RemovePartialFile(header *tar.Header) error {
+	tarInterpreter.removed = append(tarInterpreter.removed, header.Name)
+	return os.Remove(filepath.Join(tarInterpreter.directory, header.Name))
+}
+
+func TestExtractAll_partialFileRemoved(t *testing.T) {
+	tarContents := &bytes.Buffer{}
+	tarWriter := tar.NewWriter(tarContents)
+	require.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: "complete", Typeflag: tar.TypeReg, Mode: 0600, Size: 8}))
+	_, err := tarWriter.Write([]byte("complete"))
+	require.NoError(t, err)
+	require.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: "partial", Typeflag: tar.TypeReg, Mode: 0600, Size: 100}))
+	_, err = tarWriter.Write([]byte("ten bytes!"))
+	require.NoError(t, err)
+	// the second entry is cut in the middle, like the download broken while the file is written
+
+	interpreter := &diskTarInterpreter{directory: t.TempDir()}
+	err = internal.ExtractAllWithOptions(interpreter,
+		[]internal.ReaderMaker{&BufferReaderMaker{tarContents, "/usr/local/partial.tar"}},
+		internal.ExtractSleeper(NOPSleeper{}), internal.ExtractConcurrency(1), internal.ExtractRetries(0))
+
+	assert.Error(t, err)
+	assert.Equal(t, []string{"partial"}, interpreter.removed)
+	assert.FileExists(t, filepath.Join(interpreter.directory, "complete"))
+	assert.NoFileExists(t, filepath.Join(interpreter.directory, "partial"))
+}
+
 func generateRandomBytes() []byte {
 	sb := testtools.NewStrideByteReader(seed)
 	lr := &io.LimitedReader{
@@ -142,6 +365,168 @@ func TestExtractAll_multipleConcurrentTars(t *testing.T) {
 	}
 }
 
+// wedgedReader blocks the reads like the stalled download until it's closed
+type wedgedReader struct {
+	closed chan struct{}
+}
+
+func (reader *wedgedReader) Read(p []byte) (int, error) {
+	<-reader.closed
+	return 0, io.ErrClosedPipe
+}
+
+func (reader *wedgedReader) Close() error {
+	close(reader.closed)
+	return nil
+}
+
+// wedgedReaderMaker stalls on the first attempt to read the file and reads it on the retry
+type wedgedReaderMaker struct {
+	BufferReaderMaker
+	content []byte
+	wedged  *wedgedReader
+}
+
+func (maker *wedgedReaderMaker) Reader() (io.ReadCloser, error) {
+	if maker.wedged == nil {
+		maker.wedged = &wedgedReader{closed: make(chan struct{})}
+		return maker.wedged, nil
+	}
+	return io.NopCloser(bytes.NewReader(maker.content)), nil
+}
+
+func TestExtractAll_perFileTimeout(t *testing.T) {
+	viper.Set(internal.PerFileExtractTimeout, "200ms")
+	defer viper.Set(internal.PerFileExtractTimeout, nil)
+
+	fileAmount := 12
+	bufs := [][]byte{}
+	brms := []internal.ReaderMaker{}
+	for i := 0; i < fileAmount; i++ {
+		brm, b := makeTar(strconv.Itoa(i))
+		bufs = append(bufs, b)
+		brms = append(brms, &brm)
+	}
+	slow := &wedgedReaderMaker{BufferReaderMaker: BufferReaderMaker{Key: "/usr/slow.tar"}}
+	slow.content = brms[5].(*BufferReaderMaker).Buf.Bytes()
+	brms[5] = slow
+
+	buf := testtools.NewConcurrentConcatBufferTarInterpreter()
+	var progressMutex sync.Mutex
+	var timeouts []string
+	extracted := 0
+	err := internal.ExtractAllWithOptions(buf, brms,
+		internal.ExtractSleeper(NOPSleeper{}),
+		internal.ExtractConcurrency(4),
+		internal.ExtractProgress(func(file internal.ReaderMaker, err error) {
+			progressMutex.Lock()
+			defer progressMutex.Unlock()
+			var timeoutErr internal.FileExtractTimeoutError
+			if errors.As(err, &timeoutErr) {
+				timeouts = append(timeouts, file.Path())
+			} else if err == nil {
+				extracted++
+			}
+		}))
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{slow.Path()}, timeouts)
+	assert.Equal(t, fileAmount, extracted)
+	for i := 0; i < fileAmount; i++ {
+		assert.Equal(t, bufs[i], buf.Out[strconv.Itoa(i)], "Some of outputs do not match input")
+	}
+	select {
+	case <-slow.wedged.closed:
+	default:
+		t.Error("the stalled download wasn't closed on the timeout")
+	}
+}
+
+func TestGetPerFileExtractTimeout(t *testing.T) {
+	defer viper.Set(internal.PerFileExtractTimeout, nil)
+
+	timeout, err := internal.GetPerFileExtractTimeout()
+	assert.NoError(t, err)
+	assert.Zero(t, timeout)
+
+	viper.Set(internal.PerFileExtractTimeout, "5m")
+	timeout, err = internal.GetPerFileExtractTimeout()
+	assert.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, timeout)
+
+	viper.Set(internal.PerFileExtractTimeout, "-1s")
+	_, err = internal.GetPerFileExtractTimeout()
+	assert.Error(t, err)
+}
+
+type headerRecordingTarInterpreter struct {
+	headers  []*tar.Header
+	contents []string
+}
+
+func (tarInterpreter *headerRecordingTarInterpreter) Interpret(reader io.Reader, header *tar.Header) error {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	tarInterpreter.headers = append(tarInterpreter.headers, header)
+	tarInterpreter.contents = append(tarInterpreter.contents, string(content))
+	return nil
+}
+
+func TestExtractAll_paxHeaders(t *testing.T) {
+	os.Setenv(internal.DownloadConcurrencySetting, "1")
+	defer os.Unsetenv(internal.DownloadConcurrencySetting)
+
+	longName := "base/16384/" + strings.Repeat("long_relation_name_", 10)
+	tarContents := &bytes.Buffer{}
+	tarWriter := tar.NewWriter(tarContents)
+	writeEntry := func(header *tar.Header, content string) {
+		header.Size = int64(len(content))
+		assert.NoError(t, tarWriter.WriteHeader(header))
+		_, err := tarWriter.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	writeEntry(&tar.Header{Typeflag: tar.TypeXGlobalHeader, Format: tar.FormatPAX,
+		PAXRecords: map[string]string{"comment": "archive-wide"}}, "")
+	writeEntry(&tar.Header{Typeflag: tar.TypeReg, Name: longName, Mode: 0600, Format: tar.FormatPAX,
+		PAXRecords: map[string]string{"SCHILY.xattr.user.checksum": "abc"}}, "first")
+	writeEntry(&tar.Header{Typeflag: tar.TypeReg, Name: "PG_VERSION", Mode: 0600, Format: tar.FormatPAX}, "second")
+	assert.NoError(t, tarWriter.Close())
+
+	interpreter := &headerRecordingTarInterpreter{}
+	brm := &BufferReaderMaker{tarContents, "/usr/local.tar"}
+	err := internal.ExtractAllWithSleeper(interpreter, []internal.ReaderMaker{brm}, NOPSleeper{})
+	assert.NoError(t, err)
+
+	// the global header is skipped and the extended ones are applied to the entries they precede only
+	assert.Len(t, interpreter.headers, 2)
+	assert.Equal(t, longName, interpreter.headers[0].Name)
+	assert.Equal(t, "abc", interpreter.headers[0].PAXRecords["SCHILY.xattr.user.checksum"])
+	assert.Equal(t, "first", interpreter.contents[0])
+	assert.Equal(t, "PG_VERSION", interpreter.headers[1].Name)
+	assert.Empty(t, interpreter.headers[1].PAXRecords)
+	assert.Equal(t, "second", interpreter.contents[1])
+}
+
+func TestExtractAll_unknownAsRaw(t *testing.T) {
+	os.Setenv(internal.DownloadConcurrencySetting, "1")
+	defer os.Unsetenv(internal.DownloadConcurrencySetting)
+	makeFiles := func() []internal.ReaderMaker {
+		return []internal.ReaderMaker{&BufferReaderMaker{bytes.NewBufferString("version 1"), "meta/VERSION.marker"}}
+	}
+
+	err := internal.ExtractAllWithSleeper(testtools.NewConcurrentConcatBufferTarInterpreter(), makeFiles(), NOPSleeper{})
+	var unsupportedFileTypeError internal.UnsupportedFileTypeError
+	assert.True(t, errors.As(err, &unsupportedFileTypeError))
+
+	viper.Set(internal.ExtractUnknownAsRawSetting, true)
+	defer viper.Set(internal.ExtractUnknownAsRawSetting, false)
+	interpreter := testtools.NewConcurrentConcatBufferTarInterpreter()
+	assert.NoError(t, internal.ExtractAllWithSleeper(interpreter, makeFiles(), NOPSleeper{}))
+	assert.Equal(t, map[string][]byte{"meta/VERSION.marker": []byte("version 1")}, interpreter.Out)
+}
+
 func noPassphrase() (string, bool) {
 	return "", false
 }
@@ -195,6 +580,61 @@ func TestDecryptAndDecompressTar_encrypted(t *testing.T) {
 	assert.Equalf(t, bCopy, decompressed, "decompressed tar does not match the input")
 }
 
+func TestDecryptAndDecompressTar_plaintextWithCrypter(t *testing.T) {
+	b := generateRandomBytes()
+	bCopy := make([]byte, len(b))
+	copy(bCopy, b)
+
+	crypter := openpgp.CrypterFromKeyPath(PrivateKeyFilePath, noPassphrase)
+	compressed := &bytes.Buffer{}
+	_, _ = compressed.ReadFrom(internal.CompressAndEncrypt(bytes.NewReader(b), GetLz4Compressor(), nil))
+	compressedCopy := bytes.NewBuffer(compressed.Bytes())
+
+	// the file uploaded before the encryption was enabled
+	reader, err := internal.DecryptAndDecompressTar(compressed, "/usr/local/test.tar.lz4", crypter)
+	require.NoError(t, err)
+	decompressed, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, bCopy, decompressed)
+
+	viper.Set(internal.StrictEncryptionSetting, true)
+	defer viper.Set(internal.StrictEncryptionSetting, false)
+	_, err = internal.DecryptAndDecompressTar(compressedCopy, "/usr/local/test.tar.lz4", crypter)
+	assert.ErrorIs(t, err, crypto.ErrNotEncrypted)
+}
+
+// headerlessCrypter is the crypter whose output has no recognizable header, like libsodium or KMS crypters
+type headerlessCrypter struct {
+	decrypted int
+}
+
+func (crypter *headerlessCrypter) Name() string {
+	return "headerless"
+}
+
+func (crypter *headerlessCrypter) Encrypt(writer io.Writer) (io.WriteCloser, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (crypter *headerlessCrypter) Decrypt(reader io.Reader) (io.Reader, error) {
+	crypter.decrypted++
+	return reader, nil
+}
+
+func TestDecryptAndDecompressTar_headerlessCrypterAlwaysDecrypts(t *testing.T) {
+	b := generateRandomBytes()
+	compressed := &bytes.Buffer{}
+	_, _ = compressed.ReadFrom(internal.CompressAndEncrypt(bytes.NewReader(b), GetLz4Compressor(), nil))
+
+	// the ciphertext may start like the compressed data, so it is never taken for plaintext
+	crypter := &headerlessCrypter{}
+	reader, err := internal.DecryptAndDecompressTar(compressed, "/usr/local/test.tar.lz4", crypter)
+	require.NoError(t, err)
+	_, err = io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, 1, crypter.decrypted)
+}
+
 func TestDecryptAndDecompressTar_noCrypter(t *testing.T) {
 	b := generateRandomBytes()
 
@@ -207,17 +647,12 @@ func TestDecryptAndDecompressTar_noCrypter(t *testing.T) {
 	compressor := GetLz4Compressor()
 	compressed := internal.CompressAndEncrypt(bytes.NewReader(b), compressor, crypter)
 
-	reader, err := internal.DecryptAndDecompressTar(compressed, "/usr/local/test.tar.lz4", nil)
+	_, err := internal.DecryptAndDecompressTar(compressed, "/usr/local/test.tar.lz4", nil)
 	if err != nil {
 		t.Logf("%+v\n", err)
 	}
 
-	_, readErr := io.ReadAll(reader)
-	if readErr != nil {
-		t.Logf("%+v\n", readErr)
-	}
-
-	assert.Error(t, readErr)
+	assert.IsType(t, internal.PossiblyEncryptedError{}, err)
 }
 
 func TestDecryptAndDecompressTar_wrongCrypter(t *testing.T) {
@@ -256,6 +691,57 @@ func TestDecryptAndDecompressTar_unknownFormat(t *testing.T) {
 	assert.IsType(t, internal.UnsupportedFileTypeError{}, err)
 }
 
+func TestDecryptAndDecompressTar_detectedByMagic(t *testing.T) {
+	b := generateRandomBytes()
+	bCopy := make([]byte, len(b))
+	copy(bCopy, b)
+
+	compressed := internal.CompressAndEncrypt(bytes.NewReader(b), gzip.Compressor{}, nil)
+
+	reader, err := internal.DecryptAndDecompressTar(compressed, "/usr/local/test.unknown", nil)
+	assert.NoError(t, err)
+
+	decompressed, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equalf(t, bCopy, decompressed, "decompressed tar does not match the input")
+}
+
+func TestDecryptAndDecompressTar_truncated(t *testing.T) {
+	b := generateRandomBytes()
+	compressed := &bytes.Buffer{}
+	_, _ = compressed.ReadFrom(internal.CompressAndEncrypt(bytes.NewReader(b), gzip.Compressor{}, nil))
+	truncatedSize := compressed.Len() / 2
+	compressed.Truncate(truncatedSize)
+
+	reader, err := internal.DecryptAndDecompressTar(compressed, "/usr/local/test.tar.gz", nil)
+	assert.NoError(t, err)
+
+	_, err = io.ReadAll(reader)
+	var decompressionErr computils.DecompressionError
+	assert.True(t, errors.As(err, &decompressionErr))
+	assert.Contains(t, err.Error(), fmt.Sprintf("after %d bytes", truncatedSize))
+	assert.Contains(t, internal.ExplainExtractionError(err).Error(), "corrupt or truncated")
+}
+
+func TestExplainExtractionError_windowTooLarge(t *testing.T) {
+	err := fmt.Errorf("failed to decompress: %w", computils.NewWindowTooLargeError("zstd", 30, 27))
+	assert.Contains(t, internal.ExplainExtractionError(err).Error(),
+		internal.ZstdMaxWindowLogSetting+" to at least 30")
+}
+
+func TestExplainExtractionError_crypterErrors(t *testing.T) {
+	hints := map[error]string{
+		crypto.ErrWrongKey:          "encrypted with another key",
+		crypto.ErrCorruptCiphertext: "corrupt or truncated",
+		crypto.ErrNotEncrypted:      "unset the crypter settings",
+		crypto.ErrKeyUnavailable:    "the PIN is right",
+	}
+	for cause, hint := range hints {
+		err := fmt.Errorf("DecryptAndDecompressTar: decrypt failed: %w", cause)
+		assert.Contains(t, internal.ExplainExtractionError(err).Error(), hint)
+	}
+}
+
 func TestDecryptAndDecompressTar_uncompressed(t *testing.T) {
 	b := generateRandomBytes()
 	bCopy := make([]byte, len(b))
@@ -279,6 +765,39 @@ func TestDecryptAndDecompressTar_uncompressed(t *testing.T) {
 	assert.Equalf(t, bCopy, decompressed, "decompressed tar does not match the input")
 }
 
+func TestDecryptAndDecompressEncodedTar_noExtension(t *testing.T) {
+	b := generateRandomBytes()
+	encoded := internal.CompressAndEncrypt(bytes.NewReader(b), gzip.Compressor{}, nil)
+
+	reader, err := internal.DecryptAndDecompressEncodedTar(encoded, "/usr/local/part_001", "gzip", nil)
+	assert.NoError(t, err)
+
+	decompressed, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.NoError(t, reader.Close())
+	assert.Equalf(t, b, decompressed, "decompressed tar does not match the input")
+}
+
+func TestDecryptAndDecompressEncodedTar_doubleCompression(t *testing.T) {
+	b := generateRandomBytes()
+	compressed := internal.CompressAndEncrypt(bytes.NewReader(b), lz4.Compressor{}, nil)
+	encoded := internal.CompressAndEncrypt(compressed, gzip.Compressor{}, nil)
+
+	reader, err := internal.DecryptAndDecompressEncodedTar(encoded, "/usr/local/test.tar.lz4", "identity, gzip", nil)
+	assert.NoError(t, err)
+
+	decompressed, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equalf(t, b, decompressed, "decompressed tar does not match the input")
+}
+
+func TestDecryptAndDecompressEncodedTar_unsupportedEncoding(t *testing.T) {
+	_, err := internal.DecryptAndDecompressEncodedTar(bytes.NewReader(generateRandomBytes()),
+		"/usr/local/test.tar", "compress", nil)
+	assert.IsType(t, internal.UnsupportedFileTypeError{}, err)
+	assert.Contains(t, err.Error(), "Content-Encoding: compress")
+}
+
 // Used to mock files in memory.
 type BufferReaderMaker struct {
 	Buf *bytes.Buffer
@@ -293,3 +812,91 @@ func (b *BufferReaderMaker) Mode() int                      { return 0 }
 type NOPSleeper struct{}
 
 func (s NOPSleeper) Sleep() {}
+
+func TestDecryptAndDecompressTarMember(t *testing.T) {
+	var archive bytes.Buffer
+	tarWriter := tar.NewWriter(&archive)
+	var members []internal.TarMemberRange
+	for i, content := range []string{"first", "second member", "third"} {
+		require.NoError(t, tarWriter.Flush())
+		if i > 0 {
+			members[i-1].Length = int64(archive.Len()) - members[i-1].Offset
+		}
+		members = append(members, internal.TarMemberRange{Offset: int64(archive.Len())})
+		require.NoError(t, tarWriter.WriteHeader(&tar.Header{
+			Name: fmt.Sprintf("file_%d", i), Typeflag: tar.TypeReg, Mode: 0600, Size: int64(len(content))}))
+		_, err := tarWriter.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	members[2].Length = int64(archive.Len()) - members[2].Offset
+
+	compressed := &bytes.Buffer{}
+	_, err := compressed.ReadFrom(internal.CompressAndEncrypt(bytes.NewReader(archive.Bytes()), GetLz4Compressor(), nil))
+	require.NoError(t, err)
+
+	readMember := func(reader io.Reader, filePath string) string {
+		member, err := internal.DecryptAndDecompressTarMember(reader, filePath, nil, members[1])
+		require.NoError(t, err)
+		defer member.Close()
+		tarReader := tar.NewReader(member)
+		header, err := tarReader.Next()
+		require.NoError(t, err)
+		assert.Equal(t, "file_1", header.Name)
+		content, err := io.ReadAll(tarReader)
+		require.NoError(t, err)
+		_, err = tarReader.Next()
+		assert.Equal(t, io.EOF, err)
+		return string(content)
+	}
+	// seeks the plain tar, scans the compressed one
+	assert.Equal(t, "second member", readMember(bytes.NewReader(archive.Bytes()), "/usr/local/part_1.tar"))
+	assert.Equal(t, "second member", readMember(compressed, "/usr/local/part_1.tar.lz4"))
+
+	_, err = internal.DecryptAndDecompressTarMember(bytes.NewBuffer(archive.Bytes()), "/usr/local/part_1.tar", nil,
+		internal.TarMemberRange{Offset: int64(archive.Len()) + 1, Length: 512})
+	assert.Error(t, err)
+}
+
+func TestExtractAll_checkStorageTier(t *testing.T) {
+	viper.Set(internal.CheckStorageTierSetting, true)
+	defer viper.Set(internal.CheckStorageTierSetting, false)
+
+	folder := testtools.NewMockArchiveTierFolder(memory.NewFolder("in_memory/", memory.NewStorage()))
+	var files []internal.ReaderMaker
+	for _, name := range []string{"part_3.tar", "part_1.tar", "part_2.tar"} {
+		brm, _ := makeTar(name)
+		require.NoError(t, folder.PutObject(name, brm.Buf))
+		files = append(files, internal.NewStorageReaderMaker(folder, name))
+	}
+	folder.Archive("part_3.tar")
+	folder.Archive("part_1.tar")
+
+	sleeper := &countingSleeper{}
+	err := internal.ExtractAllWithSleeper(testtools.NewConcurrentConcatBufferTarInterpreter(), files, sleeper)
+
+	var archivedErr internal.ArchivedFilesError
+	require.True(t, errors.As(err, &archivedErr))
+	assert.Equal(t, []string{"part_1.tar", "part_3.tar"}, archivedErr.Paths)
+	assert.Zero(t, sleeper.sleeps)
+
+	require.NoError(t, storage.RehydrateObject(folder, "part_1.tar", storage.RehydrateOptions{}))
+	require.NoError(t, storage.RehydrateObject(folder, "part_3.tar", storage.RehydrateOptions{}))
+	folder.FinishRehydration()
+	assert.NoError(t, internal.ExtractAllWithSleeper(testtools.NewConcurrentConcatBufferTarInterpreter(), files, sleeper))
+}
+
+func TestExtractAll_archivedNotRetried(t *testing.T) {
+	folder := testtools.NewMockArchiveTierFolder(memory.NewFolder("in_memory/", memory.NewStorage()))
+	brm, _ := makeTar("archived")
+	require.NoError(t, folder.PutObject("archived.tar", brm.Buf))
+	folder.Archive("archived.tar")
+
+	sleeper := &countingSleeper{}
+	err := internal.ExtractAllWithSleeper(testtools.NewConcurrentConcatBufferTarInterpreter(),
+		[]internal.ReaderMaker{internal.NewStorageReaderMaker(folder, "archived.tar")}, sleeper)
+
+	var archivedErr storage.ObjectArchivedError
+	assert.True(t, errors.As(err, &archivedErr))
+	assert.Zero(t, sleeper.sleeps)
+}
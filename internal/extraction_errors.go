@@ -0,0 +1,242 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/compression/computils"
+	"github.com/wal-g/wal-g/internal/crypto"
+	"github.com/wal-g/wal-g/internal/signing"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+// PossiblyEncryptedError is used to signal that the file looks like encrypted data,
+// but there is no crypter configured to decrypt it.
+type PossiblyEncryptedError struct {
+	error
+}
+
+func newPossiblyEncryptedError(path string, format string) PossiblyEncryptedError {
+	return PossiblyEncryptedError{errors.Errorf("'%s' looks like %s encrypted data, but no crypter is configured",
+		path, format)}
+}
+
+func (err PossiblyEncryptedError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// ChecksumMismatchError is used to signal that the downloaded object differs from the stored one
+type ChecksumMismatchError struct {
+	error
+}
+
+func newChecksumMismatchError(path string, expected []byte, actual []byte) ChecksumMismatchError {
+	return ChecksumMismatchError{errors.Errorf("MD5 of the downloaded '%s' is %x, but the storage reports %x",
+		path, actual, expected)}
+}
+
+func (err ChecksumMismatchError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// TarEntrySizeMismatchError is returned when the tar member provides fewer bytes than its header declares,
+// the read error which cut it short is unwrapped, if any
+type TarEntrySizeMismatchError struct {
+	error
+	cause error
+}
+
+func newTarEntrySizeMismatchError(name string, declared int64, provided int64, cause error) TarEntrySizeMismatchError {
+	message := errors.Errorf("tar entry '%s' declares %d bytes, but provides %d", name, declared, provided)
+	if cause != nil {
+		message = errors.Wrapf(cause, "tar entry '%s' declares %d bytes, but provides %d", name, declared, provided)
+	}
+	return TarEntrySizeMismatchError{message, cause}
+}
+
+func (err TarEntrySizeMismatchError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+func (err TarEntrySizeMismatchError) Unwrap() error {
+	return err.cause
+}
+
+// ExtractionFailure is the error of one file which failed to extract
+type ExtractionFailure struct {
+	Path string
+	Err  error
+	// Size of the stored object is negative if the storage listing didn't report it
+	Size int64
+	// LastModified of the stored object is zero if the storage listing didn't report it
+	LastModified time.Time
+}
+
+func newExtractionFailure(file ReaderMaker, err error) ExtractionFailure {
+	failure := ExtractionFailure{Path: file.Path(), Err: err, Size: -1}
+	if size, ok := sizeOf(file); ok {
+		failure.Size = size
+	}
+	failure.LastModified, _ = lastModifiedOf(file)
+	return failure
+}
+
+// ExtractionErrors is returned when the files couldn't be extracted after all the retries,
+// it holds the failure of every file of the last attempt
+type ExtractionErrors struct {
+	Failures []ExtractionFailure
+}
+
+func (errs ExtractionErrors) Error() string {
+	paths := make([]string, 0, len(errs.Failures))
+	for _, failure := range errs.Failures {
+		paths = append(paths, failure.Path+
+			formatObjectInfo(failure.Size, failure.Size >= 0, failure.LastModified, !failure.LastModified.IsZero()))
+	}
+	message := fmt.Sprintf("failed to extract files:\n%s\n", strings.Join(paths, "\n"))
+	if cause := errs.Unwrap(); cause != nil {
+		message += ": " + cause.Error()
+	}
+	return message
+}
+
+// Unwrap returns the error of the last failed file, so errors.As finds the failure reason
+// like it does for the single file errors
+func (errs ExtractionErrors) Unwrap() error {
+	if len(errs.Failures) == 0 {
+		return nil
+	}
+	return errs.Failures[len(errs.Failures)-1].Err
+}
+
+// hasPermanentFailure tells if any of the files failed for the reason which the retries don't fix
+func (errs ExtractionErrors) hasPermanentFailure() bool {
+	for _, failure := range errs.Failures {
+		if isPermanentExtractionError(failure.Err) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPermanentExtractionError tells the failures of the stored data itself, like the corrupt, missing or archived file,
+// from the transient ones, like the storage throttling or the network errors, which are worth retrying
+// with the lower concurrency. The unknown errors are considered transient.
+func isPermanentExtractionError(err error) bool {
+	var decompressionError computils.DecompressionError
+	var windowTooLargeError computils.WindowTooLargeError
+	var possiblyEncryptedError PossiblyEncryptedError
+	var unsupportedFileTypeError UnsupportedFileTypeError
+	var objectNotFoundError storage.ObjectNotFoundError
+	var objectArchivedError storage.ObjectArchivedError
+	return errors.As(err, &decompressionError) ||
+		errors.As(err, &windowTooLargeError) ||
+		errors.As(err, &possiblyEncryptedError) ||
+		errors.As(err, &unsupportedFileTypeError) ||
+		errors.Is(err, crypto.ErrWrongKey) ||
+		errors.Is(err, crypto.ErrCorruptCiphertext) ||
+		errors.Is(err, crypto.ErrNotEncrypted) ||
+		errors.Is(err, crypto.ErrKeyUnavailable) ||
+		errors.Is(err, signing.ErrSignatureMismatch) ||
+		errors.As(err, &objectNotFoundError) ||
+		errors.As(err, &objectArchivedError)
+}
+
+// ExplainExtractionError adds a hint on how to fix the extraction failure, if the failure reason is known
+func ExplainExtractionError(err error) error {
+	var possiblyEncryptedError PossiblyEncryptedError
+	if errors.As(err, &possiblyEncryptedError) {
+		return errors.Wrap(err, "backup seems to be encrypted, configure the crypter it was made with "+
+			"(e.g. WALG_PGP_KEY_PATH or WALG_LIBSODIUM_KEY)")
+	}
+	if errors.Is(err, crypto.ErrWrongKey) {
+		return errors.Wrap(err, "backup is encrypted with another key, configure the key it was made with "+
+			"(e.g. WALG_PGP_KEY_PATH, or the former keys in WALG_PGP_DECRYPTION_KEY_PATHS)")
+	}
+	if errors.Is(err, signing.ErrSignatureMismatch) {
+		return errors.Wrap(err, "backup file doesn't match its signature, it may be tampered with, "+
+			"or signed with another key than "+VerifyEd25519KeySetting+" or "+VerifyPgpKeyPathSetting)
+	}
+	if errors.Is(err, crypto.ErrCorruptCiphertext) {
+		return errors.Wrap(err, "encrypted backup file seems to be corrupt or truncated, "+
+			"check that the object in the storage is complete")
+	}
+	if errors.Is(err, crypto.ErrKeyUnavailable) {
+		return errors.Wrap(err, "the smartcard holding the key can't decrypt, check that it is inserted "+
+			"and the PIN is right, then restart the restore")
+	}
+	if errors.Is(err, crypto.ErrNotEncrypted) {
+		return errors.Wrap(err, "backup file is not encrypted, the backup seems to be made without encryption, "+
+			"unset the crypter settings to fetch it")
+	}
+	var windowTooLargeError computils.WindowTooLargeError
+	if errors.As(err, &windowTooLargeError) {
+		return errors.Wrapf(err, "set %s to at least %d to decompress it",
+			ZstdMaxWindowLogSetting, windowTooLargeError.RequiredWindowLog)
+	}
+	var decompressionError computils.DecompressionError
+	if errors.As(err, &decompressionError) {
+		return errors.Wrap(err, "backup file seems to be corrupt or truncated, "+
+			"check that the object in the storage is complete")
+	}
+	return err
+}
+
+// checkNotEncrypted fails with PossiblyEncryptedError if the stream starts like encrypted data.
+// The returned reader still contains the peeked header and must be used instead of reader.
+func checkNotEncrypted(reader io.Reader, filePath string) (io.Reader, error) {
+	bufReader := bufio.NewReader(reader)
+	header, err := bufReader.Peek(crypto.EncryptionHeaderLength)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "DecryptAndDecompressTar: failed to read file header")
+	}
+	if format := crypto.DetectEncryption(header); format != "" {
+		return nil, newPossiblyEncryptedError(filePath, format)
+	}
+	return bufReader, nil
+}
+
+// compressedSourceReader remembers how many bytes the decompressor consumed
+// and whether the source itself failed, to tell the decoder failures from the download ones
+type compressedSourceReader struct {
+	underlying io.Reader
+	consumed   int64
+	err        error
+}
+
+func (source *compressedSourceReader) Read(p []byte) (n int, err error) {
+	n, err = source.underlying.Read(p)
+	source.consumed += int64(n)
+	if err != nil && err != io.EOF {
+		source.err = err
+	}
+	return
+}
+
+// decodeError converts the decoder failure into computils.DecompressionError with the consumed bytes count
+func (source *compressedSourceReader) decodeError(err error, format string) error {
+	if err == nil || err == io.EOF || source.err != nil {
+		return err
+	}
+	var decompressionError computils.DecompressionError
+	if errors.As(err, &decompressionError) {
+		err = errors.Cause(decompressionError.Unwrap())
+	}
+	return computils.NewDecompressionErrorAt(err, format, source.consumed)
+}
+
+type decompressedReader struct {
+	io.ReadCloser
+	source *compressedSourceReader
+	format string
+}
+
+func (reader *decompressedReader) Read(p []byte) (n int, err error) {
+	n, err = reader.ReadCloser.Read(p)
+	return n, reader.source.decodeError(err, reader.format)
+}
@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+)
+
+type extractionPhase int
+
+const (
+	downloadPhase extractionPhase = iota
+	decryptPhase
+	decompressPhase
+	writePhase
+	extractionPhasesCount
+)
+
+var extractionPhaseNames = [extractionPhasesCount]string{"download", "decrypt", "decompress", "disk write"}
+
+type extractionPhaseTimes [extractionPhasesCount]time.Duration
+
+// extractionByteCounts are the sizes of the compressed data consumed by the decompressor
+// and of the uncompressed data it produced
+type extractionByteCounts struct {
+	compressed   int64
+	decompressed int64
+}
+
+func (counts extractionByteCounts) String() string {
+	return fmt.Sprintf("%d compressed bytes, %d decompressed bytes", counts.compressed, counts.decompressed)
+}
+
+func (times extractionPhaseTimes) String() string {
+	phases := make([]string, 0, extractionPhasesCount)
+	for phase, elapsed := range times {
+		phases = append(phases, fmt.Sprintf("%s %v", extractionPhaseNames[phase], elapsed))
+	}
+	return strings.Join(phases, ", ")
+}
+
+// fileExtractionTrace measures the phases of a single file extraction.
+// The phases are the readers stacked on top of each other, so the time of every phase
+// is accumulated together with the time of the phases below it and separated in the end.
+// The bytes read from every phase reader are counted too.
+type fileExtractionTrace struct {
+	start   time.Time
+	elapsed extractionPhaseTimes
+	read    [extractionPhasesCount]int64
+}
+
+// timeReader accounts the time spent in reader.Read to the phase
+func (trace *fileExtractionTrace) timeReader(phase extractionPhase, reader io.Reader) io.Reader {
+	if trace == nil {
+		return reader
+	}
+	return newTimedReader(reader, &trace.elapsed[phase], &trace.read[phase])
+}
+
+func (trace *fileExtractionTrace) timeReadCloser(phase extractionPhase, readCloser io.ReadCloser) io.ReadCloser {
+	if trace == nil {
+		return readCloser
+	}
+	return &timedReadCloser{newTimedReader(readCloser, &trace.elapsed[phase], &trace.read[phase]), readCloser}
+}
+
+// addSetupTime accounts the time since start to the phase, when it is spent outside the phase reader,
+// e.g. in opening the object or reading the header of the encrypted stream
+func (trace *fileExtractionTrace) addSetupTime(phase extractionPhase, start time.Time) {
+	if trace == nil {
+		return
+	}
+	elapsed := time.Since(start)
+	for ; phase < writePhase; phase++ {
+		trace.elapsed[phase] += elapsed
+	}
+}
+
+func (trace *fileExtractionTrace) phaseTimes() extractionPhaseTimes {
+	elapsed := trace.elapsed
+	elapsed[writePhase] = time.Since(trace.start)
+
+	var times extractionPhaseTimes
+	times[downloadPhase] = elapsed[downloadPhase]
+	for phase := decryptPhase; phase < extractionPhasesCount; phase++ {
+		times[phase] = elapsed[phase] - elapsed[phase-1]
+	}
+	return times
+}
+
+// byteCounts returns the sizes of the decompressor input, which is the output of the decrypt phase,
+// and of its output
+func (trace *fileExtractionTrace) byteCounts() extractionByteCounts {
+	return extractionByteCounts{compressed: trace.read[decryptPhase], decompressed: trace.read[decompressPhase]}
+}
+
+// extractionPhaseTimer traces the extraction phases of every file and sums them up for the whole run.
+// It works in DEVEL log level only, otherwise newFileTrace returns nil and nothing is measured.
+type extractionPhaseTimer struct {
+	enabled     bool
+	mutex       sync.Mutex
+	total       extractionPhaseTimes
+	totalCounts extractionByteCounts
+}
+
+func newExtractionPhaseTimer() *extractionPhaseTimer {
+	return &extractionPhaseTimer{enabled: viper.GetString(LogLevelSetting) == tracelog.DevelLogLevel}
+}
+
+func (timer *extractionPhaseTimer) newFileTrace() *fileExtractionTrace {
+	if !timer.enabled {
+		return nil
+	}
+	return &fileExtractionTrace{start: time.Now()}
+}
+
+func (timer *extractionPhaseTimer) finishFile(filePath string, trace *fileExtractionTrace) {
+	if trace == nil {
+		return
+	}
+	times := trace.phaseTimes()
+	counts := trace.byteCounts()
+	tracelog.DebugLogger.Printf("Extraction phases of %s: %v; %v", filePath, times, counts)
+
+	timer.mutex.Lock()
+	defer timer.mutex.Unlock()
+	for phase, elapsed := range times {
+		timer.total[phase] += elapsed
+	}
+	timer.totalCounts.compressed += counts.compressed
+	timer.totalCounts.decompressed += counts.decompressed
+}
+
+func (timer *extractionPhaseTimer) logTotal() {
+	if !timer.enabled {
+		return
+	}
+	timer.mutex.Lock()
+	defer timer.mutex.Unlock()
+	tracelog.DebugLogger.Printf("Total extraction phases: %v; %v", timer.total, timer.totalCounts)
+}
+
+// timedReader adds the time spent in the Read calls to elapsed and the bytes count to read
+type timedReader struct {
+	io.Reader
+	elapsed *time.Duration
+	read    *int64
+}
+
+func newTimedReader(reader io.Reader, elapsed *time.Duration, read *int64) *timedReader {
+	return &timedReader{reader, elapsed, read}
+}
+
+func (reader *timedReader) Read(p []byte) (n int, err error) {
+	start := time.Now()
+	n, err = reader.Reader.Read(p)
+	*reader.elapsed += time.Since(start)
+	*reader.read += int64(n)
+	return
+}
+
+type timedReadCloser struct {
+	*timedReader
+	io.Closer
+}
+
+func (reader *timedReadCloser) Read(p []byte) (n int, err error) {
+	return reader.timedReader.Read(p)
+}
@@ -12,7 +12,9 @@ import (
 	"github.com/pkg/errors"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/crypto"
 	"github.com/wal-g/wal-g/internal/ioextensions"
+	"github.com/wal-g/wal-g/internal/signing"
 	"github.com/wal-g/wal-g/pkg/storages/storage"
 	"github.com/wal-g/wal-g/utility"
 )
@@ -48,14 +50,21 @@ func DownloadFile(folder storage.Folder, filename, ext string, writeCloser io.Wr
 	}
 	defer utility.LoggedClose(archiveReader, "")
 
-	decompressedReader, err := DecompressDecryptBytes(archiveReader, decompressor)
+	decryptReader, err := DecryptBytes(archiveReader)
 	if err != nil {
 		return err
 	}
-	defer utility.LoggedClose(decompressedReader, "")
-
-	_, err = utility.FastCopy(&utility.EmptyWriteIgnorer{Writer: writeCloser}, decompressedReader)
-	return err
+	var consumed int64
+	written, err := compression.AsDecompressorV2(decompressor).DecompressTo(
+		&utility.EmptyWriteIgnorer{Writer: writeCloser}, NewWithSizeReader(decryptReader, &consumed))
+	if closeErr := crypto.CloseDecrypted(decryptReader); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	tracelog.DebugLogger.Printf("Decompressed %s: %d compressed bytes, %d decompressed bytes", filename, consumed, written)
+	return nil
 }
 
 func TryDownloadFile(folder storage.Folder, path string) (fileReader io.ReadCloser, exists bool, err error) {
@@ -75,15 +84,31 @@ func DecompressDecryptBytes(archiveReader io.Reader, decompressor compression.De
 	if err != nil {
 		return nil, err
 	}
+	decryptCloser, ok := decryptReader.(io.Closer)
 	if decompressor == nil {
 		tracelog.DebugLogger.Printf("No decompressor has been selected")
+		if ok {
+			return ioextensions.ReadCascadeCloser{Reader: decryptReader, Closer: decryptCloser}, nil
+		}
 		return ioutil.NopCloser(decryptReader), nil
 	}
-	return decompressor.Decompress(decryptReader)
+	decompressed, err := compression.Decompress(decompressor, decryptReader, "")
+	if err != nil {
+		_ = crypto.CloseDecrypted(decryptReader)
+		return nil, err
+	}
+	if ok {
+		// e.g. the decryption workers must not outlive the decompressed reader
+		return &layeredReadCloser{decompressed, decryptCloser}, nil
+	}
+	return decompressed, nil
 }
 
 func DecryptBytes(archiveReader io.Reader) (io.Reader, error) {
-	crypter := ConfigureCrypter()
+	crypter, err := ConfigureCrypter()
+	if err != nil {
+		return nil, err
+	}
 	if crypter == nil {
 		tracelog.DebugLogger.Printf("No crypter has been selected")
 		return archiveReader, nil
@@ -169,8 +194,13 @@ func putCachedDecompressorInFirstPlace(decompressors []compression.Decompressor)
 
 // TODO : unit tests
 func DownloadAndDecompressStorageFile(folder storage.Folder, fileName string) (io.ReadCloser, error) {
-	for _, decompressor := range putCachedDecompressorInFirstPlace(compression.Decompressors) {
-		archiveReader, exists, err := TryDownloadFile(folder, fileName+"."+decompressor.FileExtension())
+	verifier, err := configureRequiredSignatureVerifier()
+	if err != nil {
+		return nil, err
+	}
+	for _, decompressor := range putCachedDecompressorInFirstPlace(compression.RegisteredDecompressors()) {
+		objectPath := fileName + "." + decompressor.FileExtension()
+		archiveReader, exists, err := TryDownloadFile(folder, objectPath)
 		if err != nil {
 			return nil, err
 		}
@@ -179,14 +209,29 @@ func DownloadAndDecompressStorageFile(folder storage.Folder, fileName string) (i
 		}
 		_ = SetLastDecompressor(decompressor)
 
-		decompressedReaded, err := DecompressDecryptBytes(archiveReader, decompressor)
+		var compressedReader io.Reader = archiveReader
+		var signatureReader *SignatureVerifyingReader
+		if verifier != nil {
+			signatureReader, err = verifyStorageFileSignature(folder, objectPath, archiveReader, verifier)
+			if err != nil {
+				utility.LoggedClose(archiveReader, "")
+				return nil, err
+			}
+			compressedReader = signatureReader
+		}
+
+		decompressedReaded, err := DecompressDecryptBytes(compressedReader, decompressor)
 		if err != nil {
 			utility.LoggedClose(archiveReader, "")
 			return nil, err
 		}
 
+		var reader io.Reader = decompressedReaded
+		if signatureReader != nil {
+			reader = &verifiedAtEOFReader{decompressedReaded, signatureReader}
+		}
 		return ioextensions.ReadCascadeCloser{
-			Reader: decompressedReaded,
+			Reader: reader,
 			Closer: ioextensions.NewMultiCloser([]io.Closer{archiveReader, decompressedReaded}),
 		}, nil
 	}
@@ -212,6 +257,11 @@ func DownloadFileTo(folder storage.Folder, fileName string, dstPath string) erro
 	defer utility.LoggedClose(reader, "")
 
 	_, err = utility.FastCopy(file, reader)
+	if errors.Is(err, signing.ErrSignatureMismatch) {
+		// the signature is checked at the end of the file, the content written before it can't be trusted
+		_ = os.Remove(dstPath)
+		return err
+	}
 	// In case of error we may have some content within file. Leave it alone.
 	return err
 }
@@ -0,0 +1,38 @@
+package internal_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/compression/lz4"
+)
+
+func TestDecompressDecryptBytes_closesDecryption(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	withCrypterSettings(map[string]string{
+		internal.EncryptCommandSetting: "cat",
+		internal.DecryptCommandSetting: "echo $$ > " + pidFile + "; exec cat /dev/zero",
+	}, func() {
+		for _, decompressor := range []compression.Decompressor{nil, lz4.Decompressor{}} {
+			reader, err := internal.DecompressDecryptBytes(strings.NewReader(""), decompressor)
+			require.NoError(t, err)
+			_, _ = reader.Read(make([]byte, 16))
+			_ = reader.Close()
+
+			pid, err := ioutil.ReadFile(pidFile)
+			require.NoError(t, err)
+			processID, err := strconv.Atoi(strings.TrimSpace(string(pid)))
+			require.NoError(t, err)
+			// the decryption process is killed and reaped by Close
+			assert.Equal(t, syscall.ESRCH, syscall.Kill(processID, 0))
+		}
+	})
+}
@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+)
+
+// FileExtractTimeoutError is returned when the file wasn't downloaded and extracted in WALG_PER_FILE_EXTRACT_TIMEOUT,
+// the file is retried like after the other transient errors
+type FileExtractTimeoutError struct {
+	error
+}
+
+func newFileExtractTimeoutError(path string, timeout time.Duration) FileExtractTimeoutError {
+	return FileExtractTimeoutError{errors.Errorf("extraction of '%s' didn't finish in %v (%s)",
+		path, timeout, PerFileExtractTimeout)}
+}
+
+func (err FileExtractTimeoutError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// extractionWatchdog aborts the readers of the file whose extraction timed out,
+// so the abandoned goroutine stops at its next read rather than writing the file along with the retry.
+// The abort also cancels its context and releases the held resources, e.g. the host extraction slot.
+type extractionWatchdog struct {
+	mutex   sync.Mutex
+	aborted bool
+	readers []*abortableReader
+	held    []*onceCloser
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+func newExtractionWatchdog() *extractionWatchdog {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &extractionWatchdog{ctx: ctx, cancel: cancel}
+}
+
+// context is cancelled by the abort, e.g. to stop waiting for the host extraction slot
+func (watchdog *extractionWatchdog) context() context.Context {
+	return watchdog.ctx
+}
+
+// hold returns the closer which the abort closes, so the extraction stuck before its first read,
+// e.g. in opening the object, doesn't keep the resource. It closes the resource once.
+func (watchdog *extractionWatchdog) hold(closer io.Closer) io.Closer {
+	held := &onceCloser{Closer: closer}
+	watchdog.mutex.Lock()
+	defer watchdog.mutex.Unlock()
+	if watchdog.aborted {
+		_ = held.Close()
+	}
+	watchdog.held = append(watchdog.held, held)
+	return held
+}
+
+// watch returns the reader which fails all the reads after the abort, the abort closes the watched reader
+func (watchdog *extractionWatchdog) watch(readCloser io.ReadCloser) io.ReadCloser {
+	reader := &abortableReader{ReadCloser: readCloser, watchdog: watchdog}
+	watchdog.mutex.Lock()
+	defer watchdog.mutex.Unlock()
+	if watchdog.aborted {
+		_ = reader.Close()
+	}
+	watchdog.readers = append(watchdog.readers, reader)
+	return reader
+}
+
+// abort tells if any reader was watched, the extraction without them hasn't read anything, so it can't write the file
+func (watchdog *extractionWatchdog) abort() bool {
+	watchdog.mutex.Lock()
+	watchdog.aborted = true
+	readers := watchdog.readers
+	held := watchdog.held
+	watchdog.mutex.Unlock()
+	watchdog.cancel()
+	for _, reader := range readers {
+		_ = reader.Close()
+	}
+	for _, closer := range held {
+		_ = closer.Close()
+	}
+	return len(readers) > 0
+}
+
+func (watchdog *extractionWatchdog) isAborted() bool {
+	watchdog.mutex.Lock()
+	defer watchdog.mutex.Unlock()
+	return watchdog.aborted
+}
+
+type abortableReader struct {
+	io.ReadCloser
+	watchdog  *extractionWatchdog
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func (reader *abortableReader) Read(p []byte) (int, error) {
+	if reader.watchdog.isAborted() {
+		return 0, errors.New("the extraction was aborted by the timeout")
+	}
+	return reader.ReadCloser.Read(p)
+}
+
+// Close closes the reader once, both the abort and the extracting goroutine close it
+func (reader *abortableReader) Close() error {
+	reader.closeOnce.Do(func() {
+		reader.closeErr = reader.ReadCloser.Close()
+	})
+	return reader.closeErr
+}
+
+type onceCloser struct {
+	io.Closer
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func (closer *onceCloser) Close() error {
+	closer.closeOnce.Do(func() {
+		closer.closeErr = closer.Closer.Close()
+	})
+	return closer.closeErr
+}
+
+// extractWithTimeout runs the extraction of the file in its own goroutine and returns FileExtractTimeoutError
+// if it doesn't finish in time, aborting its readers. The aborted goroutine which has read the file is waited for,
+// it stops at its next read and removes the partial file, so its cleanup can't remove the output of the retry.
+// The one which hasn't, e.g. waiting for the host slot or for the storage to open the object, isn't waited for:
+// its held slot is released by the abort, and it fails at its first read. Zero timeout runs the extraction as is.
+func extractWithTimeout(file ReaderMaker, timeout time.Duration, extract func(*extractionWatchdog) error) error {
+	watchdog := newExtractionWatchdog()
+	if timeout <= 0 {
+		return extract(watchdog)
+	}
+	result := make(chan error, 1)
+	go func() {
+		result <- extract(watchdog)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-result:
+		return err
+	case <-timer.C:
+		if !watchdog.abort() {
+			tracelog.DebugLogger.Printf("Aborted extraction of '%s' before it started reading", file.Path())
+			return newFileExtractTimeoutError(file.Path(), timeout)
+		}
+		if err := <-result; err != nil {
+			tracelog.DebugLogger.Printf("Aborted extraction of '%s': %v", file.Path(), err)
+		}
+		return newFileExtractTimeoutError(file.Path(), timeout)
+	}
+}
@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestExtractWithTimeout_waitsForAbortedExtraction checks the cleanup of the aborted extraction is done
+// before the timeout is returned, so it can't remove the output of the retry
+func TestExtractWithTimeout_waitsForAbortedExtraction(t *testing.T) {
+	file := newPartReaderMaker(16)
+	reader, writer := io.Pipe()
+	cleanedUp := false
+	err := extractWithTimeout(file, 50*time.Millisecond, func(watchdog *extractionWatchdog) error {
+		watched := watchdog.watch(reader)
+		defer watched.Close()
+		_, err := io.ReadAll(watched)
+		time.Sleep(50 * time.Millisecond)
+		cleanedUp = true
+		return err
+	})
+	require.Error(t, err)
+	var timeoutErr FileExtractTimeoutError
+	assert.True(t, errors.As(err, &timeoutErr))
+	assert.True(t, cleanedUp)
+	assert.NoError(t, writer.Close())
+}
+
+type closeRecorder struct {
+	closed chan struct{}
+}
+
+func (closer *closeRecorder) Close() error {
+	close(closer.closed)
+	return nil
+}
+
+// TestExtractWithTimeout_stuckBeforeReading checks the extraction stuck in opening the object isn't waited for,
+// and its host slot is released
+func TestExtractWithTimeout_stuckBeforeReading(t *testing.T) {
+	file := newPartReaderMaker(16)
+	slot := &closeRecorder{make(chan struct{})}
+	opened := make(chan struct{})
+	defer close(opened)
+	err := extractWithTimeout(file, 50*time.Millisecond, func(watchdog *extractionWatchdog) error {
+		defer watchdog.hold(slot).Close()
+		<-opened
+		return nil
+	})
+	var timeoutErr FileExtractTimeoutError
+	assert.True(t, errors.As(err, &timeoutErr))
+	select {
+	case <-slot.closed:
+	default:
+		t.Error("the slot is not released")
+	}
+}
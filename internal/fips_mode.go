@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/crypto"
+	"github.com/wal-g/wal-g/internal/crypto/openpgp"
+)
+
+type FIPSModeError struct {
+	error
+}
+
+func newFIPSModeError(offendingSettings []string) FIPSModeError {
+	return FIPSModeError{errors.Errorf("%s allows only the FIPS-approved algorithms, these settings use the others:\n%s",
+		FIPSModeSetting, strings.Join(offendingSettings, "\n"))}
+}
+
+func (err FIPSModeError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// fipsUnapprovedSettings are the settings of the crypters and the checks which use the algorithms that aren't FIPS-approved.
+// The KMS crypters are restricted to AES-256-GCM in the FIPS mode, and the PGP keys are checked separately.
+var fipsUnapprovedSettings = []struct {
+	setting    string
+	algorithms string
+}{
+	{LibsodiumKeySetting, "XChaCha20-Poly1305"},
+	{LibsodiumKeyPathSetting, "XChaCha20-Poly1305"},
+	{AgeRecipientsSetting, "X25519, ChaCha20-Poly1305"},
+	{AgeIdentitiesPathSetting, "X25519, ChaCha20-Poly1305"},
+	{AgePassphraseSetting, "scrypt, ChaCha20-Poly1305"},
+	{EncryptCommandSetting, "the algorithms of the external command can't be checked"},
+	{DecryptCommandSetting, "the algorithms of the external command can't be checked"},
+}
+
+// ConfigureFIPSMode restricts the crypters to the FIPS-approved algorithms if WALG_FIPS_MODE is enabled,
+// and fails with the list of all the settings which use the other algorithms
+func ConfigureFIPSMode() error {
+	enabled, err := GetBoolSettingDefault(FIPSModeSetting, false)
+	if err != nil {
+		return err
+	}
+	crypto.SetFIPSMode(enabled)
+	if !enabled {
+		return nil
+	}
+
+	var offendingSettings []string
+	for _, unapproved := range fipsUnapprovedSettings {
+		if _, ok := GetSetting(unapproved.setting); ok {
+			offendingSettings = append(offendingSettings, fmt.Sprintf("%s: %s", unapproved.setting, unapproved.algorithms))
+		}
+	}
+	if viper.GetBool(VerifyDownloadChecksum) {
+		offendingSettings = append(offendingSettings, fmt.Sprintf("%s: MD5", VerifyDownloadChecksum))
+	}
+	for setting, crypter := range configurePgpCrypters() {
+		if err := crypter.CheckApprovedAlgorithms(); err != nil {
+			offendingSettings = append(offendingSettings, fmt.Sprintf("%s: %v", setting, err))
+		}
+	}
+
+	if len(offendingSettings) > 0 {
+		sort.Strings(offendingSettings)
+		return newFIPSModeError(offendingSettings)
+	}
+	tracelog.InfoLogger.Println("FIPS mode: only the FIPS-approved algorithms are used")
+	return nil
+}
+
+// configurePgpCrypters returns the crypters of all the configured PGP keys by their settings
+func configurePgpCrypters() map[string]*openpgp.Crypter {
+	loadPassphrase := func() (string, bool) {
+		return GetSetting(PgpKeyPassphraseSetting)
+	}
+	crypters := make(map[string]*openpgp.Crypter)
+	if key, ok := GetSetting(PgpKeySetting); ok {
+		crypters[PgpKeySetting] = openpgp.CrypterFromKey(key, loadPassphrase).(*openpgp.Crypter)
+	}
+	if keyPath, ok := GetSetting(PgpKeyPathSetting); ok {
+		crypters[PgpKeyPathSetting] = openpgp.CrypterFromKeyPath(keyPath, loadPassphrase).(*openpgp.Crypter)
+	}
+	if keyRingID, ok := getWaleCompatibleSetting(GpgKeyIDSetting); ok {
+		crypters[GpgKeyIDSetting] = openpgp.CrypterFromKeyRingID(keyRingID, loadPassphrase).(*openpgp.Crypter)
+	}
+	if keyPaths, ok := GetSetting(PgpDecryptionKeyPathsSetting); ok {
+		for _, keyPath := range strings.Split(keyPaths, ",") {
+			if keyPath = strings.TrimSpace(keyPath); keyPath != "" {
+				setting := fmt.Sprintf("%s (%s)", PgpDecryptionKeyPathsSetting, keyPath)
+				crypters[setting] = openpgp.CrypterFromKeyPath(keyPath, loadPassphrase).(*openpgp.Crypter)
+			}
+		}
+	}
+	return crypters
+}
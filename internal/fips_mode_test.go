@@ -0,0 +1,119 @@
+package internal_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/crypto"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// writeCast5Key writes the armored public key which prefers CAST5 only
+func writeCast5Key(t *testing.T) string {
+	entity, err := openpgp.NewEntity("cast5", "", "cast5@example.com", nil)
+	require.NoError(t, err)
+	for _, identity := range entity.Identities {
+		identity.SelfSignature.PreferredSymmetric = []uint8{uint8(packet.CipherCAST5)}
+		require.NoError(t, identity.SelfSignature.SignUserId(identity.UserId.Id, entity.PrimaryKey, entity.PrivateKey, nil))
+	}
+	keyPath := filepath.Join(t.TempDir(), "cast5.asc")
+	file, err := os.Create(keyPath)
+	require.NoError(t, err)
+	defer file.Close()
+	writer, err := armor.Encode(file, openpgp.PublicKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.Serialize(writer))
+	require.NoError(t, writer.Close())
+	return keyPath
+}
+
+func withFIPSSettings(t *testing.T, settings map[string]string, check func(err error)) {
+	viper.Set(internal.FIPSModeSetting, "true")
+	for setting, value := range settings {
+		viper.Set(setting, value)
+	}
+	defer func() {
+		viper.Set(internal.FIPSModeSetting, nil)
+		for setting := range settings {
+			viper.Set(setting, nil)
+		}
+		crypto.SetFIPSMode(false)
+	}()
+	check(internal.ConfigureFIPSMode())
+}
+
+func TestConfigureFIPSMode_crypters(t *testing.T) {
+	cast5KeyPath := writeCast5Key(t)
+	for name, testCase := range map[string]struct {
+		settings  map[string]string
+		offending []string
+	}{
+		"AWS KMS":     {settings: map[string]string{internal.CseKmsIDSetting: "alias/walg"}},
+		"AES PGP key": {settings: map[string]string{internal.PgpKeyPathSetting: PrivateKeyFilePath}},
+		"CAST5 PGP key": {
+			settings:  map[string]string{internal.PgpKeyPathSetting: cast5KeyPath},
+			offending: []string{internal.PgpKeyPathSetting},
+		},
+		"libsodium": {
+			settings:  map[string]string{internal.LibsodiumKeySetting: "key"},
+			offending: []string{internal.LibsodiumKeySetting},
+		},
+		"age": {
+			settings:  map[string]string{internal.AgePassphraseSetting: "secret"},
+			offending: []string{internal.AgePassphraseSetting},
+		},
+		"MD5 checksums": {
+			settings:  map[string]string{internal.VerifyDownloadChecksum: "true"},
+			offending: []string{internal.VerifyDownloadChecksum},
+		},
+		"CAST5 rotated key": {
+			settings: map[string]string{
+				internal.PgpKeyPathSetting:            PrivateKeyFilePath,
+				internal.PgpDecryptionKeyPathsSetting: cast5KeyPath,
+				internal.EncryptCommandSetting:        "gpg -e",
+			},
+			offending: []string{internal.EncryptCommandSetting, internal.PgpDecryptionKeyPathsSetting},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			withFIPSSettings(t, testCase.settings, func(err error) {
+				if len(testCase.offending) == 0 {
+					assert.NoError(t, err)
+					assert.True(t, crypto.IsFIPSMode())
+					return
+				}
+				assert.IsType(t, internal.FIPSModeError{}, err)
+				for _, setting := range testCase.offending {
+					assert.Contains(t, err.Error(), setting)
+				}
+			})
+		})
+	}
+}
+
+func TestFIPSMode_compressorsWithApprovedCrypter(t *testing.T) {
+	withFIPSSettings(t, map[string]string{internal.PgpKeyPathSetting: PrivateKeyFilePath}, func(err error) {
+		require.NoError(t, err)
+		crypter, err := internal.ConfigureCrypter()
+		require.NoError(t, err)
+		for _, method := range compression.CompressingAlgorithms {
+			compressor := compression.Compressors[method]
+			encrypted := internal.CompressAndEncrypt(bytes.NewReader(generateRandomBytes()), compressor, crypter)
+			reader, err := internal.DecryptAndDecompressTar(encrypted, "file.tar."+compressor.FileExtension(), crypter)
+			require.NoError(t, err, method)
+			decrypted, err := ioutil.ReadAll(reader)
+			require.NoError(t, err, method)
+			assert.Equal(t, generateRandomBytes(), decrypted, method)
+		}
+	})
+}
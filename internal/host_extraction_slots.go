@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+)
+
+// hostSlotPollDelay is how often the file waiting for the host extraction slot tries the slots again
+const hostSlotPollDelay = 100 * time.Millisecond
+
+// hostExtractionSlots caps the number of files extracted at once by all the processes sharing the lock directory:
+// the file is extracted while its goroutine holds the flock of one of the slot files. The kernel releases the locks
+// of the process which exits, so the killed fetch doesn't keep its slots.
+type hostExtractionSlots struct {
+	lockDir   string
+	count     int
+	pollDelay time.Duration
+}
+
+// configureHostExtractionSlots returns the host-wide slots if WALG_HOST_EXTRACTION_LOCK_DIR is set, otherwise nil
+func configureHostExtractionSlots() (*hostExtractionSlots, error) {
+	lockDir, ok := GetSetting(HostExtractionLockDirSetting)
+	if !ok {
+		return nil, nil
+	}
+	count, err := GetMaxConcurrency(HostExtractionSlotsSetting)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(lockDir, 0755)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create %s", HostExtractionLockDirSetting)
+	}
+	tracelog.DebugLogger.Printf("Extracting at most %d files at once on the host, the slots are locked in %s",
+		count, lockDir)
+	return &hostExtractionSlots{lockDir: lockDir, count: count, pollDelay: hostSlotPollDelay}, nil
+}
+
+// acquire waits for a free slot and locks it, the slots are tried from a random one
+// so the waiting processes don't contend for the first slots. Without the host-wide cap nothing is locked.
+// The wait stops when ctx is done.
+func (slots *hostExtractionSlots) acquire(ctx context.Context) (io.Closer, error) {
+	if slots == nil {
+		return ioutil.NopCloser(nil), nil
+	}
+	start := rand.Intn(slots.count)
+	waitStart := time.Now()
+	for attempt := 0; ; attempt++ {
+		for i := 0; i < slots.count; i++ {
+			lock := flock.New(filepath.Join(slots.lockDir, fmt.Sprintf("slot-%d.lock", (start+i)%slots.count)))
+			locked, err := lock.TryLock()
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to lock the host extraction slot %s", lock.Path())
+			}
+			if locked {
+				if attempt > 0 {
+					tracelog.DebugLogger.Printf("Waited %v for the host extraction slot", time.Since(waitStart))
+				}
+				return lock, nil
+			}
+		}
+		select {
+		case <-time.After(slots.pollDelay):
+		case <-ctx.Done():
+			return nil, errors.Wrap(ctx.Err(), "stopped waiting for the host extraction slot")
+		}
+	}
+}
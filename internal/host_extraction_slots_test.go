@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostExtractionSlots_waitForFreeSlot(t *testing.T) {
+	slots := &hostExtractionSlots{lockDir: t.TempDir(), count: 2, pollDelay: time.Millisecond}
+	first, err := slots.acquire(context.Background())
+	require.NoError(t, err)
+	second, err := slots.acquire(context.Background())
+	require.NoError(t, err)
+
+	acquired := make(chan struct{})
+	go func() {
+		third, err := slots.acquire(context.Background())
+		assert.NoError(t, err)
+		close(acquired)
+		assert.NoError(t, third.Close())
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("the third slot is acquired while both slots are locked")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	require.NoError(t, first.Close())
+	<-acquired
+	require.NoError(t, second.Close())
+}
+
+func TestHostExtractionSlots_sharedByProcesses(t *testing.T) {
+	lockDir := t.TempDir()
+	// every process has its own slots of the same directory
+	processes := []*hostExtractionSlots{
+		{lockDir: lockDir, count: 3, pollDelay: time.Millisecond},
+		{lockDir: lockDir, count: 3, pollDelay: time.Millisecond},
+	}
+	var running, maxRunning int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(slots *hostExtractionSlots) {
+			defer wg.Done()
+			slot, err := slots.acquire(context.Background())
+			if !assert.NoError(t, err) {
+				return
+			}
+			current := atomic.AddInt32(&running, 1)
+			for {
+				observed := atomic.LoadInt32(&maxRunning)
+				if current <= observed || atomic.CompareAndSwapInt32(&maxRunning, observed, current) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			assert.NoError(t, slot.Close())
+		}(processes[i%len(processes)])
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, maxRunning, int32(3))
+}
+
+func TestHostExtractionSlots_disabled(t *testing.T) {
+	var slots *hostExtractionSlots
+	slot, err := slots.acquire(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, slot.Close())
+}
+
+func TestHostExtractionSlots_waitCancelled(t *testing.T) {
+	slots := &hostExtractionSlots{lockDir: t.TempDir(), count: 1, pollDelay: time.Millisecond}
+	slot, err := slots.acquire(context.Background())
+	require.NoError(t, err)
+	defer slot.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = slots.acquire(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -9,6 +9,9 @@ import (
 var DiskLimiter *rate.Limiter
 var NetworkLimiter *rate.Limiter
 
+// StorageLimiter paces the requests to the storage, it is shared by all the folders of the process
+var StorageLimiter *rate.Limiter
+
 // NewNetworkLimitReader returns a reader that is rate limited by network limiter
 func NewNetworkLimitReader(r io.Reader) io.Reader {
 	if NetworkLimiter == nil {
@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/crypto"
+)
+
+// EncryptMetadata returns the reader of the metadata object encrypted by the configured crypter
+// if WALG_ENCRYPT_METADATA is set, otherwise the reader itself
+func EncryptMetadata(reader io.Reader) (io.Reader, error) {
+	if !viper.GetBool(EncryptMetadataSetting) {
+		return reader, nil
+	}
+	crypter, err := ConfigureCrypter()
+	if err != nil {
+		return nil, err
+	}
+	if crypter == nil {
+		tracelog.DebugLogger.Printf("%s is set, but no crypter is configured", EncryptMetadataSetting)
+		return reader, nil
+	}
+
+	pipeReader, pipeWriter := io.Pipe()
+	encryptingWriter, err := crypter.Encrypt(pipeWriter)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encrypt metadata")
+	}
+	go func() {
+		_, err := io.Copy(encryptingWriter, reader)
+		if err == nil {
+			err = encryptingWriter.Close()
+		}
+		_ = pipeWriter.CloseWithError(err)
+	}()
+	return pipeReader, nil
+}
+
+// unmarshalMetadata parses the metadata object, which is decrypted first if it starts with the header
+// of the configured crypter, so the objects uploaded before and after WALG_ENCRYPT_METADATA was set are read alike.
+// The objects of the crypters without the header, e.g. libsodium, can't be told by their first bytes,
+// so such an object is read whole, parsed as is and decrypted if it is not the valid plaintext.
+func unmarshalMetadata(reader io.Reader, unmarshaller DtoSerializer, dto interface{}) error {
+	crypter, err := ConfigureCrypter()
+	if err != nil || crypter == nil {
+		return unmarshaller.Unmarshal(reader, dto)
+	}
+	if len(crypto.EncryptionFormats(crypter)) == 0 {
+		return unmarshalHeaderlessMetadata(reader, crypter, unmarshaller, dto)
+	}
+
+	bufReader := bufio.NewReader(reader)
+	header, err := bufReader.Peek(FormatDetectionHeaderSize)
+	if err != nil && err != io.EOF {
+		return errors.Wrap(err, "failed to read metadata header")
+	}
+	if crypto.DetectEncryption(header) == "" {
+		return unmarshaller.Unmarshal(bufReader, dto)
+	}
+	return unmarshalDecryptedMetadata(bufReader, crypter, unmarshaller, dto)
+}
+
+func unmarshalHeaderlessMetadata(reader io.Reader, crypter crypto.Crypter, unmarshaller DtoSerializer,
+	dto interface{}) error {
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return errors.Wrap(err, "failed to read metadata")
+	}
+	plaintextErr := unmarshaller.Unmarshal(bytes.NewReader(content), dto)
+	if plaintextErr == nil {
+		return nil
+	}
+	err = unmarshalDecryptedMetadata(bytes.NewReader(content), crypter, unmarshaller, dto)
+	return errors.Wrapf(err, "metadata is neither plaintext (%v) nor decrypted", plaintextErr)
+}
+
+func unmarshalDecryptedMetadata(reader io.Reader, crypter crypto.Crypter, unmarshaller DtoSerializer,
+	dto interface{}) error {
+	decryptedReader, err := crypter.Decrypt(reader)
+	if err != nil {
+		return errors.Wrap(err, "failed to decrypt metadata")
+	}
+	defer crypto.CloseDecrypted(decryptedReader)
+	return errors.Wrap(unmarshaller.Unmarshal(decryptedReader, dto), "failed to parse decrypted metadata")
+}
@@ -0,0 +1,102 @@
+package internal_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+type testMetadata struct {
+	Name string
+	LSN  uint64
+}
+
+func readRawObject(t *testing.T, folder storage.Folder, path string) []byte {
+	reader, err := folder.ReadObject(path)
+	require.NoError(t, err)
+	defer reader.Close()
+	content, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	return content
+}
+
+func TestEncryptMetadata_roundTrip(t *testing.T) {
+	for _, serializer := range []internal.DtoSerializerType{internal.RegularJSONSerializer, internal.StreamedJSONSerializer} {
+		withCrypterSettings(map[string]string{
+			internal.PgpKeyPathSetting:      PrivateKeyFilePath,
+			internal.EncryptMetadataSetting: "true",
+			internal.SerializerTypeSetting:  string(serializer),
+		}, func() {
+			folder := memory.NewFolder("", memory.NewStorage())
+			uploaded := testMetadata{Name: "base_000000010000000000000003", LSN: 0x3000028}
+			require.NoError(t, internal.UploadDto(folder, uploaded, "metadata.json"))
+			assert.False(t, json.Valid(readRawObject(t, folder, "metadata.json")), serializer)
+
+			var fetched testMetadata
+			backup := internal.NewBackup(folder, "base_000000010000000000000003")
+			require.NoError(t, backup.FetchDto(&fetched, "metadata.json"))
+			assert.Equal(t, uploaded, fetched, serializer)
+		})
+	}
+}
+
+// the objects uploaded before and after the metadata encryption is enabled are read alike
+func TestFetchDto_mixedMetadata(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	backup := internal.NewBackup(folder, "base_000000010000000000000003")
+	plaintext := testMetadata{Name: "plaintext", LSN: 1}
+	encrypted := testMetadata{Name: "encrypted", LSN: 2}
+	require.NoError(t, internal.UploadDto(folder, plaintext, "plaintext.json"))
+	assert.True(t, json.Valid(readRawObject(t, folder, "plaintext.json")))
+
+	withCrypterSettings(map[string]string{
+		internal.PgpKeyPathSetting:      PrivateKeyFilePath,
+		internal.EncryptMetadataSetting: "true",
+	}, func() {
+		require.NoError(t, internal.UploadDto(folder, encrypted, "encrypted.json"))
+		var fetched testMetadata
+		require.NoError(t, backup.FetchDto(&fetched, "plaintext.json"))
+		assert.Equal(t, plaintext, fetched)
+	})
+
+	// the metadata encryption is turned off, but the crypter still decrypts the objects encrypted before
+	withCrypterSettings(map[string]string{internal.PgpKeyPathSetting: PrivateKeyFilePath}, func() {
+		var fetched testMetadata
+		require.NoError(t, backup.FetchDto(&fetched, "encrypted.json"))
+		assert.Equal(t, encrypted, fetched)
+	})
+
+	var fetched testMetadata
+	assert.Error(t, backup.FetchDto(&fetched, "encrypted.json"))
+}
+
+func TestFetchDto_largeEncryptedMetadata(t *testing.T) {
+	withCrypterSettings(map[string]string{
+		internal.PgpKeyPathSetting:      PrivateKeyFilePath,
+		internal.EncryptMetadataSetting: "true",
+	}, func() {
+		folder := memory.NewFolder("", memory.NewStorage())
+		uploaded := testMetadata{Name: strings.Repeat("large", 1<<19), LSN: 3}
+		require.NoError(t, internal.UploadDto(folder, uploaded, "metadata.json"))
+
+		var fetched testMetadata
+		backup := internal.NewBackup(folder, "base_000000010000000000000003")
+		require.NoError(t, backup.FetchDto(&fetched, "metadata.json"))
+		assert.Equal(t, uploaded, fetched)
+	})
+}
+
+func TestEncryptMetadata_noCrypter(t *testing.T) {
+	withCrypterSettings(map[string]string{internal.EncryptMetadataSetting: "true"}, func() {
+		folder := memory.NewFolder("", memory.NewStorage())
+		require.NoError(t, internal.UploadDto(folder, testMetadata{Name: "plaintext"}, "metadata.json"))
+		assert.True(t, json.Valid(readRawObject(t, folder, "metadata.json")))
+	})
+}
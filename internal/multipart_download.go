@@ -0,0 +1,225 @@
+package internal
+
+import (
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// multipartDownload downloads the objects of at least threshold bytes in the parts of partSize bytes,
+// up to concurrency parts of the object at once. The parts are buffered in memory,
+// so one object takes at most concurrency * partSize bytes.
+type multipartDownload struct {
+	threshold   int64
+	partSize    int64
+	concurrency int
+}
+
+// configureMultipartDownload returns the multipart download if WALG_MULTIPART_DOWNLOAD_THRESHOLD is set, otherwise nil
+func configureMultipartDownload() (*multipartDownload, error) {
+	thresholdSetting, ok := GetSetting(MultipartDownloadThreshold)
+	if !ok {
+		return nil, nil
+	}
+	threshold, err := strconv.ParseInt(thresholdSetting, 10, 64)
+	if err != nil || threshold < 0 {
+		return nil, errors.Errorf("invalid %s value '%s': the object size in bytes expected",
+			MultipartDownloadThreshold, thresholdSetting)
+	}
+	partSize := viper.GetInt64(DownloadPartSizeSetting)
+	if partSize <= 0 {
+		return nil, errors.Errorf("invalid %s value '%s': the positive number of bytes expected",
+			DownloadPartSizeSetting, viper.GetString(DownloadPartSizeSetting))
+	}
+	concurrency, err := GetMaxConcurrency(DownloadPartConcurrency)
+	if err != nil {
+		return nil, err
+	}
+	tracelog.DebugLogger.Printf("Downloading the objects of %d bytes and more in the parts of %d bytes, %d at once",
+		threshold, partSize, concurrency)
+	return &multipartDownload{threshold: threshold, partSize: partSize, concurrency: concurrency}, nil
+}
+
+// open downloads the file in parts if it's large enough and its storage reads the ranges,
+// otherwise it's downloaded as one stream resumed after the transient errors.
+// The parts are read of the size and the version pinned before the download, since the listed size
+// is stale once the object is overwritten. The failed part is downloaded again up to resumeAttempts times.
+func (download *multipartDownload) open(file ReaderMaker, resumeAttempts int) (io.ReadCloser, error) {
+	if download != nil {
+		partReaderMaker, ok := file.(PartReaderMaker)
+		if ok && partReaderMaker.SupportsPartReads() {
+			listedSize, listed := partReaderMaker.Size()
+			if !listed || listedSize >= download.threshold {
+				size, sizeKnown, err := partReaderMaker.PinVersion()
+				if err != nil {
+					return nil, err
+				}
+				if sizeKnown && size > 0 && size >= download.threshold {
+					return newMultipartReader(partReaderMaker, size, download.partSize, download.concurrency,
+						resumeAttempts)
+				}
+			}
+		}
+	}
+	return NewResumableReaderMaker(file, resumeAttempts).Reader()
+}
+
+type downloadedPart struct {
+	data []byte
+	err  error
+}
+
+// multipartReader reads the parts downloaded concurrently in the object order. The part buffers
+// are reused, the next part is downloaded only when one of them is released by the consumed part.
+type multipartReader struct {
+	readerMaker PartReaderMaker
+	size        int64
+	partSize    int64
+	maxRetries  int
+
+	buffers chan []byte
+	parts   chan chan downloadedPart
+	// current is the unread rest of the part in buffer
+	buffer    []byte
+	current   []byte
+	err       error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newMultipartReader downloads the first part before it returns, so the object which can't be read
+// fails here like with Reader, and the content encoding and the ETag of the object are known.
+func newMultipartReader(readerMaker PartReaderMaker, size, partSize int64, concurrency int,
+	maxRetries int) (io.ReadCloser, error) {
+	reader := &multipartReader{
+		readerMaker: readerMaker,
+		size:        size,
+		partSize:    partSize,
+		maxRetries:  maxRetries,
+		buffers:     make(chan []byte, concurrency),
+		parts:       make(chan chan downloadedPart, concurrency),
+		done:        make(chan struct{}),
+	}
+	firstPart, err := reader.downloadPart(0, make([]byte, reader.partLength(0)))
+	if err != nil {
+		return nil, err
+	}
+	reader.buffer, reader.current = firstPart, firstPart
+	tracelog.DebugLogger.Printf("Downloading %s in %d parts of %d bytes, %d at once",
+		describeObject(readerMaker), (size+partSize-1)/partSize, partSize, concurrency)
+	go reader.dispatch(concurrency - 1)
+	return reader, nil
+}
+
+func (reader *multipartReader) partLength(offset int64) int64 {
+	if reader.size-offset < reader.partSize {
+		return reader.size - offset
+	}
+	return reader.partSize
+}
+
+// dispatch starts the download of every next part as soon as there is a free buffer,
+// the first part holds one of the buffers already
+func (reader *multipartReader) dispatch(freeBuffers int) {
+	defer close(reader.parts)
+	for offset := reader.partSize; offset < reader.size; offset += reader.partSize {
+		var buffer []byte
+		if freeBuffers > 0 {
+			freeBuffers--
+			buffer = make([]byte, reader.partSize)
+		} else {
+			select {
+			case buffer = <-reader.buffers:
+			case <-reader.done:
+				return
+			}
+		}
+		part := make(chan downloadedPart, 1)
+		select {
+		case reader.parts <- part:
+		case <-reader.done:
+			return
+		}
+		go func(offset int64, buffer []byte) {
+			data, err := reader.downloadPart(offset, buffer[:reader.partLength(offset)])
+			part <- downloadedPart{data, err}
+		}(offset, buffer)
+	}
+}
+
+// downloadPart fills the buffer with the part of the object at the offset, the part is downloaded again
+// from its beginning after an error
+func (reader *multipartReader) downloadPart(offset int64, buffer []byte) ([]byte, error) {
+	sleeper := NewExponentialSleeper(MinResumeRetryWait, MaxResumeRetryWait)
+	for attempt := 0; ; attempt++ {
+		err := reader.readPart(offset, buffer)
+		if err == nil {
+			return buffer, nil
+		}
+		var changedErr storage.ObjectChangedError
+		if attempt >= reader.maxRetries || errors.As(err, &changedErr) {
+			return nil, errors.Wrapf(err, "failed to download %d bytes of %s at offset %d",
+				len(buffer), reader.readerMaker.Path(), offset)
+		}
+		tracelog.WarningLogger.Printf("Failed to download %d bytes of %s at offset %d: %v. Retrying, attempt %d of %d",
+			len(buffer), reader.readerMaker.Path(), offset, err, attempt+1, reader.maxRetries)
+		sleeper.Sleep()
+	}
+}
+
+func (reader *multipartReader) readPart(offset int64, buffer []byte) error {
+	partReader, err := reader.readerMaker.PartReader(offset, int64(len(buffer)))
+	if err != nil {
+		return err
+	}
+	defer utility.LoggedClose(partReader, "")
+	_, err = io.ReadFull(partReader, buffer)
+	return err
+}
+
+func (reader *multipartReader) Read(p []byte) (int, error) {
+	if reader.err != nil {
+		return 0, reader.err
+	}
+	if len(reader.current) == 0 {
+		if err := reader.nextPart(); err != nil {
+			reader.err = err
+			return 0, err
+		}
+	}
+	n := copy(p, reader.current)
+	reader.current = reader.current[n:]
+	return n, nil
+}
+
+// nextPart releases the buffer of the consumed part and waits for the next one
+func (reader *multipartReader) nextPart() error {
+	if reader.buffer != nil {
+		reader.buffers <- reader.buffer[:cap(reader.buffer)]
+		reader.buffer, reader.current = nil, nil
+	}
+	part, ok := <-reader.parts
+	if !ok {
+		return io.EOF
+	}
+	downloaded := <-part
+	if downloaded.err != nil {
+		return downloaded.err
+	}
+	reader.buffer, reader.current = downloaded.data, downloaded.data
+	return nil
+}
+
+// Close stops the download of the next parts, the parts being downloaded are finished and dropped
+func (reader *multipartReader) Close() error {
+	reader.closeOnce.Do(func() {
+		close(reader.done)
+	})
+	return nil
+}
@@ -0,0 +1,216 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+var errPartDownload = errors.New("connection reset by peer")
+
+// partReaderMaker serves the parts of the data, the parts at the failing offsets fail once each.
+// The parts requested before the consumer has read enough to free a buffer are collected in tooEarly.
+// The listed size may differ from the size of the data, like the object overwritten since it was listed,
+// the parts of the changed object fail like the pinned reads do.
+type partReaderMaker struct {
+	data           []byte
+	listedSize     int64
+	partReads      bool
+	changed        bool
+	failingOffsets map[int64]bool
+	// read is the number of bytes the consumer has read
+	read     int64
+	partSize int64
+	buffers  int64
+
+	mutex       sync.Mutex
+	partCalls   int
+	readerCalls int
+	pinCalls    int
+	tooEarly    []int64
+}
+
+func (readerMaker *partReaderMaker) Reader() (io.ReadCloser, error) {
+	readerMaker.readerCalls++
+	return ioutil.NopCloser(bytes.NewReader(readerMaker.data)), nil
+}
+
+func (readerMaker *partReaderMaker) PartReader(offset, length int64) (io.ReadCloser, error) {
+	readerMaker.mutex.Lock()
+	defer readerMaker.mutex.Unlock()
+	readerMaker.partCalls++
+	consumedParts := atomic.LoadInt64(&readerMaker.read) / readerMaker.partSize
+	if offset/readerMaker.partSize >= consumedParts+readerMaker.buffers {
+		readerMaker.tooEarly = append(readerMaker.tooEarly, offset)
+	}
+	if readerMaker.changed {
+		return nil, storage.NewObjectChangedError(readerMaker.Path())
+	}
+	if readerMaker.failingOffsets[offset] {
+		delete(readerMaker.failingOffsets, offset)
+		return ioutil.NopCloser(io.MultiReader(bytes.NewReader(readerMaker.data[offset:offset+length/2]),
+			iotest.ErrReader(errPartDownload))), nil
+	}
+	return ioutil.NopCloser(bytes.NewReader(readerMaker.data[offset : offset+length])), nil
+}
+
+func (readerMaker *partReaderMaker) PinVersion() (int64, bool, error) {
+	readerMaker.pinCalls++
+	return int64(len(readerMaker.data)), true, nil
+}
+
+func (readerMaker *partReaderMaker) SupportsPartReads() bool         { return readerMaker.partReads }
+func (readerMaker *partReaderMaker) Size() (int64, bool)             { return readerMaker.listedSize, true }
+func (readerMaker *partReaderMaker) LastModified() (time.Time, bool) { return time.Time{}, false }
+func (readerMaker *partReaderMaker) Path() string {
+	return "base_000000010000000000000002/tar_partitions/part_1.tar.lz4"
+}
+func (readerMaker *partReaderMaker) FileType() FileType { return TarFileType }
+func (readerMaker *partReaderMaker) Mode() int          { return 0 }
+
+func newPartReaderMaker(size int) *partReaderMaker {
+	data := make([]byte, size)
+	rand.Read(data)
+	return &partReaderMaker{data: data, listedSize: int64(size), partReads: true, failingOffsets: map[int64]bool{}}
+}
+
+// readSlowly reads in small chunks counting the read bytes for the partReaderMaker checks
+func readSlowly(reader io.Reader, readerMaker *partReaderMaker) ([]byte, error) {
+	var read bytes.Buffer
+	chunk := make([]byte, 100)
+	for {
+		n, err := reader.Read(chunk)
+		read.Write(chunk[:n])
+		atomic.AddInt64(&readerMaker.read, int64(n))
+		if err == io.EOF {
+			return read.Bytes(), nil
+		}
+		if err != nil {
+			return read.Bytes(), err
+		}
+	}
+}
+
+func TestMultipartDownload_readsPartsInOrder(t *testing.T) {
+	readerMaker := newPartReaderMaker(10500)
+	readerMaker.partSize, readerMaker.buffers = 1000, 3
+	readerMaker.failingOffsets[4000] = true
+	download := &multipartDownload{threshold: 5000, partSize: 1000, concurrency: 3}
+
+	reader, err := download.open(readerMaker, 1)
+	require.NoError(t, err)
+	require.IsType(t, &multipartReader{}, reader)
+	read, err := readSlowly(reader, readerMaker)
+	assert.NoError(t, err)
+	assert.Equal(t, readerMaker.data, read)
+	assert.NoError(t, reader.Close())
+
+	assert.Equal(t, 12, readerMaker.partCalls)
+	assert.Empty(t, readerMaker.tooEarly, "the parts must not be downloaded beyond the buffers")
+	assert.Equal(t, 0, readerMaker.readerCalls)
+}
+
+func TestMultipartDownload_partFails(t *testing.T) {
+	readerMaker := newPartReaderMaker(5000)
+	readerMaker.partSize, readerMaker.buffers = 1000, 2
+	readerMaker.failingOffsets[3000] = true
+	download := &multipartDownload{threshold: 0, partSize: 1000, concurrency: 2}
+
+	reader, err := download.open(readerMaker, 0)
+	require.NoError(t, err)
+	defer reader.Close()
+	read, err := readSlowly(reader, readerMaker)
+	assert.True(t, errors.Is(err, errPartDownload))
+	assert.Contains(t, err.Error(), "at offset 3000")
+	assert.Equal(t, readerMaker.data[:3000], read)
+
+	readerMaker.failingOffsets[0] = true
+	_, err = download.open(readerMaker, 0)
+	assert.True(t, errors.Is(err, errPartDownload))
+}
+
+func TestMultipartDownload_singleStream(t *testing.T) {
+	download := &multipartDownload{threshold: 5000, partSize: 1000, concurrency: 3}
+	for _, readerMaker := range []*partReaderMaker{newPartReaderMaker(4999), newPartReaderMaker(10000)} {
+		if len(readerMaker.data) == 10000 {
+			readerMaker.partReads = false
+		}
+		reader, err := download.open(readerMaker, 0)
+		require.NoError(t, err)
+		read, err := ioutil.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, readerMaker.data, read)
+		assert.Equal(t, 1, readerMaker.readerCalls)
+		assert.Equal(t, 0, readerMaker.partCalls)
+		assert.Equal(t, 0, readerMaker.pinCalls, "the small and the unpinnable objects aren't checked")
+	}
+
+	var disabled *multipartDownload
+	readerMaker := newPartReaderMaker(10000)
+	_, err := disabled.open(readerMaker, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, readerMaker.readerCalls)
+}
+
+func TestMultipartDownload_pinnedSize(t *testing.T) {
+	readerMaker := newPartReaderMaker(10500)
+	readerMaker.partSize, readerMaker.buffers = 1000, 3
+	readerMaker.listedSize = 6000
+	download := &multipartDownload{threshold: 5000, partSize: 1000, concurrency: 3}
+
+	reader, err := download.open(readerMaker, 1)
+	require.NoError(t, err)
+	read, err := readSlowly(reader, readerMaker)
+	assert.NoError(t, err)
+	assert.Equal(t, readerMaker.data, read, "the size pinned before the download is read, not the listed one")
+	assert.NoError(t, reader.Close())
+	assert.Equal(t, 1, readerMaker.pinCalls)
+	assert.Equal(t, 11, readerMaker.partCalls)
+}
+
+func TestMultipartDownload_objectChanged(t *testing.T) {
+	readerMaker := newPartReaderMaker(5000)
+	readerMaker.partSize, readerMaker.buffers = 1000, 2
+	readerMaker.changed = true
+	download := &multipartDownload{threshold: 0, partSize: 1000, concurrency: 2}
+
+	_, err := download.open(readerMaker, 3)
+	var changedErr storage.ObjectChangedError
+	assert.True(t, errors.As(err, &changedErr), err)
+	assert.Equal(t, 1, readerMaker.partCalls, "the changed object isn't downloaded again")
+}
+
+func TestConfigureMultipartDownload(t *testing.T) {
+	defer viper.Set(MultipartDownloadThreshold, nil)
+	defer viper.Set(DownloadPartSizeSetting, viper.Get(DownloadPartSizeSetting))
+
+	download, err := configureMultipartDownload()
+	assert.NoError(t, err)
+	assert.Nil(t, download)
+
+	viper.Set(MultipartDownloadThreshold, "1073741824")
+	viper.Set(DownloadPartSizeSetting, "8388608")
+	download, err = configureMultipartDownload()
+	require.NoError(t, err)
+	assert.Equal(t, &multipartDownload{threshold: 1 << 30, partSize: 8 << 20, concurrency: 4}, download)
+
+	viper.Set(DownloadPartSizeSetting, "0")
+	_, err = configureMultipartDownload()
+	assert.Error(t, err)
+
+	viper.Set(MultipartDownloadThreshold, "1GB")
+	_, err = configureMultipartDownload()
+	assert.Error(t, err)
+}
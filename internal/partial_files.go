@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"archive/tar"
+	"io"
+
+	"github.com/wal-g/tracelog"
+)
+
+// PartialFileRemover is implemented by the interpreters writing the entries to disk. RemovePartialFile removes
+// what the interpreter has written of the entry which failed to extract, so neither the retry nor the delta
+// restore takes the partial file for the extracted one.
+type PartialFileRemover interface {
+	RemovePartialFile(header *tar.Header) error
+}
+
+// partialFileTracker remembers the entry of the archive which failed to extract. It is made for every
+// extracted archive, so it's used by one goroutine only.
+type partialFileTracker struct {
+	TarInterpreter
+	failed *tar.Header
+}
+
+func newPartialFileTracker(tarInterpreter TarInterpreter) *partialFileTracker {
+	return &partialFileTracker{TarInterpreter: tarInterpreter}
+}
+
+func (tracker *partialFileTracker) Interpret(reader io.Reader, header *tar.Header) error {
+	err := tracker.TarInterpreter.Interpret(reader, header)
+	if err != nil {
+		tracker.failed = header
+	}
+	return err
+}
+
+// removePartialFile removes the output of the failed entry, the entries extracted before it are complete
+func (tracker *partialFileTracker) removePartialFile() {
+	remover, ok := tracker.TarInterpreter.(PartialFileRemover)
+	if !ok || tracker.failed == nil {
+		return
+	}
+	if err := remover.RemovePartialFile(tracker.failed); err != nil {
+		tracelog.WarningLogger.Printf("Failed to remove the partially extracted %s: %v", tracker.failed.Name, err)
+	}
+	tracker.failed = nil
+}
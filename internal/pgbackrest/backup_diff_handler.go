@@ -0,0 +1,171 @@
+package pgbackrest
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+// BackupDiffEntry is the file added, removed or changed between two backups,
+// PreviousSize is the size in the first backup and Size is the size in the second one
+type BackupDiffEntry struct {
+	Path         string `json:"path"`
+	PreviousSize int64  `json:"previous_size"`
+	Size         int64  `json:"size"`
+}
+
+type BackupDiff struct {
+	From    string            `json:"from"`
+	To      string            `json:"to"`
+	Added   []BackupDiffEntry `json:"added"`
+	Removed []BackupDiffEntry `json:"removed"`
+	Changed []BackupDiffEntry `json:"changed"`
+}
+
+// BackupDiffSummary counts the differences, ChangedBytes is the total size of the added and changed files,
+// i.e. how much data an incremental backup on top of the first backup has to copy
+type BackupDiffSummary struct {
+	From         string `json:"from"`
+	To           string `json:"to"`
+	Added        int    `json:"added"`
+	Removed      int    `json:"removed"`
+	Changed      int    `json:"changed"`
+	ChangedBytes int64  `json:"changed_bytes"`
+}
+
+// HandleBackupDiff compares the file lists of two backup manifests and prints the added, removed
+// and changed files, the files are compared by checksums and sizes
+func HandleBackupDiff(folder storage.Folder, stanza string, fromSelector, toSelector internal.BackupSelector,
+	summary bool, json bool, output io.Writer) error {
+	diff, err := GetBackupDiff(folder, stanza, fromSelector, toSelector)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case summary && json:
+		return internal.WriteAsJSON(diff.Summary(), output, true)
+	case summary:
+		return writeBackupDiffSummary(diff.Summary(), output)
+	case json:
+		return internal.WriteAsJSON(diff, output, true)
+	default:
+		return writeBackupDiff(diff, output)
+	}
+}
+
+func GetBackupDiff(folder storage.Folder, stanza string,
+	fromSelector, toSelector internal.BackupSelector) (*BackupDiff, error) {
+	fromBackup, err := fromSelector.Select(folder)
+	if err != nil {
+		return nil, err
+	}
+	toBackup, err := toSelector.Select(folder)
+	if err != nil {
+		return nil, err
+	}
+	fromManifest, err := LoadManifest(folder, stanza, fromBackup)
+	if err != nil {
+		return nil, err
+	}
+	toManifest, err := LoadManifest(folder, stanza, toBackup)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := diffManifestFiles(fromManifest.FileSection.files, toManifest.FileSection.files)
+	diff.From = fromBackup
+	diff.To = toBackup
+	return diff, nil
+}
+
+func diffManifestFiles(fromFiles, toFiles map[string]ManifestFile) *BackupDiff {
+	diff := &BackupDiff{
+		Added:   make([]BackupDiffEntry, 0),
+		Removed: make([]BackupDiffEntry, 0),
+		Changed: make([]BackupDiffEntry, 0),
+	}
+	for path, toFile := range toFiles {
+		fromFile, ok := fromFiles[path]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, BackupDiffEntry{Path: path, Size: toFile.Size})
+		case fromFile.Checksum != toFile.Checksum || fromFile.Size != toFile.Size:
+			diff.Changed = append(diff.Changed, BackupDiffEntry{Path: path, PreviousSize: fromFile.Size, Size: toFile.Size})
+		}
+	}
+	for path, fromFile := range fromFiles {
+		if _, ok := toFiles[path]; !ok {
+			diff.Removed = append(diff.Removed, BackupDiffEntry{Path: path, PreviousSize: fromFile.Size})
+		}
+	}
+
+	for _, entries := range [][]BackupDiffEntry{diff.Added, diff.Removed, diff.Changed} {
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Path < entries[j].Path
+		})
+	}
+	return diff
+}
+
+func (diff *BackupDiff) Summary() BackupDiffSummary {
+	summary := BackupDiffSummary{
+		From:    diff.From,
+		To:      diff.To,
+		Added:   len(diff.Added),
+		Removed: len(diff.Removed),
+		Changed: len(diff.Changed),
+	}
+	for _, entry := range diff.Added {
+		summary.ChangedBytes += entry.Size
+	}
+	for _, entry := range diff.Changed {
+		summary.ChangedBytes += entry.Size
+	}
+	return summary
+}
+
+func writeBackupDiff(diff *BackupDiff, output io.Writer) error {
+	writer := tabwriter.NewWriter(output, 0, 0, 1, ' ', 0)
+	for _, entry := range diff.Added {
+		if _, err := fmt.Fprintf(writer, "+\t%s\t%d\n", entry.Path, entry.Size); err != nil {
+			return err
+		}
+	}
+	for _, entry := range diff.Removed {
+		if _, err := fmt.Fprintf(writer, "-\t%s\t%d\n", entry.Path, entry.PreviousSize); err != nil {
+			return err
+		}
+	}
+	for _, entry := range diff.Changed {
+		if _, err := fmt.Fprintf(writer, "~\t%s\t%d -> %d\n", entry.Path, entry.PreviousSize, entry.Size); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+func writeBackupDiffSummary(summary BackupDiffSummary, output io.Writer) error {
+	writer := tabwriter.NewWriter(output, 0, 0, 1, ' ', 0)
+	fields := []struct {
+		name  string
+		value interface{}
+	}{
+		{"from", summary.From},
+		{"to", summary.To},
+		{"added", summary.Added},
+		{"removed", summary.Removed},
+		{"changed", summary.Changed},
+		{"changed_bytes", summary.ChangedBytes},
+	}
+	for _, field := range fields {
+		if _, err := fmt.Fprintf(writer, "%s:\t%v\n", field.name, field.value); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,82 @@
+package pgbackrest
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+const (
+	testDiffFromManifest = "[target:file]\n" +
+		`pg_data/PG_VERSION={"checksum":"8dc7b1c1","size":3,"timestamp":1640995200}` + "\n" +
+		`pg_data/base/1/1259={"checksum":"aaaa","repo-size":4096,"size":8192,"timestamp":1640995200}` + "\n" +
+		`pg_data/base/1/16384={"checksum":"bbbb","size":16384,"timestamp":1640995200}` + "\n"
+	testDiffToManifest = "[target:file]\n" +
+		`pg_data/PG_VERSION={"checksum":"8dc7b1c1","reference":"20220101-000000F","size":3}` + "\n" +
+		`pg_data/base/1/1259={"checksum":"cccc","size":16384}` + "\n" +
+		`pg_data/base/1/16385={"checksum":"dddd","size":24576}` + "\n"
+)
+
+func putDiffTestManifests(t *testing.T, manifests map[string]string) storage.Folder {
+	folder := memory.NewFolder("", memory.NewStorage())
+	stanzaFolder := folder.GetSubFolder(BackupPath).GetSubFolder(testStanza)
+	for backupName, manifest := range manifests {
+		require.NoError(t, stanzaFolder.GetSubFolder(backupName).PutObject(BackupManifestIni,
+			strings.NewReader(manifest)))
+	}
+	return folder
+}
+
+func TestLoadManifest_fileSection(t *testing.T) {
+	folder := putDiffTestManifests(t, map[string]string{testFullBackup: testDiffFromManifest})
+
+	manifest, err := LoadManifest(folder, testStanza, testFullBackup)
+	require.NoError(t, err)
+	assert.Len(t, manifest.FileSection.files, 3)
+	assert.Equal(t, ManifestFile{Checksum: "aaaa", Size: 8192, RepoSize: 4096, Timestamp: 1640995200},
+		manifest.FileSection.files["pg_data/base/1/1259"])
+
+	folder = putDiffTestManifests(t, map[string]string{testFullBackup: "[target:file]\npg_data/PG_VERSION={\"size\":\n"})
+	_, err = LoadManifest(folder, testStanza, testFullBackup)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pg_data/PG_VERSION")
+}
+
+func TestHandleBackupDiff(t *testing.T) {
+	folder := putDiffTestManifests(t, map[string]string{
+		testFullBackup: testDiffFromManifest,
+		testIncrBackup: testDiffToManifest,
+	})
+	from, to := namedBackupSelector(testFullBackup), namedBackupSelector(testIncrBackup)
+
+	var output bytes.Buffer
+	require.NoError(t, HandleBackupDiff(folder, testStanza, from, to, false, false, &output))
+	assert.Equal(t, "+ pg_data/base/1/16385 24576\n"+
+		"- pg_data/base/1/16384 16384\n"+
+		"~ pg_data/base/1/1259  8192 -> 16384\n", output.String())
+
+	output.Reset()
+	require.NoError(t, HandleBackupDiff(folder, testStanza, from, to, true, true, &output))
+	var summary BackupDiffSummary
+	require.NoError(t, json.Unmarshal(output.Bytes(), &summary))
+	assert.Equal(t, BackupDiffSummary{From: testFullBackup, To: testIncrBackup,
+		Added: 1, Removed: 1, Changed: 1, ChangedBytes: 24576 + 16384}, summary)
+
+	output.Reset()
+	require.NoError(t, HandleBackupDiff(folder, testStanza, from, to, true, false, &output))
+	assert.Contains(t, output.String(), "changed_bytes: 40960\n")
+
+	output.Reset()
+	require.NoError(t, HandleBackupDiff(folder, testStanza, from, from, false, true, &output))
+	var diff BackupDiff
+	require.NoError(t, json.Unmarshal(output.Bytes(), &diff))
+	assert.Empty(t, diff.Added)
+	assert.Empty(t, diff.Removed)
+	assert.Empty(t, diff.Changed)
+}
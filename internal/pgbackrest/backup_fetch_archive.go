@@ -0,0 +1,202 @@
+package pgbackrest
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const tarExtension = "tar"
+
+// HandlePgbackrestBackupFetchToArchive writes the pgbackrest backup to the local tar file instead of restoring it.
+// The archive is compressed if its name ends with the extension of some compressor, e.g. backup.tar.zst.
+func HandlePgbackrestBackupFetchToArchive(folder storage.Folder, stanza string, archivePath string,
+	backupSelector internal.BackupSelector, strictListing bool, flatten bool) error {
+	compressor, err := archiveCompressor(archivePath)
+	if err != nil {
+		return err
+	}
+	lister, err := newConfiguredFilesLister(strictListing)
+	if err != nil {
+		return err
+	}
+	backupDetails, files, err := selectBackupFiles(folder, stanza, backupSelector, lister, flatten)
+	if err != nil {
+		return err
+	}
+
+	archiveFile, err := os.Create(archivePath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create archive '%s'", archivePath)
+	}
+	err = writeBackupArchive(archiveFile, compressor, backupDetails, files)
+	if err == nil {
+		err = archiveFile.Sync()
+	}
+	if err != nil {
+		utility.LoggedClose(archiveFile, "")
+		if removeErr := os.Remove(archivePath); removeErr != nil {
+			tracelog.WarningLogger.Printf("failed to remove incomplete archive '%s': %v", archivePath, removeErr)
+		}
+		return err
+	}
+	tracelog.InfoLogger.Printf("Backup %s is written to %s", backupDetails.BackupName, archivePath)
+	return archiveFile.Close()
+}
+
+// archiveCompressor returns the compressor by the extension following .tar, or nil for the plain .tar
+func archiveCompressor(archivePath string) (compression.Compressor, error) {
+	extension := utility.GetFileExtension(archivePath)
+	if extension == tarExtension {
+		return nil, nil
+	}
+	if utility.GetFileExtension(utility.TrimFileExtension(archivePath)) == tarExtension {
+		for _, compressor := range compression.Compressors {
+			if compressor.FileExtension() == extension {
+				return compressor, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unsupported archive name '%s', expected .tar or .tar.<compression>, e.g. .tar.zst", archivePath)
+}
+
+// writeBackupArchive writes the directories of the manifest and the files of the backup to the tar stream,
+// with the modes the in-place restore would give them
+func writeBackupArchive(writer io.Writer, compressor compression.Compressor, backupDetails *BackupDetails,
+	files []internal.ReaderMaker) error {
+	var compressedWriter io.WriteCloser
+	if compressor != nil {
+		compressedWriter = compressor.NewWriter(writer)
+		writer = compressedWriter
+	}
+	tarWriter := tar.NewWriter(writer)
+	interpreter := newArchiveTarInterpreter(tarWriter, backupDetails.FinishTime)
+
+	directories, err := archiveDirectories(backupDetails.DirectoryPaths)
+	if err != nil {
+		return err
+	}
+	for _, directory := range directories {
+		err = interpreter.Interpret(nil, &tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     directory,
+			Mode:     int64(backupDetails.DefaultDirectoryMode),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(files) > 0 {
+		err = internal.ExplainExtractionError(internal.ExtractAll(interpreter, files))
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = tarWriter.Close(); err != nil {
+		return errors.Wrap(err, "failed to finish the archive")
+	}
+	if compressedWriter != nil {
+		return errors.Wrap(compressedWriter.Close(), "failed to finish the archive compression")
+	}
+	return nil
+}
+
+// archiveDirectories returns the manifest directories relative to the data directory, parents first
+func archiveDirectories(directoryPaths []string) ([]string, error) {
+	directories := make([]string, 0, len(directoryPaths))
+	for _, directoryPath := range directoryPaths {
+		relativeDirectory, err := filepath.Rel(BackupDataDirectory, directoryPath)
+		if err != nil {
+			return nil, err
+		}
+		if relativeDirectory == "." {
+			continue
+		}
+		directories = append(directories, filepath.ToSlash(relativeDirectory))
+	}
+	sort.Strings(directories)
+	return directories, nil
+}
+
+// archiveTarInterpreter writes the extracted files to the tar archive. The header of the tar entry
+// needs the size, which is unknown until the file is decompressed, so every file is spooled
+// to the temporary file first: the downloads stay concurrent, and only the writes to the archive are serialized.
+type archiveTarInterpreter struct {
+	tarWriter *tar.Writer
+	modTime   time.Time
+
+	mutex sync.Mutex
+	// err makes the archive failure permanent, the retried files can't be appended to the broken stream
+	err error
+}
+
+func newArchiveTarInterpreter(tarWriter *tar.Writer, modTime time.Time) *archiveTarInterpreter {
+	return &archiveTarInterpreter{tarWriter: tarWriter, modTime: modTime}
+}
+
+func (interpreter *archiveTarInterpreter) Interpret(reader io.Reader, header *tar.Header) error {
+	archiveHeader := &tar.Header{
+		Typeflag: header.Typeflag,
+		Name:     strings.TrimPrefix(header.Name, "/"),
+		Linkname: header.Linkname,
+		Mode:     header.Mode,
+		ModTime:  interpreter.modTime,
+		Format:   tar.FormatPAX,
+	}
+	if header.Typeflag == tar.TypeDir {
+		archiveHeader.Name += "/"
+	}
+	if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+		return interpreter.write(archiveHeader, nil)
+	}
+
+	spool, err := ioutil.TempFile("", "wal-g-archive-")
+	if err != nil {
+		return errors.Wrap(err, "failed to create the spool file")
+	}
+	defer func() {
+		utility.LoggedClose(spool, "")
+		_ = os.Remove(spool.Name())
+	}()
+	archiveHeader.Typeflag = tar.TypeReg
+	archiveHeader.Size, err = io.Copy(spool, reader)
+	if err != nil {
+		return errors.Wrapf(err, "failed to spool '%s'", header.Name)
+	}
+	if _, err = spool.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrapf(err, "failed to spool '%s'", header.Name)
+	}
+	return interpreter.write(archiveHeader, spool)
+}
+
+func (interpreter *archiveTarInterpreter) write(header *tar.Header, content io.Reader) error {
+	interpreter.mutex.Lock()
+	defer interpreter.mutex.Unlock()
+	if interpreter.err != nil {
+		return interpreter.err
+	}
+
+	err := interpreter.tarWriter.WriteHeader(header)
+	if err == nil && content != nil {
+		_, err = io.Copy(interpreter.tarWriter, content)
+	}
+	if err != nil {
+		interpreter.err = errors.Wrapf(err, "failed to write '%s' to the archive", header.Name)
+	}
+	return interpreter.err
+}
@@ -0,0 +1,96 @@
+package pgbackrest
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+)
+
+func TestArchiveCompressor(t *testing.T) {
+	compressor, err := archiveCompressor("backup.tar")
+	assert.NoError(t, err)
+	assert.Nil(t, compressor)
+
+	compressor, err = archiveCompressor("/tmp/backup.tar.lz4")
+	assert.NoError(t, err)
+	assert.Equal(t, "lz4", compressor.FileExtension())
+
+	for _, archivePath := range []string{"backup.lz4", "backup.tar.unknown", "backup"} {
+		_, err = archiveCompressor(archivePath)
+		assert.Error(t, err, archivePath)
+	}
+}
+
+func TestWriteBackupArchive(t *testing.T) {
+	viper.Set(internal.DownloadConcurrencySetting, 2)
+	defer viper.Set(internal.DownloadConcurrencySetting, nil)
+
+	folder := memory.NewFolder("", memory.NewStorage())
+	dataFolder := folder.GetSubFolder(BackupFolderName).GetSubFolder(testStanza).GetSubFolder("full").
+		GetSubFolder(BackupDataDirectory)
+	contents := map[string]string{
+		"PG_VERSION":        "14",
+		"base/1/1259":       "pg_class",
+		"global/pg_control": "control",
+	}
+	for name, content := range contents {
+		compressed := new(bytes.Buffer)
+		gzipWriter := gzip.NewWriter(compressed)
+		_, err := gzipWriter.Write([]byte(content))
+		assert.NoError(t, err)
+		assert.NoError(t, gzipWriter.Close())
+		assert.NoError(t, dataFolder.PutObject(name+".gz", compressed))
+	}
+	files, err := newFilesLister(true, 1).getFiles(dataFolder, dataFolder, 0600)
+	assert.NoError(t, err)
+	backupDetails := &BackupDetails{
+		BackupName:           "full",
+		FinishTime:           time.Unix(1600000000, 0),
+		DirectoryPaths:       []string{"pg_data/global", "pg_data/base/1", "pg_data", "pg_data/base", "pg_data/pg_wal"},
+		DefaultFileMode:      0600,
+		DefaultDirectoryMode: 0700,
+	}
+
+	compressor, err := archiveCompressor("backup.tar.lz4")
+	assert.NoError(t, err)
+	archive := new(bytes.Buffer)
+	assert.NoError(t, writeBackupArchive(archive, compressor, backupDetails, files))
+
+	decompressed, err := compression.FindDecompressor("lz4").Decompress(archive)
+	assert.NoError(t, err)
+	tarReader := tar.NewReader(decompressed)
+	var directories []string
+	extracted := make(map[string]string)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, backupDetails.FinishTime, header.ModTime)
+		if header.Typeflag == tar.TypeDir {
+			assert.Equal(t, int64(0700), header.Mode)
+			directories = append(directories, header.Name)
+			continue
+		}
+		assert.Equal(t, byte(tar.TypeReg), header.Typeflag)
+		assert.Equal(t, int64(0600), header.Mode)
+		content, err := ioutil.ReadAll(tarReader)
+		assert.NoError(t, err)
+		extracted[header.Name] = string(content)
+	}
+
+	// the parents precede their children, so the archive extracts in order
+	assert.Equal(t, []string{"base/", "base/1/", "global/", "pg_wal/"}, directories)
+	assert.Equal(t, contents, extracted)
+}
@@ -1,99 +1,400 @@
 package pgbackrest
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression"
 	"github.com/wal-g/wal-g/internal/databases/postgres"
 	"github.com/wal-g/wal-g/pkg/storages/storage"
 	"github.com/wal-g/wal-g/utility"
+	"golang.org/x/sync/errgroup"
 )
 
+// FetchOptions tune the restore of HandlePgbackrestBackupFetch
+type FetchOptions struct {
+	// StrictListing fails the fetch on the backup subfolders which can't be listed, otherwise they are skipped
+	// with the warning
+	StrictListing bool
+	// ParallelVerify compares the restored files with the manifest checksums, all the mismatches fail the fetch
+	ParallelVerify bool
+	// DecompressNested decompresses the compressed files inside the archives too
+	DecompressNested bool
+	// Flatten takes the files from the backups their manifest references name, see flattenedBackupFiles
+	Flatten bool
+	// Delta keeps the files of the destination which match the backup and fetches the rest, see prepareDeltaRestore
+	Delta bool
+	// RecoveryConfig prepares the restored cluster to start the recovery, see ApplyRecoveryConfig
+	RecoveryConfig RecoveryConfig
+}
+
+// HandlePgbackrestBackupFetch restores the backup to destinationDirectory as the options tell
 func HandlePgbackrestBackupFetch(folder storage.Folder, stanza string, destinationDirectory string,
-	backupSelector internal.BackupSelector) error {
-	backupName, err := backupSelector.Select(folder)
+	backupSelector internal.BackupSelector, options FetchOptions) error {
+	lister, err := newConfiguredFilesLister(options.StrictListing)
+	if err != nil {
+		return err
+	}
+	backupDetails, files, err := selectBackupFiles(folder, stanza, backupSelector, lister, options.Flatten)
+	if err != nil {
+		return err
+	}
+	if err = options.RecoveryConfig.Validate(backupDetails.PgVersion); err != nil {
+		return err
+	}
+	var extractOptions []internal.ExtractOption
+	var deltaRestore *deltaRestore
+	if options.Delta {
+		deltaRestore, err = prepareBackupDeltaRestore(folder, stanza, backupDetails, destinationDirectory)
+		if err != nil {
+			return err
+		}
+		extractOptions = append(extractOptions, internal.ExtractPredicate(deltaRestore.shouldFetch))
+	}
+	err = createDirectories(backupDetails, destinationDirectory)
 	if err != nil {
 		return err
 	}
 
-	backupDetails, err := GetBackupDetails(folder, stanza, backupName)
+	fileInterpreter := postgres.NewFileTarInterpreter(destinationDirectory, postgres.BackupSentinelDto{},
+		postgres.FilesMetadataDto{}, getFilesToUnwrap(files, options.DecompressNested), false)
+	fileInterpreter.DecompressNestedFiles = options.DecompressNested
+	fileInterpreter.Overwrite, err = internal.GetRestoreOverwriteMode()
 	if err != nil {
 		return err
 	}
+	if options.Delta {
+		// the files left by the delta restore differ from the backup, so they are always overwritten
+		fileInterpreter.Overwrite = internal.OverwriteExistingFiles
+	}
+	// WALG_RESTORE_UMASK is not applied: the modes from the backup manifest take precedence
+	err = internal.ExtractAllWithOptions(fileInterpreter, files, extractOptions...)
+	if err != nil {
+		return internal.ExplainExtractionError(err)
+	}
+	if deltaRestore != nil {
+		if err := deltaRestore.removeStale(); err != nil {
+			return err
+		}
+	}
+	if options.ParallelVerify {
+		err = verifyRestoredBackup(folder, stanza, backupDetails.BackupName, destinationDirectory)
+		if err != nil {
+			return err
+		}
+	}
+	// the recovery settings change postgresql.auto.conf of the backup, so they are written after the verification
+	return ApplyRecoveryConfig(destinationDirectory, backupDetails.PgVersion, options.RecoveryConfig)
+}
 
-	switch backupDetails.Type {
-	case "full":
-		return fullBackupFetch(folder, stanza, backupName, destinationDirectory, backupDetails)
+func prepareBackupDeltaRestore(folder storage.Folder, stanza string, backupDetails *BackupDetails,
+	dbDataDirectory string) (*deltaRestore, error) {
+	concurrency, err := internal.GetMaxDownloadConcurrency()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := LoadManifest(folder, stanza, backupDetails.BackupName)
+	if err != nil {
+		return nil, err
+	}
+	return prepareDeltaRestore(manifest.FileSection.files, backupDetails.DirectoryPaths, dbDataDirectory, concurrency)
+}
+
+// verifyRestoredBackup checks the restored files against the manifest checksums with WALG_DOWNLOAD_CONCURRENCY workers
+func verifyRestoredBackup(folder storage.Folder, stanza string, backupName string, destinationDirectory string) error {
+	concurrency, err := internal.GetMaxDownloadConcurrency()
+	if err != nil {
+		return err
+	}
+	manifest, err := LoadManifest(folder, stanza, backupName)
+	if err != nil {
+		return err
+	}
+	result := verifyRestoredFiles(manifest.FileSection.files, destinationDirectory, concurrency)
+	if len(result.Mismatches) > 0 {
+		return ChecksumVerificationError{result}
+	}
+	return nil
+}
+
+// selectBackupFiles returns the details of the selected backup and the files to restore it
+func selectBackupFiles(folder storage.Folder, stanza string, backupSelector internal.BackupSelector,
+	lister *filesLister, flatten bool) (*BackupDetails, []internal.ReaderMaker, error) {
+	backupName, err := backupSelector.Select(folder)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	backupDetails, err := GetBackupDetails(folder, stanza, backupName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var files []internal.ReaderMaker
+	switch {
+	case flatten && isKnownBackupType(backupDetails.Type):
+		files, err = flattenedBackupFiles(folder, stanza, backupName, backupDetails, lister)
+	case backupDetails.Type == FullBackupType:
+		files, err = fullBackupFiles(folder, stanza, backupName, backupDetails, lister)
+	case backupDetails.Type == DiffBackupType || backupDetails.Type == IncrBackupType:
+		files, err = layeredBackupFiles(folder, stanza, backupName, backupDetails, lister)
 	default:
-		return errors.New("Unsupported backup type: " + backupDetails.Type)
+		return nil, nil, errors.New("Unsupported backup type: " + backupDetails.Type)
+	}
+	if err != nil {
+		return nil, nil, err
 	}
+	return backupDetails, files, nil
 }
 
-func fullBackupFetch(folder storage.Folder, stanza string, backupName string,
-	destinationDirectory string, backupDetails *BackupDetails) error {
+func fullBackupFiles(folder storage.Folder, stanza string, backupName string,
+	backupDetails *BackupDetails, lister *filesLister) ([]internal.ReaderMaker, error) {
 	backupFilesFolder := folder.GetSubFolder(BackupFolderName).GetSubFolder(stanza).GetSubFolder(backupName).GetSubFolder(BackupDataDirectory)
-	err := createDirectories(backupDetails, destinationDirectory)
+	return lister.getFiles(backupFilesFolder, backupFilesFolder, backupDetails.DefaultFileMode)
+}
+
+// layeredBackupFiles returns the files of the diff or incr backup together with the backups it references,
+// every file is fetched from the newest backup which contains it
+func layeredBackupFiles(folder storage.Folder, stanza string, backupName string,
+	backupDetails *BackupDetails, lister *filesLister) ([]internal.ReaderMaker, error) {
+	references, err := getBackupReferences(folder, stanza, backupName)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	manifest, err := LoadManifest(folder, stanza, backupName)
+	if err != nil {
+		return nil, err
+	}
+
+	stanzaFolder := folder.GetSubFolder(BackupFolderName).GetSubFolder(stanza)
+	layers := make([][]internal.ReaderMaker, 0, len(references)+1)
+	for _, layerName := range append(references, backupName) {
+		layerFilesFolder := stanzaFolder.GetSubFolder(layerName).GetSubFolder(BackupDataDirectory)
+		layerFiles, err := lister.getFiles(layerFilesFolder, layerFilesFolder, backupDetails.DefaultFileMode)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, layerFiles)
 	}
+	return filterManifestFiles(deduplicateLayers(layers), manifest.FileSection.files), nil
+}
 
-	files, err := getFilesRecursively(backupFilesFolder, backupFilesFolder, backupDetails.DefaultFileMode)
+func isKnownBackupType(backupType string) bool {
+	return backupType == FullBackupType || backupType == DiffBackupType || backupType == IncrBackupType
+}
+
+// flattenedBackupFiles resolves the files of the manifest the way the pgbackrest restore does: every file
+// is read from the backup its reference names, or from the backup itself when it has no reference.
+// Unlike layeredBackupFiles it doesn't depend on which older files the newer backups happen to contain,
+// e.g. the hardlinks of the unchanged files made with repo-hardlink, and fails if any file is missing.
+// The files outside the data directory, e.g. of the tablespaces, aren't restored.
+func flattenedBackupFiles(folder storage.Folder, stanza string, backupName string,
+	backupDetails *BackupDetails, lister *filesLister) ([]internal.ReaderMaker, error) {
+	references, err := getBackupReferences(folder, stanza, backupName)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	manifest, err := LoadManifest(folder, stanza, backupName)
+	if err != nil {
+		return nil, err
 	}
 
-	fileInterpreter := postgres.NewFileTarInterpreter(destinationDirectory, postgres.BackupSentinelDto{},
-		postgres.FilesMetadataDto{}, getFilesToUnwrap(files), false)
-	return internal.ExtractAll(fileInterpreter, files)
+	sources := append(references, backupName)
+	filesBySource := make(map[string][]string, len(sources))
+	for _, source := range sources {
+		filesBySource[source] = nil
+	}
+	for manifestPath, manifestFile := range manifest.FileSection.files {
+		if !strings.HasPrefix(manifestPath, BackupDataDirectory+"/") {
+			continue
+		}
+		source := manifestFile.Reference
+		if source == "" {
+			source = backupName
+		}
+		if _, ok := filesBySource[source]; !ok {
+			return nil, fmt.Errorf("file '%s' of backup '%s' references backup '%s' which it doesn't depend on",
+				manifestPath, backupName, source)
+		}
+		filesBySource[source] = append(filesBySource[source], manifestPath)
+	}
+
+	stanzaFolder := folder.GetSubFolder(BackupFolderName).GetSubFolder(stanza)
+	var files []internal.ReaderMaker
+	for _, source := range sources {
+		manifestPaths := filesBySource[source]
+		if len(manifestPaths) == 0 {
+			continue
+		}
+		sourceFilesFolder := stanzaFolder.GetSubFolder(source).GetSubFolder(BackupDataDirectory)
+		sourceFiles, err := lister.getFiles(sourceFilesFolder, sourceFilesFolder, backupDetails.DefaultFileMode)
+		if err != nil {
+			return nil, err
+		}
+		sourceFilesByPath := make(map[string]internal.ReaderMaker, len(sourceFiles))
+		for _, file := range sourceFiles {
+			sourceFilesByPath[path.Join(BackupDataDirectory, trimCompressionExtension(file.Path()))] = file
+		}
+		sort.Strings(manifestPaths)
+		for _, manifestPath := range manifestPaths {
+			file, ok := sourceFilesByPath[manifestPath]
+			if !ok {
+				return nil, fmt.Errorf("file '%s' of backup '%s' is missing in backup '%s'",
+					manifestPath, backupName, source)
+			}
+			files = append(files, file)
+		}
+	}
+	return files, nil
 }
 
-func getFilesToUnwrap(files []internal.ReaderMaker) map[string]bool {
+// getBackupReferences returns the backups the given one depends on, from the full backup to the latest one
+func getBackupReferences(folder storage.Folder, stanza string, backupName string) ([]string, error) {
+	backupsSettings, err := LoadBackupsSettings(folder, stanza)
+	if err != nil {
+		return nil, err
+	}
+	for _, settings := range backupsSettings {
+		if settings.Name == backupName {
+			return settings.BackupReference, nil
+		}
+	}
+	return nil, fmt.Errorf("backup '%s' is not found in %s", backupName, BackupInfoIni)
+}
+
+// deduplicateLayers keeps only the newest file of every path, the layers go from the oldest to the newest.
+// The files stored with different compression in different layers are the same path too.
+func deduplicateLayers(layers [][]internal.ReaderMaker) []internal.ReaderMaker {
+	seenPaths := make(map[string]bool)
+	var files []internal.ReaderMaker
+	for i := len(layers) - 1; i >= 0; i-- {
+		for _, file := range layers[i] {
+			filePath := trimCompressionExtension(file.Path())
+			if seenPaths[filePath] {
+				continue
+			}
+			seenPaths[filePath] = true
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// filterManifestFiles drops the files of the prior backups which were removed before the restored backup was made
+func filterManifestFiles(files []internal.ReaderMaker, manifestFiles map[string]ManifestFile) []internal.ReaderMaker {
+	filtered := make([]internal.ReaderMaker, 0, len(files))
+	for _, file := range files {
+		if _, ok := manifestFiles[path.Join(BackupDataDirectory, trimCompressionExtension(file.Path()))]; ok {
+			filtered = append(filtered, file)
+		}
+	}
+	return filtered
+}
+
+// trimCompressionExtension cuts the extension of the compressed repository files only,
+// e.g. the relation segments like base/1/16384.1 keep their numbers
+func trimCompressionExtension(filePath string) string {
+	if compression.FindDecompressor(utility.GetFileExtension(filePath)) == nil {
+		return filePath
+	}
+	return utility.TrimFileExtension(filePath)
+}
+
+// getFilesToUnwrap returns the names the files are extracted under. The nested compressed files,
+// e.g. base/1/16384.gz.gz, are decompressed by the interpreter and extracted without the inner extension too.
+func getFilesToUnwrap(files []internal.ReaderMaker, decompressNested bool) map[string]bool {
 	filesToUnwrap := make(map[string]bool)
 	for _, file := range files {
-		filesToUnwrap[utility.TrimFileExtension(file.Path())] = true
+		name := utility.TrimFileExtension(file.Path())
+		filesToUnwrap[name] = true
+		if decompressNested {
+			filesToUnwrap[trimCompressionExtension(name)] = true
+		}
 	}
 	return filesToUnwrap
 }
 
 func createDirectories(backupDetails *BackupDetails, dbDataDirectory string) error {
-	for _, directoryPath := range backupDetails.DirectoryPaths {
+	concurrency, err := internal.GetMaxDownloadConcurrency()
+	if err != nil {
+		return err
+	}
+	return createDirectoriesConcurrently(backupDetails.DirectoryPaths, os.FileMode(backupDetails.DefaultDirectoryMode),
+		dbDataDirectory, concurrency)
+}
+
+// createDirectoriesConcurrently creates the directories level by level: the directories of the same depth
+// are created by the concurrent workers, and the deeper ones only after that, so the parents always exist
+// before their children. It matters on the network filesystems where every mkdir is slow.
+func createDirectoriesConcurrently(directoryPaths []string, mode os.FileMode, dbDataDirectory string,
+	concurrency int) error {
+	levels := make(map[int][]string)
+	for _, directoryPath := range directoryPaths {
 		relativeDirectory, err := filepath.Rel(BackupDataDirectory, directoryPath)
 		if err != nil {
 			return err
 		}
-		err = os.MkdirAll(filepath.Join(dbDataDirectory, relativeDirectory), os.FileMode(backupDetails.DefaultDirectoryMode))
-		if err != nil {
+		depth := strings.Count(filepath.ToSlash(relativeDirectory), "/")
+		levels[depth] = append(levels[depth], filepath.Join(dbDataDirectory, relativeDirectory))
+	}
+	depths := make([]int, 0, len(levels))
+	for depth := range levels {
+		depths = append(depths, depth)
+	}
+	sort.Ints(depths)
+
+	for _, depth := range depths {
+		if err := createDirectoriesLevel(levels[depth], mode, concurrency); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func getFilesRecursively(folder storage.Folder, backupFilesFolder storage.Folder, fileMode int) (files []internal.ReaderMaker, err error) {
-	objects, subfolders, err := folder.ListFolder()
-	if err != nil {
-		return nil, err
+func createDirectoriesLevel(directories []string, mode os.FileMode, concurrency int) error {
+	if concurrency > len(directories) {
+		concurrency = len(directories)
 	}
-
-	for _, object := range objects {
-		relativePath, err := filepath.Rel(backupFilesFolder.GetPath(), folder.GetPath())
-		if err != nil {
-			return nil, err
-		}
-		filePath := path.Join(relativePath, object.GetName())
-		file := internal.NewRegularFileStorageReaderMarker(backupFilesFolder, filePath, fileMode)
-		files = append(files, file)
+	group, ctx := errgroup.WithContext(context.Background())
+	directoriesToCreate := make(chan string)
+	for i := 0; i < concurrency; i++ {
+		group.Go(func() error {
+			for directory := range directoriesToCreate {
+				if err := os.MkdirAll(directory, mode); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
 	}
-
-	for _, subfolder := range subfolders {
-		subfolderFiles, err := getFilesRecursively(subfolder, backupFilesFolder, fileMode)
-		if err != nil {
-			return nil, err
+	group.Go(func() error {
+		defer close(directoriesToCreate)
+		for _, directory := range directories {
+			select {
+			case directoriesToCreate <- directory:
+			case <-ctx.Done():
+				return nil
+			}
 		}
-		files = append(files, subfolderFiles...)
+		return nil
+	})
+	return group.Wait()
+}
+
+// relativeFolderPath compares the storage paths as slash separated strings, the OS path functions
+// don't suit them, and the paths of some storages, e.g. SFTP, have no trailing delimiter
+func relativeFolderPath(root storage.Folder, folder storage.Folder) (string, error) {
+	rootPath := storage.AddDelimiterToPath(root.GetPath())
+	folderPath := storage.AddDelimiterToPath(folder.GetPath())
+	if !strings.HasPrefix(folderPath, rootPath) {
+		return "", fmt.Errorf("folder '%s' is not inside '%s'", folder.GetPath(), root.GetPath())
 	}
-	return files, err
+	return strings.TrimPrefix(folderPath, rootPath), nil
 }
@@ -0,0 +1,256 @@
+package pgbackrest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+// makeDirectoryPaths returns the manifest paths of the synthetic tree with the given fanout and depth,
+// listed in the random order relative to the parents
+func makeDirectoryPaths(fanout int, depth int) []string {
+	paths := []string{BackupDataDirectory}
+	level := []string{BackupDataDirectory}
+	for i := 0; i < depth; i++ {
+		var nextLevel []string
+		for _, parent := range level {
+			for j := 0; j < fanout; j++ {
+				nextLevel = append(nextLevel, fmt.Sprintf("%s/dir%d", parent, j))
+			}
+		}
+		paths = append(nextLevel, paths...)
+		level = nextLevel
+	}
+	return paths
+}
+
+func TestCreateDirectoriesConcurrently(t *testing.T) {
+	destination, err := ioutil.TempDir("", "pgbackrest_directories")
+	assert.NoError(t, err)
+	defer os.RemoveAll(destination)
+
+	paths := makeDirectoryPaths(3, 4)
+	assert.NoError(t, createDirectoriesConcurrently(paths, 0700, destination, 8))
+
+	for _, directoryPath := range paths {
+		relativeDirectory, err := filepath.Rel(BackupDataDirectory, directoryPath)
+		assert.NoError(t, err)
+		info, err := os.Stat(filepath.Join(destination, relativeDirectory))
+		assert.NoError(t, err)
+		assert.True(t, info.IsDir())
+		assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+	}
+}
+
+func BenchmarkCreateDirectories(b *testing.B) {
+	paths := makeDirectoryPaths(6, 5)
+	for _, concurrency := range []int{1, 16} {
+		b.Run(fmt.Sprintf("concurrency_%d", concurrency), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				destination, err := ioutil.TempDir("", "pgbackrest_directories")
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err = createDirectoriesConcurrently(paths, 0700, destination, concurrency); err != nil {
+					b.Fatal(err)
+				}
+				b.StopTimer()
+				os.RemoveAll(destination)
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+func TestDeduplicateLayers(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	stanzaFolder := folder.GetSubFolder(BackupFolderName).GetSubFolder(testStanza)
+	layerContents := []map[string]string{
+		// full backup
+		{"PG_VERSION.gz": "14", "base/1/1259.gz": "old pg_class", "base/1/16384.1.gz": "dropped table"},
+		// incremental backup copies only the changed files
+		{"base/1/1259.gz": "new pg_class", "base/1/16385": "uncompressed"},
+	}
+	var layers [][]internal.ReaderMaker
+	for i, contents := range layerContents {
+		layerFolder := stanzaFolder.GetSubFolder(fmt.Sprintf("layer%d", i)).GetSubFolder(BackupDataDirectory)
+		for name, content := range contents {
+			assert.NoError(t, layerFolder.PutObject(name, strings.NewReader(content)))
+		}
+		files, err := newFilesLister(true, 1).getFiles(layerFolder, layerFolder, 0600)
+		assert.NoError(t, err)
+		layers = append(layers, files)
+	}
+
+	files := filterManifestFiles(deduplicateLayers(layers), map[string]ManifestFile{
+		"pg_data/PG_VERSION":   {},
+		"pg_data/base/1/1259":  {},
+		"pg_data/base/1/16385": {},
+	})
+
+	contents := make(map[string]string)
+	for _, file := range files {
+		reader, err := file.Reader()
+		assert.NoError(t, err)
+		content, err := ioutil.ReadAll(reader)
+		assert.NoError(t, err)
+		_, duplicate := contents[file.Path()]
+		assert.False(t, duplicate, file.Path())
+		contents[file.Path()] = string(content)
+	}
+	assert.Equal(t, map[string]string{
+		"PG_VERSION.gz":  "14",
+		"base/1/1259.gz": "new pg_class",
+		"base/1/16385":   "uncompressed",
+	}, contents)
+}
+
+func TestGetFilesToUnwrap(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	for _, name := range []string{"PG_VERSION.gz", "base/1/16384.gz.gz", "base/1/16385.1"} {
+		assert.NoError(t, folder.PutObject(name, strings.NewReader("")))
+	}
+	files, err := newFilesLister(true, 1).getFiles(folder, folder, 0600)
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]bool{"PG_VERSION": true, "base/1/16384.gz": true, "base/1/16385": true},
+		getFilesToUnwrap(files, false))
+	assert.Equal(t, map[string]bool{"PG_VERSION": true, "base/1/16384.gz": true, "base/1/16384": true,
+		"base/1/16385": true}, getFilesToUnwrap(files, true))
+}
+
+// testChainBackup is the backup of the test chain: its manifest files with their references
+// and the objects stored in its folder, gzipped like pgbackrest does by default
+type testChainBackup struct {
+	name       string
+	backupType string
+	references map[string]string
+	objects    map[string]string
+}
+
+// putFlattenTestChain uploads the full+diff+incr chain made with repo-hardlink: the incr backup
+// stores the hardlinks of all the files it references besides its own ones
+func putFlattenTestChain(t *testing.T, chain []testChainBackup) storage.Folder {
+	folder := putTestBackupChain(t)
+	stanzaFolder := folder.GetSubFolder(BackupPath).GetSubFolder(testStanza)
+	for _, backup := range chain {
+		var manifest strings.Builder
+		fmt.Fprintf(&manifest, "[backup]\nbackup-label=\"%s\"\nbackup-lsn-start=\"0/1000000\"\n"+
+			"backup-lsn-stop=\"0/2000000\"\nbackup-type=\"%s\"\n\n"+
+			"[backup:db]\ndb-version=\"11\"\n\n"+
+			"[target:file]\n", backup.name, backup.backupType)
+		for manifestPath, reference := range backup.references {
+			if reference == "" {
+				fmt.Fprintf(&manifest, "%s={\"size\":1}\n", manifestPath)
+			} else {
+				fmt.Fprintf(&manifest, "%s={\"reference\":\"%s\",\"size\":1}\n", manifestPath, reference)
+			}
+		}
+		manifest.WriteString("\n[target:file:default]\nmode=\"0600\"\n\n" +
+			"[target:path]\npg_data={}\npg_data/base={}\npg_data/base/1={}\npg_data/global={}\n\n" +
+			"[target:path:default]\nmode=\"0700\"\n")
+		backupFolder := stanzaFolder.GetSubFolder(backup.name)
+		require.NoError(t, backupFolder.PutObject(BackupManifestIni, strings.NewReader(manifest.String())))
+		for name, content := range backup.objects {
+			require.NoError(t, backupFolder.GetSubFolder(BackupDataDirectory).PutObject(name+".gz", gzipped(t, content)))
+		}
+	}
+	return folder
+}
+
+func makeFlattenTestChain() []testChainBackup {
+	return []testChainBackup{
+		{testFullBackup, FullBackupType,
+			map[string]string{"pg_data/PG_VERSION": "", "pg_data/base/1/1259": "", "pg_data/base/1/16384": "",
+				"pg_data/global/pg_control": ""},
+			map[string]string{"PG_VERSION": "14", "base/1/1259": "pg_class v1", "base/1/16384": "dropped table",
+				"global/pg_control": "control v1"}},
+		{testDiffBackup, DiffBackupType,
+			map[string]string{"pg_data/PG_VERSION": testFullBackup, "pg_data/base/1/1259": "",
+				"pg_data/base/1/16385": "", "pg_data/global/pg_control": ""},
+			map[string]string{"base/1/1259": "pg_class v2", "base/1/16385": "new table",
+				"global/pg_control": "control v2"}},
+		{testIncrBackup, IncrBackupType,
+			map[string]string{"pg_data/PG_VERSION": testFullBackup, "pg_data/base/1/1259": testDiffBackup,
+				"pg_data/base/1/16385": testDiffBackup, "pg_data/global/pg_control": ""},
+			map[string]string{"PG_VERSION": "14", "base/1/1259": "pg_class v2", "base/1/16385": "new table",
+				"global/pg_control": "control v3"}},
+	}
+}
+
+func readRestoredFiles(t *testing.T, destination string) map[string]string {
+	contents := make(map[string]string)
+	err := filepath.Walk(destination, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		content, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(destination, filePath)
+		contents[filepath.ToSlash(relativePath)] = string(content)
+		return err
+	})
+	require.NoError(t, err)
+	return contents
+}
+
+func TestHandlePgbackrestBackupFetch_flatten(t *testing.T) {
+	folder := putFlattenTestChain(t, makeFlattenTestChain())
+
+	// the files pgbackrest restore writes: every manifest file from the backup its reference names
+	expected := map[string]map[string]string{
+		testFullBackup: {"PG_VERSION": "14", "base/1/1259": "pg_class v1", "base/1/16384": "dropped table",
+			"global/pg_control": "control v1"},
+		testDiffBackup: {"PG_VERSION": "14", "base/1/1259": "pg_class v2", "base/1/16385": "new table",
+			"global/pg_control": "control v2"},
+		testIncrBackup: {"PG_VERSION": "14", "base/1/1259": "pg_class v2", "base/1/16385": "new table",
+			"global/pg_control": "control v3"},
+	}
+	for backupName, expectedFiles := range expected {
+		destination := t.TempDir()
+		err := HandlePgbackrestBackupFetch(folder, testStanza, destination, namedBackupSelector(backupName),
+			FetchOptions{StrictListing: true, Flatten: true})
+		require.NoError(t, err, backupName)
+		assert.Equal(t, expectedFiles, readRestoredFiles(t, destination), backupName)
+
+		layeredDestination := t.TempDir()
+		err = HandlePgbackrestBackupFetch(folder, testStanza, layeredDestination, namedBackupSelector(backupName),
+			FetchOptions{StrictListing: true})
+		require.NoError(t, err, backupName)
+		assert.Equal(t, expectedFiles, readRestoredFiles(t, layeredDestination), backupName)
+	}
+}
+
+func TestHandlePgbackrestBackupFetch_flattenMissingReferencedFile(t *testing.T) {
+	chain := makeFlattenTestChain()
+	delete(chain[1].objects, "base/1/16385")
+	folder := putFlattenTestChain(t, chain)
+
+	err := HandlePgbackrestBackupFetch(folder, testStanza, t.TempDir(), namedBackupSelector(testIncrBackup),
+		FetchOptions{StrictListing: true, Flatten: true})
+	assert.EqualError(t, err, "file 'pg_data/base/1/16385' of backup '"+testIncrBackup+
+		"' is missing in backup '"+testDiffBackup+"'")
+}
+
+func TestHandlePgbackrestBackupFetch_recoveryConfigCheckedFirst(t *testing.T) {
+	folder := putFlattenTestChain(t, makeFlattenTestChain())
+
+	// PostgreSQL 11 of the backup is configured by recovery.conf, so nothing is restored
+	destination := t.TempDir()
+	err := HandlePgbackrestBackupFetch(folder, testStanza, destination, namedBackupSelector(testFullBackup),
+		FetchOptions{StrictListing: true, RecoveryConfig: RecoveryConfig{Standby: true}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "recovery.conf")
+	assert.Empty(t, readRestoredFiles(t, destination))
+}
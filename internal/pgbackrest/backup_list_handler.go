@@ -7,68 +7,170 @@ import (
 	"sort"
 	"text/tabwriter"
 
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/pkg/errors"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal"
 	"github.com/wal-g/wal-g/pkg/storages/storage"
 )
 
-func HandleBackupList(folder storage.Folder, stanza string, detailed bool, pretty bool, json bool) error {
-	backupTimes, err := GetBackupList(folder, stanza)
+type UnknownBackupTypeError struct {
+	error
+}
 
-	if len(backupTimes) == 0 {
-		tracelog.InfoLogger.Println("No backups found")
-		return nil
+func newUnknownBackupTypeError(backupType string) UnknownBackupTypeError {
+	return UnknownBackupTypeError{errors.Errorf("unknown backup type '%s', expected one of: %s, %s, %s",
+		backupType, FullBackupType, DiffBackupType, IncrBackupType)}
+}
+
+func (err UnknownBackupTypeError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// HandleBackupList prints the backups of the backupType, or all of them if it is empty, the newest first.
+// With includeHistory the backups of backup:history, pending expiration, are listed as well and marked so,
+// backup.info without the section fails the listing with NoBackupHistoryError.
+func HandleBackupList(folder storage.Folder, stanza string, backupType string, includeHistory bool,
+	detailed bool, pretty bool, json bool) error {
+	switch backupType {
+	case "", FullBackupType, DiffBackupType, IncrBackupType:
+	default:
+		return newUnknownBackupTypeError(backupType)
 	}
 
+	backupTimes, err := GetBackupList(folder, stanza)
 	if err != nil {
 		return err
 	}
+	if includeHistory {
+		historyTimes, err := GetBackupHistoryList(folder, stanza)
+		if err != nil {
+			return err
+		}
+		backupTimes = append(backupTimes, historyTimes...)
+	}
+	backupTimes = filterBackupsByType(backupTimes, backupType)
+	if len(backupTimes) == 0 {
+		tracelog.InfoLogger.Println("No backups found")
+		return nil
+	}
 
 	sort.Slice(backupTimes, func(i, j int) bool {
-		return backupTimes[i].Time.Before(backupTimes[j].Time)
+		return backupTimes[i].Time.After(backupTimes[j].Time)
 	})
 
 	if detailed {
+		backupsSettings, err := LoadBackupsSettings(folder, stanza)
+		if err != nil {
+			return err
+		}
+		if includeHistory {
+			historySettings, err := LoadBackupsHistorySettings(folder, stanza)
+			if err != nil {
+				return err
+			}
+			backupsSettings = append(backupsSettings, historySettings...)
+		}
 		var backupDetails []BackupDetails
 		for _, backupTime := range backupTimes {
-			details, err := GetBackupDetails(folder, stanza, backupTime.BackupName)
+			details, err := getBackupDetails(folder, stanza, backupTime.BackupName, backupsSettings)
 			if err != nil {
 				return err
 			}
+			details.History = backupTime.History
 			backupDetails = append(backupDetails, *details)
 		}
 
-		return printBackupListDetailed(backupDetails, pretty, json)
+		return printBackupListDetailed(backupDetails, includeHistory, pretty, json)
 	}
-	return printBackupList(backupTimes, pretty, json)
+	return printBackupList(backupTimes, includeHistory, pretty, json)
 }
 
-func printBackupList(backups []internal.BackupTime, pretty bool, json bool) error {
+func filterBackupsByType(backupTimes []BackupTimeWithType, backupType string) []BackupTimeWithType {
+	if backupType == "" {
+		return backupTimes
+	}
+	var filtered []BackupTimeWithType
+	for _, backupTime := range backupTimes {
+		if backupTime.Type == backupType {
+			filtered = append(filtered, backupTime)
+		}
+	}
+	return filtered
+}
+
+func printBackupList(backups []BackupTimeWithType, includeHistory bool, pretty bool, json bool) error {
 	switch {
 	case json:
 		return internal.WriteAsJSON(backups, os.Stdout, pretty)
 	case pretty:
-		internal.WritePrettyBackupList(backups, os.Stdout)
+		writePrettyBackupList(backups, includeHistory, os.Stdout)
 		return nil
 	default:
-		internal.WriteBackupList(backups, os.Stdout)
-		return nil
+		return writeBackupTimeList(backups, includeHistory, os.Stdout)
+	}
+}
+
+// writeBackupTimeList prints the history column only if the history backups are listed,
+// so the output stays the same without them
+func writeBackupTimeList(backups []BackupTimeWithType, includeHistory bool, output io.Writer) error {
+	writer := tabwriter.NewWriter(output, 0, 0, 1, ' ', 0)
+	header := "name\tmodified\twal_segment_backup_start\ttype"
+	if includeHistory {
+		header += "\thistory"
+	}
+	_, err := fmt.Fprintln(writer, header)
+	if err != nil {
+		return err
+	}
+	for _, b := range backups {
+		row := fmt.Sprintf("%v\t%v\t%v\t%v", b.BackupName, internal.FormatTime(b.Time), b.WalFileName, b.Type)
+		if includeHistory {
+			row += fmt.Sprintf("\t%v", b.History)
+		}
+		_, err = fmt.Fprintln(writer, row)
+		if err != nil {
+			return err
+		}
 	}
+	return writer.Flush()
 }
 
-func printBackupListDetailed(backupDetails []BackupDetails, pretty bool, json bool) error {
+func writePrettyBackupList(backups []BackupTimeWithType, includeHistory bool, output io.Writer) {
+	writer := table.NewWriter()
+	writer.SetOutputMirror(output)
+	defer writer.Render()
+	header := table.Row{"#", "Name", "Modified", "WAL segment backup start", "Type"}
+	if includeHistory {
+		header = append(header, "History")
+	}
+	writer.AppendHeader(header)
+	for i, b := range backups {
+		row := table.Row{i, b.BackupName, internal.PrettyFormatTime(b.Time), b.WalFileName, b.Type}
+		if includeHistory {
+			row = append(row, b.History)
+		}
+		writer.AppendRow(row)
+	}
+}
+
+func printBackupListDetailed(backupDetails []BackupDetails, includeHistory bool, pretty bool, json bool) error {
 	switch {
 	case json:
 		return internal.WriteAsJSON(backupDetails, os.Stdout, pretty)
 	default:
-		return writeBackupList(backupDetails, os.Stdout)
+		return writeBackupList(backupDetails, includeHistory, os.Stdout)
 	}
 }
 
-func writeBackupList(backupDetails []BackupDetails, output io.Writer) error {
+func writeBackupList(backupDetails []BackupDetails, includeHistory bool, output io.Writer) error {
 	writer := tabwriter.NewWriter(output, 0, 0, 1, ' ', 0)
 	// nolint:lll
-	_, err := fmt.Fprintln(writer, "name\tmodified\twal_segment_backup_start\ttype\tstart_time\tfinish_time\tpg_version\tstart_lsn\tfinish_lsn")
+	header := "name\tmodified\twal_segment_backup_start\ttype\tstart_time\tfinish_time\tpg_version\tstart_lsn\tfinish_lsn"
+	if includeHistory {
+		header += "\thistory"
+	}
+	_, err := fmt.Fprintln(writer, header)
 	if err != nil {
 		return err
 	}
@@ -76,8 +178,11 @@ func writeBackupList(backupDetails []BackupDetails, output io.Writer) error {
 	for i := 0; i < len(backupDetails); i++ {
 		b := backupDetails[i]
 		// nolint:lll
-		_, err = fmt.Fprintf(writer, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t\n", b.BackupName, internal.FormatTime(b.ModifiedTime), b.WalFileName, b.Type, internal.FormatTime(b.StartTime), internal.FormatTime(b.FinishTime), b.PgVersion, b.StartLsn, b.FinishLsn)
-
+		row := fmt.Sprintf("%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t", b.BackupName, internal.FormatTime(b.ModifiedTime), b.WalFileName, b.Type, internal.FormatTime(b.StartTime), internal.FormatTime(b.FinishTime), b.PgVersion, b.StartLsn, b.FinishLsn)
+		if includeHistory {
+			row += fmt.Sprintf("%v\t", b.History)
+		}
+		_, err = fmt.Fprintln(writer, row)
 		if err != nil {
 			return err
 		}
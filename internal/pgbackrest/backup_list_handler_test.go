@@ -0,0 +1,137 @@
+package pgbackrest
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+)
+
+func TestFilterBackupsByType(t *testing.T) {
+	backups := []BackupTimeWithType{
+		{BackupTime: internal.BackupTime{BackupName: "20220101-000000F"}, Type: FullBackupType},
+		{BackupTime: internal.BackupTime{BackupName: "20220101-000000F_20220102-000000D"}, Type: DiffBackupType},
+		{BackupTime: internal.BackupTime{BackupName: "20220101-000000F_20220103-000000I"}, Type: IncrBackupType},
+		{BackupTime: internal.BackupTime{BackupName: "20220104-000000F"}, Type: FullBackupType},
+	}
+
+	assert.Len(t, filterBackupsByType(backups, ""), 4)
+	full := filterBackupsByType(backups, FullBackupType)
+	assert.Equal(t, []BackupTimeWithType{backups[0], backups[3]}, full)
+	assert.Empty(t, filterBackupsByType(backups[:1], IncrBackupType))
+
+	// the JSON keeps the BackupTime fields next to the type
+	marshalled, err := json.Marshal(backups[1])
+	assert.NoError(t, err)
+	assert.Contains(t, string(marshalled), `"backup_name":"20220101-000000F_20220102-000000D"`)
+	assert.Contains(t, string(marshalled), `"type":"diff"`)
+}
+
+func TestHandleBackupList_unknownType(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	err := HandleBackupList(folder, testStanza, "differential", false, false, false, false)
+	assert.IsType(t, UnknownBackupTypeError{}, err)
+}
+
+// testCurrentBackupInfo is laid out like backup.info written by pgbackrest 2.36, without the checksum
+const testCurrentBackupInfo = "[backrest]\n" +
+	"backrest-format=5\n" +
+	`backrest-version="2.36"` + "\n" +
+	"\n" +
+	"[backup:current]\n" +
+	`20220104-000000F={"backrest-format":5,"backrest-version":"2.36","backup-archive-start":"000000010000000000000004",` +
+	`"backup-archive-stop":"000000010000000000000004","backup-info-repo-size":2369186,` +
+	`"backup-info-repo-size-delta":2369186,"backup-info-size":25168133,"backup-info-size-delta":25168133,` +
+	`"backup-timestamp-start":1641254390,"backup-timestamp-stop":1641254400,"backup-type":"full","db-id":1,` +
+	`"option-archive-check":true,"option-archive-copy":false,"option-backup-standby":false,` +
+	`"option-checksum-page":true,"option-compress":true,"option-hardlink":false,"option-online":true}` + "\n" +
+	"\n" +
+	"[db]\n" +
+	"db-catalog-version=202007201\n" +
+	"db-control-version=1300\n" +
+	"db-id=1\n" +
+	"db-system-id=7050224395741233435\n" +
+	`db-version="13"` + "\n" +
+	"\n" +
+	"[db:history]\n" +
+	`1={"db-catalog-version":202007201,"db-control-version":1300,"db-system-id":7050224395741233435,` +
+	`"db-version":"13"}` + "\n"
+
+// testBackupInfoWithHistory adds backup:history, which pgbackrest doesn't write, to testCurrentBackupInfo
+const testBackupInfoWithHistory = testCurrentBackupInfo + "\n" +
+	"[backup:history]\n" +
+	`20220101-000000F={"backup-type":"full","backup-timestamp-stop":1640995200}` + "\n" +
+	`20220101-000000F_20220102-000000I={"backup-type":"incr","backup-timestamp-stop":1641081600}` + "\n"
+
+func putTestBackupInfo(t *testing.T, backupInfo string) *memory.Folder {
+	folder := memory.NewFolder("", memory.NewStorage())
+	require.NoError(t, folder.GetSubFolder(BackupPath).GetSubFolder(testStanza).PutObject(BackupInfoIni,
+		strings.NewReader(backupInfo)))
+	return folder
+}
+
+func TestGetBackupList_currentOnly(t *testing.T) {
+	folder := putTestBackupInfo(t, testBackupInfoWithHistory)
+
+	backups, err := GetBackupList(folder, testStanza)
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+	assert.Equal(t, "20220104-000000F", backups[0].BackupName)
+	assert.False(t, backups[0].History)
+}
+
+func TestGetBackupHistoryList(t *testing.T) {
+	folder := putTestBackupInfo(t, testBackupInfoWithHistory)
+
+	backups, err := GetBackupHistoryList(folder, testStanza)
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	assert.Equal(t, "20220101-000000F", backups[0].BackupName)
+	assert.Equal(t, "20220101-000000F_20220102-000000I", backups[1].BackupName)
+	assert.Equal(t, IncrBackupType, backups[1].Type)
+	for _, backup := range backups {
+		assert.True(t, backup.History)
+	}
+
+	// pgbackrest keeps no history in backup.info
+	folder = putTestBackupInfo(t, testCurrentBackupInfo)
+	_, err = GetBackupHistoryList(folder, testStanza)
+	assert.IsType(t, NoBackupHistoryError{}, err)
+}
+
+func TestHandleBackupList_noHistory(t *testing.T) {
+	folder := putTestBackupInfo(t, testCurrentBackupInfo)
+
+	assert.NoError(t, HandleBackupList(folder, testStanza, "", false, false, false, false))
+	err := HandleBackupList(folder, testStanza, "", true, false, false, false)
+	assert.IsType(t, NoBackupHistoryError{}, err)
+}
+
+func TestWriteBackupTimeList_history(t *testing.T) {
+	backups := []BackupTimeWithType{
+		{BackupTime: internal.BackupTime{BackupName: "20220104-000000F"}, Type: FullBackupType},
+		{BackupTime: internal.BackupTime{BackupName: "20220101-000000F"}, Type: FullBackupType, History: true},
+	}
+
+	var output bytes.Buffer
+	require.NoError(t, writeBackupTimeList(backups, true, &output))
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.True(t, strings.HasSuffix(lines[0], "history"))
+	assert.True(t, strings.HasSuffix(lines[1], "false"))
+	assert.True(t, strings.HasSuffix(lines[2], "true"))
+
+	output.Reset()
+	require.NoError(t, writeBackupTimeList(backups[:1], false, &output))
+	assert.NotContains(t, output.String(), "history")
+
+	// the history backups are marked in the JSON only
+	marshalled, err := json.Marshal(backups)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(marshalled), `"history":true`))
+}
@@ -0,0 +1,95 @@
+package pgbackrest
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+// HandleBackupShow prints the details of the selected backup including its annotations
+func HandleBackupShow(folder storage.Folder, stanza string, backupSelector internal.BackupSelector,
+	json bool, output io.Writer) error {
+	backupName, err := backupSelector.Select(folder)
+	if err != nil {
+		return err
+	}
+	backupsSettings, err := LoadBackupsSettings(folder, stanza)
+	if err != nil {
+		return err
+	}
+	backupDetails, err := getBackupDetails(folder, stanza, backupName, backupsSettings)
+	if err != nil {
+		return err
+	}
+	chain, err := GetBackupChain(backupsSettings, backupName)
+	if err != nil {
+		return err
+	}
+
+	if json {
+		return internal.WriteAsJSON(backupShowOutput{backupDetails, chain}, output, true)
+	}
+	return writeBackupDetails(backupDetails, chain, output)
+}
+
+// backupShowOutput is the JSON of backup-show, the chain lists the backup and its prior backups up to the full one
+type backupShowOutput struct {
+	*BackupDetails
+	Chain []string
+}
+
+type backupDetailsField struct {
+	name  string
+	value interface{}
+}
+
+func writeBackupDetails(b *BackupDetails, chain []string, output io.Writer) error {
+	writer := tabwriter.NewWriter(output, 0, 0, 1, ' ', 0)
+	fields := []backupDetailsField{
+		{"name", b.BackupName},
+		{"modified", internal.FormatTime(b.ModifiedTime)},
+		{"wal_segment_backup_start", b.WalFileName},
+		{"type", b.Type},
+		{"start_time", internal.FormatTime(b.StartTime)},
+		{"finish_time", internal.FormatTime(b.FinishTime)},
+		{"pg_version", b.PgVersion},
+		{"start_lsn", b.StartLsn},
+		{"finish_lsn", b.FinishLsn},
+		{"system_identifier", b.SystemIdentifier},
+	}
+	if b.Prior != "" {
+		fields = append(fields,
+			backupDetailsField{"prior", b.Prior},
+			backupDetailsField{"references", strings.Join(b.References, ", ")})
+	}
+	// the full backup is its own chain
+	fields = append(fields, backupDetailsField{"chain", strings.Join(chain, " <- ")})
+	for _, field := range fields {
+		if _, err := fmt.Fprintf(writer, "%s:\t%v\n", field.name, field.value); err != nil {
+			return err
+		}
+	}
+
+	if len(b.Annotation) > 0 {
+		if _, err := fmt.Fprintln(writer, "annotation:"); err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(b.Annotation))
+		for key := range b.Annotation {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if _, err := fmt.Fprintf(writer, "  %s:\t%s\n", key, b.Annotation[key]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return writer.Flush()
+}
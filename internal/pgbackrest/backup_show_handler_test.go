@@ -0,0 +1,88 @@
+package pgbackrest
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+const (
+	testFullBackup = "20220101-000000F"
+	testDiffBackup = "20220101-000000F_20220102-000000D"
+	testIncrBackup = "20220101-000000F_20220103-000000I"
+)
+
+// putTestBackupChain uploads the full backup with the diff backup based on it and the incr backup based on the diff
+func putTestBackupChain(t *testing.T) storage.Folder {
+	folder := putTestBackups(t, map[string]string{testFullBackup: "0/3000000", testDiffBackup: "0/5000000", testIncrBackup: "0/7000000"})
+	backupInfo := "[backup:current]\n" +
+		testFullBackup + `={"backup-type":"full","backup-prior":null,"backup-reference":null}` + "\n" +
+		testDiffBackup + `={"backup-type":"diff","backup-prior":"` + testFullBackup +
+		`","backup-reference":["` + testFullBackup + `"]}` + "\n" +
+		testIncrBackup + `={"backup-type":"incr","backup-prior":"` + testDiffBackup +
+		`","backup-reference":["` + testFullBackup + `","` + testDiffBackup + `"]}` + "\n"
+	stanzaFolder := folder.GetSubFolder(BackupPath).GetSubFolder(testStanza)
+	require.NoError(t, stanzaFolder.PutObject(BackupInfoIni, strings.NewReader(backupInfo)))
+	return folder
+}
+
+type namedBackupSelector string
+
+func (selector namedBackupSelector) Select(storage.Folder) (string, error) {
+	return string(selector), nil
+}
+
+func TestHandleBackupShow_chain(t *testing.T) {
+	folder := putTestBackupChain(t)
+
+	output := new(bytes.Buffer)
+	require.NoError(t, HandleBackupShow(folder, testStanza, namedBackupSelector(testIncrBackup), false, output))
+	assert.Contains(t, output.String(), "prior:                    "+testDiffBackup+"\n")
+	assert.Contains(t, output.String(), "references:               "+testFullBackup+", "+testDiffBackup+"\n")
+	assert.Contains(t, output.String(), "chain:                    "+testIncrBackup+" <- "+testDiffBackup+" <- "+testFullBackup+"\n")
+
+	output.Reset()
+	require.NoError(t, HandleBackupShow(folder, testStanza, namedBackupSelector(testFullBackup), false, output))
+	assert.NotContains(t, output.String(), "prior:")
+	assert.Contains(t, output.String(), "chain:                    "+testFullBackup+"\n")
+
+	output.Reset()
+	require.NoError(t, HandleBackupShow(folder, testStanza, namedBackupSelector(testDiffBackup), true, output))
+	var shown struct {
+		Prior      string
+		References []string
+		Chain      []string
+	}
+	require.NoError(t, json.Unmarshal(output.Bytes(), &shown))
+	assert.Equal(t, testFullBackup, shown.Prior)
+	assert.Equal(t, []string{testFullBackup}, shown.References)
+	assert.Equal(t, []string{testDiffBackup, testFullBackup}, shown.Chain)
+}
+
+func TestGetBackupChain_missingPrior(t *testing.T) {
+	backupsSettings := []BackupSettings{{Name: testIncrBackup, BackupPrior: testDiffBackup}}
+	_, err := GetBackupChain(backupsSettings, testIncrBackup)
+	assert.IsType(t, BrokenBackupChainError{}, err)
+	assert.Contains(t, err.Error(), testDiffBackup)
+
+	_, err = GetBackupChain(backupsSettings, testFullBackup)
+	assert.Error(t, err)
+}
+
+func TestHandleBackupShow_annotation(t *testing.T) {
+	folder := putTestBackups(t, map[string]string{testFullBackup: "0/3000000"})
+	manifest := "[backup]\nbackup-label=\"" + testFullBackup + "\"\nbackup-lsn-start=\"0/1000000\"\n" +
+		"backup-lsn-stop=\"0/3000000\"\n\n[metadata]\nannotation={\"source\":\"nightly\",\"ticket\":\"DB-42\"}\n\n" +
+		"[target:file:default]\nmode=\"0600\"\n\n[target:path:default]\nmode=\"0700\"\n"
+	backupFolder := folder.GetSubFolder(BackupPath).GetSubFolder(testStanza).GetSubFolder(testFullBackup)
+	require.NoError(t, backupFolder.PutObject(BackupManifestIni, strings.NewReader(manifest)))
+
+	output := new(bytes.Buffer)
+	require.NoError(t, HandleBackupShow(folder, testStanza, namedBackupSelector(testFullBackup), false, output))
+	assert.Contains(t, output.String(), "annotation:\n  source: nightly\n  ticket: DB-42\n")
+}
@@ -0,0 +1,167 @@
+package pgbackrest
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+)
+
+const (
+	// PostmasterPidFile exists in the data directory while the cluster is running
+	PostmasterPidFile = "postmaster.pid"
+	// PgVersionFile and RestoreManifestFile tell the data directory, pgbackrest keeps the backup manifest
+	// in the data directory while it restores
+	PgVersionFile       = "PG_VERSION"
+	RestoreManifestFile = "backup.manifest"
+)
+
+// deltaRestore is the state of the data directory restored over by the delta restore,
+// like the pgbackrest restore --delta does
+type deltaRestore struct {
+	// unchanged are the manifest paths of the files which already match the backup
+	unchanged map[string]bool
+	// stale are the paths of the files and the directories the backup doesn't have,
+	// they are removed once the backup is restored
+	stale []string
+}
+
+// prepareDeltaRestore finds the files and the directories of dbDataDirectory which the backup doesn't have
+// and the files which match the manifest by the size and the SHA-1, so they aren't fetched again.
+// The symlinks, e.g. pg_wal moved to another disk, are left as they are. Only the data directory,
+// which has PG_VERSION or the manifest of the interrupted pgbackrest restore, is restored over,
+// so the mistyped destination isn't wiped, and nothing is removed until the backup is restored, see removeStale,
+// except the paths which the backup has of the other kind.
+func prepareDeltaRestore(manifestFiles map[string]ManifestFile, directoryPaths []string, dbDataDirectory string,
+	concurrency int) (*deltaRestore, error) {
+	delta := &deltaRestore{unchanged: make(map[string]bool)}
+	if err := checkDeltaDestination(dbDataDirectory); err != nil {
+		return nil, err
+	}
+	directories := make(map[string]bool, len(directoryPaths))
+	for _, directoryPath := range directoryPaths {
+		directories[directoryPath] = true
+	}
+
+	var candidates []string
+	err := filepath.Walk(dbDataDirectory, func(filePath string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) && filePath == dbDataDirectory {
+			return filepath.SkipDir
+		}
+		if err != nil || filePath == dbDataDirectory || info.Mode()&os.ModeSymlink != 0 {
+			return err
+		}
+		relativePath, err := filepath.Rel(dbDataDirectory, filePath)
+		if err != nil {
+			return err
+		}
+		manifestPath := path.Join(BackupDataDirectory, filepath.ToSlash(relativePath))
+		if info.IsDir() {
+			if directories[manifestPath] {
+				return nil
+			}
+			if _, ok := manifestFiles[manifestPath]; ok {
+				tracelog.DebugLogger.Printf("Removing directory %s which is the file in the backup\n", relativePath)
+				if err := os.RemoveAll(filePath); err != nil {
+					return err
+				}
+			} else {
+				delta.stale = append(delta.stale, filePath)
+			}
+			return filepath.SkipDir
+		}
+		manifestFile, ok := manifestFiles[manifestPath]
+		if !ok {
+			if directories[manifestPath] {
+				tracelog.DebugLogger.Printf("Removing file %s which is the directory in the backup\n", relativePath)
+				return os.Remove(filePath)
+			}
+			delta.stale = append(delta.stale, filePath)
+			return nil
+		}
+		if manifestFile.Checksum != "" && info.Size() == manifestFile.Size {
+			candidates = append(candidates, manifestPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to compare %s with the backup", dbDataDirectory)
+	}
+
+	delta.findUnchanged(candidates, manifestFiles, dbDataDirectory, concurrency)
+	tracelog.InfoLogger.Printf("Delta restore: %d files match the backup, %d files and directories "+
+		"will be removed\n", len(delta.unchanged), len(delta.stale))
+	return delta, nil
+}
+
+// checkDeltaDestination refuses the delta restore to the running cluster, and to the non-empty directory
+// which doesn't look like the data directory
+func checkDeltaDestination(dbDataDirectory string) error {
+	if _, err := os.Stat(filepath.Join(dbDataDirectory, PostmasterPidFile)); err == nil {
+		return errors.Errorf("%s exists in %s, stop the cluster before the delta restore",
+			PostmasterPidFile, dbDataDirectory)
+	}
+	entries, err := ioutil.ReadDir(dbDataDirectory)
+	if os.IsNotExist(err) || err == nil && len(entries) == 0 {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s", dbDataDirectory)
+	}
+	for _, marker := range []string{PgVersionFile, RestoreManifestFile} {
+		if _, err := os.Stat(filepath.Join(dbDataDirectory, marker)); err == nil {
+			return nil
+		}
+	}
+	return errors.Errorf("%s is not empty and has neither %s nor %s, the delta restore removes the files "+
+		"the backup doesn't have, so it is refused for what doesn't look like the data directory",
+		dbDataDirectory, PgVersionFile, RestoreManifestFile)
+}
+
+// removeStale removes the files and the directories the backup doesn't have, once the backup is restored
+func (delta *deltaRestore) removeStale() error {
+	for _, stalePath := range delta.stale {
+		tracelog.DebugLogger.Printf("Removing %s which is not in the backup\n", stalePath)
+		if err := os.RemoveAll(stalePath); err != nil {
+			return errors.Wrapf(err, "failed to remove %s which is not in the backup", stalePath)
+		}
+	}
+	tracelog.InfoLogger.Printf("Delta restore: %d files and directories removed\n", len(delta.stale))
+	return nil
+}
+
+// findUnchanged hashes the files of the same size as in the manifest by the concurrent workers
+func (delta *deltaRestore) findUnchanged(manifestPaths []string, manifestFiles map[string]ManifestFile,
+	dbDataDirectory string, concurrency int) {
+	filesToHash := make(chan string)
+	var mutex sync.Mutex
+	var workers sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for manifestPath := range filesToHash {
+				if _, ok := verifyRestoredFile(manifestPath, manifestFiles[manifestPath], dbDataDirectory); ok {
+					mutex.Lock()
+					delta.unchanged[manifestPath] = true
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+	for _, manifestPath := range manifestPaths {
+		filesToHash <- manifestPath
+	}
+	close(filesToHash)
+	workers.Wait()
+}
+
+// shouldFetch is the predicate of the files to extract, it skips the files which match the backup
+func (delta *deltaRestore) shouldFetch(file internal.ReaderMaker) bool {
+	return !delta.unchanged[path.Join(BackupDataDirectory, trimCompressionExtension(file.Path()))]
+}
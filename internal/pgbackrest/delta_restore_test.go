@@ -0,0 +1,144 @@
+package pgbackrest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+var deltaTestBackupFiles = map[string]string{
+	"PG_VERSION":        "14",
+	"base/1/1259":       "pg_class",
+	"base/1/16384":      "new table",
+	"global/pg_control": "control v2",
+}
+
+// putDeltaTestBackup uploads the full backup with the sizes and the checksums of its files in the manifest
+func putDeltaTestBackup(t *testing.T) storage.Folder {
+	folder := putTestBackupChain(t)
+	var manifest strings.Builder
+	fmt.Fprintf(&manifest, "[backup]\nbackup-label=\"%s\"\nbackup-lsn-start=\"0/1000000\"\n"+
+		"backup-lsn-stop=\"0/2000000\"\nbackup-type=\"full\"\n\n[target:file]\n", testFullBackup)
+	backupFolder := folder.GetSubFolder(BackupPath).GetSubFolder(testStanza).GetSubFolder(testFullBackup)
+	for name, content := range deltaTestBackupFiles {
+		checksum := sha1.Sum([]byte(content))
+		fmt.Fprintf(&manifest, "pg_data/%s={\"checksum\":\"%s\",\"size\":%d}\n",
+			name, hex.EncodeToString(checksum[:]), len(content))
+		require.NoError(t, backupFolder.GetSubFolder(BackupDataDirectory).PutObject(name+".gz", gzipped(t, content)))
+	}
+	manifest.WriteString("\n[target:file:default]\nmode=\"0600\"\n\n" +
+		"[target:path]\npg_data={}\npg_data/base={}\npg_data/base/1={}\npg_data/global={}\n\n" +
+		"[target:path:default]\nmode=\"0700\"\n")
+	require.NoError(t, backupFolder.PutObject(BackupManifestIni, strings.NewReader(manifest.String())))
+	return folder
+}
+
+func writeDataFiles(t *testing.T, destination string, files map[string]string) {
+	for name, content := range files {
+		filePath := filepath.Join(destination, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(filePath), 0700))
+		require.NoError(t, ioutil.WriteFile(filePath, []byte(content), 0600))
+	}
+}
+
+func TestHandlePgbackrestBackupFetch_delta(t *testing.T) {
+	folder := putDeltaTestBackup(t)
+	destination := t.TempDir()
+	writeDataFiles(t, destination, map[string]string{
+		"PG_VERSION":          "14",
+		"base/1/1259":         "pg_clasZ",
+		"global/pg_control":   "control v1 and more",
+		"base/1/99999":        "dropped table",
+		"pg_stat_tmp/db.stat": "stale stats",
+		"recovery.signal":     "",
+	})
+	// the unchanged file is kept as it is, so its modification time stays
+	unchangedTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	require.NoError(t, os.Chtimes(filepath.Join(destination, "PG_VERSION"), unchangedTime, unchangedTime))
+	outside := filepath.Join(t.TempDir(), "outside")
+	require.NoError(t, ioutil.WriteFile(outside, []byte("outside"), 0600))
+	require.NoError(t, os.Symlink(outside, filepath.Join(destination, "linked")))
+
+	err := HandlePgbackrestBackupFetch(folder, testStanza, destination, namedBackupSelector(testFullBackup),
+		FetchOptions{StrictListing: true, ParallelVerify: true, Delta: true})
+	require.NoError(t, err)
+
+	expected := map[string]string{"linked": "outside"}
+	for name, content := range deltaTestBackupFiles {
+		expected[name] = content
+	}
+	assert.Equal(t, expected, readRestoredFiles(t, destination))
+	assert.NoDirExists(t, filepath.Join(destination, "pg_stat_tmp"))
+	info, err := os.Stat(filepath.Join(destination, "PG_VERSION"))
+	require.NoError(t, err)
+	assert.Equal(t, unchangedTime, info.ModTime())
+}
+
+func TestHandlePgbackrestBackupFetch_deltaEmptyDestination(t *testing.T) {
+	folder := putDeltaTestBackup(t)
+	destination := filepath.Join(t.TempDir(), "missing")
+
+	err := HandlePgbackrestBackupFetch(folder, testStanza, destination, namedBackupSelector(testFullBackup),
+		FetchOptions{StrictListing: true, Delta: true})
+	require.NoError(t, err)
+	assert.Equal(t, deltaTestBackupFiles, readRestoredFiles(t, destination))
+}
+
+func TestHandlePgbackrestBackupFetch_deltaRunningCluster(t *testing.T) {
+	folder := putDeltaTestBackup(t)
+	destination := t.TempDir()
+	writeDataFiles(t, destination, map[string]string{PostmasterPidFile: "42", "base/1/99999": "table"})
+
+	err := HandlePgbackrestBackupFetch(folder, testStanza, destination, namedBackupSelector(testFullBackup),
+		FetchOptions{StrictListing: true, Delta: true})
+	assert.Error(t, err)
+	assert.FileExists(t, filepath.Join(destination, "base/1/99999"))
+}
+
+func TestHandlePgbackrestBackupFetch_deltaNotDataDirectory(t *testing.T) {
+	folder := putDeltaTestBackup(t)
+	destination := t.TempDir()
+	writeDataFiles(t, destination, map[string]string{"notes.txt": "keep me", "photos/1.jpg": "jpeg"})
+
+	err := HandlePgbackrestBackupFetch(folder, testStanza, destination, namedBackupSelector(testFullBackup),
+		FetchOptions{StrictListing: true, Delta: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), PgVersionFile)
+	assert.Equal(t, map[string]string{"notes.txt": "keep me", "photos/1.jpg": "jpeg"},
+		readRestoredFiles(t, destination))
+}
+
+func TestHandlePgbackrestBackupFetch_deltaInterruptedRestore(t *testing.T) {
+	folder := putDeltaTestBackup(t)
+	destination := t.TempDir()
+	writeDataFiles(t, destination, map[string]string{RestoreManifestFile: "[backup]", "base/1/99999": "table"})
+
+	err := HandlePgbackrestBackupFetch(folder, testStanza, destination, namedBackupSelector(testFullBackup),
+		FetchOptions{StrictListing: true, Delta: true})
+	require.NoError(t, err)
+	assert.Equal(t, deltaTestBackupFiles, readRestoredFiles(t, destination))
+}
+
+func TestHandlePgbackrestBackupFetch_deltaFailedExtractionKeepsStaleFiles(t *testing.T) {
+	folder := putDeltaTestBackup(t)
+	dataFolder := folder.GetSubFolder(BackupPath).GetSubFolder(testStanza).GetSubFolder(testFullBackup).
+		GetSubFolder(BackupDataDirectory)
+	require.NoError(t, dataFolder.PutObject("base/1/16384.gz", strings.NewReader("not gzip")))
+	destination := t.TempDir()
+	writeDataFiles(t, destination, map[string]string{"PG_VERSION": "14", "base/1/99999": "table"})
+
+	err := HandlePgbackrestBackupFetch(folder, testStanza, destination, namedBackupSelector(testFullBackup),
+		FetchOptions{StrictListing: true, Delta: true})
+	assert.Error(t, err)
+	assert.FileExists(t, filepath.Join(destination, "base/1/99999"))
+}
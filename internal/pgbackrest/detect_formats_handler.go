@@ -0,0 +1,57 @@
+package pgbackrest
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+// HandleDetectFormats detects the format of every file of every backup in the stanza by its header
+// and prints the detected formats with the paths of the files in the data directory of their backups
+func HandleDetectFormats(folder storage.Folder, stanza string, concurrency int, output io.Writer) error {
+	backupsSettings, err := LoadBackupsSettings(folder, stanza)
+	if err != nil {
+		return err
+	}
+
+	// the unreadable folders don't stop the detection, they are reported by the lister
+	lister := newFilesLister(false, concurrency)
+	var files []internal.ReaderMaker
+	var fileBackups []string
+	for _, settings := range backupsSettings {
+		backupFilesFolder := folder.GetSubFolder(BackupFolderName).GetSubFolder(stanza).
+			GetSubFolder(settings.Name).GetSubFolder(BackupDataDirectory)
+		backupFiles, err := lister.getFiles(backupFilesFolder, backupFilesFolder, 0)
+		if err != nil {
+			return err
+		}
+		files = append(files, backupFiles...)
+		for range backupFiles {
+			fileBackups = append(fileBackups, settings.Name)
+		}
+	}
+
+	return writeFormatDetections(internal.DetectFormats(files, concurrency), fileBackups, output)
+}
+
+func writeFormatDetections(detections []internal.FormatDetection, fileBackups []string, output io.Writer) error {
+	writer := tabwriter.NewWriter(output, 0, 0, 1, ' ', 0)
+	_, err := fmt.Fprintln(writer, "backup\tpath\textension\tdetected_format")
+	if err != nil {
+		return err
+	}
+	for i, detection := range detections {
+		format := detection.Format
+		if detection.Error != nil {
+			format = fmt.Sprintf("error: %v", detection.Error)
+		}
+		_, err = fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", fileBackups[i], detection.Path, detection.Extension, format)
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
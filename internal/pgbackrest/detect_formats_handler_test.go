@@ -0,0 +1,27 @@
+package pgbackrest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression/lz4"
+)
+
+func TestHandleDetectFormats(t *testing.T) {
+	folder := putTestBackupInfo(t, testCurrentBackupInfo)
+	dataFolder := folder.GetSubFolder(BackupFolderName).GetSubFolder(testStanza).
+		GetSubFolder("20220104-000000F").GetSubFolder(BackupDataDirectory)
+	require.NoError(t, dataFolder.PutObject("base/1/1259.lz4",
+		internal.CompressAndEncrypt(strings.NewReader("relation"), lz4.Compressor{}, nil)))
+	require.NoError(t, dataFolder.PutObject("PG_VERSION", strings.NewReader("13\n")))
+
+	output := new(bytes.Buffer)
+	require.NoError(t, HandleDetectFormats(folder, testStanza, 2, output))
+	assert.Equal(t, "backup           path            extension detected_format\n"+
+		"20220104-000000F PG_VERSION                unknown\n"+
+		"20220104-000000F base/1/1259.lz4 lz4       lz4\n", output.String())
+}
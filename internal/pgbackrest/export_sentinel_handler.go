@@ -0,0 +1,136 @@
+package pgbackrest
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// exportedBackupUserData is the UserData of the exported sentinel, it refers to the pgbackrest backup it describes
+type exportedBackupUserData struct {
+	Backup     string            `json:"pgbackrest_backup"`
+	Stanza     string            `json:"pgbackrest_stanza"`
+	Type       string            `json:"pgbackrest_type"`
+	Prior      string            `json:"pgbackrest_prior,omitempty"`
+	Annotation map[string]string `json:"pgbackrest_annotation,omitempty"`
+}
+
+// HandleExportSentinel writes the WAL-G sentinel and metadata.json of the selected pgbackrest backup
+// to the basebackups folder of the target storage. The pgbackrest repository is only read, and it is refused
+// as the target, so the WAL-G backup selection and retention never see the exported backups among its files.
+// The backup is named after its first WAL segment, as WAL-G names its own backups, unless backupName is set.
+func HandleExportSentinel(folder storage.Folder, targetFolder storage.Folder, stanza string,
+	backupSelector internal.BackupSelector, backupName string) error {
+	isRepository, err := targetFolder.GetSubFolder(BackupPath).GetSubFolder(stanza).Exists(BackupInfoIni)
+	if err != nil {
+		return errors.Wrap(err, "failed to check the target storage")
+	}
+	if isRepository {
+		return errors.Errorf("the target storage has %s of stanza %s, export the sentinels to the storage "+
+			"of the WAL-G backups instead of the pgbackrest repository", BackupInfoIni, stanza)
+	}
+
+	pgbackrestBackupName, err := backupSelector.Select(folder)
+	if err != nil {
+		return err
+	}
+	backupDetails, err := GetBackupDetails(folder, stanza, pgbackrestBackupName)
+	if err != nil {
+		return err
+	}
+	if backupName == "" {
+		if backupDetails.WalFileName == "" {
+			return errors.Errorf("backup %s has no archive start WAL segment, set the name of the exported backup",
+				pgbackrestBackupName)
+		}
+		backupName = utility.BackupNamePrefix + backupDetails.WalFileName
+	}
+
+	sentinelDto, meta, err := newExportedSentinel(backupDetails, stanza)
+	if err != nil {
+		return err
+	}
+
+	baseBackupFolder := targetFolder.GetSubFolder(utility.BaseBackupPath)
+	exists, err := baseBackupFolder.Exists(internal.SentinelNameFromBackup(backupName))
+	if err != nil {
+		return errors.Wrapf(err, "failed to check if backup %s exists", backupName)
+	}
+	if exists {
+		return errors.Errorf("backup %s already exists in %s", backupName, utility.BaseBackupPath)
+	}
+
+	// the sentinel goes last, since the backup without it is not listed
+	err = internal.UploadDto(baseBackupFolder, meta, internal.MetadataNameFromBackup(backupName))
+	if err != nil {
+		return errors.Wrapf(err, "failed to upload the metadata of backup %s", backupName)
+	}
+	err = internal.UploadDto(baseBackupFolder, postgres.NewBackupSentinelDtoV2(sentinelDto, meta),
+		internal.SentinelNameFromBackup(backupName))
+	if err != nil {
+		return errors.Wrapf(err, "failed to upload the sentinel of backup %s", backupName)
+	}
+	tracelog.InfoLogger.Printf("Exported pgbackrest backup %s as %s", pgbackrestBackupName, backupName)
+	return nil
+}
+
+// newExportedSentinel describes the pgbackrest backup the way WAL-G describes its own full backups,
+// the files metadata and the sizes are not known without reading the files, so they are left out
+func newExportedSentinel(backupDetails *BackupDetails, stanza string) (postgres.BackupSentinelDto,
+	postgres.ExtendedMetadataDto, error) {
+	pgVersion, err := pgVersionNumber(backupDetails.PgVersion)
+	if err != nil {
+		return postgres.BackupSentinelDto{}, postgres.ExtendedMetadataDto{}, err
+	}
+	startLsn, finishLsn, systemIdentifier := backupDetails.StartLsn, backupDetails.FinishLsn, backupDetails.SystemIdentifier
+	userData := exportedBackupUserData{
+		Backup:     backupDetails.BackupName,
+		Stanza:     stanza,
+		Type:       backupDetails.Type,
+		Prior:      backupDetails.Prior,
+		Annotation: backupDetails.Annotation,
+	}
+
+	sentinelDto := postgres.BackupSentinelDto{
+		BackupStartLSN:        &startLsn,
+		PgVersion:             pgVersion,
+		BackupFinishLSN:       &finishLsn,
+		SystemIdentifier:      &systemIdentifier,
+		UserData:              userData,
+		FilesMetadataDisabled: true,
+	}
+	meta := postgres.ExtendedMetadataDto{
+		StartTime:        backupDetails.StartTime.UTC(),
+		FinishTime:       backupDetails.FinishTime.UTC(),
+		DatetimeFormat:   postgres.MetadataDatetimeFormat,
+		PgVersion:        pgVersion,
+		StartLsn:         startLsn,
+		FinishLsn:        finishLsn,
+		SystemIdentifier: &systemIdentifier,
+		UserData:         userData,
+	}
+	return sentinelDto, meta, nil
+}
+
+// pgVersionNumber converts the db-version of pgbackrest, e.g. 9.6 or 14, to the server_version_num form WAL-G uses
+func pgVersionNumber(version string) (int, error) {
+	parts := strings.Split(version, ".")
+	major, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts) > 2 {
+		return 0, errors.Errorf("unexpected PostgreSQL version '%s'", version)
+	}
+	if len(parts) == 1 {
+		return major * 10000, nil
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, errors.Errorf("unexpected PostgreSQL version '%s'", version)
+	}
+	return major*10000 + minor*100, nil
+}
@@ -0,0 +1,127 @@
+package pgbackrest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const testExportedManifest = `[backup]
+backup-archive-start="000000010000000000000003"
+backup-label="20220101-000000F"
+backup-lsn-start="0/3000028"
+backup-lsn-stop="0/3000100"
+backup-timestamp-start=1641000000
+backup-timestamp-stop=1641000060
+backup-type="full"
+
+[backup:db]
+db-id=1
+db-system-id=7048394513958372389
+db-version="9.6"
+
+[target:file:default]
+mode="0600"
+
+[target:path:default]
+mode="0700"
+`
+
+func init() {
+	internal.ConfigureSettings(internal.PG)
+	internal.InitConfig()
+	internal.Configure()
+}
+
+func putTestExportedBackup(t *testing.T, manifest string) storage.Folder {
+	folder := memory.NewFolder("", memory.NewStorage())
+	stanzaFolder := folder.GetSubFolder(BackupPath).GetSubFolder(testStanza)
+	require.NoError(t, stanzaFolder.PutObject(BackupInfoIni,
+		strings.NewReader("[backup:current]\n"+testFullBackup+`={"backup-type":"full"}`+"\n")))
+	require.NoError(t, stanzaFolder.GetSubFolder(testFullBackup).PutObject(BackupManifestIni, strings.NewReader(manifest)))
+	return folder
+}
+
+func readObject(t *testing.T, folder storage.Folder, path string) []byte {
+	reader, err := folder.ReadObject(path)
+	require.NoError(t, err)
+	defer reader.Close()
+	content, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	return content
+}
+
+func TestHandleExportSentinel(t *testing.T) {
+	folder := putTestExportedBackup(t, testExportedManifest)
+	target := memory.NewFolder("", memory.NewStorage())
+	require.NoError(t, HandleExportSentinel(folder, target, testStanza, namedBackupSelector(testFullBackup), ""))
+
+	baseBackupFolder := target.GetSubFolder(utility.BaseBackupPath)
+	backupName := "base_000000010000000000000003"
+	var sentinel postgres.BackupSentinelDtoV2
+	require.NoError(t, json.Unmarshal(readObject(t, baseBackupFolder, internal.SentinelNameFromBackup(backupName)), &sentinel))
+	assert.Equal(t, uint64(0x3000028), *sentinel.BackupStartLSN)
+	assert.Equal(t, uint64(0x3000100), *sentinel.BackupFinishLSN)
+	assert.Equal(t, uint64(7048394513958372389), *sentinel.SystemIdentifier)
+	assert.Equal(t, 90600, sentinel.PgVersion)
+	assert.Equal(t, int64(1641000060), sentinel.FinishTime.Unix())
+	assert.False(t, sentinel.IsIncremental())
+	assert.Equal(t, testFullBackup, sentinel.UserData.(map[string]interface{})["pgbackrest_backup"])
+
+	var meta postgres.ExtendedMetadataDto
+	require.NoError(t, json.Unmarshal(readObject(t, baseBackupFolder, internal.MetadataNameFromBackup(backupName)), &meta))
+	assert.Equal(t, uint64(0x3000028), meta.StartLsn)
+	assert.Equal(t, int64(1641000000), meta.StartTime.Unix())
+	assert.Equal(t, 90600, meta.PgVersion)
+
+	backups, err := internal.GetBackups(baseBackupFolder)
+	require.NoError(t, err)
+	assert.Equal(t, backupName, backups[0].BackupName)
+
+	// the existing backup is never overwritten
+	assert.Error(t, HandleExportSentinel(folder, target, testStanza, namedBackupSelector(testFullBackup), ""))
+	require.NoError(t, HandleExportSentinel(folder, target, testStanza, namedBackupSelector(testFullBackup),
+		"base_migrated"))
+	exists, err := baseBackupFolder.Exists(internal.SentinelNameFromBackup("base_migrated"))
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestHandleExportSentinel_noArchiveStart(t *testing.T) {
+	manifest := strings.Replace(testExportedManifest, "backup-archive-start=\"000000010000000000000003\"\n", "", 1)
+	folder := putTestExportedBackup(t, manifest)
+	target := memory.NewFolder("", memory.NewStorage())
+	assert.Error(t, HandleExportSentinel(folder, target, testStanza, namedBackupSelector(testFullBackup), ""))
+	assert.NoError(t, HandleExportSentinel(folder, target, testStanza, namedBackupSelector(testFullBackup),
+		"base_migrated"))
+}
+
+// the sentinels aren't written among the files of the pgbackrest repository
+func TestHandleExportSentinel_repositoryTarget(t *testing.T) {
+	folder := putTestExportedBackup(t, testExportedManifest)
+	assert.Error(t, HandleExportSentinel(folder, folder, testStanza, namedBackupSelector(testFullBackup), ""))
+	objects, _, err := folder.GetSubFolder(utility.BaseBackupPath).ListFolder()
+	require.NoError(t, err)
+	assert.Empty(t, objects)
+}
+
+func TestPgVersionNumber(t *testing.T) {
+	for version, expected := range map[string]int{"9.6": 90600, "10": 100000, "14": 140000} {
+		number, err := pgVersionNumber(version)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, number)
+	}
+	for _, version := range []string{"", "fourteen", "9.6.1", "9.x"} {
+		_, err := pgVersionNumber(version)
+		assert.Error(t, err, version)
+	}
+}
@@ -0,0 +1,193 @@
+package pgbackrest
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+)
+
+const listFolderRetries = 3
+
+var (
+	MinListFolderRetryWait = time.Second
+	MaxListFolderRetryWait = 10 * time.Second
+)
+
+// UnreadableFolderError is returned in the strict mode when the subfolder can't be listed even after the retries
+type UnreadableFolderError struct {
+	error
+}
+
+func newUnreadableFolderError(folderPath string, err error) UnreadableFolderError {
+	return UnreadableFolderError{errors.Wrapf(err, "failed to list folder '%s'", folderPath)}
+}
+
+func (err UnreadableFolderError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// filesLister lists the backup files. The failed ListFolder is retried with the backoff, and the subfolder
+// which still can't be listed fails the listing in the strict mode, otherwise it's skipped with the warning.
+// The root folder of the listing is never skipped. The subfolders are listed by the concurrent workers,
+// at most concurrency listings at once, and their files are returned in the order of the sequential listing.
+type filesLister struct {
+	strict     bool
+	retries    int
+	listings   *semaphore.Weighted
+	newSleeper func() internal.Sleeper
+
+	skippedMutex sync.Mutex
+	skipped      []string
+}
+
+func newFilesLister(strict bool, concurrency int) *filesLister {
+	return &filesLister{
+		strict:   strict,
+		retries:  listFolderRetries,
+		listings: semaphore.NewWeighted(int64(concurrency)),
+		newSleeper: func() internal.Sleeper {
+			return internal.NewExponentialSleeper(MinListFolderRetryWait, MaxListFolderRetryWait)
+		},
+	}
+}
+
+// newConfiguredFilesLister lists the folders with WALG_DOWNLOAD_CONCURRENCY workers,
+// the same number of storage calls the files are downloaded with
+func newConfiguredFilesLister(strict bool) (*filesLister, error) {
+	concurrency, err := internal.GetMaxDownloadConcurrency()
+	if err != nil {
+		return nil, err
+	}
+	return newFilesLister(strict, concurrency), nil
+}
+
+// getFiles lists the files under the folder with the paths relative to backupFilesFolder
+func (lister *filesLister) getFiles(folder storage.Folder, backupFilesFolder storage.Folder,
+	fileMode int) ([]internal.ReaderMaker, error) {
+	relativePath, err := relativeFolderPath(backupFilesFolder, folder)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	files, subfolders, err := lister.listFiles(ctx, folder, relativePath, backupFilesFolder, fileMode)
+	if err != nil {
+		return nil, err
+	}
+	skippedBefore := len(lister.skipped)
+	subfoldersFiles, err := lister.getFilesRecursively(ctx, subfolders, backupFilesFolder, fileMode)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, subfoldersFiles...)
+	if skipped := lister.skipped[skippedBefore:]; len(skipped) > 0 {
+		sort.Strings(skipped)
+		tracelog.WarningLogger.Printf("%d unreadable folders of '%s' are skipped, their files are missing: %s",
+			len(skipped), folder.GetPath(), strings.Join(skipped, ", "))
+	}
+	return files, nil
+}
+
+// getFilesRecursively lists the subfolders and their subfolders concurrently. The first error cancels
+// the listings which haven't started yet and stops the running ones at their next page.
+func (lister *filesLister) getFilesRecursively(ctx context.Context, subfolders []storage.Folder,
+	backupFilesFolder storage.Folder, fileMode int) ([]internal.ReaderMaker, error) {
+	group, ctx := errgroup.WithContext(ctx)
+	subfoldersFiles := make([][]internal.ReaderMaker, len(subfolders))
+	for i, subfolder := range subfolders {
+		i, subfolder := i, subfolder
+		group.Go(func() (err error) {
+			subfoldersFiles[i], err = lister.getSubfolderFiles(ctx, subfolder, backupFilesFolder, fileMode)
+			return err
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	var files []internal.ReaderMaker
+	for _, subfolderFiles := range subfoldersFiles {
+		files = append(files, subfolderFiles...)
+	}
+	return files, nil
+}
+
+// getSubfolderFiles returns the files of the subfolder followed by the files of its subfolders.
+// The worker slot is held only while the subfolder itself is listed, so the nested listings never wait
+// for the slots of their parents.
+func (lister *filesLister) getSubfolderFiles(ctx context.Context, subfolder storage.Folder,
+	backupFilesFolder storage.Folder, fileMode int) ([]internal.ReaderMaker, error) {
+	relativePath, err := relativeFolderPath(backupFilesFolder, subfolder)
+	if err != nil {
+		return nil, err
+	}
+	if err = lister.listings.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	files, subfolderSubfolders, err := lister.listFiles(ctx, subfolder, relativePath, backupFilesFolder, fileMode)
+	lister.listings.Release(1)
+	if err != nil && (lister.strict || ctx.Err() != nil) {
+		return nil, err
+	}
+	if err != nil {
+		tracelog.WarningLogger.Printf("Skipping the unreadable folder: %v", err)
+		lister.skip(subfolder.GetPath())
+		return nil, nil
+	}
+	subfoldersFiles, err := lister.getFilesRecursively(ctx, subfolderSubfolders, backupFilesFolder, fileMode)
+	if err != nil {
+		return nil, err
+	}
+	return append(files, subfoldersFiles...), nil
+}
+
+func (lister *filesLister) skip(folderPath string) {
+	lister.skippedMutex.Lock()
+	defer lister.skippedMutex.Unlock()
+	lister.skipped = append(lister.skipped, folderPath)
+}
+
+// listFiles returns the files of the folder, collected as the folder is listed, and its subfolders.
+// The listing which fails is retried from the start, the canceled one isn't.
+func (lister *filesLister) listFiles(ctx context.Context, folder storage.Folder, relativePath string,
+	backupFilesFolder storage.Folder, fileMode int) ([]internal.ReaderMaker, []storage.Folder, error) {
+	sleeper := lister.newSleeper()
+	for attempt := 0; ; attempt++ {
+		var files []internal.ReaderMaker
+		var subfolders []storage.Folder
+		err := storage.ListFolderStream(folder, func(object storage.Object, subfolder storage.Folder) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if subfolder != nil {
+				subfolders = append(subfolders, subfolder)
+				return nil
+			}
+			filePath := path.Join(relativePath, object.GetName())
+			file := internal.NewRegularFileStorageReaderMarker(backupFilesFolder, filePath, fileMode)
+			file.Object = object
+			files = append(files, file)
+			return nil
+		})
+		if err == nil {
+			return files, subfolders, nil
+		}
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		if attempt == lister.retries {
+			return nil, nil, newUnreadableFolderError(folder.GetPath(), err)
+		}
+		tracelog.WarningLogger.Printf("Failed to list folder '%s', retrying: %v", folder.GetPath(), err)
+		sleeper.Sleep()
+	}
+}
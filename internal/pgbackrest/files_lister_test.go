@@ -0,0 +1,221 @@
+package pgbackrest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+var errPermissionDenied = errors.New("permission denied")
+
+// failingListFolder fails ListFolder of the folders with the path suffix, failures times for every folder
+type failingListFolder struct {
+	storage.Folder
+	suffix   string
+	failures map[string]int
+	mutex    *sync.Mutex
+}
+
+func (folder *failingListFolder) wrap(subfolder storage.Folder) storage.Folder {
+	return &failingListFolder{Folder: subfolder, suffix: folder.suffix, failures: folder.failures, mutex: folder.mutex}
+}
+
+func (folder *failingListFolder) fails() bool {
+	folder.mutex.Lock()
+	defer folder.mutex.Unlock()
+	if strings.HasSuffix(folder.GetPath(), folder.suffix) && folder.failures[folder.GetPath()] > 0 {
+		folder.failures[folder.GetPath()]--
+		return true
+	}
+	return false
+}
+
+func (folder *failingListFolder) GetSubFolder(subFolderRelativePath string) storage.Folder {
+	return folder.wrap(folder.Folder.GetSubFolder(subFolderRelativePath))
+}
+
+func (folder *failingListFolder) ListFolder() ([]storage.Object, []storage.Folder, error) {
+	if folder.fails() {
+		return nil, nil, errPermissionDenied
+	}
+	objects, subfolders, err := folder.Folder.ListFolder()
+	for i, subfolder := range subfolders {
+		subfolders[i] = folder.wrap(subfolder)
+	}
+	return objects, subfolders, err
+}
+
+type noSleeper struct{}
+
+func (noSleeper) Sleep() {}
+
+func makeListedFolder(t *testing.T, failures int) storage.Folder {
+	folder := memory.NewFolder("", memory.NewStorage())
+	for _, name := range []string{"global/pg_control", "base/1/1259", "base/2/1259"} {
+		assert.NoError(t, folder.PutObject(name, bytes.NewReader([]byte(name))))
+	}
+	return &failingListFolder{Folder: folder, suffix: "base/2/", failures: map[string]int{"base/2/": failures},
+		mutex: &sync.Mutex{}}
+}
+
+func listedPaths(files []internal.ReaderMaker) []string {
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, file.Path())
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func newTestFilesLister(strict bool) *filesLister {
+	lister := newFilesLister(strict, 4)
+	lister.newSleeper = func() internal.Sleeper {
+		return noSleeper{}
+	}
+	return lister
+}
+
+func TestFilesLister_RetriesFailedListing(t *testing.T) {
+	folder := makeListedFolder(t, listFolderRetries)
+	files, err := newTestFilesLister(true).getFiles(folder, folder, 0600)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"base/1/1259", "base/2/1259", "global/pg_control"}, listedPaths(files))
+}
+
+func TestFilesLister_PathsRelativeToBackupFiles(t *testing.T) {
+	backupFilesFolder := memory.NewFolder("backup/main/20220104-000000F/pg_data/", memory.NewStorage())
+	for _, name := range []string{"global/pg_control", "base/1/1259", "base/1/2/2608"} {
+		assert.NoError(t, backupFilesFolder.PutObject(name, bytes.NewReader([]byte(name))))
+	}
+	files, err := newTestFilesLister(true).getFiles(backupFilesFolder.GetSubFolder("base"), backupFilesFolder, 0600)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"base/1/1259", "base/1/2/2608"}, listedPaths(files))
+}
+
+func TestFilesLister_SkipsUnreadableFolder(t *testing.T) {
+	folder := makeListedFolder(t, listFolderRetries+1)
+	lister := newTestFilesLister(false)
+	files, err := lister.getFiles(folder, folder, 0600)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"base/1/1259", "global/pg_control"}, listedPaths(files))
+	assert.Equal(t, []string{"base/2/"}, lister.skipped)
+}
+
+func TestFilesLister_StrictFailsOnUnreadableFolder(t *testing.T) {
+	folder := makeListedFolder(t, listFolderRetries+1)
+	_, err := newTestFilesLister(true).getFiles(folder, folder, 0600)
+	assert.True(t, errors.As(err, &UnreadableFolderError{}))
+}
+
+func TestFilesLister_ObjectInfo(t *testing.T) {
+	folder := makeListedFolder(t, 0)
+	files, err := newTestFilesLister(true).getFiles(folder, folder, 0600)
+	assert.NoError(t, err)
+	for _, file := range files {
+		infoFile, ok := file.(internal.ObjectInfoReaderMaker)
+		if !assert.True(t, ok) {
+			continue
+		}
+		size, ok := infoFile.Size()
+		assert.True(t, ok)
+		assert.Equal(t, int64(len(file.Path())), size)
+		lastModified, ok := infoFile.LastModified()
+		assert.True(t, ok)
+		assert.False(t, lastModified.IsZero())
+	}
+}
+
+// concurrencyRecordingFolder records the maximum number of the folders listed at once,
+// and lists the folder in the same order every time unlike the memory folder
+type concurrencyRecordingFolder struct {
+	storage.Folder
+	recorder *concurrencyRecorder
+}
+
+type concurrencyRecorder struct {
+	mutex   sync.Mutex
+	current int
+	max     int
+}
+
+func (folder *concurrencyRecordingFolder) GetSubFolder(subFolderRelativePath string) storage.Folder {
+	return &concurrencyRecordingFolder{folder.Folder.GetSubFolder(subFolderRelativePath), folder.recorder}
+}
+
+func (folder *concurrencyRecordingFolder) ListFolder() ([]storage.Object, []storage.Folder, error) {
+	recorder := folder.recorder
+	recorder.mutex.Lock()
+	recorder.current++
+	if recorder.current > recorder.max {
+		recorder.max = recorder.current
+	}
+	recorder.mutex.Unlock()
+	defer func() {
+		recorder.mutex.Lock()
+		recorder.current--
+		recorder.mutex.Unlock()
+	}()
+
+	time.Sleep(5 * time.Millisecond)
+	objects, subfolders, err := folder.Folder.ListFolder()
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].GetName() < objects[j].GetName()
+	})
+	sort.Slice(subfolders, func(i, j int) bool {
+		return subfolders[i].GetPath() < subfolders[j].GetPath()
+	})
+	for i, subfolder := range subfolders {
+		subfolders[i] = &concurrencyRecordingFolder{subfolder, recorder}
+	}
+	return objects, subfolders, err
+}
+
+func makeDeepFolder(t *testing.T) *concurrencyRecordingFolder {
+	folder := memory.NewFolder("", memory.NewStorage())
+	for database := 1; database <= 8; database++ {
+		for _, name := range []string{"1259", "1259_fsm", "pg_filenode.map"} {
+			objectName := fmt.Sprintf("pg_tblspc/16400/PG_14/%d/%s", database, name)
+			assert.NoError(t, folder.PutObject(objectName, bytes.NewReader([]byte(objectName))))
+		}
+	}
+	assert.NoError(t, folder.PutObject("global/pg_control", bytes.NewReader([]byte("pg_control"))))
+	return &concurrencyRecordingFolder{folder, &concurrencyRecorder{}}
+}
+
+func TestFilesLister_ListsSubfoldersConcurrently(t *testing.T) {
+	folder := makeDeepFolder(t)
+	files, err := newFilesLister(true, 3).getFiles(folder, folder, 0600)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, folder.recorder.max)
+
+	sequentialFolder := makeDeepFolder(t)
+	sequentialFiles, err := newFilesLister(true, 1).getFiles(sequentialFolder, sequentialFolder, 0600)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sequentialFolder.recorder.max)
+	assert.Len(t, files, 25)
+	for i := range files {
+		assert.Equal(t, sequentialFiles[i].Path(), files[i].Path(), "the order must not depend on the concurrency")
+	}
+}
+
+func TestFilesLister_StrictStopsOtherListings(t *testing.T) {
+	folder := makeListedFolder(t, listFolderRetries+1)
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("base/3/%d", i)
+		assert.NoError(t, folder.PutObject(name, bytes.NewReader([]byte(name))))
+	}
+	lister := newTestFilesLister(true)
+	_, err := lister.getFiles(folder, folder, 0600)
+	assert.True(t, errors.As(err, &UnreadableFolderError{}))
+	assert.Empty(t, lister.skipped)
+}
@@ -0,0 +1,176 @@
+package pgbackrest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/compression/gzip"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+const (
+	// InfoCopyExtension is the extension of the copy which pgbackrest writes along with every info file
+	InfoCopyExtension = ".copy"
+
+	infoChecksumSection = "backrest"
+	infoChecksumKey     = "backrest-checksum"
+)
+
+// InfoChecksumMismatchError is returned when the info file doesn't match its backrest-checksum,
+// e.g. because it was written partially
+type InfoChecksumMismatchError struct {
+	error
+}
+
+func newInfoChecksumMismatchError(name string, expected string, actual string) InfoChecksumMismatchError {
+	return InfoChecksumMismatchError{errors.Errorf("checksum of '%s' is %s, but the file declares %s", name, actual, expected)}
+}
+
+func (err InfoChecksumMismatchError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// loadInfoFile reads the info file, or its copy if the file is missing or doesn't match its checksum.
+// Both are read compressed by gzip if only the variant with the .gz extension is stored.
+// If neither matches its checksum, the file or else the copy is used anyway with a warning,
+// since the checksum is recomputed here and a mismatch may be the rendering pgbackrest differs in.
+// The errors of the file are returned if the copy doesn't help.
+func loadInfoFile(folder storage.Folder, name string) ([]byte, error) {
+	content, err := readVerifiedInfoFile(folder, name)
+	if err == nil || !isReplaceableInfoFileError(err) {
+		return content, err
+	}
+	copyName := name + InfoCopyExtension
+	tracelog.WarningLogger.Printf("Failed to load %s, trying %s: %v", name, copyName, err)
+	copyContent, copyErr := readVerifiedInfoFile(folder, copyName)
+	if copyErr == nil {
+		return copyContent, nil
+	}
+	tracelog.WarningLogger.Printf("Failed to load %s: %v", copyName, copyErr)
+	if isChecksumMismatch(err) {
+		tracelog.WarningLogger.Printf("Using %s which doesn't match its checksum", name)
+		return content, nil
+	}
+	if isChecksumMismatch(copyErr) {
+		tracelog.WarningLogger.Printf("Using %s which doesn't match its checksum", copyName)
+		return copyContent, nil
+	}
+	return nil, err
+}
+
+func isReplaceableInfoFileError(err error) bool {
+	var notFoundError storage.ObjectNotFoundError
+	return errors.As(err, &notFoundError) || isChecksumMismatch(err)
+}
+
+func isChecksumMismatch(err error) bool {
+	var mismatchError InfoChecksumMismatchError
+	return errors.As(err, &mismatchError)
+}
+
+// readVerifiedInfoFile returns the content along with InfoChecksumMismatchError if it doesn't match the checksum
+func readVerifiedInfoFile(folder storage.Folder, name string) ([]byte, error) {
+	content, err := readInfoFile(folder, name)
+	if err != nil {
+		return nil, err
+	}
+	if err = verifyInfoChecksum(content, name); err != nil {
+		if isChecksumMismatch(err) {
+			return content, err
+		}
+		return nil, err
+	}
+	return content, nil
+}
+
+// readInfoFile reads the file, or decompresses its gzip variant if only that one is stored
+func readInfoFile(folder storage.Folder, name string) ([]byte, error) {
+	reader, err := folder.ReadObject(name)
+	if err == nil {
+		defer utility.LoggedClose(reader, "")
+		return ioutil.ReadAll(reader)
+	}
+	var notFoundError storage.ObjectNotFoundError
+	if !errors.As(err, &notFoundError) {
+		return nil, err
+	}
+	compressedName := name + "." + gzip.FileExtension
+	compressedReader, compressedErr := folder.ReadObject(compressedName)
+	if compressedErr != nil {
+		if errors.As(compressedErr, &notFoundError) {
+			return nil, err
+		}
+		return nil, compressedErr
+	}
+	defer utility.LoggedClose(compressedReader, "")
+	decompressed, err := compression.Decompress(gzip.Decompressor{}, compressedReader, compressedName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decompress '%s'", compressedName)
+	}
+	defer utility.LoggedClose(decompressed, "")
+	tracelog.DebugLogger.Printf("Reading %s compressed as %s", name, compressedName)
+	content, err := ioutil.ReadAll(decompressed)
+	return content, errors.Wrapf(err, "failed to decompress '%s'", compressedName)
+}
+
+// verifyInfoChecksum compares the SHA-1 of the file with its backrest-checksum. Like pgbackrest,
+// the hash is taken over the JSON object of the sections and their keys without the checksum itself,
+// the values are JSON already. The files without the checksum aren't verified.
+func verifyInfoChecksum(content []byte, name string) error {
+	hash := sha1.New()
+	var expected, lastSection, section string
+	io.WriteString(hash, "{")
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, len(content)+1)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = line[1 : len(line)-1]
+			continue
+		}
+		separator := strings.Index(line, "=")
+		if separator < 0 {
+			return errors.Errorf("invalid line in '%s': %s", name, line)
+		}
+		key, value := strings.TrimSpace(line[:separator]), strings.TrimSpace(line[separator+1:])
+		if section == infoChecksumSection && key == infoChecksumKey {
+			expected = strings.Trim(value, `"`)
+			continue
+		}
+		switch {
+		case lastSection == "":
+			fmt.Fprintf(hash, `"%s":{`, section)
+		case lastSection != section:
+			fmt.Fprintf(hash, `},"%s":{`, section)
+		default:
+			io.WriteString(hash, ",")
+		}
+		lastSection = section
+		fmt.Fprintf(hash, `"%s":%s`, key, value)
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrapf(err, "failed to read '%s'", name)
+	}
+	io.WriteString(hash, "}}")
+	if expected == "" {
+		tracelog.DebugLogger.Printf("%s has no checksum, it isn't verified", name)
+		return nil
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+		return newInfoChecksumMismatchError(name, expected, actual)
+	}
+	return nil
+}
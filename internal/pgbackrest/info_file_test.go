@@ -0,0 +1,141 @@
+package pgbackrest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+const testBackupInfoBackup = `{"backup-type":"full","backup-prior":null,"backup-reference":null}`
+
+// testBackupInfo returns backup.info of the backup with the checksum pgbackrest would write,
+// i.e. SHA-1 of the JSON object of all the keys but the checksum
+func testBackupInfo(backupName string) string {
+	checksumJSON := `{"backrest":{"backrest-format":5,"backrest-version":"2.41"},` +
+		`"backup:current":{"` + backupName + `":` + testBackupInfoBackup + `}}`
+	checksum := sha1.Sum([]byte(checksumJSON))
+	return "[backrest]\n" +
+		`backrest-checksum="` + hex.EncodeToString(checksum[:]) + "\"\n" +
+		"backrest-format=5\n" +
+		"backrest-version=\"2.41\"\n" +
+		"\n" +
+		"[backup:current]\n" +
+		backupName + "=" + testBackupInfoBackup + "\n"
+}
+
+func gzipped(t *testing.T, content string) *bytes.Buffer {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, err := writer.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return &compressed
+}
+
+func loadTestBackupNames(t *testing.T, objects map[string]*bytes.Buffer) ([]string, error) {
+	folder := memory.NewFolder("in_memory/", memory.NewStorage())
+	stanzaFolder := folder.GetSubFolder(BackupPath).GetSubFolder(testStanza)
+	for name, content := range objects {
+		require.NoError(t, stanzaFolder.PutObject(name, content))
+	}
+	settings, err := LoadBackupsSettings(folder, testStanza)
+	var names []string
+	for _, backup := range settings {
+		names = append(names, backup.Name)
+	}
+	return names, err
+}
+
+func TestLoadBackupsSettings_verifiedChecksum(t *testing.T) {
+	names, err := loadTestBackupNames(t, map[string]*bytes.Buffer{
+		BackupInfoIni:                     bytes.NewBufferString(testBackupInfo("20220101-000000F")),
+		BackupInfoIni + InfoCopyExtension: bytes.NewBufferString(testBackupInfo("20211201-000000F")),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"20220101-000000F"}, names)
+}
+
+func TestLoadBackupsSettings_copyReplacesPartiallyWritten(t *testing.T) {
+	partial := testBackupInfo("20220101-000000F")
+	partial = partial[:strings.LastIndex(partial, ",")] + "\n"
+	names, err := loadTestBackupNames(t, map[string]*bytes.Buffer{
+		BackupInfoIni:                     bytes.NewBufferString(partial),
+		BackupInfoIni + InfoCopyExtension: bytes.NewBufferString(testBackupInfo("20211201-000000F")),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"20211201-000000F"}, names)
+
+	// without the copy the partially written file is used and fails to parse
+	_, err = loadTestBackupNames(t, map[string]*bytes.Buffer{BackupInfoIni: bytes.NewBufferString(partial)})
+	assert.Error(t, err)
+}
+
+func TestLoadBackupsSettings_pgbackrestLayout(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/backup.info")
+	require.NoError(t, err)
+	require.NoError(t, verifyInfoChecksum(content, BackupInfoIni))
+
+	names, err := loadTestBackupNames(t, map[string]*bytes.Buffer{BackupInfoIni: bytes.NewBuffer(content)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"20220101-000000F", "20220101-000000F_20220102-000000I"}, names)
+}
+
+func TestLoadBackupsSettings_checksumMismatchWarns(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/backup.info")
+	require.NoError(t, err)
+	mismatched := strings.Replace(string(content), "4b1e64825c44412264a415384ca86a6f6b9663e6",
+		"0000000000000000000000000000000000000000", 1)
+	assert.IsType(t, InfoChecksumMismatchError{}, verifyInfoChecksum([]byte(mismatched), BackupInfoIni))
+
+	// neither the file nor the copy matches, the file is used
+	names, err := loadTestBackupNames(t, map[string]*bytes.Buffer{
+		BackupInfoIni:                     bytes.NewBufferString(mismatched),
+		BackupInfoIni + InfoCopyExtension: bytes.NewBufferString(mismatched[:strings.Index(mismatched, "[db]")]),
+	})
+	require.NoError(t, err)
+	assert.Len(t, names, 2)
+
+	// the copy which doesn't match is used if the file is missing
+	names, err = loadTestBackupNames(t, map[string]*bytes.Buffer{
+		BackupInfoIni + InfoCopyExtension: bytes.NewBufferString(mismatched),
+	})
+	require.NoError(t, err)
+	assert.Len(t, names, 2)
+}
+
+func TestLoadBackupsSettings_compressed(t *testing.T) {
+	names, err := loadTestBackupNames(t, map[string]*bytes.Buffer{
+		BackupInfoIni + ".gz": gzipped(t, testBackupInfo("20220101-000000F")),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"20220101-000000F"}, names)
+
+	names, err = loadTestBackupNames(t, map[string]*bytes.Buffer{
+		BackupInfoIni + InfoCopyExtension + ".gz": gzipped(t, testBackupInfo("20211201-000000F")),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"20211201-000000F"}, names)
+
+	_, err = loadTestBackupNames(t, map[string]*bytes.Buffer{
+		BackupInfoIni + ".gz": bytes.NewBufferString(testBackupInfo("20220101-000000F")),
+	})
+	assert.Error(t, err)
+}
+
+func TestLoadBackupsSettings_missing(t *testing.T) {
+	_, err := loadTestBackupNames(t, map[string]*bytes.Buffer{})
+	var notFoundError storage.ObjectNotFoundError
+	require.True(t, errors.As(err, &notFoundError))
+	assert.Contains(t, err.Error(), BackupInfoIni)
+	assert.NotContains(t, err.Error(), InfoCopyExtension)
+}
@@ -1,8 +1,11 @@
 package pgbackrest
 
 import (
+	"fmt"
 	"sort"
 
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal"
 	"github.com/wal-g/wal-g/pkg/storages/storage"
@@ -17,6 +20,35 @@ type NamedBackupSelector struct {
 	Stanza     string
 }
 
+// LsnBackupSelector selects the latest backup which finished at or before the target LSN,
+// i.e. the backup to start the point-in-time recovery to that LSN from
+type LsnBackupSelector struct {
+	TargetLsn uint64
+	Stanza    string
+}
+
+type NoBackupBeforeLsnError struct {
+	error
+}
+
+func newNoBackupBeforeLsnError(targetLsn uint64) NoBackupBeforeLsnError {
+	return NoBackupBeforeLsnError{errors.Errorf("no backup finished at or before the target LSN %s",
+		pgx.FormatLSN(targetLsn))}
+}
+
+func (err NoBackupBeforeLsnError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// NewLsnBackupSelector parses the target LSN in the X/Y hex form
+func NewLsnBackupSelector(targetLsn string, stanza string) (LsnBackupSelector, error) {
+	lsn, err := pgx.ParseLSN(targetLsn)
+	if err != nil {
+		return LsnBackupSelector{}, errors.Wrapf(err, "invalid target LSN '%s'", targetLsn)
+	}
+	return LsnBackupSelector{TargetLsn: lsn, Stanza: stanza}, nil
+}
+
 func (selector LastestBackupSelector) Select(folder storage.Folder) (string, error) {
 	backupList, err := GetBackupList(folder, selector.Stanza)
 	if err != nil {
@@ -42,6 +74,32 @@ func (selector NamedBackupSelector) Select(folder storage.Folder) (string, error
 	return "", err
 }
 
+func (selector LsnBackupSelector) Select(folder storage.Folder) (string, error) {
+	backupList, err := GetBackupList(folder, selector.Stanza)
+	if err != nil {
+		return "", err
+	}
+
+	var best *BackupDetails
+	for _, backup := range backupList {
+		details, err := GetBackupDetails(folder, selector.Stanza, backup.BackupName)
+		if err != nil {
+			return "", err
+		}
+		if details.FinishLsn > selector.TargetLsn {
+			continue
+		}
+		if best == nil || details.FinishLsn > best.FinishLsn {
+			best = details
+		}
+	}
+	if best == nil {
+		return "", newNoBackupBeforeLsnError(selector.TargetLsn)
+	}
+	tracelog.InfoLogger.Printf("Selected backup %s finished at LSN %s\n", best.BackupName, pgx.FormatLSN(best.FinishLsn))
+	return best.BackupName, nil
+}
+
 func NewBackupSelector(backupName string, stanza string) internal.BackupSelector {
 	if backupName == internal.LatestString {
 		tracelog.InfoLogger.Printf("Selecting the latest backup...\n")
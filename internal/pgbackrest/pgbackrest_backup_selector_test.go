@@ -0,0 +1,67 @@
+package pgbackrest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+const testStanza = "main"
+
+// putTestBackups uploads backup.info and the manifests of the backups with the given stop LSNs
+func putTestBackups(t *testing.T, stopLsns map[string]string) storage.Folder {
+	folder := memory.NewFolder("", memory.NewStorage())
+	stanzaFolder := folder.GetSubFolder(BackupPath).GetSubFolder(testStanza)
+
+	var backupInfo strings.Builder
+	backupInfo.WriteString("[backup:current]\n")
+	for name, stopLsn := range stopLsns {
+		fmt.Fprintf(&backupInfo, "%s={\"backup-timestamp-stop\":1,\"backup-type\":\"full\"}\n", name)
+		manifest := fmt.Sprintf("[backup]\nbackup-label=\"%s\"\nbackup-lsn-start=\"0/1000000\"\n"+
+			"backup-lsn-stop=\"%s\"\n\n[target:file:default]\nmode=\"0600\"\n\n[target:path:default]\nmode=\"0700\"\n",
+			name, stopLsn)
+		err := stanzaFolder.GetSubFolder(name).PutObject(BackupManifestIni, strings.NewReader(manifest))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, stanzaFolder.PutObject(BackupInfoIni, strings.NewReader(backupInfo.String())))
+	return folder
+}
+
+func TestLsnBackupSelector(t *testing.T) {
+	folder := putTestBackups(t, map[string]string{
+		"20220101-000000F": "0/3000000",
+		"20220102-000000F": "0/5000028",
+		"20220103-000000F": "1/0",
+	})
+
+	for target, expected := range map[string]string{
+		"0/5000028": "20220102-000000F",
+		"0/5000027": "20220101-000000F",
+		"FF/0":      "20220103-000000F",
+	} {
+		selector, err := NewLsnBackupSelector(target, testStanza)
+		assert.NoError(t, err)
+		backupName, err := selector.Select(folder)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, backupName, "target %s", target)
+	}
+}
+
+func TestLsnBackupSelector_noBackupBeforeTarget(t *testing.T) {
+	folder := putTestBackups(t, map[string]string{"20220101-000000F": "0/3000000"})
+
+	selector, err := NewLsnBackupSelector("0/2FFFFFF", testStanza)
+	assert.NoError(t, err)
+	_, err = selector.Select(folder)
+	assert.IsType(t, NoBackupBeforeLsnError{}, err)
+	assert.Contains(t, err.Error(), "0/2FFFFFF")
+}
+
+func TestNewLsnBackupSelector_invalidLsn(t *testing.T) {
+	_, err := NewLsnBackupSelector("5000028", testStanza)
+	assert.Error(t, err)
+}
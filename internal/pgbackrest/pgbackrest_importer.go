@@ -1,10 +1,14 @@
 package pgbackrest
 
 import (
+	"encoding/json"
+	"fmt"
 	"strconv"
 	"time"
 
 	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal"
 	"github.com/wal-g/wal-g/pkg/storages/storage"
 )
@@ -23,26 +27,79 @@ type BackupDetails struct {
 	DirectoryPaths       []string
 	DefaultFileMode      int
 	DefaultDirectoryMode int
+	Annotation           map[string]string `json:",omitempty"`
+	// Prior is the backup the diff or incr backup is based on, empty for the full backup
+	Prior string `json:",omitempty"`
+	// References are the prior backups which contain the files of the backup
+	References []string `json:",omitempty"`
+	// History is set for the backup pending expiration, listed by backup:history of backup.info
+	History bool `json:",omitempty"`
 }
 
-func GetBackupList(backupsFolder storage.Folder, stanza string) ([]internal.BackupTime, error) {
+type BrokenBackupChainError struct {
+	error
+}
+
+func newBrokenBackupChainError(backupName string, prior string) BrokenBackupChainError {
+	return BrokenBackupChainError{errors.Errorf("the prior backup %s of %s is not in %s", prior, backupName, BackupInfoIni)}
+}
+
+func (err BrokenBackupChainError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// BackupTimeWithType is the BackupTime of the pgbackrest backup along with its type: full, diff or incr.
+// History is set for the backup of the backup:history section, which is pending expiration.
+type BackupTimeWithType struct {
+	internal.BackupTime
+	Type    string `json:"type"`
+	History bool   `json:"history,omitempty"`
+}
+
+func GetBackupList(backupsFolder storage.Folder, stanza string) ([]BackupTimeWithType, error) {
 	backupsSettings, err := LoadBackupsSettings(backupsFolder, stanza)
 	if err != nil {
 		return nil, err
 	}
+	return getBackupTimes(backupsSettings, false), nil
+}
+
+// GetBackupHistoryList lists the backups of the backup:history section of backup.info
+func GetBackupHistoryList(backupsFolder storage.Folder, stanza string) ([]BackupTimeWithType, error) {
+	historySettings, err := LoadBackupsHistorySettings(backupsFolder, stanza)
+	if err != nil {
+		return nil, err
+	}
+	return getBackupTimes(historySettings, true), nil
+}
 
-	var backupTimes []internal.BackupTime
+func getBackupTimes(backupsSettings []BackupSettings, history bool) []BackupTimeWithType {
+	var backupTimes []BackupTimeWithType
 	for i := range backupsSettings {
-		backupTimes = append(backupTimes, internal.BackupTime{
-			BackupName:  backupsSettings[i].Name,
-			Time:        getTime(backupsSettings[i].BackupTimestampStop),
-			WalFileName: backupsSettings[i].BackupArchiveStart,
+		backupTimes = append(backupTimes, BackupTimeWithType{
+			BackupTime: internal.BackupTime{
+				BackupName:  backupsSettings[i].Name,
+				Time:        getTime(backupsSettings[i].BackupTimestampStop),
+				WalFileName: backupsSettings[i].BackupArchiveStart,
+			},
+			Type:    backupsSettings[i].BackupType,
+			History: history,
 		})
 	}
-	return backupTimes, nil
+	return backupTimes
 }
 
 func GetBackupDetails(backupsFolder storage.Folder, stanza string, backupName string) (*BackupDetails, error) {
+	backupsSettings, err := LoadBackupsSettings(backupsFolder, stanza)
+	if err != nil {
+		return nil, err
+	}
+	return getBackupDetails(backupsFolder, stanza, backupName, backupsSettings)
+}
+
+// getBackupDetails reads the manifest of the backup, the prior backup and references are taken from backupsSettings
+func getBackupDetails(backupsFolder storage.Folder, stanza string, backupName string,
+	backupsSettings []BackupSettings) (*BackupDetails, error) {
 	manifest, err := LoadManifest(backupsFolder, stanza, backupName)
 	if err != nil {
 		return nil, err
@@ -72,6 +129,10 @@ func GetBackupDetails(backupsFolder storage.Folder, stanza string, backupName st
 	if err != nil {
 		return nil, err
 	}
+	annotation, err := parseAnnotation(manifest.MetadataSection.Annotation)
+	if err != nil {
+		return nil, err
+	}
 
 	backupDetails := BackupDetails{
 		BackupName:           backupTime.BackupName,
@@ -87,11 +148,60 @@ func GetBackupDetails(backupsFolder storage.Folder, stanza string, backupName st
 		DirectoryPaths:       manifest.PathSection.directoryPaths,
 		DefaultFileMode:      int(fileMode),
 		DefaultDirectoryMode: int(directoryMode),
+		Annotation:           annotation,
+		Prior:                manifest.BackupSection.BackupLabelPrior,
+	}
+	if settings := findBackupSettings(backupsSettings, backupName); settings != nil {
+		backupDetails.Prior = settings.BackupPrior
+		backupDetails.References = settings.BackupReference
 	}
 
 	return &backupDetails, nil
 }
 
+func findBackupSettings(backupsSettings []BackupSettings, backupName string) *BackupSettings {
+	for i := range backupsSettings {
+		if backupsSettings[i].Name == backupName {
+			return &backupsSettings[i]
+		}
+	}
+	return nil
+}
+
+// GetBackupChain returns the backup followed by its prior backups up to the full one,
+// which are all needed to restore the backup
+func GetBackupChain(backupsSettings []BackupSettings, backupName string) ([]string, error) {
+	chain := []string{backupName}
+	for current := backupName; ; {
+		settings := findBackupSettings(backupsSettings, current)
+		if settings == nil {
+			if current == backupName {
+				return nil, errors.Errorf("backup %s is not in %s", backupName, BackupInfoIni)
+			}
+			return nil, newBrokenBackupChainError(chain[len(chain)-2], current)
+		}
+		if settings.BackupPrior == "" {
+			return chain, nil
+		}
+		if len(chain) > len(backupsSettings) {
+			return nil, errors.Errorf("the prior backups of %s make a cycle", backupName)
+		}
+		current = settings.BackupPrior
+		chain = append(chain, current)
+	}
+}
+
+func parseAnnotation(annotation string) (map[string]string, error) {
+	if annotation == "" {
+		return nil, nil
+	}
+	var parsed map[string]string
+	if err := json.Unmarshal([]byte(annotation), &parsed); err != nil {
+		return nil, errors.Wrap(err, "failed to parse backup annotation")
+	}
+	return parsed, nil
+}
+
 func getTime(timestamp int64) time.Time {
 	return time.Unix(timestamp, 0)
 }
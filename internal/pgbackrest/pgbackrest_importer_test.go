@@ -0,0 +1,20 @@
+package pgbackrest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAnnotation(t *testing.T) {
+	annotation, err := parseAnnotation(`{"source":"nightly","ticket":"DB-42"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"source": "nightly", "ticket": "DB-42"}, annotation)
+
+	annotation, err = parseAnnotation("")
+	assert.NoError(t, err)
+	assert.Nil(t, annotation)
+
+	_, err = parseAnnotation(`{"source":`)
+	assert.Error(t, err)
+}
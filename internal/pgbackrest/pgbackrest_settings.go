@@ -2,7 +2,10 @@ package pgbackrest
 
 import (
 	"encoding/json"
+	"fmt"
 
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/pkg/storages/storage"
 	"gopkg.in/ini.v1"
 )
@@ -12,8 +15,15 @@ const (
 	BackupInfoIni     = "backup.info"
 	BackupManifestIni = "backup.manifest"
 
+	BackupCurrentSection = "backup:current"
+	BackupHistorySection = "backup:history"
+
 	BackupFolderName    = "backup"
 	BackupDataDirectory = "pg_data"
+
+	FullBackupType = "full"
+	DiffBackupType = "diff"
+	IncrBackupType = "incr"
 )
 
 type BackupSettings struct {
@@ -70,14 +80,30 @@ type PathSection struct {
 	directoryPaths []string
 }
 
+type FileSection struct {
+	files map[string]ManifestFile
+}
+
+// ManifestFile is the entry of the target:file section, Checksum is SHA-1 of the file contents.
+// Reference is the name of the prior backup which contains the file, if it was not copied again.
+type ManifestFile struct {
+	Checksum  string `json:"checksum"`
+	Reference string `json:"reference"`
+	Size      int64  `json:"size"`
+	RepoSize  int64  `json:"repo-size"`
+	Timestamp int64  `json:"timestamp"`
+}
+
 type ManifestSettings struct {
 	BackrestSection       BackrestSection       `ini:"backrest"`
 	BackupSection         BackupSection         `ini:"backup"`
 	BackupTargetSection   BackupTargetSection   `ini:"backup:target"`
 	BackupDatabaseSection BackupDatabaseSection `ini:"backup:db"`
 	PathSection           PathSection
+	FileSection           FileSection
 	DefaultFileSection    DefaultFileSection `ini:"target:file:default"`
 	DefaultPathSection    DefaultPathSection `ini:"target:path:default"`
+	MetadataSection       MetadataSection    `ini:"metadata"`
 }
 
 type BackupDatabaseSection struct {
@@ -88,6 +114,11 @@ type BackupDatabaseSection struct {
 	Version        string `ini:"db-version"`
 }
 
+// MetadataSection.Annotation is the JSON object of the backup annotations, empty if there are none
+type MetadataSection struct {
+	Annotation string `ini:"annotation"`
+}
+
 type PgData struct {
 	Path     string `json:"path"`
 	PathType string `json:"type"`
@@ -106,25 +137,64 @@ type DefaultPathSection struct {
 	User  string `ini:"user"`
 }
 
+// LoadBackupsSettings reads the backups of backup.info, falling back to backup.info.copy
+// if backup.info is missing or doesn't match its checksum, see loadInfoFile
 func LoadBackupsSettings(folder storage.Folder, stanza string) ([]BackupSettings, error) {
-	backupFolder := folder.GetSubFolder(BackupPath).GetSubFolder(stanza)
-	ioReader, err := backupFolder.ReadObject(BackupInfoIni)
+	cfg, err := loadBackupInfo(folder, stanza)
 	if err != nil {
 		return nil, err
 	}
 
-	cfg, err := ini.Load(ioReader)
+	backupSection, err := cfg.GetSection(BackupCurrentSection)
+	if err != nil {
+		return nil, err
+	}
+	return parseBackupsSection(backupSection)
+}
+
+// NoBackupHistoryError is returned when the history is requested from backup.info without backup:history.
+// pgbackrest itself keeps only the current backups in backup.info and removes the expired ones from it.
+type NoBackupHistoryError struct {
+	error
+}
+
+func newNoBackupHistoryError(stanza string) NoBackupHistoryError {
+	return NoBackupHistoryError{errors.Errorf("%s of stanza '%s' has no %s section, "+
+		"pgbackrest doesn't keep the expired backups there", BackupInfoIni, stanza, BackupHistorySection)}
+}
+
+func (err NoBackupHistoryError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// LoadBackupsHistorySettings reads the backups of the backup:history section of backup.info, the ones
+// which are no longer current but are retained until they expire. backup.info written by pgbackrest
+// has no such section, then NoBackupHistoryError is returned.
+func LoadBackupsHistorySettings(folder storage.Folder, stanza string) ([]BackupSettings, error) {
+	cfg, err := loadBackupInfo(folder, stanza)
 	if err != nil {
 		return nil, err
 	}
 
-	backupSection, err := cfg.GetSection("backup:current")
+	historySection, err := cfg.GetSection(BackupHistorySection)
+	if err != nil {
+		return nil, newNoBackupHistoryError(stanza)
+	}
+	return parseBackupsSection(historySection)
+}
+
+func loadBackupInfo(folder storage.Folder, stanza string) (*ini.File, error) {
+	backupFolder := folder.GetSubFolder(BackupPath).GetSubFolder(stanza)
+	content, err := loadInfoFile(backupFolder, BackupInfoIni)
 	if err != nil {
 		return nil, err
 	}
+	return ini.Load(content)
+}
 
+func parseBackupsSection(section *ini.Section) ([]BackupSettings, error) {
 	var backupsSettings []BackupSettings
-	for _, key := range backupSection.Keys() {
+	for _, key := range section.Keys() {
 		settings := BackupSettings{
 			Name: key.Name(),
 		}
@@ -153,5 +223,21 @@ func LoadManifest(folder storage.Folder, stanza string, backupName string) (*Man
 		return nil, err
 	}
 	settings.PathSection.directoryPaths = cfg.Section("target:path").KeyStrings()
+	settings.FileSection.files, err = parseFileSection(cfg.Section("target:file"))
+	if err != nil {
+		return nil, err
+	}
 	return &settings, nil
 }
+
+func parseFileSection(section *ini.Section) (map[string]ManifestFile, error) {
+	files := make(map[string]ManifestFile, len(section.Keys()))
+	for _, key := range section.Keys() {
+		var file ManifestFile
+		if err := json.Unmarshal([]byte(key.Value()), &file); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse manifest entry of %s", key.Name())
+		}
+		files[key.Name()] = file
+	}
+	return files, nil
+}
@@ -0,0 +1,209 @@
+package pgbackrest
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+)
+
+const (
+	AutoConfFileName      = "postgresql.auto.conf"
+	RecoverySignalFile    = "recovery.signal"
+	StandbySignalFile     = "standby.signal"
+	RecoveryTargetTimeKey = "recovery_target_time"
+	RestoreCommandKey     = "restore_command"
+
+	// signalFilesVersion is the first PostgreSQL version configuring the recovery by the signal files,
+	// the older ones read recovery.conf
+	signalFilesVersion = 12
+)
+
+// RecoveryConfig prepares the restored data directory to start the recovery: Settings override
+// the same named settings of postgresql.auto.conf and the rest are appended to it. The cluster is started
+// as the standby if Standby is set, otherwise the recovery is started if there is any setting.
+type RecoveryConfig struct {
+	Settings map[string]string
+	Standby  bool
+}
+
+// NewRecoveryConfig reads the settings of the template file, if it's set, and overrides them by the key=value
+// overrides and the recovery target time. The template lines which are neither settings nor comments fail it.
+func NewRecoveryConfig(templatePath string, overrides []string, targetTime string, standby bool) (RecoveryConfig, error) {
+	config := RecoveryConfig{Settings: make(map[string]string), Standby: standby}
+	if templatePath != "" {
+		template, err := ioutil.ReadFile(templatePath)
+		if err != nil {
+			return RecoveryConfig{}, errors.Wrap(err, "failed to read the recovery config template")
+		}
+		for i, line := range strings.Split(string(template), "\n") {
+			name, value, ok := parseConfLine(line)
+			if ok {
+				config.Settings[name] = value
+				continue
+			}
+			if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+				return RecoveryConfig{}, errors.Errorf("invalid line %d of the recovery config template '%s': %s",
+					i+1, templatePath, trimmed)
+			}
+		}
+	}
+	for _, override := range overrides {
+		name, value, ok := parseConfLine(override)
+		if !ok {
+			return RecoveryConfig{}, errors.Errorf("invalid recovery setting '%s', expected key=value", override)
+		}
+		config.Settings[name] = value
+	}
+	if targetTime != "" {
+		config.Settings[RecoveryTargetTimeKey] = targetTime
+	}
+	return config, nil
+}
+
+func (config RecoveryConfig) IsEmpty() bool {
+	return len(config.Settings) == 0 && !config.Standby
+}
+
+// Validate checks that the config can be applied to the backup of pgVersion, so the backup isn't restored
+// in vain: the recovery needs restore_command to fetch WAL, the standby may stream it instead
+func (config RecoveryConfig) Validate(pgVersion string) error {
+	if config.IsEmpty() {
+		return nil
+	}
+	majorVersion, err := strconv.ParseFloat(pgVersion, 64)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse PostgreSQL version '%s'", pgVersion)
+	}
+	if majorVersion < signalFilesVersion {
+		return errors.Errorf("the recovery of PostgreSQL %s is configured by recovery.conf, which is not supported",
+			pgVersion)
+	}
+	if !config.Standby && config.Settings[RestoreCommandKey] == "" {
+		return errors.Errorf("the recovery needs %s, set it by --recovery-setting or the template", RestoreCommandKey)
+	}
+	return nil
+}
+
+// ApplyRecoveryConfig writes the settings to postgresql.auto.conf of dbDataDirectory
+// and creates standby.signal or recovery.signal
+func ApplyRecoveryConfig(dbDataDirectory string, pgVersion string, config RecoveryConfig) error {
+	if config.IsEmpty() {
+		return nil
+	}
+	if err := config.Validate(pgVersion); err != nil {
+		return err
+	}
+
+	if len(config.Settings) > 0 {
+		err := patchAutoConf(filepath.Join(dbDataDirectory, AutoConfFileName), config.Settings)
+		if err != nil {
+			return err
+		}
+	}
+	signalFile := RecoverySignalFile
+	if config.Standby {
+		signalFile = StandbySignalFile
+	}
+	tracelog.InfoLogger.Printf("Creating %s\n", signalFile)
+	return ioutil.WriteFile(filepath.Join(dbDataDirectory, signalFile), nil, 0600)
+}
+
+// patchAutoConf replaces the lines of the settings in the file, keeping the others as they are,
+// and appends the settings the file doesn't have. The missing file is created.
+func patchAutoConf(autoConfPath string, settings map[string]string) error {
+	mode := os.FileMode(0600)
+	var lines []string
+	content, err := ioutil.ReadFile(autoConfPath)
+	switch {
+	case err == nil:
+		if info, err := os.Stat(autoConfPath); err == nil {
+			mode = info.Mode().Perm()
+		}
+		scanner := bufio.NewScanner(strings.NewReader(string(content)))
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+	case !os.IsNotExist(err):
+		return errors.Wrapf(err, "failed to read %s", autoConfPath)
+	}
+
+	written := make(map[string]bool)
+	for i, line := range lines {
+		name, _, ok := parseConfLine(line)
+		if !ok {
+			continue
+		}
+		if value, ok := settings[name]; ok {
+			lines[i] = formatConfLine(name, value)
+			written[name] = true
+		}
+	}
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		if !written[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lines = append(lines, formatConfLine(name, settings[name]))
+	}
+
+	tracelog.InfoLogger.Printf("Writing %d recovery settings to %s\n", len(settings), autoConfPath)
+	return ioutil.WriteFile(autoConfPath, []byte(strings.Join(lines, "\n")+"\n"), mode)
+}
+
+// parseConfLine parses the name = value line of the PostgreSQL config, the quotes of the value and the comment
+// after it are removed. The names are case insensitive, so they are lowercased.
+func parseConfLine(line string) (name string, value string, ok bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", "", false
+	}
+	separator := strings.Index(line, "=")
+	if separator <= 0 {
+		return "", "", false
+	}
+	name = strings.ToLower(strings.TrimSpace(line[:separator]))
+	value = strings.TrimSpace(line[separator+1:])
+	if unquoted, ok := unquoteConfValue(value); ok {
+		return name, unquoted, true
+	}
+	if comment := strings.Index(value, "#"); comment >= 0 {
+		value = strings.TrimSpace(value[:comment])
+	}
+	return name, value, true
+}
+
+// unquoteConfValue returns the value of the quoted string the value starts with, the doubled quotes are unescaped
+func unquoteConfValue(value string) (string, bool) {
+	if !strings.HasPrefix(value, "'") {
+		return "", false
+	}
+	var unquoted strings.Builder
+	for i := 1; i < len(value); i++ {
+		if value[i] != '\'' {
+			unquoted.WriteByte(value[i])
+			continue
+		}
+		if i+1 < len(value) && value[i+1] == '\'' {
+			unquoted.WriteByte('\'')
+			i++
+			continue
+		}
+		return unquoted.String(), true
+	}
+	return "", false
+}
+
+func formatConfLine(name string, value string) string {
+	return fmt.Sprintf("%s = '%s'", name, strings.ReplaceAll(value, "'", "''"))
+}
@@ -0,0 +1,129 @@
+package pgbackrest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAutoConf = "# Do not edit this file manually!\n" +
+	"# It will be overwritten by the ALTER SYSTEM command.\n" +
+	"work_mem = '64MB'\n" +
+	"Recovery_Target_Time = '2022-01-01 00:00:00'\n"
+
+func TestNewRecoveryConfig(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "recovery.template")
+	require.NoError(t, ioutil.WriteFile(templatePath, []byte("# the template\n"+
+		"restore_command = 'wal-g wal-fetch %f %p'\n"+
+		"recovery_target_action = 'pause'\n"), 0600))
+
+	config, err := NewRecoveryConfig(templatePath, []string{"recovery_target_action=promote"},
+		"2022-01-02 12:00:00+00", false)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"restore_command":        "wal-g wal-fetch %f %p",
+		"recovery_target_action": "promote",
+		RecoveryTargetTimeKey:    "2022-01-02 12:00:00+00",
+	}, config.Settings)
+
+	_, err = NewRecoveryConfig("", []string{"promote"}, "", false)
+	assert.Error(t, err)
+
+	config, err = NewRecoveryConfig("", nil, "", false)
+	require.NoError(t, err)
+	assert.True(t, config.IsEmpty())
+
+	require.NoError(t, ioutil.WriteFile(templatePath, []byte("restore_command 'wal-g wal-fetch %f %p'\n"), 0600))
+	_, err = NewRecoveryConfig(templatePath, nil, "", false)
+	assert.Error(t, err)
+}
+
+func TestParseConfLine(t *testing.T) {
+	for line, expected := range map[string][2]string{
+		"work_mem = 64MB":                            {"work_mem", "64MB"},
+		"work_mem = 64MB   # per operation":          {"work_mem", "64MB"},
+		"work_mem=64MB#per operation":                {"work_mem", "64MB"},
+		"Restore_Command = 'cp ''/a#b/%f'' %p' # cp": {"restore_command", "cp '/a#b/%f' %p"},
+		"recovery_target_time = ''":                  {"recovery_target_time", ""},
+	} {
+		name, value, ok := parseConfLine(line)
+		assert.True(t, ok, line)
+		assert.Equal(t, expected, [2]string{name, value}, line)
+	}
+	for _, line := range []string{"", "  # work_mem = 64MB", "work_mem"} {
+		_, _, ok := parseConfLine(line)
+		assert.False(t, ok, line)
+	}
+}
+
+func TestRecoveryConfig_Validate(t *testing.T) {
+	targetTime := RecoveryConfig{Settings: map[string]string{RecoveryTargetTimeKey: "2022-01-02 12:00:00+00"}}
+	err := targetTime.Validate("14")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), RestoreCommandKey)
+
+	targetTime.Settings[RestoreCommandKey] = "wal-g wal-fetch %f %p"
+	assert.NoError(t, targetTime.Validate("14"))
+	assert.Error(t, targetTime.Validate("11"))
+	assert.Error(t, targetTime.Validate("unknown"))
+
+	// the standby may stream WAL from the primary instead
+	assert.NoError(t, RecoveryConfig{Standby: true}.Validate("12"))
+	assert.NoError(t, RecoveryConfig{}.Validate("9.6"))
+}
+
+func TestApplyRecoveryConfig_patchesAutoConf(t *testing.T) {
+	dataDirectory := t.TempDir()
+	autoConfPath := filepath.Join(dataDirectory, AutoConfFileName)
+	require.NoError(t, ioutil.WriteFile(autoConfPath, []byte(testAutoConf), 0600))
+
+	err := ApplyRecoveryConfig(dataDirectory, "14", RecoveryConfig{Settings: map[string]string{
+		RecoveryTargetTimeKey: "2022-01-02 12:00:00+00",
+		"restore_command":     "cp '/archive/%f' %p",
+	}})
+	require.NoError(t, err)
+
+	autoConf, err := ioutil.ReadFile(autoConfPath)
+	require.NoError(t, err)
+	assert.Equal(t, "# Do not edit this file manually!\n"+
+		"# It will be overwritten by the ALTER SYSTEM command.\n"+
+		"work_mem = '64MB'\n"+
+		"recovery_target_time = '2022-01-02 12:00:00+00'\n"+
+		"restore_command = 'cp ''/archive/%f'' %p'\n", string(autoConf))
+	assert.FileExists(t, filepath.Join(dataDirectory, RecoverySignalFile))
+	assert.NoFileExists(t, filepath.Join(dataDirectory, StandbySignalFile))
+}
+
+func TestApplyRecoveryConfig_standby(t *testing.T) {
+	dataDirectory := t.TempDir()
+
+	require.NoError(t, ApplyRecoveryConfig(dataDirectory, "13", RecoveryConfig{Standby: true}))
+
+	assert.FileExists(t, filepath.Join(dataDirectory, StandbySignalFile))
+	assert.NoFileExists(t, filepath.Join(dataDirectory, RecoverySignalFile))
+	// the backup config is left as is without the settings
+	assert.NoFileExists(t, filepath.Join(dataDirectory, AutoConfFileName))
+}
+
+func TestApplyRecoveryConfig_emptyChangesNothing(t *testing.T) {
+	dataDirectory := t.TempDir()
+
+	require.NoError(t, ApplyRecoveryConfig(dataDirectory, "9.6", RecoveryConfig{}))
+
+	entries, err := ioutil.ReadDir(dataDirectory)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestApplyRecoveryConfig_recoveryConfVersion(t *testing.T) {
+	dataDirectory := t.TempDir()
+
+	err := ApplyRecoveryConfig(dataDirectory, "11", RecoveryConfig{Standby: true})
+	assert.Error(t, err)
+	_, err = os.Stat(filepath.Join(dataDirectory, StandbySignalFile))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,118 @@
+package pgbackrest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/wal-g/tracelog"
+)
+
+// FileChecksumMismatch is the restored file which doesn't match the SHA-1 of the backup manifest,
+// Err is set instead of Actual if the file can't be read
+type FileChecksumMismatch struct {
+	Path     string
+	Expected string
+	Actual   string
+	Err      error
+}
+
+func (mismatch FileChecksumMismatch) String() string {
+	if mismatch.Err != nil {
+		return fmt.Sprintf("%s: %v", mismatch.Path, mismatch.Err)
+	}
+	return fmt.Sprintf("%s: SHA-1 is %s, the manifest has %s", mismatch.Path, mismatch.Actual, mismatch.Expected)
+}
+
+// ChecksumVerificationResult lists all the mismatches found by the restore verification, sorted by path
+type ChecksumVerificationResult struct {
+	Verified   int
+	Mismatches []FileChecksumMismatch
+}
+
+// ChecksumVerificationError is returned when some restored files don't match the manifest
+type ChecksumVerificationError struct {
+	Result ChecksumVerificationResult
+}
+
+func (err ChecksumVerificationError) Error() string {
+	lines := make([]string, 0, len(err.Result.Mismatches))
+	for _, mismatch := range err.Result.Mismatches {
+		lines = append(lines, mismatch.String())
+	}
+	return fmt.Sprintf("%d of %d restored files don't match the backup manifest:\n%s",
+		len(err.Result.Mismatches), err.Result.Verified, strings.Join(lines, "\n"))
+}
+
+// verifyRestoredFiles hashes the restored files of the manifest by the concurrent workers
+// and compares them with the manifest checksums. The files without the checksum in the manifest are skipped.
+func verifyRestoredFiles(manifestFiles map[string]ManifestFile, dbDataDirectory string,
+	concurrency int) ChecksumVerificationResult {
+	filesToVerify := make(chan string)
+	mismatches := make(chan FileChecksumMismatch)
+	var workers sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for manifestPath := range filesToVerify {
+				if mismatch, ok := verifyRestoredFile(manifestPath, manifestFiles[manifestPath], dbDataDirectory); !ok {
+					mismatches <- mismatch
+				}
+			}
+		}()
+	}
+
+	verified := 0
+	go func() {
+		defer close(filesToVerify)
+		for manifestPath, file := range manifestFiles {
+			if file.Checksum == "" || !strings.HasPrefix(manifestPath, BackupDataDirectory+"/") {
+				continue
+			}
+			verified++
+			filesToVerify <- manifestPath
+		}
+	}()
+	go func() {
+		workers.Wait()
+		close(mismatches)
+	}()
+
+	var result ChecksumVerificationResult
+	for mismatch := range mismatches {
+		result.Mismatches = append(result.Mismatches, mismatch)
+	}
+	sort.Slice(result.Mismatches, func(i, j int) bool {
+		return result.Mismatches[i].Path < result.Mismatches[j].Path
+	})
+	result.Verified = verified
+	tracelog.InfoLogger.Printf("Verified checksums of %d restored files, %d mismatches",
+		result.Verified, len(result.Mismatches))
+	return result
+}
+
+func verifyRestoredFile(manifestPath string, manifestFile ManifestFile,
+	dbDataDirectory string) (FileChecksumMismatch, bool) {
+	relativePath := strings.TrimPrefix(manifestPath, BackupDataDirectory+"/")
+	mismatch := FileChecksumMismatch{Path: relativePath, Expected: manifestFile.Checksum}
+	file, err := os.Open(filepath.Join(dbDataDirectory, filepath.FromSlash(relativePath)))
+	if err != nil {
+		mismatch.Err = err
+		return mismatch, false
+	}
+	defer file.Close()
+	hash := sha1.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		mismatch.Err = err
+		return mismatch, false
+	}
+	mismatch.Actual = hex.EncodeToString(hash.Sum(nil))
+	return mismatch, mismatch.Actual == manifestFile.Checksum
+}
@@ -0,0 +1,86 @@
+package pgbackrest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sha1Hex(content string) string {
+	sum := sha1.Sum([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// writeRestoredFiles writes the files into the data directory and returns their manifest entries
+func writeRestoredFiles(t testing.TB, dbDataDirectory string, contents map[string]string) map[string]ManifestFile {
+	manifestFiles := make(map[string]ManifestFile)
+	for name, content := range contents {
+		filePath := filepath.Join(dbDataDirectory, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(filePath), 0700))
+		require.NoError(t, ioutil.WriteFile(filePath, []byte(content), 0600))
+		manifestFiles[BackupDataDirectory+"/"+name] = ManifestFile{Checksum: sha1Hex(content), Size: int64(len(content))}
+	}
+	return manifestFiles
+}
+
+func TestVerifyRestoredFiles(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	manifestFiles := writeRestoredFiles(t, dbDataDirectory, map[string]string{
+		"PG_VERSION":   "14",
+		"base/1/1259":  "pg_class",
+		"base/1/16384": "table",
+		"global/1262":  "pg_database",
+	})
+	manifestFiles["pg_data/base/1/1259"] = ManifestFile{Checksum: sha1Hex("another pg_class")}
+	manifestFiles["pg_data/base/1/16385"] = ManifestFile{Checksum: sha1Hex("missing")}
+	// the files without checksum and outside the data directory aren't verified
+	manifestFiles["pg_data/base/1/16386"] = ManifestFile{}
+	manifestFiles["pg_tblspc/16390/PG_14/1/16391"] = ManifestFile{Checksum: sha1Hex("tablespace")}
+
+	result := verifyRestoredFiles(manifestFiles, dbDataDirectory, 3)
+	assert.Equal(t, 5, result.Verified)
+	require.Len(t, result.Mismatches, 2)
+	assert.Equal(t, FileChecksumMismatch{Path: "base/1/1259", Expected: sha1Hex("another pg_class"), Actual: sha1Hex("pg_class")},
+		result.Mismatches[0])
+	assert.Equal(t, "base/1/16385", result.Mismatches[1].Path)
+	assert.True(t, errors.Is(result.Mismatches[1].Err, os.ErrNotExist))
+
+	message := ChecksumVerificationError{result}.Error()
+	assert.Contains(t, message, "2 of 5 restored files don't match the backup manifest")
+	assert.Contains(t, message, "base/1/1259: SHA-1 is "+sha1Hex("pg_class"))
+	assert.Contains(t, message, "base/1/16385: ")
+}
+
+func TestVerifyRestoredFiles_match(t *testing.T) {
+	dbDataDirectory := t.TempDir()
+	manifestFiles := writeRestoredFiles(t, dbDataDirectory, map[string]string{"PG_VERSION": "14", "base/1/1259": "pg_class"})
+	result := verifyRestoredFiles(manifestFiles, dbDataDirectory, 8)
+	assert.Equal(t, 2, result.Verified)
+	assert.Empty(t, result.Mismatches)
+}
+
+func BenchmarkVerifyRestoredFiles(b *testing.B) {
+	dbDataDirectory := b.TempDir()
+	contents := make(map[string]string)
+	for i := 0; i < 2000; i++ {
+		contents[fmt.Sprintf("base/%d/%d", i%10, 16384+i)] = fmt.Sprintf("small relation file %d", i)
+	}
+	manifestFiles := writeRestoredFiles(b, dbDataDirectory, contents)
+	for _, concurrency := range []int{1, 16} {
+		b.Run(fmt.Sprintf("concurrency_%d", concurrency), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if result := verifyRestoredFiles(manifestFiles, dbDataDirectory, concurrency); len(result.Mismatches) > 0 {
+					b.Fatal(result.Mismatches)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package pgbackrest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/testtools"
+)
+
+const sftpTestBackup = "20220101-000000F"
+
+// makeRepository writes the pgbackrest repository with a single backup,
+// the tablespace and the latest backup are linked like pgbackrest does by default
+func makeRepository(t *testing.T) string {
+	root := t.TempDir()
+	stanzaPath := filepath.Join(root, BackupPath, testStanza)
+	backupPath := filepath.Join(stanzaPath, sftpTestBackup)
+	files := map[string]string{
+		filepath.Join(stanzaPath, BackupInfoIni): "[backup:current]\n" + sftpTestBackup +
+			"={\"backup-timestamp-stop\":1,\"backup-type\":\"full\"}\n",
+		filepath.Join(backupPath, BackupManifestIni):                           "[backup]\nbackup-label=\"" + sftpTestBackup + "\"\n",
+		filepath.Join(backupPath, "pg_data", "PG_VERSION"):                     "14\n",
+		filepath.Join(backupPath, "pg_data", "base", "1", "1259"):              "pg_class",
+		filepath.Join(backupPath, "pg_tblspc", "16385", "PG_14", "1", "16386"): "table",
+	}
+	for filePath, content := range files {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filePath), 0755))
+		assert.NoError(t, ioutil.WriteFile(filePath, []byte(content), 0644))
+	}
+	assert.NoError(t, os.MkdirAll(filepath.Join(backupPath, "pg_data", "pg_tblspc"), 0755))
+	assert.NoError(t, os.Symlink(filepath.Join("..", "..", "pg_tblspc", "16385"),
+		filepath.Join(backupPath, "pg_data", "pg_tblspc", "16385")))
+	assert.NoError(t, os.Symlink(sftpTestBackup, filepath.Join(stanzaPath, "latest")))
+	return root
+}
+
+func TestSftpRepository(t *testing.T) {
+	folder := testtools.NewLocalSftpFolder(t, makeRepository(t))
+
+	backups, err := LoadBackupsSettings(folder, testStanza)
+	assert.NoError(t, err)
+	assert.Len(t, backups, 1)
+	assert.Equal(t, sftpTestBackup, backups[0].Name)
+
+	backupFilesFolder := folder.GetSubFolder(BackupPath).GetSubFolder(testStanza).
+		GetSubFolder(sftpTestBackup).GetSubFolder(BackupDataDirectory)
+	files, err := newFilesLister(true, 1).getFiles(backupFilesFolder, backupFilesFolder, 0600)
+	assert.NoError(t, err)
+
+	contents := make(map[string]string)
+	var paths []string
+	for _, file := range files {
+		reader, err := file.Reader()
+		assert.NoError(t, err)
+		content, err := ioutil.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.NoError(t, reader.Close())
+		contents[file.Path()] = string(content)
+		paths = append(paths, file.Path())
+	}
+	sort.Strings(paths)
+	assert.Equal(t, []string{"PG_VERSION", "base/1/1259", "pg_tblspc/16385/PG_14/1/16386"}, paths)
+	assert.Equal(t, "table", contents["pg_tblspc/16385/PG_14/1/16386"])
+}
@@ -0,0 +1,150 @@
+package pgbackrest
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/databases/postgres"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+const (
+	ArchivePath = "archive"
+
+	walFilenameLength = 24
+)
+
+// WalGap is the range of consecutive WAL segments missing in the archive, both ends are included
+type WalGap struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+type ArchiveGapsError struct {
+	error
+}
+
+func newArchiveGapsError(gaps []WalGap) ArchiveGapsError {
+	return ArchiveGapsError{errors.Errorf("WAL archive has %d gaps, the first one is %s-%s",
+		len(gaps), gaps[0].Start, gaps[0].End)}
+}
+
+func (err ArchiveGapsError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// HandleWalVerify prints the gaps in the WAL archive between the start and end segments,
+// ArchiveGapsError is returned if there are any
+func HandleWalVerify(folder storage.Folder, stanza string, startSegment, endSegment string,
+	json bool, output io.Writer) error {
+	gaps, err := FindArchiveGaps(folder, stanza, startSegment, endSegment)
+	if err != nil {
+		return err
+	}
+
+	if json {
+		err = internal.WriteAsJSON(gaps, output, true)
+	} else {
+		err = writeWalGaps(gaps, output)
+	}
+	if err != nil {
+		return err
+	}
+	if len(gaps) > 0 {
+		return newArchiveGapsError(gaps)
+	}
+	return nil
+}
+
+// FindArchiveGaps lists the archive/<stanza>/<archive id>/<timeline and log> folders
+// and returns the segments of the range missing in all of them.
+// Both segments must be on the same timeline.
+func FindArchiveGaps(folder storage.Folder, stanza string, startSegment, endSegment string) ([]WalGap, error) {
+	timeline, startNo, err := postgres.ParseWALFilename(startSegment)
+	if err != nil {
+		return nil, err
+	}
+	endTimeline, endNo, err := postgres.ParseWALFilename(endSegment)
+	if err != nil {
+		return nil, err
+	}
+	if timeline != endTimeline {
+		return nil, errors.Errorf("WAL range %s-%s spans several timelines", startSegment, endSegment)
+	}
+	if startNo > endNo {
+		return nil, errors.Errorf("WAL range start %s is after its end %s", startSegment, endSegment)
+	}
+
+	archived, err := listArchivedSegments(folder, stanza, timeline, startNo, endNo)
+	if err != nil {
+		return nil, err
+	}
+
+	gaps := make([]WalGap, 0)
+	for segmentNo := startNo; segmentNo <= endNo; segmentNo++ {
+		if archived[segmentNo] {
+			continue
+		}
+		name := postgres.FormatWALFileName(timeline, segmentNo)
+		if segmentNo > startNo && !archived[segmentNo-1] {
+			gaps[len(gaps)-1].End = name
+		} else {
+			gaps = append(gaps, WalGap{Start: name, End: name})
+		}
+	}
+	return gaps, nil
+}
+
+// listArchivedSegments returns the numbers of the segments archived on the timeline,
+// the archived segment name is the WAL file name followed by '-' and its checksum
+func listArchivedSegments(folder storage.Folder, stanza string, timeline uint32,
+	startNo, endNo uint64) (map[uint64]bool, error) {
+	_, archiveFolders, err := folder.GetSubFolder(ArchivePath).GetSubFolder(stanza).ListFolder()
+	if err != nil {
+		return nil, err
+	}
+	segmentsPerLog := 0x100000000 / postgres.WalSegmentSize
+
+	archived := make(map[uint64]bool)
+	for _, archiveFolder := range archiveFolders {
+		for logID := startNo / segmentsPerLog; logID <= endNo/segmentsPerLog; logID++ {
+			logFolder := archiveFolder.GetSubFolder(fmt.Sprintf("%08X%08X", timeline, logID))
+			objects, _, err := logFolder.ListFolder()
+			if err != nil {
+				return nil, err
+			}
+			for _, object := range objects {
+				name := object.GetName()
+				if len(name) <= walFilenameLength || name[walFilenameLength] != '-' {
+					continue
+				}
+				segmentTimeline, segmentNo, err := postgres.ParseWALFilename(name[:walFilenameLength])
+				if err == nil && segmentTimeline == timeline {
+					archived[segmentNo] = true
+				}
+			}
+		}
+	}
+	return archived, nil
+}
+
+func writeWalGaps(gaps []WalGap, output io.Writer) error {
+	if len(gaps) == 0 {
+		_, err := fmt.Fprintln(output, "No gaps found")
+		return err
+	}
+	writer := tabwriter.NewWriter(output, 0, 0, 1, ' ', 0)
+	if _, err := fmt.Fprintln(writer, "start\tend"); err != nil {
+		return err
+	}
+	for _, gap := range gaps {
+		if _, err := fmt.Fprintf(writer, "%s\t%s\n", gap.Start, gap.End); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,71 @@
+package pgbackrest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+const testChecksum = "-0123456789abcdef0123456789abcdef01234567.gz"
+
+func putArchivedSegments(t *testing.T, archiveID string, segments ...string) storage.Folder {
+	folder := memory.NewFolder("", memory.NewStorage())
+	archiveFolder := folder.GetSubFolder(ArchivePath).GetSubFolder(testStanza).GetSubFolder(archiveID)
+	for _, segment := range segments {
+		err := archiveFolder.GetSubFolder(segment[:16]).PutObject(segment+testChecksum, strings.NewReader("wal"))
+		assert.NoError(t, err)
+	}
+	return folder
+}
+
+func TestFindArchiveGaps(t *testing.T) {
+	folder := putArchivedSegments(t, "13-1",
+		"0000000100000000000000FE",
+		"000000010000000100000001",
+		"000000010000000100000004",
+		// other timeline and partial segment don't fill the gaps
+		"000000020000000100000002",
+	)
+	partial := "000000010000000100000002.partial"
+	err := folder.GetSubFolder(ArchivePath).GetSubFolder(testStanza).GetSubFolder("13-1").
+		GetSubFolder("0000000100000001").PutObject(partial+testChecksum, strings.NewReader("wal"))
+	assert.NoError(t, err)
+
+	gaps, err := FindArchiveGaps(folder, testStanza, "0000000100000000000000FE", "000000010000000100000004")
+	assert.NoError(t, err)
+	assert.Equal(t, []WalGap{
+		{Start: "0000000100000000000000FF", End: "000000010000000100000000"},
+		{Start: "000000010000000100000002", End: "000000010000000100000003"},
+	}, gaps)
+}
+
+func TestFindArchiveGaps_noGaps(t *testing.T) {
+	folder := putArchivedSegments(t, "13-1", "000000010000000000000001", "000000010000000000000002")
+
+	var output bytes.Buffer
+	err := HandleWalVerify(folder, testStanza, "000000010000000000000001", "000000010000000000000002", false, &output)
+	assert.NoError(t, err)
+	assert.Equal(t, "No gaps found\n", output.String())
+}
+
+func TestHandleWalVerify_gaps(t *testing.T) {
+	folder := putArchivedSegments(t, "13-1", "000000010000000000000001", "000000010000000000000003")
+
+	var output bytes.Buffer
+	err := HandleWalVerify(folder, testStanza, "000000010000000000000001", "000000010000000000000003", false, &output)
+	assert.IsType(t, ArchiveGapsError{}, err)
+	assert.Contains(t, output.String(), "000000010000000000000002")
+}
+
+func TestFindArchiveGaps_invalidRange(t *testing.T) {
+	folder := putArchivedSegments(t, "13-1")
+
+	_, err := FindArchiveGaps(folder, testStanza, "000000010000000000000002", "000000010000000000000001")
+	assert.Error(t, err)
+	_, err = FindArchiveGaps(folder, testStanza, "000000010000000000000001", "000000020000000000000002")
+	assert.Error(t, err)
+}
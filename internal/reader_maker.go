@@ -1,6 +1,10 @@
 package internal
 
-import "io"
+import (
+	"fmt"
+	"io"
+	"time"
+)
 
 type FileType string
 
@@ -18,10 +22,90 @@ type ReaderMaker interface {
 	Mode() int
 }
 
-func readerMakersToFilePaths(readerMakers []ReaderMaker) []string {
-	paths := make([]string, 0)
-	for _, readerMaker := range readerMakers {
-		paths = append(paths, readerMaker.Path())
+// ContentEncodingReaderMaker is the ReaderMaker which knows the content encoding of the object,
+// e.g. gzip applied by the storage proxy, it's valid after the Reader call
+type ContentEncodingReaderMaker interface {
+	ReaderMaker
+	ContentEncoding() string
+}
+
+func contentEncodingOf(readerMaker ReaderMaker) string {
+	if encodedReaderMaker, ok := readerMaker.(ContentEncodingReaderMaker); ok {
+		return encodedReaderMaker.ContentEncoding()
+	}
+	return ""
+}
+
+// ETagReaderMaker is the ReaderMaker which knows the ETag of the object, it's valid after the Reader call
+type ETagReaderMaker interface {
+	ReaderMaker
+	ETag() string
+}
+
+func etagOf(readerMaker ReaderMaker) string {
+	if etagReaderMaker, ok := readerMaker.(ETagReaderMaker); ok {
+		return etagReaderMaker.ETag()
+	}
+	return ""
+}
+
+// RangeReaderMaker is the ReaderMaker which can read the object from the offset,
+// it downloads only the bytes after the offset if the storage supports the range reads
+type RangeReaderMaker interface {
+	ReaderMaker
+	RangeReader(offset int64) (io.ReadCloser, error)
+}
+
+// PartReaderMaker is the ReaderMaker which can download the parts of the object independently,
+// so the large object is downloaded by several concurrent requests. SupportsPartReads is false
+// when the storage would download the object from the beginning for every part.
+// PinVersion reads the current size of the object, and, if the storage can, pins the following
+// part reads to its current version, so the parts of an overwritten object fail instead of mixing
+// two versions. It returns false when the size isn't known.
+type PartReaderMaker interface {
+	ObjectInfoReaderMaker
+	SupportsPartReads() bool
+	PinVersion() (int64, bool, error)
+	PartReader(offset, length int64) (io.ReadCloser, error)
+}
+
+// ObjectInfoReaderMaker is the ReaderMaker which knows the size and the modification time of the stored object,
+// usually from the folder listing. The methods return false when the value isn't known.
+type ObjectInfoReaderMaker interface {
+	ReaderMaker
+	Size() (int64, bool)
+	LastModified() (time.Time, bool)
+}
+
+func sizeOf(readerMaker ReaderMaker) (int64, bool) {
+	if infoReaderMaker, ok := readerMaker.(ObjectInfoReaderMaker); ok {
+		return infoReaderMaker.Size()
+	}
+	return 0, false
+}
+
+func lastModifiedOf(readerMaker ReaderMaker) (time.Time, bool) {
+	if infoReaderMaker, ok := readerMaker.(ObjectInfoReaderMaker); ok {
+		return infoReaderMaker.LastModified()
+	}
+	return time.Time{}, false
+}
+
+// describeObject returns the path with the known size and modification time of the object for the logs
+func describeObject(readerMaker ReaderMaker) string {
+	size, sizeKnown := sizeOf(readerMaker)
+	lastModified, lastModifiedKnown := lastModifiedOf(readerMaker)
+	return readerMaker.Path() + formatObjectInfo(size, sizeKnown, lastModified, lastModifiedKnown)
+}
+
+func formatObjectInfo(size int64, sizeKnown bool, lastModified time.Time, lastModifiedKnown bool) string {
+	switch {
+	case sizeKnown && lastModifiedKnown:
+		return fmt.Sprintf(" (%d bytes, modified %s)", size, lastModified.Format(time.RFC3339))
+	case sizeKnown:
+		return fmt.Sprintf(" (%d bytes)", size)
+	case lastModifiedKnown:
+		return fmt.Sprintf(" (modified %s)", lastModified.Format(time.RFC3339))
 	}
-	return paths
+	return ""
 }
@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/utility"
+)
+
+var MinResumeRetryWait = time.Second
+var MaxResumeRetryWait = 30 * time.Second
+
+// ResumableReaderMaker resumes the download of an object after a transient read error
+// instead of failing the whole file.
+//
+// Decryption and decompression are stateful, so they can't be restarted from the middle of the object.
+// Instead, the resumed byte stream continues exactly at the offset where the failed one stopped,
+// and the pipeline on top of it doesn't notice the reconnect. The RangeReaderMaker reopens the object
+// at the offset, which downloads only the rest of it from the storage supporting the range reads.
+// Otherwise the object is reopened and the already consumed bytes are skipped:
+// the decompression and disk work is saved, but the skipped prefix is downloaded again.
+// S3 with S3_RANGE_BATCH_ENABLED resumes with the Range requests on its own.
+type ResumableReaderMaker struct {
+	ReaderMaker
+	MaxResumes int
+}
+
+func NewResumableReaderMaker(readerMaker ReaderMaker, maxResumes int) *ResumableReaderMaker {
+	return &ResumableReaderMaker{readerMaker, maxResumes}
+}
+
+func (readerMaker *ResumableReaderMaker) Reader() (io.ReadCloser, error) {
+	reader, err := readerMaker.ReaderMaker.Reader()
+	if err != nil || readerMaker.MaxResumes <= 0 {
+		return reader, err
+	}
+	return &resumingReader{
+		readerMaker: readerMaker.ReaderMaker,
+		current:     reader,
+		maxResumes:  readerMaker.MaxResumes,
+		sleeper:     NewExponentialSleeper(MinResumeRetryWait, MaxResumeRetryWait),
+	}, nil
+}
+
+type resumingReader struct {
+	readerMaker ReaderMaker
+	current     io.ReadCloser
+	offset      int64
+	resumes     int
+	maxResumes  int
+	sleeper     Sleeper
+	err         error
+}
+
+func (reader *resumingReader) Read(p []byte) (n int, err error) {
+	if reader.err != nil {
+		return 0, reader.err
+	}
+	n, err = reader.current.Read(p)
+	reader.offset += int64(n)
+	if err == nil || err == io.EOF {
+		return n, err
+	}
+
+	for reader.resumes < reader.maxResumes {
+		reader.resumes++
+		tracelog.WarningLogger.Printf("Failed to read %s at offset %d: %v. Resuming, attempt %d of %d",
+			reader.readerMaker.Path(), reader.offset, err, reader.resumes, reader.maxResumes)
+		reader.sleeper.Sleep()
+
+		resumeErr := reader.resume()
+		if resumeErr == nil {
+			return n, nil
+		}
+		tracelog.WarningLogger.Printf("Failed to resume %s: %v", reader.readerMaker.Path(), resumeErr)
+	}
+	reader.err = errors.Wrapf(err, "failed to read %s after %d resumes", reader.readerMaker.Path(), reader.resumes)
+	return n, reader.err
+}
+
+// resume reopens the object at the offset, or from the beginning skipping the bytes that were already read
+func (reader *resumingReader) resume() error {
+	if reader.current != nil {
+		utility.LoggedClose(reader.current, "")
+		reader.current = nil
+	}
+	if rangeReaderMaker, ok := reader.readerMaker.(RangeReaderMaker); ok {
+		current, err := rangeReaderMaker.RangeReader(reader.offset)
+		if err != nil {
+			return err
+		}
+		reader.current = current
+		return nil
+	}
+	current, err := reader.readerMaker.Reader()
+	if err != nil {
+		return err
+	}
+	reader.current = current
+	_, err = io.CopyN(ioutil.Discard, current, reader.offset)
+	return err
+}
+
+func (reader *resumingReader) Close() error {
+	if reader.current == nil {
+		return nil
+	}
+	return reader.current.Close()
+}
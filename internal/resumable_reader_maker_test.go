@@ -0,0 +1,113 @@
+package internal_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+)
+
+var errConnectionReset = errors.New("connection reset by peer")
+
+// flakyReaderMaker returns readers failing after failAfter bytes for the first failures opens
+type flakyReaderMaker struct {
+	BufferReaderMaker
+	data      []byte
+	failAfter int
+	failures  int
+	opens     int
+}
+
+func (readerMaker *flakyReaderMaker) Reader() (io.ReadCloser, error) {
+	readerMaker.opens++
+	if readerMaker.opens > readerMaker.failures {
+		return ioutil.NopCloser(bytes.NewReader(readerMaker.data)), nil
+	}
+	return ioutil.NopCloser(io.MultiReader(bytes.NewReader(readerMaker.data[:readerMaker.failAfter]),
+		&failingReader{errConnectionReset})), nil
+}
+
+type failingReader struct {
+	err error
+}
+
+func (reader *failingReader) Read(p []byte) (int, error) {
+	return 0, reader.err
+}
+
+func init() {
+	internal.MinResumeRetryWait = 0
+}
+
+func TestResumableReaderMaker_resumesAtOffset(t *testing.T) {
+	data := generateRandomBytes()
+	readerMaker := &flakyReaderMaker{data: data, failAfter: len(data) / 3, failures: 2}
+
+	reader, err := internal.NewResumableReaderMaker(readerMaker, 2).Reader()
+	assert.NoError(t, err)
+	read, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, data, read)
+	assert.Equal(t, 3, readerMaker.opens)
+	assert.NoError(t, reader.Close())
+}
+
+func TestResumableReaderMaker_tooManyFailures(t *testing.T) {
+	data := generateRandomBytes()
+	readerMaker := &flakyReaderMaker{data: data, failAfter: len(data) / 3, failures: 3}
+
+	reader, err := internal.NewResumableReaderMaker(readerMaker, 2).Reader()
+	assert.NoError(t, err)
+	_, err = ioutil.ReadAll(reader)
+	assert.True(t, errors.Is(err, errConnectionReset))
+}
+
+func TestResumableReaderMaker_disabled(t *testing.T) {
+	data := generateRandomBytes()
+	readerMaker := &flakyReaderMaker{data: data, failAfter: len(data) / 3, failures: 1}
+
+	reader, err := internal.NewResumableReaderMaker(readerMaker, 0).Reader()
+	assert.NoError(t, err)
+	_, err = ioutil.ReadAll(reader)
+	assert.Equal(t, errConnectionReset, err)
+}
+
+// rangeFlakyReaderMaker is the flakyReaderMaker which is resumed by the range reads
+type rangeFlakyReaderMaker struct {
+	flakyReaderMaker
+	offsets []int64
+}
+
+func (readerMaker *rangeFlakyReaderMaker) RangeReader(offset int64) (io.ReadCloser, error) {
+	readerMaker.offsets = append(readerMaker.offsets, offset)
+	return ioutil.NopCloser(bytes.NewReader(readerMaker.data[offset:])), nil
+}
+
+func TestResumableReaderMaker_rangeReader(t *testing.T) {
+	data := generateRandomBytes()
+	readerMaker := &rangeFlakyReaderMaker{flakyReaderMaker: flakyReaderMaker{data: data, failAfter: len(data) / 3, failures: 1}}
+
+	reader, err := internal.NewResumableReaderMaker(readerMaker, 2).Reader()
+	assert.NoError(t, err)
+	read, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, data, read)
+	assert.Equal(t, 1, readerMaker.opens)
+	assert.Equal(t, []int64{int64(len(data) / 3)}, readerMaker.offsets)
+}
+
+func TestStorageReaderMaker_rangeReader(t *testing.T) {
+	folder := memory.NewFolder("", memory.NewStorage())
+	assert.NoError(t, folder.PutObject("base_000.tar", bytes.NewBufferString("0123456789")))
+
+	reader, err := internal.NewStorageReaderMaker(folder, "base_000.tar").RangeReader(4)
+	assert.NoError(t, err)
+	read, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "456789", string(read))
+}
@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/pkg/storages/azure"
+	"github.com/wal-g/wal-g/pkg/storages/gcs"
+	"github.com/wal-g/wal-g/pkg/storages/s3"
+	"github.com/wal-g/wal-g/pkg/storages/sh"
+)
+
+const (
+	// SecretFileSuffix marks the setting with the path of the file containing the secret
+	SecretFileSuffix = "_FILE"
+	// SecretFdSuffix marks the setting with the number of the inherited file descriptor to read the secret from
+	SecretFdSuffix = "_FD"
+)
+
+// SecretSettings are the settings which can be read from the file or the file descriptor,
+// so the secret doesn't show in the environment and the command line of the process
+var SecretSettings = []string{
+	LibsodiumKeySetting,
+	PgpKeySetting,
+	PgpKeyPassphraseSetting,
+	PgpPkcs11PinSetting,
+	AgePassphraseSetting,
+	SigningEd25519KeySetting,
+	SigningPgpPassphraseSetting,
+	s3.AccessKeyIdSetting,
+	s3.AccessKeySetting,
+	s3.SecretAccessKeySetting,
+	s3.SecretKeySetting,
+	s3.SessionTokenSetting,
+	azure.AccessKeySetting,
+	azure.SasTokenSetting,
+	gcs.EncryptionKey,
+	sh.Password,
+	"OS_PASSWORD",
+}
+
+type SecretSettingConflictError struct {
+	error
+}
+
+func newSecretSettingConflictError(settings []string) SecretSettingConflictError {
+	return SecretSettingConflictError{
+		errors.Errorf("only one of the settings %s can be set", strings.Join(settings, ", "))}
+}
+
+func (err SecretSettingConflictError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+type SecretSettingReadError struct {
+	error
+}
+
+func newSecretSettingReadError(setting string, value string, err error) SecretSettingReadError {
+	return SecretSettingReadError{errors.Errorf("failed to read the secret of %s='%s': %v", setting, value, err)}
+}
+
+func (err SecretSettingReadError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+func addSecretSourceSettings(allowedSettings map[string]bool) {
+	for _, setting := range SecretSettings {
+		allowedSettings[setting+SecretFileSuffix] = true
+		allowedSettings[setting+SecretFdSuffix] = true
+	}
+}
+
+// resolveSecretSettings sets the secret settings from their files and file descriptors
+func resolveSecretSettings(config *viper.Viper) error {
+	for _, setting := range SecretSettings {
+		var sources []string
+		for _, source := range []string{setting, setting + SecretFileSuffix, setting + SecretFdSuffix} {
+			if config.IsSet(source) {
+				sources = append(sources, source)
+			}
+		}
+		if len(sources) > 1 {
+			return newSecretSettingConflictError(sources)
+		}
+		if len(sources) == 0 || sources[0] == setting {
+			continue
+		}
+
+		source := sources[0]
+		secret, err := readSecret(source, config.GetString(source))
+		if err != nil {
+			return newSecretSettingReadError(source, config.GetString(source), err)
+		}
+		config.Set(setting, secret)
+	}
+	return nil
+}
+
+func readSecret(source string, value string) (string, error) {
+	var content []byte
+	var err error
+	if strings.HasSuffix(source, SecretFileSuffix) {
+		content, err = ioutil.ReadFile(value)
+	} else {
+		content, err = readFileDescriptor(value)
+	}
+	if err != nil {
+		return "", err
+	}
+	// the files written by editors and echo end with the newline, which is never a part of the secret
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+func readFileDescriptor(value string) ([]byte, error) {
+	fd, err := strconv.ParseUint(value, 10, 31)
+	if err != nil {
+		return nil, errors.Wrap(err, "file descriptor number expected")
+	}
+	file := os.NewFile(uintptr(fd), "fd "+value)
+	if file == nil {
+		return nil, errors.New("invalid file descriptor")
+	}
+	defer file.Close()
+	return ioutil.ReadAll(file)
+}
@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveSecretSettings_file(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "libsodium.key")
+	require.NoError(t, ioutil.WriteFile(keyPath, []byte("secret key\n"), 0600))
+	config := viper.New()
+	config.Set(LibsodiumKeySetting+SecretFileSuffix, keyPath)
+
+	require.NoError(t, resolveSecretSettings(config))
+	assert.Equal(t, "secret key", config.GetString(LibsodiumKeySetting))
+}
+
+func TestResolveSecretSettings_fileDescriptor(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	require.NoError(t, err)
+	_, err = writer.WriteString("passphrase\r\n")
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	config := viper.New()
+	config.Set(PgpKeyPassphraseSetting+SecretFdSuffix, strconv.Itoa(int(reader.Fd())))
+
+	require.NoError(t, resolveSecretSettings(config))
+	assert.Equal(t, "passphrase", config.GetString(PgpKeyPassphraseSetting))
+}
+
+func TestResolveSecretSettings_errors(t *testing.T) {
+	config := viper.New()
+	config.Set(AgePassphraseSetting, "passphrase")
+	config.Set(AgePassphraseSetting+SecretFileSuffix, "/run/secrets/age")
+	err := resolveSecretSettings(config)
+	assert.IsType(t, SecretSettingConflictError{}, err)
+	assert.Contains(t, err.Error(), "WALG_AGE_PASSPHRASE, WALG_AGE_PASSPHRASE_FILE")
+
+	config = viper.New()
+	config.Set(AgePassphraseSetting+SecretFileSuffix, filepath.Join(t.TempDir(), "missing"))
+	err = resolveSecretSettings(config)
+	assert.IsType(t, SecretSettingReadError{}, err)
+	assert.Contains(t, err.Error(), "WALG_AGE_PASSPHRASE_FILE")
+
+	config = viper.New()
+	config.Set(AgePassphraseSetting+SecretFdSuffix, "stdin")
+	assert.IsType(t, SecretSettingReadError{}, resolveSecretSettings(config))
+}
@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"hash"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/signing"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+)
+
+// SignatureReaderMaker is the ReaderMaker which can read the detached signature of its object
+type SignatureReaderMaker interface {
+	ReaderMaker
+	Signature() ([]byte, error)
+}
+
+// ReadSignature reads the detached signature object of the object
+func ReadSignature(folder storage.Folder, objectPath string) ([]byte, error) {
+	reader, err := folder.ReadObject(objectPath + signing.SignatureSuffix)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read the signature of %s", objectPath)
+	}
+	defer utility.LoggedClose(reader, "")
+	return ioutil.ReadAll(reader)
+}
+
+// SignatureVerifyingReader checks the signature of the object bytes read through it. The signature can only be
+// checked at the end of the object, so the verification error is returned instead of io.EOF and the data read
+// before it is not verified yet. The readers which may stop before the end of the object call Verify.
+type SignatureVerifyingReader struct {
+	reader     io.Reader
+	objectPath string
+	signature  []byte
+	verifier   signing.Verifier
+	digest     hash.Hash
+
+	// the decompressors reading ahead and Verify may read at once
+	mutex    sync.Mutex
+	finished bool
+	err      error
+}
+
+// VerifyObjectSignature returns the reader of the object which checks its signature at the end
+func VerifyObjectSignature(reader io.Reader, objectPath string, signature []byte,
+	verifier signing.Verifier) *SignatureVerifyingReader {
+	return &SignatureVerifyingReader{
+		reader:     reader,
+		objectPath: objectPath,
+		signature:  signature,
+		verifier:   verifier,
+		digest:     signing.NewDigest(),
+	}
+}
+
+func (reader *SignatureVerifyingReader) Read(p []byte) (int, error) {
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+	if reader.finished {
+		return 0, reader.result()
+	}
+	n, err := reader.reader.Read(p)
+	reader.digest.Write(p[:n])
+	if err == io.EOF {
+		reader.finish()
+		return n, reader.result()
+	}
+	return n, err
+}
+
+// Verify reads the rest of the object and returns the result of the signature check
+func (reader *SignatureVerifyingReader) Verify() error {
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+	if !reader.finished {
+		if _, err := io.Copy(reader.digest, reader.reader); err != nil {
+			return errors.Wrapf(err, "failed to read %s to verify its signature", reader.objectPath)
+		}
+		reader.finish()
+	}
+	return reader.err
+}
+
+func (reader *SignatureVerifyingReader) finish() {
+	reader.finished = true
+	if err := reader.verifier.Verify(reader.digest.Sum(nil), reader.signature); err != nil {
+		reader.err = errors.Wrapf(err, "signature verification of %s failed", reader.objectPath)
+		return
+	}
+	tracelog.DebugLogger.Printf("Verified the signature of %s", reader.objectPath)
+}
+
+func (reader *SignatureVerifyingReader) result() error {
+	if reader.err != nil {
+		return reader.err
+	}
+	return io.EOF
+}
+
+// verifiedAtEOFReader checks the signature at the end of the decompressed data, as the decompressor may stop
+// before the end of the object, and on the decompression failure, which the modified object is likely to cause
+type verifiedAtEOFReader struct {
+	io.Reader
+	signatureReader *SignatureVerifyingReader
+}
+
+func (reader *verifiedAtEOFReader) Read(p []byte) (int, error) {
+	n, err := reader.Reader.Read(p)
+	if err != nil {
+		if verifyErr := reader.signatureReader.Verify(); verifyErr != nil {
+			return n, verifyErr
+		}
+	}
+	return n, err
+}
+
+func verifyReaderMakerSignature(reader io.Reader, readerMaker ReaderMaker,
+	verifier signing.Verifier) (*SignatureVerifyingReader, error) {
+	signatureReaderMaker, ok := readerMaker.(SignatureReaderMaker)
+	if !ok {
+		return nil, errors.Errorf("the signature of %s can't be read", readerMaker.Path())
+	}
+	signature, err := signatureReaderMaker.Signature()
+	if err != nil {
+		return nil, err
+	}
+	return VerifyObjectSignature(reader, readerMaker.Path(), signature, verifier), nil
+}
+
+// verifyStorageFileSignature is VerifyObjectSignature of the object read from the folder
+func verifyStorageFileSignature(folder storage.Folder, objectPath string, object io.Reader,
+	verifier signing.Verifier) (*SignatureVerifyingReader, error) {
+	signature, err := ReadSignature(folder, objectPath)
+	if err != nil {
+		return nil, err
+	}
+	return VerifyObjectSignature(object, objectPath, signature, verifier), nil
+}
@@ -0,0 +1,150 @@
+package internal_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/compression/lz4"
+	"github.com/wal-g/wal-g/internal/signing"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/testtools"
+)
+
+func TestExtractAll_verifySignature(t *testing.T) {
+	os.Setenv(internal.DownloadConcurrencySetting, "1")
+	defer os.Unsetenv(internal.DownloadConcurrencySetting)
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := signing.NewEd25519Signer(base64.StdEncoding.EncodeToString(privateKey))
+	require.NoError(t, err)
+
+	folder := memory.NewFolder("", memory.NewStorage())
+	uploader := internal.NewUploader(nil, folder)
+	uploader.Signer = signer
+	brm, b := makeTar("booba")
+	require.NoError(t, uploader.Upload("part_1.tar", brm.Buf))
+	exists, err := folder.Exists("part_1.tar" + signing.SignatureSuffix)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	viper.Set(internal.VerifySignatureSetting, true)
+	defer viper.Set(internal.VerifySignatureSetting, false)
+	viper.Set(internal.VerifyEd25519KeySetting, base64.StdEncoding.EncodeToString(publicKey))
+	defer viper.Set(internal.VerifyEd25519KeySetting, nil)
+
+	buf := &testtools.BufferTarInterpreter{}
+	err = internal.ExtractAllWithSleeper(buf,
+		[]internal.ReaderMaker{internal.NewStorageReaderMaker(folder, "part_1.tar")}, NOPSleeper{})
+	require.NoError(t, err)
+	assert.Equal(t, b, buf.Out)
+
+	// the tampered object fails the extraction at its end and is not retried
+	tampered := readFolderObject(t, folder, "part_1.tar")
+	tampered[len(tampered)/2] ^= 0xff
+	require.NoError(t, folder.PutObject("part_1.tar", bytes.NewReader(tampered)))
+	buf = &testtools.BufferTarInterpreter{}
+	sleeper := &countingSleeper{}
+	err = internal.ExtractAllWithSleeper(buf,
+		[]internal.ReaderMaker{internal.NewStorageReaderMaker(folder, "part_1.tar")}, sleeper)
+	assert.True(t, errors.Is(err, signing.ErrSignatureMismatch), "unexpected error: %v", err)
+	assert.Zero(t, sleeper.sleeps)
+}
+
+func TestDownloadFileTo_verifySignature(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := signing.NewEd25519Signer(base64.StdEncoding.EncodeToString(privateKey))
+	require.NoError(t, err)
+	viper.Set(internal.VerifySignatureSetting, true)
+	defer viper.Set(internal.VerifySignatureSetting, false)
+	viper.Set(internal.VerifyEd25519KeySetting, base64.StdEncoding.EncodeToString(publicKey))
+	defer viper.Set(internal.VerifyEd25519KeySetting, nil)
+
+	folder := memory.NewFolder("", memory.NewStorage())
+	uploader := internal.NewUploader(nil, folder)
+	uploader.Signer = signer
+	compressed := new(bytes.Buffer)
+	writer := compression.Compressors[lz4.AlgorithmName].NewWriter(compressed)
+	_, err = writer.Write(bytes.Repeat([]byte("wal"), 1000))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	require.NoError(t, uploader.Upload("000000010000000000000001.lz4", bytes.NewReader(compressed.Bytes())))
+
+	destination := filepath.Join(t.TempDir(), "000000010000000000000001")
+	require.NoError(t, internal.DownloadFileTo(folder, "000000010000000000000001", destination))
+	assert.FileExists(t, destination)
+
+	// the WAL file written before the signature is checked is removed
+	tampered := compressed.Bytes()
+	tampered[len(tampered)-1] ^= 0xff
+	require.NoError(t, folder.PutObject("000000010000000000000001.lz4", bytes.NewReader(tampered)))
+	destination = filepath.Join(t.TempDir(), "000000010000000000000001")
+	err = internal.DownloadFileTo(folder, "000000010000000000000001", destination)
+	assert.True(t, errors.Is(err, signing.ErrSignatureMismatch), "unexpected error: %v", err)
+	assert.NoFileExists(t, destination)
+}
+
+func TestVerifyObjectSignature(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := signing.NewEd25519Signer(base64.StdEncoding.EncodeToString(privateKey))
+	require.NoError(t, err)
+	verifier, err := signing.NewEd25519Verifier(base64.StdEncoding.EncodeToString(publicKey))
+	require.NoError(t, err)
+	content := bytes.Repeat([]byte("signed"), 1000)
+	digest := signing.NewDigest()
+	digest.Write(content)
+	signature, err := signer.Sign(digest.Sum(nil))
+	require.NoError(t, err)
+
+	// the object is streamed and checked at its end
+	reader := internal.VerifyObjectSignature(bytes.NewReader(content), "object", signature, verifier)
+	read, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, content, read)
+	assert.NoError(t, reader.Verify())
+
+	// the rest of the object is read by Verify
+	reader = internal.VerifyObjectSignature(bytes.NewReader(content), "object", signature, verifier)
+	_, err = reader.Read(make([]byte, 10))
+	require.NoError(t, err)
+	assert.NoError(t, reader.Verify())
+
+	tampered := append([]byte{}, content...)
+	tampered[len(tampered)-1] ^= 0xff
+	reader = internal.VerifyObjectSignature(bytes.NewReader(tampered), "object", signature, verifier)
+	_, err = ioutil.ReadAll(reader)
+	assert.True(t, errors.Is(err, signing.ErrSignatureMismatch), "unexpected error: %v", err)
+	assert.True(t, errors.Is(reader.Verify(), signing.ErrSignatureMismatch))
+}
+
+func TestExtractAll_verifySignatureWithoutKey(t *testing.T) {
+	viper.Set(internal.VerifySignatureSetting, true)
+	defer viper.Set(internal.VerifySignatureSetting, false)
+
+	brm, _ := makeTar("booba")
+	err := internal.ExtractAllWithSleeper(&testtools.BufferTarInterpreter{}, []internal.ReaderMaker{&brm}, NOPSleeper{})
+	assert.Error(t, err)
+}
+
+func readFolderObject(t *testing.T, folder *memory.Folder, name string) []byte {
+	object, err := folder.ReadObject(name)
+	require.NoError(t, err)
+	defer object.Close()
+	contents := new(bytes.Buffer)
+	_, err = contents.ReadFrom(object)
+	require.NoError(t, err)
+	return contents.Bytes()
+}
@@ -0,0 +1,67 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type Ed25519Signer struct {
+	key ed25519.PrivateKey
+}
+
+// NewEd25519Signer creates the signer of the base64 encoded raw Ed25519 key,
+// either the 32 byte seed or the 64 byte private key
+func NewEd25519Signer(encodedKey string) (Signer, error) {
+	key, err := decodeKey(encodedKey)
+	if err != nil {
+		return nil, newInvalidKeyError("Ed25519", err)
+	}
+	switch len(key) {
+	case ed25519.SeedSize:
+		return &Ed25519Signer{ed25519.NewKeyFromSeed(key)}, nil
+	case ed25519.PrivateKeySize:
+		return &Ed25519Signer{key}, nil
+	default:
+		return nil, newInvalidKeyError("Ed25519", errors.Errorf("the key of %d bytes, %d or %d expected",
+			len(key), ed25519.SeedSize, ed25519.PrivateKeySize))
+	}
+}
+
+func (signer *Ed25519Signer) Name() string {
+	return "Ed25519"
+}
+
+func (signer *Ed25519Signer) Sign(digest []byte) ([]byte, error) {
+	return ed25519.Sign(signer.key, digest), nil
+}
+
+type Ed25519Verifier struct {
+	key ed25519.PublicKey
+}
+
+// NewEd25519Verifier creates the verifier of the base64 encoded raw 32 byte Ed25519 public key
+func NewEd25519Verifier(encodedKey string) (Verifier, error) {
+	key, err := decodeKey(encodedKey)
+	if err != nil {
+		return nil, newInvalidKeyError("Ed25519", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, newInvalidKeyError("Ed25519", errors.Errorf("the public key of %d bytes, %d expected",
+			len(key), ed25519.PublicKeySize))
+	}
+	return &Ed25519Verifier{key}, nil
+}
+
+func (verifier *Ed25519Verifier) Verify(digest []byte, signature []byte) error {
+	if !ed25519.Verify(verifier.key, digest, signature) {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
+
+func decodeKey(encodedKey string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(encodedKey))
+}
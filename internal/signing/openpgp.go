@@ -0,0 +1,68 @@
+package signing
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+	pgperrors "golang.org/x/crypto/openpgp/errors"
+)
+
+type OpenPGPSigner struct {
+	entity *openpgp.Entity
+}
+
+// NewOpenPGPSigner creates the signer of the first key of the armored private key ring
+func NewOpenPGPSigner(armoredKey string, passphrase string) (Signer, error) {
+	entityList, err := openpgp.ReadArmoredKeyRing(strings.NewReader(armoredKey))
+	if err != nil {
+		return nil, newInvalidKeyError("OpenPGP", err)
+	}
+	entity := entityList[0]
+	if entity.PrivateKey == nil {
+		return nil, newInvalidKeyError("OpenPGP", errors.New("the private key expected"))
+	}
+	if entity.PrivateKey.Encrypted {
+		if err = entity.PrivateKey.Decrypt([]byte(passphrase)); err != nil {
+			return nil, newInvalidKeyError("OpenPGP", err)
+		}
+	}
+	return &OpenPGPSigner{entity}, nil
+}
+
+func (signer *OpenPGPSigner) Name() string {
+	return "OpenPGP"
+}
+
+func (signer *OpenPGPSigner) Sign(digest []byte) ([]byte, error) {
+	var signature bytes.Buffer
+	if err := openpgp.DetachSign(&signature, signer.entity, bytes.NewReader(digest), nil); err != nil {
+		return nil, errors.Wrap(err, "failed to sign")
+	}
+	return signature.Bytes(), nil
+}
+
+type OpenPGPVerifier struct {
+	keyRing openpgp.EntityList
+}
+
+// NewOpenPGPVerifier creates the verifier of the armored key ring, the signature of any of its keys is valid
+func NewOpenPGPVerifier(armoredKeyRing string) (Verifier, error) {
+	keyRing, err := openpgp.ReadArmoredKeyRing(strings.NewReader(armoredKeyRing))
+	if err != nil {
+		return nil, newInvalidKeyError("OpenPGP", err)
+	}
+	return &OpenPGPVerifier{keyRing}, nil
+}
+
+func (verifier *OpenPGPVerifier) Verify(digest []byte, signature []byte) error {
+	_, err := openpgp.CheckDetachedSignature(verifier.keyRing, bytes.NewReader(digest), bytes.NewReader(signature))
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(pgperrors.SignatureError); ok || err == pgperrors.ErrUnknownIssuer {
+		return errors.Wrapf(ErrSignatureMismatch, "%v", err)
+	}
+	return errors.Wrap(err, "failed to check the signature")
+}
@@ -0,0 +1,44 @@
+package signing
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+)
+
+// SignatureSuffix is appended to the object name to get the name of its detached signature object
+const SignatureSuffix = ".sig"
+
+// ErrSignatureMismatch is returned when the signature doesn't match the object, e.g. the object was modified
+var ErrSignatureMismatch = errors.New("the signature doesn't match the object")
+
+// Signer signs the digest of the stored object, the signature is stored as the separate object
+type Signer interface {
+	Name() string
+	Sign(digest []byte) ([]byte, error)
+}
+
+// Verifier checks the signature of the digest, the mismatch is reported as ErrSignatureMismatch
+type Verifier interface {
+	Verify(digest []byte, signature []byte) error
+}
+
+// NewDigest returns the hash of the object bytes, as they are stored, which is signed
+func NewDigest() hash.Hash {
+	return sha256.New()
+}
+
+type InvalidKeyError struct {
+	error
+}
+
+func newInvalidKeyError(format string, err error) InvalidKeyError {
+	return InvalidKeyError{errors.Errorf("invalid %s signing key: %v", format, err)}
+}
+
+func (err InvalidKeyError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
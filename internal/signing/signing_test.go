@@ -0,0 +1,63 @@
+package signing_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/signing"
+)
+
+const PrivateKeyFilePath = "../crypto/openpgp/testdata/pgpTestPrivateKey"
+
+func digestOf(data string) []byte {
+	digest := signing.NewDigest()
+	digest.Write([]byte(data))
+	return digest.Sum(nil)
+}
+
+func TestEd25519_signAndVerify(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	for _, key := range [][]byte{privateKey, privateKey.Seed()} {
+		signer, err := signing.NewEd25519Signer(base64.StdEncoding.EncodeToString(key))
+		require.NoError(t, err)
+		verifier, err := signing.NewEd25519Verifier(base64.StdEncoding.EncodeToString(publicKey) + "\n")
+		require.NoError(t, err)
+
+		signature, err := signer.Sign(digestOf("object"))
+		require.NoError(t, err)
+		assert.NoError(t, verifier.Verify(digestOf("object"), signature))
+		assert.ErrorIs(t, verifier.Verify(digestOf("tampered object"), signature), signing.ErrSignatureMismatch)
+	}
+
+	_, err = signing.NewEd25519Signer(base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.IsType(t, signing.InvalidKeyError{}, err)
+	_, err = signing.NewEd25519Verifier("not base64")
+	assert.IsType(t, signing.InvalidKeyError{}, err)
+}
+
+func TestOpenPGP_signAndVerify(t *testing.T) {
+	armoredKey, err := ioutil.ReadFile(PrivateKeyFilePath)
+	require.NoError(t, err)
+	signer, err := signing.NewOpenPGPSigner(string(armoredKey), "")
+	require.NoError(t, err)
+	// the private key ring contains the public key too
+	verifier, err := signing.NewOpenPGPVerifier(string(armoredKey))
+	require.NoError(t, err)
+
+	signature, err := signer.Sign(digestOf("object"))
+	require.NoError(t, err)
+	assert.NoError(t, verifier.Verify(digestOf("object"), signature))
+	assert.ErrorIs(t, verifier.Verify(digestOf("tampered object"), signature), signing.ErrSignatureMismatch)
+
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ed25519Signature := ed25519.Sign(ed25519Key, digestOf("object"))
+	assert.Error(t, verifier.Verify(digestOf("object"), ed25519Signature))
+}
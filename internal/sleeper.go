@@ -1,5 +1,26 @@
 package internal
 
+import (
+	"time"
+
+	"github.com/wal-g/tracelog"
+)
+
 type Sleeper interface {
 	Sleep()
 }
+
+// DurationSleeper is the Sleeper which tells how long its next Sleep lasts, so the wait can be logged in advance
+type DurationSleeper interface {
+	Sleeper
+	NextSleepDuration() time.Duration
+}
+
+// logRetryDelay logs the pause before the retry, its duration is known for the DurationSleeper only
+func logRetryDelay(sleeper Sleeper, retried string) {
+	if durationSleeper, ok := sleeper.(DurationSleeper); ok {
+		tracelog.InfoLogger.Printf("Retrying %s in %v", retried, durationSleeper.NextSleepDuration())
+		return
+	}
+	tracelog.InfoLogger.Printf("Retrying %s", retried)
+}
@@ -18,6 +18,7 @@ type StorageAdapter struct {
 	settingNames       []string
 	configureFolder    func(string, map[string]string) (storage.Folder, error)
 	prefixPreprocessor func(string) string
+	isRetryableError   func(error) bool
 }
 
 func (adapter *StorageAdapter) loadSettings(config *viper.Viper) map[string]string {
@@ -46,11 +47,21 @@ func preprocessFilePrefix(prefix string) string {
 	return strings.TrimPrefix(prefix, WaleFileHost) // WAL-E backward compatibility
 }
 
+// storageSchemePrefixNames maps the schemes of the storage prefixes to the adapters
+var storageSchemePrefixNames = map[string]string{
+	"s3":    "S3_PREFIX",
+	"gs":    "GS_PREFIX",
+	"azure": "AZ_PREFIX",
+	"swift": "SWIFT_PREFIX",
+	"ssh":   "SSH_PREFIX",
+	"sftp":  "SSH_PREFIX",
+}
+
 var StorageAdapters = []StorageAdapter{
-	{"S3_PREFIX", s3.SettingList, s3.ConfigureFolder, nil},
-	{"FILE_PREFIX", nil, fs.ConfigureFolder, preprocessFilePrefix},
-	{"GS_PREFIX", gcs.SettingList, gcs.ConfigureFolder, nil},
-	{"AZ_PREFIX", azure.SettingList, azure.ConfigureFolder, nil},
-	{"SWIFT_PREFIX", swift.SettingList, swift.ConfigureFolder, nil},
-	{"SSH_PREFIX", sh.SettingsList, sh.ConfigureFolder, nil},
+	{"S3_PREFIX", s3.SettingList, s3.ConfigureFolder, nil, s3.IsRetryableError},
+	{"FILE_PREFIX", nil, fs.ConfigureFolder, preprocessFilePrefix, nil},
+	{"GS_PREFIX", gcs.SettingList, gcs.ConfigureFolder, nil, gcs.IsRetryableError},
+	{"AZ_PREFIX", azure.SettingList, azure.ConfigureFolder, nil, azure.IsRetryableError},
+	{"SWIFT_PREFIX", swift.SettingList, swift.ConfigureFolder, nil, swift.IsRetryableError},
+	{"SSH_PREFIX", sh.SettingsList, sh.ConfigureFolder, nil, nil},
 }
@@ -2,6 +2,7 @@ package internal
 
 import (
 	"io"
+	"time"
 
 	"github.com/wal-g/wal-g/pkg/storages/storage"
 )
@@ -12,20 +13,126 @@ type StorageReaderMaker struct {
 	RelativePath    string
 	StorageFileType FileType
 	FileMode        int
+	// Object is the listed object of RelativePath, if the caller has it, the size and modification time come from it
+	Object storage.Object
+
+	contentEncoding string
+	etag            string
+	// version is pinned by PinVersion, the part reads fail once the object isn't of this version
+	version *storage.ObjectVersion
 }
 
 func NewStorageReaderMaker(folder storage.Folder, relativePath string) *StorageReaderMaker {
-	return &StorageReaderMaker{folder, relativePath, TarFileType, 0}
+	return &StorageReaderMaker{Folder: folder, RelativePath: relativePath, StorageFileType: TarFileType}
 }
 
 func NewRegularFileStorageReaderMarker(folder storage.Folder, relativePath string, fileMode int) *StorageReaderMaker {
-	return &StorageReaderMaker{folder, relativePath, RegularFileType, fileMode}
+	return &StorageReaderMaker{Folder: folder, RelativePath: relativePath,
+		StorageFileType: RegularFileType, FileMode: fileMode}
 }
 
 func (readerMaker *StorageReaderMaker) Path() string { return readerMaker.RelativePath }
 
 func (readerMaker *StorageReaderMaker) Reader() (io.ReadCloser, error) {
-	return readerMaker.Folder.ReadObject(readerMaker.RelativePath)
+	reader, err := readerMaker.Folder.ReadObject(readerMaker.RelativePath)
+	if err != nil {
+		return nil, err
+	}
+	readerMaker.readAttributes(reader)
+	return reader, nil
+}
+
+func (readerMaker *StorageReaderMaker) readAttributes(reader io.ReadCloser) {
+	readerMaker.contentEncoding = ""
+	if encodedReader, ok := reader.(storage.ContentEncodingReader); ok {
+		readerMaker.contentEncoding = encodedReader.ContentEncoding()
+	}
+	readerMaker.etag = ""
+	if etagReader, ok := reader.(storage.ETagReader); ok {
+		readerMaker.etag = etagReader.ETag()
+	}
+}
+
+// ObjectTier tells whether the object is archived, see storage.GetObjectTier
+func (readerMaker *StorageReaderMaker) ObjectTier() (storage.ObjectTier, error) {
+	return storage.GetObjectTier(readerMaker.Folder, readerMaker.RelativePath)
+}
+
+// RangeReader reads the object from the offset, see storage.ReadObjectRange
+func (readerMaker *StorageReaderMaker) RangeReader(offset int64) (io.ReadCloser, error) {
+	return storage.ReadObjectRange(readerMaker.Folder, readerMaker.RelativePath, offset, -1)
+}
+
+// SupportsPartReads is true for the folders reading the ranges of the objects, see storage.SupportsRangeReads
+func (readerMaker *StorageReaderMaker) SupportsPartReads() bool {
+	return storage.SupportsRangeReads(readerMaker.Folder)
+}
+
+// PinVersion reads the size and the version of the object if the folder pins the reads,
+// see storage.SupportsPinnedReads, otherwise it returns the listed size of the object
+func (readerMaker *StorageReaderMaker) PinVersion() (int64, bool, error) {
+	if !storage.SupportsPinnedReads(readerMaker.Folder) {
+		size, known := readerMaker.Size()
+		return size, known, nil
+	}
+	version, err := storage.GetObjectVersion(readerMaker.Folder, readerMaker.RelativePath)
+	if err != nil {
+		return 0, false, err
+	}
+	readerMaker.version = &version
+	return version.Size, true, nil
+}
+
+// PartReader reads length bytes of the object from the offset, of the version pinned by PinVersion if any.
+// The part at the zero offset sets the content encoding and the ETag like Reader,
+// so it must be read before the other parts.
+func (readerMaker *StorageReaderMaker) PartReader(offset, length int64) (io.ReadCloser, error) {
+	var reader io.ReadCloser
+	var err error
+	if readerMaker.version != nil {
+		reader, err = storage.ReadPinnedObjectRange(readerMaker.Folder, readerMaker.RelativePath,
+			offset, length, *readerMaker.version)
+	} else {
+		reader, err = storage.ReadObjectRange(readerMaker.Folder, readerMaker.RelativePath, offset, length)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if offset == 0 {
+		readerMaker.readAttributes(reader)
+	}
+	return reader, nil
+}
+
+// ContentEncoding is reported by the storage when the object is read
+func (readerMaker *StorageReaderMaker) ContentEncoding() string { return readerMaker.contentEncoding }
+
+// ETag is reported by the storage when the object is read. If it isn't, e.g. GCS reports the MD5
+// of the object only in the listing, the ETag of the listed Object is used.
+func (readerMaker *StorageReaderMaker) ETag() string {
+	if readerMaker.etag == "" && readerMaker.Object != nil {
+		return storage.ETagOf(readerMaker.Object)
+	}
+	return readerMaker.etag
+}
+
+// Signature reads the detached signature object
+func (readerMaker *StorageReaderMaker) Signature() ([]byte, error) {
+	return ReadSignature(readerMaker.Folder, readerMaker.RelativePath)
+}
+
+func (readerMaker *StorageReaderMaker) Size() (int64, bool) {
+	if readerMaker.Object == nil {
+		return 0, false
+	}
+	return readerMaker.Object.GetSize(), true
+}
+
+func (readerMaker *StorageReaderMaker) LastModified() (time.Time, bool) {
+	if readerMaker.Object == nil {
+		return time.Time{}, false
+	}
+	return readerMaker.Object.GetLastModified(), true
 }
 
 func (readerMaker *StorageReaderMaker) FileType() FileType { return readerMaker.StorageFileType }
@@ -25,6 +25,8 @@ type StorageTarBall struct {
 	tarWriter   *tar.Writer
 	uploader    *Uploader
 	name        string
+	// uncompressed tarballs are uploaded as plain tar files, see CompressionPolicy
+	uncompressed bool
 }
 
 func (tarBall *StorageTarBall) Name() string {
@@ -34,12 +36,16 @@ func (tarBall *StorageTarBall) Name() string {
 // SetUp creates a new tar writer and starts upload to storage.
 // Upload will block until the tar file is finished writing.
 // If a name for the file is not given, default name is of
-// the form `part_....tar.[Compressor file extension]`.
+// the form `part_....tar.[Compressor file extension]`,
+// or `part_....tar` for the uncompressed tarballs.
 func (tarBall *StorageTarBall) SetUp(crypter crypto.Crypter, names ...string) {
 	if tarBall.tarWriter == nil {
-		if len(names) > 0 {
+		switch {
+		case len(names) > 0:
 			tarBall.name = names[0]
-		} else {
+		case tarBall.uncompressed:
+			tarBall.name = fmt.Sprintf("part_%0.3d.tar", tarBall.partNumber)
+		default:
 			tarBall.name = fmt.Sprintf("part_%0.3d.tar.%v", tarBall.partNumber, tarBall.uploader.Compressor.FileExtension())
 		}
 		writeCloser := tarBall.startUpload(tarBall.name, crypter)
@@ -114,6 +120,9 @@ func (tarBall *StorageTarBall) startUpload(name string, crypter crypto.Crypter)
 		writerToCompress = &utility.CascadeWriteCloser{WriteCloser: encryptedWriter, Underlying: pipeWriter}
 	}
 
+	if tarBall.uncompressed {
+		return writerToCompress
+	}
 	return &utility.CascadeWriteCloser{WriteCloser: uploader.Compressor.NewWriter(writerToCompress),
 		Underlying: writerToCompress}
 }
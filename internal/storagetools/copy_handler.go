@@ -0,0 +1,163 @@
+package storagetools
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"golang.org/x/sync/errgroup"
+)
+
+// Copier copies the objects from one storage folder to another, on the server if both are of the
+// same storage. The objects already copied are skipped, so the interrupted copy is resumed by running it again.
+type Copier struct {
+	source      storage.Folder
+	destination storage.Folder
+	filter      string
+
+	copied          int64
+	copiedBytes     int64
+	serverSide      int64
+	skipped         int64
+	skippedBytes    int64
+	existingObjects map[string]storage.Object
+}
+
+// NewCopier returns the copier of the source objects whose names match the filter glob, all of them if it is empty.
+// See matchFilter for the glob syntax.
+func NewCopier(source, destination storage.Folder, filter string) (*Copier, error) {
+	if filter != "" {
+		if _, err := path.Match(filter, ""); err != nil {
+			return nil, errors.Wrapf(err, "invalid filter '%s'", filter)
+		}
+	}
+	return &Copier{source: source, destination: destination, filter: filter}, nil
+}
+
+// HandleCopy copies all the matching objects of the source folder recursively
+func HandleCopy(copier *Copier, concurrency int) error {
+	objects, err := storage.ListFolderRecursively(copier.source)
+	if err != nil {
+		return errors.Wrap(err, "failed to list the source folder")
+	}
+	existing, err := storage.ListFolderRecursively(copier.destination)
+	if err != nil {
+		return errors.Wrap(err, "failed to list the destination folder")
+	}
+	copier.existingObjects = make(map[string]storage.Object, len(existing))
+	for _, object := range existing {
+		copier.existingObjects[object.GetName()] = object
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	group, ctx := errgroup.WithContext(context.Background())
+	toCopy := make(chan storage.Object)
+	for i := 0; i < concurrency; i++ {
+		group.Go(func() error {
+			for object := range toCopy {
+				if err := copier.Copy(object); err != nil {
+					return errors.Wrapf(err, "failed to copy %s", object.GetName())
+				}
+			}
+			return nil
+		})
+	}
+
+	group.Go(func() error {
+		defer close(toCopy)
+		for _, object := range objects {
+			if copier.filter != "" {
+				if !matchFilter(copier.filter, object.GetName()) {
+					continue
+				}
+			}
+			select {
+			case toCopy <- object:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		return nil
+	})
+
+	err = group.Wait()
+	tracelog.InfoLogger.Printf("Copied %d objects (%d bytes), %d of them on the server, "+
+		"skipped %d already copied objects (%d bytes)",
+		atomic.LoadInt64(&copier.copied), atomic.LoadInt64(&copier.copiedBytes), atomic.LoadInt64(&copier.serverSide),
+		atomic.LoadInt64(&copier.skipped), atomic.LoadInt64(&copier.skippedBytes))
+	return err
+}
+
+// matchFilter matches the object name by the glob segment by segment: "*" doesn't cross the slashes,
+// "**" matches any number of the folders, and the filter ending with the slash matches everything in the folder,
+// e.g. "basebackups_005/" is "basebackups_005/**"
+func matchFilter(filter, name string) bool {
+	if strings.HasSuffix(filter, "/") {
+		filter += "**"
+	}
+	return matchSegments(strings.Split(filter, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(patterns, segments []string) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			for skipped := 0; skipped <= len(segments); skipped++ {
+				if matchSegments(patterns[1:], segments[skipped:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(patterns[0], segments[0]); !matched {
+			return false
+		}
+		patterns, segments = patterns[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// Copy copies a single object, unless the destination already has the same one
+func (copier *Copier) Copy(object storage.Object) error {
+	if copier.isCopied(object) {
+		tracelog.DebugLogger.Printf("Skipping %s: already copied", object.GetName())
+		atomic.AddInt64(&copier.skipped, 1)
+		atomic.AddInt64(&copier.skippedBytes, object.GetSize())
+		return nil
+	}
+
+	tracelog.InfoLogger.Printf("Copying %s", object.GetName())
+	serverSide, err := storage.CopyObjectBetween(copier.source, object.GetName(), copier.destination, object.GetName())
+	if err != nil {
+		return err
+	}
+	if serverSide {
+		atomic.AddInt64(&copier.serverSide, 1)
+	}
+	atomic.AddInt64(&copier.copied, 1)
+	atomic.AddInt64(&copier.copiedBytes, object.GetSize())
+	return nil
+}
+
+// isCopied compares the sizes of the objects and, if both storages report the MD5 of the contents, the MD5s too
+func (copier *Copier) isCopied(object storage.Object) bool {
+	existing, ok := copier.existingObjects[object.GetName()]
+	if !ok || existing.GetSize() != object.GetSize() {
+		return false
+	}
+	md5, ok := storage.PlainMD5FromETag(storage.ETagOf(object))
+	if !ok {
+		return true
+	}
+	existingMD5, ok := storage.PlainMD5FromETag(storage.ETagOf(existing))
+	return !ok || bytes.Equal(md5, existingMD5)
+}
@@ -0,0 +1,91 @@
+package storagetools_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/storagetools"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+func listContents(t *testing.T, folder storage.Folder) map[string]string {
+	objects, err := storage.ListFolderRecursively(folder)
+	require.NoError(t, err)
+	contents := make(map[string]string)
+	for _, object := range objects {
+		contents[object.GetName()] = readObject(t, folder, object.GetName())
+	}
+	return contents
+}
+
+func newCopyFolders(t *testing.T) (source, destination storage.Folder) {
+	source = memory.NewFolder("source/", memory.NewStorage())
+	destination = memory.NewFolder("destination/", memory.NewStorage())
+	for name, content := range map[string]string{
+		"basebackups_005/base_1/part_1.tar.lz4": "part 1",
+		"wal_005/000000010000000000000001.lz4":  "wal 1",
+		"wal_005/000000010000000000000002.lz4":  "wal 2",
+	} {
+		require.NoError(t, source.PutObject(name, bytes.NewBufferString(content)))
+	}
+	return source, destination
+}
+
+func TestHandleCopy(t *testing.T) {
+	source, destination := newCopyFolders(t)
+	copier, err := storagetools.NewCopier(source, destination, "")
+	require.NoError(t, err)
+	require.NoError(t, storagetools.HandleCopy(copier, 2))
+	assert.Equal(t, listContents(t, source), listContents(t, destination))
+}
+
+func TestHandleCopy_filter(t *testing.T) {
+	source, destination := newCopyFolders(t)
+	copier, err := storagetools.NewCopier(source, destination, "wal_005/*")
+	require.NoError(t, err)
+	require.NoError(t, storagetools.HandleCopy(copier, 2))
+	assert.Equal(t, map[string]string{
+		"wal_005/000000010000000000000001.lz4": "wal 1",
+		"wal_005/000000010000000000000002.lz4": "wal 2",
+	}, listContents(t, destination))
+
+	_, err = storagetools.NewCopier(source, destination, "[")
+	assert.Error(t, err)
+}
+
+func TestHandleCopy_nestedFilter(t *testing.T) {
+	for _, filter := range []string{"basebackups_005/**", "basebackups_005/", "**/*.tar.lz4", "basebackups_005/*/part_?.tar.lz4"} {
+		source, destination := newCopyFolders(t)
+		copier, err := storagetools.NewCopier(source, destination, filter)
+		require.NoError(t, err)
+		require.NoError(t, storagetools.HandleCopy(copier, 2))
+		assert.Equal(t, map[string]string{"basebackups_005/base_1/part_1.tar.lz4": "part 1"},
+			listContents(t, destination), filter)
+	}
+
+	// "*" doesn't cross the slashes
+	source, destination := newCopyFolders(t)
+	copier, err := storagetools.NewCopier(source, destination, "basebackups_005/*")
+	require.NoError(t, err)
+	require.NoError(t, storagetools.HandleCopy(copier, 2))
+	assert.Empty(t, listContents(t, destination))
+}
+
+func TestHandleCopy_resume(t *testing.T) {
+	source, destination := newCopyFolders(t)
+	// the previous run copied the first WAL file and was interrupted copying the second one
+	require.NoError(t, destination.PutObject("wal_005/000000010000000000000001.lz4", bytes.NewBufferString("wal 1")))
+	require.NoError(t, destination.PutObject("wal_005/000000010000000000000002.lz4", bytes.NewBufferString("wa")))
+	require.NoError(t, source.PutObject("wal_005/000000010000000000000001.lz4", bytes.NewBufferString("WAL 1")))
+
+	copier, err := storagetools.NewCopier(source, destination, "")
+	require.NoError(t, err)
+	require.NoError(t, storagetools.HandleCopy(copier, 1))
+	contents := listContents(t, destination)
+	assert.Equal(t, "wal 1", contents["wal_005/000000010000000000000001.lz4"], "same size object is skipped")
+	assert.Equal(t, "wal 2", contents["wal_005/000000010000000000000002.lz4"])
+	assert.Equal(t, "part 1", contents["basebackups_005/base_1/part_1.tar.lz4"])
+}
@@ -5,13 +5,19 @@ import (
 	"github.com/wal-g/wal-g/pkg/storages/storage"
 )
 
-func HandleDeleteObject(objectPath string, folder storage.Folder) {
+// HandleDeleteObject deletes the object only if confirmed, otherwise it is a dry run like the other deletions
+func HandleDeleteObject(objectPath string, folder storage.Folder, confirmed bool) {
 	// some storages may not produce an error on deleting the non-existing object
 	exists, err := folder.Exists(objectPath)
 	tracelog.ErrorLogger.FatalfOnError("Failed to check object existence: %v", err)
 	if !exists {
 		tracelog.ErrorLogger.Fatalf("Object %s does not exist", objectPath)
 	}
+	tracelog.InfoLogger.Println("will be deleted: " + objectPath)
+	if !confirmed {
+		tracelog.InfoLogger.Println("Dry run, nothing were deleted. Add --confirm to delete the object")
+		return
+	}
 	err = folder.DeleteObjects([]string{objectPath})
 	tracelog.ErrorLogger.FatalfOnError("Failed to delete the specified object: %v", err)
 }
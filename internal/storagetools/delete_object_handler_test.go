@@ -0,0 +1,26 @@
+package storagetools_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/storagetools"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+)
+
+func TestHandleDeleteObject(t *testing.T) {
+	folder := memory.NewFolder("in_memory/", memory.NewStorage())
+	require.NoError(t, folder.PutObject("pgbackrest/main/backup.info", bytes.NewBufferString("[backup:current]")))
+
+	storagetools.HandleDeleteObject("pgbackrest/main/backup.info", folder, false)
+	exists, err := folder.Exists("pgbackrest/main/backup.info")
+	require.NoError(t, err)
+	assert.True(t, exists, "the unconfirmed deletion is a dry run")
+
+	storagetools.HandleDeleteObject("pgbackrest/main/backup.info", folder, true)
+	exists, err = folder.Exists("pgbackrest/main/backup.info")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal"
 	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/crypto"
 	"github.com/wal-g/wal-g/pkg/storages/storage"
 	"github.com/wal-g/wal-g/utility"
 )
@@ -59,6 +60,7 @@ func downloadObject(objectPath string, folder storage.Folder, fileWriter io.Writ
 		if err != nil {
 			return err
 		}
+		defer func(decrypted io.Reader) { _ = crypto.CloseDecrypted(decrypted) }(objReader)
 	}
 
 	if decompress {
@@ -70,7 +72,7 @@ func downloadObject(objectPath string, folder storage.Folder, fileWriter io.Writ
 				"decompressor for extension '%s' was not found (supported methods: %v), will download uncompressed",
 				fileExt, compression.CompressingAlgorithms)
 		} else {
-			decrypterObjReadCloser, err := decompressor.Decompress(objReader)
+			decrypterObjReadCloser, err := compression.Decompress(decompressor, objReader, objectPath)
 			if err != nil {
 				return err
 			}
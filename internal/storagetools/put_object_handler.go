@@ -55,7 +55,11 @@ func openLocalFile(localPath string) io.ReadCloser {
 func uploadFile(name string, content io.Reader, uploader *internal.Uploader, encrypt, compress bool) error {
 	var crypter crypto.Crypter
 	if encrypt {
-		crypter = internal.ConfigureCrypter()
+		var err error
+		crypter, err = internal.ConfigureCrypter()
+		if err != nil {
+			return err
+		}
 	}
 
 	var compressor compression.Compressor
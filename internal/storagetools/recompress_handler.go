@@ -0,0 +1,243 @@
+package storagetools
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression"
+	"github.com/wal-g/wal-g/internal/crypto"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"golang.org/x/sync/errgroup"
+)
+
+// Recompressor converts the storage objects from one compression format to another.
+// Every object is streamed through the decompressor of its extension and the target compressor,
+// the converted object is verified by comparing the digests of the decompressed contents
+// and only then the original is deleted. Since the original is the last thing removed,
+// the interrupted conversion is resumed by running it again: the converted objects are skipped.
+type Recompressor struct {
+	folder         storage.Folder
+	fromExtension  string
+	decompressor   compression.Decompressor
+	compressor     compression.Compressor
+	toDecompressor compression.Decompressor
+	crypter        crypto.Crypter
+	keepOriginal   bool
+
+	converted int64
+	skipped   int64
+}
+
+func NewRecompressor(folder storage.Folder, fromExtension string, compressor compression.Compressor,
+	crypter crypto.Crypter, keepOriginal bool) (*Recompressor, error) {
+	fromExtension = strings.TrimPrefix(fromExtension, ".")
+	decompressor := compression.FindDecompressor(fromExtension)
+	if decompressor == nil {
+		return nil, errors.Errorf("no decompressor for the '%s' extension", fromExtension)
+	}
+	toDecompressor := compression.GetDecompressorByCompressor(compressor)
+	if toDecompressor == nil {
+		return nil, errors.Errorf("no decompressor for the '%s' extension", compressor.FileExtension())
+	}
+	if fromExtension == compressor.FileExtension() {
+		return nil, errors.Errorf("objects are already compressed with '%s'", fromExtension)
+	}
+	return &Recompressor{
+		folder:         folder,
+		fromExtension:  fromExtension,
+		decompressor:   decompressor,
+		compressor:     compressor,
+		toDecompressor: toDecompressor,
+		crypter:        crypter,
+		keepOriginal:   keepOriginal,
+	}, nil
+}
+
+// HandleRecompress converts all the objects with the source extension in the folder recursively
+func HandleRecompress(recompressor *Recompressor, concurrency int) error {
+	objects, err := storage.ListFolderRecursively(recompressor.folder)
+	if err != nil {
+		return errors.Wrap(err, "failed to list the folder")
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	group, ctx := errgroup.WithContext(context.Background())
+	objectPaths := make(chan string)
+	for i := 0; i < concurrency; i++ {
+		group.Go(func() error {
+			for objectPath := range objectPaths {
+				if err := recompressor.Recompress(objectPath); err != nil {
+					return errors.Wrapf(err, "failed to recompress %s", objectPath)
+				}
+			}
+			return nil
+		})
+	}
+
+	suffix := "." + recompressor.fromExtension
+	group.Go(func() error {
+		defer close(objectPaths)
+		for _, object := range objects {
+			if !strings.HasSuffix(object.GetName(), suffix) {
+				continue
+			}
+			select {
+			case objectPaths <- object.GetName():
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		return nil
+	})
+
+	err = group.Wait()
+	tracelog.InfoLogger.Printf("Recompressed %d objects, skipped %d already recompressed objects",
+		atomic.LoadInt64(&recompressor.converted), atomic.LoadInt64(&recompressor.skipped))
+	return err
+}
+
+// Recompress converts a single object, if it is not converted yet
+func (recompressor *Recompressor) Recompress(objectPath string) error {
+	targetPath := strings.TrimSuffix(objectPath, recompressor.fromExtension) + recompressor.compressor.FileExtension()
+
+	exists, err := recompressor.folder.Exists(targetPath)
+	if err != nil {
+		return err
+	}
+	if exists {
+		skipped, err := recompressor.resume(objectPath, targetPath)
+		if err != nil || skipped {
+			return err
+		}
+	}
+
+	tracelog.InfoLogger.Printf("Recompressing %s to %s", objectPath, targetPath)
+	digest, err := recompressor.convert(objectPath, targetPath)
+	if err != nil {
+		return err
+	}
+	if err = recompressor.verify(targetPath, digest); err != nil {
+		if deleteErr := recompressor.folder.DeleteObjects([]string{targetPath}); deleteErr != nil {
+			tracelog.ErrorLogger.Printf("Failed to delete the invalid object %s: %v", targetPath, deleteErr)
+		}
+		return err
+	}
+	atomic.AddInt64(&recompressor.converted, 1)
+	return recompressor.deleteOriginal(objectPath)
+}
+
+// resume handles the object converted by the previous run, which could be interrupted
+// before the original was deleted or even before the converted object was verified.
+// If the converted object is broken, it is deleted to convert again.
+func (recompressor *Recompressor) resume(objectPath, targetPath string) (skipped bool, err error) {
+	digest, err := recompressor.digest(objectPath, recompressor.decompressor)
+	if err != nil {
+		return false, err
+	}
+	if err = recompressor.verify(targetPath, digest); err != nil {
+		tracelog.WarningLogger.Printf("Existing %s is invalid, converting it again: %v", targetPath, err)
+		return false, recompressor.folder.DeleteObjects([]string{targetPath})
+	}
+	tracelog.InfoLogger.Printf("Skipping %s: %s already exists", objectPath, targetPath)
+	atomic.AddInt64(&recompressor.skipped, 1)
+	return true, recompressor.deleteOriginal(objectPath)
+}
+
+// convert uploads the recompressed object and returns the digest of its decompressed contents
+func (recompressor *Recompressor) convert(objectPath, targetPath string) ([]byte, error) {
+	contents, err := recompressor.openDecompressed(objectPath, recompressor.decompressor)
+	if err != nil {
+		return nil, err
+	}
+	defer contents.Close()
+
+	hash := sha256.New()
+	recompressed := internal.CompressAndEncrypt(io.TeeReader(contents, hash), recompressor.compressor,
+		recompressor.crypter)
+	if err = recompressor.folder.PutObject(targetPath, recompressed); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+func (recompressor *Recompressor) verify(targetPath string, digest []byte) error {
+	targetDigest, err := recompressor.digest(targetPath, recompressor.toDecompressor)
+	if err != nil {
+		return errors.Wrapf(err, "failed to verify %s", targetPath)
+	}
+	if !bytes.Equal(digest, targetDigest) {
+		return errors.Errorf("contents of %s don't match the original", targetPath)
+	}
+	return nil
+}
+
+func (recompressor *Recompressor) digest(objectPath string, decompressor compression.Decompressor) ([]byte, error) {
+	contents, err := recompressor.openDecompressed(objectPath, decompressor)
+	if err != nil {
+		return nil, err
+	}
+	defer contents.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, contents); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+func (recompressor *Recompressor) openDecompressed(objectPath string,
+	decompressor compression.Decompressor) (io.ReadCloser, error) {
+	object, err := recompressor.folder.ReadObject(objectPath)
+	if err != nil {
+		return nil, err
+	}
+	var reader io.Reader = object
+	if recompressor.crypter != nil {
+		reader, err = recompressor.crypter.Decrypt(reader)
+		if err != nil {
+			object.Close()
+			return nil, err
+		}
+	}
+	decompressed, err := compression.Decompress(decompressor, reader, objectPath)
+	if err != nil {
+		_ = crypto.CloseDecrypted(reader)
+		object.Close()
+		return nil, err
+	}
+	return &decompressedObject{decompressed, reader, object}, nil
+}
+
+func (recompressor *Recompressor) deleteOriginal(objectPath string) error {
+	if recompressor.keepOriginal {
+		return nil
+	}
+	return recompressor.folder.DeleteObjects([]string{objectPath})
+}
+
+// decompressedObject closes the decompressor, the decrypter and the storage object
+type decompressedObject struct {
+	io.ReadCloser
+	decrypted io.Reader
+	object    io.Closer
+}
+
+func (reader *decompressedObject) Close() error {
+	err := reader.ReadCloser.Close()
+	if decryptedErr := crypto.CloseDecrypted(reader.decrypted); err == nil {
+		err = decryptedErr
+	}
+	if objectErr := reader.object.Close(); err == nil {
+		err = objectErr
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+package storagetools_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/compression/lz4"
+	"github.com/wal-g/wal-g/internal/compression/lzma"
+	"github.com/wal-g/wal-g/internal/storagetools"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/testtools"
+)
+
+func putCompressed(t *testing.T, folder storage.Folder, name string, contents []byte) {
+	compressed := internal.CompressAndEncrypt(bytes.NewReader(contents), lz4.Compressor{}, nil)
+	require.NoError(t, folder.PutObject(name, compressed))
+}
+
+func readDecompressed(t *testing.T, folder storage.Folder, name string) []byte {
+	object, err := folder.ReadObject(name)
+	require.NoError(t, err)
+	reader, err := lzma.Decompressor{}.Decompress(object)
+	require.NoError(t, err)
+	contents, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	return contents
+}
+
+func TestHandleRecompress(t *testing.T) {
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	putCompressed(t, folder, "basebackups_005/base_1/tar_partitions/part_1.tar.lz4", []byte("part 1"))
+	putCompressed(t, folder, "basebackups_005/base_1/tar_partitions/part_2.tar.lz4", []byte("part 2"))
+	require.NoError(t, folder.PutObject("basebackups_005/base_1_backup_stop_sentinel.json", bytes.NewBufferString("{}")))
+
+	recompressor, err := storagetools.NewRecompressor(folder.GetSubFolder("basebackups_005"), "lz4",
+		lzma.Compressor{}, nil, false)
+	require.NoError(t, err)
+	require.NoError(t, storagetools.HandleRecompress(recompressor, 2))
+
+	partitions := folder.GetSubFolder("basebackups_005/base_1/tar_partitions")
+	for part, contents := range map[string]string{"part_1": "part 1", "part_2": "part 2"} {
+		exists, err := partitions.Exists(part + ".tar.lz4")
+		assert.NoError(t, err)
+		assert.False(t, exists)
+		assert.Equal(t, []byte(contents), readDecompressed(t, partitions, part+".tar.lzma"))
+	}
+	exists, err := folder.Exists("basebackups_005/base_1_backup_stop_sentinel.json")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestHandleRecompress_resume(t *testing.T) {
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	putCompressed(t, folder, "part_1.tar.lz4", []byte("part 1"))
+	putCompressed(t, folder, "part_2.tar.lz4", []byte("part 2"))
+	// the previous run was interrupted after the upload of part_1, and part_2 upload is broken
+	require.NoError(t, folder.PutObject("part_1.tar.lzma",
+		internal.CompressAndEncrypt(bytes.NewBufferString("part 1"), lzma.Compressor{}, nil)))
+	require.NoError(t, folder.PutObject("part_2.tar.lzma", bytes.NewBufferString("garbage")))
+
+	recompressor, err := storagetools.NewRecompressor(folder, "lz4", lzma.Compressor{}, nil, true)
+	require.NoError(t, err)
+	require.NoError(t, storagetools.HandleRecompress(recompressor, 1))
+
+	// with --keep-original the existing objects are verified too, the broken one is converted again
+	assert.Equal(t, []byte("part 2"), readDecompressed(t, folder, "part_2.tar.lzma"))
+	for _, original := range []string{"part_1.tar.lz4", "part_2.tar.lz4"} {
+		exists, err := folder.Exists(original)
+		assert.NoError(t, err)
+		assert.True(t, exists)
+	}
+	require.NoError(t, folder.PutObject("part_2.tar.lzma", bytes.NewBufferString("garbage")))
+
+	recompressor, err = storagetools.NewRecompressor(folder, "lz4", lzma.Compressor{}, nil, false)
+	require.NoError(t, err)
+	require.NoError(t, storagetools.HandleRecompress(recompressor, 1))
+
+	assert.Equal(t, []byte("part 1"), readDecompressed(t, folder, "part_1.tar.lzma"))
+	assert.Equal(t, []byte("part 2"), readDecompressed(t, folder, "part_2.tar.lzma"))
+	objects, _, err := folder.ListFolder()
+	assert.NoError(t, err)
+	assert.Len(t, objects, 2)
+}
+
+func TestNewRecompressor_sameFormat(t *testing.T) {
+	_, err := storagetools.NewRecompressor(testtools.MakeDefaultInMemoryStorageFolder(), ".lz4",
+		lz4.Compressor{}, nil, false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,133 @@
+package storagetools
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"golang.org/x/sync/errgroup"
+)
+
+// Rehydrator requests the rehydration of the archived objects of the folder and waits for them to become readable
+type Rehydrator struct {
+	folder      storage.Folder
+	options     storage.RehydrateOptions
+	concurrency int
+	sleep       func(time.Duration)
+}
+
+func NewRehydrator(folder storage.Folder, options storage.RehydrateOptions, concurrency int) (*Rehydrator, error) {
+	if !storage.HasArchiveTier(folder) {
+		return nil, errors.Errorf("the storage of '%s' has no archive tier", folder.GetPath())
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Rehydrator{folder: folder, options: options, concurrency: concurrency, sleep: time.Sleep}, nil
+}
+
+// HandleRehydrate rehydrates the archived objects of the folder recursively. With the positive pollInterval
+// it polls the objects being rehydrated until all of them are readable.
+func HandleRehydrate(rehydrator *Rehydrator, pollInterval time.Duration) error {
+	objects, err := storage.ListFolderRecursively(rehydrator.folder)
+	if err != nil {
+		return errors.Wrap(err, "failed to list the folder")
+	}
+	names := make([]string, 0, len(objects))
+	for _, object := range objects {
+		names = append(names, object.GetName())
+	}
+
+	pending, err := rehydrator.Rehydrate(names)
+	if err != nil {
+		return err
+	}
+	tracelog.InfoLogger.Printf("%d of %d objects are being rehydrated", len(pending), len(names))
+	if pollInterval <= 0 {
+		return nil
+	}
+	for len(pending) > 0 {
+		tracelog.InfoLogger.Printf("Waiting %v for %d objects to be rehydrated", pollInterval, len(pending))
+		rehydrator.sleep(pollInterval)
+		pending, err = rehydrator.pending(pending)
+		if err != nil {
+			return err
+		}
+	}
+	tracelog.InfoLogger.Println("All the objects are readable")
+	return nil
+}
+
+// Rehydrate requests the rehydration of the archived objects which aren't readable yet
+// and returns the ones which are being rehydrated
+func (rehydrator *Rehydrator) Rehydrate(names []string) ([]string, error) {
+	return rehydrator.forEach(names, func(name string, tier storage.ObjectTier) (bool, error) {
+		if tier.IsReadable() {
+			return false, nil
+		}
+		if !tier.Rehydrating {
+			tracelog.InfoLogger.Printf("Rehydrating %s of %s", name, tier.StorageClass)
+			if err := storage.RehydrateObject(rehydrator.folder, name, rehydrator.options); err != nil {
+				return false, errors.Wrapf(err, "failed to rehydrate %s", name)
+			}
+		}
+		return true, nil
+	})
+}
+
+// pending returns the objects which aren't readable yet
+func (rehydrator *Rehydrator) pending(names []string) ([]string, error) {
+	return rehydrator.forEach(names, func(name string, tier storage.ObjectTier) (bool, error) {
+		return !tier.IsReadable(), nil
+	})
+}
+
+// forEach checks the tier of the objects by the concurrent workers and returns the names
+// the visit selected, the objects deleted meanwhile are skipped
+func (rehydrator *Rehydrator) forEach(names []string,
+	visit func(name string, tier storage.ObjectTier) (bool, error)) ([]string, error) {
+	var mutex sync.Mutex
+	var selected []string
+	group, ctx := errgroup.WithContext(context.Background())
+	toVisit := make(chan string)
+	for i := 0; i < rehydrator.concurrency; i++ {
+		group.Go(func() error {
+			for name := range toVisit {
+				tier, err := storage.GetObjectTier(rehydrator.folder, name)
+				var notFoundError storage.ObjectNotFoundError
+				if errors.As(err, &notFoundError) {
+					continue
+				}
+				if err != nil {
+					return errors.Wrapf(err, "failed to check the storage tier of %s", name)
+				}
+				isSelected, err := visit(name, tier)
+				if err != nil {
+					return err
+				}
+				if isSelected {
+					mutex.Lock()
+					selected = append(selected, name)
+					mutex.Unlock()
+				}
+			}
+			return nil
+		})
+	}
+	group.Go(func() error {
+		defer close(toVisit)
+		for _, name := range names {
+			select {
+			case toVisit <- name:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		return nil
+	})
+	err := group.Wait()
+	return selected, err
+}
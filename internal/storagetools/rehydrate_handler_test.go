@@ -0,0 +1,67 @@
+package storagetools
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/testtools"
+)
+
+func newRehydrateFolder(t *testing.T) *testtools.MockArchiveTierFolder {
+	folder := testtools.NewMockArchiveTierFolder(memory.NewFolder("in_memory/", memory.NewStorage()))
+	for _, name := range []string{"basebackups_005/base_1/part_1.tar.lz4", "basebackups_005/base_1/part_2.tar.lz4",
+		"basebackups_005/base_1_backup_stop_sentinel.json", "wal_005/000000010000000000000001.lz4"} {
+		require.NoError(t, folder.PutObject(name, strings.NewReader(name)))
+	}
+	folder.Archive("basebackups_005/base_1/part_1.tar.lz4")
+	folder.Archive("basebackups_005/base_1/part_2.tar.lz4")
+	folder.Archive("wal_005/000000010000000000000001.lz4")
+	return folder
+}
+
+func TestHandleRehydrate(t *testing.T) {
+	folder := newRehydrateFolder(t)
+	options := storage.RehydrateOptions{Days: 2, Priority: storage.RehydratePriorityBulk}
+	rehydrator, err := NewRehydrator(folder, options, 2)
+	require.NoError(t, err)
+
+	require.NoError(t, HandleRehydrate(rehydrator, 0))
+	assert.Equal(t, map[string]storage.RehydrateOptions{
+		"basebackups_005/base_1/part_1.tar.lz4": options,
+		"basebackups_005/base_1/part_2.tar.lz4": options,
+		"wal_005/000000010000000000000001.lz4":  options,
+	}, folder.Rehydrated)
+
+	// the objects being rehydrated are not requested again
+	pending, err := rehydrator.Rehydrate([]string{"basebackups_005/base_1/part_1.tar.lz4", "missing"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"basebackups_005/base_1/part_1.tar.lz4"}, pending)
+}
+
+func TestHandleRehydrate_waits(t *testing.T) {
+	folder := newRehydrateFolder(t)
+	rehydrator, err := NewRehydrator(folder, storage.RehydrateOptions{}, 4)
+	require.NoError(t, err)
+	var sleeps []time.Duration
+	rehydrator.sleep = func(interval time.Duration) {
+		sleeps = append(sleeps, interval)
+		if len(sleeps) == 2 {
+			folder.FinishRehydration()
+		}
+	}
+
+	require.NoError(t, HandleRehydrate(rehydrator, time.Minute))
+	assert.Equal(t, []time.Duration{time.Minute, time.Minute}, sleeps)
+	_, err = folder.ReadObject("wal_005/000000010000000000000001.lz4")
+	assert.NoError(t, err)
+}
+
+func TestNewRehydrator_noArchiveTier(t *testing.T) {
+	_, err := NewRehydrator(memory.NewFolder("in_memory/", memory.NewStorage()), storage.RehydrateOptions{}, 1)
+	assert.Error(t, err)
+}
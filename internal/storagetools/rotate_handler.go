@@ -0,0 +1,274 @@
+package storagetools
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal/crypto"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// RotatingSuffix marks the re-encrypted copy of the object which is not swapped in yet
+	RotatingSuffix = ".rotating"
+	// RotationMarkersFolder keeps the empty marker of every object whose verified re-encrypted copy is made,
+	// the markers are deleted once the whole rotation is done
+	RotationMarkersFolder = ".key_rotation"
+	// rotationVerifySize is how much of the object is decrypted to check the key
+	rotationVerifySize = 1 << 20
+)
+
+// KeyRotator re-encrypts the storage objects with the new key without decompressing them.
+// The object is re-encrypted to the temporary copy, which is verified by decrypting it with the new key,
+// marked in RotationMarkersFolder and then copied over the original, so every object is always decrypted
+// by either the old or the new key. The marked objects are already rotated, at most their swap is unfinished,
+// so the interrupted rotation is resumed by running it again. The unencrypted objects, e.g. the sentinels,
+// are left as is, while the objects which fail to be read or decrypted by the old key fail the rotation.
+type KeyRotator struct {
+	folder     storage.Folder
+	oldCrypter crypto.Crypter
+	newCrypter crypto.Crypter
+
+	rotated     int64
+	skipped     int64
+	unencrypted int64
+}
+
+func NewKeyRotator(folder storage.Folder, oldCrypter crypto.Crypter, newCrypter crypto.Crypter) *KeyRotator {
+	return &KeyRotator{folder: folder, oldCrypter: oldCrypter, newCrypter: newCrypter}
+}
+
+// HandleKeyRotation re-encrypts all the objects in the folder recursively
+func HandleKeyRotation(rotator *KeyRotator, concurrency int) error {
+	objects, err := storage.ListFolderRecursively(rotator.folder)
+	if err != nil {
+		return errors.Wrap(err, "failed to list the folder")
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	group, ctx := errgroup.WithContext(context.Background())
+	objectPaths := make(chan string)
+	for i := 0; i < concurrency; i++ {
+		group.Go(func() error {
+			for objectPath := range objectPaths {
+				if err := rotator.Rotate(objectPath); err != nil {
+					return errors.Wrapf(err, "failed to rotate the key of %s", objectPath)
+				}
+			}
+			return nil
+		})
+	}
+
+	group.Go(func() error {
+		defer close(objectPaths)
+		for _, object := range objects {
+			if strings.HasSuffix(object.GetName(), RotatingSuffix) ||
+				strings.HasPrefix(object.GetName(), RotationMarkersFolder+"/") {
+				continue
+			}
+			select {
+			case objectPaths <- object.GetName():
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		return nil
+	})
+
+	err = group.Wait()
+	tracelog.InfoLogger.Printf("Re-encrypted %d objects, skipped %d already re-encrypted and %d unencrypted objects",
+		atomic.LoadInt64(&rotator.rotated), atomic.LoadInt64(&rotator.skipped), atomic.LoadInt64(&rotator.unencrypted))
+	if err != nil {
+		return err
+	}
+	return rotator.deleteMarkers()
+}
+
+// deleteMarkers forgets the finished rotation, the next one starts over since its old key encrypts the objects now
+func (rotator *KeyRotator) deleteMarkers() error {
+	markersFolder := rotator.folder.GetSubFolder(RotationMarkersFolder)
+	markers, err := storage.ListFolderRecursively(markersFolder)
+	if err != nil {
+		return errors.Wrap(err, "failed to list the rotation markers")
+	}
+	markerPaths := make([]string, 0, len(markers))
+	for _, marker := range markers {
+		markerPaths = append(markerPaths, marker.GetName())
+	}
+	if len(markerPaths) == 0 {
+		return nil
+	}
+	return markersFolder.DeleteObjects(markerPaths)
+}
+
+// Rotate re-encrypts a single object, if it is not re-encrypted yet
+func (rotator *KeyRotator) Rotate(objectPath string) error {
+	temporaryPath := objectPath + RotatingSuffix
+	markerPath := path.Join(RotationMarkersFolder, objectPath)
+	marked, err := rotator.folder.Exists(markerPath)
+	if err != nil {
+		return err
+	}
+	if marked {
+		tracelog.DebugLogger.Printf("Skipping %s: it is already re-encrypted", objectPath)
+		atomic.AddInt64(&rotator.skipped, 1)
+		return rotator.finishSwap(objectPath, temporaryPath)
+	}
+	if err := rotator.verify(objectPath, rotator.oldCrypter); err != nil {
+		unencrypted, checkErr := rotator.isUnencrypted(objectPath, err)
+		if checkErr != nil {
+			return checkErr
+		}
+		if !unencrypted {
+			return errors.Wrapf(err, "failed to decrypt %s with the old key", objectPath)
+		}
+		tracelog.DebugLogger.Printf("Skipping %s: it is not encrypted: %v", objectPath, err)
+		atomic.AddInt64(&rotator.unencrypted, 1)
+		return nil
+	}
+
+	tracelog.InfoLogger.Printf("Re-encrypting %s", objectPath)
+	if err := rotator.reencrypt(objectPath, temporaryPath); err != nil {
+		return err
+	}
+	if err := rotator.verify(temporaryPath, rotator.newCrypter); err != nil {
+		if deleteErr := rotator.folder.DeleteObjects([]string{temporaryPath}); deleteErr != nil {
+			tracelog.ErrorLogger.Printf("Failed to delete the invalid object %s: %v", temporaryPath, deleteErr)
+		}
+		return errors.Wrapf(err, "failed to verify %s", temporaryPath)
+	}
+	if err := rotator.folder.PutObject(markerPath, &bytes.Buffer{}); err != nil {
+		return errors.Wrapf(err, "failed to mark %s as re-encrypted", objectPath)
+	}
+	atomic.AddInt64(&rotator.rotated, 1)
+	return rotator.finishSwap(objectPath, temporaryPath)
+}
+
+// finishSwap copies the verified re-encrypted copy over the original, the copy is gone once the swap is done
+func (rotator *KeyRotator) finishSwap(objectPath, temporaryPath string) error {
+	exists, err := rotator.folder.Exists(temporaryPath)
+	if err != nil || !exists {
+		return err
+	}
+	// the storages can't rename, so the verified copy replaces the original by the upload
+	if err := rotator.copyObject(temporaryPath, objectPath); err != nil {
+		return err
+	}
+	if err := rotator.verify(objectPath, rotator.newCrypter); err != nil {
+		// the temporary copy is kept, it is decrypted by the new key
+		return errors.Wrapf(err, "failed to verify %s after the swap", objectPath)
+	}
+	return rotator.folder.DeleteObjects([]string{temporaryPath})
+}
+
+func (rotator *KeyRotator) reencrypt(objectPath, targetPath string) error {
+	object, err := rotator.folder.ReadObject(objectPath)
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+	decrypted, err := rotator.oldCrypter.Decrypt(object)
+	if err != nil {
+		return err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		// e.g. the decryption workers and processes are released once the object is read
+		defer func() { _ = crypto.CloseDecrypted(decrypted) }()
+		encryptedWriter, err := rotator.newCrypter.Encrypt(writer)
+		if err == nil {
+			_, err = io.Copy(encryptedWriter, decrypted)
+			if closeErr := encryptedWriter.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		_ = writer.CloseWithError(err)
+	}()
+	err = rotator.folder.PutObject(targetPath, reader)
+	_ = reader.CloseWithError(err)
+	return err
+}
+
+func (rotator *KeyRotator) copyObject(sourcePath, targetPath string) error {
+	source, err := rotator.folder.ReadObject(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	return rotator.folder.PutObject(targetPath, source)
+}
+
+// isUnencrypted tells the object which the old key failed to decrypt since it isn't encrypted,
+// i.e. the crypter reports so or the object has no header of the known encryption format,
+// from the one which failed to be read, which is returned as the error
+func (rotator *KeyRotator) isUnencrypted(objectPath string, verifyErr error) (bool, error) {
+	var readErr objectReadError
+	if errors.As(verifyErr, &readErr) {
+		return false, readErr.error
+	}
+	if errors.Is(verifyErr, crypto.ErrNotEncrypted) {
+		return true, nil
+	}
+	object, err := rotator.folder.ReadObject(objectPath)
+	if err != nil {
+		return false, err
+	}
+	defer object.Close()
+	header := make([]byte, crypto.EncryptionHeaderLength)
+	n, err := io.ReadFull(object, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, errors.Wrapf(err, "failed to read the header of %s", objectPath)
+	}
+	return crypto.DetectEncryption(header[:n]) == "", nil
+}
+
+// objectReadError is the failure to read the stored object rather than to decrypt it
+type objectReadError struct {
+	error
+}
+
+// objectReader remembers the failure of the storage read, which the crypter may report as its own
+type objectReader struct {
+	io.Reader
+	err error
+}
+
+func (reader *objectReader) Read(p []byte) (int, error) {
+	n, err := reader.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		reader.err = err
+	}
+	return n, err
+}
+
+// verify decrypts the beginning of the object, the failure to read it is returned as objectReadError
+func (rotator *KeyRotator) verify(objectPath string, crypter crypto.Crypter) error {
+	object, err := rotator.folder.ReadObject(objectPath)
+	if err != nil {
+		return objectReadError{err}
+	}
+	defer object.Close()
+	source := &objectReader{Reader: object}
+	decrypted, err := crypter.Decrypt(source)
+	if err == nil {
+		_, err = io.Copy(ioutil.Discard, io.LimitReader(decrypted, rotationVerifySize))
+		if closeErr := crypto.CloseDecrypted(decrypted); err == nil {
+			err = closeErr
+		}
+	}
+	if source.err != nil {
+		return objectReadError{errors.Wrapf(source.err, "failed to read %s", objectPath)}
+	}
+	return err
+}
@@ -0,0 +1,164 @@
+package storagetools_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal/storagetools"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/testtools"
+)
+
+// keyCrypter marks the encrypted data with the key, which Decrypt checks and strips
+type keyCrypter struct {
+	key string
+}
+
+func (crypter keyCrypter) Name() string {
+	return crypter.key
+}
+
+func (crypter keyCrypter) Encrypt(writer io.Writer) (io.WriteCloser, error) {
+	_, err := writer.Write([]byte(crypter.key))
+	return nopWriteCloser{writer}, err
+}
+
+func (crypter keyCrypter) Decrypt(reader io.Reader) (io.Reader, error) {
+	key := make([]byte, len(crypter.key))
+	if _, err := io.ReadFull(reader, key); err != nil || string(key) != crypter.key {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return reader, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func readObject(t *testing.T, folder storage.Folder, name string) string {
+	object, err := folder.ReadObject(name)
+	require.NoError(t, err)
+	contents, err := ioutil.ReadAll(object)
+	require.NoError(t, err)
+	return string(contents)
+}
+
+func TestHandleKeyRotation(t *testing.T) {
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	objects := map[string]string{
+		"basebackups_005/base_1/tar_partitions/part_1.tar.lz4": "old:part 1",
+		// the previous run was interrupted after the swap of part_2
+		"basebackups_005/base_1/tar_partitions/part_2.tar.lz4":               "new:part 2",
+		"basebackups_005/base_1/tar_partitions/part_2.tar.lz4.rotating":      "new:part 2",
+		"basebackups_005/.key_rotation/base_1/tar_partitions/part_2.tar.lz4": "",
+		// and before the swap of part_3
+		"basebackups_005/base_1/tar_partitions/part_3.tar.lz4":               "old:part 3",
+		"basebackups_005/base_1/tar_partitions/part_3.tar.lz4.rotating":      "new:part 3",
+		"basebackups_005/.key_rotation/base_1/tar_partitions/part_3.tar.lz4": "",
+		// and before the copy of part_4 was verified and marked
+		"basebackups_005/base_1/tar_partitions/part_4.tar.lz4":          "old:part 4",
+		"basebackups_005/base_1/tar_partitions/part_4.tar.lz4.rotating": "new:par",
+		"basebackups_005/base_1_backup_stop_sentinel.json":              "{}",
+	}
+	for name, contents := range objects {
+		require.NoError(t, folder.PutObject(name, bytes.NewBufferString(contents)))
+	}
+
+	rotator := storagetools.NewKeyRotator(folder.GetSubFolder("basebackups_005"),
+		keyCrypter{"old:"}, keyCrypter{"new:"})
+	require.NoError(t, storagetools.HandleKeyRotation(rotator, 2))
+
+	partitions := folder.GetSubFolder("basebackups_005/base_1/tar_partitions")
+	assert.Equal(t, "new:part 1", readObject(t, partitions, "part_1.tar.lz4"))
+	assert.Equal(t, "new:part 2", readObject(t, partitions, "part_2.tar.lz4"))
+	assert.Equal(t, "new:part 3", readObject(t, partitions, "part_3.tar.lz4"))
+	assert.Equal(t, "new:part 4", readObject(t, partitions, "part_4.tar.lz4"))
+	assert.Equal(t, "{}", readObject(t, folder, "basebackups_005/base_1_backup_stop_sentinel.json"))
+	// neither the copies nor the markers are left once the rotation is done
+	remaining, err := storage.ListFolderRecursively(folder)
+	assert.NoError(t, err)
+	assert.Len(t, remaining, 5)
+}
+
+// the marker tells the re-encrypted object, it isn't decrypted to find it out
+func TestKeyRotator_markedObjectIsNotDecrypted(t *testing.T) {
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	require.NoError(t, folder.PutObject("part_1.tar.lz4", bytes.NewBufferString("new:part 1")))
+	require.NoError(t, folder.PutObject(".key_rotation/part_1.tar.lz4", &bytes.Buffer{}))
+
+	rotator := storagetools.NewKeyRotator(folder, failingCrypter{t}, failingCrypter{t})
+	require.NoError(t, rotator.Rotate("part_1.tar.lz4"))
+	assert.Equal(t, "new:part 1", readObject(t, folder, "part_1.tar.lz4"))
+}
+
+type failingCrypter struct {
+	t *testing.T
+}
+
+func (crypter failingCrypter) Name() string {
+	return "failing"
+}
+
+func (crypter failingCrypter) Encrypt(io.Writer) (io.WriteCloser, error) {
+	crypter.t.Error("unexpected encryption")
+	return nil, io.ErrClosedPipe
+}
+
+func (crypter failingCrypter) Decrypt(io.Reader) (io.Reader, error) {
+	crypter.t.Error("unexpected decryption")
+	return nil, io.ErrClosedPipe
+}
+
+// unreadableFolder fails to read the object, either to open it or in the middle of it, like the dropped connection
+type unreadableFolder struct {
+	storage.Folder
+	path       string
+	openFailed bool
+}
+
+func (folder unreadableFolder) ReadObject(objectRelativePath string) (io.ReadCloser, error) {
+	if objectRelativePath != folder.path {
+		return folder.Folder.ReadObject(objectRelativePath)
+	}
+	if folder.openFailed {
+		return nil, errors.New("connection reset by peer")
+	}
+	return ioutil.NopCloser(io.MultiReader(bytes.NewBufferString("old:pa"),
+		iotest.ErrReader(io.ErrUnexpectedEOF))), nil
+}
+
+func TestHandleKeyRotation_unreadableObject(t *testing.T) {
+	for _, openFailed := range []bool{true, false} {
+		folder := testtools.MakeDefaultInMemoryStorageFolder()
+		objects := map[string]string{
+			"part_1.tar.lz4": "old:part 1",
+			// the previous run rotated part_2
+			"part_2.tar.lz4":               "new:part 2",
+			".key_rotation/part_2.tar.lz4": "",
+		}
+		for name, contents := range objects {
+			require.NoError(t, folder.PutObject(name, bytes.NewBufferString(contents)))
+		}
+
+		rotator := storagetools.NewKeyRotator(unreadableFolder{folder, "part_1.tar.lz4", openFailed},
+			keyCrypter{"old:"}, keyCrypter{"new:"})
+		err := storagetools.HandleKeyRotation(rotator, 1)
+		assert.Error(t, err)
+
+		// the object isn't taken for the unencrypted one, and the markers are kept to resume the rotation
+		assert.Equal(t, "old:part 1", readObject(t, folder, "part_1.tar.lz4"))
+		exists, err := folder.Exists(".key_rotation/part_2.tar.lz4")
+		assert.NoError(t, err)
+		assert.True(t, exists, "the marker is deleted when the open failed is %v", openFailed)
+	}
+}
@@ -0,0 +1,120 @@
+package storagetools
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/signing"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/utility"
+	"golang.org/x/sync/errgroup"
+)
+
+// SignatureVerifier checks the detached signatures of the storage objects
+type SignatureVerifier struct {
+	folder   storage.Folder
+	verifier signing.Verifier
+
+	verified   int64
+	unsigned   int64
+	mismatched int64
+}
+
+func NewSignatureVerifier(folder storage.Folder, verifier signing.Verifier) *SignatureVerifier {
+	return &SignatureVerifier{folder: folder, verifier: verifier}
+}
+
+// HandleSignatureVerification verifies all the objects in the folder recursively. The objects without
+// the signature, e.g. uploaded before the signing was enabled, are reported, the mismatched ones fail
+// the verification after all the objects are checked.
+func HandleSignatureVerification(signatureVerifier *SignatureVerifier, concurrency int) error {
+	objects, err := storage.ListFolderRecursively(signatureVerifier.folder)
+	if err != nil {
+		return errors.Wrap(err, "failed to list the folder")
+	}
+	signed := make(map[string]bool)
+	for _, object := range objects {
+		if strings.HasSuffix(object.GetName(), signing.SignatureSuffix) {
+			signed[strings.TrimSuffix(object.GetName(), signing.SignatureSuffix)] = true
+		}
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	group, ctx := errgroup.WithContext(context.Background())
+	objectPaths := make(chan string)
+	for i := 0; i < concurrency; i++ {
+		group.Go(func() error {
+			for objectPath := range objectPaths {
+				if err := signatureVerifier.Verify(objectPath); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	group.Go(func() error {
+		defer close(objectPaths)
+		for _, object := range objects {
+			objectPath := object.GetName()
+			if strings.HasSuffix(objectPath, signing.SignatureSuffix) {
+				continue
+			}
+			if !signed[objectPath] {
+				tracelog.WarningLogger.Printf("%s is not signed", objectPath)
+				atomic.AddInt64(&signatureVerifier.unsigned, 1)
+				continue
+			}
+			select {
+			case objectPaths <- objectPath:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		return nil
+	})
+
+	err = group.Wait()
+	mismatched := atomic.LoadInt64(&signatureVerifier.mismatched)
+	tracelog.InfoLogger.Printf("Verified %d objects, %d objects don't match the signature, %d objects are not signed",
+		atomic.LoadInt64(&signatureVerifier.verified), mismatched, atomic.LoadInt64(&signatureVerifier.unsigned))
+	if err == nil && mismatched > 0 {
+		err = errors.Wrapf(signing.ErrSignatureMismatch, "%d objects", mismatched)
+	}
+	return err
+}
+
+// Verify checks the signature of a single object, the mismatch is logged and counted, not returned
+func (signatureVerifier *SignatureVerifier) Verify(objectPath string) error {
+	object, err := signatureVerifier.folder.ReadObject(objectPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s", objectPath)
+	}
+	defer utility.LoggedClose(object, "")
+	signature, err := internal.ReadSignature(signatureVerifier.folder, objectPath)
+	if err != nil {
+		return err
+	}
+
+	digest := signing.NewDigest()
+	if _, err = utility.FastCopy(digest, object); err != nil {
+		return errors.Wrapf(err, "failed to read %s", objectPath)
+	}
+	err = signatureVerifier.verifier.Verify(digest.Sum(nil), signature)
+	if errors.Is(err, signing.ErrSignatureMismatch) {
+		tracelog.ErrorLogger.Printf("%s doesn't match its signature: %v", objectPath, err)
+		atomic.AddInt64(&signatureVerifier.mismatched, 1)
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to verify %s", objectPath)
+	}
+	atomic.AddInt64(&signatureVerifier.verified, 1)
+	return nil
+}
@@ -0,0 +1,43 @@
+package storagetools_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/internal"
+	"github.com/wal-g/wal-g/internal/signing"
+	"github.com/wal-g/wal-g/internal/storagetools"
+	"github.com/wal-g/wal-g/testtools"
+)
+
+func TestHandleSignatureVerification(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := signing.NewEd25519Signer(base64.StdEncoding.EncodeToString(privateKey))
+	require.NoError(t, err)
+	verifier, err := signing.NewEd25519Verifier(base64.StdEncoding.EncodeToString(publicKey))
+	require.NoError(t, err)
+
+	folder := testtools.MakeDefaultInMemoryStorageFolder()
+	uploader := internal.NewUploader(nil, folder)
+	uploader.Signer = signer
+	for _, name := range []string{"wal_005/000000010000000000000001.lz4", "wal_005/000000010000000000000002.lz4"} {
+		require.NoError(t, uploader.Upload(name, bytes.NewBufferString(name)))
+	}
+	// uploaded before the signing was enabled
+	require.NoError(t, folder.PutObject("wal_005/000000010000000000000000.lz4", bytes.NewBufferString("unsigned")))
+
+	signatureVerifier := storagetools.NewSignatureVerifier(folder.GetSubFolder("wal_005"), verifier)
+	assert.NoError(t, storagetools.HandleSignatureVerification(signatureVerifier, 2))
+
+	require.NoError(t, folder.PutObject("wal_005/000000010000000000000002.lz4", bytes.NewBufferString("tampered")))
+	signatureVerifier = storagetools.NewSignatureVerifier(folder.GetSubFolder("wal_005"), verifier)
+	err = storagetools.HandleSignatureVerification(signatureVerifier, 2)
+	assert.True(t, errors.Is(err, signing.ErrSignatureMismatch), "unexpected error: %v", err)
+}
@@ -40,7 +40,7 @@ func GetLogsDstSettings(operationLogsDstEnvVariable string) (dstFolder string, e
 func DownloadAndDecompressStream(backup Backup, writeCloser io.WriteCloser) error {
 	defer utility.LoggedClose(writeCloser, "")
 
-	for _, decompressor := range compression.Decompressors {
+	for _, decompressor := range compression.RegisteredDecompressors() {
 		archiveReader, exists, err := TryDownloadFile(backup.Folder, GetStreamName(backup.Name, decompressor.FileExtension()))
 		if err != nil {
 			return fmt.Errorf("failed to dowload file: %w", err)
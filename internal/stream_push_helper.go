@@ -74,8 +74,12 @@ func (uploader *Uploader) PushStreamToDestination(stream io.Reader, dstPath stri
 	if uploader.dataSize != nil {
 		stream = NewWithSizeReader(stream, uploader.dataSize)
 	}
-	compressed := CompressAndEncrypt(stream, uploader.Compressor, ConfigureCrypter())
-	err := uploader.Upload(dstPath, compressed)
+	crypter, err := ConfigureCrypter()
+	if err != nil {
+		return err
+	}
+	compressed := CompressAndEncrypt(stream, uploader.Compressor, crypter)
+	err = uploader.Upload(dstPath, compressed)
 	tracelog.InfoLogger.Println("FILE PATH:", dstPath)
 
 	return err
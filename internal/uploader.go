@@ -1,16 +1,20 @@
 package internal
 
 import (
+	"bytes"
 	"fmt"
+	"hash"
 	"io"
 	"path/filepath"
 	"sync"
 	"sync/atomic"
 
+	"github.com/pkg/errors"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/internal/asm"
 	"github.com/wal-g/wal-g/internal/compression"
 	"github.com/wal-g/wal-g/internal/ioextensions"
+	"github.com/wal-g/wal-g/internal/signing"
 	"github.com/wal-g/wal-g/pkg/storages/storage"
 	"github.com/wal-g/wal-g/utility"
 )
@@ -41,6 +45,8 @@ type Uploader struct {
 	Failed                 atomic.Value
 	tarSize                *int64
 	dataSize               *int64
+	// Signer, if set, signs every uploaded object, the signature is uploaded next to it
+	Signer signing.Signer
 }
 
 var _ UploaderProvider = &Uploader{}
@@ -138,6 +144,7 @@ func (uploader *Uploader) Clone() *Uploader {
 		Failed:               uploader.Failed,
 		tarSize:              uploader.tarSize,
 		dataSize:             uploader.dataSize,
+		Signer:               uploader.Signer,
 	}
 }
 
@@ -150,10 +157,14 @@ func (uploader *Uploader) UploadFile(file ioextensions.NamedReader) error {
 	if uploader.dataSize != nil {
 		fileReader = NewWithSizeReader(fileReader, uploader.dataSize)
 	}
-	compressedFile := CompressAndEncrypt(fileReader, uploader.Compressor, ConfigureCrypter())
+	crypter, err := ConfigureCrypter()
+	if err != nil {
+		return err
+	}
+	compressedFile := CompressAndEncrypt(fileReader, uploader.Compressor, crypter)
 	dstPath := utility.SanitizePath(filepath.Base(filename) + "." + uploader.Compressor.FileExtension())
 
-	err := uploader.Upload(dstPath, compressedFile)
+	err = uploader.Upload(dstPath, compressedFile)
 	tracelog.InfoLogger.Println("FILE PATH:", dstPath)
 	return err
 }
@@ -174,7 +185,15 @@ func (uploader *Uploader) Upload(path string, content io.Reader) error {
 	if uploader.tarSize != nil {
 		content = NewWithSizeReader(content, uploader.tarSize)
 	}
+	var digest hash.Hash
+	if uploader.Signer != nil {
+		digest = signing.NewDigest()
+		content = io.TeeReader(content, digest)
+	}
 	err := uploader.UploadingFolder.PutObject(path, content)
+	if err == nil && digest != nil {
+		err = uploader.uploadSignature(path, digest.Sum(nil))
+	}
 	if err != nil {
 		uploader.Failed.Store(true)
 		tracelog.ErrorLogger.Printf(tracelog.GetErrorFormatter()+"\n", err)
@@ -183,6 +202,14 @@ func (uploader *Uploader) Upload(path string, content io.Reader) error {
 	return nil
 }
 
+func (uploader *Uploader) uploadSignature(path string, digest []byte) error {
+	signature, err := uploader.Signer.Sign(digest)
+	if err != nil {
+		return errors.Wrapf(err, "failed to sign %s", path)
+	}
+	return uploader.UploadingFolder.PutObject(path+signing.SignatureSuffix, bytes.NewReader(signature))
+}
+
 // UploadMultiple uploads multiple objects from the start of the slice,
 // returning the first error if any. Note that this operation is not atomic
 // TODO : unit tests
@@ -0,0 +1,67 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+// errorCodeHeader names the reason of the failed request, the downloads are sent without the SDK,
+// so their errors are recognized by it
+const errorCodeHeader = "x-ms-error-code"
+
+func isArchivedErrorCode(code azblob.StorageErrorCode) bool {
+	return code == azblob.StorageErrorCodeBlobArchived || code == azblob.StorageErrorCodeBlobBeingRehydrated
+}
+
+// GetObjectTier tells whether the blob is in the Archive access tier and whether it is being rehydrated,
+// the rehydrated blob leaves the Archive tier, so it's never archived and rehydrated at once
+func (folder *Folder) GetObjectTier(objectRelativePath string) (storage.ObjectTier, error) {
+	path := storage.JoinPath(folder.path, objectRelativePath)
+	blobClient := folder.containerClient.NewBlobClient(path)
+	properties, err := blobClient.GetProperties(context.Background(), &azblob.GetBlobPropertiesOptions{})
+	var stgErr *azblob.StorageError
+	if err != nil && errors.As(err, &stgErr) && stgErr.ErrorCode == azblob.StorageErrorCodeBlobNotFound {
+		return storage.ObjectTier{}, storage.NewObjectNotFoundError(path)
+	}
+	if err != nil {
+		return storage.ObjectTier{}, NewFolderError(err, "Unable to get the access tier of blob %s", path)
+	}
+
+	tier := storage.ObjectTier{}
+	if properties.AccessTier != nil {
+		tier.StorageClass = *properties.AccessTier
+	}
+	tier.Archived = tier.StorageClass == string(azblob.AccessTierArchive)
+	tier.Rehydrating = properties.ArchiveStatus != nil && strings.HasPrefix(*properties.ArchiveStatus, "rehydrate-pending")
+	return tier, nil
+}
+
+// Rehydrate moves the archived blob to the Hot tier, so it stays readable after the rehydration,
+// options.Days don't apply
+func (folder *Folder) Rehydrate(objectRelativePath string, options storage.RehydrateOptions) error {
+	path := storage.JoinPath(folder.path, objectRelativePath)
+	priority := azblob.RehydratePriorityStandard
+	if options.Priority == storage.RehydratePriorityHigh {
+		priority = azblob.RehydratePriorityHigh
+	}
+	blobClient := folder.containerClient.NewBlobClient(path)
+	_, err := blobClient.SetTier(context.Background(), azblob.AccessTierHot,
+		&azblob.SetTierOptions{RehydratePriority: &priority})
+	var stgErr *azblob.StorageError
+	if err != nil && errors.As(err, &stgErr) {
+		switch stgErr.ErrorCode {
+		case azblob.StorageErrorCodeBlobBeingRehydrated:
+			return nil
+		case azblob.StorageErrorCodeBlobNotFound:
+			return storage.NewObjectNotFoundError(path)
+		}
+	}
+	if err != nil {
+		return NewFolderError(err, "Unable to rehydrate blob %s", path)
+	}
+	return nil
+}
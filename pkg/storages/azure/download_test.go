@@ -0,0 +1,49 @@
+package azure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newStatusTestFolder(t *testing.T, status int, errorCode azblob.StorageErrorCode) *Folder {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if errorCode != "" {
+			writer.Header().Set(errorCodeHeader, string(errorCode))
+		}
+		writer.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	containerClient, err := azblob.NewContainerClient(server.URL+"/container", azcore.NewAnonymousCredential(), nil)
+	require.NoError(t, err)
+	return NewFolder(azblob.UploadStreamToBlockBlobOptions{}, containerClient, azcore.NewAnonymousCredential(),
+		time.Minute, http.DefaultTransport, "path/")
+}
+
+func TestReadObject_statusError(t *testing.T) {
+	for _, testCase := range []struct {
+		status    int
+		errorCode azblob.StorageErrorCode
+		retryable bool
+	}{
+		{http.StatusServiceUnavailable, azblob.StorageErrorCodeServerBusy, true},
+		{http.StatusInternalServerError, "", true},
+		{http.StatusTooManyRequests, "", true},
+		{http.StatusForbidden, azblob.StorageErrorCodeAuthenticationFailed, false},
+	} {
+		_, err := newStatusTestFolder(t, testCase.status, testCase.errorCode).ReadObject("object")
+		require.Error(t, err)
+		var statusErr DownloadStatusError
+		require.True(t, errors.As(err, &statusErr), err)
+		assert.Equal(t, testCase.status, statusErr.StatusCode)
+		assert.Equal(t, testCase.errorCode, statusErr.ErrorCode)
+		assert.Equal(t, testCase.retryable, IsRetryableError(err), testCase.status)
+	}
+}
@@ -38,14 +38,14 @@ const (
 	defaultEnvName    = "AzurePublicCloud"
 )
 
-var SettingList = []string{
+var SettingList = append([]string{
 	AccountSetting,
 	AccessKeySetting,
 	SasTokenSetting,
 	EnvironmentName,
 	BufferSizeSetting,
 	MaxBuffersSetting,
-}
+}, storage.HTTPClientSettingList...)
 
 func NewFolderError(err error, format string, args ...interface{}) storage.Error {
 	return storage.NewError(err, "Azure", format, args...)
@@ -61,12 +61,14 @@ func NewFolder(
 	containerClient azblob.ContainerClient,
 	credential azcore.Credential,
 	timeout time.Duration,
+	transport http.RoundTripper,
 	path string) *Folder {
 	return &Folder{
 		uploadStreamToBlockBlobOptions,
 		containerClient,
 		credential,
 		timeout,
+		transport,
 		path,
 	}
 }
@@ -133,15 +135,28 @@ func ConfigureFolder(prefix string, settings map[string]string) (storage.Folder,
 			return nil, NewFolderError(err, "Unable to parse service URL")
 		}
 	}
+	httpClientOptions, err := storage.ParseHTTPClientOptions(settings)
+	if err != nil {
+		return nil, err
+	}
 	timeout := time.Duration(tryTimeout) * time.Minute
-	containerClient, err := azblob.NewContainerClient(containerUrlString, credential, &azblob.ClientOptions{
+	clientOptions := &azblob.ClientOptions{
 		Retry: policy.RetryOptions{TryTimeout: timeout},
-	})
+	}
+	var transport http.RoundTripper
+	if !httpClientOptions.IsDefault() {
+		transport, err = storage.NewHTTPTransport(httpClientOptions)
+		if err != nil {
+			return nil, err
+		}
+		clientOptions.Transporter = &http.Client{Transport: transport}
+	}
+	containerClient, err := azblob.NewContainerClient(containerUrlString, credential, clientOptions)
 	if err != nil {
 		return nil, NewFolderError(err, "Unable to create service client")
 	}
 	path = storage.AddDelimiterToPath(path)
-	return NewFolder(getUploadStreamToBlockBlobOptions(settings), containerClient, credential, timeout, path), nil
+	return NewFolder(getUploadStreamToBlockBlobOptions(settings), containerClient, credential, timeout, transport, path), nil
 }
 
 type Folder struct {
@@ -149,6 +164,7 @@ type Folder struct {
 	containerClient                azblob.ContainerClient
 	credential                     azcore.Credential
 	timeout                        time.Duration
+	transport                      http.RoundTripper
 	path                           string
 }
 
@@ -197,6 +213,7 @@ func (folder *Folder) ListFolder() (objects []storage.Object, subFolders []stora
 				folder.containerClient,
 				folder.credential,
 				folder.timeout,
+				folder.transport,
 				subFolderPath))
 		}
 
@@ -210,6 +227,7 @@ func (folder *Folder) GetSubFolder(subFolderRelativePath string) storage.Folder
 		folder.containerClient,
 		folder.credential,
 		folder.timeout,
+		folder.transport,
 		storage.AddDelimiterToPath(storage.JoinPath(folder.path, subFolderRelativePath)))
 }
 
@@ -317,14 +335,30 @@ func buildCanonicalizedResource(c *azblob.SharedKeyCredential, u *url.URL) (stri
 // End from https://github.com/Azure/azure-sdk-for-go/blob/main/sdk/storage/azblob/zc_shared_policy_shared_key_credential.go
 
 func (folder *Folder) ReadObject(objectRelativePath string) (io.ReadCloser, error) {
+	return folder.downloadBlob(objectRelativePath, "", "")
+}
+
+func (folder *Folder) RangeReader(objectRelativePath string, offset, length int64) (io.ReadCloser, error) {
+	return folder.downloadBlob(objectRelativePath, storage.HTTPRange(offset, length), "")
+}
+
+// downloadBlob downloads the whole blob, or its part if the Range header value is given,
+// the blob whose ETag isn't ifMatch, if it's given, fails with storage.ObjectChangedError
+func (folder *Folder) downloadBlob(objectRelativePath, bytesRange, ifMatch string) (io.ReadCloser, error) {
 	path := storage.JoinPath(folder.path, objectRelativePath)
 	blobClient := folder.containerClient.NewBlobClient(path)
-	httpClient := &http.Client{ Timeout: folder.timeout }
+	httpClient := &http.Client{Timeout: folder.timeout, Transport: folder.transport}
 
 	req, err := http.NewRequest("GET", blobClient.URL(), nil)
 	if err != nil {
 		return nil, NewFolderError(err, "Unable to download blob %s.", path)
 	}
+	if bytesRange != "" {
+		req.Header.Set("Range", bytesRange)
+	}
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
 
 	if cred, ok := folder.credential.(*azblob.SharedKeyCredential); ok {
 		// Shared Key auth involves signing each request
@@ -352,8 +386,12 @@ func (folder *Folder) ReadObject(objectRelativePath string) (io.ReadCloser, erro
 		resp.Body.Close()
 		if resp.StatusCode == 404 {
 			return nil, storage.NewObjectNotFoundError(path)
+		} else if resp.StatusCode == http.StatusPreconditionFailed && ifMatch != "" {
+			return nil, storage.NewObjectChangedError(path)
+		} else if isArchivedErrorCode(azblob.StorageErrorCode(resp.Header.Get(errorCodeHeader))) {
+			return nil, storage.NewObjectArchivedError(path)
 		} else {
-			return nil, NewFolderError(errors.New(resp.Status), "Unable to download blob %s.", path)
+			return nil, NewFolderError(newDownloadStatusError(resp), "Unable to download blob %s.", path)
 		}
 	}
 
@@ -459,3 +497,48 @@ func getStorageEndpointSuffix(environmentName string) string {
 	}
 	return storageEndpointSuffix
 }
+
+// DownloadStatusError is the failed response to the download, which is sent without the SDK,
+// so it is told apart by the status code like azblob.StorageError is
+type DownloadStatusError struct {
+	StatusCode int
+	ErrorCode  azblob.StorageErrorCode
+	Status     string
+}
+
+func newDownloadStatusError(resp *http.Response) DownloadStatusError {
+	return DownloadStatusError{
+		StatusCode: resp.StatusCode,
+		ErrorCode:  azblob.StorageErrorCode(resp.Header.Get(errorCodeHeader)),
+		Status:     resp.Status,
+	}
+}
+
+func (err DownloadStatusError) Error() string {
+	if err.ErrorCode == "" {
+		return err.Status
+	}
+	return fmt.Sprintf("%s (%s)", err.Status, err.ErrorCode)
+}
+
+// IsRetryableError recognizes the server errors of Azure and the busy or timed out server
+func IsRetryableError(err error) bool {
+	var statusErr DownloadStatusError
+	if errors.As(err, &statusErr) {
+		return isRetryableErrorCode(statusErr.ErrorCode) ||
+			statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= http.StatusInternalServerError
+	}
+	var stgErr *azblob.StorageError
+	if !errors.As(err, &stgErr) {
+		return false
+	}
+	return isRetryableErrorCode(stgErr.ErrorCode) || stgErr.Temporary()
+}
+
+func isRetryableErrorCode(code azblob.StorageErrorCode) bool {
+	switch code {
+	case azblob.StorageErrorCodeServerBusy, azblob.StorageErrorCodeOperationTimedOut, azblob.StorageErrorCodeInternalError:
+		return true
+	}
+	return false
+}
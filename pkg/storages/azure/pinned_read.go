@@ -0,0 +1,39 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+// GetObjectVersion reads the size and the ETag of the blob properties
+func (folder *Folder) GetObjectVersion(objectRelativePath string) (storage.ObjectVersion, error) {
+	path := storage.JoinPath(folder.path, objectRelativePath)
+	blobClient := folder.containerClient.NewBlobClient(path)
+	properties, err := blobClient.GetProperties(context.Background(), &azblob.GetBlobPropertiesOptions{})
+	var stgErr *azblob.StorageError
+	if err != nil && errors.As(err, &stgErr) && stgErr.ErrorCode == azblob.StorageErrorCodeBlobNotFound {
+		return storage.ObjectVersion{}, storage.NewObjectNotFoundError(path)
+	}
+	if err != nil {
+		return storage.ObjectVersion{}, NewFolderError(err, "Unable to get the properties of blob %s", path)
+	}
+
+	version := storage.ObjectVersion{}
+	if properties.ContentLength != nil {
+		version.Size = *properties.ContentLength
+	}
+	if properties.ETag != nil {
+		version.Tag = *properties.ETag
+	}
+	return version, nil
+}
+
+// PinnedRangeReader downloads the part of the blob with the If-Match header
+func (folder *Folder) PinnedRangeReader(objectRelativePath string, offset, length int64,
+	version storage.ObjectVersion) (io.ReadCloser, error) {
+	return folder.downloadBlob(objectRelativePath, storage.HTTPRange(offset, length), version.Tag)
+}
@@ -11,7 +11,10 @@ import (
 	"github.com/wal-g/wal-g/pkg/storages/storage"
 )
 
-const dirDefaultMode = 0755
+const (
+	dirDefaultMode     = 0755
+	listDirectoryBatch = 1000
+)
 
 func NewError(err error, format string, args ...interface{}) storage.Error {
 	return storage.NewError(err, "FS", format, args...)
@@ -59,6 +62,37 @@ func (folder *Folder) ListFolder() (objects []storage.Object, subFolders []stora
 	return
 }
 
+// ListFolderStream reads the directory by listDirectoryBatch entries, unlike ListFolder
+// they aren't sorted by name but come in the directory order
+func (folder *Folder) ListFolderStream(callback storage.ListCallback) error {
+	directory, err := os.Open(path.Join(folder.rootPath, folder.subpath))
+	if err != nil {
+		return NewError(err, "Unable to read folder")
+	}
+	defer directory.Close()
+	for {
+		files, err := directory.Readdir(listDirectoryBatch)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return NewError(err, "Unable to read folder")
+		}
+		for _, fileInfo := range files {
+			if fileInfo.IsDir() {
+				// I do not use GetSubfolder() intentially
+				subPath := path.Join(folder.subpath, fileInfo.Name()) + "/"
+				err = callback(nil, NewFolder(folder.rootPath, subPath))
+			} else {
+				err = callback(storage.NewLocalObject(fileInfo.Name(), fileInfo.ModTime(), fileInfo.Size()), nil)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
 func (folder *Folder) DeleteObjects(objectRelativePaths []string) error {
 	for _, fileName := range objectRelativePaths {
 		err := os.RemoveAll(folder.GetFilePath(fileName))
@@ -105,6 +139,26 @@ func (folder *Folder) ReadObject(objectRelativePath string) (io.ReadCloser, erro
 	return file, nil
 }
 
+func (folder *Folder) RangeReader(objectRelativePath string, offset, length int64) (io.ReadCloser, error) {
+	reader, err := folder.ReadObject(objectRelativePath)
+	if err != nil {
+		return nil, err
+	}
+	file := reader.(*os.File)
+	_, err = file.Seek(offset, io.SeekStart)
+	if err != nil {
+		file.Close()
+		return nil, NewError(err, "Unable to seek %v", file.Name())
+	}
+	if length < 0 {
+		return file, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(file, length), file}, nil
+}
+
 func (folder *Folder) PutObject(name string, content io.Reader) error {
 	tracelog.DebugLogger.Printf("Put %v into %v\n", name, folder.subpath)
 	filePath := folder.GetFilePath(name)
@@ -3,9 +3,11 @@ package gcs
 import (
 	"context"
 	"encoding/base64"
+	"encoding/hex"
 	"io"
 	"io/ioutil"
 	"math/rand"
+	"net/http"
 	"path"
 	"strconv"
 	"strings"
@@ -17,7 +19,10 @@ import (
 	"github.com/wal-g/wal-g/pkg/storages/storage"
 
 	gcs "cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
 )
 
 const (
@@ -39,13 +44,13 @@ var (
 	BaseRetryDelay = 128 * time.Millisecond
 
 	// SettingList provides a list of GCS folder settings.
-	SettingList = []string{
+	SettingList = append([]string{
 		ContextTimeout,
 		NormalizePrefix,
 		EncryptionKey,
 		MaxChunkSize,
 		MaxRetries,
-	}
+	}, storage.HTTPClientSettingList...)
 )
 
 func NewError(err error, format string, args ...interface{}) storage.Error {
@@ -84,7 +89,11 @@ func ConfigureFolder(prefix string, settings map[string]string) (storage.Folder,
 
 	ctx := context.Background()
 
-	client, err := gcs.NewClient(ctx)
+	clientOptions, err := newClientOptions(ctx, settings)
+	if err != nil {
+		return nil, err
+	}
+	client, err := gcs.NewClient(ctx, clientOptions...)
 	if err != nil {
 		return nil, NewError(err, "Unable to create client")
 	}
@@ -138,6 +147,26 @@ func ConfigureFolder(prefix string, settings map[string]string) (storage.Folder,
 	return NewFolder(bucket, path, contextTimeout, normalizePrefix, encryptionKey, uploaderOptions), nil
 }
 
+// newClientOptions replaces the HTTP transport of the client, if any of the storage HTTP client settings is set
+func newClientOptions(ctx context.Context, settings map[string]string) ([]option.ClientOption, error) {
+	httpClientOptions, err := storage.ParseHTTPClientOptions(settings)
+	if err != nil {
+		return nil, err
+	}
+	if httpClientOptions.IsDefault() {
+		return nil, nil
+	}
+	transport, err := storage.NewHTTPTransport(httpClientOptions)
+	if err != nil {
+		return nil, err
+	}
+	authorizedTransport, err := htransport.NewTransport(ctx, transport, option.WithScopes(gcs.ScopeFullControl))
+	if err != nil {
+		return nil, NewError(err, "Unable to create the HTTP transport")
+	}
+	return []option.ClientOption{option.WithHTTPClient(&http.Client{Transport: authorizedTransport})}, nil
+}
+
 func getUploaderOptions(settings map[string]string) ([]UploaderOption, error) {
 	uploaderOptions := []UploaderOption{}
 
@@ -186,6 +215,11 @@ func (folder *Folder) BuildObjectHandle(path string) *gcs.ObjectHandle {
 }
 
 func (folder *Folder) ListFolder() (objects []storage.Object, subFolders []storage.Folder, err error) {
+	return storage.CollectListing(folder.ListFolderStream)
+}
+
+// ListFolderStream passes the objects to the callback as the iterator fetches their pages
+func (folder *Folder) ListFolderStream(callback storage.ListCallback) error {
 	prefix := storage.AddDelimiterToPath(folder.path)
 	ctx, cancel := folder.createTimeoutContext()
 	defer cancel()
@@ -193,34 +227,44 @@ func (folder *Folder) ListFolder() (objects []storage.Object, subFolders []stora
 	for {
 		objAttrs, err := it.Next()
 		if err == iterator.Done {
-			break
+			return nil
 		}
 		if err != nil {
-			return nil, nil, NewError(err, "Unable to iterate %v", folder.path)
+			return NewError(err, "Unable to iterate %v", folder.path)
 		}
 		if objAttrs.Prefix != "" {
-
 			if objAttrs.Prefix != prefix+"/" {
 				// Sometimes GCS returns "//" folder - skip it
-				subFolders = append(subFolders,
-					NewFolder(
-						folder.bucket,
-						objAttrs.Prefix,
-						folder.contextTimeout,
-						folder.normalizePrefix,
-						folder.encryptionKey,
-						folder.uploaderOptions,
-					))
+				err = callback(nil, NewFolder(
+					folder.bucket,
+					objAttrs.Prefix,
+					folder.contextTimeout,
+					folder.normalizePrefix,
+					folder.encryptionKey,
+					folder.uploaderOptions,
+				))
 			}
 		} else {
 			objName := strings.TrimPrefix(objAttrs.Name, prefix)
 			if objName != "" {
 				// GCS returns the current directory - skip it.
-				objects = append(objects, storage.NewLocalObject(objName, objAttrs.Updated, objAttrs.Size))
+				err = callback(storage.NewLocalObjectWithETag(objName, objAttrs.Updated, objAttrs.Size,
+					md5ETag(objAttrs.MD5)), nil)
 			}
 		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// md5ETag formats the MD5 of the object like the S3 ETag. The composite objects have no MD5, GCS checks
+// their CRC32C when they are read, so the empty ETag tells not to verify them.
+func md5ETag(md5 []byte) string {
+	if len(md5) == 0 {
+		return ""
 	}
-	return
+	return `"` + hex.EncodeToString(md5) + `"`
 }
 
 func (folder *Folder) createTimeoutContext() (context.Context, context.CancelFunc) {
@@ -278,6 +322,20 @@ func (folder *Folder) ReadObject(objectRelativePath string) (io.ReadCloser, erro
 	return ioutil.NopCloser(reader), err
 }
 
+// RangeReader reads the part of the object, GCS takes the negative length as the rest of the object too
+func (folder *Folder) RangeReader(objectRelativePath string, offset, length int64) (io.ReadCloser, error) {
+	path := folder.joinPath(folder.path, objectRelativePath)
+	object := folder.BuildObjectHandle(path)
+	reader, err := object.NewRangeReader(context.Background(), offset, length)
+	if err == gcs.ErrObjectNotExist {
+		return nil, storage.NewObjectNotFoundError(path)
+	}
+	if err != nil {
+		return nil, NewError(err, "Unable to read the range of %v", path)
+	}
+	return ioutil.NopCloser(reader), nil
+}
+
 func (folder *Folder) PutObject(name string, content io.Reader) error {
 	tracelog.DebugLogger.Printf("Put %v into %v\n", name, folder.path)
 	object := folder.BuildObjectHandle(folder.joinPath(folder.path, name))
@@ -422,3 +480,10 @@ func minDuration(a, b time.Duration) time.Duration {
 
 	return b
 }
+
+// IsRetryableError recognizes the rate limiting and the server errors of GCS
+func IsRetryableError(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) &&
+		(apiErr.Code == http.StatusTooManyRequests || apiErr.Code >= http.StatusInternalServerError)
+}
@@ -189,3 +189,11 @@ func TestInvalidUploaderOptions(t *testing.T) {
 		assert.EqualError(t, err, tc.errString)
 	}
 }
+
+func TestMD5ETag(t *testing.T) {
+	md5, ok := storage.PlainMD5FromETag(md5ETag([]byte{0x9e, 0x10, 0x7d, 0x9d, 0x37, 0x2b, 0xb6, 0x82,
+		0x6b, 0xd8, 0x1d, 0x35, 0x42, 0xa4, 0x19, 0xd6}))
+	assert.True(t, ok)
+	assert.Len(t, md5, 16)
+	assert.Equal(t, "", md5ETag(nil))
+}
@@ -0,0 +1,53 @@
+package gcs
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+// GetObjectVersion reads the size and the generation of the object
+func (folder *Folder) GetObjectVersion(objectRelativePath string) (storage.ObjectVersion, error) {
+	path := folder.joinPath(folder.path, objectRelativePath)
+	ctx, cancel := folder.createTimeoutContext()
+	defer cancel()
+	attrs, err := folder.BuildObjectHandle(path).Attrs(ctx)
+	if err == gcs.ErrObjectNotExist {
+		return storage.ObjectVersion{}, storage.NewObjectNotFoundError(path)
+	}
+	if err != nil {
+		return storage.ObjectVersion{}, NewError(err, "Unable to stat object %v", path)
+	}
+	return storage.ObjectVersion{Size: attrs.Size, Tag: strconv.FormatInt(attrs.Generation, 10)}, nil
+}
+
+// PinnedRangeReader reads the part of the object generation
+func (folder *Folder) PinnedRangeReader(objectRelativePath string, offset, length int64,
+	version storage.ObjectVersion) (io.ReadCloser, error) {
+	path := folder.joinPath(folder.path, objectRelativePath)
+	generation, err := strconv.ParseInt(version.Tag, 10, 64)
+	if err != nil {
+		return nil, errors.Errorf("invalid generation '%s' of %v", version.Tag, path)
+	}
+	object := folder.BuildObjectHandle(path).If(gcs.Conditions{GenerationMatch: generation})
+	reader, err := object.NewRangeReader(context.Background(), offset, length)
+	var apiErr *googleapi.Error
+	if err != nil && errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+		return nil, storage.NewObjectChangedError(path)
+	}
+	if err == gcs.ErrObjectNotExist {
+		return nil, storage.NewObjectNotFoundError(path)
+	}
+	if err != nil {
+		return nil, NewError(err, "Unable to read the range of %v", path)
+	}
+	return ioutil.NopCloser(reader), nil
+}
@@ -6,8 +6,8 @@ import (
 	"io/ioutil"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
-	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/wal-g/wal-g/pkg/storages/storage"
@@ -36,26 +36,48 @@ func (folder *Folder) GetPath() string {
 }
 
 func (folder *Folder) ListFolder() (objects []storage.Object, subFolders []storage.Folder, err error) {
-	subFolderNames := sync.Map{}
+	return storage.CollectListing(folder.ListFolderStream)
+}
+
+// ListFolderStream passes the objects and then the subfolders to the callback in the order of their names,
+// so the listing doesn't depend on the order the storage is ranged over, e.g. for the objects of equal timestamps
+func (folder *Folder) ListFolderStream(callback storage.ListCallback) error {
+	var objectNames []string
+	objects := make(map[string]TimeStampedData)
+	subFolderNames := make(map[string]bool)
 	folder.Storage.Range(func(key string, value TimeStampedData) bool {
 		if !strings.HasPrefix(key, folder.path) {
 			return true
 		}
 		if filepath.Base(key) == strings.TrimPrefix(key, folder.path) {
 			nameParts := strings.SplitAfter(key, "/")
-			objects = append(objects, storage.NewLocalObject(nameParts[len(nameParts)-1], value.Timestamp, int64(value.Size)))
+			objectName := nameParts[len(nameParts)-1]
+			objectNames = append(objectNames, objectName)
+			objects[objectName] = value
 		} else {
-			subFolderName := strings.Split(strings.TrimPrefix(key, folder.path), "/")[0]
-			subFolderNames.Store(subFolderName, true)
+			subFolderNames[strings.Split(strings.TrimPrefix(key, folder.path), "/")[0]] = true
 		}
 		return true
 	})
-	subFolderNames.Range(func(iName, _ interface{}) bool {
-		name := iName.(string)
-		subFolders = append(subFolders, NewFolder(path.Join(folder.path, name)+"/", folder.Storage))
-		return true
-	})
-	return
+
+	sort.Strings(objectNames)
+	for _, objectName := range objectNames {
+		value := objects[objectName]
+		if err := callback(storage.NewLocalObject(objectName, value.Timestamp, int64(value.Size)), nil); err != nil {
+			return err
+		}
+	}
+	sortedSubFolderNames := make([]string, 0, len(subFolderNames))
+	for subFolderName := range subFolderNames {
+		sortedSubFolderNames = append(sortedSubFolderNames, subFolderName)
+	}
+	sort.Strings(sortedSubFolderNames)
+	for _, subFolderName := range sortedSubFolderNames {
+		if err := callback(nil, NewFolder(path.Join(folder.path, subFolderName)+"/", folder.Storage)); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (folder *Folder) DeleteObjects(objectRelativePaths []string) error {
@@ -0,0 +1,124 @@
+package s3
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+const (
+	// InvalidObjectStateAWSErrorCode is returned by the read of the archived object which isn't restored
+	InvalidObjectStateAWSErrorCode = "InvalidObjectState"
+	// RestoreAlreadyInProgressAWSErrorCode is returned by the restore of the object which is being restored
+	RestoreAlreadyInProgressAWSErrorCode = "RestoreAlreadyInProgress"
+
+	restoreOngoing = `ongoing-request="true"`
+	restoreDone    = `ongoing-request="false"`
+
+	// archiveStatusHeader tells the Intelligent-Tiering object moved to the archive access tier,
+	// the SDK doesn't parse it, so it's read from the response
+	archiveStatusHeader     = "x-amz-archive-status"
+	archiveAccessStatus     = "ARCHIVE_ACCESS"
+	deepArchiveAccessStatus = "DEEP_ARCHIVE_ACCESS"
+)
+
+var rehydratePriorityTiers = map[storage.RehydratePriority]string{
+	storage.RehydratePriorityBulk:     s3.TierBulk,
+	storage.RehydratePriorityStandard: s3.TierStandard,
+	storage.RehydratePriorityHigh:     s3.TierExpedited,
+}
+
+func isAwsArchived(err error) bool {
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && awsErr.Code() == InvalidObjectStateAWSErrorCode
+}
+
+// isArchived tells the objects which must be restored before they are read: the objects of the Glacier
+// storage classes and the Intelligent-Tiering objects in its archive access tiers.
+// The Glacier Instant Retrieval objects are readable as is.
+func isArchived(storageClass string, archiveStatus string) bool {
+	switch storageClass {
+	case s3.StorageClassGlacier, s3.StorageClassDeepArchive:
+		return true
+	case s3.StorageClassIntelligentTiering:
+		return archiveStatus == archiveAccessStatus || archiveStatus == deepArchiveAccessStatus
+	}
+	return false
+}
+
+// GetObjectTier tells the state of the restore of the archived object by its x-amz-restore header
+func (folder *Folder) GetObjectTier(objectRelativePath string) (storage.ObjectTier, error) {
+	objectPath := folder.Path + objectRelativePath
+	customerKey := folder.uploader.customerKeyHeaders()
+	var archiveStatus string
+	head, err := folder.S3API.HeadObjectWithContext(aws.BackgroundContext(), &s3.HeadObjectInput{
+		Bucket:               folder.Bucket,
+		Key:                  aws.String(objectPath),
+		SSECustomerAlgorithm: customerKey.algorithm,
+		SSECustomerKey:       customerKey.key,
+		SSECustomerKeyMD5:    customerKey.keyMD5,
+	}, func(r *request.Request) {
+		r.Handlers.Complete.PushBack(func(r *request.Request) {
+			if r.HTTPResponse != nil {
+				archiveStatus = r.HTTPResponse.Header.Get(archiveStatusHeader)
+			}
+		})
+	})
+	if err != nil {
+		if isAwsNotExist(err) {
+			return storage.ObjectTier{}, storage.NewObjectNotFoundError(objectPath)
+		}
+		return storage.ObjectTier{}, errors.Wrapf(folder.uploader.explainEncryptionError(err),
+			"failed to check the storage class of s3 object '%s'", objectPath)
+	}
+
+	// S3 omits the header of the STANDARD objects
+	tier := storage.ObjectTier{StorageClass: s3.StorageClassStandard}
+	if head.StorageClass != nil {
+		tier.StorageClass = *head.StorageClass
+	}
+	tier.Archived = isArchived(tier.StorageClass, archiveStatus)
+	restore := aws.StringValue(head.Restore)
+	tier.Rehydrating = strings.Contains(restore, restoreOngoing)
+	tier.Rehydrated = strings.Contains(restore, restoreDone)
+	return tier, nil
+}
+
+// Rehydrate restores the temporary copy of the archived object for options.Days, the Intelligent-Tiering
+// object is moved back to its frequent access tier instead and the restore of it takes no days
+func (folder *Folder) Rehydrate(objectRelativePath string, options storage.RehydrateOptions) error {
+	objectPath := folder.Path + objectRelativePath
+	tier, ok := rehydratePriorityTiers[options.Priority]
+	if !ok {
+		tier = s3.TierStandard
+	}
+	objectTier, err := folder.GetObjectTier(objectRelativePath)
+	if err != nil {
+		return err
+	}
+	restoreRequest := &s3.RestoreRequest{GlacierJobParameters: &s3.GlacierJobParameters{Tier: aws.String(tier)}}
+	if objectTier.StorageClass != s3.StorageClassIntelligentTiering {
+		restoreRequest.Days = aws.Int64(int64(options.Days))
+	}
+	_, err = folder.S3API.RestoreObject(&s3.RestoreObjectInput{
+		Bucket:         folder.Bucket,
+		Key:            aws.String(objectPath),
+		RestoreRequest: restoreRequest,
+	})
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && awsErr.Code() == RestoreAlreadyInProgressAWSErrorCode {
+		return nil
+	}
+	if err != nil {
+		if isAwsNotExist(err) {
+			return storage.NewObjectNotFoundError(objectPath)
+		}
+		return errors.Wrapf(err, "failed to restore s3 object '%s'", objectPath)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package s3
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+const (
+	// MaxCopyObjectSize is the largest object S3 copies by one CopyObject request
+	MaxCopyObjectSize = 5 << 30
+	// CopyPartSize is the part of the multipart copy of the larger objects
+	CopyPartSize = 512 << 20
+)
+
+// serviceSettings locate the S3 service and authenticate to it, the server-side copy is requested
+// by the source client, so the destination must be reachable by the same endpoint and credentials
+var serviceSettings = []string{
+	EndpointSetting,
+	EndpointPortSetting,
+	EndpointSourceSetting,
+	RegionSetting,
+	ForcePathStyleSetting,
+	AccessKeyIdSetting,
+	AccessKeySetting,
+	SecretAccessKeySetting,
+	SecretKeySetting,
+	SessionTokenSetting,
+	RequesterPaysSetting,
+}
+
+// CopyObjectTo copies the object to the S3 folder, e.g. of another bucket, on the server.
+// The objects over MaxCopyObjectSize are copied by the parts of the multipart upload.
+// The copy gets the storage class and the server-side encryption of the destination folder uploads.
+// The folder of another endpoint or of other credentials isn't copied to, the object is streamed instead.
+func (folder *Folder) CopyObjectTo(srcPath string, destination storage.Folder, dstPath string) (bool, error) {
+	dstFolder, ok := destination.(*Folder)
+	if !ok || !folder.isSameService(dstFolder) {
+		return false, nil
+	}
+	srcKey := folder.Path + srcPath
+	sourceKey := folder.uploader.customerKeyHeaders()
+	head, err := folder.S3API.HeadObject(&s3.HeadObjectInput{Bucket: folder.Bucket, Key: aws.String(srcKey),
+		SSECustomerAlgorithm: sourceKey.algorithm, SSECustomerKey: sourceKey.key, SSECustomerKeyMD5: sourceKey.keyMD5})
+	if err != nil {
+		if isAwsNotExist(err) {
+			return false, storage.NewObjectNotFoundError(srcKey)
+		}
+		return false, errors.Wrapf(err, "failed to read the size of '%s'", srcKey)
+	}
+	copySource := escapeCopySource(*folder.Bucket, srcKey)
+	sourceName := *folder.Bucket + "/" + srcKey
+	dstKey := dstFolder.Path + dstPath
+	if aws.Int64Value(head.ContentLength) <= MaxCopyObjectSize {
+		input := &s3.CopyObjectInput{CopySource: aws.String(copySource), Bucket: dstFolder.Bucket, Key: aws.String(dstKey),
+			CopySourceSSECustomerAlgorithm: sourceKey.algorithm,
+			CopySourceSSECustomerKey:       sourceKey.key,
+			CopySourceSSECustomerKeyMD5:    sourceKey.keyMD5,
+		}
+		dstFolder.uploader.setCopyObjectOptions(input)
+		_, err = folder.S3API.CopyObject(input)
+		return true, errors.Wrapf(err, "failed to copy '%s' to '%s'", sourceName, *dstFolder.Bucket+"/"+dstKey)
+	}
+	err = folder.copyMultipart(copySource, aws.Int64Value(head.ContentLength), dstFolder, dstKey)
+	return true, errors.Wrapf(err, "failed to copy '%s' to '%s'", sourceName, *dstFolder.Bucket+"/"+dstKey)
+}
+
+func (folder *Folder) isSameService(other *Folder) bool {
+	for _, setting := range serviceSettings {
+		if folder.settings[setting] != other.settings[setting] {
+			return false
+		}
+	}
+	return true
+}
+
+// escapeCopySource URL-encodes the key of the copy source like the AWS SDKs do, the slashes are kept
+func escapeCopySource(bucket, key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = strings.ReplaceAll(url.QueryEscape(segment), "+", "%20")
+	}
+	return bucket + "/" + strings.Join(segments, "/")
+}
+
+func (folder *Folder) copyMultipart(copySource string, size int64, dstFolder *Folder, dstKey string) error {
+	createInput := &s3.CreateMultipartUploadInput{Bucket: dstFolder.Bucket, Key: aws.String(dstKey)}
+	dstFolder.uploader.setMultipartUploadOptions(createInput)
+	upload, err := folder.S3API.CreateMultipartUpload(createInput)
+	if err != nil {
+		return err
+	}
+	parts, err := folder.copyParts(copySource, size, dstFolder, dstKey, upload.UploadId)
+	if err == nil {
+		_, err = folder.S3API.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+			Bucket:          dstFolder.Bucket,
+			Key:             aws.String(dstKey),
+			UploadId:        upload.UploadId,
+			MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+		})
+	}
+	if err != nil {
+		_, abortErr := folder.S3API.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+			Bucket:   dstFolder.Bucket,
+			Key:      aws.String(dstKey),
+			UploadId: upload.UploadId,
+		})
+		if abortErr != nil {
+			tracelog.WarningLogger.Printf("Failed to abort the multipart copy to '%s': %v", dstKey, abortErr)
+		}
+	}
+	return err
+}
+
+func (folder *Folder) copyParts(copySource string, size int64, dstFolder *Folder, dstKey string,
+	uploadID *string) ([]*s3.CompletedPart, error) {
+	var parts []*s3.CompletedPart
+	upload := dstFolder.uploader.createUploadInput(*dstFolder.Bucket, dstKey, nil)
+	sourceKey := folder.uploader.customerKeyHeaders()
+	for offset, partNumber := int64(0), int64(1); offset < size; offset, partNumber = offset+CopyPartSize, partNumber+1 {
+		last := offset + CopyPartSize - 1
+		if last >= size {
+			last = size - 1
+		}
+		output, err := folder.S3API.UploadPartCopy(&s3.UploadPartCopyInput{
+			Bucket:          dstFolder.Bucket,
+			Key:             aws.String(dstKey),
+			UploadId:        uploadID,
+			PartNumber:      aws.Int64(partNumber),
+			CopySource:      aws.String(copySource),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", offset, last)),
+
+			SSECustomerAlgorithm: upload.SSECustomerAlgorithm,
+			SSECustomerKey:       upload.SSECustomerKey,
+			SSECustomerKeyMD5:    upload.SSECustomerKeyMD5,
+
+			CopySourceSSECustomerAlgorithm: sourceKey.algorithm,
+			CopySourceSSECustomerKey:       sourceKey.key,
+			CopySourceSSECustomerKeyMD5:    sourceKey.keyMD5,
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to copy part %d", partNumber)
+		}
+		parts = append(parts, &s3.CompletedPart{ETag: output.CopyPartResult.ETag, PartNumber: aws.Int64(partNumber)})
+	}
+	return parts, nil
+}
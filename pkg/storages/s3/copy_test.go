@@ -0,0 +1,60 @@
+package s3
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// copyRecordingS3API records the server-side copies of the small objects
+type copyRecordingS3API struct {
+	s3iface.S3API
+	copySources []string
+}
+
+func (api *copyRecordingS3API) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(10)}, nil
+}
+
+func (api *copyRecordingS3API) CopyObject(input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
+	api.copySources = append(api.copySources, aws.StringValue(input.CopySource))
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func newCopyTestFolder(api s3iface.S3API, bucket string, settings map[string]string) *Folder {
+	return NewFolder(*NewUploader(nil, "", "", "", "STANDARD"), api, settings, bucket, "path", false)
+}
+
+func TestCopyObjectTo_escapesCopySource(t *testing.T) {
+	api := &copyRecordingS3API{}
+	source := newCopyTestFolder(api, "source", map[string]string{})
+	destination := newCopyTestFolder(api, "destination", map[string]string{})
+
+	copied, err := source.CopyObjectTo("dir/a b+c%d.tar", destination, "dir/a b+c%d.tar")
+	require.NoError(t, err)
+	assert.True(t, copied)
+	assert.Equal(t, []string{"source/path/dir/a%20b%2Bc%25d.tar"}, api.copySources)
+}
+
+func TestCopyObjectTo_otherServiceIsStreamed(t *testing.T) {
+	api := &copyRecordingS3API{}
+	settings := map[string]string{EndpointSetting: "https://s3.example.com", AccessKeyIdSetting: "source"}
+	source := newCopyTestFolder(api, "source", settings)
+	for _, otherSettings := range []map[string]string{
+		{EndpointSetting: "https://storage.example.com", AccessKeyIdSetting: "source"},
+		{EndpointSetting: "https://s3.example.com", AccessKeyIdSetting: "destination"},
+	} {
+		copied, err := source.CopyObjectTo("object", newCopyTestFolder(api, "destination", otherSettings), "object")
+		assert.NoError(t, err)
+		assert.False(t, copied)
+	}
+	assert.Empty(t, api.copySources)
+
+	copied, err := source.CopyObjectTo("object", newCopyTestFolder(api, "destination", settings), "object")
+	assert.NoError(t, err)
+	assert.True(t, copied)
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/pkg/errors"
@@ -40,6 +41,7 @@ const (
 	UseListObjectsV1         = "S3_USE_LIST_OBJECTS_V1"
 	RangeBatchEnabled        = "S3_RANGE_BATCH_ENABLED"
 	RangeQueriesMaxRetries   = "S3_RANGE_MAX_RETRIES"
+	RequesterPaysSetting     = "S3_REQUESTER_PAYS"
 	// MaxRetriesSetting limits retries during interaction with S3
 	MaxRetriesSetting = "S3_MAX_RETRIES"
 
@@ -53,7 +55,7 @@ const (
 var (
 	// MaxRetries limit upload and download retries during interaction with S3
 	MaxRetries  = 15
-	SettingList = []string{
+	SettingList = append([]string{
 		EndpointPortSetting,
 		EndpointSetting,
 		EndpointSourceSetting,
@@ -76,7 +78,8 @@ var (
 		RangeBatchEnabled,
 		RangeQueriesMaxRetries,
 		MaxRetriesSetting,
-	}
+		RequesterPaysSetting,
+	}, storage.HTTPClientSettingList...)
 )
 
 func NewFolderError(err error, format string, args ...interface{}) storage.Error {
@@ -96,6 +99,8 @@ type Folder struct {
 	settings map[string]string
 
 	useListObjectsV1 bool
+	// requestOptions are applied to the requests of the listing pages and the upload parts
+	requestOptions []request.Option
 }
 
 func NewFolder(uploader Uploader, s3API s3iface.S3API, settings map[string]string, bucket, path string, useListObjectsV1 bool) *Folder {
@@ -119,6 +124,10 @@ func ConfigureFolder(prefix string, settings map[string]string) (storage.Folder,
 		return nil, errors.Wrap(err, "failed to create new session")
 	}
 	client := s3.New(sess)
+	err = configureRequesterPays(client, settings)
+	if err != nil {
+		return nil, err
+	}
 	uploader, err := configureUploader(client, settings)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to configure S3 uploader")
@@ -138,9 +147,13 @@ func ConfigureFolder(prefix string, settings map[string]string) (storage.Folder,
 
 func (folder *Folder) Exists(objectRelativePath string) (bool, error) {
 	objectPath := folder.Path + objectRelativePath
+	customerKey := folder.uploader.customerKeyHeaders()
 	stopSentinelObjectInput := &s3.HeadObjectInput{
-		Bucket: folder.Bucket,
-		Key:    aws.String(objectPath),
+		Bucket:               folder.Bucket,
+		Key:                  aws.String(objectPath),
+		SSECustomerAlgorithm: customerKey.algorithm,
+		SSECustomerKey:       customerKey.key,
+		SSECustomerKeyMD5:    customerKey.keyMD5,
 	}
 
 	_, err := folder.S3API.HeadObject(stopSentinelObjectInput)
@@ -148,13 +161,14 @@ func (folder *Folder) Exists(objectRelativePath string) (bool, error) {
 		if isAwsNotExist(err) {
 			return false, nil
 		}
-		return false, errors.Wrapf(err, "failed to check s3 object '%s' existance", objectPath)
+		return false, errors.Wrapf(folder.uploader.explainEncryptionError(err),
+			"failed to check s3 object '%s' existance", objectPath)
 	}
 	return true, nil
 }
 
 func (folder *Folder) PutObject(name string, content io.Reader) error {
-	return folder.uploader.upload(*folder.Bucket, folder.Path+name, content)
+	return folder.uploader.upload(*folder.Bucket, folder.Path+name, content, folder.requestOptions...)
 }
 
 func (folder *Folder) CopyObject(srcPath string, dstPath string) error {
@@ -167,7 +181,13 @@ func (folder *Folder) CopyObject(srcPath string, dstPath string) error {
 	}
 	source := path.Join(*folder.Bucket, folder.Path, srcPath)
 	dst := path.Join(folder.Path, dstPath)
-	input := &s3.CopyObjectInput{CopySource: &source, Bucket: folder.Bucket, Key: &dst}
+	customerKey := folder.uploader.customerKeyHeaders()
+	input := &s3.CopyObjectInput{CopySource: &source, Bucket: folder.Bucket, Key: &dst,
+		CopySourceSSECustomerAlgorithm: customerKey.algorithm,
+		CopySourceSSECustomerKey:       customerKey.key,
+		CopySourceSSECustomerKeyMD5:    customerKey.keyMD5,
+	}
+	folder.uploader.setCopyObjectOptions(input)
 	_, err := folder.S3API.CopyObject(input)
 	if err != nil {
 		return err
@@ -177,17 +197,11 @@ func (folder *Folder) CopyObject(srcPath string, dstPath string) error {
 
 func (folder *Folder) ReadObject(objectRelativePath string) (io.ReadCloser, error) {
 	objectPath := folder.Path + objectRelativePath
-	input := &s3.GetObjectInput{
-		Bucket: folder.Bucket,
-		Key:    aws.String(objectPath),
-	}
+	input := folder.getObjectInput(objectPath)
 
-	object, err := folder.S3API.GetObject(input)
+	object, err := folder.getObject(input)
 	if err != nil {
-		if isAwsNotExist(err) {
-			return nil, storage.NewObjectNotFoundError(objectPath)
-		}
-		return nil, errors.Wrapf(err, "failed to read object: '%s' from S3", objectPath)
+		return nil, err
 	}
 
 	rangeEnabled, maxRetries, minRetryDelay, maxRetryDelay := folder.getReaderSettings()
@@ -196,7 +210,52 @@ func (folder *Folder) ReadObject(objectRelativePath string) (io.ReadCloser, erro
 	if rangeEnabled {
 		reader = NewS3Reader(object.Body, objectPath, maxRetries, folder, minRetryDelay, maxRetryDelay)
 	}
-	return reader, nil
+	return storage.NewObjectReader(reader, storage.ObjectReadAttributes{
+		ContentEncoding: aws.StringValue(object.ContentEncoding),
+		ETag:            aws.StringValue(object.ETag),
+	}), nil
+}
+
+// RangeReader reads the part of the object with the Range request, the S3_RANGE_BATCH_ENABLED retries don't apply.
+// The ETag is the one of the whole object.
+func (folder *Folder) RangeReader(objectRelativePath string, offset, length int64) (io.ReadCloser, error) {
+	input := folder.getObjectInput(folder.Path + objectRelativePath)
+	input.Range = aws.String(storage.HTTPRange(offset, length))
+	object, err := folder.getObject(input)
+	if err != nil {
+		return nil, err
+	}
+	return storage.NewObjectReader(object.Body, storage.ObjectReadAttributes{
+		ContentEncoding: aws.StringValue(object.ContentEncoding),
+		ETag:            aws.StringValue(object.ETag),
+	}), nil
+}
+
+// getObjectInput reads the object with the SSE-C key if it's configured
+func (folder *Folder) getObjectInput(objectPath string) *s3.GetObjectInput {
+	customerKey := folder.uploader.customerKeyHeaders()
+	return &s3.GetObjectInput{
+		Bucket:               folder.Bucket,
+		Key:                  aws.String(objectPath),
+		SSECustomerAlgorithm: customerKey.algorithm,
+		SSECustomerKey:       customerKey.key,
+		SSECustomerKeyMD5:    customerKey.keyMD5,
+	}
+}
+
+func (folder *Folder) getObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	object, err := folder.S3API.GetObject(input)
+	if err != nil {
+		if isAwsNotExist(err) {
+			return nil, storage.NewObjectNotFoundError(*input.Key)
+		}
+		if isAwsArchived(err) {
+			return nil, storage.NewObjectArchivedError(*input.Key)
+		}
+		return nil, errors.Wrapf(folder.uploader.explainEncryptionError(err),
+			"failed to read object: '%s' from S3", *input.Key)
+	}
+	return object, nil
 }
 
 func (folder *Folder) getReaderSettings() (rangeEnabled bool, retriesCount int, minRetryDelay, maxRetryDelay time.Duration) {
@@ -237,11 +296,19 @@ func (folder *Folder) GetPath() string {
 }
 
 func (folder *Folder) ListFolder() (objects []storage.Object, subFolders []storage.Folder, err error) {
-	listFunc := func(commonPrefixes []*s3.CommonPrefix, contents []*s3.Object) {
+	return storage.CollectListing(folder.ListFolderStream)
+}
+
+// ListFolderStream passes the objects of every page to the callback as soon as the page is listed
+func (folder *Folder) ListFolderStream(callback storage.ListCallback) error {
+	var callbackErr error
+	listFunc := func(commonPrefixes []*s3.CommonPrefix, contents []*s3.Object) bool {
 		for _, prefix := range commonPrefixes {
 			subFolder := NewFolder(folder.uploader, folder.S3API, folder.settings, *folder.Bucket,
 				*prefix.Prefix, folder.useListObjectsV1)
-			subFolders = append(subFolders, subFolder)
+			if callbackErr = callback(nil, subFolder); callbackErr != nil {
+				return false
+			}
 		}
 		for _, object := range contents {
 			// Some storages return root tar_partitions folder as a Key.
@@ -251,48 +318,53 @@ func (folder *Folder) ListFolder() (objects []storage.Object, subFolders []stora
 				continue
 			}
 			objectRelativePath := strings.TrimPrefix(*object.Key, folder.Path)
-			objects = append(objects, storage.NewLocalObject(objectRelativePath, *object.LastModified, *object.Size))
+			callbackErr = callback(storage.NewLocalObjectWithETag(objectRelativePath, *object.LastModified, *object.Size,
+				aws.StringValue(object.ETag)), nil)
+			if callbackErr != nil {
+				return false
+			}
 		}
+		return true
 	}
 
 	prefix := aws.String(folder.Path)
 	delimiter := aws.String("/")
+	var err error
 	if folder.useListObjectsV1 {
 		err = folder.listObjectsPagesV1(prefix, delimiter, listFunc)
 	} else {
 		err = folder.listObjectsPagesV2(prefix, delimiter, listFunc)
 	}
-
-	if err != nil {
-		return nil, nil, errors.Wrapf(err, "failed to list s3 folder: '%s'", folder.Path)
+	if callbackErr != nil {
+		return callbackErr
 	}
-	return objects, subFolders, nil
+	return errors.Wrapf(err, "failed to list s3 folder: '%s'", folder.Path)
 }
 
 func (folder *Folder) listObjectsPagesV1(prefix *string, delimiter *string,
-	listFunc func(commonPrefixes []*s3.CommonPrefix, contents []*s3.Object)) error {
+	listFunc func(commonPrefixes []*s3.CommonPrefix, contents []*s3.Object) bool) error {
 	s3Objects := &s3.ListObjectsInput{
 		Bucket:    folder.Bucket,
 		Prefix:    prefix,
 		Delimiter: delimiter,
 	}
-	return folder.S3API.ListObjectsPages(s3Objects, func(files *s3.ListObjectsOutput, lastPage bool) bool {
-		listFunc(files.CommonPrefixes, files.Contents)
-		return true
-	})
+	return folder.S3API.ListObjectsPagesWithContext(aws.BackgroundContext(), s3Objects,
+		func(files *s3.ListObjectsOutput, lastPage bool) bool {
+			return listFunc(files.CommonPrefixes, files.Contents)
+		}, folder.requestOptions...)
 }
 
 func (folder *Folder) listObjectsPagesV2(prefix *string, delimiter *string,
-	listFunc func(commonPrefixes []*s3.CommonPrefix, contents []*s3.Object)) error {
+	listFunc func(commonPrefixes []*s3.CommonPrefix, contents []*s3.Object) bool) error {
 	s3Objects := &s3.ListObjectsV2Input{
 		Bucket:    folder.Bucket,
 		Prefix:    prefix,
 		Delimiter: delimiter,
 	}
-	return folder.S3API.ListObjectsV2Pages(s3Objects, func(files *s3.ListObjectsV2Output, lastPage bool) bool {
-		listFunc(files.CommonPrefixes, files.Contents)
-		return true
-	})
+	return folder.S3API.ListObjectsV2PagesWithContext(aws.BackgroundContext(), s3Objects,
+		func(files *s3.ListObjectsV2Output, lastPage bool) bool {
+			return listFunc(files.CommonPrefixes, files.Contents)
+		}, folder.requestOptions...)
 }
 
 func (folder *Folder) DeleteObjects(objectRelativePaths []string) error {
@@ -0,0 +1,21 @@
+package s3
+
+import (
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+// WithRequestPacer returns the copy of the folder which calls the pacer before every request of the listing
+// pages and the upload parts. The requests resent by the SDK after the transient errors are paced too.
+func (folder *Folder) WithRequestPacer(pacer storage.RequestPacer) storage.Folder {
+	paced := *folder
+	paced.requestOptions = append(append([]request.Option(nil), folder.requestOptions...),
+		func(r *request.Request) {
+			r.Handlers.Sign.PushFront(func(r *request.Request) {
+				if err := pacer(r.Operation.Name, ""); err != nil {
+					r.Error = err
+				}
+			})
+		})
+	return &paced
+}
@@ -0,0 +1,44 @@
+package s3
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"golang.org/x/time/rate"
+)
+
+// pagedListingServer lists one object per page, the continuation token is the number of the next page
+type pagedListingServer struct {
+	pages int
+}
+
+func (server *pagedListingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("continuation-token"))
+	truncated, next := page+1 < server.pages, ""
+	if truncated {
+		next = fmt.Sprintf("<NextContinuationToken>%d</NextContinuationToken>", page+1)
+	}
+	_, _ = fmt.Fprintf(w, "<ListBucketResult><IsTruncated>%t</IsTruncated>%s"+
+		"<Contents><Key>path/object_%d</Key><Size>1</Size>"+
+		"<LastModified>2021-01-01T00:00:00.000Z</LastModified></Contents></ListBucketResult>", truncated, next, page)
+}
+
+func TestThrottlingFolder_pacesListingPages(t *testing.T) {
+	folder := configureHTTPTestFolder(t, &pagedListingServer{pages: 3})
+	limiter := rate.NewLimiter(rate.Every(10*time.Millisecond), 1)
+	throttlingFolder := storage.NewThrottlingFolder(folder, limiter)
+	statsBefore := storage.GetThrottleStats()
+
+	objects, _, err := throttlingFolder.ListFolder()
+	require.NoError(t, err)
+	assert.Len(t, objects, 3)
+	// the first page takes the burst, the other two wait for the limiter
+	stats := storage.GetThrottleStats()
+	assert.Equal(t, int64(2), stats.ThrottledCalls-statsBefore.ThrottledCalls)
+}
@@ -0,0 +1,59 @@
+package s3
+
+import (
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+// PreconditionFailedAWSErrorCode is returned by the If-Match read of the object whose ETag has changed
+const PreconditionFailedAWSErrorCode = "PreconditionFailed"
+
+func isAwsPreconditionFailed(err error) bool {
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && awsErr.Code() == PreconditionFailedAWSErrorCode
+}
+
+// GetObjectVersion reads the size and the ETag of the object by the HEAD request
+func (folder *Folder) GetObjectVersion(objectRelativePath string) (storage.ObjectVersion, error) {
+	objectPath := folder.Path + objectRelativePath
+	customerKey := folder.uploader.customerKeyHeaders()
+	head, err := folder.S3API.HeadObject(&s3.HeadObjectInput{
+		Bucket:               folder.Bucket,
+		Key:                  aws.String(objectPath),
+		SSECustomerAlgorithm: customerKey.algorithm,
+		SSECustomerKey:       customerKey.key,
+		SSECustomerKeyMD5:    customerKey.keyMD5,
+	})
+	if err != nil {
+		if isAwsNotExist(err) {
+			return storage.ObjectVersion{}, storage.NewObjectNotFoundError(objectPath)
+		}
+		return storage.ObjectVersion{}, errors.Wrapf(folder.uploader.explainEncryptionError(err),
+			"failed to read the size of s3 object '%s'", objectPath)
+	}
+	return storage.ObjectVersion{Size: aws.Int64Value(head.ContentLength), Tag: aws.StringValue(head.ETag)}, nil
+}
+
+// PinnedRangeReader reads the part of the object with the Range and If-Match request
+func (folder *Folder) PinnedRangeReader(objectRelativePath string, offset, length int64,
+	version storage.ObjectVersion) (io.ReadCloser, error) {
+	input := folder.getObjectInput(folder.Path + objectRelativePath)
+	input.Range = aws.String(storage.HTTPRange(offset, length))
+	input.IfMatch = aws.String(version.Tag)
+	object, err := folder.getObject(input)
+	if err != nil {
+		if isAwsPreconditionFailed(err) {
+			return nil, storage.NewObjectChangedError(*input.Key)
+		}
+		return nil, err
+	}
+	return storage.NewObjectReader(object.Body, storage.ObjectReadAttributes{
+		ContentEncoding: aws.StringValue(object.ContentEncoding),
+		ETag:            aws.StringValue(object.ETag),
+	}), nil
+}
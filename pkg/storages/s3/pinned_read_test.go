@@ -0,0 +1,63 @@
+package s3
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+// versionedObjectServer serves the object with its ETag, the reads with another If-Match fail like S3 fails them
+type versionedObjectServer struct {
+	content string
+	etag    string
+}
+
+func (server *versionedObjectServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("ETag", server.etag)
+	if r.Method == http.MethodHead {
+		w.Header().Set("Content-Length", strconv.Itoa(len(server.content)))
+		return
+	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != server.etag {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		_, _ = fmt.Fprint(w, "<Error><Code>PreconditionFailed</Code><Message>At least one of the "+
+			"pre-conditions you specified did not hold</Message></Error>")
+		return
+	}
+	var start, end int
+	_, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end)
+	if err != nil {
+		start, end = 0, len(server.content)-1
+	}
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(server.content)))
+	w.WriteHeader(http.StatusPartialContent)
+	_, _ = fmt.Fprint(w, server.content[start:end+1])
+}
+
+func TestPinnedRangeReader(t *testing.T) {
+	server := &versionedObjectServer{content: "first version", etag: `"1"`}
+	folder := configureHTTPTestFolder(t, server)
+	assert.True(t, storage.SupportsPinnedReads(folder))
+
+	version, err := storage.GetObjectVersion(folder, "object")
+	require.NoError(t, err)
+	assert.Equal(t, storage.ObjectVersion{Size: int64(len("first version")), Tag: `"1"`}, version)
+
+	reader, err := storage.ReadPinnedObjectRange(folder, "object", 6, 7, version)
+	require.NoError(t, err)
+	content, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.NoError(t, reader.Close())
+	assert.Equal(t, "version", string(content))
+
+	server.content, server.etag = strings.ToUpper(server.content), `"2"`
+	_, err = storage.ReadPinnedObjectRange(folder, "object", 6, 7, version)
+	assert.IsType(t, storage.ObjectChangedError{}, err)
+}
@@ -0,0 +1,63 @@
+package s3
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+)
+
+const requestPayerHeader = "X-Amz-Request-Payer"
+
+// configureRequesterPays makes the client pay for the requests to the requester-pays bucket: every request,
+// including the listings, the deletions and the multipart uploads, carries the x-amz-request-payer header.
+// Without the setting the refusals of such a bucket name it.
+func configureRequesterPays(client *s3.S3, settings map[string]string) error {
+	requesterPays := false
+	if requesterPaysStr, ok := settings[RequesterPaysSetting]; ok {
+		var err error
+		requesterPays, err = strconv.ParseBool(requesterPaysStr)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse %s", RequesterPaysSetting)
+		}
+	}
+	if requesterPays {
+		// the header is set before the signing, so it's signed as the x-amz-* headers have to be
+		client.Handlers.Build.PushBack(setRequestPayer)
+	} else {
+		client.Handlers.UnmarshalError.PushBack(explainRequesterPaysError)
+	}
+	return nil
+}
+
+func setRequestPayer(r *request.Request) {
+	r.HTTPRequest.Header.Set(requestPayerHeader, s3.RequestPayerRequester)
+}
+
+// explainRequesterPaysError suggests the setting when the bucket refuses the request since the requester
+// doesn't pay for it, the code of the error is kept so its checks don't change
+func explainRequesterPaysError(r *request.Request) {
+	var requestFailure awserr.RequestFailure
+	if !errors.As(r.Error, &requestFailure) || requestFailure.StatusCode() != http.StatusForbidden ||
+		!mentionsRequestPayment(requestFailure.Message()) {
+		return
+	}
+	r.Error = awserr.NewRequestFailure(
+		awserr.New(requestFailure.Code(),
+			fmt.Sprintf("%s; if the bucket is requester-pays, set %s to true", requestFailure.Message(),
+				RequesterPaysSetting),
+			requestFailure.OrigErr()),
+		requestFailure.StatusCode(), requestFailure.RequestID())
+}
+
+func mentionsRequestPayment(message string) bool {
+	message = strings.ToLower(message)
+	return strings.Contains(message, "requester pays") || strings.Contains(message, "requester-pays") ||
+		strings.Contains(message, "request payer") || strings.Contains(message, "request-payer") ||
+		strings.Contains(message, "request payment")
+}
@@ -1,9 +1,12 @@
 package s3
 
 import (
+	"net/http"
 	"strings"
 
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/pkg/errors"
 )
 
 func NewConnResetRetryer(baseRetryer request.Retryer) *ConnResetRetryer {
@@ -23,3 +26,17 @@ func (r ConnResetRetryer) ShouldRetry(req *request.Request) bool {
 
 	return r.Retryer.ShouldRetry(req)
 }
+
+// IsRetryableError recognizes the throttling and the server errors which are left
+// after the retries of the SDK, so the storage.RetryingFolder repeats the whole operation
+func IsRetryableError(err error) bool {
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) {
+		return false
+	}
+	if request.IsErrorRetryable(awsErr) || request.IsErrorThrottle(awsErr) {
+		return true
+	}
+	var requestFailure awserr.RequestFailure
+	return errors.As(err, &requestFailure) && requestFailure.StatusCode() >= http.StatusInternalServerError
+}
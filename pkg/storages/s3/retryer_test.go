@@ -7,9 +7,12 @@ import (
 	"syscall"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
 )
 
 func TestConnResetRetryerRetry(t *testing.T) {
@@ -41,3 +44,13 @@ func TestConnResetRetryerNoError(t *testing.T) {
 	retryer := NewConnResetRetryer(client.DefaultRetryer{})
 	assert.False(t, retryer.ShouldRetry(&request.Request{}))
 }
+
+func TestIsRetryableError(t *testing.T) {
+	throttled := awserr.NewRequestFailure(awserr.New("SlowDown", "Please reduce your request rate.", nil), 503, "id")
+	assert.True(t, IsRetryableError(storage.NewError(errors.Wrap(throttled, "failed to read object"), "S3", "read")))
+	assert.True(t, IsRetryableError(awserr.NewRequestFailure(awserr.New("InternalError", "", nil), 500, "id")))
+
+	assert.False(t, IsRetryableError(awserr.NewRequestFailure(awserr.New("AccessDenied", "", nil), 403, "id")))
+	assert.False(t, IsRetryableError(awserr.New(NoSuchKeyAWSErrorCode, "", nil)))
+	assert.False(t, IsRetryableError(fmt.Errorf("some strange unknown error")))
+}
@@ -37,11 +37,8 @@ func (reader *s3Reader) getObjectRange(from, to int64) (*s3.GetObjectOutput, err
 	if to != 0 {
 		bytesRange += strconv.Itoa(int(to))
 	}
-	input := &s3.GetObjectInput{
-		Bucket: reader.folder.Bucket,
-		Key:    aws.String(reader.objectPath),
-		Range:  aws.String(bytesRange),
-	}
+	input := reader.folder.getObjectInput(reader.objectPath)
+	input.Range = aws.String(bytesRange)
 	reader.debugLog("GetObject with range %s", bytesRange)
 	return reader.folder.S3API.GetObject(input)
 }
@@ -17,6 +17,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/pkg/errors"
 	"github.com/wal-g/tracelog"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
 )
 
 const DefaultPort = "443"
@@ -149,6 +150,17 @@ func createSession(bucket string, settings map[string]string) (*session.Session,
 	}
 	config := getDefaultConfig(settings, maxRetriesCount)
 	config.MaxRetries = aws.Int(maxRetriesCount)
+	httpClientOptions, err := storage.ParseHTTPClientOptions(settings)
+	if err != nil {
+		return nil, err
+	}
+	if !httpClientOptions.IsDefault() {
+		transport, err := storage.NewHTTPTransport(httpClientOptions)
+		if err != nil {
+			return nil, err
+		}
+		config.HTTPClient = &http.Client{Transport: transport}
+	}
 	if _, err := config.Credentials.Get(); err != nil {
 		return nil, errors.Wrapf(err, "failed to get AWS credentials; please specify %s and %s", AccessKeyIdSetting, SecretAccessKeySetting)
 	}
@@ -8,6 +8,8 @@ import (
 	"strconv"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
@@ -32,6 +34,21 @@ func (err SseKmsIdNotSetError) Error() string {
 	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
 }
 
+// sseCustomerKeySize is the size of the AES-256 key of SSE-C
+const sseCustomerKeySize = 32
+
+type InvalidSseCustomerKeyError struct {
+	error
+}
+
+func newInvalidSseCustomerKeyError() InvalidSseCustomerKeyError {
+	return InvalidSseCustomerKeyError{errors.Errorf("%s must be the 32 bytes key or its base64 encoding", SseCSetting)}
+}
+
+func (err InvalidSseCustomerKeyError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
 type Uploader struct {
 	uploaderAPI          s3manageriface.UploaderAPI
 	serverSideEncryption string
@@ -55,11 +72,10 @@ func (uploader *Uploader) createUploadInput(bucket, path string, content io.Read
 
 	if uploader.serverSideEncryption != "" {
 		if uploader.SSECustomerKey != "" {
-			uploadInput.SSECustomerAlgorithm = aws.String(uploader.serverSideEncryption)
-			uploadInput.SSECustomerKey = aws.String(uploader.SSECustomerKey)
-			hash := md5.Sum([]byte(uploader.SSECustomerKey))
-			customerKeyMD5 := base64.StdEncoding.EncodeToString(hash[:])
-			uploadInput.SSECustomerKeyMD5 = aws.String(customerKeyMD5)
+			customerKey := uploader.customerKeyHeaders()
+			uploadInput.SSECustomerAlgorithm = customerKey.algorithm
+			uploadInput.SSECustomerKey = customerKey.key
+			uploadInput.SSECustomerKeyMD5 = customerKey.keyMD5
 		} else {
 			uploadInput.ServerSideEncryption = aws.String(uploader.serverSideEncryption)
 		}
@@ -73,10 +89,71 @@ func (uploader *Uploader) createUploadInput(bucket, path string, content io.Read
 	return uploadInput
 }
 
-func (uploader *Uploader) upload(bucket, path string, content io.Reader) error {
+// customerKeyHeaders are the SSE-C headers which every read, check and copy of the object encrypted
+// by the customer key must carry, not only its upload
+type customerKeyHeaders struct {
+	algorithm *string
+	key       *string
+	keyMD5    *string
+}
+
+// customerKeyHeaders returns the empty headers unless SSE-C is configured
+func (uploader *Uploader) customerKeyHeaders() customerKeyHeaders {
+	if uploader.serverSideEncryption == "" || uploader.SSECustomerKey == "" {
+		return customerKeyHeaders{}
+	}
+	hash := md5.Sum([]byte(uploader.SSECustomerKey))
+	return customerKeyHeaders{
+		algorithm: aws.String(uploader.serverSideEncryption),
+		key:       aws.String(uploader.SSECustomerKey),
+		keyMD5:    aws.String(base64.StdEncoding.EncodeToString(hash[:])),
+	}
+}
+
+// explainEncryptionError points at the encryption settings when the storage rejects the request
+// for the lack of the encryption headers
+func (uploader *Uploader) explainEncryptionError(err error) error {
+	awsErr, ok := errors.Cause(err).(awserr.Error)
+	if !ok || (awsErr.Code() != "InvalidRequest" && awsErr.Code() != "AccessDenied" && awsErr.Code() != "BadRequest") {
+		return err
+	}
+	if uploader.serverSideEncryption == "" {
+		return errors.Wrapf(err, "if the bucket requires the server-side encryption, set %s, with %s for aws:kms, "+
+			"or %s for the customer key", SseSetting, SseKmsIdSetting, SseCSetting)
+	}
+	if uploader.SSECustomerKey == "" && awsErr.Code() != "AccessDenied" {
+		return errors.Wrapf(err, "if the object is encrypted with the customer key, set %s", SseCSetting)
+	}
+	return err
+}
+
+// setCopyObjectOptions gives the object copied to the uploader's bucket its storage class and encryption
+func (uploader *Uploader) setCopyObjectOptions(input *s3.CopyObjectInput) {
+	upload := uploader.createUploadInput(*input.Bucket, *input.Key, nil)
+	input.StorageClass = upload.StorageClass
+	input.ServerSideEncryption = upload.ServerSideEncryption
+	input.SSECustomerAlgorithm = upload.SSECustomerAlgorithm
+	input.SSECustomerKey = upload.SSECustomerKey
+	input.SSECustomerKeyMD5 = upload.SSECustomerKeyMD5
+	input.SSEKMSKeyId = upload.SSEKMSKeyId
+}
+
+// setMultipartUploadOptions is setCopyObjectOptions for the objects copied by parts
+func (uploader *Uploader) setMultipartUploadOptions(input *s3.CreateMultipartUploadInput) {
+	upload := uploader.createUploadInput(*input.Bucket, *input.Key, nil)
+	input.StorageClass = upload.StorageClass
+	input.ServerSideEncryption = upload.ServerSideEncryption
+	input.SSECustomerAlgorithm = upload.SSECustomerAlgorithm
+	input.SSECustomerKey = upload.SSECustomerKey
+	input.SSECustomerKeyMD5 = upload.SSECustomerKeyMD5
+	input.SSEKMSKeyId = upload.SSEKMSKeyId
+}
+
+func (uploader *Uploader) upload(bucket, path string, content io.Reader, requestOptions ...request.Option) error {
 	input := uploader.createUploadInput(bucket, path, content)
-	_, err := uploader.uploaderAPI.Upload(input)
-	return errors.Wrapf(err, "failed to upload '%s' to bucket '%s'", path, bucket)
+	_, err := uploader.uploaderAPI.UploadWithContext(aws.BackgroundContext(), input,
+		s3manager.WithUploaderRequestOptions(requestOptions...))
+	return errors.Wrapf(uploader.explainEncryptionError(err), "failed to upload '%s' to bucket '%s'", path, bucket)
 }
 
 // CreateUploaderAPI returns an uploader with customizable concurrency
@@ -89,7 +166,8 @@ func CreateUploaderAPI(svc s3iface.S3API, partsize, concurrency int) s3managerif
 	return uploaderAPI
 }
 
-// TODO : unit tests
+// configureServerSideEncryption reads the SSE-C key either as is or base64 encoded,
+// the customer key implies AES256 unless S3_SSE is set
 func configureServerSideEncryption(settings map[string]string) (serverSideEncryption string, sseCustomerKey string, sseKmsKeyId string, err error) {
 	serverSideEncryption, _ = settings[SseSetting]
 	sseCustomerKey, _ = settings[SseCSetting]
@@ -99,6 +177,23 @@ func configureServerSideEncryption(settings map[string]string) (serverSideEncryp
 	if (serverSideEncryption == "aws:kms") == (sseKmsKeyId == "") {
 		return "", "", "", NewSseKmsIdNotSetError()
 	}
+	if sseCustomerKey == "" {
+		return
+	}
+	if decoded, decodeErr := base64.StdEncoding.DecodeString(sseCustomerKey); decodeErr == nil &&
+		len(decoded) == sseCustomerKeySize {
+		sseCustomerKey = string(decoded)
+	}
+	if len(sseCustomerKey) != sseCustomerKeySize {
+		return "", "", "", newInvalidSseCustomerKeyError()
+	}
+	if serverSideEncryption == "" {
+		serverSideEncryption = s3.ServerSideEncryptionAes256
+	}
+	if serverSideEncryption != s3.ServerSideEncryptionAes256 {
+		return "", "", "", errors.Errorf("%s supports only %s encryption, but %s is '%s'",
+			SseCSetting, s3.ServerSideEncryptionAes256, SseSetting, serverSideEncryption)
+	}
 	return
 }
 
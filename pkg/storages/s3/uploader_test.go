@@ -0,0 +1,97 @@
+package s3
+
+import (
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+const testCustomerKey = "0123456789abcdef0123456789abcdef"
+
+func TestConfigureServerSideEncryption_customerKey(t *testing.T) {
+	for _, key := range []string{testCustomerKey, base64.StdEncoding.EncodeToString([]byte(testCustomerKey))} {
+		serverSideEncryption, customerKey, _, err := configureServerSideEncryption(map[string]string{SseCSetting: key})
+		assert.NoError(t, err)
+		assert.Equal(t, s3.ServerSideEncryptionAes256, serverSideEncryption)
+		assert.Equal(t, testCustomerKey, customerKey)
+	}
+
+	_, _, _, err := configureServerSideEncryption(map[string]string{SseCSetting: "short"})
+	assert.IsType(t, InvalidSseCustomerKeyError{}, err)
+	_, _, _, err = configureServerSideEncryption(map[string]string{SseCSetting: testCustomerKey,
+		SseSetting: "aws:kms", SseKmsIdSetting: "key"})
+	assert.Error(t, err)
+}
+
+// headersRecordingS3API records the SSE-C headers of the reads
+type headersRecordingS3API struct {
+	s3iface.S3API
+	getObjectKey  *string
+	headObjectKey *string
+}
+
+func (api *headersRecordingS3API) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	api.getObjectKey = input.SSECustomerKey
+	return nil, awserr.New("InvalidRequest", "The object was stored using a form of Server Side Encryption", nil)
+}
+
+func (api *headersRecordingS3API) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	api.headObjectKey = input.SSECustomerKey
+	return &s3.HeadObjectOutput{}, nil
+}
+
+func TestFolder_readsWithCustomerKey(t *testing.T) {
+	api := &headersRecordingS3API{}
+	uploader := NewUploader(nil, s3.ServerSideEncryptionAes256, testCustomerKey, "", "STANDARD")
+	folder := NewFolder(*uploader, api, map[string]string{}, "bucket", "path", false)
+
+	exists, err := folder.Exists("object")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, testCustomerKey, aws.StringValue(api.headObjectKey))
+	_, err = folder.ReadObject("object")
+	assert.Error(t, err)
+	assert.Equal(t, testCustomerKey, aws.StringValue(api.getObjectKey))
+}
+
+func TestFolder_encryptionErrorNamesSettings(t *testing.T) {
+	folder := NewFolder(*NewUploader(nil, "", "", "", "STANDARD"), &headersRecordingS3API{},
+		map[string]string{}, "bucket", "path", false)
+	_, err := folder.ReadObject("object")
+	assert.Contains(t, err.Error(), SseCSetting)
+}
+
+// TestS3FolderCustomerKey runs against the S3 storage supporting SSE-C, e.g. MinIO with TLS, set by S3_TEST_PREFIX
+// and the usual AWS_* variables
+func TestS3FolderCustomerKey(t *testing.T) {
+	prefix := os.Getenv("S3_TEST_PREFIX")
+	if prefix == "" {
+		t.Skip("S3_TEST_PREFIX needed to run the SSE-C round-trip test")
+	}
+	settings := map[string]string{SseCSetting: base64.StdEncoding.EncodeToString([]byte(testCustomerKey)),
+		UploadConcurrencySetting: "1", ForcePathStyleSetting: "true"}
+	for _, name := range []string{EndpointSetting, RegionSetting, AccessKeyIdSetting, SecretAccessKeySetting} {
+		if value, ok := os.LookupEnv(name); ok {
+			settings[name] = value
+		}
+	}
+	folder, err := ConfigureFolder(prefix, settings)
+	require.NoError(t, err)
+
+	require.NoError(t, folder.PutObject("sse_c", strings.NewReader("encrypted")))
+	exists, err := folder.Exists("sse_c")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	require.NoError(t, folder.CopyObject("sse_c", "sse_c_copy"))
+	storage.RunFolderTest(folder, t)
+	assert.NoError(t, folder.DeleteObjects([]string{"sse_c", "sse_c_copy"}))
+}
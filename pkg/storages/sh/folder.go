@@ -6,13 +6,20 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
 
+	"github.com/google/uuid"
 	"github.com/pkg/sftp"
 	"github.com/wal-g/tracelog"
 	"github.com/wal-g/wal-g/pkg/storages/storage"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 type Folder struct {
@@ -25,7 +32,15 @@ const (
 	Password          = "SSH_PASSWORD"
 	Username          = "SSH_USERNAME"
 	PrivateKeyPath    = "SSH_PRIVATE_KEY_PATH"
+	KnownHostsPath    = "SSH_KNOWN_HOSTS_PATH"
+	Connections       = "SSH_CONNECTIONS"
 	defaultBufferSize = 64 * 1024 * 1024
+	defaultPort       = "22"
+	// defaultConnections is enough for the concurrent reads of ExtractAll not to wait for each other,
+	// the connections are dialed only when they are used
+	defaultConnections = 4
+	// uploadingFileMarker is the part of the name of the file being uploaded, it is renamed when completed
+	uploadingFileMarker = ".walg-uploading-"
 )
 
 var SettingsList = []string{
@@ -33,26 +48,49 @@ var SettingsList = []string{
 	Password,
 	Username,
 	PrivateKeyPath,
+	KnownHostsPath,
+	Connections,
 }
 
 func NewFolderError(err error, format string, args ...interface{}) storage.Error {
 	return storage.NewError(err, "SSH", format, args...)
 }
 
+// ConfigureFolder connects to the prefix like ssh://host/path or sftp://user@host:port/path,
+// the user and the port of the prefix take precedence over the settings
 func ConfigureFolder(prefix string, settings map[string]string) (storage.Folder, error) {
-	host, path, err := storage.ParsePrefixAsURL(prefix)
-
+	_, path, err := storage.ParsePrefixAsURL(prefix)
+	if err != nil {
+		return nil, err
+	}
+	prefixURL, err := url.Parse(prefix)
 	if err != nil {
 		return nil, err
 	}
 
 	user := settings[Username]
+	if prefixURL.User != nil {
+		user = prefixURL.User.Username()
+	}
 	pass := settings[Password]
-	port := settings[Port]
+	port := prefixURL.Port()
+	if port == "" {
+		port = settings[Port]
+	}
+	if port == "" {
+		port = defaultPort
+	}
 	pkeyPath := settings[PrivateKeyPath]
 
-	if port == "" {
-		port = "22"
+	connections := defaultConnections
+	if connectionsStr, ok := settings[Connections]; ok {
+		connections, err = strconv.Atoi(connectionsStr)
+		if err != nil {
+			return nil, NewFolderError(err, "Fail to parse %s", Connections)
+		}
+		if connections < 1 {
+			return nil, fmt.Errorf("%s must be positive, got %d", Connections, connections)
+		}
 	}
 
 	authMethods := []ssh.AuthMethod{}
@@ -74,28 +112,55 @@ func ConfigureFolder(prefix string, settings map[string]string) (storage.Folder,
 		authMethods = append(authMethods, ssh.Password(pass))
 	}
 
+	hostKeyCallback, err := configureHostKeyCallback(settings[KnownHostsPath])
+	if err != nil {
+		return nil, err
+	}
 	config := &ssh.ClientConfig{
 		User:            user,
 		Auth:            authMethods,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		HostKeyCallback: hostKeyCallback,
 	}
 
-	address := fmt.Sprint(host, ":", port)
-	sshClient, err := ssh.Dial("tcp", address, config)
-	if err != nil {
-		return nil, NewFolderError(err, "Fail connect via ssh. Address: %s", address)
+	address := net.JoinHostPort(prefixURL.Hostname(), port)
+	pool := newClientPool(connections, func() (*ssh.Client, error) {
+		sshClient, err := ssh.Dial("tcp", address, config)
+		if err != nil {
+			return nil, NewFolderError(err, "Fail connect via ssh. Address: %s", address)
+		}
+		return sshClient, nil
+	})
+	// the first connection is dialed right away to report the misconfiguration early
+	if _, err := pool.connections[0].get(); err != nil {
+		return nil, err
 	}
 
-	sftpClient, err := sftp.NewClient(sshClient)
+	return &Folder{pool, storage.AddDelimiterToPath(path)}, nil
+}
+
+// configureHostKeyCallback verifies the host key by the known_hosts file, ~/.ssh/known_hosts by default.
+// Without the file the host key isn't verified, like before the setting was introduced.
+func configureHostKeyCallback(knownHostsPath string) (ssh.HostKeyCallback, error) {
+	if knownHostsPath == "" {
+		homeDir, err := os.UserHomeDir()
+		if err == nil {
+			knownHostsPath = filepath.Join(homeDir, ".ssh", "known_hosts")
+		}
+		if _, err := os.Stat(knownHostsPath); err != nil {
+			tracelog.WarningLogger.Printf("%s is not set and %s is not found, the host key isn't verified",
+				KnownHostsPath, knownHostsPath)
+			return ssh.InsecureIgnoreHostKey(), nil
+		}
+	}
+	callback, err := knownhosts.New(knownHostsPath)
 	if err != nil {
-		return nil, NewFolderError(err, "Fail connect via sftp. Address: %s", address)
+		return nil, NewFolderError(err, "Unable to read known hosts file '%s'", knownHostsPath)
 	}
+	return callback, nil
+}
 
-	path = storage.AddDelimiterToPath(path)
-
-	return &Folder{
-		extend(sftpClient), path,
-	}, nil
+func NewFolder(sftpClient *sftp.Client, path string) *Folder {
+	return &Folder{extend(sftpClient), storage.AddDelimiterToPath(path)}
 }
 
 // TODO close ssh and sftp connection
@@ -129,6 +194,29 @@ func (folder *Folder) ListFolder() (objects []storage.Object, subFolders []stora
 	}
 
 	for _, fileInfo := range filesInfo {
+		if strings.Contains(fileInfo.Name(), uploadingFileMarker) {
+			// the upload in progress is not the object yet
+			continue
+		}
+		if fileInfo.Mode()&os.ModeSymlink != 0 {
+			// ReadDir doesn't follow symlinks, e.g. pgbackrest links the latest backup and the tablespaces
+			linkPath := client.Join(path, fileInfo.Name())
+			fileInfo, err = folder.followSymlink(linkPath, fileInfo)
+			if err != nil {
+				return nil, nil, err
+			}
+			if fileInfo.IsDir() {
+				cycle, err := folder.linksToAncestor(linkPath)
+				if err != nil {
+					return nil, nil, err
+				}
+				if cycle {
+					// the recursive listing would descend into it endlessly
+					tracelog.WarningLogger.Printf("Skipped symlink '%s' to the parent folder", linkPath)
+					continue
+				}
+			}
+		}
 		if fileInfo.IsDir() {
 			folder := &Folder{
 				folder.client,
@@ -150,6 +238,74 @@ func (folder *Folder) ListFolder() (objects []storage.Object, subFolders []stora
 	return
 }
 
+// followSymlink returns the info of the symlink target, the dangling symlink is returned as is
+func (folder *Folder) followSymlink(path string, linkInfo os.FileInfo) (os.FileInfo, error) {
+	targetInfo, err := folder.client.Stat(path)
+	if os.IsNotExist(err) {
+		tracelog.WarningLogger.Printf("Symlink '%s' target does not exist", path)
+		return linkInfo, nil
+	}
+	if err != nil {
+		return nil, NewFolderError(err, "Fail to follow symlink '%s'", path)
+	}
+	return renamedFileInfo{targetInfo, linkInfo.Name()}, nil
+}
+
+// maxSymlinkHops bounds the chain of symlinks resolved by linksToAncestor
+const maxSymlinkHops = 40
+
+// linksToAncestor reports whether the symlink resolves to the folder itself or to one of its parents
+func (folder *Folder) linksToAncestor(linkPath string) (bool, error) {
+	folderPath, err := folder.absolutePath(folder.path)
+	if err != nil {
+		return false, err
+	}
+	target, err := folder.absolutePath(linkPath)
+	if err != nil {
+		return false, err
+	}
+	for hop := 0; hop < maxSymlinkHops; hop++ {
+		info, err := folder.client.Lstat(target)
+		if err != nil {
+			return false, NewFolderError(err, "Fail to follow symlink '%s'", linkPath)
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			break
+		}
+		next, err := folder.client.ReadLink(target)
+		if err != nil {
+			return false, NewFolderError(err, "Fail to follow symlink '%s'", linkPath)
+		}
+		if !path.IsAbs(next) {
+			next = path.Join(path.Dir(target), next)
+		}
+		target = path.Clean(next)
+	}
+	return target == folderPath || target == "/" || strings.HasPrefix(folderPath, target+"/"), nil
+}
+
+// absolutePath resolves the path relative to the working directory of the SFTP session
+func (folder *Folder) absolutePath(relativePath string) (string, error) {
+	if path.IsAbs(relativePath) {
+		return path.Clean(relativePath), nil
+	}
+	workingDirectory, err := folder.client.Getwd()
+	if err != nil {
+		return "", NewFolderError(err, "Fail to get the working directory")
+	}
+	return path.Join(workingDirectory, relativePath), nil
+}
+
+// renamedFileInfo is the info of the symlink target named as the symlink
+type renamedFileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (info renamedFileInfo) Name() string {
+	return info.name
+}
+
 func (folder *Folder) DeleteObjects(objectRelativePaths []string) error {
 	client := folder.client
 
@@ -203,9 +359,12 @@ func (folder *Folder) ReadObject(objectRelativePath string) (io.ReadCloser, erro
 	path := folder.client.Join(folder.path, objectRelativePath)
 	file, err := folder.client.OpenFile(path)
 
-	if err != nil {
+	if os.IsNotExist(err) {
 		return nil, storage.NewObjectNotFoundError(path)
 	}
+	if err != nil {
+		return nil, NewFolderError(err, "Fail to open object '%s'", path)
+	}
 
 	return struct {
 		io.Reader
@@ -226,11 +385,13 @@ func (folder *Folder) PutObject(name string, content io.Reader) error {
 		)
 	}
 
-	file, err := client.CreateFile(absolutePath)
+	// the content is written to the temporary file first, so the readers never see the partial object
+	uploadingPath := absolutePath + uploadingFileMarker + uuid.New().String()
+	file, err := client.CreateFile(uploadingPath)
 	if err != nil {
 		return NewFolderError(
 			err, "Fail to create file '%s'",
-			absolutePath,
+			uploadingPath,
 		)
 	}
 
@@ -240,16 +401,27 @@ func (folder *Folder) PutObject(name string, content io.Reader) error {
 		if closerErr != nil {
 			tracelog.InfoLogger.Println("Error during closing failed upload ", closerErr)
 		}
+		removeErr := client.Remove(uploadingPath)
+		if removeErr != nil {
+			tracelog.InfoLogger.Println("Error during removing failed upload ", removeErr)
+		}
 		return NewFolderError(
 			err, "Fail write content to file '%s'",
-			absolutePath,
+			uploadingPath,
 		)
 	}
 	err = file.Close()
 	if err != nil {
 		return NewFolderError(
 			err, "Fail write close file '%s'",
-			absolutePath,
+			uploadingPath,
+		)
+	}
+	err = client.Rename(uploadingPath, absolutePath)
+	if err != nil {
+		return NewFolderError(
+			err, "Fail to rename file '%s' to '%s'",
+			uploadingPath, absolutePath,
 		)
 	}
 	return nil
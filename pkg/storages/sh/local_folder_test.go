@@ -0,0 +1,101 @@
+package sh_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/testtools"
+)
+
+func TestLocalSftpFolder(t *testing.T) {
+	storage.RunFolderTest(testtools.NewLocalSftpFolder(t, t.TempDir()), t)
+}
+
+func TestListFolder_followsSymlinks(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "20220101-000000F"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "20220101-000000F", "backup.manifest"), []byte("x"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "backup.info"), []byte("info"), 0644))
+	assert.NoError(t, os.Symlink("20220101-000000F", filepath.Join(root, "latest")))
+	assert.NoError(t, os.Symlink("backup.info", filepath.Join(root, "backup.info.link")))
+	assert.NoError(t, os.Symlink("missing", filepath.Join(root, "dangling")))
+
+	objects, subFolders, err := testtools.NewLocalSftpFolder(t, root).ListFolder()
+	assert.NoError(t, err)
+
+	var objectNames, folderPaths []string
+	for _, object := range objects {
+		objectNames = append(objectNames, object.GetName())
+	}
+	for _, subFolder := range subFolders {
+		folderPaths = append(folderPaths, strings.TrimPrefix(subFolder.GetPath(), root))
+	}
+	sort.Strings(objectNames)
+	sort.Strings(folderPaths)
+	assert.Equal(t, []string{"backup.info", "backup.info.link", "dangling"}, objectNames)
+	assert.Equal(t, []string{"/20220101-000000F", "/latest"}, folderPaths)
+
+	for _, object := range objects {
+		if object.GetName() == "backup.info.link" {
+			assert.Equal(t, int64(len("info")), object.GetSize())
+		}
+	}
+}
+
+func TestListFolder_skipsSymlinksToParents(t *testing.T) {
+	root := t.TempDir()
+	backupPath := filepath.Join(root, "20220101-000000F")
+	assert.NoError(t, os.MkdirAll(backupPath, 0755))
+	assert.NoError(t, os.Symlink("..", filepath.Join(backupPath, "parent")))
+	assert.NoError(t, os.Symlink(".", filepath.Join(backupPath, "self")))
+	assert.NoError(t, os.Symlink("parent", filepath.Join(backupPath, "chained")))
+	assert.NoError(t, os.Symlink(root, filepath.Join(backupPath, "root")))
+
+	folder := testtools.NewLocalSftpFolder(t, root).GetSubFolder("20220101-000000F")
+	objects, subFolders, err := folder.ListFolder()
+	assert.NoError(t, err)
+	assert.Empty(t, objects)
+	assert.Empty(t, subFolders)
+
+	// the recursive listing of the folder with the cycle ends
+	objects, err = storage.ListFolderRecursively(testtools.NewLocalSftpFolder(t, root))
+	assert.NoError(t, err)
+	assert.Empty(t, objects)
+}
+
+func TestReadObject_notFound(t *testing.T) {
+	_, err := testtools.NewLocalSftpFolder(t, t.TempDir()).ReadObject("missing")
+	assert.IsType(t, storage.ObjectNotFoundError{}, err)
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+func TestPutObject_failedUploadLeavesNothing(t *testing.T) {
+	root := t.TempDir()
+	folder := testtools.NewLocalSftpFolder(t, root)
+	require.NoError(t, folder.PutObject("object", strings.NewReader("old")))
+
+	assert.Error(t, folder.PutObject("object", failingReader{}))
+
+	files, err := ioutil.ReadDir(root)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	reader, err := folder.ReadObject("object")
+	require.NoError(t, err)
+	content, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.NoError(t, reader.Close())
+	assert.Equal(t, "old", string(content))
+}
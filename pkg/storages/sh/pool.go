@@ -0,0 +1,202 @@
+package sh
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/sftp"
+	"github.com/wal-g/tracelog"
+	"golang.org/x/crypto/ssh"
+)
+
+// connection is the SFTP session over its own SSH connection, it is dialed on the first use
+// and again after the server drops it
+type connection struct {
+	dial      func() (*ssh.Client, error)
+	mutex     sync.Mutex
+	sshClient *ssh.Client
+	client    *extendedSftpClient
+}
+
+func (connection *connection) get() (*extendedSftpClient, error) {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+	if connection.client != nil {
+		return connection.client, nil
+	}
+
+	sshClient, err := connection.dial()
+	if err != nil {
+		return nil, err
+	}
+	sftpClient, err := sftp.NewClient(sshClient)
+	if err != nil {
+		_ = sshClient.Close()
+		return nil, NewFolderError(err, "Fail connect via sftp. Address: %s", sshClient.RemoteAddr())
+	}
+	connection.sshClient = sshClient
+	connection.client = extend(sftpClient)
+	return connection.client, nil
+}
+
+// drop closes the lost connection, unless the concurrent request has already dialed it again
+func (connection *connection) drop(client *extendedSftpClient) {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+	if connection.client != client {
+		return
+	}
+	// the SSH connection is closed first, so closing the SFTP session doesn't wait for the dead server
+	_ = connection.sshClient.Close()
+	_ = connection.client.Close()
+	connection.sshClient = nil
+	connection.client = nil
+}
+
+// isConnectionLost tells the transport errors apart from the ones the server replied with
+func isConnectionLost(err error) bool {
+	if err == nil || os.IsNotExist(err) || os.IsExist(err) || os.IsPermission(err) {
+		return false
+	}
+	var statusErr *sftp.StatusError
+	return !errors.As(err, &statusErr)
+}
+
+// clientPool spreads the requests over several connections, so the concurrent reads of ExtractAll
+// aren't limited by a single SSH channel. The request failed by the lost connection is retried once
+// over the connection dialed again, unless it isn't safe to repeat, see doOnce.
+type clientPool struct {
+	connections []*connection
+	next        uint32
+}
+
+func newClientPool(size int, dial func() (*ssh.Client, error)) *clientPool {
+	pool := &clientPool{}
+	for i := 0; i < size; i++ {
+		pool.connections = append(pool.connections, &connection{dial: dial})
+	}
+	return pool
+}
+
+func (pool *clientPool) nextConnection() *connection {
+	next := atomic.AddUint32(&pool.next, 1)
+	return pool.connections[next%uint32(len(pool.connections))]
+}
+
+func (pool *clientPool) do(operation func(client *extendedSftpClient) error) error {
+	connection := pool.nextConnection()
+	client, err := connection.get()
+	if err != nil {
+		return err
+	}
+	err = operation(client)
+	if !isConnectionLost(err) {
+		return err
+	}
+
+	tracelog.WarningLogger.Printf("SFTP connection is lost, reconnecting: %v", err)
+	connection.drop(client)
+	client, err = connection.get()
+	if err != nil {
+		return err
+	}
+	return operation(client)
+}
+
+// doOnce runs the operation which isn't safe to repeat blindly, e.g. the rename which the server may have
+// applied before the connection was lost. The lost connection is dropped, so the next request dials it again.
+func (pool *clientPool) doOnce(operation func(client *extendedSftpClient) error) error {
+	connection := pool.nextConnection()
+	client, err := connection.get()
+	if err != nil {
+		return err
+	}
+	err = operation(client)
+	if isConnectionLost(err) {
+		tracelog.WarningLogger.Printf("SFTP connection is lost: %v", err)
+		connection.drop(client)
+	}
+	return err
+}
+
+func (pool *clientPool) ReadDir(path string) (filesInfo []os.FileInfo, err error) {
+	err = pool.do(func(client *extendedSftpClient) error {
+		filesInfo, err = client.ReadDir(path)
+		return err
+	})
+	return filesInfo, err
+}
+
+func (pool *clientPool) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+func (pool *clientPool) Remove(path string) error {
+	return pool.do(func(client *extendedSftpClient) error {
+		return client.Remove(path)
+	})
+}
+
+func (pool *clientPool) Stat(p string) (fileInfo os.FileInfo, err error) {
+	err = pool.do(func(client *extendedSftpClient) error {
+		fileInfo, err = client.Stat(p)
+		return err
+	})
+	return fileInfo, err
+}
+
+func (pool *clientPool) Lstat(p string) (fileInfo os.FileInfo, err error) {
+	err = pool.do(func(client *extendedSftpClient) error {
+		fileInfo, err = client.Lstat(p)
+		return err
+	})
+	return fileInfo, err
+}
+
+func (pool *clientPool) ReadLink(p string) (target string, err error) {
+	err = pool.do(func(client *extendedSftpClient) error {
+		target, err = client.ReadLink(p)
+		return err
+	})
+	return target, err
+}
+
+func (pool *clientPool) Getwd() (workingDirectory string, err error) {
+	err = pool.do(func(client *extendedSftpClient) error {
+		workingDirectory, err = client.Getwd()
+		return err
+	})
+	return workingDirectory, err
+}
+
+func (pool *clientPool) OpenFile(path string) (file io.ReadCloser, err error) {
+	err = pool.do(func(client *extendedSftpClient) error {
+		file, err = client.OpenFile(path)
+		return err
+	})
+	return file, err
+}
+
+func (pool *clientPool) CreateFile(path string) (file *sftp.File, err error) {
+	err = pool.doOnce(func(client *extendedSftpClient) error {
+		file, err = client.CreateFile(path)
+		return err
+	})
+	return file, err
+}
+
+func (pool *clientPool) Mkdir(path string) error {
+	return pool.do(func(client *extendedSftpClient) error {
+		return client.Mkdir(path)
+	})
+}
+
+func (pool *clientPool) Rename(oldPath string, newPath string) error {
+	return pool.doOnce(func(client *extendedSftpClient) error {
+		return client.Rename(oldPath, newPath)
+	})
+}
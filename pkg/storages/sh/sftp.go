@@ -1,26 +1,32 @@
 package sh
 
 import (
+	"errors"
 	"io"
 	"os"
+	"sync/atomic"
 
 	"github.com/pkg/sftp"
 )
 
 type SftpClient interface {
-	Lock()
-	Unlock()
 	ReadDir(path string) ([]os.FileInfo, error)
 	Join(elem ...string) string
 	Remove(path string) error
 	Stat(p string) (os.FileInfo, error)
+	Lstat(p string) (os.FileInfo, error)
+	ReadLink(p string) (string, error)
+	Getwd() (string, error)
 	OpenFile(path string) (io.ReadCloser, error)
 	CreateFile(path string) (*sftp.File, error)
 	Mkdir(path string) error
+	Rename(oldPath string, newPath string) error
 }
 
 type extendedSftpClient struct {
 	*sftp.Client
+	// noPosixRename is set once the server replies it doesn't support posix-rename@openssh.com
+	noPosixRename int32
 }
 
 func (client *extendedSftpClient) OpenFile(path string) (io.ReadCloser, error) {
@@ -35,6 +41,29 @@ func (client *extendedSftpClient) Mkdir(path string) error {
 	return client.MkdirAll(path)
 }
 
+// Rename replaces newPath by the posix-rename@openssh.com extension. Only the servers which don't support
+// the extension fall back to the plain rename, which refuses to rename to the existing file,
+// so it is removed first. The other failures of the posix rename are returned as they are.
+func (client *extendedSftpClient) Rename(oldPath string, newPath string) error {
+	if atomic.LoadInt32(&client.noPosixRename) == 0 {
+		err := client.PosixRename(oldPath, newPath)
+		if !isUnsupported(err) {
+			return err
+		}
+		atomic.StoreInt32(&client.noPosixRename, 1)
+	}
+	if err := client.Remove(newPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return client.Client.Rename(oldPath, newPath)
+}
+
+// isUnsupported tells the reply of the server which doesn't implement the request, e.g. the extension
+func isUnsupported(err error) bool {
+	var statusErr *sftp.StatusError
+	return errors.As(err, &statusErr) && statusErr.FxCode() == sftp.ErrSSHFxOpUnsupported
+}
+
 func extend(client *sftp.Client) *extendedSftpClient {
-	return &extendedSftpClient{client}
+	return &extendedSftpClient{Client: client}
 }
@@ -0,0 +1,194 @@
+package sh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	testUser     = "walg"
+	testPassword = "secret"
+)
+
+// sshServer is the SSH server serving the SFTP subsystem of the local file system
+type sshServer struct {
+	listener    net.Listener
+	config      *ssh.ServerConfig
+	hostKey     ssh.PublicKey
+	mutex       sync.Mutex
+	connections []net.Conn
+}
+
+func startSSHServer(t *testing.T) *sshServer {
+	// the known_hosts of the user running the tests isn't used
+	t.Setenv("HOME", t.TempDir())
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(hostKey)
+	require.NoError(t, err)
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(metadata ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if metadata.User() == testUser && string(password) == testPassword {
+				return nil, nil
+			}
+			return nil, errors.New("wrong password")
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &sshServer{listener: listener, config: config, hostKey: signer.PublicKey()}
+	t.Cleanup(func() {
+		_ = listener.Close()
+		server.dropConnections()
+	})
+	go server.serve()
+	return server
+}
+
+func (server *sshServer) serve() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		server.mutex.Lock()
+		server.connections = append(server.connections, conn)
+		server.mutex.Unlock()
+		go server.handle(conn)
+	}
+}
+
+func (server *sshServer) handle(conn net.Conn) {
+	_, channels, requests, err := ssh.NewServerConn(conn, server.config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for request := range channelRequests {
+				isSftp := request.Type == "subsystem" && string(request.Payload[4:]) == "sftp"
+				_ = request.Reply(isSftp, nil)
+				if isSftp {
+					sftpServer, err := sftp.NewServer(channel)
+					if err == nil {
+						_ = sftpServer.Serve()
+					}
+					_ = channel.Close()
+				}
+			}
+		}()
+	}
+}
+
+// dropConnections breaks the connections of the clients like the network failure does
+func (server *sshServer) dropConnections() {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	for _, conn := range server.connections {
+		_ = conn.Close()
+	}
+	server.connections = nil
+}
+
+func (server *sshServer) prefix(path string) string {
+	return "sftp://" + testUser + "@" + server.listener.Addr().String() + path
+}
+
+func TestConfigureFolder_sftpPrefix(t *testing.T) {
+	server := startSSHServer(t)
+	folder, err := ConfigureFolder(server.prefix(t.TempDir()), map[string]string{
+		Password:    testPassword,
+		Connections: "2",
+	})
+	require.NoError(t, err)
+
+	storage.RunFolderTest(folder, t)
+}
+
+func TestConfigureFolder_knownHosts(t *testing.T) {
+	server := startSSHServer(t)
+	knownHostsFile := filepath.Join(t.TempDir(), "known_hosts")
+	writeKnownHosts := func(hostKey ssh.PublicKey) {
+		line := knownhosts.Line([]string{knownhosts.Normalize(server.listener.Addr().String())}, hostKey)
+		require.NoError(t, ioutil.WriteFile(knownHostsFile, []byte(line+"\n"), 0600))
+	}
+	settings := map[string]string{Password: testPassword, KnownHostsPath: knownHostsFile}
+
+	writeKnownHosts(server.hostKey)
+	_, err := ConfigureFolder(server.prefix(t.TempDir()), settings)
+	assert.NoError(t, err)
+
+	otherKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	otherPublicKey, err := ssh.NewPublicKey(otherKey)
+	require.NoError(t, err)
+	writeKnownHosts(otherPublicKey)
+	_, err = ConfigureFolder(server.prefix(t.TempDir()), settings)
+	assert.Error(t, err)
+
+	settings[KnownHostsPath] = filepath.Join(t.TempDir(), "missing")
+	_, err = ConfigureFolder(server.prefix(t.TempDir()), settings)
+	assert.Error(t, err)
+}
+
+func TestIsUnsupported(t *testing.T) {
+	assert.True(t, isUnsupported(&sftp.StatusError{Code: uint32(sftp.ErrSSHFxOpUnsupported)}))
+	assert.False(t, isUnsupported(&sftp.StatusError{Code: uint32(sftp.ErrSSHFxFailure)}))
+	assert.False(t, isUnsupported(errors.New("connection lost")))
+	assert.False(t, isUnsupported(nil))
+}
+
+func TestConfigureFolder_wrongPassword(t *testing.T) {
+	server := startSSHServer(t)
+	_, err := ConfigureFolder(server.prefix(t.TempDir()), map[string]string{Password: "wrong"})
+	assert.Error(t, err)
+}
+
+func TestConfigureFolder_invalidConnections(t *testing.T) {
+	server := startSSHServer(t)
+	_, err := ConfigureFolder(server.prefix(t.TempDir()), map[string]string{
+		Password:    testPassword,
+		Connections: "0",
+	})
+	assert.Error(t, err)
+}
+
+func TestFolder_reconnects(t *testing.T) {
+	server := startSSHServer(t)
+	folder, err := ConfigureFolder(server.prefix(t.TempDir()), map[string]string{
+		Password:    testPassword,
+		Connections: "1",
+	})
+	require.NoError(t, err)
+	require.NoError(t, folder.PutObject("a/b", strings.NewReader("content")))
+
+	server.dropConnections()
+
+	reader, err := folder.ReadObject("a/b")
+	require.NoError(t, err)
+	content, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.NoError(t, reader.Close())
+	assert.Equal(t, "content", string(content))
+}
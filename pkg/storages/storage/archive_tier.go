@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"github.com/pkg/errors"
+)
+
+// RehydratePriority trades the cost of the rehydration for its speed, the storages map it to their own
+// priorities: S3 restores the Bulk, Standard or Expedited jobs, Azure rehydrates with the Standard or High priority
+type RehydratePriority string
+
+const (
+	RehydratePriorityBulk     RehydratePriority = "bulk"
+	RehydratePriorityStandard RehydratePriority = "standard"
+	RehydratePriorityHigh     RehydratePriority = "high"
+)
+
+// ParseRehydratePriority accepts the priorities case sensitively, like the other enum settings
+func ParseRehydratePriority(priority string) (RehydratePriority, error) {
+	switch RehydratePriority(priority) {
+	case RehydratePriorityBulk, RehydratePriorityStandard, RehydratePriorityHigh:
+		return RehydratePriority(priority), nil
+	}
+	return "", errors.Errorf("unknown rehydrate priority '%s', expected one of: %s, %s, %s", priority,
+		RehydratePriorityBulk, RehydratePriorityStandard, RehydratePriorityHigh)
+}
+
+type RehydrateOptions struct {
+	// Days the rehydrated copy is kept for before the object is readable no more,
+	// the storages which move the object out of the archive tier ignore it
+	Days     int
+	Priority RehydratePriority
+}
+
+// ObjectTier is the tier of the stored object, the objects of the online tiers are always readable
+type ObjectTier struct {
+	// StorageClass is the storage class or the access tier as the storage names it
+	StorageClass string
+	Archived     bool
+	// Rehydrating is set while the rehydration of the archived object is in progress
+	Rehydrating bool
+	// Rehydrated is set when the archived object has the readable copy
+	Rehydrated bool
+}
+
+func (tier ObjectTier) IsReadable() bool {
+	return !tier.Archived || tier.Rehydrated
+}
+
+// ArchiveTierFolder is implemented by the folders of the storages with the archive tiers
+type ArchiveTierFolder interface {
+	Folder
+	// GetObjectTier returns ObjectNotFoundError in case there is no such object
+	GetObjectTier(objectRelativePath string) (ObjectTier, error)
+	// Rehydrate requests the archived object to be made readable, the object
+	// which is already being rehydrated is left as is
+	Rehydrate(objectRelativePath string, options RehydrateOptions) error
+}
+
+// HasArchiveTier tells whether the objects of the folder may be archived, the wrapping folders
+// have the archive tier if the folder they wrap has it, and the MultiFolder if its primary folder has it
+func HasArchiveTier(folder Folder) bool {
+	switch wrapper := folder.(type) {
+	case *RetryingFolder:
+		return HasArchiveTier(wrapper.Folder)
+	case *ThrottlingFolder:
+		return HasArchiveTier(wrapper.Folder)
+	case *MultiFolder:
+		return HasArchiveTier(wrapper.Folder)
+	}
+	_, ok := folder.(ArchiveTierFolder)
+	return ok
+}
+
+// GetObjectTier returns the tier of the object, the objects of the storages without the archive tiers
+// are always readable
+func GetObjectTier(folder Folder, objectRelativePath string) (ObjectTier, error) {
+	if !HasArchiveTier(folder) {
+		return ObjectTier{}, nil
+	}
+	return folder.(ArchiveTierFolder).GetObjectTier(objectRelativePath)
+}
+
+// RehydrateObject requests the rehydration of the archived object, it fails for the storages without
+// the archive tiers
+func RehydrateObject(folder Folder, objectRelativePath string, options RehydrateOptions) error {
+	if !HasArchiveTier(folder) {
+		return errors.Errorf("the storage of '%s' has no archive tier", folder.GetPath())
+	}
+	return folder.(ArchiveTierFolder).Rehydrate(objectRelativePath, options)
+}
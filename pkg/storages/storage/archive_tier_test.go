@@ -0,0 +1,69 @@
+package storage_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"github.com/wal-g/wal-g/testtools"
+)
+
+func newArchiveTierFolder(t *testing.T) *testtools.MockArchiveTierFolder {
+	folder := testtools.NewMockArchiveTierFolder(memory.NewFolder("archive/", memory.NewStorage()))
+	require.NoError(t, folder.PutObject("cold", strings.NewReader("cold")))
+	require.NoError(t, folder.PutObject("hot", strings.NewReader("hot")))
+	folder.Archive("cold")
+	return folder
+}
+
+func TestHasArchiveTier(t *testing.T) {
+	plain := memory.NewFolder("plain/", memory.NewStorage())
+	archive := newArchiveTierFolder(t)
+
+	assert.False(t, storage.HasArchiveTier(plain))
+	assert.True(t, storage.HasArchiveTier(archive))
+	assert.True(t, storage.HasArchiveTier(storage.NewRetryingFolder(archive, storage.RetryOptions{MaxAttempts: 2})))
+	assert.True(t, storage.HasArchiveTier(storage.NewThrottlingFolder(archive, nil)))
+	assert.True(t, storage.HasArchiveTier(storage.NewMultiFolder(archive, []storage.Folder{plain}, nil)))
+	assert.False(t, storage.HasArchiveTier(storage.NewMultiFolder(plain, []storage.Folder{archive}, nil)))
+
+	tier, err := storage.GetObjectTier(plain, "missing")
+	assert.NoError(t, err)
+	assert.True(t, tier.IsReadable())
+	assert.Error(t, storage.RehydrateObject(plain, "missing", storage.RehydrateOptions{}))
+}
+
+func TestRetryingFolder_archivedNotRetried(t *testing.T) {
+	archive := newArchiveTierFolder(t)
+	checked := 0
+	folder := storage.NewRetryingFolder(archive, storage.RetryOptions{MaxAttempts: 5, IsRetryable: func(error) bool {
+		checked++
+		return true
+	}})
+
+	_, err := folder.ReadObject("cold")
+	var archivedError storage.ObjectArchivedError
+	assert.True(t, errors.As(err, &archivedError))
+	assert.Zero(t, checked)
+
+	tier, err := storage.GetObjectTier(folder, "cold")
+	require.NoError(t, err)
+	assert.False(t, tier.IsReadable())
+	require.NoError(t, storage.RehydrateObject(folder, "cold", storage.RehydrateOptions{Days: 3}))
+	archive.FinishRehydration()
+	assert.Equal(t, "cold", readObject(t, folder, "cold"))
+}
+
+func TestMultiFolder_archivedFailsOver(t *testing.T) {
+	archive := newArchiveTierFolder(t)
+	replica := memory.NewFolder("replica/", memory.NewStorage())
+	require.NoError(t, replica.PutObject("cold", strings.NewReader("replica")))
+	folder := storage.NewMultiFolder(archive, []storage.Folder{replica}, nil)
+
+	assert.Equal(t, "replica", readObject(t, folder, "cold"))
+	assert.Equal(t, "hot", readObject(t, folder, "hot"))
+}
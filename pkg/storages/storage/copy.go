@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"github.com/pkg/errors"
+)
+
+// ServerSideCopyFolder is implemented by the folders which copy the objects to the other folders
+// of the same storage without downloading them, e.g. to another S3 bucket
+type ServerSideCopyFolder interface {
+	Folder
+	// CopyObjectTo returns false without copying anything if the destination isn't the folder of the same storage.
+	// Like ReadObject, it returns ObjectNotFoundError in case there is no such object.
+	CopyObjectTo(srcPath string, destination Folder, dstPath string) (bool, error)
+}
+
+// CopyObjectBetween copies the object on the server if both folders are of the storage which supports it,
+// otherwise the object is streamed through this host. The RetryingFolder and the ThrottlingFolder copy
+// as the folder they wrap, but the server-side copy is neither retried nor throttled.
+func CopyObjectBetween(source Folder, srcPath string, destination Folder, dstPath string) (serverSide bool, err error) {
+	if copyFolder, ok := unwrapFolder(source).(ServerSideCopyFolder); ok {
+		copied, err := copyFolder.CopyObjectTo(srcPath, unwrapFolder(destination), dstPath)
+		if err != nil || copied {
+			return copied, err
+		}
+	}
+	reader, err := source.ReadObject(srcPath)
+	if err != nil {
+		return false, err
+	}
+	defer reader.Close()
+	err = destination.PutObject(dstPath, reader)
+	return false, errors.Wrapf(err, "failed to copy '%s' to '%s'", source.GetPath()+srcPath, destination.GetPath()+dstPath)
+}
+
+func unwrapFolder(folder Folder) Folder {
+	for {
+		switch wrapper := folder.(type) {
+		case *RetryingFolder:
+			folder = wrapper.Folder
+		case *ThrottlingFolder:
+			folder = wrapper.Folder
+		default:
+			return folder
+		}
+	}
+}
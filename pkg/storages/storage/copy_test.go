@@ -0,0 +1,25 @@
+package storage_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+func TestCopyObjectBetween_streamed(t *testing.T) {
+	source := memory.NewFolder("source/", memory.NewStorage())
+	destination := memory.NewFolder("destination/", memory.NewStorage())
+	require.NoError(t, source.PutObject("sub/object", strings.NewReader("data")))
+
+	serverSide, err := storage.CopyObjectBetween(source, "sub/object", destination, "copied")
+	assert.NoError(t, err)
+	assert.False(t, serverSide)
+	assert.Equal(t, "data", readObject(t, destination, "copied"))
+
+	_, err = storage.CopyObjectBetween(source, "missing", destination, "missing")
+	assert.IsType(t, storage.ObjectNotFoundError{}, err)
+}
@@ -30,3 +30,22 @@ func NewError(err error, storageName, format string, args ...interface{}) Error
 func (err Error) Error() string {
 	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
 }
+
+func (err Error) Unwrap() error {
+	return err.error
+}
+
+// ObjectArchivedError is returned by the read of the object in the archive tier, e.g. S3 Glacier or Azure Archive,
+// which can't be read until it's rehydrated. The retries don't help, so it fails the read at once.
+type ObjectArchivedError struct {
+	error
+}
+
+func NewObjectArchivedError(path string) ObjectArchivedError {
+	return ObjectArchivedError{errors.Errorf("object '%s' is in the archive tier and must be rehydrated "+
+		"before it's read, e.g. by 'wal-g st rehydrate'", path)}
+}
+
+func (err ObjectArchivedError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
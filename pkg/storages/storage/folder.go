@@ -2,8 +2,6 @@ package storage
 
 import (
 	"io"
-	"path"
-	"strings"
 
 	"github.com/wal-g/tracelog"
 )
@@ -23,7 +21,8 @@ type Folder interface {
 	// Returns handle to subfolder. Does not have to instantiate subfolder in any material form
 	GetSubFolder(subFolderRelativePath string) Folder
 
-	// Should return ObjectNotFoundError in case, there is no such object
+	// Should return ObjectNotFoundError in case, there is no such object.
+	// Only the fs storage returns io.Seeker, the other storages stream the object from the beginning.
 	ReadObject(objectRelativePath string) (io.ReadCloser, error)
 
 	PutObject(name string, content io.Reader) error
@@ -31,20 +30,22 @@ type Folder interface {
 	CopyObject(srcPath string, dstPath string) error
 }
 
+// DeleteObjectsWhere deletes the objects of the folder, recursively, which match the filter.
+// The folder is walked by WalkFolderRecursively, only the names of the matching objects are kept.
 func DeleteObjectsWhere(folder Folder, confirm bool, filter func(object1 Object) bool) error {
-	relativePathObjects, err := ListFolderRecursively(folder)
-	if err != nil {
-		return err
-	}
 	filteredRelativePaths := make([]string, 0)
 	tracelog.InfoLogger.Println("Objects in folder:")
-	for _, object := range relativePathObjects {
+	err := WalkFolderRecursively(folder, func(object Object) error {
 		if filter(object) {
 			tracelog.InfoLogger.Println("\twill be deleted: " + object.GetName())
 			filteredRelativePaths = append(filteredRelativePaths, object.GetName())
 		} else {
 			tracelog.DebugLogger.Println("\tskipped: " + object.GetName())
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 	if len(filteredRelativePaths) == 0 {
 		return nil
@@ -57,28 +58,14 @@ func DeleteObjectsWhere(folder Folder, confirm bool, filter func(object1 Object)
 	return nil
 }
 
+// ListFolderRecursively collects the objects of WalkFolderRecursively
 func ListFolderRecursively(folder Folder) (relativePathObjects []Object, err error) {
-	queue := make([]Folder, 0)
-	queue = append(queue, folder)
-	for len(queue) > 0 {
-		subFolder := queue[0]
-		queue = queue[1:]
-		objects, subFolders, err := subFolder.ListFolder()
-		folderPrefix := strings.TrimPrefix(subFolder.GetPath(), folder.GetPath())
-		relativePathObjects = append(relativePathObjects, addPrefixToNames(objects, folderPrefix)...)
-		if err != nil {
-			return nil, err
-		}
-		queue = append(queue, subFolders...)
+	err = WalkFolderRecursively(folder, func(object Object) error {
+		relativePathObjects = append(relativePathObjects, object)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return relativePathObjects, nil
 }
-
-func addPrefixToNames(objects []Object, folderPrefix string) []Object {
-	relativePathObjects := make([]Object, len(objects))
-	for i, object := range objects {
-		relativePath := path.Join(folderPrefix, object.GetName())
-		relativePathObjects[i] = NewLocalObject(relativePath, object.GetLastModified(), object.GetSize())
-	}
-	return relativePathObjects
-}
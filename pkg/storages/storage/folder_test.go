@@ -36,6 +36,33 @@ func TestListFolderRecursively(t *testing.T) {
 	}
 }
 
+// etagFolder lists the objects of the folder with their names as the ETags
+type etagFolder struct {
+	storage.Folder
+}
+
+func (folder etagFolder) ListFolder() ([]storage.Object, []storage.Folder, error) {
+	objects, subFolders, err := folder.Folder.ListFolder()
+	for i, object := range objects {
+		objects[i] = storage.NewLocalObjectWithETag(object.GetName(), object.GetLastModified(), object.GetSize(),
+			object.GetName())
+	}
+	for i, subFolder := range subFolders {
+		subFolders[i] = etagFolder{subFolder}
+	}
+	return objects, subFolders, err
+}
+
+func TestListFolderRecursively_keepsETags(t *testing.T) {
+	folder := memory.NewFolder("in_memory/", memory.NewStorage())
+	assert.NoError(t, folder.PutObject("subfolder/a", &bytes.Buffer{}))
+	objects, err := storage.ListFolderRecursively(etagFolder{folder})
+	assert.NoError(t, err)
+	assert.Len(t, objects, 1)
+	assert.Equal(t, "subfolder/a", objects[0].GetName())
+	assert.Equal(t, "a", storage.ETagOf(objects[0]))
+}
+
 func CreateMockStorageFolder() storage.Folder {
 	var folder = memory.NewFolder("in_memory/", memory.NewStorage())
 	subFolder := folder.GetSubFolder("basebackups_005/")
@@ -64,3 +91,15 @@ func TestDeleteOldObjects(t *testing.T) {
 	assert.Equal(t, 1, len(savedObjects))
 	assert.Equal(t, expectedOnlyOneSavedObjectName, savedObjects[0].GetName())
 }
+
+func TestPlainMD5FromETag(t *testing.T) {
+	md5, ok := storage.PlainMD5FromETag(`"9e107d9d372bb6826bd81d3542a419d6"`)
+	assert.True(t, ok)
+	assert.Equal(t, []byte{0x9e, 0x10, 0x7d, 0x9d, 0x37, 0x2b, 0xb6, 0x82,
+		0x6b, 0xd8, 0x1d, 0x35, 0x42, 0xa4, 0x19, 0xd6}, md5)
+
+	for _, etag := range []string{`"9e107d9d372bb6826bd81d3542a419d6-3"`, "", `"zz107d9d372bb6826bd81d3542a419d6"`} {
+		_, ok = storage.PlainMD5FromETag(etag)
+		assert.False(t, ok, etag)
+	}
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The settings of the HTTP clients of the S3, GCS, Azure and Swift storages
+const (
+	DialTimeoutSetting           = "STORAGE_DIAL_TIMEOUT"
+	ResponseHeaderTimeoutSetting = "STORAGE_RESPONSE_HEADER_TIMEOUT"
+	MaxIdleConnectionsSetting    = "STORAGE_MAX_IDLE_CONNECTIONS"
+	CACertFileSetting            = "STORAGE_CA_CERT_FILE"
+	InsecureSkipVerifySetting    = "STORAGE_INSECURE_SKIP_VERIFY"
+
+	// defaultKeepAlive is the keep-alive period of http.DefaultTransport
+	defaultKeepAlive = 30 * time.Second
+)
+
+var HTTPClientSettingList = []string{
+	DialTimeoutSetting,
+	ResponseHeaderTimeoutSetting,
+	MaxIdleConnectionsSetting,
+	CACertFileSetting,
+	InsecureSkipVerifySetting,
+}
+
+// HTTPClientOptions tune the transport of the storage client, the zero options keep the defaults
+// of the client library
+type HTTPClientOptions struct {
+	DialTimeout           time.Duration
+	ResponseHeaderTimeout time.Duration
+	MaxIdleConnections    int
+	// CACertFile is the PEM file of the certificates trusted besides the system ones
+	CACertFile         string
+	InsecureSkipVerify bool
+}
+
+// ParseHTTPClientOptions reads the HTTPClientSettingList settings, the timeouts are the durations like 10s
+func ParseHTTPClientOptions(settings map[string]string) (HTTPClientOptions, error) {
+	var options HTTPClientOptions
+	var err error
+	if value, ok := settings[DialTimeoutSetting]; ok {
+		if options.DialTimeout, err = time.ParseDuration(value); err != nil {
+			return HTTPClientOptions{}, errors.Wrapf(err, "failed to parse %s", DialTimeoutSetting)
+		}
+	}
+	if value, ok := settings[ResponseHeaderTimeoutSetting]; ok {
+		if options.ResponseHeaderTimeout, err = time.ParseDuration(value); err != nil {
+			return HTTPClientOptions{}, errors.Wrapf(err, "failed to parse %s", ResponseHeaderTimeoutSetting)
+		}
+	}
+	if value, ok := settings[MaxIdleConnectionsSetting]; ok {
+		if options.MaxIdleConnections, err = strconv.Atoi(value); err != nil {
+			return HTTPClientOptions{}, errors.Wrapf(err, "failed to parse %s", MaxIdleConnectionsSetting)
+		}
+	}
+	if value, ok := settings[InsecureSkipVerifySetting]; ok {
+		if options.InsecureSkipVerify, err = strconv.ParseBool(value); err != nil {
+			return HTTPClientOptions{}, errors.Wrapf(err, "failed to parse %s", InsecureSkipVerifySetting)
+		}
+	}
+	options.CACertFile = settings[CACertFileSetting]
+	return options, nil
+}
+
+func (options HTTPClientOptions) IsDefault() bool {
+	return options == HTTPClientOptions{}
+}
+
+// NewHTTPTransport returns the copy of http.DefaultTransport tuned by the options.
+// The CA file which can't be read or has no certificates fails it.
+func NewHTTPTransport(options HTTPClientOptions) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if options.DialTimeout > 0 {
+		dialer := &net.Dialer{Timeout: options.DialTimeout, KeepAlive: defaultKeepAlive}
+		transport.DialContext = dialer.DialContext
+		transport.TLSHandshakeTimeout = options.DialTimeout
+	}
+	if options.ResponseHeaderTimeout > 0 {
+		transport.ResponseHeaderTimeout = options.ResponseHeaderTimeout
+	}
+	if options.MaxIdleConnections > 0 {
+		transport.MaxIdleConns = options.MaxIdleConnections
+		transport.MaxIdleConnsPerHost = options.MaxIdleConnections
+	}
+	if options.CACertFile != "" || options.InsecureSkipVerify {
+		// the clone has its own copy of the TLS config, if any
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.InsecureSkipVerify = options.InsecureSkipVerify
+	}
+	if options.CACertFile != "" {
+		rootCAs, err := loadCACertFile(options.CACertFile)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig.RootCAs = rootCAs
+	}
+	return transport, nil
+}
+
+// loadCACertFile adds the certificates of the file to the system ones
+func loadCACertFile(caCertFile string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(caCertFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read the CA certificate file %s", caCertFile)
+	}
+	rootCAs, err := x509.SystemCertPool()
+	if err != nil || rootCAs == nil {
+		rootCAs = x509.NewCertPool()
+	}
+	if !rootCAs.AppendCertsFromPEM(pem) {
+		return nil, errors.Errorf("no PEM certificates found in the CA certificate file %s", caCertFile)
+	}
+	return rootCAs, nil
+}
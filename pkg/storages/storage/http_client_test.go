@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHTTPClientOptions(t *testing.T) {
+	options, err := ParseHTTPClientOptions(map[string]string{
+		DialTimeoutSetting:           "5s",
+		ResponseHeaderTimeoutSetting: "1m",
+		MaxIdleConnectionsSetting:    "20",
+		InsecureSkipVerifySetting:    "true",
+		CACertFileSetting:            "/etc/ca.pem",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, HTTPClientOptions{
+		DialTimeout:           5 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+		MaxIdleConnections:    20,
+		CACertFile:            "/etc/ca.pem",
+		InsecureSkipVerify:    true,
+	}, options)
+
+	options, err = ParseHTTPClientOptions(map[string]string{})
+	require.NoError(t, err)
+	assert.True(t, options.IsDefault())
+
+	_, err = ParseHTTPClientOptions(map[string]string{DialTimeoutSetting: "5"})
+	assert.Error(t, err)
+	_, err = ParseHTTPClientOptions(map[string]string{MaxIdleConnectionsSetting: "many"})
+	assert.Error(t, err)
+}
+
+func TestNewHTTPTransport(t *testing.T) {
+	transport, err := NewHTTPTransport(HTTPClientOptions{
+		DialTimeout:           5 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+		MaxIdleConnections:    20,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Second, transport.TLSHandshakeTimeout)
+	assert.Equal(t, time.Minute, transport.ResponseHeaderTimeout)
+	assert.Equal(t, 20, transport.MaxIdleConns)
+	assert.Equal(t, 20, transport.MaxIdleConnsPerHost)
+	if transport.TLSClientConfig != nil {
+		assert.False(t, transport.TLSClientConfig.InsecureSkipVerify)
+		assert.Nil(t, transport.TLSClientConfig.RootCAs)
+	}
+
+	transport, err = NewHTTPTransport(HTTPClientOptions{InsecureSkipVerify: true})
+	require.NoError(t, err)
+	assert.True(t, transport.TLSClientConfig.InsecureSkipVerify)
+}
+
+func TestNewHTTPTransport_caCertFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {}))
+	defer server.Close()
+	caCertFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, ioutil.WriteFile(caCertFile,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600))
+
+	transport, err := NewHTTPTransport(HTTPClientOptions{CACertFile: caCertFile})
+	require.NoError(t, err)
+	response, err := (&http.Client{Transport: transport}).Get(server.URL)
+	require.NoError(t, err)
+	assert.NoError(t, response.Body.Close())
+
+	// the server certificate isn't trusted without the file
+	_, err = (&http.Client{Transport: http.DefaultTransport}).Get(server.URL)
+	assert.Error(t, err)
+}
+
+func TestNewHTTPTransport_badCACertFile(t *testing.T) {
+	missingFile := filepath.Join(t.TempDir(), "missing.pem")
+	_, err := NewHTTPTransport(HTTPClientOptions{CACertFile: missingFile})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), missingFile)
+
+	notPEMFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, ioutil.WriteFile(notPEMFile, []byte("not a certificate"), 0600))
+	_, err = NewHTTPTransport(HTTPClientOptions{CACertFile: notPEMFile})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), notPEMFile)
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"path"
+	"strings"
+)
+
+// ListCallback receives the listed objects and subfolders one by one, exactly one of the arguments is non-nil.
+// The listing stops and returns the error the callback returns.
+type ListCallback func(object Object, subFolder Folder) error
+
+// StreamingListFolder is implemented by the folders which pass the objects to the callback page by page
+// as the storage lists them, so the listing of the folder with millions of objects isn't kept in memory
+type StreamingListFolder interface {
+	Folder
+	ListFolderStream(callback ListCallback) error
+}
+
+// ListFolderStream passes the objects and the subfolders of the folder to the callback,
+// the folders which don't stream the listing are listed by ListFolder first
+func ListFolderStream(folder Folder, callback ListCallback) error {
+	if streamingFolder, ok := folder.(StreamingListFolder); ok {
+		return streamingFolder.ListFolderStream(callback)
+	}
+	objects, subFolders, err := folder.ListFolder()
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		if err = callback(object, nil); err != nil {
+			return err
+		}
+	}
+	for _, subFolder := range subFolders {
+		if err = callback(nil, subFolder); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CollectListing implements ListFolder of the StreamingListFolder by its ListFolderStream
+func CollectListing(listFolderStream func(callback ListCallback) error) (objects []Object, subFolders []Folder, err error) {
+	err = listFolderStream(func(object Object, subFolder Folder) error {
+		if subFolder != nil {
+			subFolders = append(subFolders, subFolder)
+		} else {
+			objects = append(objects, object)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return objects, subFolders, nil
+}
+
+// WalkFolderRecursively passes the objects of the folder and all its subfolders to the callback,
+// named relative to the folder. Only the subfolders which are yet to be listed are kept in memory.
+func WalkFolderRecursively(folder Folder, callback func(object Object) error) error {
+	queue := []Folder{folder}
+	for len(queue) > 0 {
+		subFolder := queue[0]
+		queue = queue[1:]
+		folderPrefix := strings.TrimPrefix(subFolder.GetPath(), folder.GetPath())
+		err := ListFolderStream(subFolder, func(object Object, listedFolder Folder) error {
+			if listedFolder != nil {
+				queue = append(queue, listedFolder)
+				return nil
+			}
+			return callback(addPrefixToName(object, folderPrefix))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addPrefixToName(object Object, folderPrefix string) Object {
+	if folderPrefix == "" {
+		return object
+	}
+	return NewLocalObjectWithETag(path.Join(folderPrefix, object.GetName()), object.GetLastModified(),
+		object.GetSize(), ETagOf(object))
+}
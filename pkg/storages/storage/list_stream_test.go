@@ -0,0 +1,81 @@
+package storage_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+func heapInUse() uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+func TestWalkFolderRecursively_memoryStaysFlat(t *testing.T) {
+	if testing.Short() {
+		t.Skip("stores a million objects")
+	}
+	const objectCount = 1000000
+	memoryStorage := memory.NewStorage()
+	for i := 0; i < objectCount; i++ {
+		memoryStorage.Store(fmt.Sprintf("wal_005/%024X", i), bytes.Buffer{})
+	}
+	folder := memory.NewFolder("", memoryStorage)
+
+	var walked int
+	var heapAtStart, heapAtEnd uint64
+	err := storage.WalkFolderRecursively(folder, func(object storage.Object) error {
+		walked++
+		switch walked {
+		case objectCount / 10:
+			heapAtStart = heapInUse()
+		case objectCount:
+			heapAtEnd = heapInUse()
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, objectCount, walked)
+	// ListFolderRecursively of the same folder keeps ~100 bytes per object, ~90 MB between the measurements
+	assert.Less(t, int64(heapAtEnd)-int64(heapAtStart), int64(8<<20))
+}
+
+func TestListFolderStream(t *testing.T) {
+	folder := memory.NewFolder("in_memory/", memory.NewStorage())
+	for _, name := range []string{"a", "b", "sub/c", "sub/d", "other/e"} {
+		require.NoError(t, folder.PutObject(name, &bytes.Buffer{}))
+	}
+	var objectNames, subFolderPaths []string
+	for _, listed := range []storage.Folder{folder, etagFolder{folder}} {
+		objectNames, subFolderPaths = nil, nil
+		err := storage.ListFolderStream(listed, func(object storage.Object, subFolder storage.Folder) error {
+			if subFolder != nil {
+				subFolderPaths = append(subFolderPaths, subFolder.GetPath())
+			} else {
+				objectNames = append(objectNames, object.GetName())
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"a", "b"}, objectNames)
+		assert.ElementsMatch(t, []string{"in_memory/sub/", "in_memory/other/"}, subFolderPaths)
+	}
+
+	errStop := errors.New("stop")
+	listed := 0
+	err := storage.WalkFolderRecursively(folder, func(storage.Object) error {
+		listed++
+		return errStop
+	})
+	assert.Equal(t, errStop, err)
+	assert.Equal(t, 1, listed)
+}
@@ -6,10 +6,16 @@ type LocalObject struct {
 	name         string
 	lastModified time.Time
 	size         int64
+	etag         string
 }
 
 func NewLocalObject(name string, lastModified time.Time, size int64) *LocalObject {
-	return &LocalObject{name, lastModified, size}
+	return &LocalObject{name: name, lastModified: lastModified, size: size}
+}
+
+// NewLocalObjectWithETag is NewLocalObject of the storage which lists the ETags of the objects
+func NewLocalObjectWithETag(name string, lastModified time.Time, size int64, etag string) *LocalObject {
+	return &LocalObject{name, lastModified, size, etag}
 }
 
 func (object LocalObject) GetName() string {
@@ -23,3 +29,8 @@ func (object LocalObject) GetLastModified() time.Time {
 func (object LocalObject) GetSize() int64 {
 	return object.size
 }
+
+// GetETag is empty if the storage doesn't list the ETags
+func (object LocalObject) GetETag() string {
+	return object.etag
+}
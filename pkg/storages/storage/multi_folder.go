@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+)
+
+// MultiFolder reads from the primary folder and falls back to the failover folders, e.g. the replicas
+// of the bucket in other regions, in their order. The read fails over when the object is missing
+// or archived, or the storage is unavailable, any other error, e.g. the denied access, fails the read.
+// The objects are written, copied and deleted in the primary folder only.
+type MultiFolder struct {
+	Folder
+	failovers   []Folder
+	isRetryable func(error) bool
+}
+
+// NewMultiFolder returns the primary folder as is if there are no failover folders.
+// The isRetryable recognizes the transient errors of the backend like in RetryOptions.
+func NewMultiFolder(primary Folder, failovers []Folder, isRetryable func(error) bool) Folder {
+	if len(failovers) == 0 {
+		return primary
+	}
+	return &MultiFolder{Folder: primary, failovers: failovers, isRetryable: isRetryable}
+}
+
+func (folder *MultiFolder) folders() []Folder {
+	return append([]Folder{folder.Folder}, folder.failovers...)
+}
+
+// shouldFailOver tells whether the next folder may have what the previous one failed to provide
+func (folder *MultiFolder) shouldFailOver(err error) bool {
+	var notFoundError ObjectNotFoundError
+	var archivedError ObjectArchivedError
+	return errors.As(err, &notFoundError) || errors.As(err, &archivedError) || isTransientError(err, folder.isRetryable)
+}
+
+// read returns the result of the first folder which doesn't fail over, or the error of the primary folder
+func (folder *MultiFolder) read(objectRelativePath string,
+	readFrom func(Folder) (io.ReadCloser, error)) (io.ReadCloser, error) {
+	var primaryErr error
+	for i, candidate := range folder.folders() {
+		reader, err := readFrom(candidate)
+		if err == nil {
+			tracelog.DebugLogger.Printf("Read %s from %s", objectRelativePath, candidate.GetPath())
+			return reader, nil
+		}
+		if !folder.shouldFailOver(err) {
+			return nil, err
+		}
+		if i == 0 {
+			primaryErr = err
+		}
+		tracelog.DebugLogger.Printf("Failed to read %s from %s, failing over: %v", objectRelativePath, candidate.GetPath(), err)
+	}
+	return nil, primaryErr
+}
+
+func (folder *MultiFolder) ReadObject(objectRelativePath string) (io.ReadCloser, error) {
+	return folder.read(objectRelativePath, func(candidate Folder) (io.ReadCloser, error) {
+		return candidate.ReadObject(objectRelativePath)
+	})
+}
+
+// RangeReader reads the part of the object from the first folder which has it, see ReadObjectRange
+func (folder *MultiFolder) RangeReader(objectRelativePath string, offset, length int64) (io.ReadCloser, error) {
+	return folder.read(objectRelativePath, func(candidate Folder) (io.ReadCloser, error) {
+		return ReadObjectRange(candidate, objectRelativePath, offset, length)
+	})
+}
+
+// GetObjectTier returns the tier of the object in the primary folder, the object archived there
+// may still be read from the failover folders
+func (folder *MultiFolder) GetObjectTier(objectRelativePath string) (ObjectTier, error) {
+	return GetObjectTier(folder.Folder, objectRelativePath)
+}
+
+// Rehydrate rehydrates the object in the primary folder, like the writes do
+func (folder *MultiFolder) Rehydrate(objectRelativePath string, options RehydrateOptions) error {
+	return RehydrateObject(folder.Folder, objectRelativePath, options)
+}
+
+// Exists is true if any of the folders has the object, the unavailable folders are skipped
+// unless all of them are unavailable
+func (folder *MultiFolder) Exists(objectRelativePath string) (bool, error) {
+	var primaryErr error
+	for i, candidate := range folder.folders() {
+		exists, err := candidate.Exists(objectRelativePath)
+		if err == nil && exists {
+			tracelog.DebugLogger.Printf("Found %s in %s", objectRelativePath, candidate.GetPath())
+			return true, nil
+		}
+		if err != nil && !folder.shouldFailOver(err) {
+			return false, err
+		}
+		if i == 0 {
+			primaryErr = err
+		}
+	}
+	return false, primaryErr
+}
+
+// ListFolder merges the listings of the folders, the object listed by several folders is taken
+// from the first of them. The folder which is unavailable is skipped unless all of them are.
+func (folder *MultiFolder) ListFolder() (objects []Object, subFolders []Folder, err error) {
+	return CollectListing(folder.ListFolderStream)
+}
+
+// ListFolderStream streams the listings of the folders one after another like ListFolder merges them,
+// the folder which becomes unavailable in the middle of its listing is skipped from there on
+func (folder *MultiFolder) ListFolderStream(callback ListCallback) error {
+	listedObjects := make(map[string]bool)
+	listedSubFolders := make(map[string]bool)
+	var primaryErr, callbackErr error
+	listed := false
+	for i, candidate := range folder.folders() {
+		err := ListFolderStream(candidate, func(object Object, subFolder Folder) error {
+			if subFolder != nil {
+				name := strings.TrimSuffix(strings.TrimPrefix(subFolder.GetPath(), candidate.GetPath()), "/")
+				if listedSubFolders[name] {
+					return nil
+				}
+				listedSubFolders[name] = true
+				callbackErr = callback(nil, folder.GetSubFolder(name))
+				return callbackErr
+			}
+			if listedObjects[object.GetName()] {
+				return nil
+			}
+			listedObjects[object.GetName()] = true
+			tracelog.DebugLogger.Printf("Listed %s from %s", object.GetName(), candidate.GetPath())
+			callbackErr = callback(object, nil)
+			return callbackErr
+		})
+		if callbackErr != nil {
+			return callbackErr
+		}
+		if err != nil {
+			if !folder.shouldFailOver(err) {
+				return err
+			}
+			if i == 0 {
+				primaryErr = err
+			}
+			tracelog.DebugLogger.Printf("Failed to list %s, skipping it: %v", candidate.GetPath(), err)
+			continue
+		}
+		listed = true
+	}
+	if !listed {
+		return primaryErr
+	}
+	return nil
+}
+
+// GetSubFolder returns the MultiFolder of the same subfolders of all the folders
+func (folder *MultiFolder) GetSubFolder(subFolderRelativePath string) Folder {
+	failovers := make([]Folder, 0, len(folder.failovers))
+	for _, failover := range folder.failovers {
+		failovers = append(failovers, failover.GetSubFolder(subFolderRelativePath))
+	}
+	return &MultiFolder{
+		Folder:      folder.Folder.GetSubFolder(subFolderRelativePath),
+		failovers:   failovers,
+		isRetryable: folder.isRetryable,
+	}
+}
@@ -0,0 +1,189 @@
+package storage_test
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+var errAccessDenied = errors.New("AccessDenied: Access Denied")
+
+// failingFolder fails the reads and the listings with err
+type failingFolder struct {
+	storage.Folder
+	err error
+}
+
+func (folder *failingFolder) ReadObject(string) (io.ReadCloser, error) { return nil, folder.err }
+
+func (folder *failingFolder) Exists(string) (bool, error) { return false, folder.err }
+
+func (folder *failingFolder) ListFolder() ([]storage.Object, []storage.Folder, error) {
+	return nil, nil, folder.err
+}
+
+func newReplicatedFolders(t *testing.T) (primary, replica storage.Folder) {
+	primary = memory.NewFolder("primary/", memory.NewStorage())
+	replica = memory.NewFolder("replica/", memory.NewStorage())
+	for name, content := range map[string]string{"a": "a", "shared": "primary", "sub/x": "x"} {
+		require.NoError(t, primary.PutObject(name, strings.NewReader(content)))
+	}
+	for name, content := range map[string]string{"b": "b", "shared": "replica", "sub/y": "y", "other/z": "z"} {
+		require.NoError(t, replica.PutObject(name, strings.NewReader(content)))
+	}
+	return primary, replica
+}
+
+func readObject(t *testing.T, folder storage.Folder, name string) string {
+	reader, err := folder.ReadObject(name)
+	require.NoError(t, err)
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestMultiFolder_readFailsOver(t *testing.T) {
+	primary, replica := newReplicatedFolders(t)
+	folder := storage.NewMultiFolder(primary, []storage.Folder{replica}, nil)
+
+	assert.Equal(t, "a", readObject(t, folder, "a"))
+	assert.Equal(t, "b", readObject(t, folder, "b"))
+	assert.Equal(t, "primary", readObject(t, folder, "shared"))
+	assert.Equal(t, "y", readObject(t, folder.GetSubFolder("sub"), "y"))
+	_, err := folder.ReadObject("missing")
+	assert.IsType(t, storage.ObjectNotFoundError{}, err)
+
+	for name, expected := range map[string]bool{"a": true, "b": true, "missing": false} {
+		exists, err := folder.Exists(name)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, exists, name)
+	}
+
+	assert.NoError(t, folder.PutObject("uploaded", strings.NewReader("new")))
+	exists, err := primary.Exists("uploaded")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestMultiFolder_listingMerged(t *testing.T) {
+	primary, replica := newReplicatedFolders(t)
+	folder := storage.NewMultiFolder(primary, []storage.Folder{replica}, nil)
+
+	objects, subFolders, err := folder.ListFolder()
+	require.NoError(t, err)
+	sizes := make(map[string]int64)
+	for _, object := range objects {
+		sizes[object.GetName()] = object.GetSize()
+	}
+	assert.Equal(t, map[string]int64{"a": 1, "b": 1, "shared": int64(len("primary"))}, sizes)
+	var subFolderPaths []string
+	for _, subFolder := range subFolders {
+		subFolderPaths = append(subFolderPaths, subFolder.GetPath())
+	}
+	assert.ElementsMatch(t, []string{"primary/sub/", "primary/other/"}, subFolderPaths)
+
+	recursive, err := storage.ListFolderRecursively(folder)
+	require.NoError(t, err)
+	var names []string
+	for _, object := range recursive {
+		names = append(names, object.GetName())
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"a", "b", "other/z", "shared", "sub/x", "sub/y"}, names)
+}
+
+func TestMultiFolder_primaryUnavailable(t *testing.T) {
+	_, replica := newReplicatedFolders(t)
+	unavailable := &failingFolder{memory.NewFolder("primary/", memory.NewStorage()), syscall.ECONNREFUSED}
+	folder := storage.NewMultiFolder(unavailable, []storage.Folder{replica}, nil)
+
+	assert.Equal(t, "replica", readObject(t, folder, "shared"))
+	exists, err := folder.Exists("b")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	objects, _, err := folder.ListFolder()
+	assert.NoError(t, err)
+	assert.Len(t, objects, 2)
+
+	_, err = folder.ReadObject("missing")
+	assert.Equal(t, syscall.ECONNREFUSED, err)
+	_, _, err = storage.NewMultiFolder(unavailable, []storage.Folder{unavailable}, nil).ListFolder()
+	assert.Equal(t, syscall.ECONNREFUSED, err)
+}
+
+func TestMultiFolder_deniedAccessDoesNotFailOver(t *testing.T) {
+	_, replica := newReplicatedFolders(t)
+	denied := &failingFolder{memory.NewFolder("primary/", memory.NewStorage()), errAccessDenied}
+	folder := storage.NewMultiFolder(denied, []storage.Folder{replica}, nil)
+
+	_, err := folder.ReadObject("shared")
+	assert.Equal(t, errAccessDenied, err)
+	_, err = folder.Exists("b")
+	assert.Equal(t, errAccessDenied, err)
+	_, _, err = folder.ListFolder()
+	assert.Equal(t, errAccessDenied, err)
+
+	unavailableByBackend := storage.NewMultiFolder(denied, []storage.Folder{replica}, func(err error) bool {
+		return errors.Is(err, errAccessDenied)
+	})
+	assert.Equal(t, "replica", readObject(t, unavailableByBackend, "shared"))
+}
+
+// midStreamFailingFolder streams the first object of the folder by name and then fails with err
+type midStreamFailingFolder struct {
+	storage.Folder
+	err error
+}
+
+func (folder *midStreamFailingFolder) ListFolderStream(callback storage.ListCallback) error {
+	objects, _, err := folder.Folder.ListFolder()
+	if err != nil {
+		return err
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].GetName() < objects[j].GetName() })
+	if err = callback(objects[0], nil); err != nil {
+		return err
+	}
+	return folder.err
+}
+
+func TestMultiFolder_listFolderStream(t *testing.T) {
+	primary, replica := newReplicatedFolders(t)
+	failing := &midStreamFailingFolder{primary, syscall.ECONNRESET}
+	folder := storage.NewMultiFolder(failing, []storage.Folder{replica}, nil)
+
+	var names, subFolderPaths []string
+	err := storage.ListFolderStream(folder, func(object storage.Object, subFolder storage.Folder) error {
+		if subFolder != nil {
+			subFolderPaths = append(subFolderPaths, subFolder.GetPath())
+		} else {
+			names = append(names, object.GetName())
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	// the primary listed "a" before it failed, the rest came from the replica
+	assert.ElementsMatch(t, []string{"a", "b", "shared"}, names)
+	assert.ElementsMatch(t, []string{"primary/sub/", "primary/other/"}, subFolderPaths)
+
+	err = storage.ListFolderStream(folder, func(storage.Object, storage.Folder) error {
+		return errAccessDenied
+	})
+	assert.Equal(t, errAccessDenied, err)
+}
+
+func TestNewMultiFolder_noFailovers(t *testing.T) {
+	primary := memory.NewFolder("primary/", memory.NewStorage())
+	assert.Equal(t, storage.Folder(primary), storage.NewMultiFolder(primary, nil, nil))
+	assert.False(t, storage.SupportsRangeReads(storage.NewMultiFolder(primary, []storage.Folder{primary}, nil)))
+}
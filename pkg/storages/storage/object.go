@@ -9,3 +9,17 @@ type Object interface {
 	GetLastModified() time.Time
 	GetSize() int64
 }
+
+// ETagObject is the listed Object with the ETag, which is empty if the storage doesn't list it
+type ETagObject interface {
+	Object
+	GetETag() string
+}
+
+// ETagOf returns the listed ETag of the object, if it's known
+func ETagOf(object Object) string {
+	if etagObject, ok := object.(ETagObject); ok {
+		return etagObject.GetETag()
+	}
+	return ""
+}
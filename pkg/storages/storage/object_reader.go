@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"encoding/hex"
+	"io"
+	"strings"
+)
+
+// ContentEncodingReader is implemented by the readers returned from Folder.ReadObject
+// when the storage reports the object content encoding, e.g. `Content-Encoding: gzip`
+// of the object written through a compressing proxy
+type ContentEncodingReader interface {
+	io.ReadCloser
+	ContentEncoding() string
+}
+
+// ETagReader is implemented by the readers returned from Folder.ReadObject
+// when the storage reports the ETag of the object
+type ETagReader interface {
+	io.ReadCloser
+	ETag() string
+}
+
+// ObjectReadAttributes are the object properties the storage reports along with its content
+type ObjectReadAttributes struct {
+	ContentEncoding string
+	ETag            string
+}
+
+type objectReader struct {
+	io.ReadCloser
+	attributes ObjectReadAttributes
+}
+
+func (reader *objectReader) ContentEncoding() string {
+	return reader.attributes.ContentEncoding
+}
+
+func (reader *objectReader) ETag() string {
+	return reader.attributes.ETag
+}
+
+// NewObjectReader makes the reader implement ContentEncodingReader and ETagReader,
+// the reader is returned as is if no attributes are known
+func NewObjectReader(reader io.ReadCloser, attributes ObjectReadAttributes) io.ReadCloser {
+	if attributes == (ObjectReadAttributes{}) {
+		return reader
+	}
+	return &objectReader{reader, attributes}
+}
+
+// PlainMD5FromETag returns the MD5 of the content if the ETag is the plain hex MD5, as S3 sets for the objects
+// uploaded in a single part without SSE-KMS or SSE-C. The multipart ETags have the parts count suffix, e.g. "-5".
+func PlainMD5FromETag(etag string) ([]byte, bool) {
+	etag = strings.TrimPrefix(etag, "W/")
+	etag = strings.Trim(etag, `"`)
+	if len(etag) != 2*16 {
+		return nil, false
+	}
+	md5, err := hex.DecodeString(etag)
+	if err != nil {
+		return nil, false
+	}
+	return md5, true
+}
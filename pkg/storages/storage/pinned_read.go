@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+)
+
+// ObjectVersion is the stored content of the object, the object overwritten since it was read has another one
+type ObjectVersion struct {
+	Size int64
+	// Tag is the ETag of the object, or its generation on GCS
+	Tag string
+}
+
+// PinnedReadFolder is implemented by the folders which can read the ranges of the object version,
+// so the object downloaded by the parts isn't stitched from two versions when it's overwritten meanwhile
+type PinnedReadFolder interface {
+	RangeReaderFolder
+	// GetObjectVersion reads the size and the tag of the object, e.g. by the HEAD request.
+	// It returns ObjectNotFoundError in case there is no such object.
+	GetObjectVersion(objectRelativePath string) (ObjectVersion, error)
+	// PinnedRangeReader is RangeReader of the version, e.g. by the If-Match request,
+	// it returns ObjectChangedError if the object isn't of the version anymore
+	PinnedRangeReader(objectRelativePath string, offset, length int64, version ObjectVersion) (io.ReadCloser, error)
+}
+
+// ObjectChangedError is returned by the pinned read of the object overwritten since its version was read
+type ObjectChangedError struct {
+	error
+}
+
+func NewObjectChangedError(path string) ObjectChangedError {
+	return ObjectChangedError{errors.Errorf("object '%s' has changed while it was read", path)}
+}
+
+func (err ObjectChangedError) Error() string {
+	return fmt.Sprintf(tracelog.GetErrorFormatter(), err.error)
+}
+
+// SupportsPinnedReads tells whether the folder reads the ranges of the object version. The RetryingFolder
+// and the ThrottlingFolder pin the reads if the folder they wrap does, the MultiFolder doesn't, since
+// the failover folders have their own versions of the object.
+func SupportsPinnedReads(folder Folder) bool {
+	switch wrapper := folder.(type) {
+	case *RetryingFolder:
+		return SupportsPinnedReads(wrapper.Folder)
+	case *ThrottlingFolder:
+		return SupportsPinnedReads(wrapper.Folder)
+	case *MultiFolder:
+		return false
+	}
+	_, ok := folder.(PinnedReadFolder)
+	return ok
+}
+
+// GetObjectVersion returns the version of the object, it fails for the folders which don't pin the reads
+func GetObjectVersion(folder Folder, objectRelativePath string) (ObjectVersion, error) {
+	if !SupportsPinnedReads(folder) {
+		return ObjectVersion{}, errors.Errorf("the storage of '%s' can't pin the reads", folder.GetPath())
+	}
+	return folder.(PinnedReadFolder).GetObjectVersion(objectRelativePath)
+}
+
+// ReadPinnedObjectRange reads the part of the object version, see ReadObjectRange.
+// It fails for the folders which don't pin the reads.
+func ReadPinnedObjectRange(folder Folder, objectRelativePath string, offset, length int64,
+	version ObjectVersion) (io.ReadCloser, error) {
+	if length == 0 {
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	}
+	if !SupportsPinnedReads(folder) {
+		return nil, errors.Errorf("the storage of '%s' can't pin the reads", folder.GetPath())
+	}
+	return folder.(PinnedReadFolder).PinnedRangeReader(objectRelativePath, offset, length, version)
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// RangeReaderFolder is implemented by the folders which can read a part of the object
+// without downloading the bytes before it, e.g. with the HTTP Range requests
+type RangeReaderFolder interface {
+	Folder
+	// RangeReader reads length bytes of the object from the offset, the negative length reads up to the end.
+	// Like ReadObject, it returns ObjectNotFoundError in case there is no such object.
+	RangeReader(objectRelativePath string, offset, length int64) (io.ReadCloser, error)
+}
+
+// ReadObjectRange reads the part of the object by RangeReader if the folder supports it.
+// Otherwise the object is read from the beginning and the bytes before the offset are discarded.
+// The zero length range is empty without asking the storage.
+func ReadObjectRange(folder Folder, objectRelativePath string, offset, length int64) (io.ReadCloser, error) {
+	if length == 0 {
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	}
+	if rangeReaderFolder, ok := folder.(RangeReaderFolder); ok {
+		return rangeReaderFolder.RangeReader(objectRelativePath, offset, length)
+	}
+	reader, err := folder.ReadObject(objectRelativePath)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.CopyN(ioutil.Discard, reader, offset)
+	if err != nil {
+		reader.Close()
+		return nil, errors.Wrapf(err, "failed to skip %d bytes of '%s'", offset, objectRelativePath)
+	}
+	if length < 0 {
+		return reader, nil
+	}
+	return &limitedReadCloser{io.LimitReader(reader, length), reader}, nil
+}
+
+// SupportsRangeReads tells whether the folder reads the part of the object without downloading the bytes before it,
+// the RetryingFolder reads the ranges as well as the folder it wraps, and the MultiFolder as the worst of its folders
+func SupportsRangeReads(folder Folder) bool {
+	switch wrapper := folder.(type) {
+	case *RetryingFolder:
+		return SupportsRangeReads(wrapper.Folder)
+	case *MultiFolder:
+		for _, wrapped := range wrapper.folders() {
+			if !SupportsRangeReads(wrapped) {
+				return false
+			}
+		}
+		return true
+	}
+	_, ok := folder.(RangeReaderFolder)
+	return ok
+}
+
+// HTTPRange returns the value of the HTTP Range header which requests the part of the object,
+// the length must not be zero
+func HTTPRange(offset, length int64) string {
+	if length < 0 {
+		return fmt.Sprintf("bytes=%d-", offset)
+	}
+	return fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
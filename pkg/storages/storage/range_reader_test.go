@@ -0,0 +1,54 @@
+package storage_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/pkg/storages/fs"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+func readRange(t *testing.T, folder storage.Folder, offset, length int64) string {
+	reader, err := storage.ReadObjectRange(folder, "object", offset, length)
+	require.NoError(t, err)
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestReadObjectRange_fallback(t *testing.T) {
+	folder := memory.NewFolder("in_memory/", memory.NewStorage())
+	require.NoError(t, folder.PutObject("object", bytes.NewBufferString("0123456789")))
+	_, isRangeReaderFolder := storage.Folder(folder).(storage.RangeReaderFolder)
+	require.False(t, isRangeReaderFolder)
+
+	assert.Equal(t, "3456", readRange(t, folder, 3, 4))
+	assert.Equal(t, "789", readRange(t, folder, 7, -1))
+	assert.Equal(t, "", readRange(t, folder, 3, 0))
+
+	_, err := storage.ReadObjectRange(folder, "object", 20, -1)
+	assert.Error(t, err)
+	_, err = storage.ReadObjectRange(folder, "missing", 0, -1)
+	assert.IsType(t, storage.ObjectNotFoundError{}, err)
+}
+
+func TestHTTPRange(t *testing.T) {
+	assert.Equal(t, "bytes=100-", storage.HTTPRange(100, -1))
+	assert.Equal(t, "bytes=0-9", storage.HTTPRange(0, 10))
+}
+
+func TestSupportsRangeReads(t *testing.T) {
+	memoryFolder := memory.NewFolder("in_memory/", memory.NewStorage())
+	fsFolder := fs.NewFolder(t.TempDir(), "")
+	retries := storage.RetryOptions{MaxAttempts: 3}
+
+	assert.False(t, storage.SupportsRangeReads(memoryFolder))
+	assert.True(t, storage.SupportsRangeReads(fsFolder))
+	assert.False(t, storage.SupportsRangeReads(storage.NewRetryingFolder(memoryFolder, retries)))
+	assert.True(t, storage.SupportsRangeReads(storage.NewRetryingFolder(fsFolder, retries)))
+}
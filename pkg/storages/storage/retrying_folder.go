@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+)
+
+const (
+	retryMinDelay = 100 * time.Millisecond
+	retryMaxDelay = 10 * time.Second
+)
+
+type RetryOptions struct {
+	// MaxAttempts counts the first attempt too, so 1 disables the retries
+	MaxAttempts int
+	// Timeout caps the time spent on all the attempts of one operation, 0 means no cap
+	Timeout time.Duration
+	// IsRetryable recognizes the transient errors of the backend, e.g. throttling,
+	// the network errors are retried without it
+	IsRetryable func(error) bool
+}
+
+// RetryingFolder repeats the idempotent operations of the folder which failed transiently,
+// the delays between the attempts grow exponentially and are randomized by the full jitter.
+// PutObject isn't retried since the content reader can't be rewound.
+type RetryingFolder struct {
+	Folder
+	options RetryOptions
+	sleep   func(time.Duration)
+}
+
+// NewRetryingFolder wraps the folder unless the options allow only one attempt
+func NewRetryingFolder(folder Folder, options RetryOptions) Folder {
+	if options.MaxAttempts <= 1 {
+		return folder
+	}
+	return &RetryingFolder{Folder: folder, options: options, sleep: time.Sleep}
+}
+
+func (folder *RetryingFolder) wrap(subFolder Folder) Folder {
+	return &RetryingFolder{Folder: subFolder, options: folder.options, sleep: folder.sleep}
+}
+
+func (folder *RetryingFolder) ListFolder() (objects []Object, subFolders []Folder, err error) {
+	err = folder.retry("list", "", func() error {
+		objects, subFolders, err = folder.Folder.ListFolder()
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, subFolder := range subFolders {
+		subFolders[i] = folder.wrap(subFolder)
+	}
+	return objects, subFolders, nil
+}
+
+// ListFolderStream restarts the listing which failed transiently, the restarted listing skips the objects
+// and the subfolders already passed to the callback, so only their names are kept. The error returned
+// by the callback isn't retried.
+func (folder *RetryingFolder) ListFolderStream(callback ListCallback) error {
+	passedObjects := make(map[string]bool)
+	passedSubFolders := make(map[string]bool)
+	var callbackErr error
+	err := folder.retry("list", "", func() error {
+		listErr := ListFolderStream(folder.Folder, func(object Object, subFolder Folder) error {
+			if subFolder != nil {
+				if passedSubFolders[subFolder.GetPath()] {
+					return nil
+				}
+				passedSubFolders[subFolder.GetPath()] = true
+				callbackErr = callback(nil, folder.wrap(subFolder))
+				return callbackErr
+			}
+			if passedObjects[object.GetName()] {
+				return nil
+			}
+			passedObjects[object.GetName()] = true
+			callbackErr = callback(object, nil)
+			return callbackErr
+		})
+		if callbackErr != nil {
+			return nil
+		}
+		return listErr
+	})
+	if callbackErr != nil {
+		return callbackErr
+	}
+	return err
+}
+
+func (folder *RetryingFolder) DeleteObjects(objectRelativePaths []string) error {
+	return folder.retry("delete objects", "", func() error {
+		return folder.Folder.DeleteObjects(objectRelativePaths)
+	})
+}
+
+func (folder *RetryingFolder) Exists(objectRelativePath string) (exists bool, err error) {
+	err = folder.retry("check", objectRelativePath, func() error {
+		exists, err = folder.Folder.Exists(objectRelativePath)
+		return err
+	})
+	return exists, err
+}
+
+func (folder *RetryingFolder) GetSubFolder(subFolderRelativePath string) Folder {
+	return folder.wrap(folder.Folder.GetSubFolder(subFolderRelativePath))
+}
+
+// ReadObject retries opening the object, the failures while the reader is read are left to the caller
+func (folder *RetryingFolder) ReadObject(objectRelativePath string) (reader io.ReadCloser, err error) {
+	err = folder.retry("read", objectRelativePath, func() error {
+		reader, err = folder.Folder.ReadObject(objectRelativePath)
+		return err
+	})
+	return reader, err
+}
+
+// RangeReader retries opening the part of the object, the folders which can't read it
+// from the offset read the object from the beginning
+func (folder *RetryingFolder) RangeReader(objectRelativePath string, offset, length int64) (reader io.ReadCloser, err error) {
+	err = folder.retry("read", objectRelativePath, func() error {
+		reader, err = ReadObjectRange(folder.Folder, objectRelativePath, offset, length)
+		return err
+	})
+	return reader, err
+}
+
+func (folder *RetryingFolder) GetObjectVersion(objectRelativePath string) (version ObjectVersion, err error) {
+	err = folder.retry("check version", objectRelativePath, func() error {
+		version, err = GetObjectVersion(folder.Folder, objectRelativePath)
+		return err
+	})
+	return version, err
+}
+
+// PinnedRangeReader retries opening the part of the object version, ObjectChangedError isn't retried
+func (folder *RetryingFolder) PinnedRangeReader(objectRelativePath string, offset, length int64,
+	version ObjectVersion) (reader io.ReadCloser, err error) {
+	err = folder.retry("read", objectRelativePath, func() error {
+		reader, err = ReadPinnedObjectRange(folder.Folder, objectRelativePath, offset, length, version)
+		return err
+	})
+	return reader, err
+}
+
+func (folder *RetryingFolder) GetObjectTier(objectRelativePath string) (tier ObjectTier, err error) {
+	err = folder.retry("check tier", objectRelativePath, func() error {
+		tier, err = GetObjectTier(folder.Folder, objectRelativePath)
+		return err
+	})
+	return tier, err
+}
+
+func (folder *RetryingFolder) Rehydrate(objectRelativePath string, options RehydrateOptions) error {
+	return folder.retry("rehydrate", objectRelativePath, func() error {
+		return RehydrateObject(folder.Folder, objectRelativePath, options)
+	})
+}
+
+func (folder *RetryingFolder) CopyObject(srcPath string, dstPath string) error {
+	return folder.retry("copy", srcPath, func() error {
+		return folder.Folder.CopyObject(srcPath, dstPath)
+	})
+}
+
+// retry returns the error of the last attempt as is, so the callers still recognize ObjectNotFoundError
+func (folder *RetryingFolder) retry(operation, objectRelativePath string, attempt func() error) error {
+	deadline := time.Now().Add(folder.options.Timeout)
+	delayBound := retryMinDelay
+	for attemptNumber := 1; ; attemptNumber++ {
+		err := attempt()
+		if err == nil || attemptNumber >= folder.options.MaxAttempts || !folder.isRetryable(err) {
+			return err
+		}
+		delay := time.Duration(rand.Int63n(int64(delayBound)))
+		if folder.options.Timeout > 0 && time.Now().Add(delay).After(deadline) {
+			return err
+		}
+		tracelog.DebugLogger.Printf("Attempt %d of %d to %s %s failed, retrying in %v: %v",
+			attemptNumber, folder.options.MaxAttempts, operation, folder.GetPath()+objectRelativePath, delay, err)
+		folder.sleep(delay)
+		delayBound *= 2
+		if delayBound > retryMaxDelay {
+			delayBound = retryMaxDelay
+		}
+	}
+}
+
+func (folder *RetryingFolder) isRetryable(err error) bool {
+	return isTransientError(err, folder.options.IsRetryable)
+}
+
+// isTransientError recognizes the network errors and the errors accepted by isRetryable of the backend,
+// the missing, archived or changed object and the canceled operation are never transient
+func isTransientError(err error, isRetryable func(error) bool) bool {
+	var notFoundError ObjectNotFoundError
+	var archivedError ObjectArchivedError
+	var changedError ObjectChangedError
+	if errors.As(err, &notFoundError) || errors.As(err, &archivedError) || errors.As(err, &changedError) ||
+		errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netError net.Error
+	if errors.As(err, &netError) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	return isRetryable != nil && isRetryable(err)
+}
@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errThrottled = errors.New("SlowDown: please reduce your request rate")
+
+// flakyFolder fails the first calls of every operation with the queued errors
+type flakyFolder struct {
+	Folder
+	path   string
+	errors []error
+	calls  int
+}
+
+func (folder *flakyFolder) fail() error {
+	folder.calls++
+	if len(folder.errors) == 0 {
+		return nil
+	}
+	err := folder.errors[0]
+	folder.errors = folder.errors[1:]
+	return err
+}
+
+func (folder *flakyFolder) GetPath() string {
+	return folder.path
+}
+
+func (folder *flakyFolder) GetSubFolder(subFolderRelativePath string) Folder {
+	return &flakyFolder{path: JoinPath(folder.path, subFolderRelativePath) + "/"}
+}
+
+func (folder *flakyFolder) ReadObject(objectRelativePath string) (io.ReadCloser, error) {
+	if err := folder.fail(); err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(strings.NewReader(objectRelativePath)), nil
+}
+
+func (folder *flakyFolder) ListFolder() ([]Object, []Folder, error) {
+	if err := folder.fail(); err != nil {
+		return nil, nil, err
+	}
+	return []Object{NewLocalObject("object", time.Time{}, 0)}, []Folder{folder.GetSubFolder("sub")}, nil
+}
+
+func (folder *flakyFolder) PutObject(name string, content io.Reader) error {
+	return folder.fail()
+}
+
+func newTestRetryingFolder(folder Folder, options RetryOptions) (*RetryingFolder, *[]time.Duration) {
+	if options.IsRetryable == nil {
+		options.IsRetryable = func(err error) bool { return errors.Is(err, errThrottled) }
+	}
+	var delays []time.Duration
+	retrying := NewRetryingFolder(folder, options).(*RetryingFolder)
+	retrying.sleep = func(delay time.Duration) { delays = append(delays, delay) }
+	return retrying, &delays
+}
+
+func TestRetryingFolder_retriesTransientErrors(t *testing.T) {
+	flaky := &flakyFolder{path: "bucket/", errors: []error{
+		errors.Wrap(syscall.ECONNRESET, "read tcp"),
+		NewError(errThrottled, "S3", "failed to read object"),
+		io.ErrUnexpectedEOF,
+	}}
+	folder, delays := newTestRetryingFolder(flaky, RetryOptions{MaxAttempts: 4})
+
+	reader, err := folder.ReadObject("backup_sentinel.json")
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "backup_sentinel.json", string(data))
+	assert.Equal(t, 4, flaky.calls)
+	require.Len(t, *delays, 3)
+	for i, delay := range *delays {
+		assert.Less(t, int64(delay), int64(retryMinDelay)<<i)
+	}
+}
+
+func TestRetryingFolder_givesUp(t *testing.T) {
+	flaky := &flakyFolder{path: "bucket/", errors: []error{errThrottled, errThrottled, errThrottled}}
+	folder, _ := newTestRetryingFolder(flaky, RetryOptions{MaxAttempts: 2})
+	_, err := folder.ReadObject("file")
+	assert.Equal(t, errThrottled, err)
+	assert.Equal(t, 2, flaky.calls)
+
+	flaky = &flakyFolder{path: "bucket/", errors: []error{errThrottled, errThrottled}}
+	folder, delays := newTestRetryingFolder(flaky, RetryOptions{MaxAttempts: 10, Timeout: time.Millisecond})
+	_, err = folder.ReadObject("file")
+	assert.Equal(t, errThrottled, err)
+	assert.LessOrEqual(t, flaky.calls, 2)
+	for _, delay := range *delays {
+		assert.Less(t, int64(delay), int64(time.Millisecond))
+	}
+}
+
+func TestRetryingFolder_permanentErrors(t *testing.T) {
+	for _, permanent := range []error{
+		NewObjectNotFoundError("bucket/file"),
+		errors.Wrap(context.Canceled, "read"),
+		errors.New("AccessDenied"),
+	} {
+		flaky := &flakyFolder{path: "bucket/", errors: []error{permanent}}
+		folder, _ := newTestRetryingFolder(flaky, RetryOptions{MaxAttempts: 5})
+		_, err := folder.ReadObject("file")
+		assert.Equal(t, permanent, err)
+		assert.Equal(t, 1, flaky.calls)
+	}
+}
+
+func TestRetryingFolder_subFolders(t *testing.T) {
+	flaky := &flakyFolder{path: "bucket/", errors: []error{errThrottled}}
+	folder, _ := newTestRetryingFolder(flaky, RetryOptions{MaxAttempts: 2})
+
+	objects, subFolders, err := folder.ListFolder()
+	require.NoError(t, err)
+	assert.Len(t, objects, 1)
+	require.Len(t, subFolders, 1)
+	assert.IsType(t, &RetryingFolder{}, subFolders[0])
+	assert.Equal(t, "bucket/sub/", subFolders[0].GetPath())
+	assert.IsType(t, &RetryingFolder{}, folder.GetSubFolder("basebackups_005"))
+}
+
+func TestRetryingFolder_putIsNotRetried(t *testing.T) {
+	flaky := &flakyFolder{path: "bucket/", errors: []error{errThrottled}}
+	folder, _ := newTestRetryingFolder(flaky, RetryOptions{MaxAttempts: 3})
+	assert.Equal(t, errThrottled, folder.PutObject("file", strings.NewReader("data")))
+	assert.Equal(t, 1, flaky.calls)
+}
+
+func TestNewRetryingFolder_disabled(t *testing.T) {
+	flaky := &flakyFolder{path: "bucket/"}
+	assert.Equal(t, Folder(flaky), NewRetryingFolder(flaky, RetryOptions{MaxAttempts: 1}))
+}
+
+// midStreamFailingFolder lists one object and then fails the stream with the queued errors
+type midStreamFailingFolder struct {
+	flakyFolder
+}
+
+func (folder *midStreamFailingFolder) ListFolderStream(callback ListCallback) error {
+	if err := callback(NewLocalObject("object", time.Time{}, 0), nil); err != nil {
+		return err
+	}
+	return folder.fail()
+}
+
+func TestRetryingFolder_listFolderStream(t *testing.T) {
+	flaky := &flakyFolder{path: "bucket/", errors: []error{errThrottled}}
+	folder, _ := newTestRetryingFolder(flaky, RetryOptions{MaxAttempts: 2})
+	var objects []Object
+	var subFolders []Folder
+	err := ListFolderStream(folder, func(object Object, subFolder Folder) error {
+		if subFolder != nil {
+			subFolders = append(subFolders, subFolder)
+		} else {
+			objects = append(objects, object)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, flaky.calls)
+	assert.Len(t, objects, 1)
+	require.Len(t, subFolders, 1)
+	assert.IsType(t, &RetryingFolder{}, subFolders[0])
+
+	// the stream failing after the objects passed to the callback is restarted and skips them
+	midStream := &midStreamFailingFolder{flakyFolder{path: "bucket/", errors: []error{errThrottled}}}
+	folder, _ = newTestRetryingFolder(midStream, RetryOptions{MaxAttempts: 2})
+	listed := 0
+	err = ListFolderStream(folder, func(Object, Folder) error {
+		listed++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, midStream.calls)
+	assert.Equal(t, 1, listed)
+
+	// the error of the callback isn't retried even if it looks transient
+	flaky = &flakyFolder{path: "bucket/"}
+	folder, _ = newTestRetryingFolder(flaky, RetryOptions{MaxAttempts: 2})
+	err = ListFolderStream(folder, func(Object, Folder) error {
+		return errThrottled
+	})
+	assert.Equal(t, errThrottled, err)
+	assert.Equal(t, 1, flaky.calls)
+}
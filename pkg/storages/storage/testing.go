@@ -25,6 +25,19 @@ func RunFolderTest(storageFolder Folder, t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, token, all)
 
+	for _, byteRange := range [][2]int64{{1000, 24}, {512 * 1024, -1}, {0, 1}} {
+		rangeReader, err := ReadObjectRange(storageFolder, "file0", byteRange[0], byteRange[1])
+		assert.NoError(t, err)
+		part, err := ioutil.ReadAll(rangeReader)
+		assert.NoError(t, err)
+		end := int64(len(token))
+		if byteRange[1] >= 0 {
+			end = byteRange[0] + byteRange[1]
+		}
+		assert.Equal(t, token[byteRange[0]:end], part, byteRange)
+		assert.NoError(t, rangeReader.Close())
+	}
+
 	err = sub1.PutObject("file1", strings.NewReader("data1"))
 	assert.NoError(t, err)
 
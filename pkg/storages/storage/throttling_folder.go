@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"expvar"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wal-g/tracelog"
+	"golang.org/x/time/rate"
+)
+
+var (
+	throttledCalls    int64
+	throttledWaitNano int64
+)
+
+func init() {
+	expvar.Publish("walg_storage_throttle", expvar.Func(func() interface{} {
+		return GetThrottleStats()
+	}))
+}
+
+// ThrottleStats sums up the waits of all the throttled storage requests of the process
+type ThrottleStats struct {
+	ThrottledCalls int64         `json:"throttled_calls"`
+	WaitTime       time.Duration `json:"wait_time_ns"`
+}
+
+func GetThrottleStats() ThrottleStats {
+	return ThrottleStats{
+		ThrottledCalls: atomic.LoadInt64(&throttledCalls),
+		WaitTime:       time.Duration(atomic.LoadInt64(&throttledWaitNano)),
+	}
+}
+
+// RequestPacer is called before every request of the folder operation which takes several requests
+type RequestPacer func(operation, objectRelativePath string) error
+
+// PacedFolder is implemented by the folders which list the objects page by page or upload them part by part,
+// so one ListFolder or PutObject call makes many requests. WithRequestPacer returns the copy of the folder
+// which calls the pacer before every request of these operations.
+type PacedFolder interface {
+	Folder
+	WithRequestPacer(pacer RequestPacer) Folder
+}
+
+// ThrottlingFolder waits for the limiter before every request to the storage. The limiter is usually shared
+// by all the folders of the process, so it caps the request rate regardless of the concurrency.
+// The listing and the upload wait before every page and part if the folder is a PacedFolder,
+// otherwise they wait once, before the first request.
+type ThrottlingFolder struct {
+	Folder
+	limiter *rate.Limiter
+	// paced is the copy of Folder waiting before every page and part, or nil
+	paced Folder
+}
+
+func NewThrottlingFolder(folder Folder, limiter *rate.Limiter) *ThrottlingFolder {
+	throttlingFolder := &ThrottlingFolder{Folder: folder, limiter: limiter}
+	if pacedFolder, ok := folder.(PacedFolder); ok {
+		throttlingFolder.paced = pacedFolder.WithRequestPacer(throttlingFolder.wait)
+	}
+	return throttlingFolder
+}
+
+func (folder *ThrottlingFolder) wait(operation, objectRelativePath string) error {
+	reservation := folder.limiter.Reserve()
+	if !reservation.OK() {
+		return errors.Errorf("storage request rate limit doesn't allow to %s %s",
+			operation, folder.GetPath()+objectRelativePath)
+	}
+	delay := reservation.Delay()
+	if delay <= 0 {
+		return nil
+	}
+	atomic.AddInt64(&throttledCalls, 1)
+	atomic.AddInt64(&throttledWaitNano, int64(delay))
+	tracelog.DebugLogger.Printf("Throttling %s %s for %v", operation, folder.GetPath()+objectRelativePath, delay)
+	time.Sleep(delay)
+	return nil
+}
+
+func (folder *ThrottlingFolder) ListFolder() (objects []Object, subFolders []Folder, err error) {
+	if folder.paced != nil {
+		objects, subFolders, err = folder.paced.ListFolder()
+	} else if err = folder.wait("list", ""); err == nil {
+		objects, subFolders, err = folder.Folder.ListFolder()
+	}
+	for i, subFolder := range subFolders {
+		subFolders[i] = NewThrottlingFolder(subFolder, folder.limiter)
+	}
+	return objects, subFolders, err
+}
+
+func (folder *ThrottlingFolder) ListFolderStream(callback ListCallback) error {
+	listedFolder := folder.paced
+	if listedFolder == nil {
+		if err := folder.wait("list", ""); err != nil {
+			return err
+		}
+		listedFolder = folder.Folder
+	}
+	return ListFolderStream(listedFolder, func(object Object, subFolder Folder) error {
+		if subFolder != nil {
+			subFolder = NewThrottlingFolder(subFolder, folder.limiter)
+		}
+		return callback(object, subFolder)
+	})
+}
+
+func (folder *ThrottlingFolder) DeleteObjects(objectRelativePaths []string) error {
+	if err := folder.wait("delete objects", ""); err != nil {
+		return err
+	}
+	return folder.Folder.DeleteObjects(objectRelativePaths)
+}
+
+func (folder *ThrottlingFolder) Exists(objectRelativePath string) (bool, error) {
+	if err := folder.wait("check", objectRelativePath); err != nil {
+		return false, err
+	}
+	return folder.Folder.Exists(objectRelativePath)
+}
+
+func (folder *ThrottlingFolder) GetSubFolder(subFolderRelativePath string) Folder {
+	return NewThrottlingFolder(folder.Folder.GetSubFolder(subFolderRelativePath), folder.limiter)
+}
+
+func (folder *ThrottlingFolder) ReadObject(objectRelativePath string) (io.ReadCloser, error) {
+	if err := folder.wait("read", objectRelativePath); err != nil {
+		return nil, err
+	}
+	return folder.Folder.ReadObject(objectRelativePath)
+}
+
+func (folder *ThrottlingFolder) RangeReader(objectRelativePath string, offset, length int64) (io.ReadCloser, error) {
+	if err := folder.wait("read", objectRelativePath); err != nil {
+		return nil, err
+	}
+	return ReadObjectRange(folder.Folder, objectRelativePath, offset, length)
+}
+
+func (folder *ThrottlingFolder) GetObjectVersion(objectRelativePath string) (ObjectVersion, error) {
+	if err := folder.wait("check version", objectRelativePath); err != nil {
+		return ObjectVersion{}, err
+	}
+	return GetObjectVersion(folder.Folder, objectRelativePath)
+}
+
+func (folder *ThrottlingFolder) PinnedRangeReader(objectRelativePath string, offset, length int64,
+	version ObjectVersion) (io.ReadCloser, error) {
+	if err := folder.wait("read", objectRelativePath); err != nil {
+		return nil, err
+	}
+	return ReadPinnedObjectRange(folder.Folder, objectRelativePath, offset, length, version)
+}
+
+func (folder *ThrottlingFolder) GetObjectTier(objectRelativePath string) (ObjectTier, error) {
+	if err := folder.wait("check tier", objectRelativePath); err != nil {
+		return ObjectTier{}, err
+	}
+	return GetObjectTier(folder.Folder, objectRelativePath)
+}
+
+func (folder *ThrottlingFolder) Rehydrate(objectRelativePath string, options RehydrateOptions) error {
+	if err := folder.wait("rehydrate", objectRelativePath); err != nil {
+		return err
+	}
+	return RehydrateObject(folder.Folder, objectRelativePath, options)
+}
+
+func (folder *ThrottlingFolder) PutObject(name string, content io.Reader) error {
+	if folder.paced != nil {
+		return folder.paced.PutObject(name, content)
+	}
+	if err := folder.wait("put", name); err != nil {
+		return err
+	}
+	return folder.Folder.PutObject(name, content)
+}
+
+func (folder *ThrottlingFolder) CopyObject(srcPath string, dstPath string) error {
+	if err := folder.wait("copy", srcPath); err != nil {
+		return err
+	}
+	return folder.Folder.CopyObject(srcPath, dstPath)
+}
@@ -0,0 +1,57 @@
+package storage_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wal-g/wal-g/pkg/storages/memory"
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+	"golang.org/x/time/rate"
+)
+
+func TestThrottlingFolder_pacesRequests(t *testing.T) {
+	limiter := rate.NewLimiter(rate.Every(10*time.Millisecond), 1)
+	folder := storage.NewThrottlingFolder(memory.NewFolder("", memory.NewStorage()), limiter)
+	statsBefore := storage.GetThrottleStats()
+
+	start := time.Now()
+	require.NoError(t, folder.PutObject("sub/object", strings.NewReader("data")))
+	subFolder := folder.GetSubFolder("sub")
+	assert.IsType(t, &storage.ThrottlingFolder{}, subFolder)
+	exists, err := subFolder.Exists("object")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	objects, subFolders, err := folder.ListFolder()
+	require.NoError(t, err)
+	assert.Empty(t, objects)
+	require.Len(t, subFolders, 1)
+	assert.IsType(t, &storage.ThrottlingFolder{}, subFolders[0])
+
+	// the first request takes the burst, the other two wait for the limiter
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(15*time.Millisecond))
+	stats := storage.GetThrottleStats()
+	assert.Equal(t, int64(2), stats.ThrottledCalls-statsBefore.ThrottledCalls)
+	assert.Greater(t, int64(stats.WaitTime-statsBefore.WaitTime), int64(0))
+}
+
+func TestThrottlingFolder_noBurst(t *testing.T) {
+	folder := storage.NewThrottlingFolder(memory.NewFolder("", memory.NewStorage()), rate.NewLimiter(1, 0))
+	_, err := folder.ReadObject("object")
+	assert.Error(t, err)
+}
+
+func TestCopyObjectBetween_throttledFolders(t *testing.T) {
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	source := storage.NewThrottlingFolder(memory.NewFolder("source/", memory.NewStorage()), limiter)
+	destination := storage.NewThrottlingFolder(memory.NewFolder("destination/", memory.NewStorage()), limiter)
+	require.NoError(t, source.PutObject("object", strings.NewReader("data")))
+
+	_, err := storage.CopyObjectBetween(source, "object", destination, "copied")
+	assert.NoError(t, err)
+	exists, err := destination.Exists("copied")
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
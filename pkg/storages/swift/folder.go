@@ -4,6 +4,7 @@ import (
 	"errors"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"strings"
 
@@ -13,13 +14,13 @@ import (
 	"github.com/ncw/swift"
 )
 
-var SettingList = []string{
+var SettingList = append([]string{
 	"OS_USERNAME",
 	"OS_PASSWORD",
 	"OS_AUTH_URL",
 	"OS_TENANT_NAME",
 	"OS_REGION_NAME",
-}
+}, storage.HTTPClientSettingList...)
 
 func NewError(err error, format string, args ...interface{}) storage.Error {
 	return storage.NewError(err, "Swift", format, args...)
@@ -44,6 +45,19 @@ func ConfigureFolder(prefix string, settings map[string]string) (storage.Folder,
 	if err != nil {
 		return nil, NewError(err, "Unable to apply env variables")
 	}
+	httpClientOptions, err := storage.ParseHTTPClientOptions(settings)
+	if err != nil {
+		return nil, err
+	}
+	if !httpClientOptions.IsDefault() {
+		connection.Transport, err = storage.NewHTTPTransport(httpClientOptions)
+		if err != nil {
+			return nil, err
+		}
+		if httpClientOptions.DialTimeout > 0 {
+			connection.ConnectTimeout = httpClientOptions.DialTimeout
+		}
+	}
 	err = connection.Authenticate()
 	if err != nil {
 		return nil, NewError(err, "Unable to authenticate connection")
@@ -181,3 +195,16 @@ func (folder *Folder) DeleteObjects(objectRelativePaths []string) error {
 	}
 	return nil
 }
+
+// IsRetryableError recognizes the timeouts, the rate limiting and the server errors of Swift
+func IsRetryableError(err error) bool {
+	var swiftErr *swift.Error
+	if !errors.As(err, &swiftErr) {
+		return false
+	}
+	switch swiftErr.StatusCode {
+	case swift.TimeoutError.StatusCode, swift.RateLimit.StatusCode, swift.TooManyRequests.StatusCode:
+		return true
+	}
+	return swiftErr.StatusCode >= http.StatusInternalServerError
+}
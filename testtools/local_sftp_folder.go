@@ -0,0 +1,47 @@
+package testtools
+
+import (
+	"io"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/wal-g/wal-g/pkg/storages/sh"
+)
+
+// pipeConnection is one side of the in-process SFTP connection
+type pipeConnection struct {
+	*io.PipeReader
+	*io.PipeWriter
+}
+
+func (connection pipeConnection) Close() error {
+	readErr := connection.PipeReader.Close()
+	if err := connection.PipeWriter.Close(); err != nil {
+		return err
+	}
+	return readErr
+}
+
+// NewLocalSftpFolder serves the local directory by the SFTP server running in the same process
+// and returns the folder which reads it through the SFTP client, so the tests of the storage users
+// go through the real SFTP protocol without SSH
+func NewLocalSftpFolder(t *testing.T, rootPath string) *sh.Folder {
+	serverReader, clientWriter := io.Pipe()
+	clientReader, serverWriter := io.Pipe()
+
+	server, err := sftp.NewServer(pipeConnection{serverReader, serverWriter})
+	assert.NoError(t, err)
+	go func() {
+		_ = server.Serve()
+	}()
+
+	client, err := sftp.NewClientPipe(clientReader, clientWriter)
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		// the client waits for the connection to be closed by the server
+		_ = server.Close()
+		_ = client.Close()
+	})
+	return sh.NewFolder(client, rootPath)
+}
@@ -0,0 +1,82 @@
+package testtools
+
+import (
+	"io"
+	"sync"
+
+	"github.com/wal-g/wal-g/pkg/storages/storage"
+)
+
+// MockArchiveTierFolder keeps the tiers of the objects of the wrapped folder, the archived objects
+// fail to be read until they are rehydrated. The rehydration requested is finished by FinishRehydration.
+type MockArchiveTierFolder struct {
+	storage.Folder
+	mutex      sync.Mutex
+	tiers      map[string]storage.ObjectTier
+	Rehydrated map[string]storage.RehydrateOptions
+}
+
+func NewMockArchiveTierFolder(folder storage.Folder) *MockArchiveTierFolder {
+	return &MockArchiveTierFolder{
+		Folder:     folder,
+		tiers:      make(map[string]storage.ObjectTier),
+		Rehydrated: make(map[string]storage.RehydrateOptions),
+	}
+}
+
+func (folder *MockArchiveTierFolder) Archive(objectRelativePath string) {
+	folder.mutex.Lock()
+	defer folder.mutex.Unlock()
+	folder.tiers[objectRelativePath] = storage.ObjectTier{StorageClass: "GLACIER", Archived: true}
+}
+
+// FinishRehydration makes the objects being rehydrated readable
+func (folder *MockArchiveTierFolder) FinishRehydration() {
+	folder.mutex.Lock()
+	defer folder.mutex.Unlock()
+	for path, tier := range folder.tiers {
+		if tier.Rehydrating {
+			folder.tiers[path] = storage.ObjectTier{StorageClass: tier.StorageClass, Archived: true, Rehydrated: true}
+		}
+	}
+}
+
+func (folder *MockArchiveTierFolder) GetObjectTier(objectRelativePath string) (storage.ObjectTier, error) {
+	exists, err := folder.Exists(objectRelativePath)
+	if err != nil {
+		return storage.ObjectTier{}, err
+	}
+	if !exists {
+		return storage.ObjectTier{}, storage.NewObjectNotFoundError(objectRelativePath)
+	}
+	folder.mutex.Lock()
+	defer folder.mutex.Unlock()
+	tier, ok := folder.tiers[objectRelativePath]
+	if !ok {
+		return storage.ObjectTier{StorageClass: "STANDARD"}, nil
+	}
+	return tier, nil
+}
+
+func (folder *MockArchiveTierFolder) Rehydrate(objectRelativePath string, options storage.RehydrateOptions) error {
+	folder.mutex.Lock()
+	defer folder.mutex.Unlock()
+	tier := folder.tiers[objectRelativePath]
+	if !tier.Archived || tier.Rehydrated || tier.Rehydrating {
+		return nil
+	}
+	tier.Rehydrating = true
+	folder.tiers[objectRelativePath] = tier
+	folder.Rehydrated[objectRelativePath] = options
+	return nil
+}
+
+func (folder *MockArchiveTierFolder) ReadObject(objectRelativePath string) (io.ReadCloser, error) {
+	folder.mutex.Lock()
+	tier := folder.tiers[objectRelativePath]
+	folder.mutex.Unlock()
+	if !tier.IsReadable() {
+		return nil, storage.NewObjectArchivedError(objectRelativePath)
+	}
+	return folder.Folder.ReadObject(objectRelativePath)
+}
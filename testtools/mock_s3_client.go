@@ -7,13 +7,14 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	walgs3 "github.com/wal-g/wal-g/pkg/storages/s3"
 )
 
 // Mock out S3 client. Includes these methods:
-// ListObjects(*ListObjectsV2Input)
+// ListObjectsV2PagesWithContext(*ListObjectsV2Input)
 // GetObject(*GetObjectInput)
 // HeadObject(*HeadObjectInput)
 type MockS3Client struct {
@@ -26,8 +27,8 @@ func NewMockS3Client(err, notFound bool) *MockS3Client {
 	return &MockS3Client{err: err, notFound: notFound}
 }
 
-func (client *MockS3Client) ListObjectsV2Pages(input *s3.ListObjectsV2Input,
-	callback func(*s3.ListObjectsV2Output, bool) bool) error {
+func (client *MockS3Client) ListObjectsV2PagesWithContext(_ aws.Context, input *s3.ListObjectsV2Input,
+	callback func(*s3.ListObjectsV2Output, bool) bool, _ ...request.Option) error {
 	if client.err {
 		return awserr.New("MockListObjects", "mock ListObjects errors", nil)
 	}
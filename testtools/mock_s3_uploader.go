@@ -5,6 +5,7 @@ import (
 	"io"
 	"io/ioutil"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
@@ -25,7 +26,7 @@ func (err mockMultiFailureError) Error() string {
 }
 
 // Mock out uploader client for S3. Includes these methods:
-// Upload(*UploadInput, ...func(*s3manager.Uploader))
+// UploadWithContext(Context, *UploadInput, ...func(*s3manager.Uploader))
 type MockS3Uploader struct {
 	s3manageriface.UploaderAPI
 	multiErr bool
@@ -37,7 +38,7 @@ func NewMockS3Uploader(multiErr, err bool, storage *memory.Storage) *MockS3Uploa
 	return &MockS3Uploader{multiErr: multiErr, err: err, storage: storage}
 }
 
-func (uploader *MockS3Uploader) Upload(input *s3manager.UploadInput,
+func (uploader *MockS3Uploader) UploadWithContext(_ aws.Context, input *s3manager.UploadInput,
 	f ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error) {
 	if uploader.err {
 		return nil, awserr.New("UploadFailed", "mock Upload error", nil)
@@ -89,7 +89,9 @@ func CreateMockStorageFolder() storage.Folder {
 	subFolder := folder.GetSubFolder(utility.BaseBackupPath)
 	subFolder.PutObject("base_123_backup_stop_sentinel.json", &bytes.Buffer{})         //nolint:errcheck
 	subFolder.PutObject("base_456_backup_stop_sentinel.json", strings.NewReader("{}")) //nolint:errcheck
-	subFolder.PutObject("base_000_backup_stop_sentinel.json", &bytes.Buffer{})         //nolint:errcheck// last put
+	// the storage timestamps are rounded to microseconds, so the last put may get the same time without the pause
+	time.Sleep(time.Millisecond)
+	subFolder.PutObject("base_000_backup_stop_sentinel.json", &bytes.Buffer{}) //nolint:errcheck// last put
 	// not a sentinel
 	subFolder.PutObject("base_123312", &bytes.Buffer{})               //nolint:errcheck
 	subFolder.PutObject("base_321/nop", &bytes.Buffer{})              //nolint:errcheck